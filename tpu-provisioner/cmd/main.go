@@ -18,13 +18,17 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"net/http"
 	"os"
 	"strings"
+	"text/template"
 	"time"
 
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/kelseyhightower/envconfig"
 	corev1 "k8s.io/api/core/v1"
@@ -40,16 +44,22 @@ import (
 	"cloud.google.com/go/compute/metadata"
 	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
 	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/controller"
-	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/webhook"
+	"golang.org/x/time/rate"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/config/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	crwebhook "sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -65,37 +75,535 @@ func init() {
 
 func main() {
 	var cfg struct {
-		// Provider can be "gke" or "mock".
+		// Provider can be "gke", "gke-fake" (computes node pools without
+		// calling GKE) or "noop" (only logs, also known as "mock"). It can
+		// be overridden with the --provider flag.
 		Provider string `envconfig:"PROVIDER" default:"gke"`
 
-		GCPProjectID          string `envconfig:"GCP_PROJECT_ID"`
-		GCPClusterLocation    string `envconfig:"GCP_CLUSTER_LOCATION"`
-		GCPZone               string `envconfig:"GCP_ZONE"`
-		GCPCluster            string `envconfig:"GCP_CLUSTER"`
-		GCPNodeServiceAccount string `envconfig:"GCP_NODE_SERVICE_ACCOUNT"`
+		GCPProjectID       string `envconfig:"GCP_PROJECT_ID"`
+		GCPClusterLocation string `envconfig:"GCP_CLUSTER_LOCATION"`
+		GCPZone            string `envconfig:"GCP_ZONE"`
+		// GCPZones are the zones to create node pools in, in order of
+		// preference. It defaults to GCPZone.
+		GCPZones              []string `envconfig:"GCP_ZONES"`
+		GCPCluster            string   `envconfig:"GCP_CLUSTER"`
+		GCPNodeServiceAccount string   `envconfig:"GCP_NODE_SERVICE_ACCOUNT"`
+		// GCPNodeServiceAccounts overrides GCPNodeServiceAccount per
+		// namespace, for example
+		// "team-a:team-a@my-project.iam.gserviceaccount.com".
+		GCPNodeServiceAccounts map[string]string `envconfig:"GCP_NODE_SERVICE_ACCOUNTS"`
+		GCPNodeOAuthScopes     []string          `envconfig:"GCP_NODE_OAUTH_SCOPES"`
 
 		GCPNodeTags          []string `envconfig:"GCP_NODE_TAGS"`
 		GCPNodeSecondaryDisk string   `envconfig:"GCP_NODE_SECONDARY_DISK" default:""`
+		// GCPNodeSpot makes node pools use Spot VMs by default. Pods can
+		// override this with the google.com/tpu-provisioner-spot annotation.
+		GCPNodeSpot bool `envconfig:"GCP_NODE_SPOT" default:"false"`
+		// GCPNodeReservation is the reservation that node pools consume by
+		// default, or "none" to explicitly not consume reservations.
+		GCPNodeReservation string `envconfig:"GCP_NODE_RESERVATION" default:""`
+		// GCPNodePlacementPolicy is the compact placement resource policy
+		// that multi-host TPU node pools use by default.
+		// GCPNodePlacementPolicies overrides it per accelerator type, for
+		// example "tpu-v5p-slice:my-v5p-policy,tpu-v4-podslice:none".
+		GCPNodePlacementPolicy   string            `envconfig:"GCP_NODE_PLACEMENT_POLICY" default:""`
+		GCPNodePlacementPolicies map[string]string `envconfig:"GCP_NODE_PLACEMENT_POLICIES"`
+
+		// NodePoolClassesPath is the path to a YAML file (usually a mounted
+		// ConfigMap) of node pool classes that Pods can select by name.
+		NodePoolClassesPath string `envconfig:"NODE_POOL_CLASSES_PATH" default:""`
+		// NodePoolTemplate is the name of a node pool in the cluster that
+		// new node pools copy everything from except what is derived from
+		// the Pod. NodePoolTemplateTTL is how long it is cached.
+		NodePoolTemplate    string        `envconfig:"NODE_POOL_TEMPLATE" default:""`
+		NodePoolTemplateTTL time.Duration `envconfig:"NODE_POOL_TEMPLATE_TTL" default:"10m"`
+		// AcceleratorDefaultsPath is the path to a YAML file (usually a
+		// mounted ConfigMap) of node pool defaults per TPU accelerator type.
+		AcceleratorDefaultsPath string `envconfig:"ACCELERATOR_DEFAULTS_PATH" default:""`
+		// IncompleteSelectorPolicy is what happens to TPU Pods that select
+		// only one of the accelerator type and topology: they are rejected
+		// ("reject") or the other one is filled in from the accelerator
+		// defaults ("default").
+		IncompleteSelectorPolicy string `envconfig:"INCOMPLETE_TPU_SELECTOR_POLICY" default:"reject"`
+		// PriceTablePath is the path to a YAML file (usually a mounted
+		// ConfigMap) of hourly prices per machine type, used to annotate
+		// Pods with the estimated cost of their node pools.
+		PriceTablePath string `envconfig:"PRICE_TABLE_PATH" default:""`
+
+		// GCPNodeAutoscalingMin and GCPNodeAutoscalingMax are the default
+		// cluster autoscaling bounds of node pools. A zero maximum disables
+		// autoscaling unless the Pod sets one.
+		GCPNodeAutoscalingMin int `envconfig:"GCP_NODE_AUTOSCALING_MIN" default:"0"`
+		GCPNodeAutoscalingMax int `envconfig:"GCP_NODE_AUTOSCALING_MAX" default:"0"`
+
+		// GCPNodeDiskSizeGB and GCPNodeDiskType are the default boot disk of
+		// nodes. Zero values use the GKE defaults.
+		GCPNodeDiskSizeGB int64  `envconfig:"GCP_NODE_DISK_SIZE_GB" default:"0"`
+		GCPNodeDiskType   string `envconfig:"GCP_NODE_DISK_TYPE" default:""`
+		// GCPNodeImageType is the default node image type. It is set
+		// explicitly because TPU device plugins depend on the image.
+		GCPNodeImageType string `envconfig:"GCP_NODE_IMAGE_TYPE" default:"COS_CONTAINERD"`
+
+		// GCPNodeMinCPUPlatform is the default minimum CPU platform of nodes
+		// and GCPNodeConfidential enables Confidential GKE Nodes by default.
+		GCPNodeMinCPUPlatform string `envconfig:"GCP_NODE_MIN_CPU_PLATFORM"`
+		GCPNodeConfidential   bool   `envconfig:"GCP_NODE_CONFIDENTIAL_NODES" default:"false"`
+		// GCPNodeSandbox is the default GKE Sandbox type of nodes ("gvisor"),
+		// empty for none. Pods opt in with an annotation instead by default.
+		GCPNodeSandbox string `envconfig:"GCP_NODE_SANDBOX" default:""`
+
+		// GCPNodeLocalSSDCount is the default number of local SSDs per node.
+		// With GCPNodeLocalSSDEphemeral they back ephemeral storage,
+		// otherwise they are attached as raw scratch disks.
+		GCPNodeLocalSSDCount     int  `envconfig:"GCP_NODE_LOCAL_SSD_COUNT" default:"0"`
+		GCPNodeLocalSSDEphemeral bool `envconfig:"GCP_NODE_LOCAL_SSD_EPHEMERAL" default:"true"`
+
+		// GCPNodeNetwork and GCPNodeSubnetwork are the default additional
+		// network of nodes, GCPNodePodRange is the default secondary range
+		// for Pod IPs. Empty values use the cluster network.
+		GCPNodeNetwork    string `envconfig:"GCP_NODE_NETWORK" default:""`
+		GCPNodeSubnetwork string `envconfig:"GCP_NODE_SUBNETWORK" default:""`
+		GCPNodePodRange   string `envconfig:"GCP_NODE_POD_RANGE" default:""`
+		// GCPNodeGvnic enables gVNIC on all nodes, otherwise only where the
+		// machine type or network interfaces require it.
+		// GCPNodeAdditionalNetworks are the default network interfaces
+		// attached after the additional network, comma-separated
+		// network:subnetwork pairs.
+		GCPNodeGvnic              bool   `envconfig:"GCP_NODE_GVNIC" default:"false"`
+		GCPNodeAdditionalNetworks string `envconfig:"GCP_NODE_ADDITIONAL_NETWORKS" default:""`
+		// GCPNodeMaxPodsPerNode is the default maximum number of Pods per
+		// node, which sizes the Pod IP range of each node. GCPClusterPodCIDR
+		// is the cluster's Pod IPv4 range that it is checked against, read
+		// from the cluster with GKEValidateCluster if it is empty.
+		GCPNodeMaxPodsPerNode int    `envconfig:"GCP_NODE_MAX_PODS_PER_NODE" default:"15"`
+		GCPClusterPodCIDR     string `envconfig:"GCP_CLUSTER_POD_CIDR" default:""`
+		// GCPNodeResourceManagerTags are comma-separated resource manager
+		// tag bindings of all nodes, for example
+		// "tagKeys/281475012345678=tagValues/281479012345678" or
+		// "123456789012/env=prod", see cloud.ParseResourceManagerTags.
+		GCPNodeResourceManagerTags string `envconfig:"GCP_NODE_RESOURCE_MANAGER_TAGS" default:""`
+		// GCPNetworkProjectID is the project of the node networks, for
+		// example a Shared VPC host project, and GCPReservationProjectID the
+		// project of shared reservations. Both default to GCPProjectID.
+		GCPNetworkProjectID     string `envconfig:"GCP_NETWORK_PROJECT_ID" default:""`
+		GCPReservationProjectID string `envconfig:"GCP_RESERVATION_PROJECT_ID" default:""`
+
+		// GCPNodeVersion is the GKE version of node pools, for example
+		// "1.29.1-gke.1589017", "latest" or "current-control-plane". Empty
+		// uses the GKE default.
+		GCPNodeVersion string `envconfig:"GCP_NODE_VERSION" default:""`
+		// GCPNodeAutoUpgrade and GCPNodeAutoRepair are the default
+		// management settings of node pools. GCPClusterReleaseChannel is the
+		// release channel of the cluster, if any, which requires
+		// auto-upgrade.
+		GCPNodeAutoUpgrade       bool   `envconfig:"GCP_NODE_AUTO_UPGRADE" default:"true"`
+		GCPNodeAutoRepair        bool   `envconfig:"GCP_NODE_AUTO_REPAIR" default:"true"`
+		GCPClusterReleaseChannel string `envconfig:"GCP_CLUSTER_RELEASE_CHANNEL"`
+
+		// NodePoolNameTemplate is a Go text/template used to name node pools,
+		// evaluated against cloud.NodePoolNameData. For example:
+		// "{{ .Namespace }}-{{ .JobSetName }}-{{ .Suffix }}"
+		NodePoolNameTemplate string `envconfig:"NODE_POOL_NAME_TEMPLATE" default:""`
+
+		// PropagatePodLabels are the keys of Pod labels to copy onto created
+		// node pools (for example, "team,cost-center").
+		PropagatePodLabels []string `envconfig:"PROPAGATE_POD_LABELS"`
+
+		// NamespaceAllowlist and NamespaceDenylist are comma-separated glob
+		// patterns of namespaces that are (not) allowed to trigger node pool
+		// creation. An empty allowlist allows all namespaces.
+		NamespaceAllowlist []string `envconfig:"NAMESPACE_ALLOWLIST"`
+		NamespaceDenylist  []string `envconfig:"NAMESPACE_DENYLIST"`
+
+		// AcceleratorAllowlist is a comma-separated list of glob patterns of
+		// the accelerator types that node pools can be created for. An empty
+		// list allows all accelerator types. AcceleratorAllowlistPath, if
+		// set, is a YAML file (usually a mounted ConfigMap) with the list
+		// instead, which is reloaded when it changes.
+		AcceleratorAllowlist     []string `envconfig:"ACCELERATOR_ALLOWLIST"`
+		AcceleratorAllowlistPath string   `envconfig:"ACCELERATOR_ALLOWLIST_PATH" default:""`
+
+		// PodLabelSelector, if set, restricts the Pods that trigger node
+		// pool creation to those matching this label selector, for example
+		// "team=ml-research" or "team in (ml-research,ml-infra)".
+		PodLabelSelector string `envconfig:"POD_LABEL_SELECTOR"`
+
+		// OwnerLabelKey and OwnerLabelValue are the GCP resource label that
+		// marks the node pools that this provisioner manages. Their Nodes
+		// carry it with the "google.com/" prefix. Provisioners that share a
+		// cluster must use different values.
+		OwnerLabelKey   string `envconfig:"OWNER_LABEL_KEY" default:"nodepool-manager"`
+		OwnerLabelValue string `envconfig:"OWNER_LABEL_VALUE" default:"tpu-provisioner"`
+
+		// PodSkipAnnotation is the annotation that Pods set to "true" to
+		// opt out of node pool creation. Empty disables the opt-out.
+		PodSkipAnnotation string `envconfig:"POD_SKIP_ANNOTATION" default:"google.com/tpu-provisioner-skip"`
+
+		// DefaultTPUTaints are applied to TPU node pools when the Pod does not
+		// specify taints via annotation. Same format as kubectl taint.
+		DefaultTPUTaints string `envconfig:"DEFAULT_TPU_TAINTS" default:"google.com/tpu=present:NoSchedule"`
+		// NodePoolBaseTaints are applied to all node pools, in addition to
+		// the default or annotation taints.
+		NodePoolBaseTaints string `envconfig:"NODE_POOL_BASE_TAINTS"`
 
 		// NodeMinLifespan is the amount of time that should pass between a Node object
 		// creation and a cleanup of that Node. This needs to be long enough to allow
 		// the node to become Ready and for a pending Pod to be scheduled on it.
 		NodeMinLifespan time.Duration `envconfig:"NODE_MIN_LIFESPAN" default:"3m"`
 
-		PodResourceType string `envconfig:"POD_RESOURCE_TYPE" default:"google.com/tpu"`
+		// NodePoolIdleDuration is how long a node pool must go without any TPU Pods
+		// scheduled on it before the garbage collector deletes it.
+		// Zero disables the garbage collector.
+		NodePoolIdleDuration time.Duration `envconfig:"NODE_POOL_IDLE_DURATION" default:"0s"`
+		NodePoolGCInterval   time.Duration `envconfig:"NODE_POOL_GC_INTERVAL" default:"1m"`
+		NodePoolGCDryRun     bool          `envconfig:"NODE_POOL_GC_DRY_RUN" default:"false"`
+		// NodePoolDrain makes the garbage collector cordon the Nodes of idle
+		// node pools and evict their Pods before deleting them. If that takes
+		// longer than NodePoolDrainTimeout, NodePoolDrainTimeoutAction
+		// ("delete" or "skip") applies.
+		NodePoolDrain              bool          `envconfig:"NODE_POOL_DRAIN" default:"false"`
+		NodePoolDrainTimeout       time.Duration `envconfig:"NODE_POOL_DRAIN_TIMEOUT" default:"5m"`
+		NodePoolDrainTimeoutAction string        `envconfig:"NODE_POOL_DRAIN_TIMEOUT_ACTION" default:"delete"`
+
+		// NodePoolSweepInterval is the time between the sweeps of all node
+		// pools that reconcile pending Pods again and delete orphaned node
+		// pools after NodePoolSweepOrphanGracePeriod (zero keeps them). Sweeps take at most NodePoolSweepMaxActions actions, at
+		// NodePoolSweepQPS. Zero disables the sweep.
+		NodePoolSweepInterval          time.Duration `envconfig:"NODE_POOL_SWEEP_INTERVAL" default:"0s"`
+		NodePoolSweepOrphanGracePeriod time.Duration `envconfig:"NODE_POOL_SWEEP_ORPHAN_GRACE_PERIOD" default:"30m"`
+		NodePoolSweepQPS               float64       `envconfig:"NODE_POOL_SWEEP_QPS" default:"1"`
+		NodePoolSweepMaxActions        int           `envconfig:"NODE_POOL_SWEEP_MAX_ACTIONS" default:"50"`
+		NodePoolSweepDryRun            bool          `envconfig:"NODE_POOL_SWEEP_DRY_RUN" default:"false"`
+
+		// ProviderHealthCheckInterval is the time between the node pool
+		// listings that the readiness check uses to verify that the
+		// provider is reachable. The check fails after
+		// ProviderHealthCheckFailureThreshold consecutive failures. Zero
+		// disables the check.
+		ProviderHealthCheckInterval         time.Duration `envconfig:"PROVIDER_HEALTH_CHECK_INTERVAL" default:"1m"`
+		ProviderHealthCheckFailureThreshold int           `envconfig:"PROVIDER_HEALTH_CHECK_FAILURE_THRESHOLD" default:"3"`
+
+		// PodResourceTypes are the comma-separated names of the TPU
+		// resource, for clusters where Pods use more than one.
+		PodResourceTypes []string `envconfig:"POD_RESOURCE_TYPE" default:"google.com/tpu"`
+		// PodGPUResourceType enables provisioning of GPU node pools for Pods
+		// requesting this resource, for example "nvidia.com/gpu".
+		PodGPUResourceType string `envconfig:"POD_GPU_RESOURCE_TYPE" default:""`
+
+		// MaxNodePools limits the number of node pools that the provisioner
+		// manages at once. Zero means no limit.
+		MaxNodePools int `envconfig:"MAX_NODE_POOLS" default:"0"`
+
+		// NodePoolRecreateCooldown is how long after deleting a node pool
+		// no node pool with the same namespace, machine type and topology is
+		// created. Zero disables the cooldown.
+		NodePoolRecreateCooldown time.Duration `envconfig:"NODE_POOL_RECREATE_COOLDOWN" default:"0s"`
+
+		// NodePoolZoneFallback creates a node pool in the next of its zones
+		// when the previous one is out of capacity.
+		NodePoolZoneFallback bool `envconfig:"NODE_POOL_ZONE_FALLBACK" default:"false"`
+		// WarmNodePools are the TPU slice shapes to keep idle node pools of,
+		// for example "tpu-v5-lite-podslice/2x4=2", which Pods of the shape
+		// claim instead of creating a node pool. They are refilled every
+		// WarmNodePoolRefillInterval.
+		WarmNodePools              string        `envconfig:"WARM_NODE_POOLS" default:""`
+		WarmNodePoolRefillInterval time.Duration `envconfig:"WARM_NODE_POOL_REFILL_INTERVAL" default:"1m"`
+		// NodePoolDriftRecreate deletes and recreates existing node pools
+		// whose spec differs from the one the provisioner would create,
+		// instead of only reporting the drift.
+		NodePoolDriftRecreate bool `envconfig:"NODE_POOL_DRIFT_RECREATE" default:"false"`
+		// NodePoolLocality is the default locality of node pools, "zonal"
+		// or "regional".
+		NodePoolLocality string `envconfig:"NODE_POOL_LOCALITY" default:"zonal"`
+
+		// AsyncNodePoolOperations returns as soon as GKE accepted a node pool
+		// create request and polls the operation from later reconciles,
+		// instead of blocking a reconcile worker until it is done.
+		AsyncNodePoolOperations       bool          `envconfig:"ASYNC_NODE_POOL_OPERATIONS" default:"false"`
+		NodePoolOperationPollInterval time.Duration `envconfig:"NODE_POOL_OPERATION_POLL_INTERVAL" default:"15s"`
+		NodePoolOperationTimeout      time.Duration `envconfig:"NODE_POOL_OPERATION_TIMEOUT" default:"30m"`
+
+		// ProvisioningTimeout, if set, is how long the node pool of a Pod
+		// has to become Ready before ProvisioningTimeoutAction is taken:
+		// "retry-zone", "delete" or "abandon".
+		ProvisioningTimeout       time.Duration `envconfig:"PROVISIONING_TIMEOUT" default:"0s"`
+		ProvisioningTimeoutAction string        `envconfig:"PROVISIONING_TIMEOUT_ACTION" default:"retry-zone"`
+
+		// NodePoolReadyTimeout, if set, is how long the Nodes of an ensured
+		// node pool have to become Ready before a NodePoolNotReady event is
+		// recorded on the triggering Pod.
+		NodePoolReadyTimeout time.Duration `envconfig:"NODE_POOL_READY_TIMEOUT" default:"1h"`
+
+		// PartialSliceGracePeriod, if set, is how long the Nodes of a
+		// multi-host TPU node pool have to become Ready before the node
+		// pool is reported as a partial slice and PartialSliceAction is
+		// taken: "alert" or "delete".
+		PartialSliceGracePeriod time.Duration `envconfig:"PARTIAL_SLICE_GRACE_PERIOD" default:"0s"`
+		PartialSliceAction      string        `envconfig:"PARTIAL_SLICE_ACTION" default:"alert"`
+
+		// EventCoalesceWindow, if set, limits the events of the
+		// EventCoalesceReasons to one per object and reason per window.
+		EventCoalesceWindow  time.Duration `envconfig:"EVENT_COALESCE_WINDOW" default:"0s"`
+		EventCoalesceReasons []string      `envconfig:"EVENT_COALESCE_REASONS"`
+
+		// ProvisioningRequests enables creating node pools from provisioning
+		// request objects of the ProvisioningRequestAPIVersion and
+		// ProvisioningRequestKind, in addition to unschedulable Pods. See
+		// controller.ProvisioningRequestReconciler for their schema.
+		ProvisioningRequests          bool   `envconfig:"PROVISIONING_REQUESTS" default:"false"`
+		ProvisioningRequestAPIVersion string `envconfig:"PROVISIONING_REQUEST_API_VERSION" default:"tpu-provisioner.google.com/v1alpha1"`
+		ProvisioningRequestKind       string `envconfig:"PROVISIONING_REQUEST_KIND" default:"ProvisioningRequest"`
+
+		// ForceRecreate enables the google.com/tpu-provisioner-force-recreate
+		// Pod annotation, which drains (if NodePoolDrain is set) and deletes
+		// the node pool of the Pod so that it is created again.
+		ForceRecreate bool `envconfig:"FORCE_RECREATE" default:"false"`
+		// ManualNodePoolDeletion enables the google.com/tpu-provisioner-delete
+		// Node annotation, which drains (if NodePoolDrain is set) and deletes
+		// the node pool of the Node right away.
+		ManualNodePoolDeletion bool `envconfig:"MANUAL_NODE_POOL_DELETION" default:"false"`
+
+		// DryRun logs the node pools that would be created or deleted
+		// without calling GKE to do so.
+		DryRun bool `envconfig:"DRY_RUN" default:"false"`
+
+		// NodePoolFinalizer adds a finalizer to Pods that trigger node pool
+		// creation, so that the node pools of a parent are deleted when its
+		// last Pod is deleted.
+		NodePoolFinalizer bool `envconfig:"NODE_POOL_FINALIZER" default:"false"`
+
+		// ProvisioningPauseNamespace is the Namespace whose
+		// google.com/tpu-provisioner-paused annotation halts node pool
+		// creation. It defaults to PodNamespace.
+		ProvisioningPauseNamespace       string        `envconfig:"PROVISIONING_PAUSE_NAMESPACE"`
+		ProvisioningPauseRequeueInterval time.Duration `envconfig:"PROVISIONING_PAUSE_REQUEUE_INTERVAL" default:"1m"`
+
+		// AuditLog logs every node pool provisioning decision about a Pod
+		// with the "audit" logger. Use --zap-encoder=json for JSON lines.
+		AuditLog bool `envconfig:"AUDIT_LOG" default:"false"`
+		// Tracer traces reconciles and provider calls: "none" or "log" to
+		// log each span at verbosity 1.
+		Tracer string `envconfig:"TRACER" default:"none"`
+		// StrictShapeMatching triggers node pool creation for Pending Pods
+		// that no managed node pool matches, before they are Unschedulable.
+		StrictShapeMatching bool `envconfig:"STRICT_SHAPE_MATCHING" default:"false"`
+		// StatusEndpoint serves a JSON snapshot of the provisioning state at
+		// /status on the metrics server.
+		StatusEndpoint bool `envconfig:"STATUS_ENDPOINT" default:"false"`
+
+		// EventSinkURL, if set, is an HTTP webhook that node pool lifecycle
+		// events are also posted to as JSON. EventSinkAuthHeader is sent as
+		// its Authorization header; set it from a Secret, it is not logged.
+		EventSinkURL         string `envconfig:"EVENT_SINK_URL"`
+		EventSinkAuthHeader  string `envconfig:"EVENT_SINK_AUTH_HEADER"`
+		EventSinkMaxAttempts int    `envconfig:"EVENT_SINK_MAX_ATTEMPTS" default:"3"`
+
+		// NodePoolPreCreateHookURL and NodePoolPostCreateHookURL, if set, are
+		// HTTP webhooks that node pools are posted to before and after they
+		// are created, see cloud.CreateHooks. NodePoolCreateHookAuthHeader
+		// is sent as their Authorization header. With
+		// NodePoolCreateHookFailOpen node pools are created even if the
+		// pre-create hook cannot be called.
+		NodePoolPreCreateHookURL     string        `envconfig:"NODE_POOL_PRE_CREATE_HOOK_URL"`
+		NodePoolPostCreateHookURL    string        `envconfig:"NODE_POOL_POST_CREATE_HOOK_URL"`
+		NodePoolCreateHookAuthHeader string        `envconfig:"NODE_POOL_CREATE_HOOK_AUTH_HEADER"`
+		NodePoolCreateHookTimeout    time.Duration `envconfig:"NODE_POOL_CREATE_HOOK_TIMEOUT" default:"5s"`
+		NodePoolCreateHookFailOpen   bool          `envconfig:"NODE_POOL_CREATE_HOOK_FAIL_OPEN" default:"false"`
+
+		// WebhookEnabled serves the admission webhooks that default and
+		// validate TPU Pods. See config/webhook.
+		WebhookEnabled bool `envconfig:"WEBHOOK_ENABLED" default:"false"`
+
+		// PriorityOrdering serves Pods with a higher priority first. Pods
+		// are deferred for at most PriorityMaxDeferral.
+		PriorityOrdering    bool          `envconfig:"PRIORITY_ORDERING" default:"false"`
+		PriorityMaxDeferral time.Duration `envconfig:"PRIORITY_MAX_DEFERRAL" default:"5m"`
 
 		Concurrency int `envconfig:"CONCURRENCY" default:"3"`
+
+		// ShutdownGracePeriod is how long in-flight reconciles are given to
+		// finish and record their results after SIGTERM. It is shortened to
+		// fit the terminationGracePeriodSeconds of the Pod named by PodName
+		// and PodNamespace, if they are set (see config/manager).
+		ShutdownGracePeriod time.Duration `envconfig:"SHUTDOWN_GRACE_PERIOD" default:"30s"`
+		PodName             string        `envconfig:"POD_NAME"`
+		PodNamespace        string        `envconfig:"POD_NAMESPACE"`
+
+		// ShutdownReport logs the Pods and node pools whose provisioning is
+		// outstanding when the leader stops, at most ShutdownReportMaxEntries
+		// of each. ShutdownReportPath and ShutdownReportConfigMap (in
+		// PodNamespace), if set, also receive the report as JSON.
+		ShutdownReport           bool   `envconfig:"SHUTDOWN_REPORT" default:"true"`
+		ShutdownReportPath       string `envconfig:"SHUTDOWN_REPORT_PATH"`
+		ShutdownReportConfigMap  string `envconfig:"SHUTDOWN_REPORT_CONFIGMAP"`
+		ShutdownReportMaxEntries int    `envconfig:"SHUTDOWN_REPORT_MAX_ENTRIES" default:"100"`
+
+		// StartupResyncQPS is the rate at which Pods that are already
+		// unschedulable at startup are enqueued, at most
+		// StartupResyncMaxPods of them. Zero QPS disables the resync.
+		StartupResyncQPS     float64 `envconfig:"STARTUP_RESYNC_QPS" default:"5"`
+		StartupResyncMaxPods int     `envconfig:"STARTUP_RESYNC_MAX_PODS" default:"1000"`
+
+		// CreationConcurrency overrides Concurrency for the creation
+		// reconciler. Zero uses Concurrency. Values up to about 10 are
+		// safe; GKE serializes operations on a cluster, so more workers
+		// mostly wait, and all of them share the GKEAPIQPS rate limit.
+		CreationConcurrency int `envconfig:"CREATION_CONCURRENCY" default:"0"`
+
+		// GKEAPIQPS and GKEAPIBurst configure a client-side token bucket rate
+		// limit for node pool create and delete calls. Zero QPS disables it.
+		GKEAPIQPS   float64 `envconfig:"GKE_API_QPS" default:"0"`
+		GKEAPIBurst int     `envconfig:"GKE_API_BURST" default:"5"`
+		// GKEAPIMaxWait is how long a call may wait for the rate limit
+		// before its reconcile is requeued instead. Zero never waits.
+		GKEAPIMaxWait time.Duration `envconfig:"GKE_API_MAX_WAIT" default:"0"`
+		// GKEAPICreateTimeout, GKEAPIPollTimeout and GKEAPIListTimeout bound
+		// each GKE API call that creates, updates or deletes a node pool,
+		// gets an operation, and lists or gets node pools, see
+		// cloud.APITimeouts. Zero disables a timeout.
+		GKEAPICreateTimeout time.Duration `envconfig:"GKE_API_CREATE_TIMEOUT" default:"1m"`
+		GKEAPIPollTimeout   time.Duration `envconfig:"GKE_API_POLL_TIMEOUT" default:"30s"`
+		GKEAPIListTimeout   time.Duration `envconfig:"GKE_API_LIST_TIMEOUT" default:"30s"`
+
+		// GKEAPIEndpoint, GKEAPICredentialsFile and
+		// GKEAPIWithoutAuthentication override how the GKE API is reached,
+		// for testing against an emulator. See cloud.ServiceConfig.
+		GKEAPIEndpoint              string `envconfig:"GKE_API_ENDPOINT"`
+		GKEAPICredentialsFile       string `envconfig:"GKE_API_CREDENTIALS_FILE"`
+		GKEAPIWithoutAuthentication bool   `envconfig:"GKE_API_WITHOUT_AUTHENTICATION" default:"false"`
+		// GKEValidateCluster checks that the configured cluster exists at
+		// startup and exits if it does not.
+		GKEValidateCluster bool `envconfig:"GKE_VALIDATE_CLUSTER" default:"true"`
+
+		// SliceDebounce is how long to wait for all Pods of a multi-host
+		// slice to be observed before requesting a node pool for the slice.
+		// Zero disables slice batching.
+		SliceDebounce time.Duration `envconfig:"SLICE_DEBOUNCE" default:"0s"`
+		// JobSetSliceSizing takes the node count of JobSet slices from the
+		// parallelism of the replicated Job in the owning JobSet, falling
+		// back to SliceDebounce if the JobSet cannot be read.
+		JobSetSliceSizing bool `envconfig:"JOBSET_SLICE_SIZING" default:"false"`
+		// JobSetEvents also records the ensuring, ensured and failed events
+		// of JobSet Pods on the owning JobSet, once per slice and state.
+		JobSetEvents bool `envconfig:"JOBSET_EVENTS" default:"false"`
+		// SliceAggregation records the node pool events of multi-host slice
+		// Pods once per slice transition instead of on every Pod, and the
+		// slice_* metrics. Slices are forgotten SliceAggregationTTL after
+		// their last transition.
+		SliceAggregation    bool          `envconfig:"SLICE_AGGREGATION" default:"false"`
+		SliceAggregationTTL time.Duration `envconfig:"SLICE_AGGREGATION_TTL" default:"1h"`
+
+		// QuotaRetryInterval is how long to wait before retrying node pool
+		// creation after a quota-exceeded error.
+		QuotaRetryInterval time.Duration `envconfig:"QUOTA_RETRY_INTERVAL" default:"5m"`
+		// StockoutRetryInterval is how long to wait before retrying node
+		// pool creation after its zones were out of capacity.
+		StockoutRetryInterval time.Duration `envconfig:"STOCKOUT_RETRY_INTERVAL" default:"2m"`
+		// TransientRetryInterval is how long to wait before retrying node
+		// pool creation after other errors that are not known to be
+		// permanent. Negative values use exponential backoff.
+		TransientRetryInterval time.Duration `envconfig:"TRANSIENT_RETRY_INTERVAL" default:"15s"`
+		// NetworkErrorRetries is the number of times that node pool
+		// creation is retried right away, NetworkErrorRetryDelay apart,
+		// after a DNS, connection or timeout error talking to GKE, before
+		// it is retried after TransientRetryInterval. Zero disables these
+		// retries.
+		NetworkErrorRetries    int           `envconfig:"NETWORK_ERROR_RETRIES" default:"3"`
+		NetworkErrorRetryDelay time.Duration `envconfig:"NETWORK_ERROR_RETRY_DELAY" default:"1s"`
+		// OperationInProgressRetryInterval is how long to wait before
+		// retrying node pool creation after GKE reported a conflicting
+		// cluster operation.
+		OperationInProgressRetryInterval time.Duration `envconfig:"OPERATION_IN_PROGRESS_RETRY_INTERVAL" default:"30s"`
+		// MisconfiguredRetryInterval is how long to wait before retrying
+		// node pool creation after the configured cluster was not found.
+		MisconfiguredRetryInterval time.Duration `envconfig:"MISCONFIGURED_RETRY_INTERVAL" default:"1h"`
+		// PermanentRetryLimit, if set, is the number of permanent failures
+		// (for example an invalid configuration) after which node pool
+		// creation for a Pod is abandoned. Until then, permanent failures
+		// are retried with exponential backoff starting at
+		// PermanentRetryInterval. Zero never abandons nor retries them.
+		PermanentRetryLimit    int           `envconfig:"PERMANENT_RETRY_LIMIT" default:"0"`
+		PermanentRetryInterval time.Duration `envconfig:"PERMANENT_RETRY_INTERVAL" default:"1m"`
+		// RequeueJitter is the fraction by which retry delays after failed
+		// or throttled node pool creations are randomly spread.
+		RequeueJitter float64 `envconfig:"REQUEUE_JITTER" default:"0.2"`
 	}
 	envconfig.MustProcess("", &cfg)
+	if err := controller.ValidateJitter(cfg.RequeueJitter); err != nil {
+		setupLog.Error(err, "invalid REQUEUE_JITTER")
+		os.Exit(1)
+	}
+	if err := controller.ValidateProvisioningTimeoutAction(cfg.ProvisioningTimeoutAction); err != nil {
+		setupLog.Error(err, "invalid PROVISIONING_TIMEOUT_ACTION")
+		os.Exit(1)
+	}
+	if err := controller.ValidatePartialSliceAction(cfg.PartialSliceAction); err != nil {
+		setupLog.Error(err, "invalid PARTIAL_SLICE_ACTION")
+		os.Exit(1)
+	}
+	if err := controller.ValidateDrainTimeoutAction(cfg.NodePoolDrainTimeoutAction); err != nil {
+		setupLog.Error(err, "invalid NODE_POOL_DRAIN_TIMEOUT_ACTION")
+		os.Exit(1)
+	}
+	tracer, err := controller.NewTracer(cfg.Tracer)
+	if err != nil {
+		setupLog.Error(err, "invalid TRACER")
+		os.Exit(1)
+	}
+	if err := cloud.ValidateIncompleteSelectorPolicy(cfg.IncompleteSelectorPolicy); err != nil {
+		setupLog.Error(err, "invalid INCOMPLETE_TPU_SELECTOR_POLICY")
+		os.Exit(1)
+	}
+	owner := cloud.Owner{Key: cfg.OwnerLabelKey, Value: cfg.OwnerLabelValue}
+	if err := cloud.ValidateOwner(owner); err != nil {
+		setupLog.Error(err, "invalid OWNER_LABEL_KEY or OWNER_LABEL_VALUE")
+		os.Exit(1)
+	}
+	if cfg.EventSinkURL != "" {
+		if err := controller.ValidateEventSinkURL(cfg.EventSinkURL); err != nil {
+			setupLog.Error(err, "invalid EVENT_SINK_URL")
+			os.Exit(1)
+		}
+	}
+	var createHooks *cloud.CreateHooks
+	if cfg.NodePoolPreCreateHookURL != "" || cfg.NodePoolPostCreateHookURL != "" {
+		createHooks = &cloud.CreateHooks{
+			PreCreateURL:  cfg.NodePoolPreCreateHookURL,
+			PostCreateURL: cfg.NodePoolPostCreateHookURL,
+			AuthHeader:    cfg.NodePoolCreateHookAuthHeader,
+			Timeout:       cfg.NodePoolCreateHookTimeout,
+			FailOpen:      cfg.NodePoolCreateHookFailOpen,
+		}
+		if err := createHooks.Validate(); err != nil {
+			setupLog.Error(err, "invalid node pool create hooks")
+			os.Exit(1)
+		}
+	}
 
 	var metricsAddr string
 	var enableLeaderElection bool
+	var leaderElectionID, leaderElectionNamespace string
+	var leaseDuration, renewDeadline, retryPeriod time.Duration
+	var releaseOnCancel bool
 	var probeAddr string
+	var providerName string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.StringVar(&providerName, "provider", "", "The cloud provider: gke, gke-fake or noop. Overrides the PROVIDER environment variable.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&leaderElectionID, "leader-election-id", "ecaf1259.google.com", "The name of the Lease used for leader election.")
+	flag.StringVar(&leaderElectionNamespace, "leader-election-namespace", "",
+		"The namespace of the leader election Lease. Defaults to the namespace the manager runs in.")
+	flag.DurationVar(&leaseDuration, "leader-election-lease-duration", 15*time.Second,
+		"How long standby replicas wait before acquiring a Lease that has not been renewed.")
+	flag.DurationVar(&renewDeadline, "leader-election-renew-deadline", 10*time.Second,
+		"How long the leader retries renewing the Lease before giving up leadership.")
+	flag.DurationVar(&retryPeriod, "leader-election-retry-period", 2*time.Second,
+		"How long to wait between attempts to acquire or renew the Lease.")
+	flag.BoolVar(&releaseOnCancel, "leader-election-release-on-cancel", true,
+		"Release the Lease when the manager stops, so that a standby replica takes over without waiting for it to expire.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -104,13 +612,44 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	restConfig := ctrl.GetConfigOrDie()
+	shutdownGracePeriod := cfg.ShutdownGracePeriod
+	if cfg.PodName != "" && cfg.PodNamespace != "" {
+		var self corev1.Pod
+		if c, err := client.New(restConfig, client.Options{Scheme: scheme}); err != nil {
+			setupLog.Error(err, "unable to create client to read own pod")
+		} else if err := c.Get(context.Background(), client.ObjectKey{Namespace: cfg.PodNamespace, Name: cfg.PodName}, &self); err != nil {
+			setupLog.Error(err, "unable to read own pod, not bounding the shutdown grace period", "pod", cfg.PodName)
+		} else {
+			shutdownGracePeriod = controller.BoundedShutdownGracePeriod(cfg.ShutdownGracePeriod, self.Spec.TerminationGracePeriodSeconds)
+		}
+	}
+	if shutdownGracePeriod != cfg.ShutdownGracePeriod {
+		setupLog.Info("shortened shutdown grace period to fit the pod's termination grace period", "requested", cfg.ShutdownGracePeriod, "gracePeriod", shutdownGracePeriod)
+	}
+
+	pauseNamespace := cfg.ProvisioningPauseNamespace
+	if pauseNamespace == "" {
+		pauseNamespace = cfg.PodNamespace
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "ecaf1259.google.com",
+		LeaderElectionID:       leaderElectionID,
+		// The process exits as soon as the manager stops, so it is safe to
+		// release the Lease early.
+		LeaderElectionReleaseOnCancel: releaseOnCancel,
+		LeaderElectionNamespace:       leaderElectionNamespace,
+		LeaseDuration:                 &leaseDuration,
+		RenewDeadline:                 &renewDeadline,
+		RetryPeriod:                   &retryPeriod,
+		// Reconciles that are in flight when the manager stops are given
+		// the grace period to finish, see CreationReconciler.
+		GracefulShutdownTimeout: &shutdownGracePeriod,
 		Controller: v1alpha1.ControllerConfigurationSpec{
 			GroupKindConcurrency: map[string]int{
 				// Concurrent node pool creations:
@@ -124,7 +663,7 @@ func main() {
 				&corev1.Node{}: {
 					// Only listen for Nodes with label selectors indicating that they
 					// are managed by this controller.
-					Label: labels.SelectorFromSet(labels.Set{cloud.LabelNodepoolManager: cloud.LabelNodepoolManagerTPUPodinator}),
+					Label: labels.SelectorFromSet(owner.NodeLabels()),
 				},
 			},
 		},
@@ -134,11 +673,38 @@ func main() {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
+	limitedEventReasons := cfg.EventCoalesceReasons
+	if len(limitedEventReasons) == 0 {
+		limitedEventReasons = controller.DefaultLimitedEventReasons
+	}
+	// eventRecorder returns the event recorder of a component, limited to
+	// one event per object and reason per EVENT_COALESCE_WINDOW.
+	eventRecorder := func(name string) record.EventRecorder {
+		return controller.LimitEvents(mgr.GetEventRecorderFor(name), cfg.EventCoalesceWindow, limitedEventReasons)
+	}
 
-	var provider cloud.Provider
-	switch p := strings.ToLower(cfg.Provider); p {
-	case "gke":
-		if metadata.OnGCE() {
+	defaultTPUTaints, err := cloud.ParseTaints(cfg.DefaultTPUTaints)
+	if err != nil {
+		setupLog.Error(err, "invalid default TPU taints")
+		os.Exit(1)
+	}
+	baseTaints, err := cloud.ParseTaints(cfg.NodePoolBaseTaints)
+	if err != nil {
+		setupLog.Error(err, "invalid node pool base taints")
+		os.Exit(1)
+	}
+
+	if providerName == "" {
+		providerName = cfg.Provider
+	}
+
+	var (
+		provider            cloud.Provider
+		acceleratorDefaults map[string]cloud.AcceleratorDefaults
+	)
+	switch p := strings.ToLower(providerName); p {
+	case "gke", "gke-fake":
+		if p == "gke" && metadata.OnGCE() {
 			// Attempt to infer cluster information from GKE metadata server.
 			md := metadata.NewClient(&http.Client{})
 			var err error
@@ -174,48 +740,524 @@ func main() {
 		}
 
 		setupLog.Info("creating gke client",
+			"provider", p,
 			"project", cfg.GCPProjectID,
 			"clusterLocation", cfg.GCPClusterLocation,
 			"cluster", cfg.GCPCluster,
 			"zone", cfg.GCPZone,
 			"nodeServiceAccount", cfg.GCPNodeServiceAccount,
 			"nodeTags", cfg.GCPNodeTags,
+			"apiQPS", cfg.GKEAPIQPS,
+			"apiBurst", cfg.GKEAPIBurst,
+			"apiMaxWait", cfg.GKEAPIMaxWait,
+			"propagatePodLabels", cfg.PropagatePodLabels,
 		)
 
-		containers, err := containerv1beta1.NewService(context.Background() /*, option.WithCredentials(creds)*/)
+		var nameTemplate *template.Template
+		if cfg.NodePoolNameTemplate != "" {
+			nameTemplate, err = cloud.ParseNodePoolNameTemplate(cfg.NodePoolNameTemplate)
+			if err != nil {
+				setupLog.Error(err, "invalid node pool name template")
+				os.Exit(1)
+			}
+		}
+		warmNodePools, err := cloud.ParseWarmNodePools(cfg.WarmNodePools)
+		if err != nil {
+			setupLog.Error(err, "invalid warm node pools")
+			os.Exit(1)
+		}
+
+		if err := cloud.ValidateNodeVersion(cfg.GCPNodeVersion); err != nil {
+			setupLog.Error(err, "invalid node version")
+			os.Exit(1)
+		}
+		if err := cloud.ValidateImageType(cfg.GCPNodeImageType, ""); err != nil {
+			setupLog.Error(err, "invalid node image type")
+			os.Exit(1)
+		}
+		if err := cloud.ValidateHostVM(cfg.GCPNodeMinCPUPlatform, cfg.GCPNodeConfidential, ""); err != nil {
+			setupLog.Error(err, "invalid node host VM config")
+			os.Exit(1)
+		}
+		if err := cloud.ValidateSandbox(cfg.GCPNodeSandbox, "", cfg.GCPNodeImageType); err != nil {
+			setupLog.Error(err, "invalid node sandbox config")
+			os.Exit(1)
+		}
+		if err := cloud.ValidateMaxPodsPerNode(int64(cfg.GCPNodeMaxPodsPerNode), cfg.GCPClusterPodCIDR); err != nil {
+			setupLog.Error(err, "invalid max pods per node")
+			os.Exit(1)
+		}
+		resourceManagerTags, err := cloud.ParseResourceManagerTags(cfg.GCPNodeResourceManagerTags)
+		if err != nil {
+			setupLog.Error(err, "invalid node resource manager tags")
+			os.Exit(1)
+		}
+		additionalNetworks, err := cloud.ParseNetworkInterfaces(cfg.GCPNodeAdditionalNetworks)
+		if err != nil {
+			setupLog.Error(err, "invalid node additional networks")
+			os.Exit(1)
+		}
+		if err := cloud.ValidateLocality(cfg.NodePoolLocality); err != nil {
+			setupLog.Error(err, "invalid node pool locality")
+			os.Exit(1)
+		}
+		if err := cloud.ValidateNodeManagement(cfg.GCPClusterReleaseChannel, cfg.GCPNodeAutoUpgrade); err != nil {
+			setupLog.Error(err, "invalid node management settings")
+			os.Exit(1)
+		}
+		if err := cloud.ValidateServiceAccount(cfg.GCPNodeServiceAccount); err != nil {
+			setupLog.Error(err, "invalid node service account")
+			os.Exit(1)
+		}
+		if len(cfg.GCPZones) > 0 {
+			if err := cloud.ValidateZones(cfg.GCPZones); err != nil {
+				setupLog.Error(err, "invalid zones")
+				os.Exit(1)
+			}
+		}
+		for ns, sa := range cfg.GCPNodeServiceAccounts {
+			if err := cloud.ValidateServiceAccount(sa); err != nil {
+				setupLog.Error(err, "invalid node service account", "namespace", ns)
+				os.Exit(1)
+			}
+		}
+
+		if cfg.AcceleratorDefaultsPath != "" {
+			acceleratorDefaults, err = cloud.LoadAcceleratorDefaults(cfg.AcceleratorDefaultsPath)
+			if err != nil {
+				setupLog.Error(err, "unable to load accelerator defaults")
+				os.Exit(1)
+			}
+			setupLog.Info("loaded accelerator defaults", "count", len(acceleratorDefaults))
+		}
+
+		var nodePoolClasses map[string]cloud.NodePoolClass
+		if cfg.NodePoolClassesPath != "" {
+			nodePoolClasses, err = cloud.LoadNodePoolClasses(cfg.NodePoolClassesPath)
+			if err != nil {
+				setupLog.Error(err, "unable to load node pool classes")
+				os.Exit(1)
+			}
+			setupLog.Info("loaded node pool classes", "count", len(nodePoolClasses))
+		}
+
+		clusterContext := cloud.GKEContext{
+			ProjectID:           cfg.GCPProjectID,
+			ClusterLocation:     cfg.GCPClusterLocation,
+			Cluster:             cfg.GCPCluster,
+			NodeZone:            cfg.GCPZone,
+			NodeZones:           cfg.GCPZones,
+			NodePoolLocality:    cfg.NodePoolLocality,
+			NodeServiceAccount:  cfg.GCPNodeServiceAccount,
+			TPUResources:        cfg.PodResourceTypes,
+			GPUResource:         cfg.PodGPUResourceType,
+			NodeServiceAccounts: cfg.GCPNodeServiceAccounts,
+			NodeOAuthScopes:     cfg.GCPNodeOAuthScopes,
+			NodeSecondaryDisk:   cfg.GCPNodeSecondaryDisk,
+			NodeTags:            cfg.GCPNodeTags,
+
+			PodLabelsToPropagate: cfg.PropagatePodLabels,
+			DefaultTPUTaints:     defaultTPUTaints,
+			BaseTaints:           baseTaints,
+
+			DisableNodeAutoUpgrade: !cfg.GCPNodeAutoUpgrade,
+			DisableNodeAutoRepair:  !cfg.GCPNodeAutoRepair,
+			ReleaseChannel:         cfg.GCPClusterReleaseChannel,
+
+			NodeSpot:        cfg.GCPNodeSpot,
+			NodeReservation: cfg.GCPNodeReservation,
+
+			NodePlacementPolicy:   cfg.GCPNodePlacementPolicy,
+			NodePlacementPolicies: cfg.GCPNodePlacementPolicies,
+
+			NodePoolClasses:     nodePoolClasses,
+			AcceleratorDefaults: acceleratorDefaults,
+			NodeAutoscalingMin:  cfg.GCPNodeAutoscalingMin,
+			NodeAutoscalingMax:  cfg.GCPNodeAutoscalingMax,
+			NodeDiskSizeGB:      cfg.GCPNodeDiskSizeGB,
+			NodeDiskType:        cfg.GCPNodeDiskType,
+			NodeImageType:       cfg.GCPNodeImageType,
+			NodeMinCPUPlatform:  cfg.GCPNodeMinCPUPlatform,
+			NodeConfidential:    cfg.GCPNodeConfidential,
+			NodeSandbox:         cfg.GCPNodeSandbox,
+
+			NodeLocalSSDCount:     cfg.GCPNodeLocalSSDCount,
+			NodeLocalSSDEphemeral: cfg.GCPNodeLocalSSDEphemeral,
+
+			NodeNetwork:    cfg.GCPNodeNetwork,
+			NodeSubnetwork: cfg.GCPNodeSubnetwork,
+			NodePodRange:   cfg.GCPNodePodRange,
+
+			NodeGvnic:              cfg.GCPNodeGvnic,
+			NodeAdditionalNetworks: additionalNetworks,
+
+			NodeMaxPodsPerNode: cfg.GCPNodeMaxPodsPerNode,
+			ClusterPodCIDR:     cfg.GCPClusterPodCIDR,
+
+			NodeResourceManagerTags: resourceManagerTags,
+
+			NetworkProjectID:     cfg.GCPNetworkProjectID,
+			ReservationProjectID: cfg.GCPReservationProjectID,
+
+			NodeVersion: cfg.GCPNodeVersion,
+
+			IncompleteSelectorPolicy: cfg.IncompleteSelectorPolicy,
+
+			Owner: owner,
+		}
+
+		if p == "gke-fake" {
+			provider = &cloud.Fake{
+				ClusterContext:       clusterContext,
+				NodePoolNameTemplate: nameTemplate,
+			}
+			break
+		}
+
+		var limiter *rate.Limiter
+		if cfg.GKEAPIQPS > 0 {
+			limiter = rate.NewLimiter(rate.Limit(cfg.GKEAPIQPS), cfg.GKEAPIBurst)
+		}
+
+		if cfg.GKEAPIEndpoint != "" {
+			setupLog.Info("using custom gke api endpoint", "endpoint", cfg.GKEAPIEndpoint)
+		}
+		containers, err := cloud.NewService(context.Background(), cloud.ServiceConfig{
+			Endpoint:              cfg.GKEAPIEndpoint,
+			CredentialsFile:       cfg.GKEAPICredentialsFile,
+			WithoutAuthentication: cfg.GKEAPIWithoutAuthentication,
+		})
 		if err != nil {
 			setupLog.Error(err, "unable to create gke client")
 			os.Exit(1)
 		}
-		provider = &cloud.GKE{
-			Service: containers,
-			ClusterContext: cloud.GKEContext{
-				ProjectID:          cfg.GCPProjectID,
-				ClusterLocation:    cfg.GCPClusterLocation,
-				Cluster:            cfg.GCPCluster,
-				NodeZone:           cfg.GCPZone,
-				NodeServiceAccount: cfg.GCPNodeServiceAccount,
-				NodeSecondaryDisk:  cfg.GCPNodeSecondaryDisk,
-				NodeTags:           cfg.GCPNodeTags,
+		var priceTable *cloud.PriceTable
+		if cfg.PriceTablePath != "" {
+			priceTable, err = cloud.LoadPriceTable(cfg.PriceTablePath)
+			if err != nil {
+				setupLog.Error(err, "invalid price table")
+				os.Exit(1)
+			}
+		}
+		gke := &cloud.GKE{
+			Service:              containers,
+			ClusterContext:       clusterContext,
+			NodePoolNameTemplate: nameTemplate,
+			Recorder:             eventRecorder("tpu-provisioner"),
+			RateLimiter:          limiter,
+			RateLimitMaxWait:     cfg.GKEAPIMaxWait,
+			DryRun:               cfg.DryRun,
+			MaxNodePools:         cfg.MaxNodePools,
+			RecreateCooldown:     cfg.NodePoolRecreateCooldown,
+			AsyncOperations:      cfg.AsyncNodePoolOperations,
+			ZoneFallback:         cfg.NodePoolZoneFallback,
+			WarmNodePools:        warmNodePools,
+			CreateHooks:          createHooks,
+			PriceTable:           priceTable,
+			Annotator:            &controller.PodAnnotator{Client: mgr.GetClient()},
+
+			RecreateDriftedNodePools: cfg.NodePoolDriftRecreate,
+			NodePoolTemplate:         cfg.NodePoolTemplate,
+			NodePoolTemplateTTL:      cfg.NodePoolTemplateTTL,
+
+			APITimeouts: cloud.APITimeouts{
+				Create: cfg.GKEAPICreateTimeout,
+				Poll:   cfg.GKEAPIPollTimeout,
+				List:   cfg.GKEAPIListTimeout,
 			},
 		}
-	case "mock":
+		provider = gke
+		if cfg.GKEValidateCluster {
+			// Fail fast on a wrong project or cluster name. Other errors
+			// (for example connectivity) may go away and are reported by
+			// the provider health check.
+			if err := gke.ValidateCluster(); errors.Is(err, cloud.ErrClusterNotFound) {
+				setupLog.Error(err, "gke cluster not found, check GCP_PROJECT_ID, GCP_CLUSTER_LOCATION and GCP_CLUSTER")
+				os.Exit(1)
+			} else if err != nil {
+				setupLog.Error(err, "unable to validate gke cluster")
+			}
+		}
+	case "noop", "mock":
 		provider = &cloud.Mock{}
 	default:
 		setupLog.Error(err, "unrecognized provider", "provider", p)
 		os.Exit(1)
 	}
 
-	if err := (&controller.CreationReconciler{
+	if cfg.PodSkipAnnotation != "" {
+		if errs := validation.IsQualifiedName(cfg.PodSkipAnnotation); len(errs) > 0 {
+			setupLog.Error(errors.New(strings.Join(errs, "; ")), "invalid pod skip annotation", "annotation", cfg.PodSkipAnnotation)
+			os.Exit(1)
+		}
+	}
+	podCriteria := controller.PodCriteria{
+		ResourceTypes:  cfg.PodResourceTypes,
+		SkipAnnotation: cfg.PodSkipAnnotation,
+	}
+	if cfg.PodGPUResourceType != "" {
+		podCriteria.Families = append(podCriteria.Families, controller.ResourceFamily{
+			ResourceTypes: []string{cfg.PodGPUResourceType},
+			NodeSelectors: []string{cloud.GKEGPUNodeSelector},
+		})
+	}
+
+	if cfg.PodLabelSelector != "" {
+		ls, err := metav1.ParseToLabelSelector(cfg.PodLabelSelector)
+		if err != nil {
+			setupLog.Error(err, "invalid pod label selector")
+			os.Exit(1)
+		}
+		selector, err := metav1.LabelSelectorAsSelector(ls)
+		if err != nil {
+			setupLog.Error(err, "invalid pod label selector")
+			os.Exit(1)
+		}
+		podCriteria.Selector = selector
+	}
+
+	namespaceFilter := controller.NamespaceFilter{
+		Allow: cfg.NamespaceAllowlist,
+		Deny:  cfg.NamespaceDenylist,
+	}
+	for _, globs := range [][]string{namespaceFilter.Allow, namespaceFilter.Deny} {
+		if err := controller.ValidateGlobs(globs); err != nil {
+			setupLog.Error(err, "invalid namespace allowlist or denylist")
+			os.Exit(1)
+		}
+	}
+
+	var acceleratorAllowlist *controller.AcceleratorAllowlist
+	if len(cfg.AcceleratorAllowlist) > 0 || cfg.AcceleratorAllowlistPath != "" {
+		if err := controller.ValidateGlobs(cfg.AcceleratorAllowlist); err != nil {
+			setupLog.Error(err, "invalid accelerator allowlist")
+			os.Exit(1)
+		}
+		if cfg.AcceleratorAllowlistPath != "" {
+			// Fail on startup, later errors keep the last list.
+			if _, err := controller.LoadAcceleratorAllowlist(cfg.AcceleratorAllowlistPath); err != nil {
+				setupLog.Error(err, "invalid accelerator allowlist")
+				os.Exit(1)
+			}
+		}
+		acceleratorAllowlist = &controller.AcceleratorAllowlist{
+			Allow: cfg.AcceleratorAllowlist,
+			Path:  cfg.AcceleratorAllowlistPath,
+		}
+	}
+
+	readyTracker := &controller.NodePoolReadyTracker{}
+
+	var resync *controller.StartupResync
+	if cfg.StartupResyncQPS > 0 {
+		resync = &controller.StartupResync{
+			Client:      mgr.GetClient(),
+			PodCriteria: podCriteria,
+			QPS:         cfg.StartupResyncQPS,
+			MaxPods:     cfg.StartupResyncMaxPods,
+		}
+		if err := mgr.Add(resync); err != nil {
+			setupLog.Error(err, "unable to add startup resync")
+			os.Exit(1)
+		}
+	}
+
+	var sweep *controller.NodePoolSweep
+	if cfg.NodePoolSweepInterval > 0 {
+		sweep = &controller.NodePoolSweep{
+			Client:            mgr.GetClient(),
+			Provider:          provider,
+			PodCriteria:       podCriteria,
+			Interval:          cfg.NodePoolSweepInterval,
+			OrphanGracePeriod: cfg.NodePoolSweepOrphanGracePeriod,
+			QPS:               cfg.NodePoolSweepQPS,
+			MaxActions:        cfg.NodePoolSweepMaxActions,
+			DryRun:            cfg.NodePoolSweepDryRun,
+			Tracer:            tracer,
+		}
+		if err := mgr.Add(sweep); err != nil {
+			setupLog.Error(err, "unable to add node pool sweep")
+			os.Exit(1)
+		}
+	}
+
+	var eventSink *controller.EventSink
+	if cfg.EventSinkURL != "" {
+		eventSink = &controller.EventSink{
+			URL:         cfg.EventSinkURL,
+			AuthHeader:  cfg.EventSinkAuthHeader,
+			MaxAttempts: cfg.EventSinkMaxAttempts,
+		}
+		if err := mgr.Add(eventSink); err != nil {
+			setupLog.Error(err, "unable to add event sink")
+			os.Exit(1)
+		}
+	}
+
+	var jobSetReader client.Reader
+	if cfg.JobSetSliceSizing {
+		jobSetReader = mgr.GetAPIReader()
+	}
+	creatorRecorder := eventRecorder("tpu-provisioner-creator")
+	var jobSetEvents *controller.JobSetEvents
+	if cfg.JobSetEvents {
+		jobSetEvents = &controller.JobSetEvents{Reader: mgr.GetAPIReader(), Recorder: creatorRecorder}
+	}
+	var sliceAggregator *controller.SliceAggregator
+	if cfg.SliceAggregation {
+		sliceAggregator = &controller.SliceAggregator{TTL: cfg.SliceAggregationTTL}
+	}
+
+	retryPolicy := controller.RetryPolicy{
+		TransientInterval:  cfg.TransientRetryInterval,
+		QuotaInterval:      cfg.QuotaRetryInterval,
+		InProgressInterval: cfg.OperationInProgressRetryInterval,
+
+		StockoutInterval:      cfg.StockoutRetryInterval,
+		MisconfiguredInterval: cfg.MisconfiguredRetryInterval,
+
+		MaxPermanentAttempts: cfg.PermanentRetryLimit,
+		PermanentInterval:    cfg.PermanentRetryInterval,
+
+		NetworkRetries:    cfg.NetworkErrorRetries,
+		NetworkRetryDelay: cfg.NetworkErrorRetryDelay,
+
+		Jitter: cfg.RequeueJitter,
+	}
+	creationReconciler := &controller.CreationReconciler{
+		Client:                   mgr.GetClient(),
+		Scheme:                   mgr.GetScheme(),
+		Recorder:                 creatorRecorder,
+		Provider:                 provider,
+		PodCriteria:              podCriteria,
+		NamespaceFilter:          namespaceFilter,
+		AcceleratorAllowlist:     acceleratorAllowlist,
+		SliceDebounce:            cfg.SliceDebounce,
+		IncompleteSelectorPolicy: cfg.IncompleteSelectorPolicy,
+		AcceleratorDefaults:      acceleratorDefaults,
+		JobSetReader:             jobSetReader,
+		RetryPolicy:              retryPolicy,
+		MaxConcurrentReconciles:  cfg.CreationConcurrency,
+		ReadyTracker:             readyTracker,
+		Resync:                   resyncEvents(resync),
+		Sweep:                    sweepEvents(sweep),
+		NodePoolFinalizer:        cfg.NodePoolFinalizer,
+		PriorityPolicy: controller.PriorityPolicy{
+			Enabled:     cfg.PriorityOrdering,
+			MaxDeferral: cfg.PriorityMaxDeferral,
+		},
+		OperationPolling: controller.OperationPolling{
+			Interval: cfg.NodePoolOperationPollInterval,
+			Timeout:  cfg.NodePoolOperationTimeout,
+		},
+		ShutdownGracePeriod: shutdownGracePeriod,
+		AuditLog:            cfg.AuditLog,
+		StrictShapeMatching: cfg.StrictShapeMatching,
+		EventSink:           eventSink,
+		JobSetEvents:        jobSetEvents,
+		SliceAggregator:     sliceAggregator,
+		Tracer:              tracer,
+		ProvisioningTimeout: controller.ProvisioningTimeout{
+			Timeout: cfg.ProvisioningTimeout,
+			Action:  cfg.ProvisioningTimeoutAction,
+		},
+		PauseSwitch: controller.PauseSwitch{
+			Namespace:       pauseNamespace,
+			RequeueInterval: cfg.ProvisioningPauseRequeueInterval,
+		},
+	}
+	if err := creationReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CreationReconciler")
+		os.Exit(1)
+	}
+	if cfg.StatusEndpoint {
+		if err := mgr.AddMetricsExtraHandler("/status", creationReconciler.StatusHandler()); err != nil {
+			setupLog.Error(err, "unable to set up status endpoint")
+			os.Exit(1)
+		}
+	}
+	if cfg.ShutdownReport {
+		if cfg.ShutdownReportConfigMap != "" && cfg.PodNamespace == "" {
+			setupLog.Error(errors.New("POD_NAMESPACE must be set"), "invalid SHUTDOWN_REPORT_CONFIGMAP")
+			os.Exit(1)
+		}
+		if err := mgr.Add(&controller.ShutdownReport{
+			Client:             mgr.GetClient(),
+			Reconciler:         creationReconciler,
+			Path:               cfg.ShutdownReportPath,
+			ConfigMapNamespace: cfg.PodNamespace,
+			ConfigMapName:      cfg.ShutdownReportConfigMap,
+			MaxEntries:         cfg.ShutdownReportMaxEntries,
+			// Leave the rest of the grace period for the report and
+			// stopping the manager.
+			WaitForInFlight: shutdownGracePeriod / 2,
+		}); err != nil {
+			setupLog.Error(err, "unable to add shutdown report")
+			os.Exit(1)
+		}
+	}
+
+	if err := (&controller.NodePoolReadyReconciler{
 		Client:   mgr.GetClient(),
-		Scheme:   mgr.GetScheme(),
 		Recorder: mgr.GetEventRecorderFor("tpu-provisioner-creator"),
 		Provider: provider,
-		PodCriteria: controller.PodCriteria{
-			ResourceType: cfg.PodResourceType,
-		},
+		Tracker:  readyTracker,
+		Timeout:  cfg.NodePoolReadyTimeout,
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "CreationReconciler")
+		setupLog.Error(err, "unable to create controller", "controller", "NodePoolReadyReconciler")
+		os.Exit(1)
+	}
+
+	if cfg.PartialSliceGracePeriod > 0 {
+		if err := (&controller.PartialSliceReconciler{
+			Client:      mgr.GetClient(),
+			Recorder:    mgr.GetEventRecorderFor("tpu-provisioner-creator"),
+			Provider:    provider,
+			EventSink:   eventSink,
+			GracePeriod: cfg.PartialSliceGracePeriod,
+			Action:      cfg.PartialSliceAction,
+			Tracer:      tracer,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "PartialSliceReconciler")
+			os.Exit(1)
+		}
+	}
+
+	if cfg.ProvisioningRequests {
+		gv, err := schema.ParseGroupVersion(cfg.ProvisioningRequestAPIVersion)
+		if err != nil || cfg.ProvisioningRequestKind == "" {
+			setupLog.Error(err, "invalid PROVISIONING_REQUEST_API_VERSION or PROVISIONING_REQUEST_KIND")
+			os.Exit(1)
+		}
+		var tpuResource string
+		if len(cfg.PodResourceTypes) > 0 {
+			tpuResource = cfg.PodResourceTypes[0]
+		}
+		if err := (&controller.ProvisioningRequestReconciler{
+			Client:      mgr.GetClient(),
+			Recorder:    mgr.GetEventRecorderFor("tpu-provisioner-creator"),
+			Provider:    provider,
+			GVK:         gv.WithKind(cfg.ProvisioningRequestKind),
+			TPUResource: tpuResource,
+			RetryPolicy: retryPolicy,
+			OperationPolling: controller.OperationPolling{
+				Interval: cfg.NodePoolOperationPollInterval,
+			},
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ProvisioningRequestReconciler")
+			os.Exit(1)
+		}
+	}
+
+	// Always set up, so that finalizers are removed even if
+	// NODE_POOL_FINALIZER was disabled after they were added.
+	if err := (&controller.PodFinalizerReconciler{
+		Client:   mgr.GetClient(),
+		Recorder: mgr.GetEventRecorderFor("tpu-provisioner-deleter"),
+		Provider: provider,
+		Tracer:   tracer,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PodFinalizerReconciler")
 		os.Exit(1)
 	}
 
@@ -227,12 +1269,95 @@ func main() {
 		NodeCriteria: controller.NodeCriteria{
 			MinLifetime: cfg.NodeMinLifespan,
 		},
+		EventSink: eventSink,
+		Tracer:    tracer,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "DeletionReconciler")
 		os.Exit(1)
 	}
+
+	var drainer *controller.Drainer
+	if cfg.NodePoolDrain {
+		drainer = &controller.Drainer{
+			Client:        mgr.GetClient(),
+			Timeout:       cfg.NodePoolDrainTimeout,
+			TimeoutAction: cfg.NodePoolDrainTimeoutAction,
+		}
+	}
+	if cfg.ForceRecreate {
+		if err := (&controller.ForceRecreateReconciler{
+			Client:    mgr.GetClient(),
+			Recorder:  mgr.GetEventRecorderFor("tpu-provisioner-deleter"),
+			Provider:  provider,
+			EventSink: eventSink,
+			Drainer:   drainer,
+			Tracer:    tracer,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ForceRecreateReconciler")
+			os.Exit(1)
+		}
+	}
+	if cfg.ManualNodePoolDeletion {
+		if err := (&controller.ManualDeletionReconciler{
+			Client:    mgr.GetClient(),
+			Recorder:  mgr.GetEventRecorderFor("tpu-provisioner-deleter"),
+			Provider:  provider,
+			EventSink: eventSink,
+			Drainer:   drainer,
+			Tracer:    tracer,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ManualDeletionReconciler")
+			os.Exit(1)
+		}
+	}
+
+	if cfg.NodePoolIdleDuration > 0 {
+		if err := mgr.Add(&controller.NodePoolGarbageCollector{
+			Client:       mgr.GetClient(),
+			Recorder:     mgr.GetEventRecorderFor("tpu-provisioner-gc"),
+			Provider:     provider,
+			Interval:     cfg.NodePoolGCInterval,
+			IdleDuration: cfg.NodePoolIdleDuration,
+			DryRun:       cfg.NodePoolGCDryRun,
+			EventSink:    eventSink,
+			Drainer:      drainer,
+			Tracer:       tracer,
+		}); err != nil {
+			setupLog.Error(err, "unable to add node pool garbage collector")
+			os.Exit(1)
+		}
+	}
+	if refiller, ok := provider.(cloud.WarmNodePoolRefiller); ok && cfg.WarmNodePools != "" {
+		if err := mgr.Add(&controller.WarmNodePoolRefiller{
+			Provider: refiller,
+			Interval: cfg.WarmNodePoolRefillInterval,
+		}); err != nil {
+			setupLog.Error(err, "unable to add warm node pool refiller")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
+	if cfg.WebhookEnabled {
+		decoder, err := admission.NewDecoder(mgr.GetScheme())
+		if err != nil {
+			setupLog.Error(err, "unable to create webhook decoder")
+			os.Exit(1)
+		}
+		srv := mgr.GetWebhookServer()
+		srv.Register("/mutate-v1-pod", &crwebhook.Admission{Handler: &webhook.PodDefaulter{
+			Decoder:    decoder,
+			DiskSizeGB: cfg.GCPNodeDiskSizeGB,
+			Spot:       cfg.GCPNodeSpot,
+		}})
+		srv.Register("/validate-v1-pod", &crwebhook.Admission{Handler: &webhook.PodValidator{
+			Decoder:                  decoder,
+			TPUResources:             cfg.PodResourceTypes,
+			IncompleteSelectorPolicy: cfg.IncompleteSelectorPolicy,
+			AcceleratorDefaults:      acceleratorDefaults,
+		}})
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -241,6 +1366,23 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if cfg.ProviderHealthCheckInterval > 0 {
+		// Only a readiness check: restarting does not fix credentials or
+		// connectivity.
+		providerCheck := &controller.ProviderHealthCheck{
+			Provider:         provider,
+			Interval:         cfg.ProviderHealthCheckInterval,
+			FailureThreshold: cfg.ProviderHealthCheckFailureThreshold,
+		}
+		if err := mgr.Add(providerCheck); err != nil {
+			setupLog.Error(err, "unable to add provider health check")
+			os.Exit(1)
+		}
+		if err := mgr.AddReadyzCheck("provider", providerCheck.Check); err != nil {
+			setupLog.Error(err, "unable to set up provider ready check")
+			os.Exit(1)
+		}
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
@@ -248,3 +1390,17 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+func resyncEvents(r *controller.StartupResync) <-chan event.GenericEvent {
+	if r == nil {
+		return nil
+	}
+	return r.Events()
+}
+
+func sweepEvents(s *controller.NodePoolSweep) <-chan event.GenericEvent {
+	if s == nil {
+		return nil
+	}
+	return s.Events()
+}
@@ -0,0 +1,197 @@
+package cloud
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// AcceleratorDefaults are the node pool defaults for one TPU accelerator type
+// (the value of the cloud.google.com/gke-tpu-accelerator node selector). They
+// take precedence over the cluster defaults; node pool classes and Pod
+// annotations take precedence over them. Zero values keep the cluster
+// defaults.
+type AcceleratorDefaults struct {
+	// MachineTypes maps the number of TPU chips requested by a Pod to the
+	// machine type, overriding the built-in mapping, for example
+	// {"4": "ct5lp-hightpu-4t"}.
+	MachineTypes map[string]string `json:"machineTypes,omitempty"`
+
+	DiskSizeGB int64  `json:"diskSizeGb,omitempty"`
+	DiskType   string `json:"diskType,omitempty"`
+	// ImageType is the node image type, for example UBUNTU_CONTAINERD.
+	ImageType string `json:"imageType,omitempty"`
+
+	// MinCPUPlatform is the minimum CPU platform of the host VMs, and
+	// ConfidentialNodes whether they are Confidential GKE Nodes. Pointer so
+	// that false can override the cluster default.
+	MinCPUPlatform    string `json:"minCpuPlatform,omitempty"`
+	ConfidentialNodes *bool  `json:"confidentialNodes,omitempty"`
+
+	// PlacementPolicy is the compact placement resource policy of
+	// multi-host node pools, or "none".
+	PlacementPolicy string `json:"placementPolicy,omitempty"`
+	// Reservation is the reservation to consume, or "none".
+	Reservation string `json:"reservation,omitempty"`
+	// Taints replace the default TPU taints, in the format of the
+	// AnnotationNodePoolTaints annotation.
+	Taints string `json:"taints,omitempty"`
+	// KubeletConfig and Sysctls are the kubelet settings and sysctls of the
+	// nodes, in the format of the AnnotationKubeletConfig and
+	// AnnotationSysctls annotations. The annotations are merged into them.
+	KubeletConfig string `json:"kubeletConfig,omitempty"`
+	Sysctls       string `json:"sysctls,omitempty"`
+	// MaxPodsPerNode is the maximum number of Pods per node.
+	MaxPodsPerNode int64 `json:"maxPodsPerNode,omitempty"`
+	// Gvnic enables or disables gVNIC, and AdditionalNetworks are further
+	// network interfaces of the nodes in the format of the
+	// AnnotationAdditionalNetworks annotation.
+	Gvnic              *bool  `json:"gvnic,omitempty"`
+	AdditionalNetworks string `json:"additionalNetworks,omitempty"`
+	// Topology is the topology of Pods that select this accelerator type
+	// but no topology, and Default makes this the accelerator type of Pods
+	// that select a topology but no accelerator type, with the
+	// IncompleteSelectorDefault policy. Only one accelerator type can be the
+	// Default.
+	Topology string `json:"topology,omitempty"`
+	Default  bool   `json:"default,omitempty"`
+}
+
+// LoadAcceleratorDefaults reads the defaults of each accelerator type from a
+// YAML file (usually a mounted ConfigMap), for example:
+//
+//	tpu-v5-lite-podslice:
+//	  diskSizeGb: 200
+//	  imageType: UBUNTU_CONTAINERD
+//	  reservation: v5e-reservation
+//	tpu-v5p-slice:
+//	  placementPolicy: v5p-compact
+//	  taints: google.com/tpu=present:NoSchedule,dedicated=v5p:NoSchedule
+//
+// The accelerator types and values are validated.
+func LoadAcceleratorDefaults(path string) (map[string]AcceleratorDefaults, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading accelerator defaults: %w", err)
+	}
+	var defaults map[string]AcceleratorDefaults
+	if err := yaml.UnmarshalStrict(data, &defaults); err != nil {
+		return nil, fmt.Errorf("parsing accelerator defaults from %s: %w", path, err)
+	}
+	for accel, d := range defaults {
+		if err := d.validate(accel); err != nil {
+			return nil, fmt.Errorf("accelerator defaults for %s: %w", accel, err)
+		}
+	}
+	if err := validateDefaultAccelerator(defaults); err != nil {
+		return nil, fmt.Errorf("accelerator defaults: %w", err)
+	}
+	return defaults, nil
+}
+
+func (d AcceleratorDefaults) validate(accel string) error {
+	a, ok := tpuAccelerators[accel]
+	if !ok {
+		return fmt.Errorf("unknown accelerator type %q", accel)
+	}
+	for chips, machineType := range d.MachineTypes {
+		n, err := strconv.Atoi(chips)
+		if err != nil || !containsInt(a.ChipsPerVM, n) {
+			return fmt.Errorf("invalid machine type chip count %q, must be one of %v", chips, a.ChipsPerVM)
+		}
+		if machineType == "" {
+			return fmt.Errorf("empty machine type for %v chips", n)
+		}
+	}
+	if d.Topology != "" {
+		if _, err := parseTPUTopology(a, d.Topology); err != nil {
+			return fmt.Errorf("%v is not a valid topology: %v", d.Topology, err)
+		}
+		if len(a.Topologies) > 0 && !containsString(a.Topologies, d.Topology) {
+			return fmt.Errorf("topology %v is not supported, supported topologies: %v", d.Topology, strings.Join(a.Topologies, ", "))
+		}
+	}
+	nics, err := ParseNetworkInterfaces(d.AdditionalNetworks)
+	if err != nil {
+		return err
+	}
+	// The boot disk, image type, host VM and network interface config must
+	// be supported by every machine type of the accelerator, not only those
+	// in MachineTypes.
+	for _, chips := range a.ChipsPerVM {
+		machineType, err := AcceleratorDefaults{MachineTypes: d.MachineTypes}.machineType(accel, chips)
+		if err != nil {
+			return err
+		}
+		if err := validateBootDisk(d.DiskSizeGB, d.DiskType, machineType); err != nil {
+			return err
+		}
+		if err := ValidateImageType(d.ImageType, machineType); err != nil {
+			return err
+		}
+		if err := ValidateHostVM(d.MinCPUPlatform, d.ConfidentialNodes != nil && *d.ConfidentialNodes, machineType); err != nil {
+			return err
+		}
+		if err := ValidateNetworkInterfaces(d.Gvnic, len(nics), machineType); err != nil {
+			return err
+		}
+	}
+	if _, err := ParseTaints(d.Taints); err != nil {
+		return err
+	}
+	if _, err := ParseKubeletConfig(d.KubeletConfig); err != nil {
+		return err
+	}
+	if _, err := ParseSysctls(d.Sysctls); err != nil {
+		return err
+	}
+	if d.MaxPodsPerNode != 0 {
+		if err := ValidateMaxPodsPerNode(d.MaxPodsPerNode, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// machineType returns the machine type for the TPU request from MachineTypes,
+// or the built-in machine type.
+func (d AcceleratorDefaults) machineType(accel string, tpuRequest int) (string, error) {
+	if machineType, ok := d.MachineTypes[strconv.Itoa(tpuRequest)]; ok {
+		return machineType, nil
+	}
+	return tpuMachineType(accel, tpuRequest)
+}
+
+// acceleratorDefaultsForPod returns the defaults for the TPU accelerator type
+// of the Pod, and false if there are none.
+func (c GKEContext) acceleratorDefaultsForPod(p *corev1.Pod) (AcceleratorDefaults, bool) {
+	d, ok := c.AcceleratorDefaults[NodeSelectorForPod(p)[GKEAcceleratorNodeSelector]]
+	return d, ok
+}
+
+// tpuMachineType returns the machine type for the accelerator type and TPU
+// request, using the MachineTypes of the accelerator defaults if they map the
+// request.
+func (c GKEContext) tpuMachineType(accel string, tpuRequest int) (string, error) {
+	return c.AcceleratorDefaults[accel].machineType(accel, tpuRequest)
+}
+
+// warnUnknownAccelerator records an EventUnknownAcceleratorType event if
+// accelerator defaults are configured but not for the TPU accelerator type of
+// the Pod.
+func (g *GKE) warnUnknownAccelerator(p *corev1.Pod) {
+	if len(g.ClusterContext.AcceleratorDefaults) == 0 {
+		return
+	}
+	accel, ok := NodeSelectorForPod(p)[GKEAcceleratorNodeSelector]
+	if !ok || !strings.HasPrefix(accel, "tpu-") {
+		return
+	}
+	if _, ok := g.ClusterContext.acceleratorDefaultsForPod(p); !ok {
+		g.eventf(p, corev1.EventTypeWarning, EventUnknownAcceleratorType, "No defaults are configured for accelerator type %q, using the cluster defaults.", accel)
+	}
+}
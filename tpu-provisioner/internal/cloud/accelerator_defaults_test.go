@@ -0,0 +1,143 @@
+package cloud
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestLoadAcceleratorDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accelerators.yaml")
+	load := func(data string) (map[string]AcceleratorDefaults, error) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return LoadAcceleratorDefaults(path)
+	}
+
+	defaults, err := load(`
+tpu-v5-lite-podslice:
+  machineTypes:
+    "4": ct5lp-hightpu-4t
+  diskSizeGb: 200
+  reservation: v5e-reservation
+tpu-v5p-slice:
+  placementPolicy: v5p-compact
+  taints: google.com/tpu=present:NoSchedule,dedicated=v5p:NoSchedule
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d := defaults[V5ePodSliceAccelerator]; d.DiskSizeGB != 200 || d.Reservation != "v5e-reservation" || d.MachineTypes["4"] != "ct5lp-hightpu-4t" {
+		t.Fatalf("unexpected v5e defaults: %+v", d)
+	}
+
+	for name, data := range map[string]string{
+		"unknown field":       "tpu-v5p-slice:\n  diskSize: 100\n",
+		"unknown accelerator": "tpu-v9-slice:\n  diskSizeGb: 100\n",
+		"invalid chip count":  "tpu-v4-podslice:\n  machineTypes:\n    \"8\": ct4p-hightpu-8t\n",
+		"invalid disk":        "tpu-v4-podslice:\n  diskType: hyperdisk-balanced\n",
+		"invalid taints":      "tpu-v4-podslice:\n  taints: dedicated\n",
+		"invalid sysctls":     "tpu-v4-podslice:\n  sysctls: kernel.shmmax=1\n",
+		"invalid max pods":    "tpu-v4-podslice:\n  maxPodsPerNode: 4\n",
+		"invalid topology":    "tpu-v5-lite-podslice:\n  topology: 2x8\n",
+		"two defaults":        "tpu-v4-podslice:\n  default: true\ntpu-v5p-slice:\n  default: true\n",
+	} {
+		if _, err := load(data); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
+
+func TestGKE_nodePoolForPod_acceleratorDefaults(t *testing.T) {
+	isController := true
+	dedicated := corev1.Taint{Key: "dedicated", Value: "v5e", Effect: corev1.TaintEffectNoSchedule}
+	rec := record.NewFakeRecorder(10)
+	g := &GKE{
+		ClusterContext: GKEContext{
+			NodeDiskSizeGB:   100,
+			NodeReservation:  "cluster-reservation",
+			DefaultTPUTaints: []corev1.Taint{DefaultTPUTaint},
+			AcceleratorDefaults: map[string]AcceleratorDefaults{
+				V5ePodSliceAccelerator: {
+					MachineTypes: map[string]string{"4": "ct5lp-hightpu-4t-custom"},
+					DiskSizeGB:   200,
+					Reservation:  "v5e-reservation",
+					Taints:       "dedicated=v5e:NoSchedule",
+				},
+			},
+		},
+		Recorder: rec,
+	}
+	pod := func(accel string, annotations map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "train-0",
+				Namespace:   "default",
+				Annotations: annotations,
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "Job", Name: "train", UID: "0123456789abcdef", Controller: &isController},
+				},
+			},
+			Spec: corev1.PodSpec{
+				NodeSelector: map[string]string{
+					GKETPUNodeSelector:         "2x2",
+					GKEAcceleratorNodeSelector: accel,
+				},
+				Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+				Containers: []corev1.Container{{
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{GoogleTPUResource: resource.MustParse("4")},
+					},
+				}},
+			},
+		}
+	}
+
+	np, err := g.nodePoolForPod("np", pod(V5ePodSliceAccelerator, nil), NodePoolRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := np.Config
+	if cfg.MachineType != "ct5lp-hightpu-4t-custom" || cfg.DiskSizeGb != 200 || cfg.ReservationAffinity.Values[0] != "v5e-reservation" {
+		t.Fatalf("expected accelerator defaults, got: machineType=%v diskSizeGb=%v reservation=%v", cfg.MachineType, cfg.DiskSizeGb, cfg.ReservationAffinity.Values)
+	}
+	if len(cfg.Taints) != 1 || cfg.Taints[0].Key != dedicated.Key {
+		t.Fatalf("expected accelerator taints, got: %+v", cfg.Taints)
+	}
+	if len(rec.Events) != 0 {
+		t.Fatalf("unexpected event: %v", <-rec.Events)
+	}
+
+	np, err = g.nodePoolForPod("np", pod(V5ePodSliceAccelerator, map[string]string{AnnotationDiskSizeGB: "300", AnnotationReservation: "none"}), NodePoolRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg := np.Config; cfg.DiskSizeGb != 300 || cfg.ReservationAffinity.ConsumeReservationType != "NO_RESERVATION" {
+		t.Fatalf("expected annotations to override accelerator defaults, got: diskSizeGb=%v reservation=%+v", cfg.DiskSizeGb, cfg.ReservationAffinity)
+	}
+
+	p := pod(V4PodSliceAccelerator, nil)
+	p.Spec.NodeSelector[GKETPUNodeSelector] = "2x2x1"
+	np, err = g.nodePoolForPod("np", p, NodePoolRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg := np.Config; cfg.MachineType != "ct4p-hightpu-4t" || cfg.DiskSizeGb != 100 || cfg.ReservationAffinity.Values[0] != "cluster-reservation" {
+		t.Fatalf("expected cluster defaults, got: machineType=%v diskSizeGb=%v reservation=%v", cfg.MachineType, cfg.DiskSizeGb, cfg.ReservationAffinity.Values)
+	}
+	taints, err := g.NodePoolTaintsForPod(p)
+	if err != nil || !reflect.DeepEqual(taints, []corev1.Taint{DefaultTPUTaint}) {
+		t.Fatalf("expected default TPU taints, got: %v, %v", taints, err)
+	}
+	if exp, got := 1, len(rec.Events); exp != got {
+		t.Fatalf("events: expected: %v, got: %v", exp, got)
+	}
+}
@@ -0,0 +1,47 @@
+package cloud
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NodeSelectorForPod returns the node labels that the Pod requires, combining
+// spec.nodeSelector with the required (not preferred) node affinity of the Pod.
+//
+// Node selector terms are ORed, so only one term is used: the first one that
+// selects a TPU or GPU node with the "In" operator. Each "In" expression of that
+// term contributes its first value. Other operators (NotIn, Exists, ...) do not
+// determine a label value and are ignored. Entries in spec.nodeSelector take
+// precedence over node affinity.
+func NodeSelectorForPod(p *corev1.Pod) map[string]string {
+	sel := map[string]string{}
+	if term := acceleratorNodeSelectorTerm(p); term != nil {
+		for _, e := range term.MatchExpressions {
+			if e.Operator == corev1.NodeSelectorOpIn && len(e.Values) > 0 {
+				sel[e.Key] = e.Values[0]
+			}
+		}
+	}
+	for k, v := range p.Spec.NodeSelector {
+		sel[k] = v
+	}
+	return sel
+}
+
+func acceleratorNodeSelectorTerm(p *corev1.Pod) *corev1.NodeSelectorTerm {
+	a := p.Spec.Affinity
+	if a == nil || a.NodeAffinity == nil || a.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return nil
+	}
+	terms := a.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	for i := range terms {
+		for _, e := range terms[i].MatchExpressions {
+			if e.Operator != corev1.NodeSelectorOpIn || len(e.Values) == 0 {
+				continue
+			}
+			if e.Key == GKETPUNodeSelector || e.Key == GKEAcceleratorNodeSelector || e.Key == GKEGPUNodeSelector {
+				return &terms[i]
+			}
+		}
+	}
+	return nil
+}
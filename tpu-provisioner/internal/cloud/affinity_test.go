@@ -0,0 +1,123 @@
+package cloud
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestNodeSelectorForPod(t *testing.T) {
+	required := func(terms ...corev1.NodeSelectorTerm) *corev1.Affinity {
+		return &corev1.Affinity{
+			NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: terms,
+				},
+			},
+		}
+	}
+	in := func(key string, values ...string) corev1.NodeSelectorRequirement {
+		return corev1.NodeSelectorRequirement{Key: key, Operator: corev1.NodeSelectorOpIn, Values: values}
+	}
+
+	cases := []struct {
+		name string
+		spec corev1.PodSpec
+		exp  map[string]string
+	}{
+		{
+			name: "node selector only",
+			spec: corev1.PodSpec{
+				NodeSelector: map[string]string{GKETPUNodeSelector: "2x2x1"},
+			},
+			exp: map[string]string{GKETPUNodeSelector: "2x2x1"},
+		},
+		{
+			name: "required affinity",
+			spec: corev1.PodSpec{
+				Affinity: required(corev1.NodeSelectorTerm{
+					MatchExpressions: []corev1.NodeSelectorRequirement{
+						in(GKETPUNodeSelector, "2x2x1"),
+						in(GKEAcceleratorNodeSelector, "tpu-v4-podslice"),
+					},
+				}),
+			},
+			exp: map[string]string{
+				GKETPUNodeSelector:         "2x2x1",
+				GKEAcceleratorNodeSelector: "tpu-v4-podslice",
+			},
+		},
+		{
+			name: "first accelerator term is used",
+			spec: corev1.PodSpec{
+				Affinity: required(
+					corev1.NodeSelectorTerm{
+						MatchExpressions: []corev1.NodeSelectorRequirement{in("pool", "general")},
+					},
+					corev1.NodeSelectorTerm{
+						MatchExpressions: []corev1.NodeSelectorRequirement{
+							in(GKETPUNodeSelector, "2x2x2", "2x2x4"),
+							in(GKEAcceleratorNodeSelector, "tpu-v4-podslice"),
+						},
+					},
+					corev1.NodeSelectorTerm{
+						MatchExpressions: []corev1.NodeSelectorRequirement{in(GKETPUNodeSelector, "4x4x4")},
+					},
+				),
+			},
+			exp: map[string]string{
+				GKETPUNodeSelector:         "2x2x2",
+				GKEAcceleratorNodeSelector: "tpu-v4-podslice",
+			},
+		},
+		{
+			name: "not in is ignored",
+			spec: corev1.PodSpec{
+				Affinity: required(corev1.NodeSelectorTerm{
+					MatchExpressions: []corev1.NodeSelectorRequirement{
+						{Key: GKETPUNodeSelector, Operator: corev1.NodeSelectorOpNotIn, Values: []string{"2x2x1"}},
+					},
+				}),
+			},
+			exp: map[string]string{},
+		},
+		{
+			name: "preferred affinity is ignored",
+			spec: corev1.PodSpec{
+				Affinity: &corev1.Affinity{
+					NodeAffinity: &corev1.NodeAffinity{
+						PreferredDuringSchedulingIgnoredDuringExecution: []corev1.PreferredSchedulingTerm{
+							{
+								Weight: 1,
+								Preference: corev1.NodeSelectorTerm{
+									MatchExpressions: []corev1.NodeSelectorRequirement{in(GKETPUNodeSelector, "2x2x1")},
+								},
+							},
+						},
+					},
+				},
+			},
+			exp: map[string]string{},
+		},
+		{
+			name: "node selector takes precedence",
+			spec: corev1.PodSpec{
+				NodeSelector: map[string]string{GKETPUNodeSelector: "2x2x1"},
+				Affinity: required(corev1.NodeSelectorTerm{
+					MatchExpressions: []corev1.NodeSelectorRequirement{in(GKETPUNodeSelector, "2x2x2")},
+				}),
+			},
+			exp: map[string]string{GKETPUNodeSelector: "2x2x1"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := NodeSelectorForPod(&corev1.Pod{Spec: c.spec})
+			if !reflect.DeepEqual(c.exp, got) {
+				t.Fatalf("expected: %v, got: %v", c.exp, got)
+			}
+		})
+	}
+}
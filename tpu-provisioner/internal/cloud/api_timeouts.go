@@ -0,0 +1,29 @@
+package cloud
+
+import (
+	"context"
+	"time"
+)
+
+// APITimeouts bound the individual calls to the GKE API, so that a hung
+// request fails with ErrTransient and the Pod is requeued instead of blocking
+// a reconcile worker. A zero timeout leaves that kind of call unbounded.
+type APITimeouts struct {
+	// Create bounds the calls that create, update or delete a node pool.
+	// Waiting for their operations is bounded by Poll per call.
+	Create time.Duration
+	// Poll bounds each call that gets the status of an operation.
+	Poll time.Duration
+	// List bounds the calls that list or get node pools, and get the
+	// cluster.
+	List time.Duration
+}
+
+// callContext returns the context of a GKE API call that times out after d,
+// if positive.
+func callContext(d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), d)
+}
@@ -0,0 +1,52 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGKE_APITimeouts(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	svc, err := NewService(context.Background(), ServiceConfig{Endpoint: srv.URL + "/", WithoutAuthentication: true})
+	if err != nil {
+		t.Fatalf("creating service: %v", err)
+	}
+	g := &GKE{
+		Service:        svc,
+		ClusterContext: GKEContext{ProjectID: "my-project", ClusterLocation: "us-central2", Cluster: "my-cluster"},
+		APITimeouts:    APITimeouts{Create: 50 * time.Millisecond, Poll: 50 * time.Millisecond, List: 50 * time.Millisecond},
+	}
+
+	calls := map[string]func() error{
+		"list": func() error {
+			_, err := g.listNodePools()
+			return err
+		},
+		"poll": func() error {
+			_, err := g.PollNodePoolOperation("projects/my-project/locations/us-central2/operations/operation-1")
+			return err
+		},
+		"delete": func() error { return g.DeleteNodePool("np") },
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			if err := call(); !errors.Is(err, ErrTransient) {
+				t.Fatalf("expected %v, got: %v", ErrTransient, err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Fatalf("expected the call to time out, took %v", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package cloud
+
+import (
+	"fmt"
+	"strconv"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// autoscalingForPod returns the cluster autoscaling config of the node pool
+// for the Pod, or nil if autoscaling is disabled. Autoscaling is enabled when
+// a maximum node count is set, via the AnnotationAutoscalingMax annotation or
+// GKEContext.NodeAutoscalingMax. The minimum defaults to
+// GKEContext.NodeAutoscalingMin. nodeCount, the size of the slice, must be
+// within the bounds.
+func (g *GKE) autoscalingForPod(p *corev1.Pod, nodeCount int) (*containerv1beta1.NodePoolAutoscaling, error) {
+	min, err := intAnnotation(p, AnnotationAutoscalingMin, g.ClusterContext.NodeAutoscalingMin)
+	if err != nil {
+		return nil, err
+	}
+	max, err := intAnnotation(p, AnnotationAutoscalingMax, g.ClusterContext.NodeAutoscalingMax)
+	if err != nil {
+		return nil, err
+	}
+	if max == 0 {
+		if _, ok := p.Annotations[AnnotationAutoscalingMin]; ok {
+			return nil, fmt.Errorf("%v annotation requires a maximum node count", AnnotationAutoscalingMin)
+		}
+		return nil, nil
+	}
+	if min < 0 || min > nodeCount || nodeCount > max {
+		return nil, fmt.Errorf("autoscaling bounds must satisfy 0 <= min (%d) <= slice size (%d) <= max (%d)", min, nodeCount, max)
+	}
+	return &containerv1beta1.NodePoolAutoscaling{
+		Enabled:      true,
+		MinNodeCount: int64(min),
+		MaxNodeCount: int64(max),
+	}, nil
+}
+
+func intAnnotation(p *corev1.Pod, key string, def int) (int, error) {
+	v, ok := p.Annotations[key]
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("parsing %v annotation: %w", key, err)
+	}
+	return n, nil
+}
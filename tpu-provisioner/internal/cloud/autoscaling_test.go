@@ -0,0 +1,66 @@
+package cloud
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestGKE_autoscalingForPod(t *testing.T) {
+	cases := []struct {
+		name        string
+		ctx         GKEContext
+		annotations map[string]string
+		nodeCount   int
+		expMin      int64
+		expMax      int64
+		disabled    bool
+		err         bool
+	}{
+		{name: "disabled by default", nodeCount: 2, disabled: true},
+		{name: "global defaults", ctx: GKEContext{NodeAutoscalingMin: 1, NodeAutoscalingMax: 4}, nodeCount: 2, expMin: 1, expMax: 4},
+		{
+			name:        "annotations override defaults",
+			ctx:         GKEContext{NodeAutoscalingMin: 1, NodeAutoscalingMax: 4},
+			annotations: map[string]string{AnnotationAutoscalingMin: "0", AnnotationAutoscalingMax: "8"},
+			nodeCount:   2,
+			expMin:      0,
+			expMax:      8,
+		},
+		{
+			name:        "annotation max enables autoscaling",
+			annotations: map[string]string{AnnotationAutoscalingMax: "2"},
+			nodeCount:   2,
+			expMin:      0,
+			expMax:      2,
+		},
+		{name: "slice larger than max", ctx: GKEContext{NodeAutoscalingMax: 4}, nodeCount: 8, err: true},
+		{name: "min larger than slice", ctx: GKEContext{NodeAutoscalingMin: 4, NodeAutoscalingMax: 8}, nodeCount: 2, err: true},
+		{name: "min without max", annotations: map[string]string{AnnotationAutoscalingMin: "1"}, nodeCount: 2, err: true},
+		{name: "invalid annotation", annotations: map[string]string{AnnotationAutoscalingMax: "many"}, nodeCount: 2, err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := &GKE{ClusterContext: c.ctx}
+			p := &corev1.Pod{}
+			p.Annotations = c.annotations
+			a, err := g.autoscalingForPod(p, c.nodeCount)
+			if (err != nil) != c.err {
+				t.Fatalf("error: expected: %v, got: %v", c.err, err)
+			}
+			if c.err {
+				return
+			}
+			if c.disabled {
+				if a != nil {
+					t.Fatalf("expected autoscaling to be disabled, got: %+v", a)
+				}
+				return
+			}
+			if a == nil || !a.Enabled || a.MinNodeCount != c.expMin || a.MaxNodeCount != c.expMax {
+				t.Fatalf("expected min %v max %v, got: %+v", c.expMin, c.expMax, a)
+			}
+		})
+	}
+}
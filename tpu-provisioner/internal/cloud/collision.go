@@ -0,0 +1,78 @@
+package cloud
+
+import (
+	"errors"
+	"fmt"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// maxNameCollisions bounds the number of alternate names that are tried for
+// the node pool of a Pod.
+const maxNameCollisions = 1
+
+// errNodePoolExists is returned by createNodePool when GKE reports that the
+// node pool already exists.
+var errNodePoolExists = errors.New("node pool already exists")
+
+// nameCollides returns true if the existing node pool has the name of the
+// node pool for the Pod but is not meant for it: it was not created by the
+// provisioner, or the NodePoolNameTemplate produced the name of the node pool
+// of a different workload.
+func (g *GKE) nameCollides(existing *containerv1beta1.NodePool, p *corev1.Pod) bool {
+	if !g.NodePoolOwner().ownsNodePool(existing) {
+		return true
+	}
+	return g.NodePoolNameTemplate != nil && !g.nodePoolBelongsToPod(existing, p)
+}
+
+// resolveNameCollision ensures the node pool for the Pod under an alternate
+// name, derived from name and a hash of the owner of the Pod, after name was
+// found to be used by another node pool. It gives up with
+// ErrInvalidNodePoolConfig once maxNameCollisions alternates were tried.
+func (g *GKE) resolveNameCollision(p *corev1.Pod, r NodePoolRequest, name string, collisions int) (*NodePoolOperation, error) {
+	if collisions >= maxNameCollisions {
+		return nil, fmt.Errorf("%w: node pool name %s is used by another node pool", ErrInvalidNodePoolConfig, name)
+	}
+	ownerID, err := podOwnerID(p)
+	if err != nil {
+		return nil, fmt.Errorf("%w: determining node pool name: %v", ErrInvalidNodePoolConfig, err)
+	}
+	alternate := withHashSuffix(name, ownerID)
+	log.Info("node pool name collision, using alternate name", "collision", name, "name", alternate)
+	g.eventf(p, corev1.EventTypeNormal, EventNameCollisionResolved, "Node Pool name %s is used by another Node Pool, using %s instead.", name, alternate)
+	g.annotateNodePoolName(p, alternate)
+	return g.ensureNodePool(p, r, alternate, collisions+1)
+}
+
+// annotateNodePoolName records the alternate name of the node pool on the
+// Pod, if there is an Annotator, so that the Pod keeps using it and the
+// controllers find its node pool.
+func (g *GKE) annotateNodePoolName(p *corev1.Pod, name string) {
+	if g.Annotator == nil || p.Annotations[AnnotationNodePoolName] == name {
+		return
+	}
+	if err := g.Annotator.AnnotatePod(p, AnnotationNodePoolName, name); err != nil {
+		log.Error(err, "annotating pod with node pool name", "pod", p.Namespace+"/"+p.Name, "name", name)
+	}
+}
+
+// ensureExistingNodePool handles a node pool that GKE reported as already
+// existing (409) when it was created: if the provisioner created the node
+// pool, it is ensured and nil is returned, as for a node pool that existed
+// before the create call. It is a name collision if someone else created it,
+// and a duplicate request if it is already gone again.
+func (g *GKE) ensureExistingNodePool(p *corev1.Pod, r NodePoolRequest, name string, collisions int) (*NodePoolOperation, error) {
+	existing, err := g.getNodePool(name)
+	if err != nil {
+		return nil, fmt.Errorf("checking if node pool exists: %w", err)
+	}
+	if existing == nil {
+		return nil, ErrDuplicateRequest
+	}
+	if !g.nameCollides(existing, p) {
+		return nil, nil
+	}
+	return g.resolveNameCollision(p, r, name, collisions)
+}
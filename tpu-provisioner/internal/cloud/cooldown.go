@@ -0,0 +1,70 @@
+package cloud
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+)
+
+// CooldownError is returned when a node pool is not created because a node
+// pool of the same shape was deleted less than GKE.RecreateCooldown ago.
+type CooldownError struct {
+	Shape string
+	// RetryAfter is how long until the cooldown ends.
+	RetryAfter time.Duration
+}
+
+func (e *CooldownError) Error() string {
+	return fmt.Sprintf("node pool of shape %s was recently deleted, retry after %v", e.Shape, e.RetryAfter)
+}
+
+// nodePoolShape identifies node pools that are interchangeable for the
+// purpose of the recreate cooldown: the namespace of the parent, the machine
+// type (which determines the accelerator and chips per node) and the TPU
+// topology.
+func nodePoolShape(np *containerv1beta1.NodePool) string {
+	var namespace, machineType, topo string
+	if np.Config != nil {
+		namespace = np.Config.ResourceLabels[ResourceLabelParentNamespace]
+		machineType = np.Config.MachineType
+	}
+	if np.PlacementPolicy != nil {
+		topo = np.PlacementPolicy.TpuTopology
+	}
+	return namespace + "/" + machineType + "/" + topo
+}
+
+// shapeCooldowns tracks when node pools of each shape were last deleted.
+// Entries are dropped once their cooldown is over.
+type shapeCooldowns struct {
+	mtx       sync.Mutex
+	deletedAt map[string]time.Time
+}
+
+func (c *shapeCooldowns) record(shape string, now time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.deletedAt == nil {
+		c.deletedAt = map[string]time.Time{}
+	}
+	c.deletedAt[shape] = now
+}
+
+// remaining returns how long node pools of the shape may not be created for,
+// 0 if they can be created now.
+func (c *shapeCooldowns) remaining(shape string, cooldown time.Duration, now time.Time) time.Duration {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for s, t := range c.deletedAt {
+		if now.Sub(t) >= cooldown {
+			delete(c.deletedAt, s)
+		}
+	}
+	t, ok := c.deletedAt[shape]
+	if !ok {
+		return 0
+	}
+	return t.Add(cooldown).Sub(now)
+}
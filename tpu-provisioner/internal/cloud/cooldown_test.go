@@ -0,0 +1,46 @@
+package cloud
+
+import (
+	"testing"
+	"time"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+)
+
+func Test_nodePoolShape(t *testing.T) {
+	np := &containerv1beta1.NodePool{
+		Config: &containerv1beta1.NodeConfig{
+			MachineType:    "ct5p-hightpu-4t",
+			ResourceLabels: map[string]string{ResourceLabelParentNamespace: "team-a"},
+		},
+		PlacementPolicy: &containerv1beta1.PlacementPolicy{TpuTopology: "2x2x4"},
+	}
+	if exp, got := "team-a/ct5p-hightpu-4t/2x2x4", nodePoolShape(np); exp != got {
+		t.Fatalf("expected: %q, got: %q", exp, got)
+	}
+	if exp, got := "/ct5lp-hightpu-1t/", nodePoolShape(&containerv1beta1.NodePool{Config: &containerv1beta1.NodeConfig{MachineType: "ct5lp-hightpu-1t"}}); exp != got {
+		t.Fatalf("expected: %q, got: %q", exp, got)
+	}
+}
+
+func Test_shapeCooldowns(t *testing.T) {
+	now := time.Now()
+	var c shapeCooldowns
+
+	if got := c.remaining("a", time.Minute, now); got != 0 {
+		t.Fatalf("expected no cooldown, got: %v", got)
+	}
+	c.record("a", now)
+	if exp, got := 40*time.Second, c.remaining("a", time.Minute, now.Add(20*time.Second)); exp != got {
+		t.Fatalf("expected: %v, got: %v", exp, got)
+	}
+	if got := c.remaining("b", time.Minute, now.Add(20*time.Second)); got != 0 {
+		t.Fatalf("expected no cooldown for other shape, got: %v", got)
+	}
+	if got := c.remaining("a", time.Minute, now.Add(time.Minute)); got != 0 {
+		t.Fatalf("expected cooldown to be over, got: %v", got)
+	}
+	if len(c.deletedAt) != 0 {
+		t.Fatalf("expected expired cooldowns to be dropped, got: %v", c.deletedAt)
+	}
+}
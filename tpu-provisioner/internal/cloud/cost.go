@@ -0,0 +1,149 @@
+package cloud
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// PriceTable holds the hourly prices of one node of each machine type, used
+// to estimate the cost of node pools. Prices are in the currency of the
+// table, usually USD.
+type PriceTable struct {
+	// Default prices apply in regions that do not list the machine type.
+	Default map[string]MachinePrice `json:"default,omitempty"`
+	// Regions holds the prices per region, for example "us-east5".
+	Regions map[string]map[string]MachinePrice `json:"regions,omitempty"`
+}
+
+// MachinePrice is the hourly price of one node of a machine type.
+type MachinePrice struct {
+	OnDemand float64 `json:"onDemand,omitempty"`
+	// Spot is the price of Spot VMs. If unset, OnDemand is used.
+	Spot float64 `json:"spot,omitempty"`
+}
+
+// LoadPriceTable reads a PriceTable from a YAML file (usually a mounted
+// ConfigMap), for example:
+//
+//	default:
+//	  ct5lp-hightpu-4t:
+//	    onDemand: 4.80
+//	    spot: 1.68
+//	regions:
+//	  europe-west4:
+//	    ct5lp-hightpu-4t:
+//	      onDemand: 5.64
+func LoadPriceTable(path string) (*PriceTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading price table: %w", err)
+	}
+	var t PriceTable
+	if err := yaml.UnmarshalStrict(data, &t); err != nil {
+		return nil, fmt.Errorf("parsing price table from %s: %w", path, err)
+	}
+	check := func(where string, prices map[string]MachinePrice) error {
+		for machineType, p := range prices {
+			if p.OnDemand < 0 || p.Spot < 0 {
+				return fmt.Errorf("%s: negative price for machine type %s", where, machineType)
+			}
+		}
+		return nil
+	}
+	if err := check("default", t.Default); err != nil {
+		return nil, err
+	}
+	for region, prices := range t.Regions {
+		if err := check("region "+region, prices); err != nil {
+			return nil, err
+		}
+	}
+	return &t, nil
+}
+
+// price returns the hourly price of a node of the machine type in the
+// region. Missing prices fall back to the default prices and to the
+// on-demand price for Spot VMs; the fallbacks taken are returned as
+// warnings. ok is false if no price is known at all.
+func (t *PriceTable) price(region, machineType string, spot bool) (price float64, warnings []string, ok bool) {
+	p, found := t.Regions[region][machineType]
+	if !found {
+		if p, found = t.Default[machineType]; !found {
+			return 0, nil, false
+		}
+		if len(t.Regions) > 0 {
+			warnings = append(warnings, fmt.Sprintf("no price for %s in region %s, using the default price", machineType, region))
+		}
+	}
+	if spot {
+		if p.Spot > 0 {
+			return p.Spot, warnings, true
+		}
+		warnings = append(warnings, fmt.Sprintf("no Spot price for %s, using the on-demand price", machineType))
+	}
+	if p.OnDemand <= 0 {
+		return 0, warnings, false
+	}
+	return p.OnDemand, warnings, true
+}
+
+// regionOf returns the region of a zone ("us-central2-b" is in
+// "us-central2"). Regions are returned unchanged.
+func regionOf(location string) string {
+	if zonePattern.MatchString(location) {
+		return location[:strings.LastIndex(location, "-")]
+	}
+	return location
+}
+
+// estimateHourlyCost returns the estimated hourly cost of the node pool from
+// its machine type, Spot setting and initial node count, in the region of its
+// first location (or of the cluster).
+func (t *PriceTable) estimateHourlyCost(np *containerv1beta1.NodePool, clusterLocation string) (cost float64, warnings []string, ok bool) {
+	location := clusterLocation
+	if len(np.Locations) > 0 {
+		location = np.Locations[0]
+	}
+	price, warnings, ok := t.price(regionOf(location), np.Config.MachineType, np.Config.Spot)
+	if !ok {
+		return 0, warnings, false
+	}
+	return price * float64(np.InitialNodeCount), warnings, true
+}
+
+// annotateCostEstimate records the estimated hourly cost of the node pool on
+// the Pod in the AnnotationEstimatedHourlyCost annotation. The estimate is
+// advisory: missing prices produce a warning event, and a best-effort
+// estimate if possible, but never fail provisioning. Pods already annotated
+// with the same estimate are skipped, so that each warning is only sent once
+// per node pool rather than on every attempt to ensure it.
+func (g *GKE) annotateCostEstimate(p *corev1.Pod, np *containerv1beta1.NodePool) {
+	if g.PriceTable == nil || g.Annotator == nil {
+		return
+	}
+	cost, warnings, ok := g.PriceTable.estimateHourlyCost(np, g.ClusterContext.ClusterLocation)
+	var value string
+	if ok {
+		value = strconv.FormatFloat(cost, 'f', 2, 64)
+		if p.Annotations[AnnotationEstimatedHourlyCost] == value {
+			return
+		}
+	}
+	for _, w := range warnings {
+		g.eventf(p, corev1.EventTypeWarning, EventIncompleteCostEstimate, "Estimated cost of Node Pool %s may be inaccurate: %s.", np.Name, w)
+	}
+	if !ok {
+		g.eventf(p, corev1.EventTypeWarning, EventIncompleteCostEstimate, "Cannot estimate the cost of Node Pool %s: no price for machine type %s.", np.Name, np.Config.MachineType)
+		return
+	}
+	log.Info("estimated node pool cost", "name", np.Name, "hourlyCost", value, "machineType", np.Config.MachineType, "nodeCount", np.InitialNodeCount, "spot", np.Config.Spot)
+	if err := g.Annotator.AnnotatePod(p, AnnotationEstimatedHourlyCost, value); err != nil {
+		log.Error(err, "annotating pod with estimated cost", "name", np.Name)
+	}
+}
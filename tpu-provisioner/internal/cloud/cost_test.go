@@ -0,0 +1,164 @@
+package cloud
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// recordingAnnotator records the annotations set on Pods.
+type recordingAnnotator struct {
+	annotations map[string]string
+}
+
+func (a *recordingAnnotator) AnnotatePod(_ *corev1.Pod, key, value string) error {
+	if a.annotations == nil {
+		a.annotations = map[string]string{}
+	}
+	a.annotations[key] = value
+	return nil
+}
+
+func TestLoadPriceTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.yaml")
+	load := func(data string) (*PriceTable, error) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return LoadPriceTable(path)
+	}
+
+	table, err := load(`
+default:
+  ct5lp-hightpu-4t:
+    onDemand: 4.80
+    spot: 1.68
+regions:
+  europe-west4:
+    ct5lp-hightpu-4t:
+      onDemand: 5.64
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p := table.Regions["europe-west4"]["ct5lp-hightpu-4t"]; p.OnDemand != 5.64 {
+		t.Fatalf("unexpected regional price: %+v", p)
+	}
+
+	for name, data := range map[string]string{
+		"unknown field":  "default:\n  ct5lp-hightpu-4t:\n    hourly: 4.80\n",
+		"negative price": "default:\n  ct5lp-hightpu-4t:\n    onDemand: -1\n",
+	} {
+		if _, err := load(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestPriceTable_estimateHourlyCost(t *testing.T) {
+	table := &PriceTable{
+		Default: map[string]MachinePrice{
+			"ct5lp-hightpu-4t": {OnDemand: 4.80, Spot: 1.68},
+			"ct4p-hightpu-4t":  {OnDemand: 12.88},
+		},
+		Regions: map[string]map[string]MachinePrice{
+			"europe-west4": {"ct5lp-hightpu-4t": {OnDemand: 5.64}},
+		},
+	}
+	np := func(machineType, zone string, nodes int64, spot bool) *containerv1beta1.NodePool {
+		return &containerv1beta1.NodePool{
+			Config:           &containerv1beta1.NodeConfig{MachineType: machineType, Spot: spot},
+			InitialNodeCount: nodes,
+			Locations:        []string{zone},
+		}
+	}
+
+	cases := []struct {
+		name     string
+		np       *containerv1beta1.NodePool
+		cost     float64
+		warnings int
+		ok       bool
+	}{
+		{name: "regional price", np: np("ct5lp-hightpu-4t", "europe-west4-a", 4, false), cost: 4 * 5.64, ok: true},
+		{name: "default price", np: np("ct5lp-hightpu-4t", "us-east5-a", 4, false), cost: 4 * 4.80, warnings: 1, ok: true},
+		{name: "spot price", np: np("ct5lp-hightpu-4t", "us-east5-a", 2, true), cost: 2 * 1.68, warnings: 1, ok: true},
+		{name: "no spot price", np: np("ct4p-hightpu-4t", "us-east5-a", 2, true), cost: 2 * 12.88, warnings: 2, ok: true},
+		{name: "no price", np: np("ct5p-hightpu-4t", "us-east5-a", 2, false)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cost, warnings, ok := table.estimateHourlyCost(c.np, "us-central2")
+			if ok != c.ok || len(warnings) != c.warnings {
+				t.Fatalf("expected ok=%v with %d warnings, got: %v, %v", c.ok, c.warnings, ok, warnings)
+			}
+			if diff := cost - c.cost; diff > 1e-9 || diff < -1e-9 {
+				t.Fatalf("expected cost %v, got: %v", c.cost, cost)
+			}
+		})
+	}
+}
+
+func TestGKE_annotateCostEstimate(t *testing.T) {
+	rec := record.NewFakeRecorder(10)
+	annotator := &recordingAnnotator{}
+	g := &GKE{
+		ClusterContext: GKEContext{ClusterLocation: "us-east5"},
+		Recorder:       rec,
+		PriceTable:     &PriceTable{Default: map[string]MachinePrice{"ct5lp-hightpu-4t": {OnDemand: 4.80}}},
+		Annotator:      annotator,
+	}
+	p := &corev1.Pod{}
+
+	g.annotateCostEstimate(p, &containerv1beta1.NodePool{
+		Name:             "np",
+		Config:           &containerv1beta1.NodeConfig{MachineType: "ct5lp-hightpu-4t"},
+		InitialNodeCount: 4,
+	})
+	if exp, got := "19.20", annotator.annotations[AnnotationEstimatedHourlyCost]; exp != got {
+		t.Fatalf("expected estimate %v, got: %v", exp, got)
+	}
+	if len(rec.Events) != 0 {
+		t.Fatalf("unexpected event: %v", <-rec.Events)
+	}
+
+	// Partial estimates warn once: the Pod annotated with the estimate by the
+	// first attempt gets no more events.
+	g.PriceTable.Regions = map[string]map[string]MachinePrice{"europe-west4": {"ct5lp-hightpu-4t": {OnDemand: 5.00}}}
+	partial := &containerv1beta1.NodePool{
+		Name:             "np",
+		Config:           &containerv1beta1.NodeConfig{MachineType: "ct5lp-hightpu-4t", Spot: true},
+		InitialNodeCount: 4,
+	}
+	g.annotateCostEstimate(p, partial)
+	if len(rec.Events) == 0 {
+		t.Fatalf("expected an %s event for a partial estimate", EventIncompleteCostEstimate)
+	}
+	for len(rec.Events) > 0 {
+		<-rec.Events
+	}
+	p.Annotations = map[string]string{AnnotationEstimatedHourlyCost: annotator.annotations[AnnotationEstimatedHourlyCost]}
+	g.annotateCostEstimate(p, partial)
+	if len(rec.Events) != 0 {
+		t.Fatalf("unexpected event for an already annotated Pod: %v", <-rec.Events)
+	}
+
+	annotator.annotations = nil
+	g.annotateCostEstimate(p, &containerv1beta1.NodePool{
+		Name:             "np",
+		Config:           &containerv1beta1.NodeConfig{MachineType: "ct5p-hightpu-4t"},
+		InitialNodeCount: 4,
+	})
+	if len(annotator.annotations) != 0 {
+		t.Fatalf("expected no estimate without a price, got: %v", annotator.annotations)
+	}
+	if ev := <-rec.Events; !strings.Contains(ev, EventIncompleteCostEstimate) {
+		t.Fatalf("expected an %s event, got: %v", EventIncompleteCostEstimate, ev)
+	}
+}
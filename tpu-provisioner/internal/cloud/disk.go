@@ -0,0 +1,136 @@
+package cloud
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// minBootDiskSizeGB is the smallest boot disk that GKE accepts.
+const minBootDiskSizeGB = 10
+
+// bootDiskTypes are the supported boot disk types.
+var bootDiskTypes = []string{"pd-standard", "pd-balanced", "pd-ssd", "hyperdisk-balanced"}
+
+// hyperdiskMachinePrefixes are the machine type prefixes that support
+// Hyperdisk boot disks.
+var hyperdiskMachinePrefixes = []string{"a3-", "c3-", "c3d-", "c4-", "ct6e-", "n4-"}
+
+// bootDiskForPod returns the boot disk size (GB) and type for the node pool
+// of the Pod. The AnnotationDiskSizeGB and AnnotationDiskType annotations
+// take precedence over the class, which takes precedence over the
+// accelerator defaults and then the cluster defaults. Zero values leave the
+// choice to GKE.
+func (g *GKE) bootDiskForPod(p *corev1.Pod, machineType string, class *NodePoolClass) (int64, string, error) {
+	size := g.ClusterContext.NodeDiskSizeGB
+	diskType := g.ClusterContext.NodeDiskType
+	if d, ok := g.ClusterContext.acceleratorDefaultsForPod(p); ok {
+		if d.DiskSizeGB != 0 {
+			size = d.DiskSizeGB
+		}
+		if d.DiskType != "" {
+			diskType = d.DiskType
+		}
+	}
+	if class != nil {
+		if class.DiskSizeGB != 0 {
+			size = class.DiskSizeGB
+		}
+		if class.DiskType != "" {
+			diskType = class.DiskType
+		}
+	}
+	if v, ok := p.Annotations[AnnotationDiskSizeGB]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, "", fmt.Errorf("%w: parsing %v annotation: %v", ErrInvalidDiskConfig, AnnotationDiskSizeGB, err)
+		}
+		size = n
+	}
+	if v, ok := p.Annotations[AnnotationDiskType]; ok {
+		diskType = v
+	}
+
+	if err := validateBootDisk(size, diskType, machineType); err != nil {
+		return 0, "", err
+	}
+	return size, diskType, nil
+}
+
+func validateBootDisk(size int64, diskType, machineType string) error {
+	if size != 0 && size < minBootDiskSizeGB {
+		return fmt.Errorf("%w: boot disk size %dGB is below the minimum of %dGB", ErrInvalidDiskConfig, size, minBootDiskSizeGB)
+	}
+	if diskType == "" {
+		return nil
+	}
+	if !containsString(bootDiskTypes, diskType) {
+		return fmt.Errorf("%w: unsupported boot disk type %q, must be one of %v", ErrInvalidDiskConfig, diskType, bootDiskTypes)
+	}
+	if strings.HasPrefix(diskType, "hyperdisk-") && !hasAnyPrefix(machineType, hyperdiskMachinePrefixes) {
+		return fmt.Errorf("%w: boot disk type %q is not supported by machine type %q", ErrInvalidDiskConfig, diskType, machineType)
+	}
+	return nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// localSSDCounts are the supported numbers of local SSDs per machine type, for
+// the machine types that this provisioner creates. Machine types that are
+// not listed (including TPU machine types) do not support local SSDs.
+var localSSDCounts = map[string][]int{
+	"a2-highgpu-1g":  {1},
+	"a2-highgpu-2g":  {2},
+	"a2-highgpu-4g":  {4},
+	"a2-highgpu-8g":  {8},
+	"a2-megagpu-16g": {8},
+	"a2-ultragpu-1g": {1},
+	"a2-ultragpu-2g": {2},
+	"a2-ultragpu-4g": {4},
+	"a2-ultragpu-8g": {8},
+	"a3-highgpu-8g":  {16},
+	"g2-standard-4":  {1},
+	"g2-standard-24": {2},
+	"g2-standard-48": {4},
+	"g2-standard-96": {8},
+	"n1-standard-4":  {1, 2, 3, 4, 5, 6, 7, 8, 16, 24},
+	"n1-standard-8":  {1, 2, 3, 4, 5, 6, 7, 8, 16, 24},
+	"n1-standard-16": {1, 2, 3, 4, 5, 6, 7, 8, 16, 24},
+}
+
+// localSSDCountForPod returns the number of local SSDs for the nodes of the
+// Pod's node pool. The AnnotationLocalSSDCount annotation takes precedence
+// over GKEContext.NodeLocalSSDCount.
+func (g *GKE) localSSDCountForPod(p *corev1.Pod, machineType string) (int, error) {
+	count := g.ClusterContext.NodeLocalSSDCount
+	if v, ok := p.Annotations[AnnotationLocalSSDCount]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("%w: parsing %v annotation: %v", ErrInvalidDiskConfig, AnnotationLocalSSDCount, err)
+		}
+		count = n
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	if count < 0 {
+		return 0, fmt.Errorf("%w: invalid local SSD count %d", ErrInvalidDiskConfig, count)
+	}
+	supported, ok := localSSDCounts[machineType]
+	if !ok {
+		return 0, fmt.Errorf("%w: machine type %q does not support local SSDs", ErrInvalidDiskConfig, machineType)
+	}
+	if !containsInt(supported, count) {
+		return 0, fmt.Errorf("%w: machine type %q supports %v local SSDs, not %d", ErrInvalidDiskConfig, machineType, supported, count)
+	}
+	return count, nil
+}
@@ -0,0 +1,163 @@
+package cloud
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestGKE_bootDiskForPod(t *testing.T) {
+	cases := []struct {
+		name        string
+		ctx         GKEContext
+		class       *NodePoolClass
+		annotations map[string]string
+		machineType string
+		expSize     int64
+		expType     string
+		err         bool
+	}{
+		{name: "gke defaults", machineType: "ct5p-hightpu-4t"},
+		{
+			name:        "cluster defaults",
+			ctx:         GKEContext{NodeDiskSizeGB: 200, NodeDiskType: "pd-balanced"},
+			machineType: "ct5p-hightpu-4t",
+			expSize:     200,
+			expType:     "pd-balanced",
+		},
+		{
+			name:        "class overrides cluster defaults",
+			ctx:         GKEContext{NodeDiskSizeGB: 200, NodeDiskType: "pd-balanced"},
+			class:       &NodePoolClass{DiskSizeGB: 500},
+			machineType: "ct5p-hightpu-4t",
+			expSize:     500,
+			expType:     "pd-balanced",
+		},
+		{
+			name:        "annotations override class",
+			class:       &NodePoolClass{DiskSizeGB: 500, DiskType: "pd-balanced"},
+			annotations: map[string]string{AnnotationDiskSizeGB: "1000", AnnotationDiskType: "pd-ssd"},
+			machineType: "ct5p-hightpu-4t",
+			expSize:     1000,
+			expType:     "pd-ssd",
+		},
+		{
+			name:        "hyperdisk on supported machine type",
+			annotations: map[string]string{AnnotationDiskType: "hyperdisk-balanced"},
+			machineType: "a3-highgpu-8g",
+			expType:     "hyperdisk-balanced",
+		},
+		{
+			name:        "hyperdisk on unsupported machine type",
+			annotations: map[string]string{AnnotationDiskType: "hyperdisk-balanced"},
+			machineType: "ct4p-hightpu-4t",
+			err:         true,
+		},
+		{
+			name:        "unknown disk type",
+			annotations: map[string]string{AnnotationDiskType: "floppy"},
+			machineType: "ct4p-hightpu-4t",
+			err:         true,
+		},
+		{
+			name:        "below minimum size",
+			annotations: map[string]string{AnnotationDiskSizeGB: "5"},
+			machineType: "ct4p-hightpu-4t",
+			err:         true,
+		},
+		{
+			name:        "invalid size",
+			annotations: map[string]string{AnnotationDiskSizeGB: "large"},
+			machineType: "ct4p-hightpu-4t",
+			err:         true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := &GKE{ClusterContext: c.ctx}
+			p := &corev1.Pod{}
+			p.Annotations = c.annotations
+			size, diskType, err := g.bootDiskForPod(p, c.machineType, c.class)
+			if c.err {
+				if !errors.Is(err, ErrInvalidDiskConfig) {
+					t.Fatalf("expected ErrInvalidDiskConfig, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if size != c.expSize || diskType != c.expType {
+				t.Fatalf("expected: %vGB %q, got: %vGB %q", c.expSize, c.expType, size, diskType)
+			}
+		})
+	}
+}
+
+func TestGKE_localSSDCountForPod(t *testing.T) {
+	cases := []struct {
+		name        string
+		ctx         GKEContext
+		annotations map[string]string
+		machineType string
+		exp         int
+		err         bool
+	}{
+		{name: "none", machineType: "ct5p-hightpu-4t"},
+		{name: "cluster default", ctx: GKEContext{NodeLocalSSDCount: 16}, machineType: "a3-highgpu-8g", exp: 16},
+		{
+			name:        "annotation overrides default",
+			ctx:         GKEContext{NodeLocalSSDCount: 1},
+			annotations: map[string]string{AnnotationLocalSSDCount: "4"},
+			machineType: "n1-standard-8",
+			exp:         4,
+		},
+		{
+			name:        "annotation disables default",
+			ctx:         GKEContext{NodeLocalSSDCount: 1},
+			annotations: map[string]string{AnnotationLocalSSDCount: "0"},
+			machineType: "ct5p-hightpu-4t",
+		},
+		{
+			name:        "unsupported machine type",
+			annotations: map[string]string{AnnotationLocalSSDCount: "1"},
+			machineType: "ct4p-hightpu-4t",
+			err:         true,
+		},
+		{
+			name:        "unsupported count",
+			annotations: map[string]string{AnnotationLocalSSDCount: "2"},
+			machineType: "a3-highgpu-8g",
+			err:         true,
+		},
+		{
+			name:        "invalid count",
+			annotations: map[string]string{AnnotationLocalSSDCount: "-1"},
+			machineType: "a3-highgpu-8g",
+			err:         true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := &GKE{ClusterContext: c.ctx}
+			p := &corev1.Pod{}
+			p.Annotations = c.annotations
+			count, err := g.localSSDCountForPod(p, c.machineType)
+			if c.err {
+				if !errors.Is(err, ErrInvalidDiskConfig) {
+					t.Fatalf("expected ErrInvalidDiskConfig, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if count != c.exp {
+				t.Fatalf("expected: %v, got: %v", c.exp, count)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package cloud
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// specHashLength is the number of hex digits of the spec hash that are kept.
+const specHashLength = 16
+
+// specHashVersion prefixes the ResourceLabelSpecHash of node pools whose
+// hash leaves out the per-Pod labels. Older hashes included them, so they
+// cannot be compared with the intended spec of another Pod of the same node
+// pool.
+const specHashVersion = "v2-"
+
+// nodePoolSpecHash returns the ResourceLabelSpecHash of the intended spec of
+// the node pool. The labels whose values differ between the Pods that share
+// the node pool (the trigger Pod and the propagated Pod labels) are left out,
+// so that every Pod of a Job or slice has the same intended spec.
+func (g *GKE) nodePoolSpecHash(np *containerv1beta1.NodePool) string {
+	perPod := map[string]bool{LabelTriggerPod: true}
+	perPodResource := map[string]bool{}
+	for _, k := range g.ClusterContext.PodLabelsToPropagate {
+		perPod[k] = true
+		if rk, _, ok := sanitizeGCPLabel(k, ""); ok {
+			perPodResource[rk] = true
+		}
+	}
+	return specHashVersion + specHash(np, perPod, perPodResource)
+}
+
+// specHash returns a hash of the spec of the node pool without the given
+// labels and resource labels. The locations and the creation time are left
+// out too: they are chosen when the node pool is created (for example by
+// zone fallback), not by the configuration.
+func specHash(np *containerv1beta1.NodePool, ignoredLabels, ignoredResourceLabels map[string]bool) string {
+	spec := *np
+	spec.Locations = nil
+	if np.Config != nil {
+		config := *np.Config
+		if len(ignoredLabels) > 0 && np.Config.Labels != nil {
+			config.Labels = map[string]string{}
+			for k, v := range np.Config.Labels {
+				if !ignoredLabels[k] {
+					config.Labels[k] = v
+				}
+			}
+		}
+		config.ResourceLabels = map[string]string{}
+		for k, v := range np.Config.ResourceLabels {
+			if k != ResourceLabelCreatedAt && k != ResourceLabelSpecHash && !ignoredResourceLabels[k] {
+				config.ResourceLabels[k] = v
+			}
+		}
+		spec.Config = &config
+	}
+	// Maps are marshalled with sorted keys, so the encoding is stable.
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])[:specHashLength]
+}
+
+// setSpecHash records the hash of the intended spec of the node pool in its
+// ResourceLabelSpecHash resource label.
+func (g *GKE) setSpecHash(np *containerv1beta1.NodePool) {
+	if np.Config == nil {
+		return
+	}
+	if np.Config.ResourceLabels == nil {
+		np.Config.ResourceLabels = map[string]string{}
+	}
+	np.Config.ResourceLabels[ResourceLabelSpecHash] = g.nodePoolSpecHash(np)
+}
+
+// nodePoolDrifted returns true if the existing node pool was created with a
+// different spec than the intended one, and emits an EventNodePoolDrift event
+// on the Pod if so. Node pools without a spec hash of the current
+// specHashVersion (created by older versions) never drift.
+func (g *GKE) nodePoolDrifted(p *corev1.Pod, existing, intended *containerv1beta1.NodePool) bool {
+	if existing.Config == nil || intended.Config == nil {
+		return false
+	}
+	have, ok := existing.Config.ResourceLabels[ResourceLabelSpecHash]
+	want := g.nodePoolSpecHash(intended)
+	if !ok || !strings.HasPrefix(have, specHashVersion) || have == want {
+		return false
+	}
+	action := "Leaving it in place, the Node Pool has to be replaced manually."
+	if g.RecreateDriftedNodePools && !g.DryRun {
+		action = "Recreating it."
+	}
+	log.Info("node pool differs from its intended spec", "name", existing.Name, "specHash", have, "intendedSpecHash", want, "recreate", g.RecreateDriftedNodePools)
+	g.eventf(p, corev1.EventTypeWarning, EventNodePoolDrift, "Node Pool %s differs from its intended spec (spec hash %s, intended %s). %s", existing.Name, have, want, action)
+	return true
+}
@@ -0,0 +1,17 @@
+package cloud
+
+// Events emitted by providers on the Pods that trigger node pool creation.
+const (
+	EventInvalidPodLabel = "InvalidPodLabel"
+	EventDryRunNodePool  = "DryRunNodePool"
+	EventZoneStockout    = "ZoneStockout"
+	EventNodePoolDrift   = "NodePoolDrift"
+
+	EventNameCollisionResolved = "NameCollisionResolved"
+	EventWarmNodePoolClaimed   = "WarmNodePoolClaimed"
+
+	EventUnknownAcceleratorType = "UnknownAcceleratorType"
+	EventIncompleteCostEstimate = "IncompleteCostEstimate"
+
+	EventInvalidIdleTimeout = "InvalidIdleTimeout"
+)
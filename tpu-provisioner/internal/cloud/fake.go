@@ -0,0 +1,158 @@
+package cloud
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Fake is an in-memory provider that computes node pools the same way as the
+// GKE provider but records them instead of calling the GKE API. It is useful
+// for integration tests and local development without GCP credentials.
+type Fake struct {
+	ClusterContext       GKEContext
+	NodePoolNameTemplate *template.Template
+
+	mtx       sync.Mutex
+	gke       *GKE
+	nodePools map[string]*containerv1beta1.NodePool
+	createdAt map[string]time.Time
+	requests  []FakeRequest
+}
+
+// FakeRequest is a call to Fake.EnsureNodePoolForPod that created a node pool.
+type FakeRequest struct {
+	Pod      types.NamespacedName
+	Request  NodePoolRequest
+	NodePool *containerv1beta1.NodePool
+}
+
+func (f *Fake) NodePoolLabelKey() string { return GKENodePoolNameLabel }
+
+func (f *Fake) NodePoolOwner() Owner { return f.ClusterContext.owner() }
+
+func (f *Fake) EnsureNodePoolForPod(p *corev1.Pod, r NodePoolRequest) (*NodePoolOperation, error) {
+	p, err := CompleteTPUSelectors(p, f.ClusterContext.IncompleteSelectorPolicy, f.ClusterContext.AcceleratorDefaults)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateTPUPod(p, f.ClusterContext.TPUResources...); err != nil {
+		return nil, err
+	}
+	if _, err := f.ClusterContext.nodePoolClassForPod(p); err != nil {
+		return nil, err
+	}
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	g := f.provider()
+	name, err := g.nodePoolName(p)
+	if err != nil {
+		return nil, fmt.Errorf("%w: determining node pool name: %v", ErrInvalidNodePoolConfig, err)
+	}
+	if _, exists := f.nodePools[name]; exists {
+		return nil, nil
+	}
+	np, err := g.nodePoolForPod(name, p, r)
+	if err != nil {
+		return nil, invalidNodePoolConfig(err)
+	}
+
+	log.Info("fake: creating node pool", "name", name, "nodeCount", np.InitialNodeCount)
+	if f.nodePools == nil {
+		f.nodePools = map[string]*containerv1beta1.NodePool{}
+		f.createdAt = map[string]time.Time{}
+	}
+	f.nodePools[name] = np
+	f.createdAt[name] = time.Now()
+	f.requests = append(f.requests, FakeRequest{
+		Pod:      types.NamespacedName{Namespace: p.Namespace, Name: p.Name},
+		Request:  r,
+		NodePool: np,
+	})
+	return &NodePoolOperation{Name: f.ClusterContext.OpName(fmt.Sprintf("operation-fake-%d", len(f.requests)))}, nil
+}
+
+// PollNodePoolOperation always returns done, the fake creates node pools
+// synchronously.
+func (f *Fake) PollNodePoolOperation(string) (bool, error) { return true, nil }
+
+func (f *Fake) NodePoolNameForPod(p *corev1.Pod) (string, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.provider().nodePoolName(p)
+}
+
+func (f *Fake) NodePoolTaintsForPod(p *corev1.Pod) ([]corev1.Taint, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.provider().NodePoolTaintsForPod(p)
+}
+
+func (f *Fake) DeleteNodePoolForNode(node *corev1.Node) error {
+	name, ok := node.GetLabels()[f.NodePoolLabelKey()]
+	if !ok {
+		return fmt.Errorf("node %q does not have node pool label", node.Name)
+	}
+	return f.DeleteNodePool(name)
+}
+
+func (f *Fake) DeleteNodePool(name string) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	log.Info("fake: deleting node pool", "name", name)
+	delete(f.nodePools, name)
+	delete(f.createdAt, name)
+	return nil
+}
+
+func (f *Fake) ListNodePools() ([]NodePoolInfo, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	var out []NodePoolInfo
+	for name, np := range f.nodePools {
+		out = append(out, NodePoolInfo{
+			Name:       name,
+			CreatedAt:  f.createdAt[name],
+			NodeCount:  int(np.InitialNodeCount),
+			Autoscaled: np.Autoscaling != nil && np.Autoscaling.Enabled,
+			Status:     NodePoolStatusRunning,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// Requests returns the recorded requests that created node pools, in order.
+func (f *Fake) Requests() []FakeRequest {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return append([]FakeRequest(nil), f.requests...)
+}
+
+// NodePool returns the node pool with the given name, if it exists.
+func (f *Fake) NodePool(name string) (*containerv1beta1.NodePool, bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	np, ok := f.nodePools[name]
+	return np, ok
+}
+
+// provider returns the GKE provider used to compute node pools. f.mtx must be
+// held.
+func (f *Fake) provider() *GKE {
+	if f.gke == nil {
+		f.gke = &GKE{
+			ClusterContext:       f.ClusterContext,
+			NodePoolNameTemplate: f.NodePoolNameTemplate,
+		}
+	}
+	return f.gke
+}
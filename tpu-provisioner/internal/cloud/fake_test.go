@@ -0,0 +1,77 @@
+package cloud
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFake(t *testing.T) {
+	f := &Fake{ClusterContext: GKEContext{NodeZone: "us-central2-b"}}
+	isController := true
+
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "train-0",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Job", Name: "train", UID: "0123456789abcdef", Controller: &isController},
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{
+				GKETPUNodeSelector:         "2x2x2",
+				GKEAcceleratorNodeSelector: V4PodSliceAccelerator,
+			},
+			Containers: []corev1.Container{
+				{
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{GoogleTPUResource: resource.MustParse("4")},
+					},
+				},
+			},
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		op, err := f.EnsureNodePoolForPod(p, NodePoolRequest{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// Only the first call creates the node pool.
+		if (op != nil) != (i == 0) {
+			t.Fatalf("operation %d: unexpected %+v", i, op)
+		}
+	}
+
+	reqs := f.Requests()
+	if exp, got := 1, len(reqs); exp != got {
+		t.Fatalf("requests: expected: %v, got: %v", exp, got)
+	}
+	np := reqs[0].NodePool
+	if exp, got := int64(2), np.InitialNodeCount; exp != got {
+		t.Fatalf("node count: expected: %v, got: %v", exp, got)
+	}
+	if exp, got := "ct4p-hightpu-4t", np.Config.MachineType; exp != got {
+		t.Fatalf("machine type: expected: %v, got: %v", exp, got)
+	}
+	if _, ok := f.NodePool(np.Name); !ok {
+		t.Fatalf("expected node pool %q to exist", np.Name)
+	}
+	infos, err := f.ListNodePools()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(infos) != 1 || infos[0].Name != np.Name || infos[0].NodeCount != 2 || infos[0].CreatedAt.IsZero() {
+		t.Fatalf("unexpected node pools: %+v", infos)
+	}
+
+	if err := f.DeleteNodePool(np.Name); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := f.NodePool(np.Name); ok {
+		t.Fatalf("expected node pool %q to be deleted", np.Name)
+	}
+}
@@ -1,18 +1,23 @@
 package cloud
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
+	"golang.org/x/time/rate"
 	containerv1beta1 "google.golang.org/api/container/v1beta1"
 	"google.golang.org/api/googleapi"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -21,53 +26,242 @@ var log = logf.Log.WithName("provider")
 const (
 	GKETPUNodeSelector         = "cloud.google.com/gke-tpu-topology"
 	GKEAcceleratorNodeSelector = "cloud.google.com/gke-tpu-accelerator"
-	GKENodePoolNameLabel       = "cloud.google.com/gke-nodepool"
-	GKENodePoolNamePrefix      = "tpu-provisioner-"
-	V4PodSliceAccelerator      = "tpu-v4-podslice"
-	V5ePodSliceAccelerator     = "tpu-v5-lite-podslice"
-	V5pPodSliceAccelerator     = "tpu-v5p-slice"
-	GoogleTPUResource          = "google.com/tpu"
-	gcpLabelPrefix             = "cloud.google.com/"
-	googleLabelPrefix          = "google.com/"
-	// Default max pods per node is 110, but a lower value is necessary for large scale clusters,
-	// otherwise we'll run out of IP Space and provisioning will fail.
-	// 15 pods per node will work for small and large cluster sizes, given the TPU constraint of
-	// 1 pod per TPU node + kube-system pods
-	// TODO: move this to a environment variable
-	maxPodsPerNode = 15
+	GKEGPUNodeSelector         = "cloud.google.com/gke-accelerator"
+	GKESpotNodeSelector        = "cloud.google.com/gke-spot"
+	GKEReservationNodeSelector = "cloud.google.com/reservation-name"
+	// NoReservation can be used in place of a reservation name to explicitly
+	// not consume any reservation.
+	NoReservation = "none"
+	// NoPlacementPolicy can be used in place of a placement policy name to
+	// explicitly not use a named placement policy.
+	NoPlacementPolicy      = "none"
+	GKENodePoolNameLabel   = "cloud.google.com/gke-nodepool"
+	GKENodePoolNamePrefix  = "tpu-provisioner-"
+	V4PodSliceAccelerator  = "tpu-v4-podslice"
+	V5ePodSliceAccelerator = "tpu-v5-lite-podslice"
+	V5pPodSliceAccelerator = "tpu-v5p-slice"
+	GoogleTPUResource      = "google.com/tpu"
+	NvidiaGPUResource      = "nvidia.com/gpu"
+	gcpLabelPrefix         = "cloud.google.com/"
+	googleLabelPrefix      = "google.com/"
 )
 
 type GKE struct {
 	Service        *containerv1beta1.Service
 	ClusterContext GKEContext
 
+	// NodePoolNameTemplate, if set, is used to name node pools instead of
+	// the default "tpu-provisioner-<owner id>" scheme.
+	// See ParseNodePoolNameTemplate and NodePoolNameData.
+	NodePoolNameTemplate *template.Template
+
+	// Recorder, if set, is used to emit warning events on Pods.
+	Recorder record.EventRecorder
+
+	// PriceTable, if set, is used to estimate the hourly cost of node pools
+	// before they are created, which is recorded on the Pod by Annotator.
+	PriceTable *PriceTable
+	Annotator  PodAnnotator
+
+	// RateLimiter, if set, limits node pool create and delete calls.
+	// It should be shared by everything that calls the GKE API.
+	RateLimiter *rate.Limiter
+	// RateLimitMaxWait is how long a call may wait for the RateLimiter,
+	// calls that would wait longer return a RateLimitedError. Zero never
+	// waits.
+	RateLimitMaxWait time.Duration
+
+	// DryRun computes and logs node pools instead of creating or deleting
+	// them. Read-only GKE API calls are still made.
+	DryRun bool
+
+	// MaxNodePools, if set, is the maximum number of node pools that this
+	// provisioner may manage at once. The number of existing node pools is
+	// cached for NodePoolCountTTL (default 30s).
+	MaxNodePools     int
+	NodePoolCountTTL time.Duration
+
+	// NodePoolListTTL is how long ListNodePools caches node pools (default
+	// 10s).
+	NodePoolListTTL time.Duration
+
+	// RecreateCooldown, if set, is how long after deleting a node pool no
+	// node pool of the same shape (see nodePoolShape) is created, to avoid
+	// flapping when straggler Pods show up right after a deletion.
+	RecreateCooldown time.Duration
+
+	// AsyncOperations returns from EnsureNodePoolForPod as soon as GKE
+	// accepted the create request, with a pending NodePoolOperation, instead
+	// of waiting for the node pool to be created.
+	AsyncOperations bool
+
+	// RecreateDriftedNodePools deletes and recreates existing node pools
+	// whose spec differs from the intended one (see nodePoolDrifted), even
+	// if they are in use. Otherwise drift is only reported.
+	RecreateDriftedNodePools bool
+
+	// NodePoolTemplate, if set, is the name of a node pool in the cluster
+	// whose spec new node pools are copied from, see
+	// applyNodePoolTemplate. It is fetched at most every
+	// NodePoolTemplateTTL (default 10m).
+	NodePoolTemplate    string
+	NodePoolTemplateTTL time.Duration
+
+	// ZoneFallback creates the node pool in the next zone of zonesForPod if
+	// the first one has no capacity. It does not apply to AsyncOperations.
+	ZoneFallback bool
+
+	// WarmNodePools are the shapes that idle node pools are kept of, see
+	// RefillWarmNodePools. Pods claim a warm node pool of their shape with
+	// the same spec instead of creating one.
+	WarmNodePools []WarmNodePoolShape
+
+	// CreateHooks, if set, are called before and after node pools are
+	// created, see CreateHooks.
+	CreateHooks *CreateHooks
+
+	// APITimeouts bound the calls to the GKE API.
+	APITimeouts APITimeouts
+
 	inProgressDeletes sync.Map
 	inProgressCreates sync.Map
+	// dryRunPlanned holds the names of node pools that would have been
+	// created in dry-run mode, so that each is only planned once.
+	dryRunPlanned sync.Map
+
+	counterOnce sync.Once
+	counter     *nodePoolCounter
+
+	listCacheOnce sync.Once
+	listCache     *nodePoolListCache
+
+	cooldowns shapeCooldowns
+
+	templateCache nodePoolTemplateCache
+
+	// pendingCreates maps the names of pending create operations to the
+	// node pools they create, to classify their errors.
+	pendingCreates sync.Map
+
+	// warmClaims maps the names of claimed warm node pools to the parent
+	// (namespace/kind/name) of the workload they were claimed for, see
+	// claimWarmNodePool.
+	warmMtx    sync.Mutex
+	warmClaims map[string]string
 }
 
 func (g *GKE) NodePoolLabelKey() string { return GKENodePoolNameLabel }
 
-func (g *GKE) EnsureNodePoolForPod(p *corev1.Pod) error {
-	name, err := podToNodePoolName(p, GKENodePoolNamePrefix, "")
+func (g *GKE) NodePoolOwner() Owner { return g.ClusterContext.owner() }
+
+func (g *GKE) EnsureNodePoolForPod(p *corev1.Pod, r NodePoolRequest) (*NodePoolOperation, error) {
+	p, err := CompleteTPUSelectors(p, g.ClusterContext.IncompleteSelectorPolicy, g.ClusterContext.AcceleratorDefaults)
 	if err != nil {
-		return fmt.Errorf("determining node pool name: %w", err)
+		return nil, err
+	}
+	if err := ValidateTPUPod(p, g.ClusterContext.TPUResources...); err != nil {
+		return nil, err
+	}
+	if _, err := g.ClusterContext.nodePoolClassForPod(p); err != nil {
+		return nil, err
 	}
 
-	exists, err := g.nodePoolExists(name)
+	name, err := g.nodePoolName(p)
 	if err != nil {
-		return fmt.Errorf("checking if node pool exists: %w", err)
+		return nil, fmt.Errorf("%w: determining node pool name: %v", ErrInvalidNodePoolConfig, err)
 	}
-	if exists {
-		return nil
+	collisions := 0
+	if alternate := p.Annotations[AnnotationNodePoolName]; alternate != "" {
+		// The collision was resolved before, keep using the same name.
+		if err := validateNodePoolName(alternate); err != nil {
+			return nil, fmt.Errorf("%w: %s annotation: %v", ErrInvalidNodePoolConfig, AnnotationNodePoolName, err)
+		}
+		name, collisions = alternate, maxNameCollisions
+	}
+	op, err := g.ensureNodePool(p, r, name, collisions)
+	return op, classifyTransientError(err)
+}
+
+// ensureNodePool ensures the node pool with the given name for the Pod.
+// collisions is the number of alternate names that were tried already, see
+// resolveNameCollision.
+func (g *GKE) ensureNodePool(p *corev1.Pod, r NodePoolRequest, name string, collisions int) (*NodePoolOperation, error) {
+	existing, err := g.getNodePool(name)
+	if err != nil {
+		return nil, fmt.Errorf("checking if node pool exists: %w", err)
+	}
+	if existing != nil && g.nameCollides(existing, p) {
+		return g.resolveNameCollision(p, r, name, collisions)
+	}
+
+	np, err := g.nodePoolForPod(name, p, r)
+	if err != nil {
+		err = invalidNodePoolConfig(err)
+	} else if g.NodePoolTemplate != "" {
+		np, err = g.applyNodePoolTemplate(np)
+	}
+	if existing != nil {
+		// Only existing node pools are checked for drift, whose Pods may
+		// no longer be valid: those are left alone.
+		if err != nil || !g.nodePoolDrifted(p, existing, np) || !g.RecreateDriftedNodePools || g.DryRun {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	g.setSpecHash(np)
+	network, err := g.networkForPod(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.checkNetwork(network); err != nil {
+		return nil, err
+	}
+	if existing == nil && len(g.WarmNodePools) > 0 && !g.DryRun {
+		if claimed, err := g.claimWarmNodePool(p, np); err != nil || claimed {
+			return nil, err
+		}
+	}
+	if g.RecreateCooldown > 0 {
+		shape := nodePoolShape(np)
+		if wait := g.cooldowns.remaining(shape, g.RecreateCooldown, time.Now()); wait > 0 {
+			return nil, &CooldownError{Shape: shape, RetryAfter: wait}
+		}
 	}
+	g.annotateCostEstimate(p, np)
 
-	np, err := g.nodePoolForPod(name, p)
+	if g.DryRun {
+		return nil, g.planNodePool(p, np)
+	}
+	zones, err := g.zonesForPod(p)
 	if err != nil {
-		return fmt.Errorf("determining node pool for pod: %w", err)
+		return nil, err
+	}
+	if zones, err = r.Placement.zones(zones); err != nil {
+		return nil, err
+	}
+	locality, err := g.localityForPod(p)
+	if err != nil {
+		return nil, err
 	}
 
-	log.Info("creating node pool", "name", name, "nodeCount", np.InitialNodeCount)
+	system := nodeSystemConfigOf(np.Config)
+	var maxPods int64
+	if np.MaxPodsConstraint != nil {
+		maxPods = np.MaxPodsConstraint.MaxPodsPerNode
+	}
+	log.Info("creating node pool", "name", name, "nodeCount", np.InitialNodeCount,
+		"machineType", np.Config.MachineType, "version", np.Version, "diskSizeGb", np.Config.DiskSizeGb, "diskType", np.Config.DiskType, "imageType", np.Config.ImageType,
+		"minCpuPlatform", np.Config.MinCpuPlatform, "confidentialNodes", np.Config.ConfidentialNodes != nil, "sandbox", np.Config.SandboxConfig != nil,
+		"kubeletConfig", formatSettings(system.Kubelet), "sysctls", formatSettings(system.Sysctls),
+		"resourceManagerTags", formatSettings(resourceManagerTagsOf(np.Config)),
+		"maxPodsPerNode", maxPods,
+		"locality", locality, "locations", np.Locations, "network", network.Network, "subnetwork", network.Subnetwork, "podRange", network.PodRange,
+		"gvnic", np.Config.Gvnic != nil, "additionalNetworks", additionalNetworkCount(np),
+		"autoUpgrade", np.Management.AutoUpgrade, "autoRepair", np.Management.AutoRepair)
 
+	np.Config.ResourceLabels[ResourceLabelCreatedAt] = strconv.FormatInt(time.Now().Unix(), 10)
 	req := &containerv1beta1.CreateNodePoolRequest{
 		NodePool: np,
 		Parent:   g.ClusterContext.ClusterName(),
@@ -77,19 +271,115 @@ func (g *GKE) EnsureNodePoolForPod(p *corev1.Pod) error {
 	// Node Pool will occur at the same time. The result is an error:
 	// "do: googleapi: Error 400: Cluster is running incompatible operation ..."
 	// To avoid a bunch of failed requests, we dedeuplicate here.
-	if _, inProgress := g.inProgressCreates.Load(name); inProgress {
-		return ErrDuplicateRequest
+	// LoadOrStore acts as a per-node-pool lock: only one caller wins.
+	if _, inProgress := g.inProgressCreates.LoadOrStore(name, struct{}{}); inProgress {
+		return nil, ErrDuplicateRequest
 	}
-	g.inProgressCreates.Store(name, struct{}{})
 	defer g.inProgressCreates.Delete(name)
+	if req.NodePool, err = g.CreateHooks.preCreate(p, np); err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		log.Info("deleting node pool to recreate it with its intended spec", "name", name)
+		if err := g.deleteNodePoolAndWait(name); err != nil {
+			return nil, fmt.Errorf("deleting drifted node pool: %w", err)
+		}
+		g.nodePoolListCache().invalidate()
+	}
+	counter := g.nodePoolCounter()
+	if counter != nil {
+		if err := counter.reserve(); err != nil {
+			return nil, err
+		}
+	}
+	var op *NodePoolOperation
+	if locality == LocalityRegional {
+		// Regional node pools span their locations, there is no other zone
+		// to fall back to.
+		op, err = g.createNodePool(req)
+	} else {
+		op, err = g.createNodePoolInZones(p, req, zones)
+	}
+	if counter != nil {
+		counter.release(err == nil)
+	}
+	if errors.Is(err, errNodePoolExists) {
+		// The node pool was created between the existence check and the
+		// create call, by another worker or by someone else.
+		return g.ensureExistingNodePool(p, r, name, collisions)
+	}
+	if err == nil {
+		g.nodePoolListCache().invalidate()
+		if op != nil && !op.Pending {
+			g.CreateHooks.postCreate(p, req.NodePool)
+		}
+	}
+	return op, err
+}
 
+// createNodePool creates the node pool and waits for the operation to finish.
+// The operation is returned even if it failed, so that it can be reported.
+func (g *GKE) createNodePool(req *containerv1beta1.CreateNodePoolRequest) (*NodePoolOperation, error) {
+	ctx, cancel := callContext(g.APITimeouts.Create)
+	defer cancel()
+	if err := g.waitForRateLimit(ctx); err != nil {
+		return nil, err
+	}
 	call := g.Service.Projects.Locations.Clusters.NodePools.Create(g.ClusterContext.ClusterName(), req)
-	op, err := call.Do()
+	op, err := call.Context(ctx).Do()
 	if err != nil {
-		return fmt.Errorf("do: %w", err)
+		if gerr, ok := err.(*googleapi.Error); ok && gerr.Code == http.StatusConflict {
+			return nil, fmt.Errorf("%w: %v", errNodePoolExists, err)
+		}
+		return nil, classifyCreateError(fmt.Errorf("do: %w", err), req.NodePool)
 	}
 
-	return waitForGkeOp(g.Service, g.ClusterContext, op)
+	npOp := &NodePoolOperation{Name: g.ClusterContext.OpName(op.Name), SelfLink: op.SelfLink, NodePool: req.NodePool.Name}
+	log.Info("started node pool operation", "name", req.NodePool.Name, "operation", npOp.Name)
+	if g.AsyncOperations {
+		npOp.Pending = true
+		g.pendingCreates.Store(npOp.Name, req.NodePool)
+		return npOp, nil
+	}
+	return npOp, classifyCreateError(g.waitForOperation(op), req.NodePool)
+}
+
+func (g *GKE) PollNodePoolOperation(name string) (bool, error) {
+	ctx, cancel := callContext(g.APITimeouts.Poll)
+	defer cancel()
+	op, err := g.Service.Projects.Locations.Operations.Get(name).Context(ctx).Do()
+	if err != nil {
+		return false, classifyTransientError(fmt.Errorf("getting operation: %w", err))
+	}
+	if op.Status != "DONE" {
+		return false, nil
+	}
+	np := &containerv1beta1.NodePool{}
+	if v, ok := g.pendingCreates.LoadAndDelete(name); ok {
+		np = v.(*containerv1beta1.NodePool)
+	}
+	g.nodePoolListCache().invalidate()
+	if op.Error != nil {
+		return true, classifyCreateError(fmt.Errorf("operation %s failed: %s", name, op.Error.Message), np)
+	}
+	if np.Name != "" {
+		g.CreateHooks.postCreate(nil, np)
+	}
+	return true, nil
+}
+
+// planNodePool logs (and records an event for) the node pool that would be
+// created for the Pod in dry-run mode.
+func (g *GKE) planNodePool(p *corev1.Pod, np *containerv1beta1.NodePool) error {
+	if _, planned := g.dryRunPlanned.LoadOrStore(np.Name, struct{}{}); planned {
+		return nil
+	}
+	log.Info("dry run: would create node pool", "name", np.Name, "nodeCount", np.InitialNodeCount)
+	if spec, err := json.Marshal(np); err == nil {
+		log.V(1).Info("dry run: node pool spec", "name", np.Name, "spec", string(spec))
+	}
+	g.eventf(p, corev1.EventTypeNormal, EventDryRunNodePool, "Dry run: would create Node Pool %s with %d node(s).", np.Name, np.InitialNodeCount)
+	return nil
 }
 
 func (g *GKE) DeleteNodePoolForNode(node *corev1.Node) error {
@@ -97,45 +387,243 @@ func (g *GKE) DeleteNodePoolForNode(node *corev1.Node) error {
 	if !ok {
 		return fmt.Errorf("node %q does not have node pool label", node.Name)
 	}
+	return g.DeleteNodePool(name)
+}
+
+func (g *GKE) DeleteNodePool(name string) error {
+	if g.DryRun {
+		log.Info("dry run: would delete node pool", "name", name)
+		g.dryRunPlanned.Delete(name)
+		return nil
+	}
+	// Never delete a node pool that this process is still creating.
+	if _, inProgress := g.inProgressCreates.Load(name); inProgress {
+		return ErrNodePoolCreationInProgress
+	}
 	// Due to concurrent reconciles, multiple deletes for the same
 	// Node Pool will occur at the same time. The result is an error:
 	// To avoid a bunch of failed requests, we dedeuplicate here.
-	if _, inProgress := g.inProgressDeletes.Load(name); inProgress {
+	if _, inProgress := g.inProgressDeletes.LoadOrStore(name, struct{}{}); inProgress {
 		return ErrDuplicateRequest
 	}
-	g.inProgressDeletes.Store(name, struct{}{})
 	defer g.inProgressDeletes.Delete(name)
 
-	op, err := g.Service.Projects.Locations.Clusters.Delete(g.ClusterContext.NodePoolName(name)).Do()
+	if counter := g.nodePoolCounter(); counter != nil {
+		defer counter.invalidate()
+	}
+	defer g.nodePoolListCache().invalidate()
+
+	ctx, cancel := callContext(g.APITimeouts.Create)
+	defer cancel()
+	if err := g.waitForRateLimit(ctx); err != nil {
+		return err
+	}
+	np, err := g.getNodePool(name)
 	if err != nil {
-		return fmt.Errorf("deleting node pool %q: %w", name, err)
+		return classifyTransientError(fmt.Errorf("checking node pool owner: %w", err))
+	}
+	if np != nil && !g.NodePoolOwner().ownsNodePool(np) {
+		return fmt.Errorf("%w: %s", ErrNodePoolNotOwned, name)
+	}
+	var shape string
+	if g.RecreateCooldown > 0 && np != nil {
+		shape = nodePoolShape(np)
 	}
+	op, err := g.Service.Projects.Locations.Clusters.Delete(g.ClusterContext.NodePoolName(name)).Context(ctx).Do()
+	if err != nil {
+		if gerr, ok := err.(*googleapi.Error); ok && gerr.Code == http.StatusNotFound {
+			// Already deleted.
+			return nil
+		}
+		return classifyTransientError(fmt.Errorf("deleting node pool %q: %w", name, err))
+	}
+
+	if err := g.waitForOperation(op); err != nil {
+		return classifyTransientError(err)
+	}
+	if shape != "" {
+		g.cooldowns.record(shape, time.Now())
+	}
+	return nil
+}
+
+// nodePoolCounter returns the counter that enforces MaxNodePools, or nil if
+// there is no limit.
+func (g *GKE) nodePoolCounter() *nodePoolCounter {
+	if g.MaxNodePools <= 0 {
+		return nil
+	}
+	g.counterOnce.Do(func() {
+		ttl := g.NodePoolCountTTL
+		if ttl == 0 {
+			ttl = defaultNodePoolCountTTL
+		}
+		g.counter = &nodePoolCounter{
+			max:   g.MaxNodePools,
+			ttl:   ttl,
+			owner: g.NodePoolOwner(),
+			list:  g.listNodePools,
+		}
+	})
+	return g.counter
+}
+
+func (g *GKE) ListNodePools() ([]NodePoolInfo, error) {
+	return g.nodePoolListCache().get()
+}
 
-	return waitForGkeOp(g.Service, g.ClusterContext, op)
+func (g *GKE) nodePoolListCache() *nodePoolListCache {
+	g.listCacheOnce.Do(func() {
+		ttl := g.NodePoolListTTL
+		if ttl == 0 {
+			ttl = defaultNodePoolListTTL
+		}
+		g.listCache = &nodePoolListCache{ttl: ttl, owner: g.NodePoolOwner(), list: g.listNodePools}
+	})
+	return g.listCache
 }
 
-func (g *GKE) nodePoolExists(name string) (bool, error) {
+func (g *GKE) listNodePools() ([]*containerv1beta1.NodePool, error) {
+	return listAllNodePools(func(string) ([]*containerv1beta1.NodePool, string, error) {
+		// The v1beta1 NodePools.List call returns all node pools of the
+		// cluster in a single page.
+		ctx, cancel := callContext(g.APITimeouts.List)
+		defer cancel()
+		resp, err := g.Service.Projects.Locations.Clusters.NodePools.List(g.ClusterContext.ClusterName()).Context(ctx).Do()
+		if err != nil {
+			return nil, "", classifyTransientError(classifyClusterError(err))
+		}
+		return resp.NodePools, "", nil
+	})
+}
+
+// waitForRateLimit waits until a call can be made without exceeding the rate
+// limit, for at most RateLimitMaxWait. If the call would have to wait longer,
+// a RateLimitedError is returned right away instead of blocking. The wait is
+// given up with the error of ctx if ctx is done first.
+func (g *GKE) waitForRateLimit(ctx context.Context) error {
+	if g.RateLimiter == nil {
+		return nil
+	}
+	res := g.RateLimiter.Reserve()
+	delay := res.Delay()
+	if delay == 0 {
+		return nil
+	}
+	if delay > g.RateLimitMaxWait {
+		res.Cancel()
+		return &RateLimitedError{RetryAfter: delay}
+	}
+	log.Info("delaying GKE API call for the rate limit", "delay", delay)
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		res.Cancel()
+		return ctx.Err()
+	}
+}
+
+// getNodePool returns the node pool with the given name, or nil if it does
+// not exist.
+func (g *GKE) getNodePool(name string) (*containerv1beta1.NodePool, error) {
+	ctx, cancel := callContext(g.APITimeouts.List)
+	defer cancel()
 	call := g.Service.Projects.Locations.Clusters.NodePools.Get(g.ClusterContext.NodePoolName(name))
-	_, err := call.Do()
+	np, err := call.Context(ctx).Do()
 	if err == nil {
-		return true, nil
+		return np, nil
+	}
+	if isClusterNotFoundError(err) {
+		return nil, fmt.Errorf("%w: %v", ErrClusterNotFound, err)
 	}
 	if gerr, ok := err.(*googleapi.Error); ok && gerr.Code == http.StatusNotFound {
-		return false, nil
+		return nil, nil
 	}
-	return false, err
+	return nil, err
 }
 
-func (g *GKE) nodePoolForPod(name string, p *corev1.Pod) (*containerv1beta1.NodePool, error) {
+// ValidateCluster returns ErrClusterNotFound if the configured cluster does
+// not exist, so that misconfigurations can be reported at startup. It
+// records the cluster's Pod IP range in ClusterPodCIDR if that is not set.
+func (g *GKE) ValidateCluster() error {
+	ctx, cancel := callContext(g.APITimeouts.List)
+	defer cancel()
+	cluster, err := g.Service.Projects.Locations.Clusters.Get(g.ClusterContext.ClusterName()).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("getting cluster %s: %w", g.ClusterContext.ClusterName(), classifyClusterError(err))
+	}
+	if g.ClusterContext.ClusterPodCIDR == "" && cluster.IpAllocationPolicy != nil {
+		g.ClusterContext.ClusterPodCIDR = cluster.IpAllocationPolicy.ClusterIpv4CidrBlock
+	}
+	return nil
+}
+
+// NodePoolNameForPod returns the preferred name of the node pool for the Pod.
+// EnsureNodePoolForPod may fall back to a different name if that one is
+// already taken by another workload.
+func (g *GKE) NodePoolNameForPod(p *corev1.Pod) (string, error) {
+	return g.nodePoolName(p)
+}
+
+// nodePoolName returns the name of the node pool for the Pod, using the
+// configured name template if there is one.
+func (g *GKE) nodePoolName(p *corev1.Pod) (string, error) {
+	if g.NodePoolNameTemplate == nil {
+		return podToNodePoolName(p, GKENodePoolNamePrefix, "")
+	}
+	ownerID, err := podOwnerID(p)
+	if err != nil {
+		return "", err
+	}
+	name, err := executeNodePoolNameTemplate(g.NodePoolNameTemplate, nodePoolNameDataForPod(p, ownerID))
+	if err != nil {
+		return "", err
+	}
+	return name, validateNodePoolName(name)
+}
+
+// invalidNodePoolConfig wraps an error returned by nodePoolForPod with
+// ErrInvalidNodePoolConfig, unless it already is a more specific
+// configuration error.
+func invalidNodePoolConfig(err error) error {
+	if errors.Is(err, ErrInvalidDiskConfig) || errors.Is(err, ErrUnknownNodePoolClass) || errors.Is(err, ErrInvalidNetworkConfig) ||
+		errors.Is(err, ErrIncompatibleNodeVersion) || errors.Is(err, ErrInvalidServiceAccount) || errors.Is(err, ErrNodeManagementConflict) ||
+		errors.Is(err, ErrIncompatibleLocality) || errors.Is(err, ErrInvalidImageType) ||
+		errors.Is(err, ErrInvalidHostVMConfig) || errors.Is(err, ErrInvalidSandboxConfig) || errors.Is(err, ErrInvalidKubeletConfig) ||
+		errors.Is(err, ErrInvalidMaxPodsPerNode) || errors.Is(err, ErrInvalidResourceManagerTags) || errors.Is(err, ErrInvalidNetworkInterfaceConfig) ||
+		errors.Is(err, ErrUnsatisfiableTopology) {
+		return err
+	}
+	return fmt.Errorf("%w: determining node pool for pod: %v", ErrInvalidNodePoolConfig, err)
+}
+
+// nodePoolBelongsToPod returns true if the node pool was created for the
+// same parent (Job) as the Pod.
+func (g *GKE) nodePoolBelongsToPod(np *containerv1beta1.NodePool, p *corev1.Pod) bool {
+	ref := metav1.GetControllerOf(p)
+	if ref == nil || !g.NodePoolOwner().ownsNodePool(np) {
+		return false
+	}
+	lbls := np.Config.Labels
+	return lbls[LabelParentKind] == strings.ToLower(ref.Kind) &&
+		lbls[LabelParentName] == strings.ToLower(ref.Name) &&
+		lbls[LabelParentNamespace] == strings.ToLower(p.Namespace)
+}
+
+func (g *GKE) nodePoolForPod(name string, p *corev1.Pod, r NodePoolRequest) (*containerv1beta1.NodePool, error) {
 	ref := metav1.GetControllerOf(p)
 	if ref == nil {
 		// TODO: Allow for standalone Pods?
 		return nil, errors.New("no owner reference")
 	}
 
+	owner := g.NodePoolOwner()
 	labels := map[string]string{
 		// Used to keep track of what Node Pools this provisioner is responsible for.
-		LabelNodepoolManager: LabelNodepoolManagerTPUPodinator,
+		owner.NodeLabelKey(): owner.Value,
 
 		// Leave some bread crumbs:
 		LabelParentKind: strings.ToLower(ref.Kind),
@@ -143,46 +631,59 @@ func (g *GKE) nodePoolForPod(name string, p *corev1.Pod) (*containerv1beta1.Node
 		// Assuming a Namespaced parent here...
 		LabelParentNamespace: strings.ToLower(p.Namespace),
 	}
+	if v := sanitizeLabelValue(p.Name); v != "" {
+		labels[LabelTriggerPod] = v
+	}
+	jobSet := p.Labels[JobSetNameLabel]
+	if v := sanitizeLabelValue(jobSet); v != "" {
+		labels[LabelJobSetName] = v
+	}
 
-	for k, v := range p.Spec.NodeSelector {
+	nodeSelector := NodeSelectorForPod(p)
+	for k, v := range nodeSelector {
 		// Don't copy GCP/Google labels onto the node.
 		if !strings.HasPrefix(k, gcpLabelPrefix) && !strings.HasPrefix(k, googleLabelPrefix) {
 			labels[k] = v
 		}
 	}
 
-	// Pod should already be filtered for this Node Selector at this point.
-	tpuTopo, ok := p.Spec.NodeSelector[GKETPUNodeSelector]
-	if !ok {
-		return nil, fmt.Errorf("missing node selector key: %v", GKETPUNodeSelector)
+	resourceLabels := map[string]string{
+		owner.Key:                    owner.Value,
+		ResourceLabelParentNamespace: strings.ToLower(p.Namespace),
 	}
-	accel, ok := p.Spec.NodeSelector[GKEAcceleratorNodeSelector]
-	if !ok {
-		return nil, fmt.Errorf("missing node selector key: %v", GKEAcceleratorNodeSelector)
+	// Resource labels only record what is shared by all node pools of a
+	// workload, the Pod name is only a node label.
+	if _, v, ok := sanitizeGCPLabel(ResourceLabelJobSetName, jobSet); ok && v != "" {
+		resourceLabels[ResourceLabelJobSetName] = v
 	}
-	tpuRequest, err := sumTPURequests(p)
-	if err != nil {
-		return nil, fmt.Errorf("summing TPU requests: %w", err)
+	for _, k := range g.ClusterContext.PodLabelsToPropagate {
+		v, ok := p.Labels[k]
+		if !ok {
+			continue
+		}
+		labels[k] = v
+		rk, rv, ok := sanitizeGCPLabel(k, v)
+		if !ok {
+			g.eventf(p, corev1.EventTypeWarning, EventInvalidPodLabel, "Not copying label %q onto Node Pool resource labels: does not satisfy GCP label constraints.", k)
+			continue
+		}
+		resourceLabels[rk] = rv
 	}
 
-	nodeCount, err := tpuTopologyToNodeCount(accel, tpuTopo)
+	class, err := g.ClusterContext.nodePoolClassForPod(p)
 	if err != nil {
-		return nil, fmt.Errorf("determining node count: %w", err)
+		return nil, err
 	}
-	machineType, err := tpuMachineType(accel, tpuRequest)
+	s, err := g.nodePoolSettingsForPod(p, r, class)
 	if err != nil {
-		return nil, fmt.Errorf("determining node count: %w", err)
+		return nil, err
 	}
-
-	var reservation *containerv1beta1.ReservationAffinity
-	if resName, ok := p.Spec.NodeSelector["cloud.google.com/reservation-name"]; ok {
-		reservation = &containerv1beta1.ReservationAffinity{
-			ConsumeReservationType: "SPECIFIC_RESERVATION",
-			Key:                    "compute.googleapis.com/reservation-name",
-			Values: []string{
-				resName,
-			},
-		}
+	g.warnUnknownAccelerator(p)
+	if s.autoscaling != nil {
+		labels[LabelAutoscalingMin] = strconv.FormatInt(s.autoscaling.MinNodeCount, 10)
+	}
+	if v, ok := g.idleTimeoutForPod(p); ok {
+		labels[LabelIdleTimeout] = v
 	}
 
 	var secondaryDisks []containerv1beta1.SecondaryBootDisk
@@ -196,10 +697,11 @@ func (g *GKE) nodePoolForPod(name string, p *corev1.Pod) (*containerv1beta1.Node
 		}
 	}
 
-	return &containerv1beta1.NodePool{
+	np := &containerv1beta1.NodePool{
 		Name: name,
 		Config: &containerv1beta1.NodeConfig{
-			ServiceAccount: g.ClusterContext.NodeServiceAccount,
+			ServiceAccount: s.identity.ServiceAccount,
+			OauthScopes:    s.identity.OAuthScopes,
 			ShieldedInstanceConfig: &containerv1beta1.ShieldedInstanceConfig{
 				EnableIntegrityMonitoring: true,
 				EnableSecureBoot:          true,
@@ -208,40 +710,420 @@ func (g *GKE) nodePoolForPod(name string, p *corev1.Pod) (*containerv1beta1.Node
 			// NOTE: vendor/ was manually updated to include the field because
 			// it was not currently available at the time of writing:
 			SecondaryBootDisks:  secondaryDisks,
-			MachineType:         machineType,
-			ReservationAffinity: reservation,
+			MachineType:         s.machineType,
+			Accelerators:        s.accelerators,
+			ReservationAffinity: s.reservation,
+			Spot:                s.spot,
 			Labels:              labels,
+			ResourceLabels:      resourceLabels,
+			Taints:              s.taints,
+
+			DiskSizeGb:                     s.diskSize,
+			DiskType:                       s.diskType,
+			ImageType:                      s.imageType,
+			MinCpuPlatform:                 s.hostVM.MinCPUPlatform,
+			ConfidentialNodes:              s.hostVM.confidentialNodes(),
+			Gvnic:                          s.nics.gvnic(),
+			SandboxConfig:                  sandboxConfig(s.sandbox),
+			KubeletConfig:                  s.system.kubeletConfig(),
+			LinuxNodeConfig:                s.system.linuxNodeConfig(),
+			ResourceManagerTags:            resourceManagerTags(s.tags),
+			LocalSsdCount:                  s.localSSDCount,
+			EphemeralStorageLocalSsdConfig: s.ephemeralConfig,
 		},
-		InitialNodeCount: int64(nodeCount),
-		Locations:        []string{g.ClusterContext.NodeZone},
-		PlacementPolicy: &containerv1beta1.PlacementPolicy{
-			TpuTopology: tpuTopo,
-			Type:        "COMPACT",
-		},
-		Management: &containerv1beta1.NodeManagement{
-			AutoRepair:  true,
-			AutoUpgrade: true,
-		},
+		InitialNodeCount: int64(s.nodeCount),
+		Version:          s.version,
+		Autoscaling:      s.autoscaling,
+		Locations:        s.locations,
+		PlacementPolicy:  s.placement,
+		NetworkConfig:    s.network.nodeNetworkConfig(),
+		Management:       s.management,
 		UpgradeSettings: &containerv1beta1.UpgradeSettings{
 			MaxSurge: 1,
 		},
-		MaxPodsConstraint: &containerv1beta1.MaxPodsConstraint{MaxPodsPerNode: maxPodsPerNode},
-	}, nil
+		MaxPodsConstraint: &containerv1beta1.MaxPodsConstraint{MaxPodsPerNode: s.maxPods},
+	}
+	s.nics.apply(np)
+	if err := r.Placement.apply(np, s.locality); err != nil {
+		return nil, err
+	}
+	if class != nil {
+		class.apply(np.Config)
+	}
+	return np, nil
 }
 
-func sumTPURequests(p *corev1.Pod) (int, error) {
+// nodePoolSettings is the part of the node pool for a Pod that is derived
+// from the Pod, see nodePoolSettingsForPod.
+type nodePoolSettings struct {
+	machineType  string
+	nodeCount    int
+	accelerators []*containerv1beta1.AcceleratorConfig
+	placement    *containerv1beta1.PlacementPolicy
+	spot         bool
+	taints       []*containerv1beta1.NodeTaint
+	diskSize     int64
+	diskType     string
+	imageType    string
+	hostVM       hostVM
+	sandbox      string
+	system       nodeSystemConfig
+	tags         map[string]string
+	identity     nodeIdentity
+
+	localSSDCount   int64
+	ephemeralConfig *containerv1beta1.EphemeralStorageLocalSsdConfig
+
+	autoscaling *containerv1beta1.NodePoolAutoscaling
+	network     nodeNetwork
+	maxPods     int64
+	nics        nodeNICs
+	locations   []string
+	locality    string
+	management  *containerv1beta1.NodeManagement
+	version     string
+	reservation *containerv1beta1.ReservationAffinity
+}
+
+// nodePoolSettingsForPod validates the Pod's node selectors, resources and
+// node pool annotations and returns the node pool settings derived from them.
+// It is the single place where a Pod is checked before its node pool is
+// created, nodePoolForPod and ValidatePod both use it. class is the node pool
+// class of the Pod, or nil.
+func (g *GKE) nodePoolSettingsForPod(p *corev1.Pod, r NodePoolRequest, class *NodePoolClass) (*nodePoolSettings, error) {
+	var (
+		s            nodePoolSettings
+		err          error
+		nodeSelector = NodeSelectorForPod(p)
+	)
+	if gpuType, ok := nodeSelector[GKEGPUNodeSelector]; ok {
+		gpuCount, err := sumResourceLimits(p, g.ClusterContext.gpuResource())
+		if err != nil {
+			return nil, fmt.Errorf("summing GPU limits: %w", err)
+		}
+		s.machineType, err = gpuMachineType(gpuType, gpuCount)
+		if err != nil {
+			return nil, fmt.Errorf("determining machine type: %w", err)
+		}
+		s.nodeCount = 1
+		s.accelerators = []*containerv1beta1.AcceleratorConfig{
+			{
+				AcceleratorType:  gpuType,
+				AcceleratorCount: int64(gpuCount),
+				GpuDriverInstallationConfig: &containerv1beta1.GPUDriverInstallationConfig{
+					GpuDriverVersion: "DEFAULT",
+				},
+			},
+		}
+	} else {
+		// Pod should already be filtered for this Node Selector at this point.
+		tpuTopo, ok := nodeSelector[GKETPUNodeSelector]
+		if !ok {
+			return nil, fmt.Errorf("missing node selector key: %v", GKETPUNodeSelector)
+		}
+		if r.Topology != "" {
+			tpuTopo = r.Topology
+		}
+		accel, ok := nodeSelector[GKEAcceleratorNodeSelector]
+		if !ok {
+			return nil, fmt.Errorf("missing node selector key: %v", GKEAcceleratorNodeSelector)
+		}
+		tpuRequest, err := sumResourceRequests(p, g.ClusterContext.tpuResources()...)
+		if err != nil {
+			return nil, fmt.Errorf("summing TPU requests: %w", err)
+		}
+
+		s.nodeCount, err = TPUTopologyToNodeCount(accel, tpuTopo)
+		if err != nil {
+			return nil, fmt.Errorf("determining node count: %w", err)
+		}
+		if r.NodeCount > 0 {
+			s.nodeCount = r.NodeCount
+		}
+		s.machineType, err = g.ClusterContext.tpuMachineType(accel, tpuRequest)
+		if err != nil {
+			return nil, fmt.Errorf("determining node count: %w", err)
+		}
+		// Single-host node pools don't need a placement policy, GKE derives
+		// the topology from the machine type.
+		if s.nodeCount > 1 {
+			s.placement = &containerv1beta1.PlacementPolicy{
+				TpuTopology: tpuTopo,
+				Type:        "COMPACT",
+				PolicyName:  g.placementPolicyForPod(p, accel),
+			}
+		}
+	}
+
+	if s.spot, err = g.podRequestsSpot(p); err != nil {
+		return nil, err
+	}
+	podTaints, err := g.NodePoolTaintsForPod(p)
+	if err != nil {
+		return nil, err
+	}
+	if s.taints, err = gkeTaints(podTaints); err != nil {
+		return nil, fmt.Errorf("converting taints: %w", err)
+	}
+
+	if s.diskSize, s.diskType, err = g.bootDiskForPod(p, s.machineType, class); err != nil {
+		return nil, err
+	}
+	if s.imageType, err = g.imageTypeForPod(p, s.machineType, class); err != nil {
+		return nil, err
+	}
+	if s.hostVM, err = g.hostVMForPod(p, s.machineType); err != nil {
+		return nil, err
+	}
+	if s.sandbox, err = g.sandboxForPod(p, s.machineType, s.imageType); err != nil {
+		return nil, err
+	}
+	if s.system, err = g.systemConfigForPod(p); err != nil {
+		return nil, err
+	}
+	if s.tags, err = g.resourceManagerTagsForPod(p); err != nil {
+		return nil, err
+	}
+	if s.identity, err = g.identityForPod(p, class); err != nil {
+		return nil, err
+	}
+
+	localSSDs, err := g.localSSDCountForPod(p, s.machineType)
+	if err != nil {
+		return nil, err
+	}
+	if g.ClusterContext.NodeLocalSSDEphemeral {
+		if localSSDs > 0 {
+			s.ephemeralConfig = &containerv1beta1.EphemeralStorageLocalSsdConfig{LocalSsdCount: int64(localSSDs)}
+		}
+	} else {
+		s.localSSDCount = int64(localSSDs)
+	}
+
+	if s.autoscaling, err = g.autoscalingForPod(p, s.nodeCount); err != nil {
+		return nil, err
+	}
+
+	if s.network, err = g.networkForPod(p); err != nil {
+		return nil, err
+	}
+	if s.maxPods, err = g.maxPodsPerNodeForPod(p, s.network.PodRange); err != nil {
+		return nil, err
+	}
+	if s.nics, err = g.networkInterfacesForPod(p, s.machineType, s.network); err != nil {
+		return nil, err
+	}
+
+	zones, err := g.zonesForPod(p)
+	if err != nil {
+		return nil, err
+	}
+	if zones, err = r.Placement.zones(zones); err != nil {
+		return nil, err
+	}
+	if s.locations, err = g.locationsForPod(p, zones, s.placement != nil); err != nil {
+		return nil, err
+	}
+	if s.locality, err = g.localityForPod(p); err != nil {
+		return nil, err
+	}
+
+	if s.management, err = g.managementForPod(p); err != nil {
+		return nil, err
+	}
+
+	if s.version, err = nodeVersionFor(g.ClusterContext.NodeVersion, s.machineType); err != nil {
+		return nil, err
+	}
+
+	s.reservation = g.reservationForPod(p)
+	if s.spot && s.reservation != nil && s.reservation.ConsumeReservationType == "SPECIFIC_RESERVATION" {
+		return nil, errors.New("invalid node pool config: spot and reservation cannot both be requested")
+	}
+	return &s, nil
+}
+
+// placementPolicyForPod returns the name of the resource policy for the
+// multi-host node pool of the Pod, or "" for none. The annotation takes
+// precedence over the accelerator defaults, then the per-accelerator default
+// and then the global default.
+func (g *GKE) placementPolicyForPod(p *corev1.Pod, accel string) string {
+	name := g.ClusterContext.NodePlacementPolicy
+	if v, ok := g.ClusterContext.NodePlacementPolicies[accel]; ok {
+		name = v
+	}
+	if v := g.ClusterContext.AcceleratorDefaults[accel].PlacementPolicy; v != "" {
+		name = v
+	}
+	if v, ok := p.Annotations[AnnotationPlacementPolicy]; ok {
+		name = v
+	}
+	if name == NoPlacementPolicy {
+		return ""
+	}
+	return name
+}
+
+// reservationForPod returns the reservation affinity for the node pool of the
+// Pod. The annotation takes precedence over the node selector, which takes
+// precedence over the accelerator defaults and then the global default.
+func (g *GKE) reservationForPod(p *corev1.Pod) *containerv1beta1.ReservationAffinity {
+	resName := g.ClusterContext.NodeReservation
+	if d, ok := g.ClusterContext.acceleratorDefaultsForPod(p); ok && d.Reservation != "" {
+		resName = d.Reservation
+	}
+	if v, ok := NodeSelectorForPod(p)[GKEReservationNodeSelector]; ok {
+		resName = v
+	}
+	if v, ok := p.Annotations[AnnotationReservation]; ok {
+		resName = v
+	}
+
+	switch resName {
+	case "":
+		return nil
+	case NoReservation:
+		return &containerv1beta1.ReservationAffinity{
+			ConsumeReservationType: "NO_RESERVATION",
+		}
+	}
+	return &containerv1beta1.ReservationAffinity{
+		ConsumeReservationType: "SPECIFIC_RESERVATION",
+		Key:                    "compute.googleapis.com/reservation-name",
+		Values: []string{
+			g.ClusterContext.reservationPath(resName),
+		},
+	}
+}
+
+func (g *GKE) NodePoolTaintsForPod(p *corev1.Pod) ([]corev1.Taint, error) {
+	defaults := g.ClusterContext.DefaultTPUTaints
+	if d, ok := g.ClusterContext.acceleratorDefaultsForPod(p); ok && d.Taints != "" {
+		var err error
+		if defaults, err = ParseTaints(d.Taints); err != nil {
+			return nil, fmt.Errorf("parsing taints of accelerator defaults: %w", err)
+		}
+	}
+	taints, err := NodePoolTaintsForPod(p, defaults)
+	if err != nil {
+		return nil, err
+	}
+	taints = mergeTaints(g.ClusterContext.BaseTaints, taints)
+	spot, err := g.podRequestsSpot(p)
+	if err != nil {
+		return nil, err
+	}
+	if spot {
+		taints = append(append([]corev1.Taint{}, taints...), SpotTaint)
+	}
+	sandbox, err := g.sandboxTypeForPod(p)
+	if err != nil {
+		return nil, err
+	}
+	if sandbox != "" {
+		taints = append(append([]corev1.Taint{}, taints...), SandboxTaint)
+	}
+	return taints, nil
+}
+
+// podRequestsSpot returns whether the node pool for the Pod should use Spot
+// VMs. The annotation takes precedence over the node selector, which takes
+// precedence over the global default.
+func (g *GKE) podRequestsSpot(p *corev1.Pod) (bool, error) {
+	if v, ok := p.Annotations[AnnotationSpot]; ok {
+		spot, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, fmt.Errorf("parsing %v annotation: %w", AnnotationSpot, err)
+		}
+		return spot, nil
+	}
+	if v, ok := NodeSelectorForPod(p)[GKESpotNodeSelector]; ok {
+		return v == "true", nil
+	}
+	return g.ClusterContext.NodeSpot, nil
+}
+
+func (g *GKE) eventf(p *corev1.Pod, eventType, reason, messageFmt string, args ...interface{}) {
+	if g.Recorder != nil {
+		g.Recorder.Eventf(p, eventType, reason, messageFmt, args...)
+	}
+}
+
+// sumResourceRequests returns the number of the resources, any of them
+// counted together, that the Pod requires the way the scheduler computes it:
+// the sum of the container requests or, if larger, the largest init
+// container request, plus the Pod overhead. Containers that only set a limit
+// request the limit, which is what the API server defaults the request to
+// for extended resources.
+func sumResourceRequests(p *corev1.Pod, resources ...string) (int, error) {
 	var n int
 	for _, c := range p.Spec.Containers {
-		if c.Resources.Requests == nil {
+		req, err := containerResourceRequest(c, resources)
+		if err != nil {
+			return 0, err
+		}
+		n += req
+	}
+	for _, c := range p.Spec.InitContainers {
+		// Init containers run one at a time, before the containers.
+		req, err := containerResourceRequest(c, resources)
+		if err != nil {
+			return 0, err
+		}
+		if req > n {
+			n = req
+		}
+	}
+	for _, resource := range resources {
+		overhead, ok := p.Spec.Overhead[corev1.ResourceName(resource)]
+		if !ok {
 			continue
 		}
-		req, ok := c.Resources.Requests[corev1.ResourceName(GoogleTPUResource)]
+		v, ok := overhead.AsInt64()
 		if !ok {
+			return 0, fmt.Errorf("invalid %v overhead: %v", resource, overhead.String())
+		}
+		n += int(v)
+	}
+	return n, nil
+}
+
+// containerResourceRequest sums the requests of the container for any of the
+// resources, using the limit of those that it does not request.
+func containerResourceRequest(c corev1.Container, resources []string) (int, error) {
+	var n int
+	for _, resource := range resources {
+		name := corev1.ResourceName(resource)
+		q, ok := c.Resources.Requests[name]
+		kind := "request"
+		if !ok {
+			if q, ok = c.Resources.Limits[name]; !ok {
+				continue
+			}
+			kind = "limit"
+		}
+		v, ok := q.AsInt64()
+		if !ok {
+			return 0, fmt.Errorf("invalid %v %s: %v", resource, kind, q.String())
+		}
+		n += int(v)
+	}
+	return n, nil
+}
+
+func sumResourceLimits(p *corev1.Pod, resource string) (int, error) {
+	var n int
+	for _, c := range p.Spec.Containers {
+		if c.Resources.Limits == nil {
 			continue
 		}
-		v, ok := req.AsInt64()
+		lim, ok := c.Resources.Limits[corev1.ResourceName(resource)]
 		if !ok {
-			return 0, fmt.Errorf(("invalid TPU request: %v"), req.String())
+			continue
+		}
+		v, ok := lim.AsInt64()
+		if !ok {
+			return 0, fmt.Errorf(("invalid %v limit: %v"), resource, lim.String())
 		}
 		n += int(v)
 	}
@@ -249,52 +1131,44 @@ func sumTPURequests(p *corev1.Pod) (int, error) {
 }
 
 func podToNodePoolName(p *corev1.Pod, prefix, suffix string) (string, error) {
+	ownerID, err := podOwnerID(p)
+	if err != nil {
+		return "", err
+	}
+	return prefix + ownerID[0:12] + suffix, nil
+}
+
+// podOwnerID returns an identifier for the workload that owns the Pod.
+func podOwnerID(p *corev1.Pod) (string, error) {
 	// If JobSet job key annotation (SHA1 hash of namespaced job key) exists,
 	// use it as the owner ID.
 	// This annotation is stable through Job recreations, so the node pool name
 	// generated here will be the same if the JobSet is restarted.
-	var ownerID string
-	if jobKey, exists := p.Annotations["jobset.sigs.k8s.io/job-key"]; exists {
-		ownerID = jobKey
-	} else {
-		// Otherwise, fall back to the Job UID. The Job UID is not stable through
-		// recreations, so if a Job is recreated, the node pool name generated here
-		// will be different.
-		ref := metav1.GetControllerOf(p)
-		if ref == nil {
-			return "", errors.New("no owner reference")
-		}
-		ownerID = string(ref.UID)
+	if jobKey, exists := p.Annotations[JobSetJobKeyAnnotation]; exists {
+		return jobKey, nil
 	}
-	return prefix + ownerID[0:12] + suffix, nil
+	// Otherwise, fall back to the Job UID. The Job UID is not stable through
+	// recreations, so if a Job is recreated, the node pool name generated here
+	// will be different.
+	ref := metav1.GetControllerOf(p)
+	if ref == nil {
+		return "", errors.New("no owner reference")
+	}
+	return string(ref.UID), nil
 }
 
-func tpuTopologyToNodeCount(accelerator, topo string) (int, error) {
-	var expectedDims int
-	switch accelerator {
-	case V4PodSliceAccelerator, V5pPodSliceAccelerator:
-		expectedDims = 3
-	case V5ePodSliceAccelerator:
-		expectedDims = 2
-	default:
+// TPUTopologyToNodeCount returns the number of TPU hosts (Nodes) needed for the
+// given accelerator and topology.
+func TPUTopologyToNodeCount(accelerator, topo string) (int, error) {
+	a, ok := tpuAccelerators[accelerator]
+	if !ok {
 		return 0, fmt.Errorf("invalid accelerator: %v", accelerator)
 	}
-
-	split := strings.Split(topo, "x")
-	if len(split) != expectedDims {
-		return 0, fmt.Errorf("invalid topology: %v, expected %v dimensions", topo, expectedDims)
-	}
-
-	product := 1
-	for _, s := range split {
-		x, err := strconv.Atoi(s)
-		if err != nil {
-			return 0, fmt.Errorf("invalid topology: %v, could not convert %q to int: %w", topo, s, err)
-		}
-		product *= x
+	chips, err := parseTPUTopology(a, topo)
+	if err != nil {
+		return 0, fmt.Errorf("invalid topology: %v, %w", topo, err)
 	}
-
-	return product / 4, nil
+	return chips / 4, nil
 }
 
 // tpuMachineType takes an accelerator type (from nodeSelector) and a TPU request
@@ -303,26 +1177,57 @@ func tpuMachineType(accel string, tpuRequest int) (string, error) {
 	if tpuRequest < 1 {
 		return "", fmt.Errorf("invalid TPU request: %v", tpuRequest)
 	}
+	a, ok := tpuAccelerators[accel]
+	if !ok {
+		return "", fmt.Errorf("invalid accelerator: %v", accel)
+	}
+	return fmt.Sprintf("%s%vt", a.MachineTypePrefix, tpuRequest), nil
+}
+
+// gpuMachineTypes maps a GPU accelerator type (from nodeSelector) to the
+// machine types that attach a given number of those GPUs.
+var gpuMachineTypes = map[string]map[int]string{
+	"nvidia-tesla-a100": {1: "a2-highgpu-1g", 2: "a2-highgpu-2g", 4: "a2-highgpu-4g", 8: "a2-highgpu-8g", 16: "a2-megagpu-16g"},
+	"nvidia-a100-80gb":  {1: "a2-ultragpu-1g", 2: "a2-ultragpu-2g", 4: "a2-ultragpu-4g", 8: "a2-ultragpu-8g"},
+	"nvidia-h100-80gb":  {8: "a3-highgpu-8g"},
+	"nvidia-l4":         {1: "g2-standard-4", 2: "g2-standard-24", 4: "g2-standard-48", 8: "g2-standard-96"},
+	"nvidia-tesla-t4":   {1: "n1-standard-4", 2: "n1-standard-8", 4: "n1-standard-16"},
+}
+
+// gpuMachineType takes a GPU accelerator type (from nodeSelector) and a GPU limit
+// from container limits and returns the corresponding machine type.
+func gpuMachineType(accel string, gpuLimit int) (string, error) {
+	if gpuLimit < 1 {
+		return "", fmt.Errorf("invalid GPU limit: %v", gpuLimit)
+	}
 
-	switch accel {
-	case V4PodSliceAccelerator: // v4
-		return fmt.Sprintf("ct4p-hightpu-%vt", tpuRequest), nil
-	case V5ePodSliceAccelerator: // v5e
-		return fmt.Sprintf("ct5lp-hightpu-%vt", tpuRequest), nil
-	case V5pPodSliceAccelerator: // v5p
-		return fmt.Sprintf("ct5p-hightpu-%vt", tpuRequest), nil
+	counts, ok := gpuMachineTypes[accel]
+	if !ok {
+		return "", fmt.Errorf("invalid accelerator: %v", accel)
 	}
+	machineType, ok := counts[gpuLimit]
+	if !ok {
+		return "", fmt.Errorf("unsupported GPU count %v for accelerator %v", gpuLimit, accel)
+	}
+	return machineType, nil
+}
 
-	return "", fmt.Errorf("invalid accelerator: %v", accel)
+// waitForOperation waits for the operation to finish, each poll bounded by
+// the Poll timeout.
+func (g *GKE) waitForOperation(operation *containerv1beta1.Operation) error {
+	return waitForGkeOp(g.Service, g.ClusterContext, operation, g.APITimeouts.Poll)
 }
 
-func waitForGkeOp(svc *containerv1beta1.Service, c GKEContext, operation *containerv1beta1.Operation) error {
+func waitForGkeOp(svc *containerv1beta1.Service, c GKEContext, operation *containerv1beta1.Operation, pollTimeout time.Duration) error {
 	operationWaitTimeout := 30 * time.Minute
 	operationPollInterval := 5 * time.Second
 
 	for start := time.Now(); time.Since(start) < operationWaitTimeout; time.Sleep(operationPollInterval) {
-		if op, err := svc.Projects.Locations.Operations.Get(c.OpName(operation.Name)).Do(); err == nil {
+		if op, err := getGkeOp(svc, c.OpName(operation.Name), pollTimeout); err == nil {
 			if op.Status == "DONE" {
+				if op.Error != nil {
+					return fmt.Errorf("operation %s failed: %s", operation.Name, op.Error.Message)
+				}
 				return nil
 			}
 		} else {
@@ -332,3 +1237,9 @@ func waitForGkeOp(svc *containerv1beta1.Service, c GKEContext, operation *contai
 
 	return fmt.Errorf("timeout while waiting for operation %s on %s to complete", operation.Name, operation.TargetLink)
 }
+
+func getGkeOp(svc *containerv1beta1.Service, name string, timeout time.Duration) (*containerv1beta1.Operation, error) {
+	ctx, cancel := callContext(timeout)
+	defer cancel()
+	return svc.Projects.Locations.Operations.Get(name).Context(ctx).Do()
+}
@@ -1,15 +1,164 @@
 package cloud
 
-import "fmt"
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
 
 type GKEContext struct {
-	ProjectID          string
-	ClusterLocation    string
-	Cluster            string
-	NodeZone           string
+	ProjectID       string
+	ClusterLocation string
+	Cluster         string
+	NodeZone        string
+	// NodeZones, if set, are the zones to create node pools in instead of
+	// NodeZone, in order of preference.
+	NodeZones          []string
 	NodeServiceAccount string
 	NodeSecondaryDisk  string
 	NodeTags           []string
+
+	// NodePoolLocality is the default locality of node pools, LocalityZonal
+	// if empty.
+	NodePoolLocality string
+
+	// TPUResources are the names of the Pod resources that request TPU
+	// chips, GoogleTPUResource if empty. Requests of all of them are summed,
+	// see sumResourceRequests.
+	TPUResources []string
+
+	// GPUResource is the name of the Pod resource that requests GPUs,
+	// NvidiaGPUResource if empty. Its limits are summed, see
+	// sumResourceLimits.
+	GPUResource string
+
+	// PodLabelsToPropagate are the keys of Pod labels that are copied onto
+	// created node pools as node labels and as GCP resource labels.
+	PodLabelsToPropagate []string
+
+	// DefaultTPUTaints are applied to TPU node pools unless the Pod
+	// specifies taints via the AnnotationNodePoolTaints annotation.
+	DefaultTPUTaints []corev1.Taint
+
+	// BaseTaints are applied to every node pool, in addition to the
+	// DefaultTPUTaints or the taints of the AnnotationNodePoolTaints
+	// annotation, which override base taints with the same key and effect.
+	BaseTaints []corev1.Taint
+
+	// DisableNodeAutoUpgrade and DisableNodeAutoRepair turn off auto-upgrade
+	// and auto-repair of node pools unless the Pod requests otherwise.
+	DisableNodeAutoUpgrade bool
+	DisableNodeAutoRepair  bool
+
+	// ReleaseChannel is the release channel of the cluster (for example
+	// "REGULAR"), if known. Auto-upgrade cannot be disabled in a release
+	// channel.
+	ReleaseChannel string
+
+	// NodeSpot is whether node pools use Spot VMs unless the Pod requests
+	// otherwise.
+	NodeSpot bool
+
+	// NodeReservation is the name of the reservation that node pools consume
+	// unless the Pod requests otherwise. "none" explicitly disables
+	// consuming reservations.
+	NodeReservation string
+
+	// NodePlacementPolicy is the name of the resource policy that multi-host
+	// TPU node pools use unless the Pod requests otherwise.
+	// NodePlacementPolicies overrides it per accelerator type (the value of
+	// the cloud.google.com/gke-tpu-accelerator node selector).
+	NodePlacementPolicy   string
+	NodePlacementPolicies map[string]string
+
+	// AcceleratorDefaults are the node pool defaults per TPU accelerator
+	// type, see AcceleratorDefaults.
+	AcceleratorDefaults map[string]AcceleratorDefaults
+
+	// IncompleteSelectorPolicy is what happens to Pods that select only one
+	// of the TPU accelerator type and topology, IncompleteSelectorReject if
+	// empty, see CompleteTPUSelectors.
+	IncompleteSelectorPolicy string
+
+	// NodePoolClasses are the node pool templates that Pods can select with
+	// the AnnotationNodePoolClass annotation, by name.
+	NodePoolClasses map[string]NodePoolClass
+
+	// NodeAutoscalingMin and NodeAutoscalingMax are the default cluster
+	// autoscaling bounds of node pools. Autoscaling is disabled unless a
+	// maximum is set here or by the Pod.
+	NodeAutoscalingMin int
+	NodeAutoscalingMax int
+
+	// NodeDiskSizeGB and NodeDiskType are the default boot disk of nodes.
+	// Zero values use the GKE defaults.
+	NodeDiskSizeGB int64
+	NodeDiskType   string
+
+	// NodeImageType is the default node image type, empty for the GKE
+	// default.
+	NodeImageType string
+
+	// NodeMinCPUPlatform is the default minimum CPU platform of nodes and
+	// NodeConfidential whether they are Confidential GKE Nodes by default.
+	NodeMinCPUPlatform string
+	NodeConfidential   bool
+
+	// NodeSandbox is the default GKE Sandbox type of nodes, empty for none.
+	NodeSandbox string
+
+	// NodeLocalSSDCount is the default number of local SSDs of nodes. They
+	// back ephemeral storage (emptyDir volumes) if NodeLocalSSDEphemeral is
+	// set, and are attached as raw scratch disks otherwise.
+	NodeLocalSSDCount     int
+	NodeLocalSSDEphemeral bool
+
+	// NodeNetwork and NodeSubnetwork are the default additional network of
+	// nodes, NodePodRange is the default secondary range for Pod IPs. Empty
+	// values use the cluster network.
+	NodeNetwork    string
+	NodeSubnetwork string
+	NodePodRange   string
+	// NodeGvnic enables gVNIC on all nodes. Otherwise it is only enabled
+	// where it is required.
+	// NodeAdditionalNetworks are the default network interfaces attached
+	// after the additional network.
+	NodeGvnic              bool
+	NodeAdditionalNetworks []NetworkInterface
+
+	// NodeMaxPodsPerNode is the default maximum number of Pods per node, 15
+	// if it is not set. ClusterPodCIDR is the cluster's Pod IPv4 range (for
+	// example "10.4.0.0/14") that the Pod range of each node must fit into,
+	// not checked if it is empty.
+	NodeMaxPodsPerNode int
+	ClusterPodCIDR     string
+
+	// NodeResourceManagerTags are the resource manager tag bindings of the
+	// nodes, see ParseResourceManagerTags.
+	NodeResourceManagerTags map[string]string
+
+	// NodeOAuthScopes are the default OAuth scopes of nodes, empty for the
+	// GKE defaults. NodeServiceAccounts overrides NodeServiceAccount per
+	// namespace of the Pod.
+	NodeOAuthScopes     []string
+	NodeServiceAccounts map[string]string
+
+	// NodeVersion is the GKE version of node pools, "latest",
+	// "current-control-plane" or empty for the GKE default.
+	// See ValidateNodeVersion.
+	NodeVersion string
+
+	// NetworkProjectID is the project of NodeNetwork and NodeSubnetwork
+	// (and of the network annotations), for example a Shared VPC host
+	// project, and ReservationProjectID the project of shared reservations.
+	// Both default to ProjectID. Names that are resource paths are used
+	// as is.
+	NetworkProjectID     string
+	ReservationProjectID string
+
+	// Owner marks the node pools that this provisioner manages, DefaultOwner
+	// if it is not set.
+	Owner Owner
 }
 
 func (c GKEContext) ClusterName() string {
@@ -36,3 +185,27 @@ func (c GKEContext) OpName(op string) string {
 		op,
 	)
 }
+
+// tpuResources returns TPUResources, or GoogleTPUResource if it is empty.
+func (c GKEContext) tpuResources() []string {
+	if len(c.TPUResources) == 0 {
+		return []string{GoogleTPUResource}
+	}
+	return c.TPUResources
+}
+
+// gpuResource returns GPUResource, or NvidiaGPUResource if it is empty.
+func (c GKEContext) gpuResource() string {
+	if c.GPUResource == "" {
+		return NvidiaGPUResource
+	}
+	return c.GPUResource
+}
+
+// owner returns Owner, or DefaultOwner if it is not set.
+func (c GKEContext) owner() Owner {
+	if c.Owner == (Owner{}) {
+		return DefaultOwner
+	}
+	return c.Owner
+}
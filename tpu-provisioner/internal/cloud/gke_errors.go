@@ -0,0 +1,306 @@
+package cloud
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	"google.golang.org/api/googleapi"
+)
+
+// Error categories returned by ErrorCategory.
+const (
+	ErrorCategoryQuota      = "quota"
+	ErrorCategoryPermission = "permission"
+	// ErrorCategoryNetworkPermission and ErrorCategoryReservationPermission
+	// are used for ProjectPermissionErrors, to tell which project's IAM
+	// policy denied the node pool.
+	ErrorCategoryNetworkPermission     = "network_permission"
+	ErrorCategoryReservationPermission = "reservation_permission"
+	ErrorCategoryNotFound              = "not_found"
+	ErrorCategoryReservation           = "reservation"
+	ErrorCategoryLimit                 = "limit"
+	ErrorCategoryInvalid               = "invalid_config"
+	ErrorCategoryPlacement             = "placement_policy"
+	ErrorCategoryStockout              = "stockout"
+	ErrorCategoryInProgress            = "operation_in_progress"
+	ErrorCategoryResourceManagerTag    = "resource_manager_tag"
+	ErrorCategoryTransient             = "transient"
+	ErrorCategoryCreateHook            = "create_hook"
+	// ErrorCategoryMisconfigured is used for errors that affect every call
+	// until the provisioner is reconfigured, such as ErrClusterNotFound.
+	ErrorCategoryMisconfigured = "misconfigured"
+	ErrorCategoryOther         = "other"
+)
+
+// ErrorCategory returns a coarse category for an error returned by a
+// provider, suitable for use as a metric label.
+func ErrorCategory(err error) string {
+	if errors.Is(err, ErrClusterNotFound) || errors.Is(err, ErrTemplateNotFound) {
+		return ErrorCategoryMisconfigured
+	}
+	if errors.Is(err, ErrReservationUnavailable) {
+		return ErrorCategoryReservation
+	}
+	if errors.Is(err, ErrQuotaExceeded) {
+		return ErrorCategoryQuota
+	}
+	if errors.Is(err, ErrNodePoolLimitReached) {
+		return ErrorCategoryLimit
+	}
+	if errors.Is(err, ErrInvalidTPUConfig) || errors.Is(err, ErrInvalidNodePoolConfig) || errors.Is(err, ErrUnknownNodePoolClass) ||
+		errors.Is(err, ErrInvalidDiskConfig) || errors.Is(err, ErrInvalidNetworkConfig) || errors.Is(err, ErrIncompatibleNodeVersion) ||
+		errors.Is(err, ErrInvalidServiceAccount) || errors.Is(err, ErrNodeManagementConflict) || errors.Is(err, ErrIncompatibleLocality) ||
+		errors.Is(err, ErrInvalidImageType) || errors.Is(err, ErrInvalidHostVMConfig) || errors.Is(err, ErrInvalidSandboxConfig) ||
+		errors.Is(err, ErrInvalidKubeletConfig) || errors.Is(err, ErrInvalidMaxPodsPerNode) || errors.Is(err, ErrInvalidResourceManagerTags) ||
+		errors.Is(err, ErrInvalidNetworkInterfaceConfig) || errors.Is(err, ErrIncompleteTPUSelector) || errors.Is(err, ErrUnsatisfiableTopology) {
+		return ErrorCategoryInvalid
+	}
+	if errors.Is(err, ErrResourceManagerTagBinding) {
+		return ErrorCategoryResourceManagerTag
+	}
+	if errors.Is(err, ErrCreateHookRejected) || errors.Is(err, ErrCreateHookFailed) {
+		return ErrorCategoryCreateHook
+	}
+	if errors.Is(err, ErrServiceAccountPermission) {
+		return ErrorCategoryPermission
+	}
+	var projectPermission *ProjectPermissionError
+	if errors.As(err, &projectPermission) {
+		switch projectPermission.Role {
+		case ProjectRoleNetwork:
+			return ErrorCategoryNetworkPermission
+		case ProjectRoleReservation:
+			return ErrorCategoryReservationPermission
+		}
+		return ErrorCategoryPermission
+	}
+	if errors.Is(err, ErrPlacementPolicyNotFound) {
+		return ErrorCategoryPlacement
+	}
+	if errors.Is(err, ErrZoneStockout) || isStockoutError(err) {
+		return ErrorCategoryStockout
+	}
+	if errors.Is(err, ErrOperationInProgress) {
+		return ErrorCategoryInProgress
+	}
+	if errors.Is(err, ErrTransient) {
+		return ErrorCategoryTransient
+	}
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		switch gerr.Code {
+		case http.StatusTooManyRequests:
+			return ErrorCategoryQuota
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return ErrorCategoryPermission
+		case http.StatusNotFound:
+			return ErrorCategoryNotFound
+		}
+	}
+	if strings.Contains(strings.ToLower(err.Error()), "quota") {
+		return ErrorCategoryQuota
+	}
+	return ErrorCategoryOther
+}
+
+// classifyCreateError wraps errors returned while creating a node pool with
+// the matching sentinel error (if any), so that callers can use errors.Is.
+func classifyCreateError(err error, np *containerv1beta1.NodePool) error {
+	if err == nil {
+		return nil
+	}
+	if isClusterNotFoundError(err) {
+		return fmt.Errorf("%w: %v", ErrClusterNotFound, err)
+	}
+	if isResourceManagerTagError(err, np) {
+		return fmt.Errorf("%w: %v", ErrResourceManagerTagBinding, err)
+	}
+	if perr := projectPermissionError(err, np); perr != nil {
+		return perr
+	}
+	if isReservationError(err, np) {
+		return fmt.Errorf("%w: %v", ErrReservationUnavailable, err)
+	}
+	if isPlacementPolicyError(err, np) {
+		return fmt.Errorf("%w: %v", ErrPlacementPolicyNotFound, err)
+	}
+	if isStockoutError(err) {
+		return fmt.Errorf("%w: %v", ErrZoneStockout, err)
+	}
+	if isOperationInProgressError(err) {
+		return &OperationInProgressError{Operation: conflictingOperation(err), Err: err}
+	}
+	if isServiceAccountError(err, np) {
+		return fmt.Errorf("%w: %v", ErrServiceAccountPermission, err)
+	}
+	if isQuotaError(err) {
+		return fmt.Errorf("%w: %v", ErrQuotaExceeded, err)
+	}
+	if isNodeVersionError(err, np) {
+		return fmt.Errorf("%w: %v", ErrIncompatibleNodeVersion, err)
+	}
+	if isNodeManagementError(err, np) {
+		return fmt.Errorf("%w: %v", ErrNodeManagementConflict, err)
+	}
+	return err
+}
+
+// isClusterNotFoundError matches errors about the cluster or project itself
+// rather than one of its node pools, such as:
+// "googleapi: Error 404: Not found: projects/my-project/locations/us-central2/clusters/my-cluster., notFound"
+// "googleapi: Error 404: Requested project not found or user does not have access to it., notFound"
+func isClusterNotFoundError(err error) bool {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) || gerr.Code != http.StatusNotFound {
+		return false
+	}
+	msg := strings.ToLower(gerr.Message)
+	// Errors about a missing node pool name the cluster (and project) in the
+	// node pool's path.
+	if strings.Contains(msg, "/nodepools/") {
+		return false
+	}
+	return strings.Contains(msg, "requested project") || strings.Contains(msg, "project not found") ||
+		strings.Contains(msg, "/clusters/")
+}
+
+// classifyClusterError wraps err with ErrClusterNotFound if it reports that
+// the cluster or project does not exist.
+func classifyClusterError(err error) error {
+	if err != nil && isClusterNotFoundError(err) {
+		return fmt.Errorf("%w: %v", ErrClusterNotFound, err)
+	}
+	return err
+}
+
+func isNodeVersionError(err error, np *containerv1beta1.NodePool) bool {
+	if np.Version == "" {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	if !strings.Contains(msg, "version") {
+		return false
+	}
+	for _, s := range []string{"not supported", "unsupported", "incompatible", "not available", "invalid"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isStockoutError matches errors such as:
+// "operation operation-123 failed: The zone 'projects/.../zones/us-central2-b' does not have enough resources available to fulfill the request."
+// "... ZONE_RESOURCE_POOL_EXHAUSTED ..." or "... GCE_STOCKOUT ..."
+// "googleapi: Error 429: There is no more capacity in the zone \"us-central2-b\"; you can try in another zone where Cloud TPU Nodes are offered."
+// Both stockouts and exceeded quotas may be reported as RESOURCE_EXHAUSTED,
+// errors that mention quota are never stockouts.
+func isStockoutError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	if strings.Contains(msg, "quota") {
+		return false
+	}
+	for _, s := range []string{"resource_pool_exhausted", "stockout", "does not have enough resources available", "no more capacity", "insufficient capacity", "not enough capacity"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isOperationInProgressError matches errors such as:
+// "googleapi: Error 400: Cluster is running incompatible operation operation-1700000000000-0123abcd., failedPrecondition"
+// "Operation operation-1700000000000-0123abcd is currently upgrading cluster my-cluster. Please wait and try again once it is done."
+func isOperationInProgressError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"incompatible operation", "is currently upgrading", "is currently creating", "is currently deleting", "another operation is in progress"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// operationNamePattern matches the name of a GKE operation, for example
+// "operation-1700000000000-0123abcd".
+var operationNamePattern = regexp.MustCompile(`operation-[0-9]+(-[0-9a-f]+)*`)
+
+// conflictingOperation returns the name of the operation that the error
+// reports as conflicting, or "" if it does not name one. The conflicting
+// operation is named last: errors of failed operations start with the name
+// of the failed operation itself.
+func conflictingOperation(err error) string {
+	names := operationNamePattern.FindAllString(err.Error(), -1)
+	if len(names) == 0 {
+		return ""
+	}
+	return names[len(names)-1]
+}
+
+// isServiceAccountError matches errors such as:
+// "The user does not have access to service account \"sa@...\". Ask a project owner to grant you the iam.serviceAccountUser role on the service account"
+// "Service account \"sa@...\" does not exist."
+func isServiceAccountError(err error, np *containerv1beta1.NodePool) bool {
+	if np.Config == nil || np.Config.ServiceAccount == "" {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	if !strings.Contains(msg, "service account") {
+		return false
+	}
+	for _, s := range []string{"does not have access", "serviceaccountuser", "permission", "does not exist", "not found"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPlacementPolicyError(err error, np *containerv1beta1.NodePool) bool {
+	if np.PlacementPolicy == nil || np.PlacementPolicy.PolicyName == "" {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	if !strings.Contains(msg, "policy") {
+		return false
+	}
+	return strings.Contains(msg, "not found") || strings.Contains(msg, "does not exist")
+}
+
+// isQuotaError matches errors such as:
+// "googleapi: Error 403: Insufficient quota to satisfy the request: ..."
+// "Quota 'TPU_V5_LITE_PODSLICE' exceeded. Limit: 16.0 in region ..."
+func isQuotaError(err error) bool {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		for _, e := range gerr.Errors {
+			if e.Reason == "quotaExceeded" {
+				return true
+			}
+		}
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "quota") &&
+		(strings.Contains(msg, "exceeded") || strings.Contains(msg, "insufficient"))
+}
+
+func isReservationError(err error, np *containerv1beta1.NodePool) bool {
+	if np.Config == nil || np.Config.ReservationAffinity == nil ||
+		np.Config.ReservationAffinity.ConsumeReservationType != "SPECIFIC_RESERVATION" {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	if !strings.Contains(msg, "reservation") {
+		return false
+	}
+	for _, s := range []string{"not found", "does not exist", "insufficient", "not enough", "no available"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,263 @@
+package cloud
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	"google.golang.org/api/googleapi"
+)
+
+func Test_classifyCreateError(t *testing.T) {
+	specificReservation := &containerv1beta1.NodePool{
+		Config: &containerv1beta1.NodeConfig{
+			ReservationAffinity: &containerv1beta1.ReservationAffinity{
+				ConsumeReservationType: "SPECIFIC_RESERVATION",
+			},
+		},
+	}
+	noReservation := &containerv1beta1.NodePool{Config: &containerv1beta1.NodeConfig{}}
+
+	cases := []struct {
+		name   string
+		err    error
+		np     *containerv1beta1.NodePool
+		target error
+	}{
+		{
+			name: "reservation not found",
+			err: &googleapi.Error{
+				Code:    http.StatusBadRequest,
+				Message: "Reservation projects/my-project/zones/us-central2-b/reservations/my-res not found.",
+			},
+			np:     specificReservation,
+			target: ErrReservationUnavailable,
+		},
+		{
+			name:   "unsupported node version",
+			err:    errors.New("operation operation-123 failed: Node version 1.25.16-gke.1000 is not supported."),
+			np:     &containerv1beta1.NodePool{Version: "1.25.16-gke.1000", Config: &containerv1beta1.NodeConfig{}},
+			target: ErrIncompatibleNodeVersion,
+		},
+		{
+			name: "service account not usable",
+			err: &googleapi.Error{
+				Code:    http.StatusBadRequest,
+				Message: `The user does not have access to service account "training@my-project.iam.gserviceaccount.com". Ask a project owner to grant you the iam.serviceAccountUser role on the service account.`,
+			},
+			np:     &containerv1beta1.NodePool{Config: &containerv1beta1.NodeConfig{ServiceAccount: "training@my-project.iam.gserviceaccount.com"}},
+			target: ErrServiceAccountPermission,
+		},
+		{
+			name:   "reservation lacks capacity",
+			err:    errors.New("operation operation-123 failed: Insufficient capacity in reservation my-res."),
+			np:     specificReservation,
+			target: ErrReservationUnavailable,
+		},
+		{
+			name: "insufficient quota",
+			err: &googleapi.Error{
+				Code:    http.StatusForbidden,
+				Message: "Insufficient quota to satisfy the request: Not all instances running in IGM after 1m.",
+			},
+			np:     noReservation,
+			target: ErrQuotaExceeded,
+		},
+		{
+			name:   "quota exceeded in operation",
+			err:    errors.New("operation operation-123 failed: Quota 'TPU_V5_LITE_PODSLICE' exceeded. Limit: 16.0 in region us-west4."),
+			np:     noReservation,
+			target: ErrQuotaExceeded,
+		},
+		{
+			name: "quota exceeded reason",
+			err: &googleapi.Error{
+				Code:   http.StatusForbidden,
+				Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}},
+			},
+			np:     noReservation,
+			target: ErrQuotaExceeded,
+		},
+		{
+			name:   "zone stockout",
+			err:    errors.New("operation operation-123 failed: GCE_STOCKOUT: The zone 'projects/my-project/zones/us-central2-b' does not have enough resources available to fulfill the request."),
+			np:     noReservation,
+			target: ErrZoneStockout,
+		},
+		{
+			name:   "zone resource pool exhausted",
+			err:    errors.New("operation operation-123 failed: ZONE_RESOURCE_POOL_EXHAUSTED_WITH_DETAILS: Instance 'gke-tpu-0' creation failed: The zone 'projects/my-project/zones/us-central2-b' does not have enough resources available to fulfill the request. '(resource type:compute)'."),
+			np:     noReservation,
+			target: ErrZoneStockout,
+		},
+		{
+			name: "resource exhausted capacity",
+			err: &googleapi.Error{
+				Code:    http.StatusTooManyRequests,
+				Message: `There is no more capacity in the zone "us-central2-b"; you can try in another zone where Cloud TPU Nodes are offered.`,
+				Errors:  []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}},
+			},
+			np:     noReservation,
+			target: ErrZoneStockout,
+		},
+		{
+			name: "resource exhausted quota",
+			err: &googleapi.Error{
+				Code:    http.StatusTooManyRequests,
+				Message: "Quota exceeded for quota metric 'TPUV5sLitepodPerProjectPerZoneForTPUAPI' and limit 'per zone' of service 'tpu.googleapis.com'.",
+				Errors:  []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}},
+			},
+			np:     noReservation,
+			target: ErrQuotaExceeded,
+		},
+		{
+			name: "incompatible operation",
+			err: fmt.Errorf("do: %w", &googleapi.Error{
+				Code:    http.StatusBadRequest,
+				Message: "Cluster is running incompatible operation operation-1700000000000-0123abcd.",
+				Errors:  []googleapi.ErrorItem{{Reason: "failedPrecondition"}},
+			}),
+			np:     noReservation,
+			target: ErrOperationInProgress,
+		},
+		{
+			name:   "cluster upgrade in progress",
+			err:    errors.New("operation operation-1700000000001-4567ef01 failed: Operation operation-1700000000000-0123abcd is currently upgrading cluster my-cluster. Please wait and try again once it is done."),
+			np:     noReservation,
+			target: ErrOperationInProgress,
+		},
+		{
+			name:   "auto-upgrade required by release channel",
+			err:    errors.New("googleapi: Error 400: Auto_upgrade must be true when release_channel REGULAR is set."),
+			np:     &containerv1beta1.NodePool{Management: &containerv1beta1.NodeManagement{AutoRepair: true}},
+			target: ErrNodeManagementConflict,
+		},
+		{
+			name: "placement policy not found",
+			err: &googleapi.Error{
+				Code:    http.StatusBadRequest,
+				Message: "Resource policy projects/my-project/regions/us-central2/resourcePolicies/my-policy was not found.",
+			},
+			np:     &containerv1beta1.NodePool{PlacementPolicy: &containerv1beta1.PlacementPolicy{PolicyName: "my-policy"}},
+			target: ErrPlacementPolicyNotFound,
+		},
+		{
+			name: "unrelated error",
+			err: &googleapi.Error{
+				Code:    http.StatusBadRequest,
+				Message: "Invalid machine type.",
+			},
+			np: specificReservation,
+		},
+		{
+			name: "cluster not found",
+			err: &googleapi.Error{
+				Code:    http.StatusNotFound,
+				Message: "Not found: projects/my-project/locations/us-central2/clusters/my-cluster.",
+			},
+			np:     noReservation,
+			target: ErrClusterNotFound,
+		},
+		{
+			name: "project not found",
+			err: &googleapi.Error{
+				Code:    http.StatusNotFound,
+				Message: "Requested project not found or user does not have access to it.",
+			},
+			np:     noReservation,
+			target: ErrClusterNotFound,
+		},
+		{
+			name: "node pool not found",
+			err: &googleapi.Error{
+				Code:    http.StatusNotFound,
+				Message: "Not found: projects/my-project/locations/us-central2/clusters/my-cluster/nodePools/np.",
+			},
+			np: noReservation,
+		},
+		{
+			name: "no reservation requested",
+			err:  errors.New("reservation not found"),
+			np:   noReservation,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := classifyCreateError(c.err, c.np)
+			if c.target != nil && !errors.Is(err, c.target) {
+				t.Fatalf("expected error to wrap %v, got: %v", c.target, err)
+			}
+			if c.target == nil && err != c.err {
+				t.Fatalf("expected error to be unchanged, got: %v", err)
+			}
+		})
+	}
+}
+
+func Test_classifyCreateError_conflictingOperation(t *testing.T) {
+	cases := []struct {
+		err error
+		exp string
+	}{
+		{
+			err: &googleapi.Error{Code: http.StatusBadRequest, Message: "Cluster is running incompatible operation operation-1700000000000-0123abcd."},
+			exp: "operation-1700000000000-0123abcd",
+		},
+		{
+			err: errors.New("operation operation-1700000000001-4567ef01 failed: Operation operation-1700000000000-0123abcd is currently upgrading cluster my-cluster. Please wait and try again once it is done."),
+			exp: "operation-1700000000000-0123abcd",
+		},
+		{
+			err: errors.New("googleapi: Error 400: Another operation is in progress on the cluster, failedPrecondition"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.err.Error(), func(t *testing.T) {
+			var inProgress *OperationInProgressError
+			if !errors.As(classifyCreateError(c.err, &containerv1beta1.NodePool{}), &inProgress) {
+				t.Fatalf("expected an OperationInProgressError")
+			}
+			if inProgress.Operation != c.exp {
+				t.Fatalf("expected operation %q, got: %q", c.exp, inProgress.Operation)
+			}
+			if !errors.Is(inProgress, c.err) {
+				t.Fatalf("expected the GKE error to be wrapped")
+			}
+		})
+	}
+}
+
+func TestErrorCategory(t *testing.T) {
+	cases := []struct {
+		err      error
+		category string
+	}{
+		{err: &googleapi.Error{Code: http.StatusTooManyRequests}, category: ErrorCategoryQuota},
+		{err: &googleapi.Error{Code: http.StatusForbidden}, category: ErrorCategoryPermission},
+		{err: &googleapi.Error{Code: http.StatusNotFound}, category: ErrorCategoryNotFound},
+		{err: fmt.Errorf("%w: not found", ErrReservationUnavailable), category: ErrorCategoryReservation},
+		{err: errors.New("Quota 'TPUS' exceeded"), category: ErrorCategoryQuota},
+		{err: fmt.Errorf("%w: GCE_STOCKOUT", ErrZoneStockout), category: ErrorCategoryStockout},
+		{err: &googleapi.Error{Code: http.StatusTooManyRequests, Message: "There is no more capacity in the zone"}, category: ErrorCategoryStockout},
+		{err: fmt.Errorf("%w: 10 of 10 node pools in use", ErrNodePoolLimitReached), category: ErrorCategoryLimit},
+		{err: &OperationInProgressError{Err: errors.New("incompatible operation")}, category: ErrorCategoryInProgress},
+		{err: fmt.Errorf("%w: not found", ErrClusterNotFound), category: ErrorCategoryMisconfigured},
+		{err: fmt.Errorf("%w: golden", ErrTemplateNotFound), category: ErrorCategoryMisconfigured},
+		{err: &ProjectPermissionError{Role: ProjectRoleNetwork, Project: "host", Err: errors.New("forbidden")}, category: ErrorCategoryNetworkPermission},
+		{err: &ProjectPermissionError{Role: ProjectRoleReservation, Project: "shared", Err: errors.New("forbidden")}, category: ErrorCategoryReservationPermission},
+		{err: fmt.Errorf("%w: connection reset by peer", ErrTransient), category: ErrorCategoryTransient},
+		{err: errors.New("boom"), category: ErrorCategoryOther},
+	}
+
+	for _, c := range cases {
+		t.Run(c.err.Error(), func(t *testing.T) {
+			if exp, got := c.category, ErrorCategory(c.err); exp != got {
+				t.Fatalf("expected: %v, got: %v", exp, got)
+			}
+		})
+	}
+}
@@ -1,11 +1,22 @@
 package cloud
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 )
 
-func Test_tpuTopologyToNodeCount(t *testing.T) {
+func TestTPUTopologyToNodeCount(t *testing.T) {
 	cases := []struct {
 		accel string
 		topo  string
@@ -61,7 +72,7 @@ func Test_tpuTopologyToNodeCount(t *testing.T) {
 
 	for _, c := range cases {
 		t.Run(c.accel+"_"+c.topo, func(t *testing.T) {
-			count, err := tpuTopologyToNodeCount(c.accel, c.topo)
+			count, err := TPUTopologyToNodeCount(c.accel, c.topo)
 			if (err != nil) != c.err {
 				t.Fatalf("error: expected: %v", c.err)
 			}
@@ -128,3 +139,586 @@ func Test_tpuMachineType(t *testing.T) {
 		})
 	}
 }
+
+func Test_sumResourceRequests(t *testing.T) {
+	container := func(requests, limits string) corev1.Container {
+		var c corev1.Container
+		if requests != "" {
+			c.Resources.Requests = corev1.ResourceList{GoogleTPUResource: resource.MustParse(requests)}
+		}
+		if limits != "" {
+			c.Resources.Limits = corev1.ResourceList{GoogleTPUResource: resource.MustParse(limits)}
+		}
+		return c
+	}
+
+	cases := []struct {
+		name           string
+		containers     []corev1.Container
+		initContainers []corev1.Container
+		overhead       corev1.ResourceList
+		resources      []string
+		exp            int
+		err            bool
+	}{
+		{name: "requests", containers: []corev1.Container{container("2", "2"), container("2", "2")}, exp: 4},
+		{name: "limit only", containers: []corev1.Container{container("", "4")}, exp: 4},
+		{name: "request without limit", containers: []corev1.Container{container("4", "")}, exp: 4},
+		{name: "request and zero limit", containers: []corev1.Container{container("4", "0")}, exp: 4},
+		{name: "smaller init container", containers: []corev1.Container{container("4", "")}, initContainers: []corev1.Container{container("1", "")}, exp: 4},
+		{name: "larger init container", containers: []corev1.Container{container("1", ""), container("1", "")}, initContainers: []corev1.Container{container("", "4")}, exp: 4},
+		{name: "overhead", containers: []corev1.Container{container("3", "")}, overhead: corev1.ResourceList{GoogleTPUResource: resource.MustParse("1")}, exp: 4},
+		{
+			name: "alternative resources",
+			containers: []corev1.Container{container("2", ""), {Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{"example.com/tpu": resource.MustParse("2")},
+			}}},
+			resources: []string{GoogleTPUResource, "example.com/tpu"},
+			exp:       4,
+		},
+		{name: "no request", containers: []corev1.Container{{}}},
+		{name: "fractional", containers: []corev1.Container{container("", "500m")}, err: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := &corev1.Pod{}
+			p.Spec.Containers = c.containers
+			p.Spec.InitContainers = c.initContainers
+			p.Spec.Overhead = c.overhead
+			resources := c.resources
+			if resources == nil {
+				resources = []string{GoogleTPUResource}
+			}
+			n, err := sumResourceRequests(p, resources...)
+			if (err != nil) != c.err {
+				t.Fatalf("error: expected: %v, got: %v", c.err, err)
+			}
+			if n != c.exp {
+				t.Fatalf("expected: %v, got: %v", c.exp, n)
+			}
+		})
+	}
+}
+
+func Test_gpuMachineType(t *testing.T) {
+	cases := []struct {
+		accel       string
+		gpuLimit    int
+		machineType string
+		err         bool
+	}{
+		{
+			accel:       "nvidia-l4",
+			gpuLimit:    1,
+			machineType: "g2-standard-4",
+		},
+		{
+			accel:       "nvidia-tesla-a100",
+			gpuLimit:    16,
+			machineType: "a2-megagpu-16g",
+		},
+		{
+			accel:       "nvidia-h100-80gb",
+			gpuLimit:    8,
+			machineType: "a3-highgpu-8g",
+		},
+		{
+			accel:    "nvidia-h100-80gb",
+			gpuLimit: 3,
+			err:      true,
+		},
+		{
+			accel:    "not-an-accel",
+			gpuLimit: 1,
+			err:      true,
+		},
+		{
+			accel:    "nvidia-l4",
+			gpuLimit: 0,
+			err:      true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%v_accel_%v_gpus", c.accel, c.gpuLimit), func(t *testing.T) {
+			machineType, err := gpuMachineType(c.accel, c.gpuLimit)
+			if (err != nil) != c.err {
+				t.Fatalf("error: expected: %v", c.err)
+			}
+			if exp, got := c.machineType, machineType; exp != got {
+				t.Fatalf("machineType: expected: %v, got: %v", exp, got)
+			}
+		})
+	}
+}
+
+func Test_sanitizeGCPLabel(t *testing.T) {
+	cases := []struct {
+		key, value       string
+		expKey, expValue string
+		ok               bool
+	}{
+		{
+			key: "team", value: "ml-research",
+			expKey: "team", expValue: "ml-research",
+			ok: true,
+		},
+		{
+			key: "cost-center", value: "CC.1234",
+			expKey: "cost-center", expValue: "cc_1234",
+			ok: true,
+		},
+		{
+			key: "app.kubernetes.io/name", value: "trainer",
+			expKey: "app_kubernetes_io_name", expValue: "trainer",
+			ok: true,
+		},
+		{
+			key: "1team", value: "a",
+		},
+		{
+			key: "team", value: strings.Repeat("a", 64),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.key, func(t *testing.T) {
+			key, value, ok := sanitizeGCPLabel(c.key, c.value)
+			if ok != c.ok {
+				t.Fatalf("ok: expected: %v, got: %v", c.ok, ok)
+			}
+			if key != c.expKey || value != c.expValue {
+				t.Fatalf("expected: %v=%v, got: %v=%v", c.expKey, c.expValue, key, value)
+			}
+		})
+	}
+}
+
+func TestGKE_planNodePool(t *testing.T) {
+	rec := record.NewFakeRecorder(10)
+	g := &GKE{Recorder: rec, DryRun: true}
+	p := &corev1.Pod{}
+	np := &containerv1beta1.NodePool{Name: "tpu-provisioner-0123456789ab", InitialNodeCount: 4}
+
+	for i := 0; i < 2; i++ {
+		if err := g.planNodePool(p, np); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if exp, got := 1, len(rec.Events); exp != got {
+		t.Fatalf("events: expected: %v, got: %v", exp, got)
+	}
+
+	// Deleting a planned node pool allows it to be planned again.
+	if err := g.DeleteNodePool(np.Name); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := g.planNodePool(p, np); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exp, got := 2, len(rec.Events); exp != got {
+		t.Fatalf("events: expected: %v, got: %v", exp, got)
+	}
+}
+
+func TestGKE_placementPolicyForPod(t *testing.T) {
+	g := &GKE{ClusterContext: GKEContext{
+		NodePlacementPolicy: "default-policy",
+		NodePlacementPolicies: map[string]string{
+			V5pPodSliceAccelerator: "v5p-policy",
+			V4PodSliceAccelerator:  NoPlacementPolicy,
+		},
+	}}
+
+	cases := []struct {
+		name        string
+		accel       string
+		annotations map[string]string
+		exp         string
+	}{
+		{name: "global default", accel: V5ePodSliceAccelerator, exp: "default-policy"},
+		{name: "per accelerator", accel: V5pPodSliceAccelerator, exp: "v5p-policy"},
+		{name: "per accelerator none", accel: V4PodSliceAccelerator, exp: ""},
+		{
+			name:        "annotation",
+			accel:       V5pPodSliceAccelerator,
+			annotations: map[string]string{AnnotationPlacementPolicy: "my-policy"},
+			exp:         "my-policy",
+		},
+		{
+			name:        "annotation none",
+			accel:       V5pPodSliceAccelerator,
+			annotations: map[string]string{AnnotationPlacementPolicy: NoPlacementPolicy},
+			exp:         "",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := &corev1.Pod{}
+			p.Annotations = c.annotations
+			if got := g.placementPolicyForPod(p, c.accel); got != c.exp {
+				t.Fatalf("expected: %q, got: %q", c.exp, got)
+			}
+		})
+	}
+}
+
+func Test_sanitizeLabelValue(t *testing.T) {
+	cases := []struct {
+		in, out string
+	}{
+		{in: "train-0", out: "train-0"},
+		{in: "my.pod", out: "my.pod"},
+		{in: "a/b c", out: "a-b-c"},
+		{in: "-pod-", out: "pod"},
+		{in: strings.Repeat("a", 62) + "-b", out: strings.Repeat("a", 62)},
+		{in: "", out: ""},
+	}
+	for _, c := range cases {
+		t.Run(c.in, func(t *testing.T) {
+			if got := sanitizeLabelValue(c.in); got != c.out {
+				t.Fatalf("expected: %q, got: %q", c.out, got)
+			}
+		})
+	}
+}
+
+func TestGKE_nodePoolForPod_workloadLabels(t *testing.T) {
+	isController := true
+	g := &GKE{ClusterContext: GKEContext{NodeZone: "us-central2-b"}}
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "trainer-slice-0-0-abcde",
+			Namespace: "default",
+			Labels:    map[string]string{JobSetNameLabel: "Trainer"},
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Job", Name: "trainer-slice-0", UID: "0123456789abcdef", Controller: &isController},
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{
+				GKETPUNodeSelector:         "2x2x1",
+				GKEAcceleratorNodeSelector: V4PodSliceAccelerator,
+			},
+			Containers: []corev1.Container{{
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{GoogleTPUResource: resource.MustParse("4")},
+				},
+			}},
+		},
+	}
+
+	np, err := g.nodePoolForPod("np", p, NodePoolRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	labels, resourceLabels := np.Config.Labels, np.Config.ResourceLabels
+	if exp, got := "trainer-slice-0-0-abcde", labels[LabelTriggerPod]; exp != got {
+		t.Fatalf("trigger pod label: expected: %v, got: %v", exp, got)
+	}
+	if exp, got := "Trainer", labels[LabelJobSetName]; exp != got {
+		t.Fatalf("jobset label: expected: %v, got: %v", exp, got)
+	}
+	if exp, got := "trainer", resourceLabels[ResourceLabelJobSetName]; exp != got {
+		t.Fatalf("jobset resource label: expected: %v, got: %v", exp, got)
+	}
+	if exp, got := "default", resourceLabels[ResourceLabelParentNamespace]; exp != got {
+		t.Fatalf("namespace resource label: expected: %v, got: %v", exp, got)
+	}
+	for k := range resourceLabels {
+		if strings.Contains(k, "pod") {
+			t.Fatalf("unexpected pod resource label %q", k)
+		}
+	}
+
+	delete(p.Labels, JobSetNameLabel)
+	np, err = g.nodePoolForPod("np", p, NodePoolRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := np.Config.Labels[LabelJobSetName]; ok {
+		t.Fatalf("unexpected jobset label without jobset")
+	}
+	if _, ok := np.Config.ResourceLabels[ResourceLabelJobSetName]; ok {
+		t.Fatalf("unexpected jobset resource label without jobset")
+	}
+}
+
+func TestGKE_nodePoolForPod_gpuResource(t *testing.T) {
+	isController := true
+	pod := func(resourceName corev1.ResourceName) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "inference-0",
+				Namespace: "default",
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "Job", Name: "inference", UID: "0123456789abcdef", Controller: &isController},
+				},
+			},
+			Spec: corev1.PodSpec{
+				NodeSelector: map[string]string{GKEGPUNodeSelector: "nvidia-l4"},
+				Containers: []corev1.Container{{
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{resourceName: resource.MustParse("2")},
+					},
+				}},
+			},
+		}
+	}
+
+	cases := []struct {
+		name     string
+		ctx      GKEContext
+		resource corev1.ResourceName
+		exp      int64
+		err      bool
+	}{
+		{name: "default resource", resource: NvidiaGPUResource, exp: 2},
+		{name: "configured resource", ctx: GKEContext{GPUResource: "example.com/gpu"}, resource: "example.com/gpu", exp: 2},
+		{name: "default resource not counted", ctx: GKEContext{GPUResource: "example.com/gpu"}, resource: NvidiaGPUResource, err: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.ctx.NodeZone = "us-central1-a"
+			g := &GKE{ClusterContext: c.ctx}
+			np, err := g.nodePoolForPod("np", pod(c.resource), NodePoolRequest{})
+			if c.err {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if exp, got := c.exp, np.Config.Accelerators[0].AcceleratorCount; exp != got {
+				t.Fatalf("accelerator count: expected: %v, got: %v", exp, got)
+			}
+		})
+	}
+}
+
+func TestGKE_waitForRateLimit(t *testing.T) {
+	t.Run("no limiter", func(t *testing.T) {
+		g := &GKE{}
+		if err := g.waitForRateLimit(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("limit hit", func(t *testing.T) {
+		g := &GKE{RateLimiter: rate.NewLimiter(rate.Every(time.Hour), 1)}
+		if err := g.waitForRateLimit(context.Background()); err != nil {
+			t.Fatalf("first call: unexpected error: %v", err)
+		}
+		err := g.waitForRateLimit(context.Background())
+		var rateLimited *RateLimitedError
+		if !errors.As(err, &rateLimited) {
+			t.Fatalf("expected a RateLimitedError, got: %v", err)
+		}
+		if rateLimited.RetryAfter <= 59*time.Minute || rateLimited.RetryAfter > time.Hour {
+			t.Fatalf("retry after: expected about 1h, got: %v", rateLimited.RetryAfter)
+		}
+		// The cancelled reservation does not push back later calls.
+		if err := g.waitForRateLimit(context.Background()); !errors.As(err, &rateLimited) || rateLimited.RetryAfter > time.Hour {
+			t.Fatalf("expected a RateLimitedError within 1h, got: %v", err)
+		}
+	})
+
+	t.Run("limit hit by a call", func(t *testing.T) {
+		g := &GKE{RateLimiter: rate.NewLimiter(rate.Every(time.Hour), 1)}
+		g.RateLimiter.Allow()
+		var rateLimited *RateLimitedError
+		if err := g.DeleteNodePool("np"); !errors.As(err, &rateLimited) {
+			t.Fatalf("expected a RateLimitedError, got: %v", err)
+		}
+	})
+
+	t.Run("waits within max wait", func(t *testing.T) {
+		g := &GKE{RateLimiter: rate.NewLimiter(rate.Every(50*time.Millisecond), 1), RateLimitMaxWait: time.Minute}
+		g.RateLimiter.Allow()
+		start := time.Now()
+		if err := g.waitForRateLimit(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 25*time.Millisecond {
+			t.Fatalf("expected the call to wait for the limiter, took %v", elapsed)
+		}
+	})
+
+	t.Run("context cancelled while waiting", func(t *testing.T) {
+		g := &GKE{RateLimiter: rate.NewLimiter(rate.Every(time.Minute), 1), RateLimitMaxWait: time.Hour}
+		g.RateLimiter.Allow()
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if err := g.waitForRateLimit(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected %v, got: %v", context.DeadlineExceeded, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("expected the wait to be given up, took %v", elapsed)
+		}
+	})
+}
+
+func TestGKE_podRequestsSpot(t *testing.T) {
+	cases := []struct {
+		name         string
+		annotations  map[string]string
+		nodeSelector map[string]string
+		clusterSpot  bool
+		exp          bool
+		expErr       bool
+	}{
+		{name: "default"},
+		{name: "cluster default", clusterSpot: true, exp: true},
+		{name: "node selector", nodeSelector: map[string]string{GKESpotNodeSelector: "true"}, exp: true},
+		{name: "node selector over cluster default", nodeSelector: map[string]string{GKESpotNodeSelector: "false"}, clusterSpot: true},
+		{name: "annotation", annotations: map[string]string{AnnotationSpot: "true"}, exp: true},
+		{
+			name:         "annotation over node selector",
+			annotations:  map[string]string{AnnotationSpot: "false"},
+			nodeSelector: map[string]string{GKESpotNodeSelector: "true"},
+			clusterSpot:  true,
+		},
+		{
+			name:         "annotation over node selector and cluster default",
+			annotations:  map[string]string{AnnotationSpot: "true"},
+			nodeSelector: map[string]string{GKESpotNodeSelector: "false"},
+			exp:          true,
+		},
+		{name: "invalid annotation", annotations: map[string]string{AnnotationSpot: "maybe"}, expErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := &GKE{ClusterContext: GKEContext{NodeSpot: c.clusterSpot}}
+			p := &corev1.Pod{}
+			p.Annotations = c.annotations
+			p.Spec.NodeSelector = c.nodeSelector
+			got, err := g.podRequestsSpot(p)
+			if (err != nil) != c.expErr {
+				t.Fatalf("expected error: %v, got: %v", c.expErr, err)
+			}
+			if got != c.exp {
+				t.Fatalf("expected: %v, got: %v", c.exp, got)
+			}
+		})
+	}
+}
+
+func TestGKE_NodePoolTaintsForPod_spot(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		clusterSpot bool
+		exp         bool
+	}{
+		{name: "on-demand"},
+		{name: "spot annotation", annotations: map[string]string{AnnotationSpot: "true"}, exp: true},
+		{name: "spot cluster default", clusterSpot: true, exp: true},
+		{name: "on-demand annotation over cluster default", annotations: map[string]string{AnnotationSpot: "false"}, clusterSpot: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := &GKE{ClusterContext: GKEContext{NodeSpot: c.clusterSpot}}
+			p := &corev1.Pod{}
+			p.Annotations = c.annotations
+			p.Spec.NodeSelector = map[string]string{GKETPUNodeSelector: "2x2x1", GKEAcceleratorNodeSelector: V4PodSliceAccelerator}
+			taints, err := g.NodePoolTaintsForPod(p)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := false
+			for _, taint := range taints {
+				if taint == SpotTaint {
+					got = true
+				}
+			}
+			if got != c.exp {
+				t.Fatalf("spot taint: expected: %v, got: %v", c.exp, taints)
+			}
+		})
+	}
+}
+
+func TestGKE_nodePoolForPod_spotReservation(t *testing.T) {
+	isController := true
+	pod := func(annotations, nodeSelector map[string]string) *corev1.Pod {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "train-0",
+				Namespace:   "default",
+				Annotations: annotations,
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "Job", Name: "train", UID: "0123456789abcdef", Controller: &isController},
+				},
+			},
+			Spec: corev1.PodSpec{
+				NodeSelector: map[string]string{
+					GKETPUNodeSelector:         "2x2x1",
+					GKEAcceleratorNodeSelector: V4PodSliceAccelerator,
+				},
+				Containers: []corev1.Container{{
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{GoogleTPUResource: resource.MustParse("4")},
+					},
+				}},
+			},
+		}
+		for k, v := range nodeSelector {
+			p.Spec.NodeSelector[k] = v
+		}
+		return p
+	}
+	cases := []struct {
+		name               string
+		pod                *corev1.Pod
+		clusterReservation string
+		expSpot            bool
+		expErr             bool
+	}{
+		{name: "spot", pod: pod(map[string]string{AnnotationSpot: "true"}, nil), expSpot: true},
+		{name: "reservation", pod: pod(map[string]string{AnnotationReservation: "my-reservation"}, nil)},
+		{
+			name:   "spot and reservation annotations",
+			pod:    pod(map[string]string{AnnotationSpot: "true", AnnotationReservation: "my-reservation"}, nil),
+			expErr: true,
+		},
+		{
+			name:   "spot and reservation node selectors",
+			pod:    pod(nil, map[string]string{GKESpotNodeSelector: "true", GKEReservationNodeSelector: "my-reservation"}),
+			expErr: true,
+		},
+		{
+			name:               "spot with the cluster reservation",
+			pod:                pod(map[string]string{AnnotationSpot: "true"}, nil),
+			clusterReservation: "my-reservation",
+			expErr:             true,
+		},
+		{
+			name:               "spot opting out of the cluster reservation",
+			pod:                pod(map[string]string{AnnotationSpot: "true", AnnotationReservation: NoReservation}, nil),
+			clusterReservation: "my-reservation",
+			expSpot:            true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := &GKE{ClusterContext: GKEContext{ProjectID: "my-project", NodeZone: "us-central2-b", NodeReservation: c.clusterReservation}}
+			np, err := g.nodePoolForPod("np", c.pod, NodePoolRequest{})
+			if c.expErr {
+				if err == nil || !strings.Contains(err.Error(), "spot and reservation") {
+					t.Fatalf("expected the spot and reservation error, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if np.Config.Spot != c.expSpot {
+				t.Fatalf("spot: expected: %v, got: %v", c.expSpot, np.Config.Spot)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package cloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Create hook names, the Hook of a CreateHookRequest.
+const (
+	CreateHookPreCreate  = "preCreate"
+	CreateHookPostCreate = "postCreate"
+)
+
+const (
+	// DefaultCreateHookTimeout is the timeout of a create hook call unless
+	// CreateHooks.Timeout is set, MaxCreateHookTimeout the longest one
+	// allowed so that a slow hook cannot wedge reconciles.
+	DefaultCreateHookTimeout = 5 * time.Second
+	MaxCreateHookTimeout     = 30 * time.Second
+
+	// maxCreateHookResponseSize is the maximum size of a response body that
+	// is read.
+	maxCreateHookResponseSize = 1 << 20
+)
+
+// CreateHookRequest is the JSON body that CreateHooks post.
+type CreateHookRequest struct {
+	// Hook is CreateHookPreCreate or CreateHookPostCreate.
+	Hook string `json:"hook"`
+	// PodNamespace and PodName identify the Pod that the node pool is
+	// created for. They are omitted for the post-create hook of node pools
+	// created with asynchronous operations.
+	PodNamespace string `json:"podNamespace,omitempty"`
+	PodName      string `json:"podName,omitempty"`
+	// NodePool is the node pool to be created (pre-create) or that was
+	// created (post-create), as in the GKE API.
+	NodePool *containerv1beta1.NodePool `json:"nodePool"`
+}
+
+// CreateHookResponse is the JSON body that the pre-create hook answers with.
+// The response of the post-create hook is ignored.
+type CreateHookResponse struct {
+	// Allowed must be true for the node pool to be created. Reason explains
+	// a rejection, it is recorded on the Pod.
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+	// NodePool, if set, replaces the node pool to be created, see
+	// CreateHooks.
+	NodePool *containerv1beta1.NodePool `json:"nodePool,omitempty"`
+}
+
+// CreateHooks call external HTTP webhooks before and after node pools are
+// created. The pre-create hook can reject the node pool, which fails with
+// ErrCreateHookRejected, or replace it: the name and the node labels and
+// resource labels set by the provisioner cannot be changed, other labels
+// are added. If a hook call fails (an error, a timeout or a non-2xx status)
+// node pools are created anyway with FailOpen, otherwise ensuring them fails
+// with ErrCreateHookFailed and is retried. Post-create hook failures are only
+// logged, the node pool exists by then.
+type CreateHooks struct {
+	// PreCreateURL and PostCreateURL are the http or https URLs of the
+	// hooks, either can be empty.
+	PreCreateURL  string
+	PostCreateURL string
+	// AuthHeader, if set, is sent as the Authorization header. It is never
+	// logged.
+	AuthHeader string
+	// Timeout bounds each hook call, DefaultCreateHookTimeout if it is not
+	// set.
+	Timeout  time.Duration
+	FailOpen bool
+
+	// Client is used to call the hooks, it defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// Validate returns an error unless the URLs are absolute http or https URLs
+// and the timeout is at most MaxCreateHookTimeout. The error does not
+// contain the URLs, which may contain credentials.
+func (h *CreateHooks) Validate() error {
+	for name, u := range map[string]string{CreateHookPreCreate: h.PreCreateURL, CreateHookPostCreate: h.PostCreateURL} {
+		if u == "" {
+			continue
+		}
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("%s hook URL must be an absolute http or https URL", name)
+		}
+	}
+	if h.Timeout < 0 || h.Timeout > MaxCreateHookTimeout {
+		return fmt.Errorf("create hook timeout %v must be between 0 and %v", h.Timeout, MaxCreateHookTimeout)
+	}
+	return nil
+}
+
+// preCreate calls the pre-create hook for the node pool to be created for the
+// Pod and returns the node pool to create: np, or the one of the response.
+func (h *CreateHooks) preCreate(p *corev1.Pod, np *containerv1beta1.NodePool) (*containerv1beta1.NodePool, error) {
+	if h == nil || h.PreCreateURL == "" {
+		return np, nil
+	}
+	var resp CreateHookResponse
+	err := h.call(h.PreCreateURL, createHookRequest(CreateHookPreCreate, p, np), &resp)
+	if err == nil {
+		err = validateCreateHookNodePool(np, resp.NodePool)
+	}
+	if err != nil {
+		if h.FailOpen {
+			log.Error(err, "pre-create hook failed, creating node pool anyway", "name", np.Name)
+			return np, nil
+		}
+		return nil, fmt.Errorf("%w: %v", ErrCreateHookFailed, err)
+	}
+	if !resp.Allowed {
+		reason := resp.Reason
+		if reason == "" {
+			reason = "no reason given"
+		}
+		return nil, fmt.Errorf("%w: %s", ErrCreateHookRejected, reason)
+	}
+	if resp.NodePool == nil {
+		return np, nil
+	}
+	out := resp.NodePool
+	out.Config.Labels = mergeLabels(out.Config.Labels, np.Config.Labels)
+	out.Config.ResourceLabels = mergeLabels(out.Config.ResourceLabels, np.Config.ResourceLabels)
+	log.Info("pre-create hook replaced node pool", "name", np.Name)
+	return out, nil
+}
+
+// postCreate calls the post-create hook for the node pool created for the
+// Pod, p is nil if it is not known. Failures are logged.
+func (h *CreateHooks) postCreate(p *corev1.Pod, np *containerv1beta1.NodePool) {
+	if h == nil || h.PostCreateURL == "" {
+		return
+	}
+	if err := h.call(h.PostCreateURL, createHookRequest(CreateHookPostCreate, p, np), nil); err != nil {
+		log.Error(err, "post-create hook failed", "name", np.Name)
+	}
+}
+
+func createHookRequest(hook string, p *corev1.Pod, np *containerv1beta1.NodePool) CreateHookRequest {
+	req := CreateHookRequest{Hook: hook, NodePool: np}
+	if p != nil {
+		req.PodNamespace, req.PodName = p.Namespace, p.Name
+	}
+	return req
+}
+
+// validateCreateHookNodePool returns an error if the node pool of a
+// pre-create hook response cannot replace np.
+func validateCreateHookNodePool(np, out *containerv1beta1.NodePool) error {
+	if out == nil {
+		return nil
+	}
+	if out.Name != np.Name {
+		return fmt.Errorf("response node pool name %q must be %q", out.Name, np.Name)
+	}
+	if out.Config == nil {
+		return errors.New("response node pool has no config")
+	}
+	return nil
+}
+
+// call posts the request to the URL and decodes the response into resp,
+// unless it is nil. Errors do not contain the URL.
+func (h *CreateHooks) call(u string, req CreateHookRequest, resp interface{}) error {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCreateHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("encoding %s hook request: %w", req.Hook, err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating %s hook request: invalid URL", req.Hook)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if h.AuthHeader != "" {
+		httpReq.Header.Set("Authorization", h.AuthHeader)
+	}
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return fmt.Errorf("calling %s hook: %v", req.Hook, err)
+	}
+	defer httpResp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(httpResp.Body, maxCreateHookResponseSize))
+	if err != nil {
+		return fmt.Errorf("reading %s hook response: %v", req.Hook, err)
+	}
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		return fmt.Errorf("%s hook responded with status %d", req.Hook, httpResp.StatusCode)
+	}
+	if resp == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, resp); err != nil {
+		return fmt.Errorf("decoding %s hook response: %v", req.Hook, err)
+	}
+	return nil
+}
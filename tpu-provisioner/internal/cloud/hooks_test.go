@@ -0,0 +1,125 @@
+package cloud
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestCreateHooks_Validate(t *testing.T) {
+	cases := []struct {
+		name  string
+		hooks CreateHooks
+		valid bool
+	}{
+		{name: "pre-create", hooks: CreateHooks{PreCreateURL: "https://hooks.example.com/pre"}, valid: true},
+		{name: "post-create", hooks: CreateHooks{PostCreateURL: "http://cmdb.svc/post", Timeout: 30 * time.Second}, valid: true},
+		{name: "relative URL", hooks: CreateHooks{PreCreateURL: "/pre"}},
+		{name: "other scheme", hooks: CreateHooks{PostCreateURL: "ftp://hooks.example.com"}},
+		{name: "timeout too long", hooks: CreateHooks{PreCreateURL: "https://hooks.example.com/pre", Timeout: time.Minute}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.hooks.Validate(); (err == nil) != c.valid {
+				t.Fatalf("expected valid: %v, got: %v", c.valid, err)
+			}
+		})
+	}
+}
+
+func TestCreateHooks_preCreate(t *testing.T) {
+	var (
+		got      CreateHookRequest
+		response string
+		status   int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("expected the auth header, got: %q", r.Header.Get("Authorization"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	defer srv.Close()
+
+	p := &corev1.Pod{}
+	p.Namespace, p.Name = "default", "job-0"
+	np := func() *containerv1beta1.NodePool {
+		return &containerv1beta1.NodePool{Name: "np", Config: &containerv1beta1.NodeConfig{
+			MachineType:    "ct5lp-hightpu-4t",
+			Labels:         map[string]string{LabelJobSetName: "job"},
+			ResourceLabels: map[string]string{ResourceLabelSpecHash: "abc"},
+		}}
+	}
+	hooks := &CreateHooks{PreCreateURL: srv.URL, AuthHeader: "Bearer secret"}
+
+	status, response = http.StatusOK, `{"allowed":true}`
+	out, err := hooks.preCreate(p, np())
+	if err != nil || out.Config.MachineType != "ct5lp-hightpu-4t" {
+		t.Fatalf("expected the node pool to be allowed, got: %+v, %v", out, err)
+	}
+	if got.Hook != CreateHookPreCreate || got.PodName != "job-0" || got.NodePool.Name != "np" {
+		t.Fatalf("unexpected request: %+v", got)
+	}
+
+	status, response = http.StatusOK, `{"allowed":false,"reason":"no IP range left"}`
+	if _, err := hooks.preCreate(p, np()); !errors.Is(err, ErrCreateHookRejected) {
+		t.Fatalf("expected %v, got: %v", ErrCreateHookRejected, err)
+	}
+
+	status, response = http.StatusOK, `{"allowed":true,"nodePool":{"name":"np","config":{"machineType":"ct5lp-hightpu-4t",`+
+		`"labels":{"team":"ml","`+LabelJobSetName+`":"other"},"resourceLabels":{"`+ResourceLabelSpecHash+`":"changed"}},`+
+		`"networkConfig":{"podRange":"allocated"}}}`
+	out, err = hooks.preCreate(p, np())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.NetworkConfig == nil || out.NetworkConfig.PodRange != "allocated" || out.Config.Labels["team"] != "ml" {
+		t.Fatalf("expected the returned node pool, got: %+v", out)
+	}
+	if out.Config.Labels[LabelJobSetName] != "job" || out.Config.ResourceLabels[ResourceLabelSpecHash] != "abc" {
+		t.Fatalf("expected the provisioner's labels to be kept, got: %v, %v", out.Config.Labels, out.Config.ResourceLabels)
+	}
+
+	status, response = http.StatusOK, `{"allowed":true,"nodePool":{"name":"other","config":{}}}`
+	if _, err := hooks.preCreate(p, np()); !errors.Is(err, ErrCreateHookFailed) {
+		t.Fatalf("expected %v for a renamed node pool, got: %v", ErrCreateHookFailed, err)
+	}
+
+	status, response = http.StatusInternalServerError, ``
+	if _, err := hooks.preCreate(p, np()); !errors.Is(err, ErrCreateHookFailed) || isTransientError(err) {
+		t.Fatalf("expected %v, got: %v", ErrCreateHookFailed, err)
+	}
+	hooks.FailOpen = true
+	if out, err := hooks.preCreate(p, np()); err != nil || out.Name != "np" {
+		t.Fatalf("expected the node pool to be created with fail-open, got: %+v, %v", out, err)
+	}
+}
+
+func TestCreateHooks_timeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	hooks := &CreateHooks{PreCreateURL: srv.URL, Timeout: 50 * time.Millisecond}
+	start := time.Now()
+	_, err := hooks.preCreate(&corev1.Pod{}, &containerv1beta1.NodePool{Name: "np", Config: &containerv1beta1.NodeConfig{}})
+	if !errors.Is(err, ErrCreateHookFailed) {
+		t.Fatalf("expected %v, got: %v", ErrCreateHookFailed, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the call to time out, took %v", elapsed)
+	}
+}
@@ -0,0 +1,104 @@
+package cloud
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// cpuPlatformAutomatic lets Compute Engine choose the CPU platform.
+const cpuPlatformAutomatic = "Automatic"
+
+// cpuPlatforms are the minimum CPU platforms that can be requested, see
+// https://cloud.google.com/compute/docs/instances/specify-min-cpu-platform.
+var cpuPlatforms = []string{
+	cpuPlatformAutomatic,
+	"Intel Haswell", "Intel Broadwell", "Intel Skylake", "Intel Cascade Lake",
+	"Intel Ice Lake", "Intel Sapphire Rapids", "Intel Emerald Rapids",
+	"AMD Rome", "AMD Milan", "AMD Genoa",
+}
+
+// Machine type prefixes that support Confidential GKE Nodes: AMD SEV on the
+// AMD series and Intel TDX on the Intel series.
+var (
+	confidentialAMDMachinePrefixes   = []string{"n2d-", "c2d-", "c3d-"}
+	confidentialIntelMachinePrefixes = []string{"c3-", "a3-highgpu-"}
+)
+
+// hostVM is the host VM configuration of a node pool.
+type hostVM struct {
+	MinCPUPlatform string
+	Confidential   bool
+}
+
+// ValidateHostVM returns ErrInvalidHostVMConfig if the minimum CPU platform
+// is unknown or, if machineType is set, the configuration is not supported by
+// the machine type: Confidential GKE Nodes are only available on some
+// machine series (not on TPU machine types) and require a CPU platform of
+// the same vendor.
+func ValidateHostVM(minCPUPlatform string, confidential bool, machineType string) error {
+	if minCPUPlatform != "" && !containsString(cpuPlatforms, minCPUPlatform) {
+		return fmt.Errorf("%w: unknown minimum CPU platform %q, must be one of %q", ErrInvalidHostVMConfig, minCPUPlatform, cpuPlatforms)
+	}
+	if !confidential || machineType == "" {
+		return nil
+	}
+	var vendor string
+	switch {
+	case hasAnyPrefix(machineType, confidentialAMDMachinePrefixes):
+		vendor = "AMD"
+	case hasAnyPrefix(machineType, confidentialIntelMachinePrefixes):
+		vendor = "Intel"
+	default:
+		return fmt.Errorf("%w: machine type %q does not support Confidential GKE Nodes", ErrInvalidHostVMConfig, machineType)
+	}
+	if minCPUPlatform != "" && minCPUPlatform != cpuPlatformAutomatic && !strings.HasPrefix(minCPUPlatform, vendor+" ") {
+		return fmt.Errorf("%w: Confidential GKE Nodes on machine type %q require an %s CPU platform, not %q", ErrInvalidHostVMConfig, machineType, vendor, minCPUPlatform)
+	}
+	return nil
+}
+
+// hostVMForPod returns the host VM configuration of the node pool for the
+// Pod. The AnnotationMinCPUPlatform and AnnotationConfidentialNodes
+// annotations take precedence over the accelerator defaults and then the
+// cluster defaults.
+func (g *GKE) hostVMForPod(p *corev1.Pod, machineType string) (hostVM, error) {
+	vm := hostVM{
+		MinCPUPlatform: g.ClusterContext.NodeMinCPUPlatform,
+		Confidential:   g.ClusterContext.NodeConfidential,
+	}
+	if d, ok := g.ClusterContext.acceleratorDefaultsForPod(p); ok {
+		if d.MinCPUPlatform != "" {
+			vm.MinCPUPlatform = d.MinCPUPlatform
+		}
+		if d.ConfidentialNodes != nil {
+			vm.Confidential = *d.ConfidentialNodes
+		}
+	}
+	if v, ok := p.Annotations[AnnotationMinCPUPlatform]; ok {
+		vm.MinCPUPlatform = v
+	}
+	if v, ok := p.Annotations[AnnotationConfidentialNodes]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return hostVM{}, fmt.Errorf("%w: parsing %v annotation: %v", ErrInvalidHostVMConfig, AnnotationConfidentialNodes, err)
+		}
+		vm.Confidential = b
+	}
+	if err := ValidateHostVM(vm.MinCPUPlatform, vm.Confidential, machineType); err != nil {
+		return hostVM{}, err
+	}
+	return vm, nil
+}
+
+// confidentialNodes returns the ConfidentialNodes node config, nil if they
+// are disabled.
+func (vm hostVM) confidentialNodes() *containerv1beta1.ConfidentialNodes {
+	if !vm.Confidential {
+		return nil
+	}
+	return &containerv1beta1.ConfidentialNodes{Enabled: true}
+}
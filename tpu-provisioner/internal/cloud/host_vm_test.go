@@ -0,0 +1,72 @@
+package cloud
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestValidateHostVM(t *testing.T) {
+	cases := []struct {
+		name           string
+		minCPUPlatform string
+		confidential   bool
+		machineType    string
+		valid          bool
+	}{
+		{name: "defaults", machineType: "ct5lp-hightpu-4t", valid: true},
+		{name: "min CPU platform", minCPUPlatform: "Intel Ice Lake", machineType: "ct4p-hightpu-4t", valid: true},
+		{name: "unknown min CPU platform", minCPUPlatform: "Intel Icelake"},
+		{name: "confidential without machine type", confidential: true, valid: true},
+		{name: "confidential TPU", confidential: true, machineType: "ct5lp-hightpu-4t"},
+		{name: "confidential AMD", confidential: true, minCPUPlatform: "AMD Milan", machineType: "n2d-standard-8", valid: true},
+		{name: "confidential AMD on Intel platform", confidential: true, minCPUPlatform: "Intel Ice Lake", machineType: "n2d-standard-8"},
+		{name: "confidential Intel", confidential: true, minCPUPlatform: "Automatic", machineType: "a3-highgpu-8g", valid: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateHostVM(c.minCPUPlatform, c.confidential, c.machineType)
+			if c.valid && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !c.valid && !errors.Is(err, ErrInvalidHostVMConfig) {
+				t.Fatalf("expected %v, got: %v", ErrInvalidHostVMConfig, err)
+			}
+		})
+	}
+}
+
+func TestGKE_hostVMForPod(t *testing.T) {
+	const accel = "tpu-v5-lite-podslice"
+	disabled := false
+	g := &GKE{ClusterContext: GKEContext{
+		NodeMinCPUPlatform:  "Intel Cascade Lake",
+		NodeConfidential:    true,
+		AcceleratorDefaults: map[string]AcceleratorDefaults{accel: {MinCPUPlatform: "Intel Ice Lake", ConfidentialNodes: &disabled}},
+	}}
+	p := &corev1.Pod{}
+	p.Spec.NodeSelector = map[string]string{GKEAcceleratorNodeSelector: accel}
+
+	vm, err := g.hostVMForPod(p, "ct5lp-hightpu-4t")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exp := (hostVM{MinCPUPlatform: "Intel Ice Lake"}); vm != exp || vm.confidentialNodes() != nil {
+		t.Fatalf("expected: %+v, got: %+v", exp, vm)
+	}
+
+	p.Annotations = map[string]string{AnnotationMinCPUPlatform: "Intel Sapphire Rapids"}
+	if vm, err := g.hostVMForPod(p, "ct5lp-hightpu-4t"); err != nil || vm.MinCPUPlatform != "Intel Sapphire Rapids" {
+		t.Fatalf("expected the annotation to take precedence, got: %+v, %v", vm, err)
+	}
+
+	p.Annotations = map[string]string{AnnotationConfidentialNodes: "true"}
+	if _, err := g.hostVMForPod(p, "ct5lp-hightpu-4t"); !errors.Is(err, ErrInvalidHostVMConfig) {
+		t.Fatalf("expected %v for confidential TPU nodes, got: %v", ErrInvalidHostVMConfig, err)
+	}
+	p.Annotations = map[string]string{AnnotationConfidentialNodes: "yes please"}
+	if _, err := g.hostVMForPod(p, "ct5lp-hightpu-4t"); !errors.Is(err, ErrInvalidHostVMConfig) {
+		t.Fatalf("expected %v for an invalid annotation, got: %v", ErrInvalidHostVMConfig, err)
+	}
+}
@@ -0,0 +1,54 @@
+package cloud
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// parseIdleTimeout parses an idle timeout, which must be a positive duration.
+func parseIdleTimeout(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return d, nil
+}
+
+// idleTimeoutForPod returns the value of the LabelIdleTimeout label of the
+// node pool for the Pod, from its AnnotationIdleTimeout annotation, or false
+// if it is not set. An invalid annotation is ignored with a warning event, so
+// that the node pool uses the default idle timeout instead of not being
+// created.
+func (g *GKE) idleTimeoutForPod(p *corev1.Pod) (string, bool) {
+	v, ok := p.Annotations[AnnotationIdleTimeout]
+	if !ok {
+		return "", false
+	}
+	d, err := parseIdleTimeout(v)
+	if err != nil {
+		log.Info("Ignoring invalid idle timeout annotation", "pod", p.Namespace+"/"+p.Name, "value", v, "error", err.Error())
+		g.eventf(p, corev1.EventTypeWarning, EventInvalidIdleTimeout, "Ignoring %v annotation %q: %v. Using the default idle timeout.", AnnotationIdleTimeout, v, err)
+		return "", false
+	}
+	// The canonical form, for example "1h30m0s", is a valid label value.
+	return d.String(), true
+}
+
+// NodePoolIdleTimeout returns the idle timeout of a node pool from the
+// LabelIdleTimeout label of its Nodes, or false if it is not set or invalid.
+func NodePoolIdleTimeout(labels map[string]string) (time.Duration, bool) {
+	v, ok := labels[LabelIdleTimeout]
+	if !ok {
+		return 0, false
+	}
+	d, err := parseIdleTimeout(v)
+	if err != nil {
+		return 0, false
+	}
+	return d, true
+}
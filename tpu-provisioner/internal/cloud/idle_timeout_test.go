@@ -0,0 +1,43 @@
+package cloud
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestGKE_idleTimeoutForPod(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		exp         string
+		event       bool
+	}{
+		{name: "not set"},
+		{name: "valid", annotations: map[string]string{AnnotationIdleTimeout: "90m"}, exp: "1h30m0s"},
+		{name: "not a duration", annotations: map[string]string{AnnotationIdleTimeout: "soon"}, event: true},
+		{name: "not positive", annotations: map[string]string{AnnotationIdleTimeout: "0s"}, event: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rec := record.NewFakeRecorder(10)
+			g := &GKE{Recorder: rec}
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "train-0", Namespace: "default", Annotations: c.annotations}}
+			got, ok := g.idleTimeoutForPod(pod)
+			if got != c.exp || ok != (c.exp != "") {
+				t.Fatalf("expected: %q, got: %q, %v", c.exp, got, ok)
+			}
+			if c.event != (len(rec.Events) == 1) {
+				t.Fatalf("expected warning event: %v, got %d events", c.event, len(rec.Events))
+			}
+			if ok {
+				if d, ok := NodePoolIdleTimeout(map[string]string{LabelIdleTimeout: got}); !ok || d != 90*time.Minute {
+					t.Fatalf("expected the label to parse back to 90m, got: %v, %v", d, ok)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package cloud
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// imageTypes are the node image types that GKE supports.
+var imageTypes = []string{"COS_CONTAINERD", "UBUNTU_CONTAINERD", "WINDOWS_LTSC_CONTAINERD", "WINDOWS_SAC_CONTAINERD"}
+
+// acceleratorImageTypes are the node image types that support TPU and GPU
+// machine types, whose device plugins only run on Linux.
+var acceleratorImageTypes = []string{"COS_CONTAINERD", "UBUNTU_CONTAINERD"}
+
+// acceleratorMachinePrefixes are the prefixes of TPU and GPU machine types.
+var acceleratorMachinePrefixes = []string{"ct", "a2-", "a3-", "g2-"}
+
+// ValidateImageType returns ErrInvalidImageType if the image type is not
+// supported by GKE or, if machineType is set, by the machine type. Image
+// types are case-insensitive. Empty leaves the choice to GKE.
+func ValidateImageType(imageType, machineType string) error {
+	if imageType == "" {
+		return nil
+	}
+	imageType = strings.ToUpper(imageType)
+	if !containsString(imageTypes, imageType) {
+		return fmt.Errorf("%w: unsupported image type %q, must be one of %v", ErrInvalidImageType, imageType, imageTypes)
+	}
+	if hasAnyPrefix(machineType, acceleratorMachinePrefixes) && !containsString(acceleratorImageTypes, imageType) {
+		return fmt.Errorf("%w: image type %q is not supported by machine type %q, must be one of %v", ErrInvalidImageType, imageType, machineType, acceleratorImageTypes)
+	}
+	return nil
+}
+
+// imageTypeForPod returns the node image type of the node pool for the Pod.
+// The AnnotationImageType annotation takes precedence over the class, which
+// takes precedence over the accelerator defaults and then the cluster
+// default.
+func (g *GKE) imageTypeForPod(p *corev1.Pod, machineType string, class *NodePoolClass) (string, error) {
+	imageType := g.ClusterContext.NodeImageType
+	if d, ok := g.ClusterContext.acceleratorDefaultsForPod(p); ok && d.ImageType != "" {
+		imageType = d.ImageType
+	}
+	if class != nil && class.ImageType != "" {
+		imageType = class.ImageType
+	}
+	if v, ok := p.Annotations[AnnotationImageType]; ok {
+		imageType = v
+	}
+	imageType = strings.ToUpper(imageType)
+	if err := ValidateImageType(imageType, machineType); err != nil {
+		return "", err
+	}
+	return imageType, nil
+}
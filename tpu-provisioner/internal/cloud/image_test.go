@@ -0,0 +1,65 @@
+package cloud
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestGKE_imageTypeForPod(t *testing.T) {
+	const accel = "tpu-v5-lite-podslice"
+	ctx := GKEContext{
+		NodeImageType:       "COS_CONTAINERD",
+		AcceleratorDefaults: map[string]AcceleratorDefaults{accel: {ImageType: "UBUNTU_CONTAINERD"}},
+	}
+	pod := func(accelerator string, annotations map[string]string) *corev1.Pod {
+		p := &corev1.Pod{}
+		p.Annotations = annotations
+		p.Spec.NodeSelector = map[string]string{GKEAcceleratorNodeSelector: accelerator}
+		return p
+	}
+
+	cases := []struct {
+		name  string
+		pod   *corev1.Pod
+		class *NodePoolClass
+		exp   string
+		err   error
+	}{
+		{name: "cluster default", pod: pod("tpu-v4-podslice", nil), exp: "COS_CONTAINERD"},
+		{name: "accelerator default", pod: pod(accel, nil), exp: "UBUNTU_CONTAINERD"},
+		{name: "class", pod: pod(accel, nil), class: &NodePoolClass{ImageType: "COS_CONTAINERD"}, exp: "COS_CONTAINERD"},
+		{
+			name:  "annotation",
+			pod:   pod(accel, map[string]string{AnnotationImageType: "cos_containerd"}),
+			class: &NodePoolClass{ImageType: "UBUNTU_CONTAINERD"},
+			exp:   "COS_CONTAINERD",
+		},
+		{name: "unknown", pod: pod(accel, map[string]string{AnnotationImageType: "COS"}), err: ErrInvalidImageType},
+		{
+			name: "unsupported by machine type",
+			pod:  pod(accel, map[string]string{AnnotationImageType: "WINDOWS_LTSC_CONTAINERD"}),
+			err:  ErrInvalidImageType,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := &GKE{ClusterContext: ctx}
+			got, err := g.imageTypeForPod(c.pod, "ct5lp-hightpu-4t", c.class)
+			if c.err != nil {
+				if !errors.Is(err, c.err) {
+					t.Fatalf("expected %v, got: %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != c.exp {
+				t.Fatalf("expected: %v, got: %v", c.exp, got)
+			}
+		})
+	}
+}
@@ -2,14 +2,251 @@ package cloud
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 )
 
 type Provider interface {
 	NodePoolLabelKey() string
-	EnsureNodePoolForPod(*corev1.Pod) error
+	// NodePoolOwner returns the label that marks the node pools, and their
+	// Nodes, that this provisioner manages.
+	NodePoolOwner() Owner
+	// EnsureNodePoolForPod creates the node pool for the Pod unless it
+	// already exists. The operation that creates the node pool is returned
+	// if one was started, even if it failed.
+	EnsureNodePoolForPod(*corev1.Pod, NodePoolRequest) (*NodePoolOperation, error)
+	// PollNodePoolOperation returns whether the named operation is done,
+	// and if so, the error it failed with. Errors while polling are returned
+	// with done=false.
+	PollNodePoolOperation(name string) (done bool, err error)
+	// NodePoolNameForPod returns the preferred name of the node pool for the
+	// Pod. EnsureNodePoolForPod may use a different name if the preferred
+	// one is taken by another node pool, and records it in the
+	// AnnotationNodePoolName annotation and in NodePoolOperation.NodePool,
+	// see NodePoolNameForPod in the controller package.
+	NodePoolNameForPod(*corev1.Pod) (string, error)
+	// NodePoolTaintsForPod returns the taints that the node pool created
+	// for the Pod would have.
+	NodePoolTaintsForPod(*corev1.Pod) ([]corev1.Taint, error)
 	DeleteNodePoolForNode(*corev1.Node) error
+	// DeleteNodePool deletes the named node pool. Node pools that were not
+	// created by this provisioner are refused with ErrNodePoolNotOwned.
+	DeleteNodePool(name string) error
+	// ListNodePools returns the node pools that were created by this
+	// provisioner. The result may be cached briefly.
+	ListNodePools() ([]NodePoolInfo, error)
 }
 
-var ErrDuplicateRequest = errors.New("duplicate request")
+// WarmNodePoolRefiller is implemented by providers that keep warm node pools
+// for Pods to claim.
+type WarmNodePoolRefiller interface {
+	// RefillWarmNodePools creates the missing warm node pools and deletes
+	// the ones that are no longer wanted.
+	RefillWarmNodePools() error
+}
+
+// PodAnnotator sets annotations on Pods for providers, which do not have
+// access to the Kubernetes API themselves.
+type PodAnnotator interface {
+	AnnotatePod(p *corev1.Pod, key, value string) error
+}
+
+// NodePoolInfo describes a node pool that was created by this provisioner.
+type NodePoolInfo struct {
+	Name string
+	// CreatedAt is when the provisioner created the node pool, zero if
+	// unknown (node pools created by older versions).
+	CreatedAt time.Time
+	// NodeCount is the number of nodes that the node pool was created with.
+	// The cluster autoscaler may have changed it since.
+	NodeCount int
+	// Autoscaled is true if the cluster autoscaler may scale the node pool,
+	// possibly down to zero nodes.
+	Autoscaled bool
+	// Status is the provider's status of the node pool, for example
+	// NodePoolStatusRunning, empty if unknown.
+	Status string
+}
+
+// Statuses of node pools, see NodePoolInfo.Status.
+const (
+	NodePoolStatusRunning = "RUNNING"
+	NodePoolStatusError   = "ERROR"
+)
+
+// NodePoolOperation identifies a cloud operation on a node pool, for
+// correlation with the provider's logs and APIs.
+type NodePoolOperation struct {
+	// Name is the fully qualified name of the operation, for example
+	// "projects/my-project/locations/us-central2/operations/operation-123".
+	Name string
+	// SelfLink is the URL of the operation, if known.
+	SelfLink string
+	// NodePool is the name of the node pool that the operation is for.
+	NodePool string
+	// Pending is true if the provider returned without waiting for the
+	// operation to finish, see Provider.PollNodePoolOperation.
+	Pending bool
+}
+
+// NodePoolRequest carries sizing information that the caller has already
+// determined for the node pool (for example, for a whole multi-host slice).
+// Zero values mean the provider should derive the value from the Pod.
+type NodePoolRequest struct {
+	NodeCount int
+	Topology  string
+	// Placement is what the topology constraints of the Pods require from
+	// the node pool, see PlacementIntentForPod.
+	Placement PlacementIntent
+}
+
+var (
+	ErrDuplicateRequest           = errors.New("duplicate request")
+	ErrNodePoolCreationInProgress = errors.New("node pool creation in progress")
+	// ErrNodePoolNotOwned is returned when deleting a node pool that was
+	// not created by this provisioner.
+	ErrNodePoolNotOwned = errors.New("node pool not owned by the provisioner")
+	// ErrReservationUnavailable is returned when the requested reservation
+	// does not exist or does not have enough capacity for the node pool.
+	ErrReservationUnavailable = errors.New("reservation unavailable")
+	// ErrQuotaExceeded is returned when the node pool could not be created
+	// because a GCP quota was exhausted.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrNodePoolLimitReached is returned when creating the node pool would
+	// exceed the configured maximum number of managed node pools.
+	ErrNodePoolLimitReached = errors.New("node pool limit reached")
+	// ErrInvalidTPUConfig is returned when the TPU accelerator, topology and
+	// TPU request of a Pod are not compatible with each other.
+	ErrInvalidTPUConfig = errors.New("invalid TPU configuration")
+	// ErrInvalidNodePoolConfig is returned when a node pool cannot be derived
+	// from the Pod, for example because of conflicting annotations.
+	ErrInvalidNodePoolConfig = errors.New("invalid node pool configuration")
+	// ErrPlacementPolicyNotFound is returned when the requested placement
+	// resource policy does not exist.
+	ErrPlacementPolicyNotFound = errors.New("placement policy not found")
+	// ErrUnknownNodePoolClass is returned when the Pod selects a node pool
+	// class that is not configured.
+	ErrUnknownNodePoolClass = errors.New("unknown node pool class")
+	// ErrInvalidDiskConfig is returned when the requested disks are invalid
+	// or not supported by the machine type of the node pool.
+	ErrInvalidDiskConfig = errors.New("invalid disk configuration")
+	// ErrInvalidNetworkConfig is returned when the requested network,
+	// subnetwork or secondary range is invalid or does not exist.
+	ErrInvalidNetworkConfig = errors.New("invalid network configuration")
+	// ErrIncompatibleNodeVersion is returned when the requested node version
+	// is invalid or does not support the machine type of the node pool.
+	ErrIncompatibleNodeVersion = errors.New("incompatible node version")
+	// ErrInvalidServiceAccount is returned when the node service account is
+	// not a service account email.
+	ErrInvalidServiceAccount = errors.New("invalid service account")
+	// ErrServiceAccountPermission is returned when GKE rejects the node
+	// service account because it does not exist or the provisioner is not
+	// allowed to use it (roles/iam.serviceAccountUser).
+	ErrServiceAccountPermission = errors.New("service account permission denied")
+	// ErrProjectPermission is returned when GKE rejects the node pool
+	// because a network or reservation in another project may not be used,
+	// see ProjectPermissionError.
+	ErrProjectPermission = errors.New("project permission denied")
+	// ErrZoneStockout is returned when the zone of the node pool does not
+	// have the capacity to create it.
+	ErrZoneStockout = errors.New("zone out of capacity")
+	// ErrNodeManagementConflict is returned when the requested auto-upgrade
+	// or auto-repair settings are not allowed for the cluster, for example
+	// disabling auto-upgrade in a release channel.
+	ErrNodeManagementConflict = errors.New("node management settings conflict with cluster")
+	// ErrIncompatibleLocality is returned when the requested locality of the
+	// node pool is not supported for its accelerator, for example a
+	// regional multi-host TPU slice.
+	ErrIncompatibleLocality = errors.New("incompatible node pool locality")
+	// ErrOperationInProgress is returned when GKE rejected the node pool
+	// because the cluster is running a conflicting operation, see
+	// OperationInProgressError.
+	ErrOperationInProgress = errors.New("cluster operation in progress")
+	// ErrInvalidImageType is returned when the requested node image type is
+	// unknown or not supported by the machine type of the node pool.
+	ErrInvalidImageType = errors.New("invalid image type")
+	// ErrInvalidHostVMConfig is returned when the minimum CPU platform or
+	// the Confidential GKE Nodes setting is invalid or not supported by the
+	// machine type of the node pool.
+	ErrInvalidHostVMConfig = errors.New("invalid host VM config")
+	// ErrInvalidSandboxConfig is returned when the requested GKE Sandbox
+	// type is unknown or not supported by the machine type or image type of
+	// the node pool.
+	ErrInvalidSandboxConfig = errors.New("invalid sandbox config")
+	// ErrInvalidKubeletConfig is returned when a requested kubelet setting
+	// or sysctl is unknown, has an invalid value or is not allowed by GKE.
+	ErrInvalidKubeletConfig = errors.New("invalid kubelet config")
+	// ErrInvalidMaxPodsPerNode is returned when the requested maximum number
+	// of Pods per node is outside of the range that GKE allows or does not
+	// fit into the cluster's Pod IP range.
+	ErrInvalidMaxPodsPerNode = errors.New("invalid max pods per node")
+	// ErrInvalidResourceManagerTags is returned when a requested resource
+	// manager tag binding is malformed.
+	ErrInvalidResourceManagerTags = errors.New("invalid resource manager tags")
+	// ErrResourceManagerTagBinding is returned when GKE could not bind the
+	// resource manager tags of a node pool, because a tag does not exist or
+	// the GKE service agent may not use it.
+	ErrResourceManagerTagBinding = errors.New("resource manager tag binding failed")
+	// ErrInvalidNetworkInterfaceConfig is returned when the requested gVNIC
+	// setting or additional network interfaces are malformed or not
+	// supported by the machine type of the node pool.
+	ErrInvalidNetworkInterfaceConfig = errors.New("invalid network interface config")
+	// ErrCreateHookRejected is returned when the pre-create hook rejected
+	// the node pool, and ErrCreateHookFailed when it could not be called
+	// and CreateHooks.FailOpen is not set.
+	ErrCreateHookRejected = errors.New("node pool rejected by pre-create hook")
+	ErrCreateHookFailed   = errors.New("pre-create hook failed")
+	// ErrIncompleteTPUSelector is returned when a Pod selects only one of
+	// the TPU accelerator type and topology and the other one is not filled
+	// in, see CompleteTPUSelectors.
+	ErrIncompleteTPUSelector = errors.New("incomplete TPU node selectors")
+	// ErrUnsatisfiableTopology is returned when the topology constraints of
+	// the Pod cannot be satisfied by its node pool, see PlacementIntent.
+	ErrUnsatisfiableTopology = errors.New("unsatisfiable topology constraints")
+	// ErrClusterNotFound is returned when the configured project or cluster
+	// does not exist (or is not visible to the provisioner's credentials).
+	// Nothing succeeds until the configuration is fixed.
+	ErrClusterNotFound = errors.New("cluster not found")
+	// ErrTemplateNotFound is returned when the node pool template that new
+	// node pools are copied from does not exist.
+	ErrTemplateNotFound = errors.New("node pool template not found")
+	// ErrTransient is returned when a call to GKE failed at the network or
+	// transport level (a DNS lookup, a connection or a timeout) before
+	// GKE answered. Retrying right away is likely to succeed.
+	ErrTransient = errors.New("transient network error")
+)
+
+// RateLimitedError is returned when a call was not made because it would
+// have exceeded the client-side rate limit.
+type RateLimitedError struct {
+	// RetryAfter is how long to wait before the call can be made.
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("rate limited, retry after %v", e.RetryAfter)
+}
+
+// OperationInProgressError is returned when the cluster is running an
+// operation that conflicts with the node pool call, for example an upgrade
+// or the creation of another node pool. It matches ErrOperationInProgress.
+type OperationInProgressError struct {
+	// Operation is the name of the conflicting operation, if GKE reported
+	// it.
+	Operation string
+	Err       error
+}
+
+func (e *OperationInProgressError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrOperationInProgress, e.Err)
+}
+
+func (e *OperationInProgressError) Is(target error) bool {
+	return target == ErrOperationInProgress
+}
+
+func (e *OperationInProgressError) Unwrap() error {
+	return e.Err
+}
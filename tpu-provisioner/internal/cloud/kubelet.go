@@ -0,0 +1,248 @@
+package cloud
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Kubelet settings of the AnnotationKubeletConfig annotation, see
+// https://cloud.google.com/kubernetes-engine/docs/how-to/node-system-config.
+const (
+	// KubeletCPUManagerPolicy is the CPU manager policy, "none" or "static".
+	KubeletCPUManagerPolicy = "cpu-manager-policy"
+	// KubeletCPUCFSQuota ("true" or "false") enforces CPU limits.
+	KubeletCPUCFSQuota = "cpu-cfs-quota"
+	// KubeletCPUCFSQuotaPeriod is the CPU CFS quota period, a duration
+	// between 1ms and 1s.
+	KubeletCPUCFSQuotaPeriod = "cpu-cfs-quota-period"
+	// KubeletPodPidsLimit is the maximum number of processes per Pod,
+	// between 1024 and 4194304.
+	KubeletPodPidsLimit = "pod-pids-limit"
+)
+
+const (
+	minPodPidsLimit      = 1024
+	maxPodPidsLimit      = 4194304
+	minCPUCFSQuotaPeriod = time.Millisecond
+	maxCPUCFSQuotaPeriod = time.Second
+)
+
+// allowedSysctls are the sysctls that GKE allows to set on nodes, GKE
+// rejects node pools with other sysctls.
+var allowedSysctls = map[string]bool{
+	"net.core.busy_poll":                 true,
+	"net.core.busy_read":                 true,
+	"net.core.netdev_max_backlog":        true,
+	"net.core.rmem_default":              true,
+	"net.core.rmem_max":                  true,
+	"net.core.wmem_default":              true,
+	"net.core.wmem_max":                  true,
+	"net.core.optmem_max":                true,
+	"net.core.somaxconn":                 true,
+	"net.ipv4.tcp_rmem":                  true,
+	"net.ipv4.tcp_wmem":                  true,
+	"net.ipv4.tcp_tw_reuse":              true,
+	"net.ipv6.conf.all.disable_ipv6":     true,
+	"net.ipv6.conf.default.disable_ipv6": true,
+	"vm.max_map_count":                   true,
+}
+
+// ParseKubeletConfig parses kubelet settings in the format of the
+// AnnotationKubeletConfig annotation: comma-separated setting=value pairs,
+// for example "cpu-manager-policy=static,pod-pids-limit=4096". Unknown
+// settings and invalid values return ErrInvalidKubeletConfig.
+func ParseKubeletConfig(spec string) (map[string]string, error) {
+	settings, err := parseSettings(spec, "kubelet setting", ErrInvalidKubeletConfig)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range settings {
+		if err := validateKubeletSetting(k, v); err != nil {
+			return nil, err
+		}
+	}
+	return settings, nil
+}
+
+func validateKubeletSetting(key, value string) error {
+	switch key {
+	case KubeletCPUManagerPolicy:
+		if value != "none" && value != "static" {
+			return fmt.Errorf("%w: %s must be %q or %q, not %q", ErrInvalidKubeletConfig, key, "none", "static", value)
+		}
+	case KubeletCPUCFSQuota:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%w: %s must be true or false, not %q", ErrInvalidKubeletConfig, key, value)
+		}
+	case KubeletCPUCFSQuotaPeriod:
+		d, err := time.ParseDuration(value)
+		if err != nil || d < minCPUCFSQuotaPeriod || d > maxCPUCFSQuotaPeriod {
+			return fmt.Errorf("%w: %s must be a duration between %v and %v, not %q", ErrInvalidKubeletConfig, key, minCPUCFSQuotaPeriod, maxCPUCFSQuotaPeriod, value)
+		}
+	case KubeletPodPidsLimit:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < minPodPidsLimit || n > maxPodPidsLimit {
+			return fmt.Errorf("%w: %s must be between %d and %d, not %q", ErrInvalidKubeletConfig, key, minPodPidsLimit, maxPodPidsLimit, value)
+		}
+	default:
+		return fmt.Errorf("%w: unknown kubelet setting %q, must be one of %s", ErrInvalidKubeletConfig, key,
+			strings.Join([]string{KubeletCPUManagerPolicy, KubeletCPUCFSQuota, KubeletCPUCFSQuotaPeriod, KubeletPodPidsLimit}, ", "))
+	}
+	return nil
+}
+
+// ParseSysctls parses sysctls in the format of the AnnotationSysctls
+// annotation: comma-separated sysctl=value pairs, for example
+// "net.core.somaxconn=4096". Sysctls that GKE does not allow return
+// ErrInvalidKubeletConfig.
+func ParseSysctls(spec string) (map[string]string, error) {
+	sysctls, err := parseSettings(spec, "sysctl", ErrInvalidKubeletConfig)
+	if err != nil {
+		return nil, err
+	}
+	for k := range sysctls {
+		if !allowedSysctls[k] {
+			return nil, fmt.Errorf("%w: sysctl %q is not allowed by GKE", ErrInvalidKubeletConfig, k)
+		}
+	}
+	return sysctls, nil
+}
+
+// parseSettings parses comma-separated key=value pairs, malformed pairs
+// return errInvalid. Values can contain spaces, for example the
+// "4096 87380 6291456" of net.ipv4.tcp_rmem.
+func parseSettings(spec, what string, errInvalid error) (map[string]string, error) {
+	settings := map[string]string{}
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(s, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" || v == "" {
+			return nil, fmt.Errorf("%w: invalid %s %q, must be key=value", errInvalid, what, s)
+		}
+		if _, ok := settings[k]; ok {
+			return nil, fmt.Errorf("%w: duplicate %s %q", errInvalid, what, k)
+		}
+		settings[k] = v
+	}
+	return settings, nil
+}
+
+// nodeSystemConfig are the kubelet settings and sysctls of a node pool.
+type nodeSystemConfig struct {
+	Kubelet map[string]string
+	Sysctls map[string]string
+}
+
+// systemConfigForPod returns the kubelet settings and sysctls of the node
+// pool for the Pod. The AnnotationKubeletConfig and AnnotationSysctls
+// annotations are merged into the accelerator defaults, the annotations take
+// precedence for each setting.
+func (g *GKE) systemConfigForPod(p *corev1.Pod) (nodeSystemConfig, error) {
+	var out nodeSystemConfig
+	d, _ := g.ClusterContext.acceleratorDefaultsForPod(p)
+	for _, s := range []struct {
+		defaults, annotation string
+		parse                func(string) (map[string]string, error)
+		into                 *map[string]string
+	}{
+		{defaults: d.KubeletConfig, annotation: AnnotationKubeletConfig, parse: ParseKubeletConfig, into: &out.Kubelet},
+		{defaults: d.Sysctls, annotation: AnnotationSysctls, parse: ParseSysctls, into: &out.Sysctls},
+	} {
+		settings, err := s.parse(s.defaults)
+		if err != nil {
+			return nodeSystemConfig{}, fmt.Errorf("accelerator defaults: %w", err)
+		}
+		if v, ok := p.Annotations[s.annotation]; ok {
+			overrides, err := s.parse(v)
+			if err != nil {
+				return nodeSystemConfig{}, fmt.Errorf("parsing %v annotation: %w", s.annotation, err)
+			}
+			for k, v := range overrides {
+				settings[k] = v
+			}
+		}
+		if len(settings) > 0 {
+			*s.into = settings
+		}
+	}
+	return out, nil
+}
+
+// kubeletConfig returns the NodeKubeletConfig node config, nil without
+// kubelet settings. The settings must have been validated.
+func (c nodeSystemConfig) kubeletConfig() *containerv1beta1.NodeKubeletConfig {
+	if len(c.Kubelet) == 0 {
+		return nil
+	}
+	out := &containerv1beta1.NodeKubeletConfig{
+		CpuManagerPolicy: c.Kubelet[KubeletCPUManagerPolicy],
+	}
+	if v, ok := c.Kubelet[KubeletCPUCFSQuota]; ok {
+		out.CpuCfsQuota, _ = strconv.ParseBool(v)
+		// Send false, which GKE would otherwise default to true.
+		out.ForceSendFields = append(out.ForceSendFields, "CpuCfsQuota")
+	}
+	if v, ok := c.Kubelet[KubeletCPUCFSQuotaPeriod]; ok {
+		d, _ := time.ParseDuration(v)
+		out.CpuCfsQuotaPeriod = d.String()
+	}
+	if v, ok := c.Kubelet[KubeletPodPidsLimit]; ok {
+		out.PodPidsLimit, _ = strconv.ParseInt(v, 10, 64)
+	}
+	return out
+}
+
+// linuxNodeConfig returns the LinuxNodeConfig node config, nil without
+// sysctls.
+func (c nodeSystemConfig) linuxNodeConfig() *containerv1beta1.LinuxNodeConfig {
+	if len(c.Sysctls) == 0 {
+		return nil
+	}
+	return &containerv1beta1.LinuxNodeConfig{Sysctls: c.Sysctls}
+}
+
+// nodeSystemConfigOf returns the kubelet settings and sysctls of a node
+// config, for logging.
+func nodeSystemConfigOf(cfg *containerv1beta1.NodeConfig) nodeSystemConfig {
+	var out nodeSystemConfig
+	if k := cfg.KubeletConfig; k != nil {
+		out.Kubelet = map[string]string{}
+		if k.CpuManagerPolicy != "" {
+			out.Kubelet[KubeletCPUManagerPolicy] = k.CpuManagerPolicy
+		}
+		if k.CpuCfsQuota || containsString(k.ForceSendFields, "CpuCfsQuota") {
+			out.Kubelet[KubeletCPUCFSQuota] = strconv.FormatBool(k.CpuCfsQuota)
+		}
+		if k.CpuCfsQuotaPeriod != "" {
+			out.Kubelet[KubeletCPUCFSQuotaPeriod] = k.CpuCfsQuotaPeriod
+		}
+		if k.PodPidsLimit != 0 {
+			out.Kubelet[KubeletPodPidsLimit] = strconv.FormatInt(k.PodPidsLimit, 10)
+		}
+	}
+	if cfg.LinuxNodeConfig != nil {
+		out.Sysctls = cfg.LinuxNodeConfig.Sysctls
+	}
+	return out
+}
+
+// formatSettings formats settings as sorted comma-separated key=value pairs,
+// in the format of the annotations.
+func formatSettings(settings map[string]string) string {
+	pairs := make([]string, 0, len(settings))
+	for k, v := range settings {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
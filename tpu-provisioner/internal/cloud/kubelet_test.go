@@ -0,0 +1,97 @@
+package cloud
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParseKubeletConfig(t *testing.T) {
+	cases := []struct {
+		name  string
+		spec  string
+		exp   map[string]string
+		valid bool
+	}{
+		{name: "empty", exp: map[string]string{}, valid: true},
+		{
+			name:  "all settings",
+			spec:  "cpu-manager-policy=static, cpu-cfs-quota=false,cpu-cfs-quota-period=100ms,pod-pids-limit=4096",
+			exp:   map[string]string{KubeletCPUManagerPolicy: "static", KubeletCPUCFSQuota: "false", KubeletCPUCFSQuotaPeriod: "100ms", KubeletPodPidsLimit: "4096"},
+			valid: true,
+		},
+		{name: "unknown setting", spec: "image-gc-high-threshold=80"},
+		{name: "missing value", spec: "cpu-manager-policy"},
+		{name: "duplicate", spec: "pod-pids-limit=4096,pod-pids-limit=8192"},
+		{name: "invalid policy", spec: "cpu-manager-policy=dynamic"},
+		{name: "invalid quota", spec: "cpu-cfs-quota=maybe"},
+		{name: "period too long", spec: "cpu-cfs-quota-period=2s"},
+		{name: "pids limit too low", spec: "pod-pids-limit=100"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			settings, err := ParseKubeletConfig(c.spec)
+			if c.valid {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(settings, c.exp) {
+					t.Fatalf("expected: %v, got: %v", c.exp, settings)
+				}
+			}
+			if !c.valid && !errors.Is(err, ErrInvalidKubeletConfig) {
+				t.Fatalf("expected %v, got: %v", ErrInvalidKubeletConfig, err)
+			}
+		})
+	}
+}
+
+func TestParseSysctls(t *testing.T) {
+	sysctls, err := ParseSysctls("net.core.somaxconn=4096,net.ipv4.tcp_rmem=4096 87380 6291456")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exp := map[string]string{"net.core.somaxconn": "4096", "net.ipv4.tcp_rmem": "4096 87380 6291456"}; !reflect.DeepEqual(sysctls, exp) {
+		t.Fatalf("expected: %v, got: %v", exp, sysctls)
+	}
+	if _, err := ParseSysctls("kernel.shmmax=1"); !errors.Is(err, ErrInvalidKubeletConfig) {
+		t.Fatalf("expected %v for a disallowed sysctl, got: %v", ErrInvalidKubeletConfig, err)
+	}
+}
+
+func TestGKE_systemConfigForPod(t *testing.T) {
+	g := &GKE{ClusterContext: GKEContext{AcceleratorDefaults: map[string]AcceleratorDefaults{
+		V5ePodSliceAccelerator: {KubeletConfig: "cpu-manager-policy=static,pod-pids-limit=4096", Sysctls: "net.core.somaxconn=4096"},
+	}}}
+	p := &corev1.Pod{Spec: corev1.PodSpec{NodeSelector: map[string]string{GKEAcceleratorNodeSelector: V4PodSliceAccelerator}}}
+
+	system, err := g.systemConfigForPod(p)
+	if err != nil || system.kubeletConfig() != nil || system.linuxNodeConfig() != nil {
+		t.Fatalf("expected no kubelet config or sysctls by default, got: %+v, %v", system, err)
+	}
+
+	p.Spec.NodeSelector[GKEAcceleratorNodeSelector] = V5ePodSliceAccelerator
+	p.Annotations = map[string]string{AnnotationKubeletConfig: "pod-pids-limit=8192,cpu-cfs-quota=false", AnnotationSysctls: "vm.max_map_count=262144"}
+	system, err = g.systemConfigForPod(p)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kubelet := system.kubeletConfig()
+	if kubelet.CpuManagerPolicy != "static" || kubelet.PodPidsLimit != 8192 || kubelet.CpuCfsQuota || !containsString(kubelet.ForceSendFields, "CpuCfsQuota") {
+		t.Fatalf("expected the annotation to be merged into the accelerator defaults, got: %+v", kubelet)
+	}
+	if exp := map[string]string{"net.core.somaxconn": "4096", "vm.max_map_count": "262144"}; !reflect.DeepEqual(system.linuxNodeConfig().Sysctls, exp) {
+		t.Fatalf("expected sysctls: %v, got: %v", exp, system.linuxNodeConfig().Sysctls)
+	}
+	if got := nodeSystemConfigOf(&containerv1beta1.NodeConfig{KubeletConfig: kubelet}); formatSettings(got.Kubelet) != "cpu-cfs-quota=false,cpu-manager-policy=static,pod-pids-limit=8192" {
+		t.Fatalf("unexpected logged kubelet settings: %v", formatSettings(got.Kubelet))
+	}
+
+	p.Annotations = map[string]string{AnnotationSysctls: "kernel.shmmax=1"}
+	if _, err := g.systemConfigForPod(p); !errors.Is(err, ErrInvalidKubeletConfig) {
+		t.Fatalf("expected %v, got: %v", ErrInvalidKubeletConfig, err)
+	}
+}
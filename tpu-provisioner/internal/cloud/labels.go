@@ -1,5 +1,12 @@
 package cloud
 
+import (
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
 const (
 	keyPrefix = "google.com/"
 
@@ -9,4 +16,270 @@ const (
 	LabelParentKind      = keyPrefix + "tpu-provisioner-parent-kind"
 	LabelParentName      = keyPrefix + "tpu-provisioner-parent-name"
 	LabelParentNamespace = keyPrefix + "tpu-provisioner-parent-namespace"
+
+	// LabelTriggerPod is the name of the Pod that the node pool was created
+	// for and LabelJobSetName the name of its JobSet, if any. Both are
+	// sanitized to be valid label values (see sanitizeLabelValue).
+	LabelTriggerPod = keyPrefix + "tpu-provisioner-trigger-pod"
+	LabelJobSetName = keyPrefix + "tpu-provisioner-jobset-name"
+
+	// LabelAutoscalingMin is set on the nodes of autoscaled node pools to
+	// the minimum node count of the pool.
+	LabelAutoscalingMin = keyPrefix + "tpu-provisioner-autoscaling-min"
+
+	// LabelIdleTimeout is set on the nodes of node pools created for a Pod
+	// with the AnnotationIdleTimeout annotation, to the idle timeout that
+	// the garbage collector applies to the pool instead of its default.
+	LabelIdleTimeout = keyPrefix + "tpu-provisioner-idle-timeout"
+
+	// LabelWarmNodePool is set on the nodes of warm node pools, to
+	// WarmNodePoolAvailable or WarmNodePoolClaimed. LabelWarmNodePoolShape
+	// is the shape of available warm node pools. TaintWarmNodePool keeps
+	// Pods off available warm node pools until they are claimed.
+	LabelWarmNodePool      = keyPrefix + "tpu-provisioner-warm-node-pool"
+	LabelWarmNodePoolShape = keyPrefix + "tpu-provisioner-warm-node-pool-shape"
+	TaintWarmNodePool      = keyPrefix + "tpu-provisioner-warm-node-pool"
 )
+
+// Annotations that can be set on Pods to customize the node pools created
+// for them.
+const (
+	// AnnotationNodePoolTaints is a comma-separated list of taints to apply to
+	// the node pool, for example "dedicated=training:NoSchedule".
+	AnnotationNodePoolTaints = keyPrefix + "tpu-provisioner-taints"
+	// AnnotationSpot ("true" or "false") overrides whether the node pool
+	// uses Spot VMs.
+	AnnotationSpot = keyPrefix + "tpu-provisioner-spot"
+	// AnnotationReservation is the name of a reservation for the node pool
+	// to consume, or "none" to not consume any reservation.
+	AnnotationReservation = keyPrefix + "tpu-provisioner-reservation"
+	// AnnotationPlacementPolicy is the name of an existing compact placement
+	// resource policy for a multi-host node pool to use, or "none" to not use
+	// a named policy.
+	AnnotationPlacementPolicy = keyPrefix + "tpu-provisioner-placement-policy"
+	// AnnotationNodePoolClass is the name of a NodePoolClass to use as the
+	// template for the node pool.
+	AnnotationNodePoolClass = keyPrefix + "tpu-provisioner-node-pool-class"
+	// AnnotationAutoscalingMin and AnnotationAutoscalingMax are the cluster
+	// autoscaling bounds of the node pool. Setting a maximum enables
+	// autoscaling.
+	AnnotationAutoscalingMin = keyPrefix + "tpu-provisioner-autoscaling-min"
+	AnnotationAutoscalingMax = keyPrefix + "tpu-provisioner-autoscaling-max"
+	// AnnotationDiskSizeGB and AnnotationDiskType are the size (GB) and type
+	// (pd-standard, pd-balanced, pd-ssd or hyperdisk-balanced) of the boot
+	// disk of the nodes.
+	AnnotationDiskSizeGB = keyPrefix + "tpu-provisioner-disk-size-gb"
+	AnnotationDiskType   = keyPrefix + "tpu-provisioner-disk-type"
+	// AnnotationImageType is the node image type of the node pool, for
+	// example COS_CONTAINERD or UBUNTU_CONTAINERD.
+	AnnotationImageType = keyPrefix + "tpu-provisioner-image-type"
+	// AnnotationMinCPUPlatform is the minimum CPU platform of the nodes, for
+	// example "Intel Ice Lake". AnnotationConfidentialNodes ("true" or
+	// "false") enables Confidential GKE Nodes.
+	AnnotationMinCPUPlatform    = keyPrefix + "tpu-provisioner-min-cpu-platform"
+	AnnotationConfidentialNodes = keyPrefix + "tpu-provisioner-confidential-nodes"
+	// AnnotationSandbox is the GKE Sandbox type of the node pool, "gvisor"
+	// or "none".
+	AnnotationSandbox = keyPrefix + "tpu-provisioner-sandbox"
+	// AnnotationKubeletConfig and AnnotationSysctls are comma-separated
+	// key=value kubelet settings (for example
+	// "cpu-manager-policy=static,pod-pids-limit=4096") and sysctls (for
+	// example "net.core.somaxconn=4096") of the nodes.
+	AnnotationKubeletConfig = keyPrefix + "tpu-provisioner-kubelet-config"
+	AnnotationSysctls       = keyPrefix + "tpu-provisioner-sysctls"
+	// AnnotationMaxPodsPerNode is the maximum number of Pods per node, which
+	// sizes the Pod IP range of each node.
+	AnnotationMaxPodsPerNode = keyPrefix + "tpu-provisioner-max-pods-per-node"
+	// AnnotationResourceManagerTags are comma-separated key=value resource
+	// manager tag bindings of the nodes (for example
+	// "tagKeys/281475012345678=tagValues/281479012345678" or
+	// "123456789012/env=prod"), in addition to the configured ones.
+	AnnotationResourceManagerTags = keyPrefix + "tpu-provisioner-resource-manager-tags"
+	// AnnotationLocalSSDCount is the number of local SSDs to attach to each
+	// node as ephemeral scratch space.
+	AnnotationLocalSSDCount = keyPrefix + "tpu-provisioner-local-ssd-count"
+	// AnnotationNetwork and AnnotationSubnetwork are the VPC network and
+	// subnetwork to attach the nodes to, in addition to the cluster network.
+	// AnnotationPodRange is the name of the secondary range to allocate Pod
+	// IPs from.
+	AnnotationNetwork    = keyPrefix + "tpu-provisioner-network"
+	AnnotationSubnetwork = keyPrefix + "tpu-provisioner-subnetwork"
+	AnnotationPodRange   = keyPrefix + "tpu-provisioner-pod-range"
+	// AnnotationGvnic enables ("true") or disables ("false") gVNIC on the
+	// nodes. AnnotationAdditionalNetworks are further network interfaces of
+	// the nodes, comma-separated network:subnetwork pairs, see
+	// ParseNetworkInterfaces.
+	AnnotationGvnic              = keyPrefix + "tpu-provisioner-gvnic"
+	AnnotationAdditionalNetworks = keyPrefix + "tpu-provisioner-additional-networks"
+
+	// AnnotationServiceAccount is the email of the GCP service account of
+	// the nodes, AnnotationOAuthScopes a comma-separated list of their OAuth
+	// scopes.
+	AnnotationServiceAccount = keyPrefix + "tpu-provisioner-service-account"
+	AnnotationOAuthScopes    = keyPrefix + "tpu-provisioner-oauth-scopes"
+
+	// AnnotationZones is a comma-separated list of zones to create the node
+	// pool in, in order of preference.
+	AnnotationZones = keyPrefix + "tpu-provisioner-zones"
+	// AnnotationLocality is the locality of the node pool, LocalityZonal or
+	// LocalityRegional.
+	AnnotationLocality = keyPrefix + "tpu-provisioner-locality"
+
+	// AnnotationAutoUpgrade and AnnotationAutoRepair ("true" or "false")
+	// override whether the nodes are automatically upgraded and repaired.
+	AnnotationAutoUpgrade = keyPrefix + "tpu-provisioner-auto-upgrade"
+	AnnotationAutoRepair  = keyPrefix + "tpu-provisioner-auto-repair"
+
+	// AnnotationSkipProvisioning ("true") is the default annotation that
+	// exempts a Pod from triggering node pool creation, for example a Pod
+	// that waits for a reserved node pool.
+	AnnotationSkipProvisioning = keyPrefix + "tpu-provisioner-skip"
+	// AnnotationForceRecreate is a request ID (any value, for example a
+	// timestamp) that makes the provisioner drain and delete the node pool
+	// of the Pod, so that it is created again. Each request ID is handled
+	// once, see AnnotationForceRecreateDone.
+	AnnotationForceRecreate = keyPrefix + "tpu-provisioner-force-recreate"
+	// AnnotationIdleTimeout is a duration (for example "2h") that overrides
+	// how long the node pool must be idle before the garbage collector
+	// deletes it. Invalid values are ignored with a warning event.
+	AnnotationIdleTimeout = keyPrefix + "tpu-provisioner-idle-timeout"
+)
+
+// Annotations that can be set on Namespaces.
+const (
+	// AnnotationNamespaceEnabled ("true") allows Pods in the Namespace to
+	// trigger node pool creation even if the Namespace is not allowed by the
+	// provisioner's Namespace allow/deny lists.
+	AnnotationNamespaceEnabled = keyPrefix + "tpu-provisioner-enabled"
+	// AnnotationProvisioningPaused ("true") on the provisioner's pause
+	// Namespace halts node pool creation cluster-wide.
+	AnnotationProvisioningPaused = keyPrefix + "tpu-provisioner-paused"
+)
+
+// Annotations that the provisioner sets on Pods to record provisioning state.
+const (
+	// AnnotationLastQuotaFailure is the time (RFC 3339) at which creating a
+	// node pool for the Pod last failed due to exhausted quota. The Pod is
+	// not retried until the quota retry interval has passed since then.
+	AnnotationLastQuotaFailure = keyPrefix + "tpu-provisioner-last-quota-failure"
+	// AnnotationNodePoolReady is the time (RFC 3339) at which all Nodes of
+	// the node pool ensured for the Pod became Ready.
+	AnnotationNodePoolReady = keyPrefix + "tpu-provisioner-node-pool-ready"
+	// AnnotationNodePoolOperation is the name of the cloud operation that
+	// created the node pool for the Pod.
+	AnnotationNodePoolOperation = keyPrefix + "tpu-provisioner-node-pool-operation"
+	// AnnotationNodePoolOperationStarted is the time (RFC 3339) at which the
+	// node pool operation was started, while it is still being polled.
+	AnnotationNodePoolOperationStarted = keyPrefix + "tpu-provisioner-node-pool-operation-started"
+	// AnnotationProvisioningAttempts is the number of times that ensuring the
+	// node pool for the Pod failed with a permanent error.
+	// AnnotationLastProvisioningFailure is the time (RFC 3339) and
+	// AnnotationLastProvisioningError the message of the last such failure.
+	AnnotationProvisioningAttempts    = keyPrefix + "tpu-provisioner-provisioning-attempts"
+	AnnotationLastProvisioningFailure = keyPrefix + "tpu-provisioner-last-provisioning-failure"
+	AnnotationLastProvisioningError   = keyPrefix + "tpu-provisioner-last-provisioning-error"
+	// AnnotationEstimatedHourlyCost is the estimated hourly cost of the node
+	// pool for the Pod, in the currency of the price table, see PriceTable.
+	AnnotationEstimatedHourlyCost = keyPrefix + "tpu-provisioner-estimated-hourly-cost"
+	// AnnotationNodePoolName is the name of the node pool for the Pod if it
+	// differs from the preferred name, which was taken by another node pool,
+	// see Provider.NodePoolNameForPod.
+	AnnotationNodePoolName = keyPrefix + "tpu-provisioner-node-pool-name"
+	// AnnotationNodePoolZone is the zone that the node pool for the Pod was
+	// last created in, unset for regional node pools.
+	AnnotationNodePoolZone = keyPrefix + "tpu-provisioner-node-pool-zone"
+	// AnnotationProvisioningStarted is the time (RFC 3339) at which the node
+	// pool for the Pod was first ensured, while a provisioning timeout
+	// applies. AnnotationProvisioningTimedOut is the time at which
+	// provisioning was abandoned because the node pool was not Ready in
+	// time.
+	AnnotationProvisioningStarted  = keyPrefix + "tpu-provisioner-provisioning-started"
+	AnnotationProvisioningTimedOut = keyPrefix + "tpu-provisioner-provisioning-timed-out"
+	// AnnotationExcludedZones is a comma-separated list of zones that node
+	// pools for the Pod timed out in, which are no longer tried.
+	AnnotationExcludedZones = keyPrefix + "tpu-provisioner-excluded-zones"
+	// AnnotationForceRecreateDone is the ID of the last force recreate
+	// request of the Pod that was handled. The AnnotationForceRecreate
+	// annotation is removed once its request is handled.
+	AnnotationForceRecreateDone = keyPrefix + "tpu-provisioner-force-recreate-done"
+)
+
+// Annotations that can be set on Nodes.
+const (
+	// AnnotationDeleteNodePool ("true") on any Node of a node pool created by
+	// the provisioner makes it drain and delete the node pool right away,
+	// without waiting for it to be idle.
+	AnnotationDeleteNodePool = keyPrefix + "tpu-provisioner-delete"
+)
+
+// Annotations that the provisioner sets on Nodes.
+const (
+	// AnnotationCordoned is the time (RFC 3339) at which the provisioner
+	// cordoned the Node to drain it before deleting its node pool. Only Nodes
+	// with this annotation are uncordoned again if the node pool is kept.
+	AnnotationCordoned = keyPrefix + "tpu-provisioner-cordoned"
+	// AnnotationRecreating is the ID of the force recreate request that the
+	// node pool of the Node is being drained and deleted for, see
+	// AnnotationForceRecreate.
+	AnnotationRecreating = keyPrefix + "tpu-provisioner-recreating"
+)
+
+// Labels and annotations that JobSet sets on the Pods it creates.
+const (
+	JobSetNameLabel          = "jobset.sigs.k8s.io/jobset-name"
+	JobSetReplicatedJobLabel = "jobset.sigs.k8s.io/replicatedjob-name"
+	JobSetJobIndexLabel      = "jobset.sigs.k8s.io/job-index"
+	JobSetJobKeyAnnotation   = "jobset.sigs.k8s.io/job-key"
+)
+
+// GCP resource labels applied to every node pool created by this provisioner.
+// GCP label keys may not contain "/" or ".", so these differ from the
+// Kubernetes node labels above.
+const (
+	ResourceLabelNodepoolManager = "nodepool-manager"
+	ResourceLabelParentNamespace = "tpu-provisioner-parent-namespace"
+	// ResourceLabelJobSetName is the name of the JobSet that the node pool
+	// was created for, if any.
+	ResourceLabelJobSetName = "tpu-provisioner-jobset-name"
+	// ResourceLabelCreatedAt is the time (Unix seconds) at which the
+	// provisioner created the node pool.
+	ResourceLabelCreatedAt = "tpu-provisioner-created-at"
+	// ResourceLabelSpecHash is a hash of the spec that the provisioner
+	// created the node pool with, see nodePoolSpecHash.
+	ResourceLabelSpecHash = "tpu-provisioner-spec-hash"
+	// ResourceLabelWarmSpecHash is the hash of the spec of a warm node pool
+	// that Pods must match to claim it, see warmSpecHash.
+	ResourceLabelWarmSpecHash = "tpu-provisioner-warm-spec-hash"
+)
+
+// maxGCPLabelLength is the maximum length of GCP resource label keys and values.
+const maxGCPLabelLength = 63
+
+var (
+	gcpLabelKeyRegexp    = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+	invalidGCPLabelChars = regexp.MustCompile(`[^a-z0-9_-]`)
+	invalidLabelChars    = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+)
+
+// sanitizeLabelValue converts an arbitrary string into a valid Kubernetes
+// label value: invalid characters are replaced with "-" and the result is
+// truncated to 63 characters.
+func sanitizeLabelValue(value string) string {
+	value = invalidLabelChars.ReplaceAllString(value, "-")
+	if len(value) > validation.LabelValueMaxLength {
+		value = value[:validation.LabelValueMaxLength]
+	}
+	return strings.Trim(value, "-_.")
+}
+
+// sanitizeGCPLabel converts a Kubernetes label key and value into a GCP
+// resource label. It returns false if the result still does not satisfy GCP
+// label constraints.
+func sanitizeGCPLabel(key, value string) (string, string, bool) {
+	key = invalidGCPLabelChars.ReplaceAllString(strings.ToLower(key), "_")
+	value = invalidGCPLabelChars.ReplaceAllString(strings.ToLower(value), "_")
+	if len(key) > maxGCPLabelLength || len(value) > maxGCPLabelLength || !gcpLabelKeyRegexp.MatchString(key) {
+		return "", "", false
+	}
+	return key, value, true
+}
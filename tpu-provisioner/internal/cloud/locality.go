@@ -0,0 +1,66 @@
+package cloud
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Node pool localities, see localityForPod.
+const (
+	// LocalityZonal node pools are created in a single zone, see
+	// zonesForPod.
+	LocalityZonal = "zonal"
+	// LocalityRegional node pools spread their nodes over several zones:
+	// the configured zones, or the cluster's default node locations if
+	// none are configured.
+	LocalityRegional = "regional"
+)
+
+// ValidateLocality returns an error if l is not a known locality. Empty
+// means LocalityZonal.
+func ValidateLocality(l string) error {
+	switch l {
+	case "", LocalityZonal, LocalityRegional:
+		return nil
+	}
+	return fmt.Errorf("unknown locality %q, must be %q or %q", l, LocalityZonal, LocalityRegional)
+}
+
+// localityForPod returns the locality of the node pool for the Pod. The
+// AnnotationLocality annotation takes precedence over the cluster's
+// NodePoolLocality.
+func (g *GKE) localityForPod(p *corev1.Pod) (string, error) {
+	l := g.ClusterContext.NodePoolLocality
+	if v, ok := p.Annotations[AnnotationLocality]; ok {
+		l = v
+	}
+	if err := ValidateLocality(l); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidNodePoolConfig, err)
+	}
+	if l == "" {
+		return LocalityZonal, nil
+	}
+	return l, nil
+}
+
+// locationsForPod returns the node locations of the node pool for the Pod,
+// given its zones in order of preference. Multi-host TPU slices must be
+// zonal: their hosts are connected by the interconnect of a single zone.
+func (g *GKE) locationsForPod(p *corev1.Pod, zones []string, multiHostTPU bool) ([]string, error) {
+	locality, err := g.localityForPod(p)
+	if err != nil {
+		return nil, err
+	}
+	if locality == LocalityZonal {
+		return zones[:1], nil
+	}
+	if multiHostTPU {
+		return nil, fmt.Errorf("%w: multi-host TPU slices cannot be created as %s node pools", ErrIncompatibleLocality, locality)
+	}
+	if _, ok := p.Annotations[AnnotationZones]; ok || len(g.ClusterContext.NodeZones) > 0 {
+		return zones, nil
+	}
+	// GKE uses the default node locations of the cluster.
+	return nil, nil
+}
@@ -0,0 +1,99 @@
+package cloud
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestGKE_locationsForPod(t *testing.T) {
+	zones := []string{"us-central2-b", "us-central2-c"}
+
+	cases := []struct {
+		name         string
+		ctx          GKEContext
+		annotations  map[string]string
+		multiHostTPU bool
+		exp          []string
+		err          error
+	}{
+		{
+			name: "zonal by default",
+			ctx:  GKEContext{NodeZones: zones},
+			exp:  zones[:1],
+		},
+		{
+			name: "regional",
+			ctx:  GKEContext{NodeZones: zones, NodePoolLocality: LocalityRegional},
+			exp:  zones,
+		},
+		{
+			name: "regional without zones uses cluster locations",
+			ctx:  GKEContext{NodeZone: "us-central2-b", NodePoolLocality: LocalityRegional},
+		},
+		{
+			name:        "regional annotation",
+			ctx:         GKEContext{NodeZones: zones},
+			annotations: map[string]string{AnnotationLocality: LocalityRegional, AnnotationZones: "us-central2-b"},
+			exp:         zones,
+		},
+		{
+			name:        "zonal annotation overrides regional default",
+			ctx:         GKEContext{NodeZones: zones, NodePoolLocality: LocalityRegional},
+			annotations: map[string]string{AnnotationLocality: LocalityZonal},
+			exp:         zones[:1],
+		},
+		{
+			name:         "multi-host zonal",
+			ctx:          GKEContext{NodeZones: zones},
+			multiHostTPU: true,
+			exp:          zones[:1],
+		},
+		{
+			name:         "multi-host regional",
+			ctx:          GKEContext{NodeZones: zones, NodePoolLocality: LocalityRegional},
+			multiHostTPU: true,
+			err:          ErrIncompatibleLocality,
+		},
+		{
+			name:        "unknown locality",
+			ctx:         GKEContext{NodeZones: zones},
+			annotations: map[string]string{AnnotationLocality: "multi-region"},
+			err:         ErrInvalidNodePoolConfig,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := &GKE{ClusterContext: c.ctx}
+			p := &corev1.Pod{}
+			p.Annotations = c.annotations
+			got, err := g.locationsForPod(p, zones, c.multiHostTPU)
+			if c.err != nil {
+				if !errors.Is(err, c.err) {
+					t.Fatalf("expected %v, got: %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, c.exp) {
+				t.Fatalf("expected: %v, got: %v", c.exp, got)
+			}
+		})
+	}
+}
+
+func TestValidateLocality(t *testing.T) {
+	for _, l := range []string{"", LocalityZonal, LocalityRegional} {
+		if err := ValidateLocality(l); err != nil {
+			t.Errorf("%q: unexpected error: %v", l, err)
+		}
+	}
+	if err := ValidateLocality("Regional"); err == nil {
+		t.Errorf("expected an error for an unknown locality")
+	}
+}
@@ -0,0 +1,73 @@
+package cloud
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// releaseChannelNone is the release channel of clusters that are not
+// enrolled in one.
+const releaseChannelNone = "UNSPECIFIED"
+
+// ValidateNodeManagement returns ErrNodeManagementConflict if auto-upgrade is
+// disabled for a cluster that is enrolled in a release channel: GKE always
+// upgrades the nodes of such clusters.
+func ValidateNodeManagement(releaseChannel string, autoUpgrade bool) error {
+	if autoUpgrade || releaseChannel == "" || strings.EqualFold(releaseChannel, releaseChannelNone) {
+		return nil
+	}
+	return fmt.Errorf("%w: auto-upgrade cannot be disabled in release channel %v", ErrNodeManagementConflict, releaseChannel)
+}
+
+// managementForPod returns the auto-upgrade and auto-repair settings of the
+// node pool for the Pod. The AnnotationAutoUpgrade and AnnotationAutoRepair
+// annotations take precedence over the cluster defaults.
+func (g *GKE) managementForPod(p *corev1.Pod) (*containerv1beta1.NodeManagement, error) {
+	m := &containerv1beta1.NodeManagement{
+		AutoUpgrade: !g.ClusterContext.DisableNodeAutoUpgrade,
+		AutoRepair:  !g.ClusterContext.DisableNodeAutoRepair,
+	}
+	for annotation, field := range map[string]*bool{
+		AnnotationAutoUpgrade: &m.AutoUpgrade,
+		AnnotationAutoRepair:  &m.AutoRepair,
+	} {
+		v, ok := p.Annotations[annotation]
+		if !ok {
+			continue
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: parsing %v annotation: %v", ErrInvalidNodePoolConfig, annotation, err)
+		}
+		*field = b
+	}
+	if err := ValidateNodeManagement(g.ClusterContext.ReleaseChannel, m.AutoUpgrade); err != nil {
+		return nil, err
+	}
+	// false is omitted from the request unless it is forced, and GKE would
+	// apply its default instead.
+	m.ForceSendFields = []string{"AutoUpgrade", "AutoRepair"}
+	return m, nil
+}
+
+// isNodeManagementError matches errors such as:
+// "Auto_upgrade must be true when release_channel REGULAR is set."
+func isNodeManagementError(err error, np *containerv1beta1.NodePool) bool {
+	if np.Management == nil || (np.Management.AutoUpgrade && np.Management.AutoRepair) {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	if !strings.Contains(msg, "release channel") && !strings.Contains(msg, "release_channel") {
+		return false
+	}
+	for _, s := range []string{"auto_upgrade", "auto-upgrade", "autoupgrade", "auto_repair", "auto-repair", "autorepair"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package cloud
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestGKE_managementForPod(t *testing.T) {
+	cases := []struct {
+		name        string
+		ctx         GKEContext
+		annotations map[string]string
+		autoUpgrade bool
+		autoRepair  bool
+		err         error
+	}{
+		{
+			name:        "defaults",
+			autoUpgrade: true,
+			autoRepair:  true,
+		},
+		{
+			name:       "cluster disables auto-upgrade",
+			ctx:        GKEContext{DisableNodeAutoUpgrade: true},
+			autoRepair: true,
+		},
+		{
+			name:        "annotations",
+			ctx:         GKEContext{DisableNodeAutoUpgrade: true},
+			annotations: map[string]string{AnnotationAutoUpgrade: "true", AnnotationAutoRepair: "false"},
+			autoUpgrade: true,
+		},
+		{
+			name:        "invalid annotation",
+			annotations: map[string]string{AnnotationAutoRepair: "sometimes"},
+			err:         ErrInvalidNodePoolConfig,
+		},
+		{
+			name:        "release channel",
+			ctx:         GKEContext{ReleaseChannel: "REGULAR"},
+			annotations: map[string]string{AnnotationAutoUpgrade: "false"},
+			err:         ErrNodeManagementConflict,
+		},
+		{
+			name:        "no release channel",
+			ctx:         GKEContext{ReleaseChannel: "UNSPECIFIED"},
+			annotations: map[string]string{AnnotationAutoUpgrade: "false"},
+			autoRepair:  true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := &GKE{ClusterContext: c.ctx}
+			p := &corev1.Pod{}
+			p.Annotations = c.annotations
+			m, err := g.managementForPod(p)
+			if c.err != nil {
+				if !errors.Is(err, c.err) {
+					t.Fatalf("expected error %v, got: %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if m.AutoUpgrade != c.autoUpgrade || m.AutoRepair != c.autoRepair {
+				t.Fatalf("expected autoUpgrade=%v autoRepair=%v, got: %+v", c.autoUpgrade, c.autoRepair, m)
+			}
+			// Disabled settings must be sent to GKE.
+			body, err := m.MarshalJSON()
+			if err != nil {
+				t.Fatalf("marshaling: %v", err)
+			}
+			if !strings.Contains(string(body), `"autoUpgrade":`) || !strings.Contains(string(body), `"autoRepair":`) {
+				t.Fatalf("expected both fields to be sent, got: %s", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package cloud
+
+import (
+	"fmt"
+	"math/bits"
+	"net"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// Default max pods per node is 110, but a lower value is necessary for large scale clusters,
+	// otherwise we'll run out of IP Space and provisioning will fail.
+	// 15 pods per node will work for small and large cluster sizes, given the TPU constraint of
+	// 1 pod per TPU node + kube-system pods
+	defaultMaxPodsPerNode = 15
+
+	// GKE allows between 8 and 256 Pods per node, see
+	// https://cloud.google.com/kubernetes-engine/docs/how-to/flexible-pod-cidr.
+	minMaxPodsPerNode = 8
+	maxMaxPodsPerNode = 256
+)
+
+// ValidateMaxPodsPerNode returns ErrInvalidMaxPodsPerNode if n is outside of
+// the range that GKE allows or, if podCIDR (the cluster's Pod IPv4 range, for
+// example "10.4.0.0/14") is set, the Pod range of a single node does not fit
+// into it.
+func ValidateMaxPodsPerNode(n int64, podCIDR string) error {
+	if n < minMaxPodsPerNode || n > maxMaxPodsPerNode {
+		return fmt.Errorf("%w: %d must be between %d and %d", ErrInvalidMaxPodsPerNode, n, minMaxPodsPerNode, maxMaxPodsPerNode)
+	}
+	if podCIDR == "" {
+		return nil
+	}
+	_, ipNet, err := net.ParseCIDR(podCIDR)
+	if err != nil {
+		return fmt.Errorf("%w: invalid cluster Pod CIDR %q: %v", ErrInvalidMaxPodsPerNode, podCIDR, err)
+	}
+	clusterSize, _ := ipNet.Mask.Size()
+	if nodeSize := nodePodRangeSize(n); nodeSize < clusterSize {
+		return fmt.Errorf("%w: %d Pods per node need a /%d range per node, larger than the cluster Pod range %s",
+			ErrInvalidMaxPodsPerNode, n, nodeSize, podCIDR)
+	}
+	return nil
+}
+
+// nodePodRangeSize returns the prefix length of the Pod range that GKE
+// assigns to each node for n Pods: the smallest range with at least twice as
+// many addresses as Pods.
+func nodePodRangeSize(n int64) int {
+	return 32 - bits.Len64(uint64(2*n-1))
+}
+
+// maxPodsPerNodeForPod returns the maximum number of Pods per node of the
+// node pool for the Pod. The AnnotationMaxPodsPerNode annotation takes
+// precedence over the accelerator defaults and then the cluster default.
+// The cluster Pod range is only checked without podRange, nodes on an
+// additional Pod range take their Pod IPs from that range.
+func (g *GKE) maxPodsPerNodeForPod(p *corev1.Pod, podRange string) (int64, error) {
+	n := int64(g.ClusterContext.NodeMaxPodsPerNode)
+	if n == 0 {
+		n = defaultMaxPodsPerNode
+	}
+	if d, ok := g.ClusterContext.acceleratorDefaultsForPod(p); ok && d.MaxPodsPerNode != 0 {
+		n = d.MaxPodsPerNode
+	}
+	if v, ok := p.Annotations[AnnotationMaxPodsPerNode]; ok {
+		var err error
+		n, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: parsing %v annotation: %v", ErrInvalidMaxPodsPerNode, AnnotationMaxPodsPerNode, err)
+		}
+	}
+	podCIDR := g.ClusterContext.ClusterPodCIDR
+	if podRange != "" {
+		podCIDR = ""
+	}
+	if err := ValidateMaxPodsPerNode(n, podCIDR); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,80 @@
+package cloud
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestValidateMaxPodsPerNode(t *testing.T) {
+	cases := []struct {
+		n       int64
+		podCIDR string
+		valid   bool
+	}{
+		{n: 15, valid: true},
+		{n: 8, podCIDR: "10.4.0.0/28", valid: true},
+		{n: 256, podCIDR: "10.4.0.0/14", valid: true},
+		{n: 7},
+		{n: 257},
+		{n: 15, podCIDR: "10.4.0.0/28"},
+		{n: 110, podCIDR: "10.4.0.0/25"},
+		{n: 15, podCIDR: "10.4.0.0"},
+	}
+	for _, c := range cases {
+		err := ValidateMaxPodsPerNode(c.n, c.podCIDR)
+		if c.valid && err != nil {
+			t.Fatalf("%d in %q: unexpected error: %v", c.n, c.podCIDR, err)
+		}
+		if !c.valid && !errors.Is(err, ErrInvalidMaxPodsPerNode) {
+			t.Fatalf("%d in %q: expected %v, got: %v", c.n, c.podCIDR, ErrInvalidMaxPodsPerNode, err)
+		}
+	}
+}
+
+func TestNodePodRangeSize(t *testing.T) {
+	for n, exp := range map[int64]int{8: 28, 9: 27, 15: 27, 16: 27, 17: 26, 110: 24, 256: 23} {
+		if got := nodePodRangeSize(n); got != exp {
+			t.Fatalf("%d Pods: expected /%d, got: /%d", n, exp, got)
+		}
+	}
+}
+
+func TestGKE_maxPodsPerNodeForPod(t *testing.T) {
+	g := &GKE{ClusterContext: GKEContext{
+		ClusterPodCIDR: "10.4.0.0/24",
+		AcceleratorDefaults: map[string]AcceleratorDefaults{
+			V5ePodSliceAccelerator: {MaxPodsPerNode: 32},
+		},
+	}}
+	p := &corev1.Pod{Spec: corev1.PodSpec{NodeSelector: map[string]string{GKEAcceleratorNodeSelector: V4PodSliceAccelerator}}}
+
+	if n, err := g.maxPodsPerNodeForPod(p, ""); err != nil || n != defaultMaxPodsPerNode {
+		t.Fatalf("expected the default of %d, got: %d, %v", defaultMaxPodsPerNode, n, err)
+	}
+	g.ClusterContext.NodeMaxPodsPerNode = 24
+	if n, err := g.maxPodsPerNodeForPod(p, ""); err != nil || n != 24 {
+		t.Fatalf("expected the cluster default, got: %d, %v", n, err)
+	}
+	p.Spec.NodeSelector[GKEAcceleratorNodeSelector] = V5ePodSliceAccelerator
+	if n, err := g.maxPodsPerNodeForPod(p, ""); err != nil || n != 32 {
+		t.Fatalf("expected the accelerator default, got: %d, %v", n, err)
+	}
+	p.Annotations = map[string]string{AnnotationMaxPodsPerNode: "64"}
+	if n, err := g.maxPodsPerNodeForPod(p, ""); err != nil || n != 64 {
+		t.Fatalf("expected the annotation, got: %d, %v", n, err)
+	}
+
+	p.Annotations[AnnotationMaxPodsPerNode] = "256"
+	if _, err := g.maxPodsPerNodeForPod(p, ""); !errors.Is(err, ErrInvalidMaxPodsPerNode) {
+		t.Fatalf("expected %v for a /23 per node in a /24 cluster range, got: %v", ErrInvalidMaxPodsPerNode, err)
+	}
+	if n, err := g.maxPodsPerNodeForPod(p, "tpu-pods"); err != nil || n != 256 {
+		t.Fatalf("expected the cluster range not to be checked with a Pod range, got: %d, %v", n, err)
+	}
+	p.Annotations[AnnotationMaxPodsPerNode] = "many"
+	if _, err := g.maxPodsPerNodeForPod(p, ""); !errors.Is(err, ErrInvalidMaxPodsPerNode) {
+		t.Fatalf("expected %v, got: %v", ErrInvalidMaxPodsPerNode, err)
+	}
+}
@@ -2,11 +2,27 @@ package cloud
 
 import corev1 "k8s.io/api/core/v1"
 
-// Mock is useful for local development or debugging purposes to understand what
-// the controller would do without it doing anything.
+// Mock is a noop provider, useful for local development or debugging purposes
+// to understand what the controller would do without it doing anything. It
+// only logs the calls that are made.
 type Mock struct{}
 
 // TODO: Find a better mock node pool label key.
-func (m *Mock) NodePoolLabelKey() string                 { return "kubernetes.io/os" }
-func (m *Mock) EnsureNodePoolForPod(*corev1.Pod) error   { return nil }
-func (m *Mock) DeleteNodePoolForNode(*corev1.Node) error { return nil }
+func (m *Mock) NodePoolLabelKey() string { return "kubernetes.io/os" }
+func (m *Mock) NodePoolOwner() Owner     { return DefaultOwner }
+func (m *Mock) EnsureNodePoolForPod(p *corev1.Pod, r NodePoolRequest) (*NodePoolOperation, error) {
+	log.Info("noop: ensure node pool for pod", "pod", p.Namespace+"/"+p.Name, "nodeCount", r.NodeCount, "topology", r.Topology)
+	return nil, nil
+}
+func (m *Mock) PollNodePoolOperation(string) (bool, error)               { return true, nil }
+func (m *Mock) NodePoolNameForPod(*corev1.Pod) (string, error)           { return "mock", nil }
+func (m *Mock) NodePoolTaintsForPod(*corev1.Pod) ([]corev1.Taint, error) { return nil, nil }
+func (m *Mock) DeleteNodePoolForNode(n *corev1.Node) error {
+	log.Info("noop: delete node pool for node", "node", n.Name)
+	return nil
+}
+func (m *Mock) ListNodePools() ([]NodePoolInfo, error) { return nil, nil }
+func (m *Mock) DeleteNodePool(name string) error {
+	log.Info("noop: delete node pool", "name", name)
+	return nil
+}
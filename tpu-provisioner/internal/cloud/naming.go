@@ -0,0 +1,121 @@
+package cloud
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxNodePoolNameLength is the maximum length GKE allows for node pool names.
+const maxNodePoolNameLength = 40
+
+var (
+	nodePoolNameRegexp       = regexp.MustCompile(`^[a-z]([-a-z0-9]*[a-z0-9])?$`)
+	invalidNodePoolNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+)
+
+// NodePoolNameData is the data that node pool name templates are evaluated
+// against.
+type NodePoolNameData struct {
+	Namespace  string
+	PodName    string
+	Labels     map[string]string
+	JobSetName string
+	OwnerKind  string
+	OwnerName  string
+	// Suffix is derived from the owner of the Pod and is stable for the
+	// lifetime of the workload. Include it to keep names unique.
+	Suffix string
+}
+
+// ParseNodePoolNameTemplate parses a node pool name template and verifies
+// that it produces a valid node pool name.
+func ParseNodePoolNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("nodepool-name").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing template: %w", err)
+	}
+	name, err := executeNodePoolNameTemplate(tmpl, NodePoolNameData{
+		Namespace:  "default",
+		PodName:    "example-pod",
+		Labels:     map[string]string{},
+		JobSetName: "example-jobset",
+		OwnerKind:  "job",
+		OwnerName:  "example-job",
+		Suffix:     "0123456789ab",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := validateNodePoolName(name); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func executeNodePoolNameTemplate(tmpl *template.Template, data NodePoolNameData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("executing template: %w", err)
+	}
+	return sanitizeNodePoolName(buf.String()), nil
+}
+
+func nodePoolNameDataForPod(p *corev1.Pod, ownerID string) NodePoolNameData {
+	data := NodePoolNameData{
+		Namespace:  p.Namespace,
+		PodName:    p.Name,
+		Labels:     p.Labels,
+		JobSetName: p.Labels[JobSetNameLabel],
+		Suffix:     ownerID[0:12],
+	}
+	if ref := metav1.GetControllerOf(p); ref != nil {
+		data.OwnerKind = strings.ToLower(ref.Kind)
+		data.OwnerName = ref.Name
+	}
+	return data
+}
+
+// sanitizeNodePoolName converts an arbitrary string into a name that satisfies
+// GKE node pool naming constraints. Names that are too long are truncated
+// deterministically by replacing the tail with a hash of the full name.
+func sanitizeNodePoolName(name string) string {
+	name = strings.ToLower(name)
+	name = invalidNodePoolNameChars.ReplaceAllString(name, "-")
+	name = strings.Trim(name, "-")
+	if name == "" || name[0] < 'a' || name[0] > 'z' {
+		name = "np-" + name
+	}
+	if len(name) > maxNodePoolNameLength {
+		name = withHashSuffix(name, name)
+	}
+	return strings.TrimRight(name, "-")
+}
+
+// withHashSuffix appends a short hash of key to name, truncating name so that
+// the result fits within the maximum node pool name length.
+func withHashSuffix(name, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	suffix := "-" + hex.EncodeToString(sum[:])[0:8]
+	if max := maxNodePoolNameLength - len(suffix); len(name) > max {
+		name = strings.TrimRight(name[0:max], "-")
+	}
+	return name + suffix
+}
+
+func validateNodePoolName(name string) error {
+	if len(name) > maxNodePoolNameLength {
+		return fmt.Errorf("node pool name %q exceeds %v characters", name, maxNodePoolNameLength)
+	}
+	if !nodePoolNameRegexp.MatchString(name) {
+		return fmt.Errorf("node pool name %q must consist of lowercase alphanumeric characters and dashes and start with a letter", name)
+	}
+	return nil
+}
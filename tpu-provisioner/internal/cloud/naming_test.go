@@ -0,0 +1,83 @@
+package cloud
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_sanitizeNodePoolName(t *testing.T) {
+	cases := []struct {
+		in  string
+		out string
+	}{
+		{
+			in:  "team-a-train-0123456789ab",
+			out: "team-a-train-0123456789ab",
+		},
+		{
+			in:  "Team_A/Train",
+			out: "team-a-train",
+		},
+		{
+			in:  "0-starts-with-digit",
+			out: "np-0-starts-with-digit",
+		},
+		{
+			in:  "--trailing--",
+			out: "trailing",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.in, func(t *testing.T) {
+			if exp, got := c.out, sanitizeNodePoolName(c.in); exp != got {
+				t.Fatalf("expected: %v, got: %v", exp, got)
+			}
+		})
+	}
+
+	t.Run("truncation", func(t *testing.T) {
+		long := strings.Repeat("abcdefghij", 6)
+		name := sanitizeNodePoolName(long)
+		if err := validateNodePoolName(name); err != nil {
+			t.Fatalf("expected valid name, got: %v", err)
+		}
+		if name != sanitizeNodePoolName(long) {
+			t.Fatalf("expected truncation to be deterministic")
+		}
+		if name == sanitizeNodePoolName(long+"x") {
+			t.Fatalf("expected different names for different inputs")
+		}
+	})
+}
+
+func TestParseNodePoolNameTemplate(t *testing.T) {
+	cases := []struct {
+		tmpl string
+		err  bool
+	}{
+		{
+			tmpl: "{{ .Namespace }}-{{ .JobSetName }}-{{ .Suffix }}",
+		},
+		{
+			tmpl: `{{ index .Labels "team" }}-{{ .Suffix }}`,
+		},
+		{
+			tmpl: "{{ .Namespace ",
+			err:  true,
+		},
+		{
+			tmpl: "{{ .NotAField }}",
+			err:  true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.tmpl, func(t *testing.T) {
+			_, err := ParseNodePoolNameTemplate(c.tmpl)
+			if (err != nil) != c.err {
+				t.Fatalf("error: expected: %v, got: %v", c.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// nodeNetwork is the network configuration of a node pool. Network and
+// Subnetwork are attached to the nodes as an additional network, PodRange is
+// the name of the secondary range that Pod IPs are allocated from (of
+// Subnetwork if set, of the cluster subnetwork otherwise).
+type nodeNetwork struct {
+	Network    string
+	Subnetwork string
+	PodRange   string
+}
+
+// networkForPod returns the network configuration for the node pool of the
+// Pod. The AnnotationNetwork, AnnotationSubnetwork and AnnotationPodRange
+// annotations take precedence over the cluster defaults, each individually.
+// Network names are qualified with the network project, see
+// GKEContext.NetworkProjectID.
+func (g *GKE) networkForPod(p *corev1.Pod) (nodeNetwork, error) {
+	n := nodeNetwork{
+		Network:    g.ClusterContext.NodeNetwork,
+		Subnetwork: g.ClusterContext.NodeSubnetwork,
+		PodRange:   g.ClusterContext.NodePodRange,
+	}
+	if v, ok := p.Annotations[AnnotationNetwork]; ok {
+		n.Network = v
+	}
+	if v, ok := p.Annotations[AnnotationSubnetwork]; ok {
+		n.Subnetwork = v
+	}
+	if v, ok := p.Annotations[AnnotationPodRange]; ok {
+		n.PodRange = v
+	}
+	if err := n.validate(); err != nil {
+		return nodeNetwork{}, err
+	}
+	n.Network, n.Subnetwork = g.ClusterContext.networkPaths(n.Network, n.Subnetwork)
+	return n, nil
+}
+
+func (n nodeNetwork) validate() error {
+	if (n.Network == "") != (n.Subnetwork == "") {
+		return fmt.Errorf("%w: network and subnetwork must be set together", ErrInvalidNetworkConfig)
+	}
+	for _, s := range []string{n.Network, n.Subnetwork, n.PodRange} {
+		if strings.ContainsAny(s, " \t\n") {
+			return fmt.Errorf("%w: invalid name %q", ErrInvalidNetworkConfig, s)
+		}
+	}
+	return nil
+}
+
+// nodeNetworkConfig returns the node pool network configuration, or nil to
+// use the cluster defaults.
+func (n nodeNetwork) nodeNetworkConfig() *containerv1beta1.NodeNetworkConfig {
+	if n == (nodeNetwork{}) {
+		return nil
+	}
+	if n.Subnetwork == "" {
+		return &containerv1beta1.NodeNetworkConfig{PodRange: n.PodRange}
+	}
+	cfg := &containerv1beta1.NodeNetworkConfig{
+		AdditionalNodeNetworkConfigs: []*containerv1beta1.AdditionalNodeNetworkConfig{
+			{Network: n.Network, Subnetwork: n.Subnetwork},
+		},
+	}
+	if n.PodRange != "" {
+		cfg.AdditionalPodNetworkConfigs = []*containerv1beta1.AdditionalPodNetworkConfig{
+			{Subnetwork: n.Subnetwork, SecondaryPodRange: n.PodRange},
+		}
+	}
+	return cfg
+}
+
+// checkNetworkExists returns ErrInvalidNetworkConfig if the subnetwork (and
+// secondary Pod range) of the node network is not one of the usable
+// subnetworks. Nothing is checked if no subnetwork is set.
+func checkNetworkExists(n nodeNetwork, usable []*containerv1beta1.UsableSubnetwork) error {
+	if n.Subnetwork == "" {
+		return nil
+	}
+	for _, s := range usable {
+		if !resourceNameMatches(s.Subnetwork, n.Subnetwork) || !resourceNameMatches(s.Network, n.Network) {
+			continue
+		}
+		if n.PodRange == "" {
+			return nil
+		}
+		for _, r := range s.SecondaryIpRanges {
+			if r.RangeName == n.PodRange {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: subnetwork %q has no secondary range %q", ErrInvalidNetworkConfig, n.Subnetwork, n.PodRange)
+	}
+	return fmt.Errorf("%w: subnetwork %q of network %q not found", ErrInvalidNetworkConfig, n.Subnetwork, n.Network)
+}
+
+// resourceNameMatches returns true if name is either the full resource path
+// or the last path element of the resource.
+func resourceNameMatches(resource, name string) bool {
+	return resource == name || strings.HasSuffix(resource, "/"+name)
+}
+
+// checkNetwork verifies that the subnetwork of the node network exists. If
+// the usable subnetworks cannot be listed (for example due to missing
+// permissions) the check is skipped and the create call reports any error.
+func (g *GKE) checkNetwork(n nodeNetwork) error {
+	if n.Subnetwork == "" || g.Service == nil {
+		return nil
+	}
+	var usable []*containerv1beta1.UsableSubnetwork
+	err := g.Service.Projects.Aggregated.UsableSubnetworks.List("projects/"+g.ClusterContext.ProjectID).
+		Pages(context.Background(), func(resp *containerv1beta1.ListUsableSubnetworksResponse) error {
+			usable = append(usable, resp.Subnetworks...)
+			return nil
+		})
+	if err != nil {
+		log.Error(err, "listing usable subnetworks, skipping network check", "subnetwork", n.Subnetwork)
+		return nil
+	}
+	return checkNetworkExists(n, usable)
+}
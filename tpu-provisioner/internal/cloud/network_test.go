@@ -0,0 +1,103 @@
+package cloud
+
+import (
+	"errors"
+	"testing"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestGKE_networkForPod(t *testing.T) {
+	g := &GKE{ClusterContext: GKEContext{NodeNetwork: "vpc", NodeSubnetwork: "tpu", NodePodRange: "pods"}}
+
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		exp         nodeNetwork
+		err         bool
+	}{
+		{name: "defaults", exp: nodeNetwork{Network: "vpc", Subnetwork: "tpu", PodRange: "pods"}},
+		{
+			name:        "annotations",
+			annotations: map[string]string{AnnotationNetwork: "other-vpc", AnnotationSubnetwork: "isolated", AnnotationPodRange: "isolated-pods"},
+			exp:         nodeNetwork{Network: "other-vpc", Subnetwork: "isolated", PodRange: "isolated-pods"},
+		},
+		{
+			name:        "subnetwork without network",
+			annotations: map[string]string{AnnotationNetwork: ""},
+			err:         true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := &corev1.Pod{}
+			p.Annotations = c.annotations
+			n, err := g.networkForPod(p)
+			if c.err {
+				if !errors.Is(err, ErrInvalidNetworkConfig) {
+					t.Fatalf("expected ErrInvalidNetworkConfig, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n != c.exp {
+				t.Fatalf("expected: %+v, got: %+v", c.exp, n)
+			}
+		})
+	}
+}
+
+func Test_nodeNetworkConfig(t *testing.T) {
+	if cfg := (nodeNetwork{}).nodeNetworkConfig(); cfg != nil {
+		t.Fatalf("expected nil config, got: %+v", cfg)
+	}
+	if cfg := (nodeNetwork{PodRange: "pods"}).nodeNetworkConfig(); cfg.PodRange != "pods" || cfg.AdditionalNodeNetworkConfigs != nil {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	cfg := nodeNetwork{Network: "vpc", Subnetwork: "tpu", PodRange: "pods"}.nodeNetworkConfig()
+	if cfg.PodRange != "" || len(cfg.AdditionalNodeNetworkConfigs) != 1 || len(cfg.AdditionalPodNetworkConfigs) != 1 {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	if n := cfg.AdditionalNodeNetworkConfigs[0]; n.Network != "vpc" || n.Subnetwork != "tpu" {
+		t.Fatalf("unexpected node network: %+v", n)
+	}
+	if n := cfg.AdditionalPodNetworkConfigs[0]; n.Subnetwork != "tpu" || n.SecondaryPodRange != "pods" {
+		t.Fatalf("unexpected pod network: %+v", n)
+	}
+}
+
+func Test_checkNetworkExists(t *testing.T) {
+	usable := []*containerv1beta1.UsableSubnetwork{
+		{
+			Network:           "projects/my-project/global/networks/vpc",
+			Subnetwork:        "projects/my-project/regions/us-central2/subnetworks/tpu",
+			SecondaryIpRanges: []*containerv1beta1.UsableSubnetworkSecondaryRange{{RangeName: "pods"}},
+		},
+	}
+
+	cases := []struct {
+		name string
+		n    nodeNetwork
+		err  bool
+	}{
+		{name: "no subnetwork", n: nodeNetwork{PodRange: "anything"}},
+		{name: "short names", n: nodeNetwork{Network: "vpc", Subnetwork: "tpu", PodRange: "pods"}},
+		{name: "full names", n: nodeNetwork{Network: usable[0].Network, Subnetwork: usable[0].Subnetwork}},
+		{name: "missing subnetwork", n: nodeNetwork{Network: "vpc", Subnetwork: "gpu"}, err: true},
+		{name: "wrong network", n: nodeNetwork{Network: "other", Subnetwork: "tpu"}, err: true},
+		{name: "missing range", n: nodeNetwork{Network: "vpc", Subnetwork: "tpu", PodRange: "services"}, err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := checkNetworkExists(c.n, usable)
+			if c.err != errors.Is(err, ErrInvalidNetworkConfig) {
+				t.Fatalf("expected error: %v, got: %v", c.err, err)
+			}
+		})
+	}
+}
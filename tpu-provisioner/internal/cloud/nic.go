@@ -0,0 +1,172 @@
+package cloud
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Machine type prefixes whose nodes only boot with gVNIC, see
+// https://cloud.google.com/compute/docs/networking/using-gvnic.
+var gvnicRequiredMachinePrefixes = []string{"ct5p-", "ct6e-", "a3-", "c3-", "c3d-", "h3-"}
+
+// maxNodeNetworkInterfaces is the number of network interfaces that
+// Compute Engine allows per VM. One of them is the interface of the cluster
+// network.
+const maxNodeNetworkInterfaces = 8
+
+// maxAdditionalNetworksByMachinePrefix limits the number of additional node
+// networks of machine types that support fewer interfaces than
+// maxNodeNetworkInterfaces. TPU v4 hosts support a single additional network.
+var maxAdditionalNetworksByMachinePrefix = map[string]int{
+	"ct4p-": 1,
+}
+
+// NetworkInterface is an additional network interface of the nodes: the VPC
+// network and subnetwork it is attached to.
+type NetworkInterface struct {
+	Network    string
+	Subnetwork string
+}
+
+// nodeNICs is the network interface configuration of a node pool. Gvnic
+// enables the gVNIC driver, Additional are the network interfaces attached
+// after the additional network of nodeNetwork.
+type nodeNICs struct {
+	Gvnic      bool
+	Additional []NetworkInterface
+}
+
+// ParseNetworkInterfaces parses additional network interfaces in the format
+// of the AnnotationAdditionalNetworks annotation: a comma separated list of
+// network:subnetwork pairs, for example "data-1:data-1-sub,data-2:data-2-sub".
+func ParseNetworkInterfaces(spec string) ([]NetworkInterface, error) {
+	var nics []NetworkInterface
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		network, subnetwork, ok := strings.Cut(s, ":")
+		if !ok || network == "" || subnetwork == "" || strings.ContainsAny(s, " \t\n") {
+			return nil, fmt.Errorf("%w: invalid network interface %q, must be network:subnetwork", ErrInvalidNetworkInterfaceConfig, s)
+		}
+		nics = append(nics, NetworkInterface{Network: network, Subnetwork: subnetwork})
+	}
+	return nics, nil
+}
+
+// ValidateNetworkInterfaces returns ErrInvalidNetworkInterfaceConfig if the
+// network interfaces are not supported by the machine type: gvnic is
+// explicitly disabled (false) on a machine type that requires gVNIC or for
+// more than one additional network, or there are more additional networks (including the one of the network
+// configuration, if any) than the machine type supports. Nothing is checked
+// against an empty machineType. A nil gvnic is not checked, gVNIC is
+// enabled where needed.
+func ValidateNetworkInterfaces(gvnic *bool, additionalNetworks int, machineType string) error {
+	if machineType == "" {
+		return nil
+	}
+	if gvnic != nil && !*gvnic {
+		if hasAnyPrefix(machineType, gvnicRequiredMachinePrefixes) {
+			return fmt.Errorf("%w: machine type %q requires gVNIC", ErrInvalidNetworkInterfaceConfig, machineType)
+		}
+		if additionalNetworks > 1 {
+			return fmt.Errorf("%w: %d additional networks require gVNIC", ErrInvalidNetworkInterfaceConfig, additionalNetworks)
+		}
+	}
+	max := maxNodeNetworkInterfaces - 1
+	for prefix, n := range maxAdditionalNetworksByMachinePrefix {
+		if strings.HasPrefix(machineType, prefix) {
+			max = n
+		}
+	}
+	if additionalNetworks > max {
+		return fmt.Errorf("%w: machine type %q supports at most %d additional networks, not %d", ErrInvalidNetworkInterfaceConfig, machineType, max, additionalNetworks)
+	}
+	return nil
+}
+
+// networkInterfacesForPod returns the network interface configuration of
+// the node pool for the Pod, whose network configuration is n. The
+// AnnotationGvnic and AnnotationAdditionalNetworks annotations take
+// precedence over the accelerator defaults and then the cluster defaults.
+// Unless it is explicitly disabled, gVNIC is enabled for more than one
+// additional network. GKE enables it on machine types that require it by
+// itself, it is not set for them to keep the spec of existing node pools.
+func (g *GKE) networkInterfacesForPod(p *corev1.Pod, machineType string, n nodeNetwork) (nodeNICs, error) {
+	var gvnic *bool
+	if g.ClusterContext.NodeGvnic {
+		gvnic = &g.ClusterContext.NodeGvnic
+	}
+	additional := g.ClusterContext.NodeAdditionalNetworks
+	if d, ok := g.ClusterContext.acceleratorDefaultsForPod(p); ok {
+		if d.Gvnic != nil {
+			gvnic = d.Gvnic
+		}
+		if d.AdditionalNetworks != "" {
+			nics, err := ParseNetworkInterfaces(d.AdditionalNetworks)
+			if err != nil {
+				return nodeNICs{}, err
+			}
+			additional = nics
+		}
+	}
+	if v, ok := p.Annotations[AnnotationGvnic]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nodeNICs{}, fmt.Errorf("%w: parsing %v annotation: %v", ErrInvalidNetworkInterfaceConfig, AnnotationGvnic, err)
+		}
+		gvnic = &b
+	}
+	if v, ok := p.Annotations[AnnotationAdditionalNetworks]; ok {
+		nics, err := ParseNetworkInterfaces(v)
+		if err != nil {
+			return nodeNICs{}, err
+		}
+		additional = nics
+	}
+
+	count := len(additional)
+	if n.Subnetwork != "" {
+		count++
+	}
+	if err := ValidateNetworkInterfaces(gvnic, count, machineType); err != nil {
+		return nodeNICs{}, err
+	}
+	nics := nodeNICs{Gvnic: count > 1}
+	if gvnic != nil {
+		nics.Gvnic = *gvnic
+	}
+	for _, nic := range additional {
+		nic.Network, nic.Subnetwork = g.ClusterContext.networkPaths(nic.Network, nic.Subnetwork)
+		nics.Additional = append(nics.Additional, nic)
+	}
+	return nics, nil
+}
+
+// gvnic returns the Gvnic node config, nil if gVNIC is not enabled.
+func (nics nodeNICs) gvnic() *containerv1beta1.VirtualNIC {
+	if !nics.Gvnic {
+		return nil
+	}
+	return &containerv1beta1.VirtualNIC{Enabled: true}
+}
+
+// apply attaches the additional network interfaces to the node pool, after
+// the additional network of its network configuration.
+func (nics nodeNICs) apply(np *containerv1beta1.NodePool) {
+	if len(nics.Additional) == 0 {
+		return
+	}
+	if np.NetworkConfig == nil {
+		np.NetworkConfig = &containerv1beta1.NodeNetworkConfig{}
+	}
+	for _, nic := range nics.Additional {
+		np.NetworkConfig.AdditionalNodeNetworkConfigs = append(np.NetworkConfig.AdditionalNodeNetworkConfigs,
+			&containerv1beta1.AdditionalNodeNetworkConfig{Network: nic.Network, Subnetwork: nic.Subnetwork})
+	}
+}
@@ -0,0 +1,116 @@
+package cloud
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParseNetworkInterfaces(t *testing.T) {
+	nics, err := ParseNetworkInterfaces(" data-1:data-1-sub, projects/host/global/networks/data-2:data-2-sub,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exp := []NetworkInterface{
+		{Network: "data-1", Subnetwork: "data-1-sub"},
+		{Network: "projects/host/global/networks/data-2", Subnetwork: "data-2-sub"},
+	}
+	if !reflect.DeepEqual(nics, exp) {
+		t.Fatalf("expected: %+v, got: %+v", exp, nics)
+	}
+	for _, spec := range []string{"data-1", "data-1:", ":data-1-sub", "data 1:sub"} {
+		if _, err := ParseNetworkInterfaces(spec); !errors.Is(err, ErrInvalidNetworkInterfaceConfig) {
+			t.Errorf("%q: expected %v, got: %v", spec, ErrInvalidNetworkInterfaceConfig, err)
+		}
+	}
+}
+
+func TestValidateNetworkInterfaces(t *testing.T) {
+	enabled, disabled := true, false
+	cases := []struct {
+		name        string
+		gvnic       *bool
+		networks    int
+		machineType string
+		valid       bool
+	}{
+		{name: "defaults", machineType: "ct5lp-hightpu-4t", valid: true},
+		{name: "without machine type", gvnic: &disabled, networks: 9, valid: true},
+		{name: "gVNIC", gvnic: &enabled, machineType: "ct4p-hightpu-4t", valid: true},
+		{name: "gVNIC disabled", gvnic: &disabled, networks: 1, machineType: "ct5lp-hightpu-4t", valid: true},
+		{name: "gVNIC required by machine type", gvnic: &disabled, machineType: "ct5p-hightpu-4t"},
+		{name: "gVNIC required by networks", gvnic: &disabled, networks: 2, machineType: "ct5lp-hightpu-4t"},
+		{name: "multi-NIC", networks: 7, machineType: "ct6e-standard-4t", valid: true},
+		{name: "too many networks", networks: 8, machineType: "ct6e-standard-4t"},
+		{name: "TPU v4 single network", networks: 1, machineType: "ct4p-hightpu-4t", valid: true},
+		{name: "TPU v4 multi-NIC", networks: 2, machineType: "ct4p-hightpu-4t"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateNetworkInterfaces(c.gvnic, c.networks, c.machineType)
+			if c.valid && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !c.valid && !errors.Is(err, ErrInvalidNetworkInterfaceConfig) {
+				t.Fatalf("expected %v, got: %v", ErrInvalidNetworkInterfaceConfig, err)
+			}
+		})
+	}
+}
+
+func TestGKE_networkInterfacesForPod(t *testing.T) {
+	const accel = "tpu-v5-lite-podslice"
+	disabled := false
+	g := &GKE{ClusterContext: GKEContext{
+		ProjectID:              "cluster-project",
+		NetworkProjectID:       "host-project",
+		ClusterLocation:        "us-east5",
+		NodeGvnic:              true,
+		NodeAdditionalNetworks: []NetworkInterface{{Network: "default-data", Subnetwork: "default-data-sub"}},
+		AcceleratorDefaults:    map[string]AcceleratorDefaults{accel: {Gvnic: &disabled}},
+	}}
+	p := &corev1.Pod{}
+	p.Spec.NodeSelector = map[string]string{GKEAcceleratorNodeSelector: accel}
+
+	nics, err := g.networkInterfacesForPod(p, "ct5lp-hightpu-4t", nodeNetwork{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exp := nodeNICs{Additional: []NetworkInterface{{
+		Network:    "projects/host-project/global/networks/default-data",
+		Subnetwork: "projects/host-project/regions/us-east5/subnetworks/default-data-sub",
+	}}}
+	if !reflect.DeepEqual(nics, exp) || nics.gvnic() != nil {
+		t.Fatalf("expected: %+v, got: %+v", exp, nics)
+	}
+	if _, err := g.networkInterfacesForPod(p, "ct5lp-hightpu-4t", nodeNetwork{Network: "data", Subnetwork: "data-sub"}); !errors.Is(err, ErrInvalidNetworkInterfaceConfig) {
+		t.Fatalf("expected %v for multi-NIC with gVNIC disabled, got: %v", ErrInvalidNetworkInterfaceConfig, err)
+	}
+
+	p.Annotations = map[string]string{AnnotationGvnic: "true", AnnotationAdditionalNetworks: "data-1:data-1-sub,data-2:data-2-sub"}
+	nics, err = g.networkInterfacesForPod(p, "ct5lp-hightpu-4t", nodeNetwork{Network: "data", Subnetwork: "data-sub"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	np := &containerv1beta1.NodePool{NetworkConfig: nodeNetwork{Network: "data", Subnetwork: "data-sub"}.nodeNetworkConfig()}
+	nics.apply(np)
+	if !nics.Gvnic || additionalNetworkCount(np) != 3 || np.NetworkConfig.AdditionalNodeNetworkConfigs[2].Network != "projects/host-project/global/networks/data-2" {
+		t.Fatalf("expected gVNIC and three additional networks, got: %+v", np.NetworkConfig.AdditionalNodeNetworkConfigs)
+	}
+
+	p.Annotations = map[string]string{AnnotationGvnic: "maybe"}
+	if _, err := g.networkInterfacesForPod(p, "ct5lp-hightpu-4t", nodeNetwork{}); !errors.Is(err, ErrInvalidNetworkInterfaceConfig) {
+		t.Fatalf("expected %v for an invalid annotation, got: %v", ErrInvalidNetworkInterfaceConfig, err)
+	}
+
+	// Multi-NIC gets gVNIC without it being requested.
+	g.ClusterContext.NodeGvnic = false
+	g.ClusterContext.AcceleratorDefaults = nil
+	p.Annotations = nil
+	if nics, err := g.networkInterfacesForPod(p, "ct5p-hightpu-4t", nodeNetwork{Network: "data", Subnetwork: "data-sub"}); err != nil || !nics.Gvnic {
+		t.Fatalf("expected gVNIC to be enabled, got: %+v, %v", nics, err)
+	}
+}
@@ -0,0 +1,68 @@
+package cloud
+
+import (
+	"fmt"
+	"os"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// NodePoolClass is a named node pool template that Pods select with the
+// AnnotationNodePoolClass annotation. Zero values keep the cluster defaults.
+type NodePoolClass struct {
+	DiskSizeGB     int64    `json:"diskSizeGb,omitempty"`
+	DiskType       string   `json:"diskType,omitempty"`
+	ImageType      string   `json:"imageType,omitempty"`
+	ServiceAccount string   `json:"serviceAccount,omitempty"`
+	OAuthScopes    []string `json:"oauthScopes,omitempty"`
+	// Labels are added to the node labels of the node pool. Labels derived
+	// from the Pod take precedence.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// LoadNodePoolClasses reads node pool classes from a YAML file (usually a
+// mounted ConfigMap) that maps class names to NodePoolClass, for example:
+//
+//	training-large:
+//	  diskSizeGb: 500
+//	  diskType: pd-ssd
+//	  serviceAccount: training@my-project.iam.gserviceaccount.com
+func LoadNodePoolClasses(path string) (map[string]NodePoolClass, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading node pool classes: %w", err)
+	}
+	var classes map[string]NodePoolClass
+	if err := yaml.UnmarshalStrict(data, &classes); err != nil {
+		return nil, fmt.Errorf("parsing node pool classes from %s: %w", path, err)
+	}
+	return classes, nil
+}
+
+// nodePoolClassForPod returns the class selected by the Pod, or nil if the
+// Pod does not select one.
+func (c GKEContext) nodePoolClassForPod(p *corev1.Pod) (*NodePoolClass, error) {
+	name, ok := p.Annotations[AnnotationNodePoolClass]
+	if !ok || name == "" {
+		return nil, nil
+	}
+	class, ok := c.NodePoolClasses[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownNodePoolClass, name)
+	}
+	return &class, nil
+}
+
+// apply overrides the node config with the values that are set in the class.
+// Labels already in the config are kept. The boot disk is handled by
+// bootDiskForPod, the image type by imageTypeForPod, the service account and
+// OAuth scopes by identityForPod.
+func (c *NodePoolClass) apply(cfg *containerv1beta1.NodeConfig) {
+	for k, v := range c.Labels {
+		if _, ok := cfg.Labels[k]; !ok {
+			cfg.Labels[k] = v
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package cloud
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLoadNodePoolClasses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "classes.yaml")
+	data := `
+training-large:
+  diskSizeGb: 500
+  diskType: pd-ssd
+  oauthScopes: ["https://www.googleapis.com/auth/cloud-platform"]
+  labels:
+    profile: training
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	classes, err := LoadNodePoolClasses(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c, ok := classes["training-large"]
+	if !ok {
+		t.Fatalf("expected class training-large, got: %v", classes)
+	}
+	if c.DiskSizeGB != 500 || c.DiskType != "pd-ssd" || len(c.OAuthScopes) != 1 || c.Labels["profile"] != "training" {
+		t.Fatalf("unexpected class: %+v", c)
+	}
+
+	if err := os.WriteFile(path, []byte("training-large:\n  diskSize: 500\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadNodePoolClasses(path); err == nil {
+		t.Fatalf("expected error for unknown field")
+	}
+}
+
+func TestGKE_nodePoolForPod_class(t *testing.T) {
+	isController := true
+	g := &GKE{ClusterContext: GKEContext{
+		NodeServiceAccount: "default@my-project.iam.gserviceaccount.com",
+		NodePoolClasses: map[string]NodePoolClass{
+			"training-large": {
+				DiskSizeGB:     500,
+				ImageType:      "COS_CONTAINERD",
+				ServiceAccount: "training@my-project.iam.gserviceaccount.com",
+				Labels: map[string]string{
+					"profile":            "training",
+					LabelNodepoolManager: "someone-else",
+				},
+			},
+		},
+	}}
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "train-0",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Job", Name: "train", UID: "0123456789abcdef", Controller: &isController},
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{
+				GKETPUNodeSelector:         "2x2x1",
+				GKEAcceleratorNodeSelector: V4PodSliceAccelerator,
+			},
+			Containers: []corev1.Container{
+				{
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{GoogleTPUResource: resource.MustParse("4")},
+					},
+				},
+			},
+		},
+	}
+
+	np, err := g.nodePoolForPod("np", p, NodePoolRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exp, got := g.ClusterContext.NodeServiceAccount, np.Config.ServiceAccount; exp != got {
+		t.Fatalf("without class: service account: expected: %v, got: %v", exp, got)
+	}
+
+	p.Annotations = map[string]string{AnnotationNodePoolClass: "training-large"}
+	np, err = g.nodePoolForPod("np", p, NodePoolRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := np.Config
+	if cfg.DiskSizeGb != 500 || cfg.ImageType != "COS_CONTAINERD" || cfg.ServiceAccount != "training@my-project.iam.gserviceaccount.com" {
+		t.Fatalf("class not applied: %+v", cfg)
+	}
+	if exp, got := "training", cfg.Labels["profile"]; exp != got {
+		t.Fatalf("label: expected: %v, got: %v", exp, got)
+	}
+	if exp, got := LabelNodepoolManagerTPUPodinator, cfg.Labels[LabelNodepoolManager]; exp != got {
+		t.Fatalf("manager label: expected: %v, got: %v", exp, got)
+	}
+
+	p.Annotations[AnnotationNodePoolClass] = "does-not-exist"
+	if _, err := g.EnsureNodePoolForPod(p, NodePoolRequest{}); !errors.Is(err, ErrUnknownNodePoolClass) {
+		t.Fatalf("expected ErrUnknownNodePoolClass, got: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package cloud
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+)
+
+// defaultNodePoolCountTTL is used when GKE.NodePoolCountTTL is not set.
+const defaultNodePoolCountTTL = 30 * time.Second
+
+// nodePoolCounter enforces a maximum number of provisioner-managed node pools.
+// The count is listed from the provider and cached for ttl. Creates that are
+// in flight are counted as well, so that concurrent callers cannot exceed the
+// limit together.
+type nodePoolCounter struct {
+	max   int
+	ttl   time.Duration
+	owner Owner
+	list  func() ([]*containerv1beta1.NodePool, error)
+
+	mtx       sync.Mutex
+	count     int
+	fetchedAt time.Time
+	inFlight  int
+}
+
+// reserve returns ErrNodePoolLimitReached if creating another node pool would
+// exceed the limit. Otherwise, the caller must call release once the create
+// attempt has finished.
+func (c *nodePoolCounter) reserve() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.fetchedAt.IsZero() || time.Since(c.fetchedAt) > c.ttl {
+		nps, err := c.list()
+		if err != nil {
+			return fmt.Errorf("listing node pools: %w", err)
+		}
+		c.count = countManagedNodePools(nps, c.owner)
+		c.fetchedAt = time.Now()
+	}
+	if c.count+c.inFlight >= c.max {
+		return fmt.Errorf("%w: %d of %d node pools in use", ErrNodePoolLimitReached, c.count+c.inFlight, c.max)
+	}
+	c.inFlight++
+	return nil
+}
+
+// release marks a reserved create attempt as finished.
+func (c *nodePoolCounter) release(created bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.inFlight--
+	if created {
+		c.count++
+	}
+}
+
+// invalidate forces the next reserve to list node pools again.
+func (c *nodePoolCounter) invalidate() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.fetchedAt = time.Time{}
+}
+
+// countManagedNodePools returns the number of node pools that were created by
+// the owner.
+func countManagedNodePools(nps []*containerv1beta1.NodePool, owner Owner) int {
+	var n int
+	for _, np := range nps {
+		if owner.ownsNodePool(np) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,60 @@
+package cloud
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+)
+
+func Test_nodePoolCounter(t *testing.T) {
+	managed := &containerv1beta1.NodePool{Config: &containerv1beta1.NodeConfig{
+		Labels: map[string]string{LabelNodepoolManager: LabelNodepoolManagerTPUPodinator},
+	}}
+	unmanaged := &containerv1beta1.NodePool{Config: &containerv1beta1.NodeConfig{}}
+
+	var lists int
+	c := &nodePoolCounter{
+		max:   3,
+		ttl:   time.Hour,
+		owner: DefaultOwner,
+		list: func() ([]*containerv1beta1.NodePool, error) {
+			lists++
+			return []*containerv1beta1.NodePool{managed, unmanaged, unmanaged}, nil
+		},
+	}
+
+	if err := c.reserve(); err != nil {
+		t.Fatalf("first reserve: unexpected error: %v", err)
+	}
+	if err := c.reserve(); err != nil {
+		t.Fatalf("second reserve: unexpected error: %v", err)
+	}
+	// 1 managed + 2 in flight.
+	if err := c.reserve(); !errors.Is(err, ErrNodePoolLimitReached) {
+		t.Fatalf("third reserve: expected ErrNodePoolLimitReached, got: %v", err)
+	}
+	if exp, got := 1, lists; exp != got {
+		t.Fatalf("lists: expected: %v, got: %v", exp, got)
+	}
+
+	c.release(false)
+	if err := c.reserve(); err != nil {
+		t.Fatalf("reserve after failed create: unexpected error: %v", err)
+	}
+	c.release(true)
+	c.release(true)
+	// 3 managed.
+	if err := c.reserve(); !errors.Is(err, ErrNodePoolLimitReached) {
+		t.Fatalf("reserve after creates: expected ErrNodePoolLimitReached, got: %v", err)
+	}
+
+	c.invalidate()
+	if err := c.reserve(); err != nil {
+		t.Fatalf("reserve after invalidate: unexpected error: %v", err)
+	}
+	if exp, got := 2, lists; exp != got {
+		t.Fatalf("lists: expected: %v, got: %v", exp, got)
+	}
+}
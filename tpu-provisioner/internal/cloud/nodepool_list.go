@@ -0,0 +1,97 @@
+package cloud
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+)
+
+// defaultNodePoolListTTL is used when GKE.NodePoolListTTL is not set.
+const defaultNodePoolListTTL = 10 * time.Second
+
+// maxNodePoolListPages guards against a server that keeps returning page
+// tokens.
+const maxNodePoolListPages = 100
+
+// nodePoolPageFunc fetches the page of node pools for the page token ("" for
+// the first page) and returns the token of the next page, or "" if it was
+// the last page.
+type nodePoolPageFunc func(pageToken string) ([]*containerv1beta1.NodePool, string, error)
+
+// listAllNodePools pages through all node pools.
+func listAllNodePools(fetch nodePoolPageFunc) ([]*containerv1beta1.NodePool, error) {
+	var (
+		all   []*containerv1beta1.NodePool
+		token string
+	)
+	for i := 0; i < maxNodePoolListPages; i++ {
+		nps, next, err := fetch(token)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, nps...)
+		if next == "" {
+			return all, nil
+		}
+		token = next
+	}
+	return nil, fmt.Errorf("listing node pools: more than %d pages", maxNodePoolListPages)
+}
+
+// managedNodePoolInfos returns the node pools that were created by the owner.
+func managedNodePoolInfos(nps []*containerv1beta1.NodePool, owner Owner) []NodePoolInfo {
+	var out []NodePoolInfo
+	for _, np := range nps {
+		if !owner.ownsNodePool(np) {
+			continue
+		}
+		info := NodePoolInfo{
+			Name:       np.Name,
+			NodeCount:  int(np.InitialNodeCount),
+			Autoscaled: np.Autoscaling != nil && np.Autoscaling.Enabled,
+			Status:     np.Status,
+		}
+		if v, ok := np.Config.ResourceLabels[ResourceLabelCreatedAt]; ok {
+			if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+				info.CreatedAt = time.Unix(sec, 0)
+			}
+		}
+		out = append(out, info)
+	}
+	return out
+}
+
+// nodePoolListCache caches the result of listing managed node pools for ttl.
+type nodePoolListCache struct {
+	ttl   time.Duration
+	owner Owner
+	list  func() ([]*containerv1beta1.NodePool, error)
+
+	mtx       sync.Mutex
+	pools     []NodePoolInfo
+	fetchedAt time.Time
+}
+
+func (c *nodePoolListCache) get() ([]NodePoolInfo, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.fetchedAt.IsZero() || time.Since(c.fetchedAt) > c.ttl {
+		nps, err := c.list()
+		if err != nil {
+			return nil, fmt.Errorf("listing node pools: %w", err)
+		}
+		c.pools = managedNodePoolInfos(nps, c.owner)
+		c.fetchedAt = time.Now()
+	}
+	return append([]NodePoolInfo(nil), c.pools...), nil
+}
+
+// invalidate forces the next get to list node pools again.
+func (c *nodePoolListCache) invalidate() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.fetchedAt = time.Time{}
+}
@@ -0,0 +1,105 @@
+package cloud
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+)
+
+func Test_listAllNodePools(t *testing.T) {
+	pages := map[string]struct {
+		pools []*containerv1beta1.NodePool
+		next  string
+	}{
+		"":   {pools: []*containerv1beta1.NodePool{{Name: "a"}, {Name: "b"}}, next: "p2"},
+		"p2": {pools: []*containerv1beta1.NodePool{{Name: "c"}}, next: "p3"},
+		"p3": {pools: []*containerv1beta1.NodePool{{Name: "d"}}},
+	}
+	var tokens []string
+	nps, err := listAllNodePools(func(token string) ([]*containerv1beta1.NodePool, string, error) {
+		tokens = append(tokens, token)
+		p := pages[token]
+		return p.pools, p.next, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exp, got := 4, len(nps); exp != got {
+		t.Fatalf("node pools: expected: %v, got: %v", exp, got)
+	}
+	if exp, got := 3, len(tokens); exp != got {
+		t.Fatalf("pages: expected: %v, got: %v (%v)", exp, got, tokens)
+	}
+
+	errBoom := errors.New("boom")
+	if _, err := listAllNodePools(func(token string) ([]*containerv1beta1.NodePool, string, error) {
+		if token == "p2" {
+			return nil, "", errBoom
+		}
+		return nil, "p2", nil
+	}); !errors.Is(err, errBoom) {
+		t.Fatalf("expected page error, got: %v", err)
+	}
+
+	if _, err := listAllNodePools(func(string) ([]*containerv1beta1.NodePool, string, error) {
+		return nil, "again", nil
+	}); err == nil {
+		t.Fatalf("expected error for endless pages")
+	}
+}
+
+func Test_managedNodePoolInfos(t *testing.T) {
+	managedLabels := map[string]string{LabelNodepoolManager: LabelNodepoolManagerTPUPodinator}
+	nps := []*containerv1beta1.NodePool{
+		{
+			Name:             "managed",
+			InitialNodeCount: 4,
+			Config: &containerv1beta1.NodeConfig{
+				Labels:         managedLabels,
+				ResourceLabels: map[string]string{ResourceLabelCreatedAt: "1700000000"},
+			},
+		},
+		{Name: "managed-old", InitialNodeCount: 1, Config: &containerv1beta1.NodeConfig{Labels: managedLabels}},
+		{Name: "default-pool", InitialNodeCount: 3, Config: &containerv1beta1.NodeConfig{}},
+		{Name: "no-config"},
+	}
+
+	infos := managedNodePoolInfos(nps, DefaultOwner)
+	if exp, got := 2, len(infos); exp != got {
+		t.Fatalf("node pools: expected: %v, got: %v (%+v)", exp, got, infos)
+	}
+	if infos[0].Name != "managed" || infos[0].NodeCount != 4 || !infos[0].CreatedAt.Equal(time.Unix(1700000000, 0)) {
+		t.Fatalf("unexpected info: %+v", infos[0])
+	}
+	if infos[1].Name != "managed-old" || !infos[1].CreatedAt.IsZero() {
+		t.Fatalf("unexpected info: %+v", infos[1])
+	}
+}
+
+func Test_nodePoolListCache(t *testing.T) {
+	var lists int
+	c := &nodePoolListCache{
+		ttl: time.Hour,
+		list: func() ([]*containerv1beta1.NodePool, error) {
+			lists++
+			return nil, nil
+		},
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := c.get(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if exp, got := 1, lists; exp != got {
+		t.Fatalf("lists: expected: %v, got: %v", exp, got)
+	}
+	c.invalidate()
+	if _, err := c.get(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exp, got := 2, lists; exp != got {
+		t.Fatalf("lists after invalidate: expected: %v, got: %v", exp, got)
+	}
+}
@@ -0,0 +1,61 @@
+package cloud
+
+import (
+	"fmt"
+	"regexp"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Owner is the label that marks the node pools that a provisioner instance
+// created and manages. Key is a GCP resource label key; on the node pool's
+// Nodes the label key has the "google.com/" prefix. Provisioner instances that
+// share a cluster must use different owners (for example different values) so
+// that they never touch each other's node pools.
+type Owner struct {
+	Key   string
+	Value string
+}
+
+// DefaultOwner is the owner used when none is configured.
+var DefaultOwner = Owner{Key: ResourceLabelNodepoolManager, Value: LabelNodepoolManagerTPUPodinator}
+
+var gcpLabelValueRegexp = regexp.MustCompile(`^[a-z0-9_-]*$`)
+
+// ValidateOwner returns an error if the key or value of the owner is not a
+// valid GCP resource label, or if they are not valid as a Node label.
+func ValidateOwner(o Owner) error {
+	if len(o.Key) > maxGCPLabelLength || !gcpLabelKeyRegexp.MatchString(o.Key) {
+		return fmt.Errorf("owner label key %q must start with a lowercase letter and only contain lowercase letters, digits, '_' and '-' (at most %d characters)", o.Key, maxGCPLabelLength)
+	}
+	if o.Value == "" || len(o.Value) > maxGCPLabelLength || !gcpLabelValueRegexp.MatchString(o.Value) {
+		return fmt.Errorf("owner label value %q must only contain lowercase letters, digits, '_' and '-' (1 to %d characters)", o.Value, maxGCPLabelLength)
+	}
+	if errs := validation.IsQualifiedName(o.NodeLabelKey()); len(errs) > 0 {
+		return fmt.Errorf("owner label key %q is not a valid Node label key: %v", o.Key, errs)
+	}
+	if errs := validation.IsValidLabelValue(o.Value); len(errs) > 0 {
+		return fmt.Errorf("owner label value %q is not a valid Node label value: %v", o.Value, errs)
+	}
+	return nil
+}
+
+// NodeLabelKey returns the key of the owner label on Nodes.
+func (o Owner) NodeLabelKey() string { return keyPrefix + o.Key }
+
+// NodeLabels returns the owner label of Nodes, for example to list the Nodes
+// of the owned node pools.
+func (o Owner) NodeLabels() map[string]string {
+	return map[string]string{o.NodeLabelKey(): o.Value}
+}
+
+// Owns returns true if the Node labels carry the owner label.
+func (o Owner) Owns(nodeLabels map[string]string) bool {
+	return nodeLabels[o.NodeLabelKey()] == o.Value
+}
+
+// ownsNodePool returns true if the node pool was created by the owner.
+func (o Owner) ownsNodePool(np *containerv1beta1.NodePool) bool {
+	return np.Config != nil && o.Owns(np.Config.Labels)
+}
@@ -0,0 +1,82 @@
+package cloud
+
+import (
+	"testing"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateOwner(t *testing.T) {
+	cases := []struct {
+		name  string
+		owner Owner
+		valid bool
+	}{
+		{name: "default", owner: DefaultOwner, valid: true},
+		{name: "staging", owner: Owner{Key: "nodepool-manager", Value: "tpu-provisioner-staging"}, valid: true},
+		{name: "empty key", owner: Owner{Value: "tpu-provisioner"}},
+		{name: "empty value", owner: Owner{Key: "nodepool-manager"}},
+		{name: "key with prefix", owner: Owner{Key: "google.com/nodepool-manager", Value: "tpu-provisioner"}},
+		{name: "uppercase value", owner: Owner{Key: "nodepool-manager", Value: "Staging"}},
+		{name: "value not a node label value", owner: Owner{Key: "nodepool-manager", Value: "staging-"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateOwner(c.owner)
+			if c.valid && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !c.valid && err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestGKE_nodePoolForPod_owner(t *testing.T) {
+	isController := true
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "train-0",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Job", Name: "train", UID: "0123456789abcdef", Controller: &isController},
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{
+				GKETPUNodeSelector:         "2x2x1",
+				GKEAcceleratorNodeSelector: V4PodSliceAccelerator,
+			},
+			Containers: []corev1.Container{{
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{GoogleTPUResource: resource.MustParse("4")},
+				},
+			}},
+		},
+	}
+	staging := Owner{Key: "nodepool-manager", Value: "tpu-provisioner-staging"}
+	g := &GKE{ClusterContext: GKEContext{Owner: staging}}
+
+	np, err := g.nodePoolForPod("np", p, NodePoolRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v := np.Config.Labels[LabelNodepoolManager]; v != staging.Value {
+		t.Fatalf("expected the owner node label, got: %q", v)
+	}
+	if v := np.Config.ResourceLabels[staging.Key]; v != staging.Value {
+		t.Fatalf("expected the owner resource label, got: %q", v)
+	}
+	if !staging.ownsNodePool(np) || DefaultOwner.ownsNodePool(np) {
+		t.Fatal("expected the node pool to only be owned by the staging owner")
+	}
+
+	defaultPool := &containerv1beta1.NodePool{Config: &containerv1beta1.NodeConfig{Labels: DefaultOwner.NodeLabels()}}
+	if !g.nameCollides(defaultPool, p) {
+		t.Fatal("expected a node pool of another owner to collide")
+	}
+}
@@ -0,0 +1,109 @@
+package cloud
+
+import (
+	"fmt"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Node labels that the topology constraints of Pods refer to, see
+// PlacementIntentForPod.
+const (
+	ZoneTopologyKey              = "topology.kubernetes.io/zone"
+	GKEPlacementGroupTopologyKey = "cloud.google.com/gke-placement-group"
+)
+
+// PlacementIntent is the placement that the topology constraints of a Pod
+// require from its node pool. The zero value requires nothing.
+type PlacementIntent struct {
+	// Zones, if set, are the zones that the required node affinity (or the
+	// node selector) of the Pod allows.
+	Zones []string
+	// SingleZone requires all Nodes in one zone: the Pod has required Pod
+	// affinity with the ZoneTopologyKey.
+	SingleZone bool
+	// MinZones is the number of zones that a ZoneTopologyKey topology spread
+	// constraint with DoNotSchedule requires (its minDomains), 0 for none.
+	MinZones int
+	// Compact requires all Nodes in one compact placement: the Pod has
+	// required Pod affinity with the GKEPlacementGroupTopologyKey.
+	Compact bool
+}
+
+// PlacementIntentForPod returns the placement that the topology constraints
+// of the Pod require. Pod affinity with the GKENodePoolNameLabel topology key
+// is satisfied by every node pool and ignored.
+func PlacementIntentForPod(p *corev1.Pod) PlacementIntent {
+	var pi PlacementIntent
+	if zone, ok := p.Spec.NodeSelector[ZoneTopologyKey]; ok {
+		pi.Zones = []string{zone}
+	} else if term := acceleratorNodeSelectorTerm(p); term != nil {
+		for _, e := range term.MatchExpressions {
+			if e.Key == ZoneTopologyKey && e.Operator == corev1.NodeSelectorOpIn {
+				pi.Zones = append(pi.Zones, e.Values...)
+			}
+		}
+	}
+	if a := p.Spec.Affinity; a != nil && a.PodAffinity != nil {
+		for _, t := range a.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+			switch t.TopologyKey {
+			case ZoneTopologyKey:
+				pi.SingleZone = true
+			case GKEPlacementGroupTopologyKey:
+				pi.Compact = true
+			}
+		}
+	}
+	for _, c := range p.Spec.TopologySpreadConstraints {
+		if c.TopologyKey == ZoneTopologyKey && c.WhenUnsatisfiable == corev1.DoNotSchedule && c.MinDomains != nil && int(*c.MinDomains) > pi.MinZones {
+			pi.MinZones = int(*c.MinDomains)
+		}
+	}
+	return pi
+}
+
+// zones returns the zones, in order, that the Pod allows, or
+// ErrUnsatisfiableTopology if it allows none of them.
+func (pi PlacementIntent) zones(zones []string) ([]string, error) {
+	if len(pi.Zones) == 0 {
+		return zones, nil
+	}
+	var allowed []string
+	for _, z := range zones {
+		if containsString(pi.Zones, z) {
+			allowed = append(allowed, z)
+		}
+	}
+	if len(allowed) == 0 {
+		return nil, fmt.Errorf("%w: the Pod requires one of the zones %v, the node pool can only be created in %v", ErrUnsatisfiableTopology, pi.Zones, zones)
+	}
+	return allowed, nil
+}
+
+// apply narrows the node locations to one zone and adds a compact placement
+// policy to multi-node node pools as the intent requires. It returns
+// ErrUnsatisfiableTopology if the node pool cannot span MinZones zones.
+// Node pools without locations use the cluster's default node locations,
+// whose number is not known.
+func (pi PlacementIntent) apply(np *containerv1beta1.NodePool, locality string) error {
+	if (pi.SingleZone || pi.Compact) && len(np.Locations) > 1 {
+		np.Locations = np.Locations[:1]
+	}
+	count := len(np.Locations)
+	if locality == LocalityZonal {
+		// Zonal node pools are created in one of the locations.
+		count = 1
+	}
+	if pi.MinZones > 1 && count > 0 && count < pi.MinZones {
+		shape := "a node pool in one zone"
+		if np.PlacementPolicy != nil && np.PlacementPolicy.TpuTopology != "" {
+			shape = "a multi-host TPU slice, which is always in one zone"
+		}
+		return fmt.Errorf("%w: the Pod's topology spread constraint requires %d zones, but its node pool is %s", ErrUnsatisfiableTopology, pi.MinZones, shape)
+	}
+	if pi.Compact && np.PlacementPolicy == nil && np.InitialNodeCount > 1 {
+		np.PlacementPolicy = &containerv1beta1.PlacementPolicy{Type: "COMPACT"}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package cloud
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestPlacementIntentForPod(t *testing.T) {
+	two := int32(2)
+	p := &corev1.Pod{}
+	p.Spec.Affinity = &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{
+				{Key: GKETPUNodeSelector, Operator: corev1.NodeSelectorOpIn, Values: []string{"2x4"}},
+				{Key: ZoneTopologyKey, Operator: corev1.NodeSelectorOpIn, Values: []string{"us-east5-a", "us-east5-b"}},
+			}}},
+		}},
+		PodAffinity: &corev1.PodAffinity{RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+			{TopologyKey: GKENodePoolNameLabel},
+			{TopologyKey: GKEPlacementGroupTopologyKey},
+		}},
+	}
+	p.Spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{
+		{TopologyKey: ZoneTopologyKey, WhenUnsatisfiable: corev1.ScheduleAnyway, MinDomains: &two},
+		{TopologyKey: corev1.LabelHostname, WhenUnsatisfiable: corev1.DoNotSchedule, MinDomains: &two},
+	}
+
+	exp := PlacementIntent{Zones: []string{"us-east5-a", "us-east5-b"}, Compact: true}
+	if got := PlacementIntentForPod(p); !reflect.DeepEqual(got, exp) {
+		t.Fatalf("expected: %+v, got: %+v", exp, got)
+	}
+
+	p.Spec.NodeSelector = map[string]string{ZoneTopologyKey: "us-east5-c"}
+	p.Spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution = []corev1.PodAffinityTerm{{TopologyKey: ZoneTopologyKey}}
+	p.Spec.TopologySpreadConstraints[0].WhenUnsatisfiable = corev1.DoNotSchedule
+	exp = PlacementIntent{Zones: []string{"us-east5-c"}, SingleZone: true, MinZones: 2}
+	if got := PlacementIntentForPod(p); !reflect.DeepEqual(got, exp) {
+		t.Fatalf("expected: %+v, got: %+v", exp, got)
+	}
+}
+
+func TestGKE_nodePoolForPod_placement(t *testing.T) {
+	g := &GKE{ClusterContext: GKEContext{
+		ProjectID: "my-project", ClusterLocation: "us-central2", Cluster: "my-cluster",
+		NodeZones: []string{"us-central2-a", "us-central2-b"},
+	}}
+	p := tagsTestPod(nil)
+
+	np, err := g.nodePoolForPod("tpu-provisioner-train", p, NodePoolRequest{Placement: PlacementIntent{Zones: []string{"us-central2-b"}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(np.Locations, []string{"us-central2-b"}) {
+		t.Fatalf("expected the zone allowed by the Pod, got: %v", np.Locations)
+	}
+
+	for name, pi := range map[string]PlacementIntent{
+		"no allowed zone":  {Zones: []string{"us-east5-a"}},
+		"too few zones":    {MinZones: 2},
+		"single zone pool": {SingleZone: true, MinZones: 3},
+	} {
+		if _, err := g.nodePoolForPod("tpu-provisioner-train", p, NodePoolRequest{Placement: pi}); !errors.Is(err, ErrUnsatisfiableTopology) {
+			t.Errorf("%s: expected %v, got: %v", name, ErrUnsatisfiableTopology, err)
+		}
+	}
+
+	// Single-host node pools of more than one node need a compact
+	// placement policy for Pods that require one placement group.
+	p.Spec.NodeSelector[GKETPUNodeSelector] = "2x2"
+	np, err = g.nodePoolForPod("tpu-provisioner-train", p, NodePoolRequest{NodeCount: 4, Placement: PlacementIntent{Compact: true}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if np.PlacementPolicy == nil || np.PlacementPolicy.Type != "COMPACT" {
+		t.Fatalf("expected a compact placement policy, got: %+v", np.PlacementPolicy)
+	}
+}
@@ -0,0 +1,151 @@
+package cloud
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	"google.golang.org/api/googleapi"
+)
+
+// Roles of the GCP projects that node pools reference resources in, see
+// ProjectPermissionError.
+const (
+	// ProjectRoleNetwork is the (Shared VPC host) project of the additional
+	// network and subnetwork of the nodes.
+	ProjectRoleNetwork = "network"
+	// ProjectRoleReservation is the project of the shared reservation that
+	// the nodes consume.
+	ProjectRoleReservation = "reservation"
+)
+
+// ProjectPermissionError is returned when GKE rejects a node pool because the
+// provisioner or the GKE service agent is not allowed to use a resource in
+// the project of the Role, for example a missing compute.networkUser role on
+// a Shared VPC host project. It matches ErrProjectPermission.
+type ProjectPermissionError struct {
+	// Role is ProjectRoleNetwork or ProjectRoleReservation.
+	Role string
+	// Project is the project of the resource, empty for the cluster
+	// project.
+	Project string
+	Err     error
+}
+
+func (e *ProjectPermissionError) Error() string {
+	project := e.Project
+	if project == "" {
+		project = "of the cluster"
+	}
+	return fmt.Sprintf("%v: %s project %s: %v", ErrProjectPermission, e.Role, project, e.Err)
+}
+
+func (e *ProjectPermissionError) Is(target error) bool {
+	return target == ErrProjectPermission
+}
+
+func (e *ProjectPermissionError) Unwrap() error {
+	return e.Err
+}
+
+// networkProjectID returns NetworkProjectID, or the cluster project if it is
+// not set.
+func (c GKEContext) networkProjectID() string {
+	if c.NetworkProjectID == "" {
+		return c.ProjectID
+	}
+	return c.NetworkProjectID
+}
+
+// reservationProjectID returns ReservationProjectID, or the cluster project
+// if it is not set.
+func (c GKEContext) reservationProjectID() string {
+	if c.ReservationProjectID == "" {
+		return c.ProjectID
+	}
+	return c.ReservationProjectID
+}
+
+// networkPaths returns the network and subnetwork as resource paths in the
+// network project, if it is not the cluster project. Names that already are
+// paths, and empty names, are returned unchanged.
+func (c GKEContext) networkPaths(network, subnetwork string) (string, string) {
+	project := c.networkProjectID()
+	if project == c.ProjectID {
+		return network, subnetwork
+	}
+	if network != "" && !strings.Contains(network, "/") {
+		network = fmt.Sprintf("projects/%s/global/networks/%s", project, network)
+	}
+	if subnetwork != "" && !strings.Contains(subnetwork, "/") {
+		subnetwork = fmt.Sprintf("projects/%s/regions/%s/subnetworks/%s", project, regionOf(c.ClusterLocation), subnetwork)
+	}
+	return network, subnetwork
+}
+
+// reservationPath returns the reservation as a shared reservation path in the
+// reservation project, if it is not the cluster project. Names that already
+// are paths are returned unchanged.
+func (c GKEContext) reservationPath(name string) string {
+	project := c.reservationProjectID()
+	if project == c.ProjectID || strings.Contains(name, "/") {
+		return name
+	}
+	return fmt.Sprintf("projects/%s/reservations/%s", project, name)
+}
+
+// projectOf returns the project of a resource path such as
+// "projects/host-project/global/networks/shared", or "" for a plain name.
+func projectOf(path string) string {
+	if !strings.HasPrefix(path, "projects/") {
+		return ""
+	}
+	project, _, _ := strings.Cut(strings.TrimPrefix(path, "projects/"), "/")
+	return project
+}
+
+// projectPermissionError returns a ProjectPermissionError if err reports that
+// a network or reservation of the node pool may not be used, such as:
+// "googleapi: Error 403: Required 'compute.subnetworks.use' permission for 'projects/host/regions/us-central2/subnetworks/tpu', forbidden"
+// "Permission denied on reservation projects/shared/reservations/v5e."
+// Errors about the node service account or quota are left to
+// isServiceAccountError and isQuotaError.
+func projectPermissionError(err error, np *containerv1beta1.NodePool) *ProjectPermissionError {
+	msg := strings.ToLower(err.Error())
+	if strings.Contains(msg, "service account") || strings.Contains(msg, "quota") {
+		return nil
+	}
+	var gerr *googleapi.Error
+	forbidden := errors.As(err, &gerr) && gerr.Code == http.StatusForbidden
+	if !forbidden && !strings.Contains(msg, "permission") && !strings.Contains(msg, "not authorized") && !strings.Contains(msg, "does not have access") {
+		return nil
+	}
+	if network := additionalNetwork(np); network != nil && (strings.Contains(msg, "network") || strings.Contains(msg, "subnetwork")) {
+		return &ProjectPermissionError{Role: ProjectRoleNetwork, Project: projectOf(network.Subnetwork), Err: err}
+	}
+	if r := np.Config; r != nil && r.ReservationAffinity != nil && r.ReservationAffinity.ConsumeReservationType == "SPECIFIC_RESERVATION" &&
+		len(r.ReservationAffinity.Values) > 0 && strings.Contains(msg, "reservation") {
+		return &ProjectPermissionError{Role: ProjectRoleReservation, Project: projectOf(r.ReservationAffinity.Values[0]), Err: err}
+	}
+	return nil
+}
+
+// additionalNetwork returns the additional node network of the node pool, or
+// nil if it only uses the cluster network.
+func additionalNetwork(np *containerv1beta1.NodePool) *containerv1beta1.AdditionalNodeNetworkConfig {
+	if np.NetworkConfig == nil || len(np.NetworkConfig.AdditionalNodeNetworkConfigs) == 0 {
+		return nil
+	}
+	return np.NetworkConfig.AdditionalNodeNetworkConfigs[0]
+}
+
+// additionalNetworkCount returns the number of additional node networks of
+// the node pool.
+func additionalNetworkCount(np *containerv1beta1.NodePool) int {
+	if np.NetworkConfig == nil {
+		return 0
+	}
+	return len(np.NetworkConfig.AdditionalNodeNetworkConfigs)
+}
@@ -0,0 +1,91 @@
+package cloud
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	"google.golang.org/api/googleapi"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestGKEContext_projectPaths(t *testing.T) {
+	c := GKEContext{ProjectID: "cluster", ClusterLocation: "us-central2-b"}
+	if network, subnetwork := c.networkPaths("shared", "tpu"); network != "shared" || subnetwork != "tpu" {
+		t.Fatalf("expected names in the cluster project to be unchanged, got: %q, %q", network, subnetwork)
+	}
+	if got := c.reservationPath("v5e"); got != "v5e" {
+		t.Fatalf("expected the reservation in the cluster project to be unchanged, got: %q", got)
+	}
+
+	c.NetworkProjectID, c.ReservationProjectID = "host", "shared"
+	network, subnetwork := c.networkPaths("shared", "tpu")
+	if network != "projects/host/global/networks/shared" || subnetwork != "projects/host/regions/us-central2/subnetworks/tpu" {
+		t.Fatalf("expected paths in the network project, got: %q, %q", network, subnetwork)
+	}
+	if _, subnetwork := c.networkPaths("", "projects/other/regions/us-central2/subnetworks/tpu"); subnetwork != "projects/other/regions/us-central2/subnetworks/tpu" {
+		t.Fatalf("expected paths to be unchanged, got: %q", subnetwork)
+	}
+	if got := c.reservationPath("v5e"); got != "projects/shared/reservations/v5e" {
+		t.Fatalf("expected a shared reservation path, got: %q", got)
+	}
+
+	g := &GKE{ClusterContext: c}
+	p := &corev1.Pod{}
+	p.Annotations = map[string]string{AnnotationReservation: "v5e"}
+	if r := g.reservationForPod(p); r.Values[0] != "projects/shared/reservations/v5e" {
+		t.Fatalf("expected the reservation project to be used, got: %v", r.Values)
+	}
+}
+
+func Test_classifyCreateError_projectPermission(t *testing.T) {
+	np := &containerv1beta1.NodePool{
+		Config: &containerv1beta1.NodeConfig{
+			ReservationAffinity: &containerv1beta1.ReservationAffinity{
+				ConsumeReservationType: "SPECIFIC_RESERVATION",
+				Values:                 []string{"projects/shared/reservations/v5e"},
+			},
+		},
+		NetworkConfig: &containerv1beta1.NodeNetworkConfig{
+			AdditionalNodeNetworkConfigs: []*containerv1beta1.AdditionalNodeNetworkConfig{
+				{Network: "projects/host/global/networks/shared", Subnetwork: "projects/host/regions/us-central2/subnetworks/tpu"},
+			},
+		},
+	}
+	cases := []struct {
+		name    string
+		err     error
+		role    string
+		project string
+	}{
+		{
+			name:    "subnetwork",
+			err:     &googleapi.Error{Code: http.StatusForbidden, Message: "Required 'compute.subnetworks.use' permission for 'projects/host/regions/us-central2/subnetworks/tpu'"},
+			role:    ProjectRoleNetwork,
+			project: "host",
+		},
+		{
+			name:    "reservation",
+			err:     errors.New("operation operation-123 failed: Permission denied on reservation projects/shared/reservations/v5e."),
+			role:    ProjectRoleReservation,
+			project: "shared",
+		},
+		{name: "quota", err: &googleapi.Error{Code: http.StatusForbidden, Message: "Insufficient quota to satisfy the request for network resources"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var perr *ProjectPermissionError
+			ok := errors.As(classifyCreateError(c.err, np), &perr)
+			if c.role == "" {
+				if ok {
+					t.Fatalf("unexpected project permission error: %v", perr)
+				}
+				return
+			}
+			if !ok || perr.Role != c.role || perr.Project != c.project || !errors.Is(perr, ErrProjectPermission) {
+				t.Fatalf("expected a %s permission error in project %s, got: %v", c.role, c.project, perr)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package cloud
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	// tagIDRegexp matches tag key and tag value IDs such as
+	// "tagKeys/281475012345678".
+	tagKeyIDRegexp   = regexp.MustCompile(`^tagKeys/[0-9]+$`)
+	tagValueIDRegexp = regexp.MustCompile(`^tagValues/[0-9]+$`)
+	// tagParentRegexp matches the parent of a namespaced tag key: a numeric
+	// organization ID or a project ID.
+	tagParentRegexp = regexp.MustCompile(`^([0-9]+|[a-z][a-z0-9-]{4,28}[a-z0-9])$`)
+	// tagShortNameRegexp matches the short names of tag keys and values, see
+	// https://cloud.google.com/resource-manager/docs/tags/tags-creating-and-managing.
+	tagShortNameRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]{0,61}[A-Za-z0-9])?$`)
+)
+
+// ParseResourceManagerTags parses resource manager tag bindings in the format
+// of the AnnotationResourceManagerTags annotation: comma-separated key=value
+// pairs, where the key is a tag key ID and the value a tag value ID
+// ("tagKeys/281475012345678=tagValues/281479012345678"), or the key is a
+// namespaced tag key name (an organization or project ID and the short name
+// of the key) and the value the short name of the value
+// ("123456789012/env=prod", "my-project/team=ml"). Malformed bindings return
+// ErrInvalidResourceManagerTags. Whether the tags exist is only checked by
+// GKE.
+func ParseResourceManagerTags(spec string) (map[string]string, error) {
+	tags, err := parseSettings(spec, "resource manager tag", ErrInvalidResourceManagerTags)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range tags {
+		if err := validateResourceManagerTag(k, v); err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+func validateResourceManagerTag(key, value string) error {
+	if strings.HasPrefix(key, "tagKeys/") {
+		if !tagKeyIDRegexp.MatchString(key) {
+			return fmt.Errorf("%w: invalid tag key ID %q, must be tagKeys/<number>", ErrInvalidResourceManagerTags, key)
+		}
+		if !tagValueIDRegexp.MatchString(value) {
+			return fmt.Errorf("%w: invalid value %q of tag key ID %s, must be tagValues/<number>", ErrInvalidResourceManagerTags, value, key)
+		}
+		return nil
+	}
+	parent, name, ok := strings.Cut(key, "/")
+	if !ok || !tagParentRegexp.MatchString(parent) || !tagShortNameRegexp.MatchString(name) {
+		return fmt.Errorf("%w: invalid tag key %q, must be tagKeys/<number> or <organization or project ID>/<short name>", ErrInvalidResourceManagerTags, key)
+	}
+	if !tagShortNameRegexp.MatchString(value) {
+		return fmt.Errorf("%w: invalid value %q of tag key %s, must be the short name of a tag value", ErrInvalidResourceManagerTags, value, key)
+	}
+	return nil
+}
+
+// resourceManagerTagsForPod returns the resource manager tags of the node
+// pool for the Pod: NodeResourceManagerTags and those of the
+// AnnotationResourceManagerTags annotation. The annotation can add tags but
+// not change the value of a tag key of NodeResourceManagerTags, which often
+// enforce firewall or IAM policies.
+func (g *GKE) resourceManagerTagsForPod(p *corev1.Pod) (map[string]string, error) {
+	tags := mergeLabels(nil, g.ClusterContext.NodeResourceManagerTags)
+	v, ok := p.Annotations[AnnotationResourceManagerTags]
+	if !ok {
+		return tags, nil
+	}
+	requested, err := ParseResourceManagerTags(v)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %v annotation: %w", AnnotationResourceManagerTags, err)
+	}
+	for k, v := range requested {
+		if configured, ok := g.ClusterContext.NodeResourceManagerTags[k]; ok && configured != v {
+			return nil, fmt.Errorf("%w: %v annotation cannot change tag %s from %s to %s", ErrInvalidResourceManagerTags, AnnotationResourceManagerTags, k, configured, v)
+		}
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+// resourceManagerTags returns the ResourceManagerTags node config, nil
+// without tags.
+func resourceManagerTags(tags map[string]string) *containerv1beta1.ResourceManagerTags {
+	if len(tags) == 0 {
+		return nil
+	}
+	return &containerv1beta1.ResourceManagerTags{Tags: tags}
+}
+
+// isResourceManagerTagError matches errors about the resource manager tags
+// of the node pool, such as:
+// "googleapi: Error 400: Tag value tagValues/281479012345678 not found., badRequest"
+// "googleapi: Error 403: Permission 'resourcemanager.tagValueBindings.create' denied on resource 'tagValues/281479012345678', forbidden"
+func isResourceManagerTagError(err error, np *containerv1beta1.NodePool) bool {
+	if np.Config == nil || np.Config.ResourceManagerTags == nil || len(np.Config.ResourceManagerTags.Tags) == 0 {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"tagvalues/", "tagkeys/", "tag value", "tag key", "tagbinding", "tag binding", "resource manager tag", "resourcemanager.tag"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// resourceManagerTagsOf returns the resource manager tags of a node config,
+// for logging.
+func resourceManagerTagsOf(cfg *containerv1beta1.NodeConfig) map[string]string {
+	if cfg.ResourceManagerTags == nil {
+		return nil
+	}
+	return cfg.ResourceManagerTags.Tags
+}
@@ -0,0 +1,168 @@
+package cloud
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	"google.golang.org/api/googleapi"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseResourceManagerTags(t *testing.T) {
+	tags, err := ParseResourceManagerTags("tagKeys/281475012345678=tagValues/281479012345678, 123456789012/env=prod,my-project/team=ml_infra")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exp := "123456789012/env=prod,my-project/team=ml_infra,tagKeys/281475012345678=tagValues/281479012345678"
+	if got := formatSettings(tags); got != exp {
+		t.Fatalf("expected: %v, got: %v", exp, got)
+	}
+
+	for _, spec := range []string{
+		"tagKeys/281475012345678",
+		"tagKeys/abc=tagValues/281479012345678",
+		"tagKeys/281475012345678=prod",
+		"env=prod",
+		"123456789012/env=tagValues/281479012345678",
+		"123456789012/-env=prod",
+		"My_Project/env=prod",
+		"123456789012/env=prod,123456789012/env=dev",
+	} {
+		if _, err := ParseResourceManagerTags(spec); !errors.Is(err, ErrInvalidResourceManagerTags) {
+			t.Errorf("%q: expected %v, got: %v", spec, ErrInvalidResourceManagerTags, err)
+		}
+	}
+}
+
+func TestGKE_resourceManagerTagsForPod(t *testing.T) {
+	g := &GKE{ClusterContext: GKEContext{NodeResourceManagerTags: map[string]string{"123456789012/env": "prod"}}}
+	p := &corev1.Pod{}
+
+	tags, err := g.resourceManagerTagsForPod(p)
+	if err != nil || formatSettings(tags) != "123456789012/env=prod" {
+		t.Fatalf("expected the configured tags, got: %v, %v", tags, err)
+	}
+
+	p.Annotations = map[string]string{AnnotationResourceManagerTags: "my-project/team=ml,123456789012/env=prod"}
+	tags, err = g.resourceManagerTagsForPod(p)
+	if err != nil || formatSettings(tags) != "123456789012/env=prod,my-project/team=ml" {
+		t.Fatalf("expected the configured and requested tags, got: %v, %v", tags, err)
+	}
+	if len(g.ClusterContext.NodeResourceManagerTags) != 1 {
+		t.Fatalf("expected the configured tags not to change, got: %v", g.ClusterContext.NodeResourceManagerTags)
+	}
+
+	p.Annotations[AnnotationResourceManagerTags] = "123456789012/env=dev"
+	if _, err := g.resourceManagerTagsForPod(p); !errors.Is(err, ErrInvalidResourceManagerTags) {
+		t.Fatalf("expected changing a configured tag to fail with %v, got: %v", ErrInvalidResourceManagerTags, err)
+	}
+}
+
+func TestClassifyCreateError_resourceManagerTags(t *testing.T) {
+	tagged := &containerv1beta1.NodePool{Config: &containerv1beta1.NodeConfig{
+		ResourceManagerTags: resourceManagerTags(map[string]string{"tagKeys/281475012345678": "tagValues/281479012345678"}),
+	}}
+	untagged := &containerv1beta1.NodePool{Config: &containerv1beta1.NodeConfig{}}
+
+	cases := []struct {
+		name    string
+		err     error
+		np      *containerv1beta1.NodePool
+		binding bool
+	}{
+		{
+			name:    "missing tag value",
+			err:     &googleapi.Error{Code: http.StatusBadRequest, Message: "Tag value tagValues/281479012345678 not found."},
+			np:      tagged,
+			binding: true,
+		},
+		{
+			name:    "permission denied on tag value",
+			err:     &googleapi.Error{Code: http.StatusForbidden, Message: "Permission 'resourcemanager.tagValueBindings.create' denied on resource 'tagValues/281479012345678'"},
+			np:      tagged,
+			binding: true,
+		},
+		{
+			name: "quota exceeded",
+			err:  &googleapi.Error{Code: http.StatusForbidden, Message: "Quota 'TPUS' exceeded."},
+			np:   tagged,
+		},
+		{
+			name: "node pool without tags",
+			err:  &googleapi.Error{Code: http.StatusBadRequest, Message: "Tag value tagValues/281479012345678 not found."},
+			np:   untagged,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := classifyCreateError(fmt.Errorf("do: %w", c.err), c.np)
+			if got := errors.Is(err, ErrResourceManagerTagBinding); got != c.binding {
+				t.Fatalf("expected %v: %v, got: %v", ErrResourceManagerTagBinding, c.binding, err)
+			}
+			if c.binding && ErrorCategory(err) != ErrorCategoryResourceManagerTag {
+				t.Fatalf("expected category %v, got: %v", ErrorCategoryResourceManagerTag, ErrorCategory(err))
+			}
+		})
+	}
+}
+
+func TestGKE_nodePoolForPod_resourceManagerTags(t *testing.T) {
+	g := &GKE{ClusterContext: GKEContext{
+		ProjectID: "my-project", ClusterLocation: "us-central2", Cluster: "my-cluster", NodeZone: "us-central2-b",
+		NodeResourceManagerTags: map[string]string{"123456789012/env": "prod"},
+	}}
+	p := tagsTestPod(nil)
+	np, err := g.nodePoolForPod("tpu-provisioner-train", p, NodePoolRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if np.Config.ResourceManagerTags == nil || formatSettings(np.Config.ResourceManagerTags.Tags) != "123456789012/env=prod" {
+		t.Fatalf("expected the configured tags, got: %+v", np.Config.ResourceManagerTags)
+	}
+
+	g.ClusterContext.NodeResourceManagerTags = nil
+	if np, err = g.nodePoolForPod("tpu-provisioner-train", p, NodePoolRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if np.Config.ResourceManagerTags != nil {
+		t.Fatalf("expected no tags, got: %+v", np.Config.ResourceManagerTags)
+	}
+
+	p = tagsTestPod(map[string]string{AnnotationResourceManagerTags: "env=prod"})
+	if _, err := g.nodePoolForPod("tpu-provisioner-train", p, NodePoolRequest{}); !errors.Is(err, ErrInvalidResourceManagerTags) {
+		t.Fatalf("expected %v, got: %v", ErrInvalidResourceManagerTags, err)
+	}
+	if err := ValidatePod(p); !errors.Is(err, ErrInvalidResourceManagerTags) {
+		t.Fatalf("expected the Pod to be invalid, got: %v", err)
+	}
+}
+
+func tagsTestPod(annotations map[string]string) *corev1.Pod {
+	isController := true
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "train-0",
+			Namespace:   "default",
+			Annotations: annotations,
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Job", Name: "train", UID: "0123456789abcdef", Controller: &isController},
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{
+				GKETPUNodeSelector:         "2x4",
+				GKEAcceleratorNodeSelector: V5ePodSliceAccelerator,
+			},
+			Containers: []corev1.Container{{
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{GoogleTPUResource: resource.MustParse("4")},
+				},
+			}},
+		},
+	}
+}
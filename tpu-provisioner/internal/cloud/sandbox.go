@@ -0,0 +1,94 @@
+package cloud
+
+import (
+	"fmt"
+	"strings"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Sandbox types of node pools, see
+// https://cloud.google.com/kubernetes-engine/docs/concepts/sandbox-pods.
+const (
+	// SandboxGVisor runs the Pods of the node pool in the gVisor sandbox.
+	SandboxGVisor = "gvisor"
+	// SandboxNone disables the sandbox, it opts a Pod out of a default
+	// sandbox type.
+	SandboxNone = "none"
+)
+
+// SandboxTaint is set by GKE on sandboxed node pools. Pods with the gvisor
+// RuntimeClass tolerate it: the RuntimeClass adds the toleration when the Pod
+// is created.
+var SandboxTaint = corev1.Taint{
+	Key:    "sandbox.gke.io/runtime",
+	Value:  SandboxGVisor,
+	Effect: corev1.TaintEffectNoSchedule,
+}
+
+// sandboxTPUMachinePrefixes are the TPU machine type prefixes that GKE
+// Sandbox supports. Other accelerators (GPUs) are left to GKE to validate.
+var sandboxTPUMachinePrefixes = []string{"ct5lp-", "ct5p-", "ct6e-"}
+
+// sandboxImageType is the only node image type that supports GKE Sandbox.
+const sandboxImageType = "COS_CONTAINERD"
+
+// ValidateSandbox returns ErrInvalidSandboxConfig if the sandbox type is
+// unknown or, if machineType and imageType are set, not supported by them.
+// Both types are case-insensitive.
+func ValidateSandbox(sandbox, machineType, imageType string) error {
+	switch strings.ToLower(sandbox) {
+	case "", SandboxNone:
+		return nil
+	case SandboxGVisor:
+	default:
+		return fmt.Errorf("%w: unknown sandbox type %q, must be %q or %q", ErrInvalidSandboxConfig, sandbox, SandboxGVisor, SandboxNone)
+	}
+	if strings.HasPrefix(machineType, "ct") && !hasAnyPrefix(machineType, sandboxTPUMachinePrefixes) {
+		return fmt.Errorf("%w: TPU machine type %q does not support GKE Sandbox", ErrInvalidSandboxConfig, machineType)
+	}
+	if imageType != "" && strings.ToUpper(imageType) != sandboxImageType {
+		return fmt.Errorf("%w: GKE Sandbox requires the %s image type, not %s", ErrInvalidSandboxConfig, sandboxImageType, imageType)
+	}
+	return nil
+}
+
+// sandboxTypeForPod returns the sandbox type of the node pool for the Pod,
+// "" for none. The AnnotationSandbox annotation takes precedence over the
+// cluster default.
+func (g *GKE) sandboxTypeForPod(p *corev1.Pod) (string, error) {
+	sandbox := g.ClusterContext.NodeSandbox
+	if v, ok := p.Annotations[AnnotationSandbox]; ok {
+		sandbox = v
+	}
+	sandbox = strings.ToLower(sandbox)
+	if err := ValidateSandbox(sandbox, "", ""); err != nil {
+		return "", err
+	}
+	if sandbox == SandboxNone {
+		return "", nil
+	}
+	return sandbox, nil
+}
+
+// sandboxForPod returns the sandbox type of the node pool for the Pod, checked
+// against the machine type and image type of the node pool.
+func (g *GKE) sandboxForPod(p *corev1.Pod, machineType, imageType string) (string, error) {
+	sandbox, err := g.sandboxTypeForPod(p)
+	if err != nil {
+		return "", err
+	}
+	if err := ValidateSandbox(sandbox, machineType, imageType); err != nil {
+		return "", err
+	}
+	return sandbox, nil
+}
+
+// sandboxConfig returns the SandboxConfig node config, nil without a sandbox.
+func sandboxConfig(sandbox string) *containerv1beta1.SandboxConfig {
+	if sandbox != SandboxGVisor {
+		return nil
+	}
+	return &containerv1beta1.SandboxConfig{Type: "GVISOR"}
+}
@@ -0,0 +1,81 @@
+package cloud
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestValidateSandbox(t *testing.T) {
+	cases := []struct {
+		name        string
+		sandbox     string
+		machineType string
+		imageType   string
+		valid       bool
+	}{
+		{name: "none", machineType: "ct4p-hightpu-4t", imageType: "UBUNTU_CONTAINERD", valid: true},
+		{name: "explicitly none", sandbox: "none", machineType: "ct4p-hightpu-4t", valid: true},
+		{name: "unknown", sandbox: "kata"},
+		{name: "gvisor without machine type", sandbox: "gVisor", valid: true},
+		{name: "gvisor on supported TPU", sandbox: "gvisor", machineType: "ct5lp-hightpu-4t", imageType: "cos_containerd", valid: true},
+		{name: "gvisor on unsupported TPU", sandbox: "gvisor", machineType: "ct4p-hightpu-4t"},
+		{name: "gvisor on GPU", sandbox: "gvisor", machineType: "a2-highgpu-1g", valid: true},
+		{name: "gvisor on Ubuntu", sandbox: "gvisor", machineType: "ct5lp-hightpu-4t", imageType: "UBUNTU_CONTAINERD"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateSandbox(c.sandbox, c.machineType, c.imageType)
+			if c.valid && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !c.valid && !errors.Is(err, ErrInvalidSandboxConfig) {
+				t.Fatalf("expected %v, got: %v", ErrInvalidSandboxConfig, err)
+			}
+		})
+	}
+}
+
+func TestGKE_sandboxForPod(t *testing.T) {
+	g := &GKE{}
+	p := &corev1.Pod{}
+
+	if sandbox, err := g.sandboxForPod(p, "ct5lp-hightpu-4t", ""); err != nil || sandbox != "" || sandboxConfig(sandbox) != nil {
+		t.Fatalf("expected no sandbox by default, got: %q, %v", sandbox, err)
+	}
+
+	p.Annotations = map[string]string{AnnotationSandbox: "gvisor"}
+	sandbox, err := g.sandboxForPod(p, "ct5lp-hightpu-4t", "")
+	if err != nil || sandbox != SandboxGVisor {
+		t.Fatalf("expected the annotation to opt in, got: %q, %v", sandbox, err)
+	}
+	if cfg := sandboxConfig(sandbox); cfg == nil || cfg.Type != "GVISOR" {
+		t.Fatalf("expected a gVisor sandbox config, got: %+v", cfg)
+	}
+	taints, err := g.NodePoolTaintsForPod(p)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !taintsContain(taints, SandboxTaint) {
+		t.Fatalf("expected the sandbox taint, got: %v", taints)
+	}
+	if _, err := g.sandboxForPod(p, "ct4p-hightpu-4t", ""); !errors.Is(err, ErrInvalidSandboxConfig) {
+		t.Fatalf("expected %v, got: %v", ErrInvalidSandboxConfig, err)
+	}
+
+	g.ClusterContext.NodeSandbox = SandboxGVisor
+	p.Annotations = map[string]string{AnnotationSandbox: "none"}
+	if sandbox, err := g.sandboxForPod(p, "ct4p-hightpu-4t", ""); err != nil || sandbox != "" {
+		t.Fatalf("expected the annotation to opt out, got: %q, %v", sandbox, err)
+	}
+}
+
+func taintsContain(taints []corev1.Taint, taint corev1.Taint) bool {
+	for _, t := range taints {
+		if t.MatchTaint(&taint) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package cloud
+
+import (
+	"context"
+	"fmt"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	"google.golang.org/api/option"
+)
+
+// ServiceConfig overrides how the GKE API is reached, for example to test
+// against an emulator. Zero values use the production endpoint with
+// Application Default Credentials.
+type ServiceConfig struct {
+	// Endpoint is the base URL of the GKE API, for example
+	// "http://localhost:8080/".
+	Endpoint string
+	// CredentialsFile is the path of a service account key or other
+	// credentials JSON file.
+	CredentialsFile string
+	// WithoutAuthentication sends requests without credentials.
+	WithoutAuthentication bool
+}
+
+// NewService returns a GKE API client configured by c.
+func NewService(ctx context.Context, c ServiceConfig) (*containerv1beta1.Service, error) {
+	if c.CredentialsFile != "" && c.WithoutAuthentication {
+		return nil, fmt.Errorf("credentials file and no authentication are mutually exclusive")
+	}
+	var opts []option.ClientOption
+	if c.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(c.Endpoint))
+	}
+	if c.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(c.CredentialsFile))
+	}
+	if c.WithoutAuthentication {
+		opts = append(opts, option.WithoutAuthentication())
+	}
+	return containerv1beta1.NewService(ctx, opts...)
+}
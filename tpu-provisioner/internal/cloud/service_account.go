@@ -0,0 +1,73 @@
+package cloud
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// serviceAccountPattern matches the email of a GCP service account, for
+// example "training@my-project.iam.gserviceaccount.com" or
+// "123456789-compute@developer.gserviceaccount.com".
+var serviceAccountPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*@[a-z0-9][a-z0-9.-]*\.gserviceaccount\.com$`)
+
+// ValidateServiceAccount returns ErrInvalidServiceAccount if the node service
+// account is neither empty, "default" nor a service account email.
+func ValidateServiceAccount(email string) error {
+	if email == "" || email == "default" || serviceAccountPattern.MatchString(email) {
+		return nil
+	}
+	return fmt.Errorf("%w: %q is not a service account email", ErrInvalidServiceAccount, email)
+}
+
+// nodeIdentity is the service account and OAuth scopes of the nodes of a
+// node pool. Empty values use the GKE defaults.
+type nodeIdentity struct {
+	ServiceAccount string
+	OAuthScopes    []string
+}
+
+// identityForPod returns the node identity for the node pool of the Pod.
+// The AnnotationServiceAccount and AnnotationOAuthScopes annotations take
+// precedence over the class, which takes precedence over the default of the
+// Pod's namespace and then the cluster defaults.
+func (g *GKE) identityForPod(p *corev1.Pod, class *NodePoolClass) (nodeIdentity, error) {
+	id := nodeIdentity{
+		ServiceAccount: g.ClusterContext.NodeServiceAccount,
+		OAuthScopes:    g.ClusterContext.NodeOAuthScopes,
+	}
+	if v, ok := g.ClusterContext.NodeServiceAccounts[p.Namespace]; ok {
+		id.ServiceAccount = v
+	}
+	if class != nil {
+		if class.ServiceAccount != "" {
+			id.ServiceAccount = class.ServiceAccount
+		}
+		if len(class.OAuthScopes) > 0 {
+			id.OAuthScopes = class.OAuthScopes
+		}
+	}
+	if v, ok := p.Annotations[AnnotationServiceAccount]; ok {
+		id.ServiceAccount = v
+	}
+	if v, ok := p.Annotations[AnnotationOAuthScopes]; ok {
+		id.OAuthScopes = splitScopes(v)
+	}
+	if err := ValidateServiceAccount(id.ServiceAccount); err != nil {
+		return nodeIdentity{}, err
+	}
+	return id, nil
+}
+
+// splitScopes splits a comma-separated list of OAuth scopes.
+func splitScopes(s string) []string {
+	var scopes []string
+	for _, scope := range strings.Split(s, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
@@ -0,0 +1,119 @@
+package cloud
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestValidateServiceAccount(t *testing.T) {
+	cases := []struct {
+		email string
+		err   bool
+	}{
+		{email: ""},
+		{email: "default"},
+		{email: "training@my-project.iam.gserviceaccount.com"},
+		{email: "123456789-compute@developer.gserviceaccount.com"},
+		{email: "training", err: true},
+		{email: "training@example.com", err: true},
+		{email: "Training@my-project.iam.gserviceaccount.com", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.email, func(t *testing.T) {
+			err := ValidateServiceAccount(c.email)
+			if (err != nil) != c.err {
+				t.Fatalf("error: expected: %v, got: %v", c.err, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidServiceAccount) {
+				t.Fatalf("expected ErrInvalidServiceAccount, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestGKE_identityForPod(t *testing.T) {
+	g := &GKE{ClusterContext: GKEContext{
+		NodeServiceAccount: "default@my-project.iam.gserviceaccount.com",
+		NodeOAuthScopes:    []string{"https://www.googleapis.com/auth/cloud-platform"},
+		NodeServiceAccounts: map[string]string{
+			"team-a": "team-a@my-project.iam.gserviceaccount.com",
+		},
+	}}
+	class := &NodePoolClass{ServiceAccount: "class@my-project.iam.gserviceaccount.com"}
+
+	cases := []struct {
+		name        string
+		namespace   string
+		class       *NodePoolClass
+		annotations map[string]string
+		exp         nodeIdentity
+		err         bool
+	}{
+		{
+			name:      "cluster default",
+			namespace: "default",
+			exp: nodeIdentity{
+				ServiceAccount: "default@my-project.iam.gserviceaccount.com",
+				OAuthScopes:    []string{"https://www.googleapis.com/auth/cloud-platform"},
+			},
+		},
+		{
+			name:      "namespace default",
+			namespace: "team-a",
+			exp: nodeIdentity{
+				ServiceAccount: "team-a@my-project.iam.gserviceaccount.com",
+				OAuthScopes:    []string{"https://www.googleapis.com/auth/cloud-platform"},
+			},
+		},
+		{
+			name:      "class",
+			namespace: "team-a",
+			class:     class,
+			exp: nodeIdentity{
+				ServiceAccount: "class@my-project.iam.gserviceaccount.com",
+				OAuthScopes:    []string{"https://www.googleapis.com/auth/cloud-platform"},
+			},
+		},
+		{
+			name:      "annotations",
+			namespace: "team-a",
+			class:     class,
+			annotations: map[string]string{
+				AnnotationServiceAccount: "pod@my-project.iam.gserviceaccount.com",
+				AnnotationOAuthScopes:    "https://www.googleapis.com/auth/devstorage.read_only, https://www.googleapis.com/auth/logging.write",
+			},
+			exp: nodeIdentity{
+				ServiceAccount: "pod@my-project.iam.gserviceaccount.com",
+				OAuthScopes: []string{
+					"https://www.googleapis.com/auth/devstorage.read_only",
+					"https://www.googleapis.com/auth/logging.write",
+				},
+			},
+		},
+		{
+			name:        "invalid annotation",
+			namespace:   "default",
+			annotations: map[string]string{AnnotationServiceAccount: "not-an-email"},
+			err:         true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := &corev1.Pod{}
+			p.Namespace = c.namespace
+			p.Annotations = c.annotations
+			id, err := g.identityForPod(p, c.class)
+			if (err != nil) != c.err {
+				t.Fatalf("error: expected: %v, got: %v", c.err, err)
+			}
+			if !reflect.DeepEqual(id, c.exp) {
+				t.Fatalf("expected: %+v, got: %+v", c.exp, id)
+			}
+		})
+	}
+}
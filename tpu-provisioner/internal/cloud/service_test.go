@@ -0,0 +1,700 @@
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// fakeGKEServer serves the node pool and operation calls of the GKE API
+// with canned responses and records the node pool create and delete
+// requests. The operations of node pools created in stockoutZones fail.
+// Only the nodePools exist, delete operations are done right away. Creating
+// one of the racingNodePools fails with 409 and adds it to the nodePools, as
+// if it had been created concurrently. If createStarted is set, every create
+// request is sent to it once recorded, and if releaseCreates is set, the
+// responses to create requests wait until it is closed.
+type fakeGKEServer struct {
+	mtx             sync.Mutex
+	creates         []containerv1beta1.CreateNodePoolRequest
+	deletes         []string
+	stockoutZones   map[string]bool
+	nodePools       map[string]*containerv1beta1.NodePool
+	racingNodePools map[string]*containerv1beta1.NodePool
+	createStarted   chan string
+	releaseCreates  chan struct{}
+}
+
+func (s *fakeGKEServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	switch {
+	case r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/nodePools/"):
+		s.mtx.Lock()
+		np, ok := s.nodePools[name]
+		s.mtx.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"code": 404, "message": "not found"}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(np)
+	case r.Method == http.MethodDelete && strings.Contains(r.URL.Path, "/nodePools/"):
+		s.mtx.Lock()
+		s.deletes = append(s.deletes, name)
+		delete(s.nodePools, name)
+		n := len(s.deletes)
+		s.mtx.Unlock()
+		fmt.Fprintf(w, `{"name": "delete-%d", "status": "RUNNING"}`, n)
+	case r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/operations/delete-"):
+		fmt.Fprintf(w, `{"name": %q, "status": "DONE"}`, name)
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/nodePools"):
+		var req containerv1beta1.CreateNodePoolRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mtx.Lock()
+		if np, ok := s.racingNodePools[req.NodePool.Name]; ok {
+			if s.nodePools == nil {
+				s.nodePools = map[string]*containerv1beta1.NodePool{}
+			}
+			s.nodePools[req.NodePool.Name] = np
+			s.mtx.Unlock()
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"error": {"code": 409, "message": "Already exists"}}`))
+			return
+		}
+		s.creates = append(s.creates, req)
+		n := len(s.creates)
+		s.mtx.Unlock()
+		if s.createStarted != nil {
+			s.createStarted <- req.NodePool.Name
+		}
+		if s.releaseCreates != nil {
+			<-s.releaseCreates
+		}
+		fmt.Fprintf(w, `{"name": "operation-%d", "status": "RUNNING"}`, n)
+	case r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/operations/operation-"):
+		var n int
+		fmt.Sscanf(r.URL.Path[strings.LastIndex(r.URL.Path, "-")+1:], "%d", &n)
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		if n < 1 || n > len(s.creates) {
+			http.Error(w, "operation not found", http.StatusNotFound)
+			return
+		}
+		if zone := s.creates[n-1].NodePool.Locations[0]; s.stockoutZones[zone] {
+			fmt.Fprintf(w, `{"name": "operation-%d", "status": "DONE", "error": {"message": "GCE_STOCKOUT: zone %s does not have enough resources available to fulfill the request"}}`, n, zone)
+			return
+		}
+		fmt.Fprintf(w, `{"name": "operation-%d", "status": "DONE"}`, n)
+	default:
+		http.Error(w, "unexpected request "+r.Method+" "+r.URL.Path, http.StatusNotImplemented)
+	}
+}
+
+func TestGKE_EnsureNodePoolForPod_request(t *testing.T) {
+	fake := &fakeGKEServer{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	svc, err := NewService(context.Background(), ServiceConfig{Endpoint: srv.URL + "/", WithoutAuthentication: true})
+	if err != nil {
+		t.Fatalf("creating service: %v", err)
+	}
+	g := &GKE{
+		Service: svc,
+		ClusterContext: GKEContext{
+			ProjectID:       "my-project",
+			ClusterLocation: "us-central2",
+			Cluster:         "my-cluster",
+			NodeZone:        "us-central2-b",
+			DefaultTPUTaints: []corev1.Taint{
+				{Key: GoogleTPUResource, Value: "present", Effect: corev1.TaintEffectNoSchedule},
+			},
+		},
+	}
+
+	isController := true
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "train-0",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Job", Name: "train", UID: "0123456789abcdef", Controller: &isController},
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{
+				GKETPUNodeSelector:         "2x2x2",
+				GKEAcceleratorNodeSelector: V4PodSliceAccelerator,
+			},
+			Containers: []corev1.Container{{
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{GoogleTPUResource: resource.MustParse("4")},
+				},
+			}},
+		},
+	}
+
+	op, err := g.EnsureNodePoolForPod(p, NodePoolRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exp, got := "projects/my-project/locations/us-central2/operations/operation-1", op.Name; exp != got {
+		t.Fatalf("operation: expected: %v, got: %v", exp, got)
+	}
+
+	if exp, got := 1, len(fake.creates); exp != got {
+		t.Fatalf("create requests: expected: %v, got: %v", exp, got)
+	}
+	np := fake.creates[0].NodePool
+	if exp, got := int64(2), np.InitialNodeCount; exp != got {
+		t.Fatalf("node count: expected: %v, got: %v", exp, got)
+	}
+	if exp, got := "ct4p-hightpu-4t", np.Config.MachineType; exp != got {
+		t.Fatalf("machine type: expected: %v, got: %v", exp, got)
+	}
+	if exp, got := "2x2x2", np.PlacementPolicy.TpuTopology; exp != got {
+		t.Fatalf("topology: expected: %v, got: %v", exp, got)
+	}
+	if exp, got := LabelNodepoolManagerTPUPodinator, np.Config.Labels[LabelNodepoolManager]; exp != got {
+		t.Fatalf("manager label: expected: %v, got: %v", exp, got)
+	}
+	if len(np.Config.Taints) != 1 || np.Config.Taints[0].Key != GoogleTPUResource || np.Config.Taints[0].Effect != "NO_SCHEDULE" {
+		t.Fatalf("expected TPU taint, got: %+v", np.Config.Taints)
+	}
+}
+
+func TestGKE_EnsureNodePoolForPod_concurrent(t *testing.T) {
+	fake := &fakeGKEServer{createStarted: make(chan string, 1), releaseCreates: make(chan struct{})}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	svc, err := NewService(context.Background(), ServiceConfig{Endpoint: srv.URL + "/", WithoutAuthentication: true})
+	if err != nil {
+		t.Fatalf("creating service: %v", err)
+	}
+	g := &GKE{
+		Service:        svc,
+		ClusterContext: GKEContext{ProjectID: "my-project", ClusterLocation: "us-central2", Cluster: "my-cluster", NodeZone: "us-central2-b"},
+	}
+
+	isController := true
+	pod := func(name string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "Job", Name: "train", UID: "0123456789abcdef", Controller: &isController},
+				},
+			},
+			Spec: corev1.PodSpec{
+				NodeSelector: map[string]string{
+					GKETPUNodeSelector:         "2x2x2",
+					GKEAcceleratorNodeSelector: V4PodSliceAccelerator,
+				},
+				Containers: []corev1.Container{{
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{GoogleTPUResource: resource.MustParse("4")},
+					},
+				}},
+			},
+		}
+	}
+
+	first := make(chan error, 1)
+	go func() {
+		_, err := g.EnsureNodePoolForPod(pod("train-0"), NodePoolRequest{})
+		first <- err
+	}()
+	<-fake.createStarted
+
+	// The Pods of the same Job share the node pool, whose creation is in
+	// flight.
+	const callers = 4
+	errs := make(chan error, callers)
+	var wg sync.WaitGroup
+	for i := 1; i <= callers; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			_, err := g.EnsureNodePoolForPod(pod(name), NodePoolRequest{})
+			errs <- err
+		}(fmt.Sprintf("train-%d", i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if !errors.Is(err, ErrDuplicateRequest) {
+			t.Fatalf("concurrent caller: expected %v, got: %v", ErrDuplicateRequest, err)
+		}
+	}
+
+	close(fake.releaseCreates)
+	if err := <-first; err != nil {
+		t.Fatalf("first caller: unexpected error: %v", err)
+	}
+	if exp, got := 1, len(fake.creates); exp != got {
+		t.Fatalf("create requests: expected: %v, got: %v", exp, got)
+	}
+}
+
+func TestGKE_EnsureNodePoolForPod_drift(t *testing.T) {
+	isController := true
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "train-0",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Job", Name: "train", UID: "0123456789abcdef", Controller: &isController},
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{
+				GKETPUNodeSelector:         "2x2x1",
+				GKEAcceleratorNodeSelector: V4PodSliceAccelerator,
+			},
+			Containers: []corev1.Container{{
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{GoogleTPUResource: resource.MustParse("4")},
+				},
+			}},
+		},
+	}
+
+	for _, recreate := range []bool{false, true} {
+		fake := &fakeGKEServer{}
+		srv := httptest.NewServer(fake)
+		defer srv.Close()
+		svc, err := NewService(context.Background(), ServiceConfig{Endpoint: srv.URL + "/", WithoutAuthentication: true})
+		if err != nil {
+			t.Fatalf("creating service: %v", err)
+		}
+		rec := record.NewFakeRecorder(10)
+		g := &GKE{
+			Service:                  svc,
+			ClusterContext:           GKEContext{ProjectID: "my-project", ClusterLocation: "us-central2", Cluster: "my-cluster", NodeZone: "us-central2-b"},
+			Recorder:                 rec,
+			RecreateDriftedNodePools: recreate,
+		}
+		name, err := g.NodePoolNameForPod(p)
+		if err != nil {
+			t.Fatalf("node pool name: %v", err)
+		}
+
+		if _, err := g.EnsureNodePoolForPod(p, NodePoolRequest{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		created := fake.creates[0].NodePool
+		if created.Config.ResourceLabels[ResourceLabelSpecHash] == "" {
+			t.Fatalf("expected a %v resource label, got: %v", ResourceLabelSpecHash, created.Config.ResourceLabels)
+		}
+
+		// An existing node pool with the intended spec is left alone.
+		fake.nodePools = map[string]*containerv1beta1.NodePool{name: created}
+		if _, err := g.EnsureNodePoolForPod(p, NodePoolRequest{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(fake.creates) != 1 || len(fake.deletes) != 0 || len(rec.Events) != 0 {
+			t.Fatalf("expected nothing to be done, got: %d creates, %d deletes, %d events", len(fake.creates), len(fake.deletes), len(rec.Events))
+		}
+
+		drifted := *created
+		drifted.Config = &containerv1beta1.NodeConfig{Labels: created.Config.Labels, ResourceLabels: map[string]string{ResourceLabelSpecHash: specHashVersion + "0123456789abcdef"}}
+		fake.nodePools = map[string]*containerv1beta1.NodePool{name: &drifted}
+		if _, err := g.EnsureNodePoolForPod(p, NodePoolRequest{}); err != nil {
+			t.Fatalf("recreate=%v: unexpected error: %v", recreate, err)
+		}
+		if ev := <-rec.Events; !strings.Contains(ev, EventNodePoolDrift) {
+			t.Fatalf("recreate=%v: expected a %s event, got: %v", recreate, EventNodePoolDrift, ev)
+		}
+		exp := 0
+		if recreate {
+			exp = 1
+		}
+		if len(fake.deletes) != exp || len(fake.creates) != 1+exp {
+			t.Fatalf("recreate=%v: expected %d deletes and recreates, got: %d deletes, %d creates", recreate, exp, len(fake.deletes), len(fake.creates)-1)
+		}
+	}
+}
+
+func TestGKE_EnsureNodePoolForPod_driftSiblings(t *testing.T) {
+	isController := true
+	pod := func(name, index string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{"team": "research", "batch.kubernetes.io/job-completion-index": index},
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "Job", Name: "train", UID: "0123456789abcdef", Controller: &isController},
+				},
+			},
+			Spec: corev1.PodSpec{
+				NodeSelector: map[string]string{
+					GKETPUNodeSelector:         "2x2x2",
+					GKEAcceleratorNodeSelector: V4PodSliceAccelerator,
+				},
+				Containers: []corev1.Container{{
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{GoogleTPUResource: resource.MustParse("4")},
+					},
+				}},
+			},
+		}
+	}
+	first, second := pod("train-0-abcde", "0"), pod("train-1-fghij", "1")
+
+	fake := &fakeGKEServer{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	svc, err := NewService(context.Background(), ServiceConfig{Endpoint: srv.URL + "/", WithoutAuthentication: true})
+	if err != nil {
+		t.Fatalf("creating service: %v", err)
+	}
+	rec := record.NewFakeRecorder(10)
+	g := &GKE{
+		Service: svc,
+		ClusterContext: GKEContext{
+			ProjectID: "my-project", ClusterLocation: "us-central2", Cluster: "my-cluster", NodeZone: "us-central2-b",
+			PodLabelsToPropagate: []string{"team", "batch.kubernetes.io/job-completion-index"},
+		},
+		Recorder:                 rec,
+		RecreateDriftedNodePools: true,
+	}
+	name, err := g.NodePoolNameForPod(first)
+	if err != nil {
+		t.Fatalf("node pool name: %v", err)
+	}
+	if other, _ := g.NodePoolNameForPod(second); other != name {
+		t.Fatalf("expected the Pods to share a node pool, got: %v and %v", name, other)
+	}
+
+	if _, err := g.EnsureNodePoolForPod(first, NodePoolRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	created := fake.creates[0].NodePool
+	fake.nodePools = map[string]*containerv1beta1.NodePool{name: created}
+
+	// The sibling has another trigger Pod and completion index, but the
+	// same intended spec.
+	if _, err := g.EnsureNodePoolForPod(second, NodePoolRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fake.creates) != 1 || len(fake.deletes) != 0 || len(rec.Events) != 0 {
+		t.Fatalf("expected the sibling's node pool to be left alone, got: %d creates, %d deletes, %d events", len(fake.creates), len(fake.deletes), len(rec.Events))
+	}
+
+	// Hashes of older versions, which included the per-Pod labels, are not
+	// compared.
+	legacy := *created
+	legacy.Config = &containerv1beta1.NodeConfig{Labels: created.Config.Labels, ResourceLabels: map[string]string{ResourceLabelSpecHash: "0123456789abcdef"}}
+	fake.nodePools = map[string]*containerv1beta1.NodePool{name: &legacy}
+	if _, err := g.EnsureNodePoolForPod(second, NodePoolRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fake.creates) != 1 || len(fake.deletes) != 0 || len(rec.Events) != 0 {
+		t.Fatalf("expected a legacy spec hash not to drift, got: %d creates, %d deletes, %d events", len(fake.creates), len(fake.deletes), len(rec.Events))
+	}
+}
+
+func TestGKE_EnsureNodePoolForPod_nameCollision(t *testing.T) {
+	isController := true
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "train-0",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Job", Name: "train", UID: "0123456789abcdef", Controller: &isController},
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{
+				GKETPUNodeSelector:         "2x2x1",
+				GKEAcceleratorNodeSelector: V4PodSliceAccelerator,
+			},
+			Containers: []corev1.Container{{
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{GoogleTPUResource: resource.MustParse("4")},
+				},
+			}},
+		},
+	}
+	foreign := &containerv1beta1.NodePool{Config: &containerv1beta1.NodeConfig{Labels: map[string]string{"team": "infra"}}}
+	ours := &containerv1beta1.NodePool{Config: &containerv1beta1.NodeConfig{Labels: map[string]string{LabelNodepoolManager: LabelNodepoolManagerTPUPodinator}}}
+	alternate := withHashSuffix("tpu-provisioner-0123456789ab", "0123456789abcdef")
+
+	for name, c := range map[string]struct {
+		fake    *fakeGKEServer
+		creates []string
+		err     error
+	}{
+		"existing foreign node pool": {
+			fake:    &fakeGKEServer{nodePools: map[string]*containerv1beta1.NodePool{"tpu-provisioner-0123456789ab": foreign}},
+			creates: []string{alternate},
+		},
+		"created concurrently by someone else": {
+			fake:    &fakeGKEServer{racingNodePools: map[string]*containerv1beta1.NodePool{"tpu-provisioner-0123456789ab": foreign}},
+			creates: []string{alternate},
+		},
+		"created concurrently by the provisioner": {
+			fake: &fakeGKEServer{racingNodePools: map[string]*containerv1beta1.NodePool{"tpu-provisioner-0123456789ab": ours}},
+		},
+		"alternate name taken too": {
+			fake: &fakeGKEServer{nodePools: map[string]*containerv1beta1.NodePool{"tpu-provisioner-0123456789ab": foreign, alternate: foreign}},
+			err:  ErrInvalidNodePoolConfig,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(c.fake)
+			defer srv.Close()
+			svc, err := NewService(context.Background(), ServiceConfig{Endpoint: srv.URL + "/", WithoutAuthentication: true})
+			if err != nil {
+				t.Fatalf("creating service: %v", err)
+			}
+			rec := record.NewFakeRecorder(10)
+			annotator := &recordingAnnotator{}
+			g := &GKE{
+				Service:        svc,
+				ClusterContext: GKEContext{ProjectID: "my-project", ClusterLocation: "us-central2", Cluster: "my-cluster", NodeZone: "us-central2-b"},
+				Recorder:       rec,
+				Annotator:      annotator,
+			}
+			op, err := g.EnsureNodePoolForPod(p, NodePoolRequest{})
+			if !errors.Is(err, c.err) || (c.err == nil && err != nil) {
+				t.Fatalf("expected error %v, got: %v", c.err, err)
+			}
+			var creates []string
+			for _, req := range c.fake.creates {
+				creates = append(creates, req.NodePool.Name)
+			}
+			if fmt.Sprint(creates) != fmt.Sprint(c.creates) {
+				t.Fatalf("expected creates: %v, got: %v", c.creates, creates)
+			}
+			if len(c.creates) > 0 {
+				if ev := <-rec.Events; !strings.Contains(ev, EventNameCollisionResolved) {
+					t.Fatalf("expected a %s event, got: %v", EventNameCollisionResolved, ev)
+				}
+				if op == nil || op.NodePool != alternate {
+					t.Fatalf("expected an operation for node pool: %v, got: %+v", alternate, op)
+				}
+				if got := annotator.annotations[AnnotationNodePoolName]; got != alternate {
+					t.Fatalf("expected %s annotation: %v, got: %v", AnnotationNodePoolName, alternate, got)
+				}
+			}
+		})
+	}
+}
+
+func TestGKE_EnsureNodePoolForPod_annotatedName(t *testing.T) {
+	isController := true
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "train-0",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Job", Name: "train", UID: "0123456789abcdef", Controller: &isController},
+			},
+			Annotations: map[string]string{AnnotationNodePoolName: "tpu-provisioner-0123456789ab-alt"},
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{
+				GKETPUNodeSelector:         "2x2x1",
+				GKEAcceleratorNodeSelector: V4PodSliceAccelerator,
+			},
+			Containers: []corev1.Container{{
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{GoogleTPUResource: resource.MustParse("4")},
+				},
+			}},
+		},
+	}
+	fake := &fakeGKEServer{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	svc, err := NewService(context.Background(), ServiceConfig{Endpoint: srv.URL + "/", WithoutAuthentication: true})
+	if err != nil {
+		t.Fatalf("creating service: %v", err)
+	}
+	g := &GKE{
+		Service:        svc,
+		ClusterContext: GKEContext{ProjectID: "my-project", ClusterLocation: "us-central2", Cluster: "my-cluster", NodeZone: "us-central2-b"},
+	}
+	op, err := g.EnsureNodePoolForPod(p, NodePoolRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fake.creates) != 1 || fake.creates[0].NodePool.Name != "tpu-provisioner-0123456789ab-alt" {
+		t.Fatalf("expected the annotated node pool name to be created, got: %+v", fake.creates)
+	}
+	if op.NodePool != "tpu-provisioner-0123456789ab-alt" {
+		t.Fatalf("expected operation node pool: %v, got: %v", "tpu-provisioner-0123456789ab-alt", op.NodePool)
+	}
+}
+
+func TestGKE_DeleteNodePool_owner(t *testing.T) {
+	foreign := &containerv1beta1.NodePool{Config: &containerv1beta1.NodeConfig{Labels: map[string]string{"team": "infra"}}}
+	ours := &containerv1beta1.NodePool{Config: &containerv1beta1.NodeConfig{Labels: map[string]string{LabelNodepoolManager: LabelNodepoolManagerTPUPodinator}}}
+
+	for name, c := range map[string]struct {
+		nodePool *containerv1beta1.NodePool
+		deletes  []string
+		err      error
+	}{
+		"owned":   {nodePool: ours, deletes: []string{"np"}},
+		"foreign": {nodePool: foreign, err: ErrNodePoolNotOwned},
+		// Deleting a node pool that is already gone is not an error.
+		"missing": {deletes: []string{"np"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			fake := &fakeGKEServer{nodePools: map[string]*containerv1beta1.NodePool{}}
+			if c.nodePool != nil {
+				fake.nodePools["np"] = c.nodePool
+			}
+			srv := httptest.NewServer(fake)
+			defer srv.Close()
+			svc, err := NewService(context.Background(), ServiceConfig{Endpoint: srv.URL + "/", WithoutAuthentication: true})
+			if err != nil {
+				t.Fatalf("creating service: %v", err)
+			}
+			g := &GKE{
+				Service:        svc,
+				ClusterContext: GKEContext{ProjectID: "my-project", ClusterLocation: "us-central2", Cluster: "my-cluster"},
+			}
+			if err := g.DeleteNodePool("np"); !errors.Is(err, c.err) || (c.err == nil && err != nil) {
+				t.Fatalf("expected error %v, got: %v", c.err, err)
+			}
+			if fmt.Sprint(fake.deletes) != fmt.Sprint(c.deletes) {
+				t.Fatalf("expected deletes: %v, got: %v", c.deletes, fake.deletes)
+			}
+		})
+	}
+}
+
+func TestGKE_EnsureNodePoolForPod_template(t *testing.T) {
+	isController := true
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "train-0",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Job", Name: "train", UID: "0123456789abcdef", Controller: &isController},
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{
+				GKETPUNodeSelector:         "2x2x1",
+				GKEAcceleratorNodeSelector: V4PodSliceAccelerator,
+			},
+			Containers: []corev1.Container{{
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{GoogleTPUResource: resource.MustParse("4")},
+				},
+			}},
+		},
+	}
+	fake := &fakeGKEServer{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	svc, err := NewService(context.Background(), ServiceConfig{Endpoint: srv.URL + "/", WithoutAuthentication: true})
+	if err != nil {
+		t.Fatalf("creating service: %v", err)
+	}
+	g := &GKE{
+		Service:          svc,
+		ClusterContext:   GKEContext{ProjectID: "my-project", ClusterLocation: "us-central2", Cluster: "my-cluster", NodeZone: "us-central2-b"},
+		NodePoolTemplate: "tpu-template",
+	}
+
+	if _, err := g.EnsureNodePoolForPod(p, NodePoolRequest{}); !errors.Is(err, ErrTemplateNotFound) {
+		t.Fatalf("expected ErrTemplateNotFound, got: %v", err)
+	}
+	if len(fake.creates) != 0 {
+		t.Fatalf("expected no node pool to be created, got: %d", len(fake.creates))
+	}
+
+	fake.nodePools = map[string]*containerv1beta1.NodePool{"tpu-template": {
+		Name:     "tpu-template",
+		Status:   "RUNNING",
+		SelfLink: "https://container.googleapis.com/v1beta1/tpu-template",
+		Config: &containerv1beta1.NodeConfig{
+			MachineType:    "e2-standard-4",
+			DiskSizeGb:     500,
+			ServiceAccount: "tpu@my-project.iam.gserviceaccount.com",
+			Labels:         map[string]string{"team": "ml"},
+			Taints:         []*containerv1beta1.NodeTaint{{Key: "dedicated", Value: "ml", Effect: "NO_SCHEDULE"}},
+		},
+	}}
+	if _, err := g.EnsureNodePoolForPod(p, NodePoolRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	created := fake.creates[0].NodePool
+	if created.Status != "" || created.SelfLink != "" {
+		t.Errorf("expected the output-only fields to be cleared, got status %q, self link %q", created.Status, created.SelfLink)
+	}
+	if created.Name == "tpu-template" || created.Config.MachineType != "ct4p-hightpu-4t" {
+		t.Errorf("expected the name and machine type of the Pod, got: %q, %q", created.Name, created.Config.MachineType)
+	}
+	if created.Config.DiskSizeGb != 500 || created.Config.ServiceAccount != "tpu@my-project.iam.gserviceaccount.com" {
+		t.Errorf("expected the disk size and service account of the template, got: %d, %q", created.Config.DiskSizeGb, created.Config.ServiceAccount)
+	}
+	if created.Config.Labels["team"] != "ml" || len(created.Config.Labels) < 2 {
+		t.Errorf("expected the template labels to be merged, got: %v", created.Config.Labels)
+	}
+	if len(created.Config.Taints) == 0 || created.Config.Taints[0].Key != "dedicated" {
+		t.Errorf("expected the template taints to be kept, got: %d taints", len(created.Config.Taints))
+	}
+}
+
+func TestGKE_ValidateCluster(t *testing.T) {
+	for name, c := range map[string]struct {
+		status   int
+		body     string
+		notFound bool
+	}{
+		"exists":    {status: http.StatusOK, body: `{"name": "my-cluster"}`},
+		"not found": {status: http.StatusNotFound, body: `{"error": {"code": 404, "message": "Not found: projects/my-project/locations/us-central2/clusters/my-cluster."}}`, notFound: true},
+		"other":     {status: http.StatusServiceUnavailable, body: `{"error": {"code": 503, "message": "unavailable"}}`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasSuffix(r.URL.Path, "/projects/my-project/locations/us-central2/clusters/my-cluster") {
+					http.Error(w, "unexpected request "+r.URL.Path, http.StatusNotImplemented)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(c.status)
+				w.Write([]byte(c.body))
+			}))
+			defer srv.Close()
+			svc, err := NewService(context.Background(), ServiceConfig{Endpoint: srv.URL + "/", WithoutAuthentication: true})
+			if err != nil {
+				t.Fatalf("creating service: %v", err)
+			}
+			g := &GKE{Service: svc, ClusterContext: GKEContext{ProjectID: "my-project", ClusterLocation: "us-central2", Cluster: "my-cluster"}}
+
+			err = g.ValidateCluster()
+			if (err != nil) != (c.status != http.StatusOK) {
+				t.Fatalf("unexpected result: %v", err)
+			}
+			if errors.Is(err, ErrClusterNotFound) != c.notFound {
+				t.Fatalf("expected ErrClusterNotFound=%v, got: %v", c.notFound, err)
+			}
+		})
+	}
+}
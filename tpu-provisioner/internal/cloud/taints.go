@@ -0,0 +1,137 @@
+package cloud
+
+import (
+	"fmt"
+	"strings"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultTPUTaint is the taint that GKE applies to TPU nodes.
+var DefaultTPUTaint = corev1.Taint{
+	Key:    GoogleTPUResource,
+	Value:  "present",
+	Effect: corev1.TaintEffectNoSchedule,
+}
+
+// SpotTaint is applied to Spot node pools so that only Pods that tolerate
+// Spot VMs are scheduled onto them.
+var SpotTaint = corev1.Taint{
+	Key:    GKESpotNodeSelector,
+	Value:  "true",
+	Effect: corev1.TaintEffectNoSchedule,
+}
+
+// ParseTaints parses a comma-separated list of taints in the same format as
+// kubectl taint, for example: "dedicated=training:NoSchedule,gpu:NoExecute".
+func ParseTaints(spec string) ([]corev1.Taint, error) {
+	var taints []corev1.Taint
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		kv, effect, ok := strings.Cut(s, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid taint %q: missing effect", s)
+		}
+		key, value, _ := strings.Cut(kv, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid taint %q: missing key", s)
+		}
+
+		t := corev1.Taint{Key: key, Value: value, Effect: corev1.TaintEffect(effect)}
+		if _, err := gkeTaintEffect(t.Effect); err != nil {
+			return nil, fmt.Errorf("invalid taint %q: %w", s, err)
+		}
+		taints = append(taints, t)
+	}
+	return taints, nil
+}
+
+// NodePoolTaintsForPod returns the taints that should be applied to the node
+// pool created for the Pod. The taints annotation on the Pod takes precedence
+// over the defaults, which only apply to TPU Pods.
+func NodePoolTaintsForPod(p *corev1.Pod, defaultTPUTaints []corev1.Taint) ([]corev1.Taint, error) {
+	if spec, ok := p.Annotations[AnnotationNodePoolTaints]; ok {
+		taints, err := ParseTaints(spec)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %v annotation: %w", AnnotationNodePoolTaints, err)
+		}
+		return taints, nil
+	}
+	if _, ok := NodeSelectorForPod(p)[GKETPUNodeSelector]; ok {
+		return defaultTPUTaints, nil
+	}
+	return nil, nil
+}
+
+// mergeTaints returns the base taints followed by the other taints. A taint
+// with the same key and effect as a base taint replaces it.
+func mergeTaints(base, taints []corev1.Taint) []corev1.Taint {
+	if len(base) == 0 {
+		return taints
+	}
+	merged := append([]corev1.Taint{}, base...)
+	for _, t := range taints {
+		replaced := false
+		for i := range merged {
+			if merged[i].MatchTaint(&t) {
+				merged[i] = t
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, t)
+		}
+	}
+	return merged
+}
+
+// UntoleratedTaint returns the first taint that the Pod does not tolerate.
+func UntoleratedTaint(p *corev1.Pod, taints []corev1.Taint) (corev1.Taint, bool) {
+	for i := range taints {
+		tolerated := false
+		for j := range p.Spec.Tolerations {
+			if p.Spec.Tolerations[j].ToleratesTaint(&taints[i]) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return taints[i], true
+		}
+	}
+	return corev1.Taint{}, false
+}
+
+func gkeTaintEffect(e corev1.TaintEffect) (string, error) {
+	switch e {
+	case corev1.TaintEffectNoSchedule:
+		return "NO_SCHEDULE", nil
+	case corev1.TaintEffectPreferNoSchedule:
+		return "PREFER_NO_SCHEDULE", nil
+	case corev1.TaintEffectNoExecute:
+		return "NO_EXECUTE", nil
+	}
+	return "", fmt.Errorf("unsupported taint effect %q", e)
+}
+
+func gkeTaints(taints []corev1.Taint) ([]*containerv1beta1.NodeTaint, error) {
+	var out []*containerv1beta1.NodeTaint
+	for _, t := range taints {
+		effect, err := gkeTaintEffect(t.Effect)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, &containerv1beta1.NodeTaint{
+			Key:    t.Key,
+			Value:  t.Value,
+			Effect: effect,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,119 @@
+package cloud
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParseTaints(t *testing.T) {
+	cases := []struct {
+		spec   string
+		taints []corev1.Taint
+		err    bool
+	}{
+		{
+			spec: "",
+		},
+		{
+			spec: "dedicated=training:NoSchedule, gpu:NoExecute",
+			taints: []corev1.Taint{
+				{Key: "dedicated", Value: "training", Effect: corev1.TaintEffectNoSchedule},
+				{Key: "gpu", Effect: corev1.TaintEffectNoExecute},
+			},
+		},
+		{
+			spec: "dedicated=training",
+			err:  true,
+		},
+		{
+			spec: "=training:NoSchedule",
+			err:  true,
+		},
+		{
+			spec: "dedicated=training:Sometimes",
+			err:  true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.spec, func(t *testing.T) {
+			taints, err := ParseTaints(c.spec)
+			if (err != nil) != c.err {
+				t.Fatalf("error: expected: %v, got: %v", c.err, err)
+			}
+			if !reflect.DeepEqual(c.taints, taints) {
+				t.Fatalf("taints: expected: %v, got: %v", c.taints, taints)
+			}
+		})
+	}
+}
+
+func TestUntoleratedTaint(t *testing.T) {
+	taints := []corev1.Taint{DefaultTPUTaint}
+
+	var pod corev1.Pod
+	if _, ok := UntoleratedTaint(&pod, taints); !ok {
+		t.Fatalf("expected Pod without tolerations to not tolerate taint")
+	}
+
+	pod.Spec.Tolerations = []corev1.Toleration{
+		{Key: GoogleTPUResource, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	}
+	if taint, ok := UntoleratedTaint(&pod, taints); ok {
+		t.Fatalf("expected Pod to tolerate taints, got untolerated: %v", taint.ToString())
+	}
+}
+
+func TestGKE_NodePoolTaintsForPod_baseTaints(t *testing.T) {
+	dedicated := corev1.Taint{Key: "dedicated", Value: "tpu-provisioner", Effect: corev1.TaintEffectNoSchedule}
+	g := &GKE{ClusterContext: GKEContext{
+		DefaultTPUTaints: []corev1.Taint{DefaultTPUTaint},
+		BaseTaints:       []corev1.Taint{dedicated},
+	}}
+
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		tpu         bool
+		exp         []corev1.Taint
+	}{
+		{
+			name: "non-TPU pod",
+			exp:  []corev1.Taint{dedicated},
+		},
+		{
+			name: "TPU pod",
+			tpu:  true,
+			exp:  []corev1.Taint{dedicated, DefaultTPUTaint},
+		},
+		{
+			name:        "annotation",
+			tpu:         true,
+			annotations: map[string]string{AnnotationNodePoolTaints: "team=ml:NoExecute"},
+			exp:         []corev1.Taint{dedicated, {Key: "team", Value: "ml", Effect: corev1.TaintEffectNoExecute}},
+		},
+		{
+			name:        "annotation overrides base taint",
+			annotations: map[string]string{AnnotationNodePoolTaints: "dedicated=training:NoSchedule"},
+			exp:         []corev1.Taint{{Key: "dedicated", Value: "training", Effect: corev1.TaintEffectNoSchedule}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := &corev1.Pod{}
+			p.Annotations = c.annotations
+			if c.tpu {
+				p.Spec.NodeSelector = map[string]string{GKETPUNodeSelector: "2x2x1"}
+			}
+			taints, err := g.NodePoolTaintsForPod(p)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(taints, c.exp) {
+				t.Fatalf("expected: %v, got: %v", c.exp, taints)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package cloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+)
+
+// defaultNodePoolTemplateTTL is used when GKE.NodePoolTemplateTTL is not set.
+const defaultNodePoolTemplateTTL = 10 * time.Minute
+
+// nodePoolTemplateCache holds the template node pool fetched last. Missing
+// templates are not cached, so that a template created later is picked up
+// on the next retry.
+type nodePoolTemplateCache struct {
+	mtx       sync.Mutex
+	np        *containerv1beta1.NodePool
+	fetchedAt time.Time
+}
+
+// nodePoolTemplate returns the NodePoolTemplate node pool, fetching it if the
+// cached one is older than NodePoolTemplateTTL. It returns
+// ErrTemplateNotFound if the node pool does not exist.
+func (g *GKE) nodePoolTemplate() (*containerv1beta1.NodePool, error) {
+	ttl := g.NodePoolTemplateTTL
+	if ttl <= 0 {
+		ttl = defaultNodePoolTemplateTTL
+	}
+	c := &g.templateCache
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.np != nil && time.Since(c.fetchedAt) < ttl {
+		return c.np, nil
+	}
+	np, err := g.getNodePool(g.NodePoolTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("getting node pool template %s: %w", g.NodePoolTemplate, err)
+	}
+	if np == nil {
+		return nil, fmt.Errorf("%w: node pool %s does not exist in the cluster", ErrTemplateNotFound, g.NodePoolTemplate)
+	}
+	c.np, c.fetchedAt = np, time.Now()
+	return np, nil
+}
+
+// applyNodePoolTemplate returns a copy of the NodePoolTemplate node pool with
+// the parts of np that the provisioner derives from the Pod: the name, the
+// machine type and accelerators, the size, placement, locations and
+// autoscaling, Spot, reservation and sandbox, and the version if set. The labels,
+// taints and sysctls of np are added to those of the template, and its kubelet
+// settings replace the template's if set. Everything else (disks,
+// image, identity, network, management) is taken from the template, but for
+// the management settings if the template has none.
+func (g *GKE) applyNodePoolTemplate(np *containerv1beta1.NodePool) (*containerv1beta1.NodePool, error) {
+	tmpl, err := g.nodePoolTemplate()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cloneNodePool(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("copying node pool template %s: %w", g.NodePoolTemplate, err)
+	}
+
+	// Output-only fields of the template.
+	out.Status, out.StatusMessage, out.SelfLink, out.Etag = "", "", "", ""
+	out.Conditions, out.InstanceGroupUrls, out.UpdateInfo = nil, nil, nil
+	if out.Management != nil {
+		out.Management.UpgradeOptions = nil
+	} else {
+		out.Management = np.Management
+	}
+	if out.NetworkConfig != nil {
+		// The template's Pod range is reused, not its CIDR block.
+		out.NetworkConfig.PodIpv4CidrBlock = ""
+		out.NetworkConfig.PodIpv4RangeUtilization = 0
+		out.NetworkConfig.CreatePodRange = false
+	}
+
+	out.Name = np.Name
+	out.InitialNodeCount = np.InitialNodeCount
+	out.Autoscaling = np.Autoscaling
+	out.Locations = np.Locations
+	out.PlacementPolicy = np.PlacementPolicy
+	if np.Version != "" {
+		out.Version = np.Version
+	}
+	if out.Config == nil {
+		out.Config = &containerv1beta1.NodeConfig{}
+	}
+	out.Config.MachineType = np.Config.MachineType
+	out.Config.Accelerators = np.Config.Accelerators
+	out.Config.Spot = np.Config.Spot
+	out.Config.ReservationAffinity = np.Config.ReservationAffinity
+	out.Config.SandboxConfig = np.Config.SandboxConfig
+	if np.Config.Gvnic != nil {
+		out.Config.Gvnic = np.Config.Gvnic
+	}
+	if np.Config.KubeletConfig != nil {
+		out.Config.KubeletConfig = np.Config.KubeletConfig
+	}
+	if np.Config.LinuxNodeConfig != nil {
+		if out.Config.LinuxNodeConfig == nil {
+			out.Config.LinuxNodeConfig = &containerv1beta1.LinuxNodeConfig{}
+		}
+		out.Config.LinuxNodeConfig.Sysctls = mergeLabels(out.Config.LinuxNodeConfig.Sysctls, np.Config.LinuxNodeConfig.Sysctls)
+	}
+	if np.Config.ResourceManagerTags != nil {
+		if out.Config.ResourceManagerTags == nil {
+			out.Config.ResourceManagerTags = &containerv1beta1.ResourceManagerTags{}
+		}
+		out.Config.ResourceManagerTags.Tags = mergeLabels(out.Config.ResourceManagerTags.Tags, np.Config.ResourceManagerTags.Tags)
+	}
+	out.Config.Labels = mergeLabels(out.Config.Labels, np.Config.Labels)
+	out.Config.ResourceLabels = mergeLabels(out.Config.ResourceLabels, np.Config.ResourceLabels)
+	out.Config.Taints = mergeNodeTaints(out.Config.Taints, np.Config.Taints)
+	return out, nil
+}
+
+// cloneNodePool returns a deep copy of the node pool.
+func cloneNodePool(np *containerv1beta1.NodePool) (*containerv1beta1.NodePool, error) {
+	b, err := json.Marshal(np)
+	if err != nil {
+		return nil, err
+	}
+	var out containerv1beta1.NodePool
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// mergeLabels returns the labels of base with those of override added,
+// override taking precedence.
+func mergeLabels(base, override map[string]string) map[string]string {
+	out := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range override {
+		out[k] = v
+	}
+	return out
+}
+
+// mergeNodeTaints is mergeTaints for GKE node taints: the base taints with
+// the same key and effect as one of the other taints are replaced by it.
+func mergeNodeTaints(base, taints []*containerv1beta1.NodeTaint) []*containerv1beta1.NodeTaint {
+	var merged []*containerv1beta1.NodeTaint
+	for _, b := range base {
+		replaced := false
+		for _, t := range taints {
+			if t.Key == b.Key && t.Effect == b.Effect {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, b)
+		}
+	}
+	return append(merged, taints...)
+}
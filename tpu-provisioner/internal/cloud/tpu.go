@@ -0,0 +1,122 @@
+package cloud
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// tpuAccelerator describes a TPU accelerator type (the value of the
+// cloud.google.com/gke-tpu-accelerator node selector).
+type tpuAccelerator struct {
+	// MachineTypePrefix is combined with the number of chips per VM to form
+	// the machine type, for example "ct4p-hightpu-" + "4t".
+	MachineTypePrefix string
+	// TopologyDims is the number of dimensions of a valid topology.
+	TopologyDims int
+	// ChipsPerVM lists the supported numbers of chips per VM (the TPU
+	// request of a Pod).
+	ChipsPerVM []int
+	// Topologies, if set, is the exhaustive list of supported topologies.
+	Topologies []string
+}
+
+// tpuAccelerators is the compatibility table for supported TPU generations.
+// Add an entry here when a new generation becomes available.
+var tpuAccelerators = map[string]tpuAccelerator{
+	V4PodSliceAccelerator: {
+		MachineTypePrefix: "ct4p-hightpu-",
+		TopologyDims:      3,
+		ChipsPerVM:        []int{4},
+	},
+	V5ePodSliceAccelerator: {
+		MachineTypePrefix: "ct5lp-hightpu-",
+		TopologyDims:      2,
+		ChipsPerVM:        []int{1, 4, 8},
+		Topologies:        []string{"1x1", "2x2", "2x4", "4x4", "4x8", "8x8", "8x16", "16x16"},
+	},
+	V5pPodSliceAccelerator: {
+		MachineTypePrefix: "ct5p-hightpu-",
+		TopologyDims:      3,
+		ChipsPerVM:        []int{4},
+	},
+}
+
+// ValidateTPUPod checks the TPU accelerator, topology and TPU request of the
+// Pod against the compatibility table. It returns an error wrapping
+// ErrInvalidTPUConfig if the combination can never be provisioned. Pods that
+// do not select a TPU topology are not validated. The TPU request is the sum
+// of the requests of tpuResources (GoogleTPUResource if none).
+func ValidateTPUPod(p *corev1.Pod, tpuResources ...string) error {
+	nodeSelector := NodeSelectorForPod(p)
+	topo, ok := nodeSelector[GKETPUNodeSelector]
+	if !ok {
+		return nil
+	}
+	tpuRequest, err := sumResourceRequests(p, GKEContext{TPUResources: tpuResources}.tpuResources()...)
+	if err != nil {
+		return fmt.Errorf("%w: summing TPU requests: %v", ErrInvalidTPUConfig, err)
+	}
+	return validateTPUConfig(nodeSelector[GKEAcceleratorNodeSelector], topo, tpuRequest)
+}
+
+func validateTPUConfig(accel, topo string, tpuRequest int) error {
+	a, ok := tpuAccelerators[accel]
+	if !ok {
+		return fmt.Errorf("%w: unsupported accelerator %q", ErrInvalidTPUConfig, accel)
+	}
+	chips, err := parseTPUTopology(a, topo)
+	if err != nil {
+		return fmt.Errorf("%w: %v is not a valid topology for %v: %v", ErrInvalidTPUConfig, topo, accel, err)
+	}
+	if len(a.Topologies) > 0 && !containsString(a.Topologies, topo) {
+		return fmt.Errorf("%w: topology %v is not supported for %v, supported topologies: %v", ErrInvalidTPUConfig, topo, accel, strings.Join(a.Topologies, ", "))
+	}
+	if !containsInt(a.ChipsPerVM, tpuRequest) {
+		return fmt.Errorf("%w: requesting %d TPU chips is not supported for %v, supported requests: %v", ErrInvalidTPUConfig, tpuRequest, accel, a.ChipsPerVM)
+	}
+	if chips%tpuRequest != 0 {
+		return fmt.Errorf("%w: topology %v (%d chips) cannot be divided into VMs of %d chips", ErrInvalidTPUConfig, topo, chips, tpuRequest)
+	}
+	return nil
+}
+
+// parseTPUTopology returns the number of chips in the topology.
+func parseTPUTopology(a tpuAccelerator, topo string) (int, error) {
+	split := strings.Split(topo, "x")
+	if len(split) != a.TopologyDims {
+		return 0, fmt.Errorf("expected %v dimensions", a.TopologyDims)
+	}
+	product := 1
+	for _, s := range split {
+		x, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("could not convert %q to int: %w", s, err)
+		}
+		if x < 1 {
+			return 0, fmt.Errorf("dimension %v must be positive", x)
+		}
+		product *= x
+	}
+	return product, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, n int) bool {
+	for _, x := range list {
+		if x == n {
+			return true
+		}
+	}
+	return false
+}
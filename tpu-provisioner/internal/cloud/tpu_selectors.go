@@ -0,0 +1,107 @@
+package cloud
+
+import (
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Policies for TPU Pods that select only one of the accelerator type
+// (GKEAcceleratorNodeSelector) and the topology (GKETPUNodeSelector), see
+// CompleteTPUSelectors.
+const (
+	// IncompleteSelectorReject rejects the Pods with
+	// ErrIncompleteTPUSelector, naming the missing node selector.
+	IncompleteSelectorReject = "reject"
+	// IncompleteSelectorDefault fills the missing node selector from the
+	// accelerator defaults: the Topology of the accelerator type, or the
+	// accelerator type that is the Default.
+	IncompleteSelectorDefault = "default"
+)
+
+// ValidateIncompleteSelectorPolicy returns an error unless the policy is
+// empty (IncompleteSelectorReject), IncompleteSelectorReject or
+// IncompleteSelectorDefault.
+func ValidateIncompleteSelectorPolicy(policy string) error {
+	switch policy {
+	case "", IncompleteSelectorReject, IncompleteSelectorDefault:
+		return nil
+	}
+	return fmt.Errorf("invalid incomplete TPU selector policy %q, must be %q or %q", policy, IncompleteSelectorReject, IncompleteSelectorDefault)
+}
+
+// HasTPUSelector returns true if the Pod selects a TPU accelerator type or a
+// TPU topology.
+func HasTPUSelector(p *corev1.Pod) bool {
+	nodeSelector := NodeSelectorForPod(p)
+	_, accel := nodeSelector[GKEAcceleratorNodeSelector]
+	_, topo := nodeSelector[GKETPUNodeSelector]
+	return accel || topo
+}
+
+// CompleteTPUSelectors returns the Pod if it selects both or neither of the
+// TPU accelerator type and topology. If it selects only one of them, the
+// policy applies: IncompleteSelectorDefault returns a copy of the Pod whose
+// spec.nodeSelector has the missing one from the accelerator defaults,
+// otherwise (and if the defaults have none) it returns
+// ErrIncompleteTPUSelector naming the missing node selector.
+func CompleteTPUSelectors(p *corev1.Pod, policy string, defaults map[string]AcceleratorDefaults) (*corev1.Pod, error) {
+	nodeSelector := NodeSelectorForPod(p)
+	accel, hasAccel := nodeSelector[GKEAcceleratorNodeSelector]
+	topo, hasTopo := nodeSelector[GKETPUNodeSelector]
+	if hasAccel == hasTopo {
+		return p, nil
+	}
+
+	selected, missing, value := GKEAcceleratorNodeSelector, GKETPUNodeSelector, accel
+	if hasTopo {
+		selected, missing, value = GKETPUNodeSelector, GKEAcceleratorNodeSelector, topo
+	}
+	if policy != IncompleteSelectorDefault {
+		return nil, fmt.Errorf("%w: the Pod selects %s=%s but is missing the %s node selector", ErrIncompleteTPUSelector, selected, value, missing)
+	}
+	var fill string
+	if hasAccel {
+		fill = defaults[accel].Topology
+	} else {
+		fill = defaultAccelerator(defaults)
+	}
+	if fill == "" {
+		return nil, fmt.Errorf("%w: the Pod selects %s=%s but is missing the %s node selector, and the accelerator defaults have no default for it", ErrIncompleteTPUSelector, selected, value, missing)
+	}
+
+	out := p.DeepCopy()
+	if out.Spec.NodeSelector == nil {
+		out.Spec.NodeSelector = map[string]string{}
+	}
+	out.Spec.NodeSelector[missing] = fill
+	return out, nil
+}
+
+// defaultAccelerator returns the accelerator type whose defaults are the
+// Default, or "" if there is none.
+func defaultAccelerator(defaults map[string]AcceleratorDefaults) string {
+	for accel, d := range defaults {
+		if d.Default {
+			return accel
+		}
+	}
+	return ""
+}
+
+// validateDefaultAccelerator returns an error if more than one accelerator
+// type is the Default.
+func validateDefaultAccelerator(defaults map[string]AcceleratorDefaults) error {
+	var accels []string
+	for accel, d := range defaults {
+		if d.Default {
+			accels = append(accels, accel)
+		}
+	}
+	if len(accels) > 1 {
+		sort.Strings(accels)
+		return fmt.Errorf("only one accelerator type can be the default, got: %v", accels)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package cloud
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestCompleteTPUSelectors(t *testing.T) {
+	defaults := map[string]AcceleratorDefaults{
+		V5ePodSliceAccelerator: {Topology: "2x4"},
+		V5pPodSliceAccelerator: {Default: true},
+	}
+	pod := func(nodeSelector map[string]string) *corev1.Pod {
+		p := &corev1.Pod{}
+		p.Spec.NodeSelector = nodeSelector
+		return p
+	}
+
+	cases := []struct {
+		name         string
+		nodeSelector map[string]string
+		policy       string
+		defaults     map[string]AcceleratorDefaults
+		// exp is the expected filled in node selector, missing the one
+		// named in the error otherwise.
+		exp     map[string]string
+		missing string
+	}{
+		{
+			name:         "complete",
+			nodeSelector: map[string]string{GKEAcceleratorNodeSelector: V4PodSliceAccelerator, GKETPUNodeSelector: "2x2x2"},
+			exp:          map[string]string{GKEAcceleratorNodeSelector: V4PodSliceAccelerator, GKETPUNodeSelector: "2x2x2"},
+		},
+		{
+			name:         "not a TPU Pod",
+			nodeSelector: map[string]string{"pool": "cpu"},
+			exp:          map[string]string{"pool": "cpu"},
+		},
+		{
+			name:         "missing topology rejected",
+			nodeSelector: map[string]string{GKEAcceleratorNodeSelector: V5ePodSliceAccelerator},
+			policy:       IncompleteSelectorReject,
+			defaults:     defaults,
+			missing:      GKETPUNodeSelector,
+		},
+		{
+			name:         "missing accelerator rejected by default",
+			nodeSelector: map[string]string{GKETPUNodeSelector: "2x2x1"},
+			defaults:     defaults,
+			missing:      GKEAcceleratorNodeSelector,
+		},
+		{
+			name:         "topology from defaults",
+			nodeSelector: map[string]string{GKEAcceleratorNodeSelector: V5ePodSliceAccelerator},
+			policy:       IncompleteSelectorDefault,
+			defaults:     defaults,
+			exp:          map[string]string{GKEAcceleratorNodeSelector: V5ePodSliceAccelerator, GKETPUNodeSelector: "2x4"},
+		},
+		{
+			name:         "default accelerator",
+			nodeSelector: map[string]string{GKETPUNodeSelector: "2x2x1"},
+			policy:       IncompleteSelectorDefault,
+			defaults:     defaults,
+			exp:          map[string]string{GKEAcceleratorNodeSelector: V5pPodSliceAccelerator, GKETPUNodeSelector: "2x2x1"},
+		},
+		{
+			name:         "no default topology",
+			nodeSelector: map[string]string{GKEAcceleratorNodeSelector: V4PodSliceAccelerator},
+			policy:       IncompleteSelectorDefault,
+			defaults:     defaults,
+			missing:      GKETPUNodeSelector,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := pod(c.nodeSelector)
+			out, err := CompleteTPUSelectors(p, c.policy, c.defaults)
+			if c.missing != "" {
+				if !errors.Is(err, ErrIncompleteTPUSelector) || !strings.Contains(err.Error(), "missing the "+c.missing+" node selector") {
+					t.Fatalf("expected %v naming %s, got: %v", ErrIncompleteTPUSelector, c.missing, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := NodeSelectorForPod(out); !reflect.DeepEqual(got, c.exp) {
+				t.Fatalf("expected node selector: %v, got: %v", c.exp, got)
+			}
+			if len(p.Spec.NodeSelector) != len(c.nodeSelector) {
+				t.Fatalf("expected the Pod not to be changed, got: %v", p.Spec.NodeSelector)
+			}
+		})
+	}
+}
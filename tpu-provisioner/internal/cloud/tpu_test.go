@@ -0,0 +1,66 @@
+package cloud
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func Test_validateTPUConfig(t *testing.T) {
+	cases := []struct {
+		accel      string
+		topo       string
+		tpuRequest int
+		err        bool
+	}{
+		{accel: V4PodSliceAccelerator, topo: "2x2x4", tpuRequest: 4},
+		{accel: V5pPodSliceAccelerator, topo: "2x2x1", tpuRequest: 4},
+		{accel: V5ePodSliceAccelerator, topo: "1x1", tpuRequest: 1},
+		{accel: V5ePodSliceAccelerator, topo: "2x4", tpuRequest: 8},
+		{accel: V5ePodSliceAccelerator, topo: "4x4", tpuRequest: 4},
+		// v5e topology on a v4 accelerator.
+		{accel: V4PodSliceAccelerator, topo: "2x4", tpuRequest: 4, err: true},
+		// v4 topology on a v5e accelerator.
+		{accel: V5ePodSliceAccelerator, topo: "2x2x2", tpuRequest: 4, err: true},
+		{accel: V5ePodSliceAccelerator, topo: "3x3", tpuRequest: 1, err: true},
+		{accel: V4PodSliceAccelerator, topo: "2x2x4", tpuRequest: 8, err: true},
+		{accel: V5ePodSliceAccelerator, topo: "1x1", tpuRequest: 4, err: true},
+		{accel: V4PodSliceAccelerator, topo: "0x2x2", tpuRequest: 4, err: true},
+		{accel: "tpu-v1", topo: "2x2", tpuRequest: 4, err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%v_%v_%v", c.accel, c.topo, c.tpuRequest), func(t *testing.T) {
+			err := validateTPUConfig(c.accel, c.topo, c.tpuRequest)
+			if (err != nil) != c.err {
+				t.Fatalf("error: expected: %v, got: %v", c.err, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidTPUConfig) {
+				t.Fatalf("expected ErrInvalidTPUConfig, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateTPUPod_resources(t *testing.T) {
+	p := &corev1.Pod{}
+	p.Spec.NodeSelector = map[string]string{
+		GKETPUNodeSelector:         "2x2x1",
+		GKEAcceleratorNodeSelector: V4PodSliceAccelerator,
+	}
+	p.Spec.Containers = []corev1.Container{{
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{"example.com/tpu": resource.MustParse("4")},
+		},
+	}}
+
+	if err := ValidateTPUPod(p); !errors.Is(err, ErrInvalidTPUConfig) {
+		t.Fatalf("default resource: expected ErrInvalidTPUConfig, got: %v", err)
+	}
+	if err := ValidateTPUPod(p, GoogleTPUResource, "example.com/tpu"); err != nil {
+		t.Fatalf("alternative resource: unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"google.golang.org/api/googleapi"
+)
+
+// transientErrorMessages are parts of the messages of network errors that
+// reach the provider flattened into a string, for example by the token
+// source of the metadata server credentials.
+var transientErrorMessages = []string{
+	"connection reset by peer",
+	"connection refused",
+	"broken pipe",
+	"no such host",
+	"server misbehaving",
+	"temporary failure in name resolution",
+	"i/o timeout",
+	"tls handshake timeout",
+	"unexpected eof",
+	"network is unreachable",
+}
+
+// isTransientError returns true if err is a network or transport error, such
+// as a DNS lookup failure, a refused or reset connection or a timeout, that
+// happened before GKE answered. Errors answered by the API, such as exceeded
+// quotas or denied permissions, are never transient, and neither are
+// failures of the create hooks, which are not calls to GKE.
+func isTransientError(err error) bool {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) || errors.Is(err, ErrCreateHookFailed) {
+		return false
+	}
+	// A call that exceeded its APITimeouts.
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	for _, target := range []error{io.ErrUnexpectedEOF, syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.EPIPE,
+		syscall.ETIMEDOUT, syscall.EHOSTUNREACH, syscall.ENETUNREACH} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range transientErrorMessages {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyTransientError wraps err with ErrTransient if it is a network or
+// transport error, see isTransientError.
+func classifyTransientError(err error) error {
+	if err == nil || errors.Is(err, ErrTransient) || !isTransientError(err) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrTransient, err)
+}
@@ -0,0 +1,107 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestClassifyTransientError(t *testing.T) {
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Post", URL: "https://container.googleapis.com/v1beta1/projects/my-project/locations/us-central2/clusters/my-cluster/nodePools", Err: err}
+	}
+	cases := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{
+			name:      "DNS lookup failure",
+			err:       urlErr(&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "container.googleapis.com", IsNotFound: true}}),
+			transient: true,
+		},
+		{
+			name:      "connection refused by the metadata server",
+			err:       urlErr(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}),
+			transient: true,
+		},
+		{
+			name:      "connection reset",
+			err:       fmt.Errorf("checking if node pool exists: %w", urlErr(&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)})),
+			transient: true,
+		},
+		{
+			name:      "unexpected EOF",
+			err:       urlErr(io.ErrUnexpectedEOF),
+			transient: true,
+		},
+		{
+			name:      "client timeout",
+			err:       urlErr(timeoutError{}),
+			transient: true,
+		},
+		{
+			name:      "call timeout",
+			err:       fmt.Errorf("getting operation: %w", context.DeadlineExceeded),
+			transient: true,
+		},
+		{
+			name:      "flattened token source error",
+			err:       errors.New(`oauth2: cannot fetch token: Get "http://169.254.169.254/computeMetadata/v1/instance/service-accounts/default/token": dial tcp 169.254.169.254:80: i/o timeout`),
+			transient: true,
+		},
+		{
+			name: "quota exceeded",
+			err:  &googleapi.Error{Code: http.StatusTooManyRequests, Message: "Quota 'TPUS' exceeded"},
+		},
+		{
+			name: "permission denied",
+			err:  fmt.Errorf("do: %w", &googleapi.Error{Code: http.StatusForbidden, Message: "Required 'container.clusters.update' permission"}),
+		},
+		{
+			name: "API error mentioning a timeout",
+			err:  &googleapi.Error{Code: http.StatusBadRequest, Message: "i/o timeout talking to the node"},
+		},
+		{
+			name: "reconcile cancelled",
+			err:  urlErr(context.Canceled),
+		},
+		{
+			name: "other error",
+			err:  errors.New("boom"),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := classifyTransientError(c.err)
+			if got := errors.Is(err, ErrTransient); got != c.transient {
+				t.Fatalf("expected transient: %v, got: %v (%v)", c.transient, got, err)
+			}
+		})
+	}
+
+	if classifyTransientError(nil) != nil {
+		t.Fatal("expected no error")
+	}
+	wrapped := fmt.Errorf("%w: connection reset by peer", ErrTransient)
+	if got := classifyTransientError(wrapped); got != wrapped {
+		t.Fatalf("expected transient errors to be returned as is, got: %v", got)
+	}
+}
+
+// timeoutError is a net.Error that timed out, as returned when the timeout
+// of an http.Client expires.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "Client.Timeout exceeded while awaiting headers" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
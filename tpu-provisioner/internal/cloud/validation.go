@@ -0,0 +1,25 @@
+package cloud
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ValidatePod checks a TPU Pod the same way that the GKE provider does when it
+// creates the node pool for the Pod: the TPU configuration (see
+// ValidateTPUPod) and the node pool annotations, see nodePoolSettingsForPod.
+// Provisioner defaults are not taken into account, so only errors caused by
+// the Pod itself are reported. Pods that do not select a TPU topology are not
+// validated. tpuResources are the TPU resource names as in ValidateTPUPod.
+func ValidatePod(p *corev1.Pod, tpuResources ...string) error {
+	if err := ValidateTPUPod(p, tpuResources...); err != nil {
+		return err
+	}
+	if _, ok := NodeSelectorForPod(p)[GKETPUNodeSelector]; !ok {
+		return nil
+	}
+	g := &GKE{ClusterContext: GKEContext{TPUResources: tpuResources}}
+	if _, err := g.nodePoolSettingsForPod(p, NodePoolRequest{}, nil); err != nil {
+		return invalidNodePoolConfig(err)
+	}
+	return nil
+}
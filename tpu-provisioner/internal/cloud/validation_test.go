@@ -0,0 +1,63 @@
+package cloud
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestValidatePod(t *testing.T) {
+	pod := func(accel, topo string, tpus string, annotations map[string]string) *corev1.Pod {
+		p := &corev1.Pod{}
+		p.Annotations = annotations
+		p.Spec.NodeSelector = map[string]string{
+			GKETPUNodeSelector:         topo,
+			GKEAcceleratorNodeSelector: accel,
+		}
+		p.Spec.Containers = []corev1.Container{{
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{GoogleTPUResource: resource.MustParse(tpus)},
+			},
+		}}
+		return p
+	}
+
+	cases := []struct {
+		name string
+		pod  *corev1.Pod
+		exp  error
+	}{
+		{name: "not a TPU pod", pod: &corev1.Pod{}},
+		{name: "valid", pod: pod(V4PodSliceAccelerator, "2x2x2", "4", map[string]string{AnnotationSpot: "true", AnnotationDiskSizeGB: "200"})},
+		{name: "invalid topology", pod: pod(V4PodSliceAccelerator, "2x2", "4", nil), exp: ErrInvalidTPUConfig},
+		{name: "missing accelerator", pod: pod("", "2x2x2", "4", nil), exp: ErrInvalidTPUConfig},
+		{name: "invalid spot", pod: pod(V4PodSliceAccelerator, "2x2x2", "4", map[string]string{AnnotationSpot: "maybe"}), exp: ErrInvalidNodePoolConfig},
+		{
+			name: "spot and reservation",
+			pod:  pod(V4PodSliceAccelerator, "2x2x2", "4", map[string]string{AnnotationSpot: "true", AnnotationReservation: "my-reservation"}),
+			exp:  ErrInvalidNodePoolConfig,
+		},
+		{name: "invalid taints", pod: pod(V4PodSliceAccelerator, "2x2x2", "4", map[string]string{AnnotationNodePoolTaints: "dedicated"}), exp: ErrInvalidNodePoolConfig},
+		{name: "disk too small", pod: pod(V4PodSliceAccelerator, "2x2x2", "4", map[string]string{AnnotationDiskSizeGB: "1"}), exp: ErrInvalidDiskConfig},
+		{name: "local SSDs on TPU", pod: pod(V4PodSliceAccelerator, "2x2x2", "4", map[string]string{AnnotationLocalSSDCount: "1"}), exp: ErrInvalidDiskConfig},
+		{name: "invalid service account", pod: pod(V4PodSliceAccelerator, "2x2x2", "4", map[string]string{AnnotationServiceAccount: "nodes"}), exp: ErrInvalidServiceAccount},
+		{name: "autoscaling below slice size", pod: pod(V4PodSliceAccelerator, "2x2x2", "4", map[string]string{AnnotationAutoscalingMax: "1"}), exp: ErrInvalidNodePoolConfig},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidatePod(c.pod)
+			if c.exp == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, c.exp) {
+				t.Fatalf("expected %v, got: %v", c.exp, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package cloud
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Node version aliases accepted in addition to explicit GKE versions.
+const (
+	NodeVersionLatest              = "latest"
+	NodeVersionCurrentControlPlane = "current-control-plane"
+)
+
+// nodeVersionPattern matches the GKE version formats "1.X", "1.X.Y" and
+// "1.X.Y-gke.N".
+var nodeVersionPattern = regexp.MustCompile(`^1\.(\d+)(?:\.(\d+)(?:-gke\.(\d+))?)?$`)
+
+// minTPUNodeVersions are the oldest GKE versions that support the TPU machine
+// types with the given prefix.
+var minTPUNodeVersions = map[string]string{
+	"ct4p-":  "1.26.1-gke.1500",
+	"ct5lp-": "1.27.2-gke.2100",
+	"ct5p-":  "1.28.3-gke.1024000",
+}
+
+// ValidateNodeVersion returns an error if v is not a GKE version, "latest" or
+// "current-control-plane". An empty version is valid and uses the GKE
+// default.
+func ValidateNodeVersion(v string) error {
+	if v == "" || v == NodeVersionLatest || v == NodeVersionCurrentControlPlane {
+		return nil
+	}
+	if !nodeVersionPattern.MatchString(v) {
+		return fmt.Errorf("%w: invalid node version %q, must be of the form 1.X, 1.X.Y or 1.X.Y-gke.N, %q or %q",
+			ErrIncompatibleNodeVersion, v, NodeVersionLatest, NodeVersionCurrentControlPlane)
+	}
+	return nil
+}
+
+// nodeVersionFor returns the value of the node pool version field for the
+// configured node version and machine type, ErrIncompatibleNodeVersion if
+// the version is known to not support the machine type.
+func nodeVersionFor(v, machineType string) (string, error) {
+	if err := ValidateNodeVersion(v); err != nil {
+		return "", err
+	}
+	switch v {
+	case "", NodeVersionLatest:
+		return v, nil
+	case NodeVersionCurrentControlPlane:
+		// The GKE API uses "-" for the version of the control plane.
+		return "-", nil
+	}
+	for prefix, min := range minTPUNodeVersions {
+		if strings.HasPrefix(machineType, prefix) && versionBefore(v, min) {
+			return "", fmt.Errorf("%w: machine type %q requires node version %v or later, got %v",
+				ErrIncompatibleNodeVersion, machineType, min, v)
+		}
+	}
+	return v, nil
+}
+
+// versionBefore returns true if the version v is older than min. Only the
+// components present in v are compared, so "1.28" is not before
+// "1.28.3-gke.1024000".
+func versionBefore(v, min string) bool {
+	a, b := versionComponents(v), versionComponents(min)
+	for i := range a {
+		if a[i] < 0 {
+			return false
+		}
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// versionComponents returns the minor, patch and GKE patch numbers of a
+// version matching nodeVersionPattern, -1 for missing components.
+func versionComponents(v string) [3]int {
+	c := [3]int{-1, -1, -1}
+	m := nodeVersionPattern.FindStringSubmatch(v)
+	if m == nil {
+		return c
+	}
+	for i, s := range m[1:] {
+		if s == "" {
+			continue
+		}
+		c[i], _ = strconv.Atoi(s)
+	}
+	return c
+}
@@ -0,0 +1,63 @@
+package cloud
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateNodeVersion(t *testing.T) {
+	cases := []struct {
+		version string
+		err     bool
+	}{
+		{version: ""},
+		{version: "latest"},
+		{version: "current-control-plane"},
+		{version: "1.29"},
+		{version: "1.29.1"},
+		{version: "1.29.1-gke.1589017"},
+		{version: "v1.29.1", err: true},
+		{version: "1.29.1-gke", err: true},
+		{version: "stable", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.version, func(t *testing.T) {
+			err := ValidateNodeVersion(c.version)
+			if c.err != errors.Is(err, ErrIncompatibleNodeVersion) {
+				t.Fatalf("expected error: %v, got: %v", c.err, err)
+			}
+		})
+	}
+}
+
+func Test_nodeVersionFor(t *testing.T) {
+	cases := []struct {
+		version     string
+		machineType string
+		exp         string
+		err         bool
+	}{
+		{version: "", machineType: "ct5p-hightpu-4t", exp: ""},
+		{version: "latest", machineType: "ct5p-hightpu-4t", exp: "latest"},
+		{version: "current-control-plane", machineType: "ct5p-hightpu-4t", exp: "-"},
+		{version: "1.28.3-gke.1024000", machineType: "ct5p-hightpu-4t", exp: "1.28.3-gke.1024000"},
+		{version: "1.28", machineType: "ct5p-hightpu-4t", exp: "1.28"},
+		{version: "1.28.3-gke.1000", machineType: "ct5p-hightpu-4t", err: true},
+		{version: "1.27.5", machineType: "ct5p-hightpu-4t", err: true},
+		{version: "1.27.5", machineType: "ct5lp-hightpu-4t", exp: "1.27.5"},
+		{version: "1.20", machineType: "g2-standard-4", exp: "1.20"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.version+"_"+c.machineType, func(t *testing.T) {
+			v, err := nodeVersionFor(c.version, c.machineType)
+			if c.err != errors.Is(err, ErrIncompatibleNodeVersion) {
+				t.Fatalf("expected error: %v, got: %v", c.err, err)
+			}
+			if v != c.exp {
+				t.Fatalf("expected: %q, got: %q", c.exp, v)
+			}
+		})
+	}
+}
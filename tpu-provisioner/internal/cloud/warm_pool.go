@@ -0,0 +1,363 @@
+package cloud
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+// Values of the LabelWarmNodePool label.
+const (
+	// WarmNodePoolAvailable marks warm node pools that wait to be claimed.
+	// The provisioner never deletes them as idle.
+	WarmNodePoolAvailable = "available"
+	// WarmNodePoolClaimed marks warm node pools that were claimed for a
+	// workload, they are managed like other node pools from then on.
+	WarmNodePoolClaimed = "claimed"
+)
+
+// warmNodePoolParentKind is the parent kind of warm node pools until they are
+// claimed.
+const warmNodePoolParentKind = "WarmNodePool"
+
+// WarmNodePoolShape is a TPU slice shape that the provisioner keeps Count
+// idle node pools of, see GKE.WarmNodePools.
+type WarmNodePoolShape struct {
+	Accelerator string
+	Topology    string
+	// Chips is the number of TPU chips per VM (the TPU request of the
+	// Pods), by default the chips of the topology divided among its nodes.
+	Chips int
+	Count int
+}
+
+// String returns the shape in the format of ParseWarmNodePools, without the
+// count.
+func (s WarmNodePoolShape) String() string {
+	return s.Accelerator + "/" + s.Topology + "/" + strconv.Itoa(s.Chips)
+}
+
+// label returns the shape as a LabelWarmNodePoolShape label value.
+func (s WarmNodePoolShape) label() string {
+	return s.Accelerator + "." + s.Topology + "." + strconv.Itoa(s.Chips)
+}
+
+// ParseWarmNodePools parses a comma-separated list of warm node pool shapes,
+// each accelerator/topology[/chips]=count, for example
+// "tpu-v5-lite-podslice/2x4=2,tpu-v5p-slice/2x2x2=1".
+func ParseWarmNodePools(spec string) ([]WarmNodePoolShape, error) {
+	var shapes []WarmNodePoolShape
+	seen := map[string]bool{}
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		shapeSpec, countSpec, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid warm node pool %q, must be accelerator/topology[/chips]=count", s)
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(countSpec))
+		if err != nil || count < 1 {
+			return nil, fmt.Errorf("invalid warm node pool count %q of %q, must be a positive integer", countSpec, s)
+		}
+		parts := strings.Split(strings.TrimSpace(shapeSpec), "/")
+		if len(parts) != 2 && len(parts) != 3 {
+			return nil, fmt.Errorf("invalid warm node pool %q, must be accelerator/topology[/chips]=count", s)
+		}
+		shape := WarmNodePoolShape{Accelerator: parts[0], Topology: parts[1], Count: count}
+		if len(parts) == 3 {
+			if shape.Chips, err = strconv.Atoi(parts[2]); err != nil {
+				return nil, fmt.Errorf("invalid chips per VM of warm node pool %q: %v", s, err)
+			}
+		} else if shape.Chips, err = defaultWarmNodePoolChips(shape.Accelerator, shape.Topology); err != nil {
+			return nil, fmt.Errorf("warm node pool %q: %w", s, err)
+		}
+		if err := validateTPUConfig(shape.Accelerator, shape.Topology, shape.Chips); err != nil {
+			return nil, fmt.Errorf("warm node pool %q: %w", s, err)
+		}
+		if seen[shape.String()] {
+			return nil, fmt.Errorf("duplicate warm node pool %q", shape)
+		}
+		seen[shape.String()] = true
+		shapes = append(shapes, shape)
+	}
+	return shapes, nil
+}
+
+// defaultWarmNodePoolChips returns the chips per VM of the topology when its
+// chips are divided among the nodes of TPUTopologyToNodeCount.
+func defaultWarmNodePoolChips(accel, topo string) (int, error) {
+	a, ok := tpuAccelerators[accel]
+	if !ok {
+		return 0, fmt.Errorf("%w: unsupported accelerator %q", ErrInvalidTPUConfig, accel)
+	}
+	chips, err := parseTPUTopology(a, topo)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v is not a valid topology for %v: %v", ErrInvalidTPUConfig, topo, accel, err)
+	}
+	nodes, _ := TPUTopologyToNodeCount(accel, topo)
+	if nodes < 1 {
+		nodes = 1
+	}
+	return chips / nodes, nil
+}
+
+// warmNodePoolPod returns the Pod that the node pools of the shape are built
+// for, so that they get the same defaults as node pools for real Pods of the
+// shape.
+func warmNodePoolPod(shape WarmNodePoolShape, tpuResource string) *corev1.Pod {
+	chips := resource.MustParse(strconv.Itoa(shape.Chips))
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			OwnerReferences: []metav1.OwnerReference{{
+				Kind:       warmNodePoolParentKind,
+				Name:       strings.ReplaceAll(shape.label(), ".", "-"),
+				Controller: pointer.Bool(true),
+			}},
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{
+				GKEAcceleratorNodeSelector: shape.Accelerator,
+				GKETPUNodeSelector:         shape.Topology,
+			},
+			Containers: []corev1.Container{{
+				Name: "warm",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceName(tpuResource): chips},
+					Limits:   corev1.ResourceList{corev1.ResourceName(tpuResource): chips},
+				},
+			}},
+		},
+	}
+}
+
+// warmSpecHash returns a hash of the parts of the node pool spec that cannot
+// be changed when a warm node pool is claimed: everything except its name,
+// labels, resource labels and taints.
+func warmSpecHash(np *containerv1beta1.NodePool) string {
+	spec := *np
+	spec.Name = ""
+	if np.Config != nil {
+		config := *np.Config
+		config.Labels = nil
+		config.ResourceLabels = nil
+		config.Taints = nil
+		spec.Config = &config
+	}
+	return specHash(&spec, nil, nil)
+}
+
+// warmNodePoolName returns a new random name for a node pool of the shape.
+func warmNodePoolName(shape WarmNodePoolShape) (string, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(shape.String()))
+	return GKENodePoolNamePrefix + "warm-" + hex.EncodeToString(sum[:])[0:8] + "-" + hex.EncodeToString(b), nil
+}
+
+// warmNodePoolForShape returns a new warm node pool of the shape: the node
+// pool for a Pod of the shape, labeled available and tainted so that no Pods
+// schedule onto it before it is claimed.
+func (g *GKE) warmNodePoolForShape(shape WarmNodePoolShape) (*containerv1beta1.NodePool, error) {
+	name, err := warmNodePoolName(shape)
+	if err != nil {
+		return nil, fmt.Errorf("generating warm node pool name: %w", err)
+	}
+	np, err := g.nodePoolForPod(name, warmNodePoolPod(shape, g.ClusterContext.tpuResources()[0]), NodePoolRequest{})
+	if err != nil {
+		return nil, err
+	}
+	if g.NodePoolTemplate != "" {
+		if np, err = g.applyNodePoolTemplate(np); err != nil {
+			return nil, err
+		}
+	}
+	np.Config.Labels[LabelWarmNodePool] = WarmNodePoolAvailable
+	np.Config.Labels[LabelWarmNodePoolShape] = shape.label()
+	np.Config.Taints = append(np.Config.Taints, &containerv1beta1.NodeTaint{Key: TaintWarmNodePool, Value: WarmNodePoolAvailable, Effect: "NO_SCHEDULE"})
+	np.Config.ResourceLabels[ResourceLabelWarmSpecHash] = warmSpecHash(np)
+	g.setSpecHash(np)
+	np.Config.ResourceLabels[ResourceLabelCreatedAt] = strconv.FormatInt(time.Now().Unix(), 10)
+	return np, nil
+}
+
+// claimWarmNodePool claims an available warm node pool for the Pod instead
+// of creating np, if one with the same spec exists, and returns whether the
+// Pod has a warm node pool. A claimed node pool gets the labels, resource
+// labels and taints of np. Claims are recorded in memory before the node
+// pool is updated, so that concurrent reconciles never claim the same node
+// pool twice or two node pools for the same workload.
+func (g *GKE) claimWarmNodePool(p *corev1.Pod, np *containerv1beta1.NodePool) (bool, error) {
+	parent := np.Config.Labels[LabelParentNamespace] + "/" + np.Config.Labels[LabelParentKind] + "/" + np.Config.Labels[LabelParentName]
+	pools, err := g.listNodePools()
+	if err != nil {
+		return false, fmt.Errorf("listing warm node pools: %w", err)
+	}
+	want := warmSpecHash(np)
+
+	g.warmMtx.Lock()
+	var claim *containerv1beta1.NodePool
+	for _, pool := range pools {
+		if !g.NodePoolOwner().ownsNodePool(pool) {
+			continue
+		}
+		if g.warmClaims[pool.Name] == parent ||
+			(pool.Config.Labels[LabelWarmNodePool] == WarmNodePoolClaimed && g.nodePoolBelongsToPod(pool, p)) {
+			// Claimed by an earlier reconcile of the workload.
+			g.warmMtx.Unlock()
+			return true, nil
+		}
+		if claim == nil && pool.Config.Labels[LabelWarmNodePool] == WarmNodePoolAvailable && pool.Status == NodePoolStatusRunning &&
+			pool.Config.ResourceLabels[ResourceLabelWarmSpecHash] == want && g.warmClaims[pool.Name] == "" {
+			claim = pool
+		}
+	}
+	if claim == nil {
+		g.warmMtx.Unlock()
+		return false, nil
+	}
+	if g.warmClaims == nil {
+		g.warmClaims = map[string]string{}
+	}
+	g.warmClaims[claim.Name] = parent
+	g.warmMtx.Unlock()
+
+	if err := g.updateClaimedNodePool(claim, np); err != nil {
+		g.warmMtx.Lock()
+		delete(g.warmClaims, claim.Name)
+		g.warmMtx.Unlock()
+		return false, fmt.Errorf("claiming warm node pool %s: %w", claim.Name, err)
+	}
+	g.nodePoolListCache().invalidate()
+	log.Info("claimed warm node pool", "name", claim.Name, "instead", np.Name)
+	g.eventf(p, corev1.EventTypeNormal, EventWarmNodePoolClaimed, "Claimed warm Node Pool %s instead of creating Node Pool %s.", claim.Name, np.Name)
+	return true, nil
+}
+
+// updateClaimedNodePool replaces the labels, resource labels and taints of
+// the claimed warm node pool with those of np and waits for the update.
+func (g *GKE) updateClaimedNodePool(claim, np *containerv1beta1.NodePool) error {
+	labels := mergeLabels(nil, np.Config.Labels)
+	labels[LabelWarmNodePool] = WarmNodePoolClaimed
+	resourceLabels := mergeLabels(nil, np.Config.ResourceLabels)
+	if v, ok := claim.Config.ResourceLabels[ResourceLabelCreatedAt]; ok {
+		resourceLabels[ResourceLabelCreatedAt] = v
+	}
+	taints := np.Config.Taints
+	if taints == nil {
+		taints = []*containerv1beta1.NodeTaint{}
+	}
+	req := &containerv1beta1.UpdateNodePoolRequest{
+		Labels:         &containerv1beta1.NodeLabels{Labels: labels},
+		ResourceLabels: &containerv1beta1.ResourceLabels{Labels: resourceLabels},
+		Taints:         &containerv1beta1.NodeTaints{Taints: taints, ForceSendFields: []string{"Taints"}},
+	}
+	ctx, cancel := callContext(g.APITimeouts.Create)
+	defer cancel()
+	if err := g.waitForRateLimit(ctx); err != nil {
+		return err
+	}
+	op, err := g.Service.Projects.Locations.Clusters.NodePools.Update(g.ClusterContext.NodePoolName(claim.Name), req).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return g.waitForOperation(op)
+}
+
+// RefillWarmNodePools creates the missing available node pools of each of
+// the WarmNodePools shapes, and deletes available warm node pools beyond
+// them (of shapes that are no longer configured, or beyond their count).
+// Warm node pools are created one at a time, each call waits for the
+// creation.
+func (g *GKE) RefillWarmNodePools() error {
+	pools, err := g.listNodePools()
+	if err != nil {
+		return fmt.Errorf("listing warm node pools: %w", err)
+	}
+	wanted := map[string]int{}
+	for _, shape := range g.WarmNodePools {
+		wanted[shape.label()] = shape.Count
+	}
+
+	available := map[string]int{}
+	names := map[string]bool{}
+	var excess []string
+	g.warmMtx.Lock()
+	for _, pool := range pools {
+		names[pool.Name] = true
+		if !g.NodePoolOwner().ownsNodePool(pool) || pool.Config.Labels[LabelWarmNodePool] != WarmNodePoolAvailable || g.warmClaims[pool.Name] != "" {
+			continue
+		}
+		// Node pools that failed to be created are replaced.
+		shape := pool.Config.Labels[LabelWarmNodePoolShape]
+		if available[shape] >= wanted[shape] || pool.Status == NodePoolStatusError {
+			excess = append(excess, pool.Name)
+			continue
+		}
+		available[shape]++
+	}
+	// Forget the claims of node pools that are gone.
+	for name := range g.warmClaims {
+		if !names[name] {
+			delete(g.warmClaims, name)
+		}
+	}
+	g.warmMtx.Unlock()
+
+	for _, name := range excess {
+		log.Info("deleting excess warm node pool", "name", name)
+		if err := g.DeleteNodePool(name); err != nil {
+			return fmt.Errorf("deleting excess warm node pool %s: %w", name, err)
+		}
+	}
+	for _, shape := range g.WarmNodePools {
+		for i := available[shape.label()]; i < shape.Count; i++ {
+			if err := g.createWarmNodePool(shape); err != nil {
+				return fmt.Errorf("creating warm node pool %s: %w", shape, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (g *GKE) createWarmNodePool(shape WarmNodePoolShape) error {
+	np, err := g.warmNodePoolForShape(shape)
+	if err != nil {
+		return invalidNodePoolConfig(err)
+	}
+	if g.DryRun {
+		log.Info("dry run: would create warm node pool", "name", np.Name, "shape", shape.String())
+		return nil
+	}
+	log.Info("creating warm node pool", "name", np.Name, "shape", shape.String(), "nodeCount", np.InitialNodeCount, "machineType", np.Config.MachineType)
+	counter := g.nodePoolCounter()
+	if counter != nil {
+		if err := counter.reserve(); err != nil {
+			return err
+		}
+	}
+	op, err := g.createNodePool(&containerv1beta1.CreateNodePoolRequest{NodePool: np, Parent: g.ClusterContext.ClusterName()})
+	if op != nil && op.Pending {
+		// Pending warm node pools are not polled, the next refill sees
+		// them in the node pool list.
+		g.pendingCreates.Delete(op.Name)
+	}
+	if counter != nil {
+		counter.release(err == nil)
+	}
+	g.nodePoolListCache().invalidate()
+	return err
+}
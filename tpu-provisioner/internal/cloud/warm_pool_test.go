@@ -0,0 +1,110 @@
+package cloud
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+func TestParseWarmNodePools(t *testing.T) {
+	shapes, err := ParseWarmNodePools(" tpu-v5-lite-podslice/2x4=2, tpu-v4-podslice/2x2x2/4=1 ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exp := []WarmNodePoolShape{
+		{Accelerator: V5ePodSliceAccelerator, Topology: "2x4", Chips: 4, Count: 2},
+		{Accelerator: V4PodSliceAccelerator, Topology: "2x2x2", Chips: 4, Count: 1},
+	}
+	if len(shapes) != len(exp) {
+		t.Fatalf("expected: %v, got: %v", exp, shapes)
+	}
+	for i := range exp {
+		if shapes[i] != exp[i] {
+			t.Fatalf("expected: %v, got: %v", exp, shapes)
+		}
+	}
+
+	if shapes, err := ParseWarmNodePools(""); err != nil || len(shapes) != 0 {
+		t.Fatalf("expected no shapes, got: %v, %v", shapes, err)
+	}
+	for _, spec := range []string{
+		"tpu-v5-lite-podslice/2x4",
+		"tpu-v5-lite-podslice/2x4=0",
+		"tpu-v5-lite-podslice=1",
+		"tpu-v5-lite-podslice/3x3=1",
+		"tpu-v5-lite-podslice/2x4/3=1",
+		"tpu-v9/2x4=1",
+		"tpu-v5-lite-podslice/2x4=1,tpu-v5-lite-podslice/2x4/4=2",
+	} {
+		if _, err := ParseWarmNodePools(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestGKE_warmNodePoolForShape(t *testing.T) {
+	g := &GKE{ClusterContext: GKEContext{ProjectID: "my-project", ClusterLocation: "us-central2", Cluster: "my-cluster", NodeZone: "us-central2-b"}}
+	shape := WarmNodePoolShape{Accelerator: V5ePodSliceAccelerator, Topology: "2x4", Chips: 4, Count: 1}
+
+	warm, err := g.warmNodePoolForShape(shape)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(warm.Name, GKENodePoolNamePrefix+"warm-") {
+		t.Errorf("unexpected name: %v", warm.Name)
+	}
+	if got := warm.Config.Labels[LabelWarmNodePool]; got != WarmNodePoolAvailable {
+		t.Errorf("expected the %v label to be %v, got: %q", LabelWarmNodePool, WarmNodePoolAvailable, got)
+	}
+	if got := warm.Config.Labels[LabelWarmNodePoolShape]; got != "tpu-v5-lite-podslice.2x4.4" {
+		t.Errorf("unexpected shape label: %q", got)
+	}
+	tainted := false
+	for _, taint := range warm.Config.Taints {
+		tainted = tainted || taint.Key == TaintWarmNodePool
+	}
+	if !tainted {
+		t.Errorf("expected the %v taint, got: %+v", TaintWarmNodePool, warm.Config.Taints)
+	}
+
+	// The node pool of a Pod of the shape must match the warm node pool,
+	// despite its different name, labels and taints.
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "train-0",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Job", Name: "train", UID: "0123456789abcdef", Controller: pointer.Bool(true)},
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{
+				GKETPUNodeSelector:         "2x4",
+				GKEAcceleratorNodeSelector: V5ePodSliceAccelerator,
+			},
+			Containers: []corev1.Container{{
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{GoogleTPUResource: resource.MustParse("4")},
+				},
+			}},
+		},
+	}
+	np, err := g.nodePoolForPod("tpu-provisioner-train", p, NodePoolRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exp, got := warm.Config.ResourceLabels[ResourceLabelWarmSpecHash], warmSpecHash(np); exp != got {
+		t.Fatalf("expected the node pool of the Pod to match the warm node pool, warm spec hash: %v, got: %v", exp, got)
+	}
+	p.Spec.NodeSelector[GKETPUNodeSelector] = "4x4"
+	if np, err = g.nodePoolForPod("tpu-provisioner-train", p, NodePoolRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if warm.Config.ResourceLabels[ResourceLabelWarmSpecHash] == warmSpecHash(np) {
+		t.Fatal("expected the node pool of another shape not to match the warm node pool")
+	}
+}
@@ -0,0 +1,141 @@
+package cloud
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	containerv1beta1 "google.golang.org/api/container/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// zonePattern matches a GCP zone name, for example "us-central2-b".
+var zonePattern = regexp.MustCompile(`^[a-z]+-[a-z]+[0-9]+-[a-z]$`)
+
+// zonesForPod returns the zones to create the node pool of the Pod in, in
+// order of preference. The AnnotationZones annotation takes precedence over
+// the cluster's NodeZones, which take precedence over NodeZone. Node pools
+// are always created in a single zone: TPU slices cannot span zones, so the
+// other zones are only tried if the preferred ones have no capacity. Zones
+// listed in the AnnotationExcludedZones annotation are skipped.
+func (g *GKE) zonesForPod(p *corev1.Pod) ([]string, error) {
+	zones, err := g.preferredZonesForPod(p)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := p.Annotations[AnnotationExcludedZones]
+	if !ok {
+		return zones, nil
+	}
+	var excluded []string
+	for _, z := range strings.Split(v, ",") {
+		if z = strings.TrimSpace(z); z != "" {
+			excluded = append(excluded, z)
+		}
+	}
+	var remaining []string
+	for _, z := range zones {
+		if !containsString(excluded, z) {
+			remaining = append(remaining, z)
+		}
+	}
+	if len(remaining) == 0 {
+		return nil, fmt.Errorf("%w: every zone (%v) is excluded by the %v annotation", ErrInvalidNodePoolConfig, strings.Join(zones, ", "), AnnotationExcludedZones)
+	}
+	return remaining, nil
+}
+
+func (g *GKE) preferredZonesForPod(p *corev1.Pod) ([]string, error) {
+	zones := g.ClusterContext.NodeZones
+	if v, ok := p.Annotations[AnnotationZones]; ok {
+		zones = nil
+		for _, z := range strings.Split(v, ",") {
+			if z = strings.TrimSpace(z); z != "" {
+				zones = append(zones, z)
+			}
+		}
+		if len(zones) == 0 {
+			return nil, fmt.Errorf("%w: %v annotation does not list any zones", ErrInvalidNodePoolConfig, AnnotationZones)
+		}
+	}
+	if len(zones) == 0 {
+		return []string{g.ClusterContext.NodeZone}, nil
+	}
+	if err := ValidateZones(zones); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidNodePoolConfig, err)
+	}
+	return zones, nil
+}
+
+// ValidateZones returns an error if any of the zones is malformed or listed
+// twice.
+func ValidateZones(zones []string) error {
+	seen := map[string]bool{}
+	for _, z := range zones {
+		if !zonePattern.MatchString(z) {
+			return fmt.Errorf("invalid zone %q", z)
+		}
+		if seen[z] {
+			return fmt.Errorf("zone %q listed more than once", z)
+		}
+		seen[z] = true
+	}
+	return nil
+}
+
+// createNodePoolInZones creates the node pool in the first zone. If
+// ZoneFallback is enabled and the zone has no capacity, the node pool that
+// failed to be created is deleted and the next zone is tried. The zone that
+// the node pool was created in is recorded in the AnnotationNodePoolZone
+// annotation.
+func (g *GKE) createNodePoolInZones(p *corev1.Pod, req *containerv1beta1.CreateNodePoolRequest, zones []string) (*NodePoolOperation, error) {
+	for i, zone := range zones {
+		req.NodePool.Locations = []string{zone}
+		op, err := g.createNodePool(req)
+		if err == nil {
+			g.annotateZone(p, zone)
+		}
+		if !errors.Is(err, ErrZoneStockout) || !g.ZoneFallback || i == len(zones)-1 {
+			return op, err
+		}
+		next := zones[i+1]
+		log.Info("zone has no capacity, trying next zone", "name", req.NodePool.Name, "zone", zone, "nextZone", next, "error", err)
+		g.eventf(p, corev1.EventTypeWarning, EventZoneStockout, "Zone %s has no capacity for Node Pool %s, trying zone %s.", zone, req.NodePool.Name, next)
+		if err := g.deleteNodePoolAndWait(req.NodePool.Name); err != nil {
+			return op, fmt.Errorf("deleting node pool that failed to be created in zone %s: %w", zone, err)
+		}
+	}
+	return nil, fmt.Errorf("%w: no zones to create node pool in", ErrInvalidNodePoolConfig)
+}
+
+// deleteNodePoolAndWait deletes the node pool, if it exists (GKE may keep a
+// node pool whose creation failed), and waits for the deletion to finish.
+// Unlike DeleteNodePool, it does not start a recreate cooldown.
+func (g *GKE) deleteNodePoolAndWait(name string) error {
+	existing, err := g.getNodePool(name)
+	if err != nil || existing == nil {
+		return err
+	}
+	ctx, cancel := callContext(g.APITimeouts.Create)
+	defer cancel()
+	if err := g.waitForRateLimit(ctx); err != nil {
+		return err
+	}
+	op, err := g.Service.Projects.Locations.Clusters.NodePools.Delete(g.ClusterContext.NodePoolName(name)).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return g.waitForOperation(op)
+}
+
+// annotateZone records the zone of the node pool on the Pod, if there is an
+// Annotator.
+func (g *GKE) annotateZone(p *corev1.Pod, zone string) {
+	if g.Annotator == nil || p.Annotations[AnnotationNodePoolZone] == zone {
+		return
+	}
+	if err := g.Annotator.AnnotatePod(p, AnnotationNodePoolZone, zone); err != nil {
+		log.Error(err, "annotating pod with node pool zone", "pod", p.Namespace+"/"+p.Name, "zone", zone)
+	}
+}
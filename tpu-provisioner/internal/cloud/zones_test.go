@@ -0,0 +1,171 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestGKE_zonesForPod(t *testing.T) {
+	cases := []struct {
+		name        string
+		ctx         GKEContext
+		annotations map[string]string
+		exp         []string
+		err         bool
+		errMsg      string
+	}{
+		{
+			name: "cluster zone",
+			ctx:  GKEContext{NodeZone: "us-central2-b"},
+			exp:  []string{"us-central2-b"},
+		},
+		{
+			name: "cluster zones",
+			ctx:  GKEContext{NodeZone: "us-central2-b", NodeZones: []string{"us-central2-c", "us-central2-b"}},
+			exp:  []string{"us-central2-c", "us-central2-b"},
+		},
+		{
+			name:        "annotation",
+			ctx:         GKEContext{NodeZone: "us-central2-b"},
+			annotations: map[string]string{AnnotationZones: "us-east5-a, us-east5-b"},
+			exp:         []string{"us-east5-a", "us-east5-b"},
+		},
+		{
+			name:        "invalid zone",
+			ctx:         GKEContext{NodeZone: "us-central2-b"},
+			annotations: map[string]string{AnnotationZones: "us-central2"},
+			err:         true,
+		},
+		{
+			name:        "duplicate zone",
+			ctx:         GKEContext{NodeZone: "us-central2-b"},
+			annotations: map[string]string{AnnotationZones: "us-central2-b,us-central2-b"},
+			err:         true,
+		},
+		{
+			name:        "empty annotation",
+			ctx:         GKEContext{NodeZone: "us-central2-b"},
+			annotations: map[string]string{AnnotationZones: ""},
+			err:         true,
+		},
+		{
+			name:        "excluded zone",
+			ctx:         GKEContext{NodeZone: "us-central2-b", NodeZones: []string{"us-central2-c", "us-central2-b"}},
+			annotations: map[string]string{AnnotationExcludedZones: "us-central2-c"},
+			exp:         []string{"us-central2-b"},
+		},
+		{
+			name:        "excluded zones with spaces",
+			ctx:         GKEContext{NodeZone: "us-central2-b", NodeZones: []string{"us-central2-a", "us-central2-c", "us-central2-b"}},
+			annotations: map[string]string{AnnotationExcludedZones: "us-central2-a, us-central2-c ,"},
+			exp:         []string{"us-central2-b"},
+		},
+		{
+			name:        "every zone excluded",
+			ctx:         GKEContext{NodeZone: "us-central2-b"},
+			annotations: map[string]string{AnnotationExcludedZones: "us-central2-c, us-central2-b"},
+			err:         true,
+			errMsg:      "every zone (us-central2-b) is excluded",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := &GKE{ClusterContext: c.ctx}
+			p := &corev1.Pod{}
+			p.Annotations = c.annotations
+			zones, err := g.zonesForPod(p)
+			if (err != nil) != c.err {
+				t.Fatalf("error: expected: %v, got: %v", c.err, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidNodePoolConfig) {
+				t.Fatalf("expected ErrInvalidNodePoolConfig, got: %v", err)
+			}
+			if err != nil && !strings.Contains(err.Error(), c.errMsg) {
+				t.Fatalf("expected error message to contain %q, got: %v", c.errMsg, err)
+			}
+			if !reflect.DeepEqual(zones, c.exp) {
+				t.Fatalf("expected: %v, got: %v", c.exp, zones)
+			}
+		})
+	}
+}
+
+func TestGKE_EnsureNodePoolForPod_zoneFallback(t *testing.T) {
+	isController := true
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "train-0",
+			Namespace:   "default",
+			Annotations: map[string]string{AnnotationZones: "us-central2-b,us-central2-c"},
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Job", Name: "train", UID: "0123456789abcdef", Controller: &isController},
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{
+				GKETPUNodeSelector:         "2x2x1",
+				GKEAcceleratorNodeSelector: V4PodSliceAccelerator,
+			},
+			Containers: []corev1.Container{{
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{GoogleTPUResource: resource.MustParse("4")},
+				},
+			}},
+		},
+	}
+
+	for _, fallback := range []bool{false, true} {
+		fake := &fakeGKEServer{stockoutZones: map[string]bool{"us-central2-b": true}}
+		srv := httptest.NewServer(fake)
+		defer srv.Close()
+		svc, err := NewService(context.Background(), ServiceConfig{Endpoint: srv.URL + "/", WithoutAuthentication: true})
+		if err != nil {
+			t.Fatalf("creating service: %v", err)
+		}
+		rec := record.NewFakeRecorder(10)
+		annotator := &recordingAnnotator{}
+		g := &GKE{
+			Service:        svc,
+			ClusterContext: GKEContext{ProjectID: "my-project", ClusterLocation: "us-central2", Cluster: "my-cluster"},
+			Recorder:       rec,
+			ZoneFallback:   fallback,
+			Annotator:      annotator,
+		}
+
+		_, err = g.EnsureNodePoolForPod(p, NodePoolRequest{})
+		if !fallback {
+			if !errors.Is(err, ErrZoneStockout) {
+				t.Fatalf("without fallback: expected ErrZoneStockout, got: %v", err)
+			}
+			if exp, got := 1, len(fake.creates); exp != got {
+				t.Fatalf("without fallback: create requests: expected: %v, got: %v", exp, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("with fallback: unexpected error: %v", err)
+		}
+		if exp, got := 2, len(fake.creates); exp != got {
+			t.Fatalf("with fallback: create requests: expected: %v, got: %v", exp, got)
+		}
+		if exp, got := []string{"us-central2-c"}, fake.creates[1].NodePool.Locations; !reflect.DeepEqual(exp, got) {
+			t.Fatalf("with fallback: locations: expected: %v, got: %v", exp, got)
+		}
+		if exp, got := 1, len(rec.Events); exp != got {
+			t.Fatalf("with fallback: events: expected: %v, got: %v", exp, got)
+		}
+		if exp, got := "us-central2-c", annotator.annotations[AnnotationNodePoolZone]; exp != got {
+			t.Fatalf("with fallback: zone annotation: expected: %v, got: %v", exp, got)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+// acceleratorAllowlistCheckInterval is how often the file of an
+// AcceleratorAllowlist is checked for changes.
+const acceleratorAllowlistCheckInterval = 10 * time.Second
+
+// AcceleratorAllowlist restricts the accelerator types (the TPU accelerator
+// type or the GPU type that Pods select) that node pools are created for.
+// Patterns are shell globs as understood by path.Match, for example
+// "tpu-v5*". Pods that select no accelerator type are not allowed while the
+// list is not empty, their accelerator type is only known once the provider
+// completed their node selectors.
+type AcceleratorAllowlist struct {
+	// Allow, if non-empty, lists the only accelerator types that are
+	// allowed. It is used while Path is not set.
+	Allow []string
+	// Path, if set, is a YAML file (usually a mounted ConfigMap) with the
+	// list of allowed accelerator types, which replaces Allow. The file is
+	// read again when it changes, so that updates of the ConfigMap take
+	// effect without a restart. If it cannot be read, the last list is kept.
+	Path string
+
+	mtx sync.Mutex
+	// loaded is the list read from Path, as of modTime and checked, guarded
+	// by mtx.
+	loaded  []string
+	modTime time.Time
+	checked time.Time
+}
+
+// LoadAcceleratorAllowlist reads a YAML list of accelerator type patterns.
+func LoadAcceleratorAllowlist(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading accelerator allowlist: %w", err)
+	}
+	var allow []string
+	if err := yaml.UnmarshalStrict(data, &allow); err != nil {
+		return nil, fmt.Errorf("parsing accelerator allowlist from %s: %w", path, err)
+	}
+	if err := ValidateGlobs(allow); err != nil {
+		return nil, fmt.Errorf("accelerator allowlist: %w", err)
+	}
+	return allow, nil
+}
+
+// allows returns whether the accelerator type is allowed. A nil allowlist
+// allows every accelerator type.
+func (a *AcceleratorAllowlist) allows(ctx context.Context, accel string) bool {
+	if a == nil {
+		return true
+	}
+	allow := a.list(ctx, time.Now())
+	if len(allow) == 0 {
+		return true
+	}
+	return accel != "" && matchesAnyGlob(accel, allow)
+}
+
+// list returns the current list, reading the file again if it changed since
+// it was last read.
+func (a *AcceleratorAllowlist) list(ctx context.Context, now time.Time) []string {
+	if a.Path == "" {
+		return a.Allow
+	}
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if !a.checked.IsZero() && now.Sub(a.checked) < acceleratorAllowlistCheckInterval {
+		return a.loaded
+	}
+	a.checked = now
+
+	// The kubelet updates a mounted ConfigMap by swapping a symlink, which
+	// os.Stat follows.
+	info, err := os.Stat(a.Path)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to check accelerator allowlist, keeping the last list", "path", a.Path)
+		return a.loaded
+	}
+	if info.ModTime().Equal(a.modTime) {
+		return a.loaded
+	}
+	allow, err := LoadAcceleratorAllowlist(a.Path)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to reload accelerator allowlist, keeping the last list", "path", a.Path)
+		return a.loaded
+	}
+	log.FromContext(ctx).Info("Loaded accelerator allowlist", "path", a.Path, "allow", allow)
+	a.loaded, a.modTime = allow, info.ModTime()
+	return a.loaded
+}
+
+// podAccelerator returns the TPU accelerator type or the GPU type that the Pod
+// selects, or "" if it selects neither.
+func podAccelerator(p *corev1.Pod) string {
+	nodeSelector := cloud.NodeSelectorForPod(p)
+	if accel := nodeSelector[cloud.GKEAcceleratorNodeSelector]; accel != "" {
+		return accel
+	}
+	return nodeSelector[cloud.GKEGPUNodeSelector]
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_AcceleratorAllowlist_allows(t *testing.T) {
+	cases := []struct {
+		name  string
+		list  *AcceleratorAllowlist
+		accel string
+		exp   bool
+	}{
+		{name: "no allowlist", accel: "tpu-v4-podslice", exp: true},
+		{name: "empty list", list: &AcceleratorAllowlist{}, accel: "tpu-v4-podslice", exp: true},
+		{name: "allowed by glob", list: &AcceleratorAllowlist{Allow: []string{"tpu-v5*"}}, accel: "tpu-v5-lite-podslice", exp: true},
+		{name: "not allowed", list: &AcceleratorAllowlist{Allow: []string{"tpu-v5*"}}, accel: "tpu-v4-podslice", exp: false},
+		{name: "no accelerator", list: &AcceleratorAllowlist{Allow: []string{"*"}}, accel: "", exp: false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.list.allows(context.Background(), c.accel); got != c.exp {
+				t.Fatalf("expected %v, got %v", c.exp, got)
+			}
+		})
+	}
+}
+
+func Test_AcceleratorAllowlist_reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist.yaml")
+	mtime := time.Now().Add(-time.Hour)
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mtime = mtime.Add(time.Minute)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+	a := &AcceleratorAllowlist{Allow: []string{"ignored"}, Path: path}
+	now := time.Now()
+
+	write("- tpu-v4-podslice\n")
+	if got := a.list(ctx, now); len(got) != 1 || got[0] != "tpu-v4-podslice" {
+		t.Fatalf("expected the list of the file, got: %v", got)
+	}
+
+	write("- tpu-v5p-slice\n")
+	if got := a.list(ctx, now.Add(time.Second)); got[0] != "tpu-v4-podslice" {
+		t.Fatalf("expected the file not to be checked again yet, got: %v", got)
+	}
+	now = now.Add(acceleratorAllowlistCheckInterval)
+	if got := a.list(ctx, now); got[0] != "tpu-v5p-slice" {
+		t.Fatalf("expected the changed list, got: %v", got)
+	}
+
+	write("- [invalid\n")
+	now = now.Add(acceleratorAllowlistCheckInterval)
+	if got := a.list(ctx, now); len(got) != 1 || got[0] != "tpu-v5p-slice" {
+		t.Fatalf("expected the last list to be kept, got: %v", got)
+	}
+}
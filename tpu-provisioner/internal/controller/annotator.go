@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// podAnnotatorTimeout bounds the patches made by PodAnnotator, which are not
+// tied to the context of a reconcile.
+const podAnnotatorTimeout = 10 * time.Second
+
+// PodAnnotator implements cloud.PodAnnotator with a Kubernetes client. The
+// annotation is patched on a copy of the Pod, so that the object held by the
+// caller is left unchanged.
+type PodAnnotator struct {
+	Client client.Client
+}
+
+func (a *PodAnnotator) AnnotatePod(p *corev1.Pod, key, value string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), podAnnotatorTimeout)
+	defer cancel()
+	pod := p.DeepCopy()
+	patch := client.MergeFrom(p)
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[key] = value
+	return a.Client.Patch(ctx, pod, patch)
+}
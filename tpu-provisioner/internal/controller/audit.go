@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Audit log outcomes: whether a node pool was requested for the Pod.
+const (
+	// auditIgnored means that the Pod does not trigger node pool creation.
+	auditIgnored = "ignored"
+	// auditDeferred means that the Pod is reconciled again later.
+	auditDeferred = "deferred"
+	// auditPending means that the node pool operation is still running.
+	auditPending = "pending"
+	auditEnsured = "ensured"
+	auditFailed  = "failed"
+)
+
+// Audit log keys. Tooling that ships audit logs can rely on these keys, new
+// keys are only ever appended.
+const (
+	auditKeyOutcome          = "outcome"
+	auditKeyReason           = "reason"
+	auditKeyPodNamespace     = "podNamespace"
+	auditKeyPodName          = "podName"
+	auditKeyNodePool         = "nodePool"
+	auditKeyError            = "error"
+	auditKeyPending          = "pending"
+	auditKeyUnschedulable    = "unschedulable"
+	auditKeyRequestsResource = "requestsResource"
+	auditKeyHasNodeSelectors = "hasNodeSelectors"
+	auditKeyMatchesLabels    = "matchesLabels"
+)
+
+// Reasons of audit log lines for Pods that do not match the PodCriteria.
+const (
+	auditReasonNotPending           = "NotPending"
+	auditReasonNotUnschedulable     = "NotUnschedulable"
+	auditReasonNoResourceRequest    = "NoResourceRequest"
+	auditReasonMissingNodeSelectors = "MissingNodeSelectors"
+	auditReasonLabelsNotMatched     = "LabelsNotMatched"
+	auditReasonSkipped              = "Skipped"
+)
+
+// Reasons of audit log lines for Pods that are ignored for other reasons
+// than the PodCriteria.
+const (
+	auditReasonNamespaceNotAllowed = "NamespaceNotAllowed"
+	auditReasonSliceInProgress     = "SliceInProgress"
+	auditReasonDuplicateRequest    = "DuplicateRequest"
+)
+
+// ignoreReasons are the reasons that the podsIgnored metric is partitioned
+// by, in the order of the checks in CreationReconciler.Reconcile. Any other
+// reason is counted as ignoreReasonOther to keep the cardinality bounded.
+var ignoreReasons = []string{
+	auditReasonSkipped,
+	auditReasonNamespaceNotAllowed,
+	auditReasonNotPending,
+	auditReasonNotUnschedulable,
+	auditReasonNoResourceRequest,
+	auditReasonMissingNodeSelectors,
+	auditReasonLabelsNotMatched,
+	EventAcceleratorTypeNotAllowed,
+	EventProvisioningAbandoned,
+	EventProvisioningTimeout,
+	EventInvalidNodePoolTaints,
+	EventMissingToleration,
+	auditReasonSliceInProgress,
+	auditReasonDuplicateRequest,
+}
+
+const ignoreReasonOther = "Other"
+
+// audit writes an audit log line for a provisioning decision about the Pod,
+// if the AuditLog is enabled. Audit lines are logged by the "audit" logger at
+// level 0 so that they are not dropped by the verbosity.
+func (r *CreationReconciler) audit(ctx context.Context, pod *corev1.Pod, outcome, reason string, keysAndValues ...interface{}) {
+	if !r.AuditLog {
+		return
+	}
+	kvs := append([]interface{}{
+		auditKeyOutcome, outcome,
+		auditKeyReason, reason,
+		auditKeyPodNamespace, pod.Namespace,
+		auditKeyPodName, pod.Name,
+	}, keysAndValues...)
+	log.FromContext(ctx).WithName("audit").Info("Provisioning decision", kvs...)
+}
+
+// ignored counts the Pod as ignored for the reason in the podsIgnored
+// metric and writes an audit log line for it, see audit.
+func (r *CreationReconciler) ignored(ctx context.Context, pod *corev1.Pod, reason string, keysAndValues ...interface{}) {
+	podsIgnored.WithLabelValues(ignoreReasonLabel(reason)).Inc()
+	r.audit(ctx, pod, auditIgnored, reason, keysAndValues...)
+}
+
+// ignoreReasonLabel returns the podsIgnored label of the reason:
+// ignoreReasonOther if it is not one of the ignoreReasons.
+func ignoreReasonLabel(reason string) string {
+	for _, r := range ignoreReasons {
+		if r == reason {
+			return reason
+		}
+	}
+	return ignoreReasonOther
+}
+
+// auditCriteria returns the audit log fields of the criteria that a Pod must
+// match to trigger node pool creation, and the reason for the first one that
+// it does not match.
+func auditCriteria(p *corev1.Pod, c PodCriteria) ([]interface{}, string) {
+	pending, unschedulable, m := isPending(p), isUnschedulable(p), c.evaluate(p)
+	var reason string
+	switch {
+	case !pending:
+		reason = auditReasonNotPending
+	case !unschedulable:
+		reason = auditReasonNotUnschedulable
+	case !m.requestsResource:
+		reason = auditReasonNoResourceRequest
+	case !m.hasNodeSelectors:
+		reason = auditReasonMissingNodeSelectors
+	case !m.matchesLabels:
+		reason = auditReasonLabelsNotMatched
+	}
+	return []interface{}{
+		auditKeyPending, pending,
+		auditKeyUnschedulable, unschedulable,
+		auditKeyRequestsResource, m.requestsResource,
+		auditKeyHasNodeSelectors, m.hasNodeSelectors,
+		auditKeyMatchesLabels, m.matchesLabels,
+	}, reason
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+	"github.com/go-logr/logr/funcr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func Test_auditCriteria(t *testing.T) {
+	criteria := PodCriteria{ResourceType: cloud.GoogleTPUResource, Selector: labels.SelectorFromSet(labels.Set{"team": "ml"})}
+	pod := func(mutate func(*corev1.Pod)) *corev1.Pod {
+		p := &corev1.Pod{}
+		p.Labels = map[string]string{"team": "ml"}
+		p.Status.Phase = corev1.PodPending
+		p.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: corev1.PodReasonUnschedulable}}
+		p.Spec.NodeSelector = map[string]string{cloud.GKETPUNodeSelector: "2x2x1"}
+		p.Spec.Containers = []corev1.Container{{Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{cloud.GoogleTPUResource: resource.MustParse("4")},
+		}}}
+		if mutate != nil {
+			mutate(p)
+		}
+		return p
+	}
+
+	cases := []struct {
+		name   string
+		pod    *corev1.Pod
+		reason string
+	}{
+		{name: "matches", pod: pod(nil)},
+		{name: "running", pod: pod(func(p *corev1.Pod) { p.Status.Phase = corev1.PodRunning }), reason: auditReasonNotPending},
+		{name: "schedulable", pod: pod(func(p *corev1.Pod) { p.Status.Conditions = nil }), reason: auditReasonNotUnschedulable},
+		{name: "no request", pod: pod(func(p *corev1.Pod) { p.Spec.Containers = nil }), reason: auditReasonNoResourceRequest},
+		{name: "no topology", pod: pod(func(p *corev1.Pod) { p.Spec.NodeSelector = nil }), reason: auditReasonMissingNodeSelectors},
+		{name: "other team", pod: pod(func(p *corev1.Pod) { p.Labels["team"] = "web" }), reason: auditReasonLabelsNotMatched},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, reason := auditCriteria(c.pod, criteria)
+			if reason != c.reason {
+				t.Fatalf("expected reason %q, got: %q", c.reason, reason)
+			}
+			if matches := isPending(c.pod) && isUnschedulable(c.pod) && criteria.matches(c.pod); matches != (reason == "") {
+				t.Fatalf("reason %q disagrees with matches: %v", reason, matches)
+			}
+		})
+	}
+}
+
+func Test_CreationReconciler_audit(t *testing.T) {
+	var lines []string
+	ctx := log.IntoContext(context.Background(), funcr.New(func(prefix, args string) {
+		lines = append(lines, prefix+" "+args)
+	}, funcr.Options{}))
+	p := &corev1.Pod{}
+	p.Namespace, p.Name = "default", "train-0"
+
+	r := &CreationReconciler{}
+	r.audit(ctx, p, auditIgnored, auditReasonNotPending)
+	if len(lines) != 0 {
+		t.Fatalf("expected no audit log when disabled, got: %v", lines)
+	}
+
+	r.AuditLog = true
+	r.audit(ctx, p, auditEnsured, EventNodePoolEnsured, auditKeyNodePool, "np")
+	if len(lines) != 1 {
+		t.Fatalf("expected one audit log line, got: %v", lines)
+	}
+	for _, s := range []string{`audit`, `"outcome"="ensured"`, `"reason"="NodePoolEnsured"`, `"podNamespace"="default"`, `"podName"="train-0"`, `"nodePool"="np"`} {
+		if !strings.Contains(lines[0], s) {
+			t.Fatalf("expected %s in audit log line: %v", s, lines[0])
+		}
+	}
+}
+
+func Test_ignoreReasonLabel(t *testing.T) {
+	for _, reason := range []string{auditReasonNotUnschedulable, auditReasonMissingNodeSelectors, EventMissingToleration, auditReasonDuplicateRequest} {
+		if got := ignoreReasonLabel(reason); got != reason {
+			t.Errorf("expected %q to be its own label, got: %q", reason, got)
+		}
+	}
+	for _, reason := range []string{"", "SomethingNew", EventNodePoolEnsured} {
+		if got := ignoreReasonLabel(reason); got != ignoreReasonOther {
+			t.Errorf("expected %q to be counted as %q, got: %q", reason, ignoreReasonOther, got)
+		}
+	}
+}
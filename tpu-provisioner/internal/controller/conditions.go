@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// PodConditionNodePoolProvisioning is set on Pods that triggered node pool
+// creation to report its progress.
+const PodConditionNodePoolProvisioning corev1.PodConditionType = "NodePoolProvisioning"
+
+// Reasons of the PodConditionNodePoolProvisioning condition.
+const (
+	NodePoolProvisioningEnsuring = "Ensuring"
+	NodePoolProvisioningEnsured  = "Ensured"
+	NodePoolProvisioningFailed   = "Failed"
+)
+
+// updateProvisioningCondition sets the NodePoolProvisioning condition of the
+// Pod. The Pod is updated with optimistic concurrency and refetched on
+// conflicts, because the scheduler also updates Pod status. Failures are only
+// logged, the condition is informational.
+func (r *CreationReconciler) updateProvisioningCondition(ctx context.Context, pod *corev1.Pod, status corev1.ConditionStatus, reason, message string) {
+	cond := corev1.PodCondition{
+		Type:    PodConditionNodePoolProvisioning,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}
+	key := types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var latest corev1.Pod
+		if err := r.Get(ctx, key, &latest); err != nil {
+			return err
+		}
+		if !setPodCondition(&latest.Status, cond, time.Now()) {
+			return nil
+		}
+		return r.Status().Update(ctx, &latest)
+	})
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update pod condition", "condition", PodConditionNodePoolProvisioning, "reason", reason)
+	}
+}
+
+// setPodCondition adds or updates the condition in the Pod status. It returns
+// false if the status already contained the condition with the same status
+// and reason: a new message alone, for example a different error of a retry
+// that failed again, is not worth a status update.
+func setPodCondition(status *corev1.PodStatus, cond corev1.PodCondition, now time.Time) bool {
+	cond.LastProbeTime = metav1.NewTime(now)
+	cond.LastTransitionTime = metav1.NewTime(now)
+	for i, c := range status.Conditions {
+		if c.Type != cond.Type {
+			continue
+		}
+		if c.Status == cond.Status && c.Reason == cond.Reason {
+			return false
+		}
+		if c.Status == cond.Status {
+			cond.LastTransitionTime = c.LastTransitionTime
+		}
+		status.Conditions[i] = cond
+		return true
+	}
+	status.Conditions = append(status.Conditions, cond)
+	return true
+}
+
+// hasPodCondition returns true if the Pod has the condition with the given
+// reason.
+func hasPodCondition(p *corev1.Pod, t corev1.PodConditionType, reason string) bool {
+	for _, c := range p.Status.Conditions {
+		if c.Type == t && c.Reason == reason {
+			return true
+		}
+	}
+	return false
+}
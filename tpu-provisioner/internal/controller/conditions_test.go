@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func Test_setPodCondition(t *testing.T) {
+	var status corev1.PodStatus
+	t0 := time.Now().Truncate(time.Second)
+
+	ensuring := corev1.PodCondition{
+		Type:    PodConditionNodePoolProvisioning,
+		Status:  corev1.ConditionTrue,
+		Reason:  NodePoolProvisioningEnsuring,
+		Message: "Ensuring Node Pool tpu-provisioner-abc.",
+	}
+	if !setPodCondition(&status, ensuring, t0) {
+		t.Fatalf("adding condition: expected change")
+	}
+	if setPodCondition(&status, ensuring, t0.Add(time.Minute)) {
+		t.Fatalf("identical condition: expected no change")
+	}
+	retried := ensuring
+	retried.Message = "Ensuring Node Pool tpu-provisioner-def."
+	if setPodCondition(&status, retried, t0.Add(time.Minute)) {
+		t.Fatalf("new message only: expected no change")
+	}
+
+	ensured := ensuring
+	ensured.Reason = NodePoolProvisioningEnsured
+	if !setPodCondition(&status, ensured, t0.Add(2*time.Minute)) {
+		t.Fatalf("new reason: expected change")
+	}
+	if exp, got := 1, len(status.Conditions); exp != got {
+		t.Fatalf("conditions: expected: %v, got: %v", exp, got)
+	}
+	c := status.Conditions[0]
+	if c.Reason != NodePoolProvisioningEnsured {
+		t.Fatalf("reason: expected: %v, got: %v", NodePoolProvisioningEnsured, c.Reason)
+	}
+	if !c.LastTransitionTime.Time.Equal(t0) {
+		t.Fatalf("unchanged status: expected transition time to be kept, got: %v", c.LastTransitionTime)
+	}
+
+	failed := ensuring
+	failed.Status = corev1.ConditionFalse
+	failed.Reason = NodePoolProvisioningFailed
+	setPodCondition(&status, failed, t0.Add(3*time.Minute))
+	if c := status.Conditions[0]; !c.LastTransitionTime.Time.Equal(t0.Add(3 * time.Minute)) {
+		t.Fatalf("changed status: expected new transition time, got: %v", c.LastTransitionTime)
+	}
+}
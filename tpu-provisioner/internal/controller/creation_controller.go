@@ -20,16 +20,29 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
 
 	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	crcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // CreationReconciler watches Pods and creates Node Pools.
@@ -40,22 +53,289 @@ type CreationReconciler struct {
 
 	PodCriteria PodCriteria
 
+	// NamespaceFilter restricts the namespaces that Pods can trigger node pool
+	// creation from.
+	NamespaceFilter NamespaceFilter
+
+	// AcceleratorAllowlist, if set, restricts the accelerator types that
+	// node pools are created for.
+	AcceleratorAllowlist *AcceleratorAllowlist
+
 	Provider cloud.Provider
+
+	// SliceDebounce enables batching of the Pods that make up a multi-host
+	// TPU slice into a single node pool request. Each slice waits until all
+	// of its Pods have been observed or until the debounce window elapses,
+	// whichever comes first. Zero disables batching.
+	SliceDebounce time.Duration
+
+	// IncompleteSelectorPolicy and AcceleratorDefaults complete the TPU
+	// node selectors of Pods that select only one of them the way the
+	// provider does (see cloud.CompleteTPUSelectors), so that their slices
+	// are batched as well.
+	IncompleteSelectorPolicy string
+	AcceleratorDefaults      map[string]cloud.AcceleratorDefaults
+
+	// JobSetReader, if set, is used to read the Jobs and JobSets that own
+	// Pods, so that the node count of a JobSet slice is taken from the
+	// parallelism of its replicated Job instead of waiting for its Pods (see
+	// jobSetParallelism). It should not be a cached client, to avoid
+	// watching all Jobs and JobSets.
+	JobSetReader client.Reader
+
+	// RetryPolicy determines when to retry after ensuring a node pool failed.
+	RetryPolicy RetryPolicy
+
+	// MaxConcurrentReconciles is the number of Pods reconciled in parallel.
+	// Zero uses the manager's concurrency for Pods. Concurrent requests for
+	// the same node pool share a single provider call (see ensureNodePool),
+	// so raising this mainly speeds up unrelated workloads; calls to the GKE
+	// API are still subject to the provider's rate limit. Values up to about
+	// 10 are safe, GKE serializes operations on a cluster beyond that.
+	MaxConcurrentReconciles int
+
+	// ReadyTracker, if set, is notified of ensured node pools so that the
+	// NodePoolReadyReconciler can report when their Nodes are Ready.
+	ReadyTracker *NodePoolReadyTracker
+
+	// Resync, if set, is a source of additional Pods to reconcile, see
+	// StartupResync.
+	Resync <-chan event.GenericEvent
+	// Sweep, if set, is a source of Pods to reconcile again, see
+	// NodePoolSweep.
+	Sweep <-chan event.GenericEvent
+
+	// OperationPolling determines how node pool operations that the provider
+	// did not wait for are polled.
+	OperationPolling OperationPolling
+
+	// PriorityPolicy, if enabled, serves higher-priority Pods first.
+	PriorityPolicy PriorityPolicy
+
+	// NodePoolFinalizer adds the NodePoolFinalizer to Pods before ensuring
+	// node pools for them, see PodFinalizerReconciler.
+	NodePoolFinalizer bool
+
+	// ShutdownGracePeriod is how long the result of a provider call can
+	// still be recorded on the Pod after the manager started stopping, see
+	// checkpointContext. Zero records nothing once stopping.
+	ShutdownGracePeriod time.Duration
+
+	// PauseSwitch, if configured, halts node pool creation while paused.
+	PauseSwitch PauseSwitch
+
+	// AuditLog logs every provisioning decision with stable keys, see audit.
+	AuditLog bool
+
+	// StrictShapeMatching also treats Pending Pods as triggers before they
+	// are Unschedulable, if no node pool created by this provisioner has
+	// their exact accelerator and topology, see lacksMatchingNodePool.
+	StrictShapeMatching bool
+
+	// EventSink, if set, also receives the node pool lifecycle events.
+	EventSink *EventSink
+
+	// ProvisioningTimeout, if set, gives up on node pools that do not
+	// become Ready in time.
+	ProvisioningTimeout ProvisioningTimeout
+
+	// JobSetEvents, if set, also records the node pool events of JobSet
+	// Pods on their JobSet.
+	JobSetEvents *JobSetEvents
+
+	// SliceAggregator, if set, records the node pool events of the Pods of
+	// a multi-host slice once per slice transition instead of on every Pod.
+	SliceAggregator *SliceAggregator
+
+	// Tracer, if set, traces reconciles and the provider calls they make.
+	Tracer Tracer
+
+	slices   sliceTracker
+	flights  ensureFlights
+	failures failureLog
 }
 
+// PodCriteria determines which Pods trigger node pool creation. A Pod matches
+// if it requests the resource type of any resource family and has all of that
+// family's node selectors, its labels match the Selector if there is one, and
+// it did not opt out with the SkipAnnotation.
 type PodCriteria struct {
-	ResourceType string
+	// ResourceType is the TPU resource type. It is shorthand for a resource
+	// family that requires the GKE TPU topology node selector.
+	// ResourceTypes are alternative names of the TPU resource type, in
+	// addition to ResourceType.
+	ResourceType  string
+	ResourceTypes []string
+
+	// Families are additional resource families to match (for example GPUs).
+	Families []ResourceFamily
+
+	// Selector, if set, restricts the Pods to those with matching labels.
+	Selector labels.Selector
+
+	// SkipAnnotation, if set, is the annotation that Pods set to "true" to
+	// opt out of node pool creation, see cloud.AnnotationSkipProvisioning.
+	SkipAnnotation string
+}
+
+// ResourceFamily is a kind of accelerator resource together with the node
+// selectors that the provider requires to size a node pool for it. A Pod
+// belongs to the family if it requests any of the resource types.
+type ResourceFamily struct {
+	ResourceTypes []string
+	NodeSelectors []string
+	// AnyNodeSelector, if set, only requires one of the NodeSelectors: the
+	// provider completes or rejects the others.
+	AnyNodeSelector bool
+}
+
+func (c PodCriteria) families() []ResourceFamily {
+	families := c.Families
+	var tpuTypes []string
+	if c.ResourceType != "" {
+		tpuTypes = append(tpuTypes, c.ResourceType)
+	}
+	tpuTypes = append(tpuTypes, c.ResourceTypes...)
+	if len(tpuTypes) > 0 {
+		families = append([]ResourceFamily{{
+			ResourceTypes: tpuTypes,
+			// Pods that select only one of them are handled by the
+			// provider's incomplete selector policy, see
+			// cloud.CompleteTPUSelectors.
+			NodeSelectors:   []string{cloud.GKETPUNodeSelector, cloud.GKEAcceleratorNodeSelector},
+			AnyNodeSelector: true,
+		}}, families...)
+	}
+	return families
+}
+
+// matches returns true if the Pod requests the resource of, and has the
+// node selectors required by, any resource family.
+func (c PodCriteria) matches(p *corev1.Pod) bool {
+	m := c.evaluate(p)
+	return m.matchesLabels && m.hasNodeSelectors && !c.skipped(p)
+}
+
+// skipped returns true if the Pod opted out of node pool creation with the
+// SkipAnnotation.
+func (c PodCriteria) skipped(p client.Object) bool {
+	return c.SkipAnnotation != "" && p.GetAnnotations()[c.SkipAnnotation] == "true"
+}
+
+// criteriaMatch is the result of matching a Pod against each of the
+// PodCriteria.
+type criteriaMatch struct {
+	// requestsResource is whether the Pod requests the resource of any
+	// family, hasNodeSelectors whether it also has the node selectors of
+	// such a family.
+	requestsResource bool
+	hasNodeSelectors bool
+	matchesLabels    bool
+}
+
+func (c PodCriteria) evaluate(p *corev1.Pod) criteriaMatch {
+	m := criteriaMatch{matchesLabels: c.matchesLabels(p)}
+	for _, f := range c.families() {
+		if doesRequestResource(p, f.ResourceTypes...) {
+			m.requestsResource = true
+			if hasNodeSelectors(p, f.NodeSelectors...) || (f.AnyNodeSelector && hasAnyNodeSelector(p, f.NodeSelectors...)) {
+				m.hasNodeSelectors = true
+			}
+		}
+	}
+	return m
+}
+
+// matchesLabels returns true if there is no Selector or the labels of the Pod
+// match it.
+func (c PodCriteria) matchesLabels(p client.Object) bool {
+	return c.Selector == nil || c.Selector.Matches(labels.Set(p.GetLabels()))
+}
+
+// mayTrigger filters the Pod events that are queued: only Pending Pods that
+// match the criteria can trigger node pool creation. Whether the Pod is
+// Unschedulable is deliberately not checked here, so that the status update
+// that makes it Unschedulable gets through; Reconcile checks all conditions.
+func (c PodCriteria) mayTrigger(o client.Object) bool {
+	p, ok := o.(*corev1.Pod)
+	return ok && isPending(p) && c.matches(p)
+}
+
+// relevantUpdate filters the Pod updates that are queued: updates that only
+// change annotations, finalizers or the status other than the phase and the
+// PodScheduled condition are dropped. Those are mostly the provisioner's own
+// writes (the NodePoolProvisioning condition and the state annotations), and
+// queuing them would reconcile the Pod again right away instead of after the
+// RequeueAfter of the RetryPolicy. Changes of the SkipAnnotation still get
+// through, so that a Pod that opts back in is provisioned.
+func (c PodCriteria) relevantUpdate(e event.UpdateEvent) bool {
+	old, ok := e.ObjectOld.(*corev1.Pod)
+	if !ok {
+		return true
+	}
+	p, ok := e.ObjectNew.(*corev1.Pod)
+	if !ok {
+		return true
+	}
+	if c.SkipAnnotation != "" && old.Annotations[c.SkipAnnotation] != p.Annotations[c.SkipAnnotation] {
+		return true
+	}
+	if old.Status.Phase != p.Status.Phase {
+		return true
+	}
+	oldScheduled, scheduled := podScheduledCondition(old), podScheduledCondition(p)
+	if oldScheduled.Status != scheduled.Status || oldScheduled.Reason != scheduled.Reason {
+		return true
+	}
+	return !apiequality.Semantic.DeepEqual(relevantMeta(old), relevantMeta(p)) || !apiequality.Semantic.DeepEqual(old.Spec, p.Spec)
+}
+
+// relevantMeta returns the object metadata of the Pod without the fields that
+// relevantUpdate ignores.
+func relevantMeta(p *corev1.Pod) metav1.ObjectMeta {
+	m := *p.ObjectMeta.DeepCopy()
+	m.Annotations = nil
+	m.Finalizers = nil
+	m.ResourceVersion = ""
+	m.ManagedFields = nil
+	return m
+}
+
+// podScheduledCondition returns the PodScheduled condition of the Pod, or an
+// empty condition if it has none.
+func podScheduledCondition(p *corev1.Pod) corev1.PodCondition {
+	for _, c := range p.Status.Conditions {
+		if c.Type == corev1.PodScheduled {
+			return c
+		}
+	}
+	return corev1.PodCondition{}
 }
 
 //+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=pods/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups="",resources=pods/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 
 func (r *CreationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := startSpan(ctx, r.Tracer, "Reconcile", SpanAttribute{spanAttrPod, req.String()})
+	result, err := r.reconcile(ctx, req)
+	endSpan(span, spanResultSuccess, err)
+	return result, err
+}
+
+func (r *CreationReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	lg := log.FromContext(ctx)
 
 	lg.V(3).Info("Reconciling Pod")
 
+	if ctx.Err() != nil {
+		// The manager is stopping: don't start new provider calls, the Pod
+		// is reconciled again after the restart.
+		lg.V(1).Info("Not reconciling pod while shutting down")
+		return ctrl.Result{}, nil
+	}
+
 	var pod corev1.Pod
 	if err := r.Get(ctx, req.NamespacedName, &pod); err != nil {
 		if apierrors.IsNotFound(err) {
@@ -65,31 +345,491 @@ func (r *CreationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, fmt.Errorf("getting pod: %w", err)
 	}
 
+	if r.PodCriteria.skipped(&pod) {
+		lg.V(1).Info("Ignoring pod that opted out of node pool provisioning", "annotation", r.PodCriteria.SkipAnnotation)
+		r.ignored(ctx, &pod, auditReasonSkipped)
+		return ctrl.Result{}, nil
+	}
+
+	if allowed, err := r.namespaceAllowed(ctx, pod.Namespace); err != nil {
+		return ctrl.Result{}, err
+	} else if !allowed {
+		lg.V(1).Info("Ignoring pod in namespace that is not allowed to provision node pools")
+		r.ignored(ctx, &pod, auditReasonNamespaceNotAllowed)
+		return ctrl.Result{}, nil
+	}
+
 	// Return early if Pod should not trigger a scale up.
-	if !isPending(&pod) || !isUnschedulable(&pod) || !doesRequestResource(&pod, r.PodCriteria.ResourceType) || !hasNodeSelectors(&pod, cloud.GKETPUNodeSelector) {
-		lg.V(3).Info("Ignoring pod")
+	criteria, reason := auditCriteria(&pod, r.PodCriteria)
+	var noMatchingPool bool
+	if reason == auditReasonNotUnschedulable && r.StrictShapeMatching {
+		lacks, err := lacksMatchingNodePool(ctx, r, r.Provider.NodePoolOwner(), &pod)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if lacks && r.PodCriteria.matches(&pod) {
+			noMatchingPool = true
+			reason = ""
+		}
+	}
+	if reason != "" {
+		lg.V(3).Info("Ignoring pod", "reason", reason)
+		r.ignored(ctx, &pod, reason, criteria...)
+		return ctrl.Result{}, nil
+	}
+	if accel := podAccelerator(&pod); !r.AcceleratorAllowlist.allows(ctx, accel) {
+		lg.Info("Ignoring pod that requests an accelerator type that is not allowed", "accelerator", accel)
+		msg := fmt.Sprintf("Not ensuring Node Pool: accelerator type %q is not allowed.", accel)
+		if accel == "" {
+			msg = "Not ensuring Node Pool: the Pod must select an allowed accelerator type."
+		}
+		r.Recorder.Event(&pod, corev1.EventTypeWarning, EventAcceleratorTypeNotAllowed, msg)
+		r.ignored(ctx, &pod, EventAcceleratorTypeNotAllowed, eventFieldAccelerator, accel)
 		return ctrl.Result{}, nil
 	}
 
-	lg.Info("Ensuring node pool for unschedulable pod")
-	r.Recorder.Eventf(&pod, corev1.EventTypeNormal, EventEnsuringNodePool, "Ensuring Node Pool, triggered by Pod %s/%s.", pod.Namespace, pod.Name)
-	if err := r.Provider.EnsureNodePoolForPod(&pod); err != nil {
-		if errors.Is(err, cloud.ErrDuplicateRequest) {
-			lg.Info("Ignoring duplicate request to create node pool")
-		} else {
-			r.Recorder.Event(&pod, corev1.EventTypeWarning, EventFailedEnsuringNodePool, "Failed to ensure existance of Node Pool: "+err.Error())
+	if r.RetryPolicy.abandoned(&pod) {
+		lg.V(1).Info("Ignoring pod that node pool provisioning was abandoned for", "attempts", provisioningAttempts(&pod))
+		r.ignored(ctx, &pod, EventProvisioningAbandoned)
+		return ctrl.Result{}, nil
+	}
+	if provisioningTimedOut(&pod) {
+		lg.V(1).Info("Ignoring pod whose node pool was not ready within the provisioning timeout")
+		r.ignored(ctx, &pod, EventProvisioningTimeout)
+		return ctrl.Result{}, nil
+	}
+	if result, handled, err := r.checkProvisioningTimeout(ctx, &pod); handled || err != nil {
+		return result, err
+	}
+	if wait := r.RetryPolicy.permanentRetryWait(&pod, time.Now()); wait > 0 {
+		lg.V(3).Info("Waiting to retry pod after permanent error", "attempts", provisioningAttempts(&pod), "wait", wait)
+		r.audit(ctx, &pod, auditDeferred, "PermanentErrorBackoff")
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+	if wait := r.RetryPolicy.quotaRetryWait(&pod, time.Now()); wait > 0 {
+		lg.V(3).Info("Waiting to retry pod after quota was exceeded", "wait", wait)
+		r.audit(ctx, &pod, auditDeferred, EventQuotaExceeded)
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	if _, pending := pod.Annotations[cloud.AnnotationNodePoolOperationStarted]; pending {
+		return r.pollOperation(ctx, &pod)
+	}
+
+	// Don't create a node pool that the Pod would not be able to schedule onto.
+	taints, err := r.Provider.NodePoolTaintsForPod(&pod)
+	if err != nil {
+		r.Recorder.Event(&pod, corev1.EventTypeWarning, EventInvalidNodePoolTaints, err.Error())
+		r.ignored(ctx, &pod, EventInvalidNodePoolTaints, auditKeyError, err.Error())
+		return ctrl.Result{}, nil
+	}
+	if taint, ok := cloud.UntoleratedTaint(&pod, taints); ok {
+		lg.Info("Ignoring pod that does not tolerate node pool taint", "taint", taint.ToString())
+		r.Recorder.Eventf(&pod, corev1.EventTypeWarning, EventMissingToleration, "Not ensuring Node Pool: Pod does not tolerate taint %s that would be applied to the Node Pool.", taint.ToString())
+		r.ignored(ctx, &pod, EventMissingToleration)
+		return ctrl.Result{}, nil
+	}
+
+	if paused, err := r.PauseSwitch.paused(ctx, r); err != nil {
+		return ctrl.Result{}, err
+	} else if paused {
+		lg.V(1).Info("Not ensuring node pool while provisioning is paused")
+		r.Recorder.Event(&pod, corev1.EventTypeNormal, EventProvisioningPaused, "Not ensuring Node Pool while provisioning is paused.")
+		r.audit(ctx, &pod, auditDeferred, EventProvisioningPaused)
+		return ctrl.Result{RequeueAfter: r.PauseSwitch.requeueInterval()}, nil
+	}
+
+	if r.PriorityPolicy.Enabled {
+		var pods corev1.PodList
+		if err := r.List(ctx, &pods, client.MatchingFields{priorityWaitingIndex: "true"}); err != nil {
+			return ctrl.Result{}, fmt.Errorf("listing pods: %w", err)
+		}
+		deferred, err := r.PriorityPolicy.shouldDefer(&pod, pods.Items, func(p *corev1.Pod) (bool, error) { return r.wouldServe(ctx, p) }, time.Now())
+		if err != nil {
 			return ctrl.Result{}, err
 		}
+		if deferred {
+			lg.V(1).Info("Deferring pod while pods with a higher priority are waiting", "priority", podPriority(&pod))
+			r.audit(ctx, &pod, auditDeferred, "HigherPriorityPending")
+			return ctrl.Result{RequeueAfter: r.PriorityPolicy.RequeueInterval}, nil
+		}
+	}
+
+	var npReq cloud.NodePoolRequest
+	trigger := fmt.Sprintf("Pod %s/%s", pod.Namespace, pod.Name)
+	// The slice is sized from the node selectors that the node pool is
+	// created for. Pods whose selectors cannot be completed are reported by
+	// the provider.
+	selectorPod, err := cloud.CompleteTPUSelectors(&pod, r.IncompleteSelectorPolicy, r.AcceleratorDefaults)
+	if err != nil {
+		selectorPod = &pod
+	}
+	if key, nodeCount, ok := r.jobSetSliceSize(ctx, selectorPod); ok {
+		npReq = cloud.NodePoolRequest{NodeCount: nodeCount, Topology: cloud.NodeSelectorForPod(selectorPod)[cloud.GKETPUNodeSelector]}
+		trigger = "slice " + key
+		lg.Info("Ensuring node pool for slice sized by its JobSet", "slice", key, "nodeCount", nodeCount)
+	} else if key, ok := sliceKey(&pod); ok && r.SliceDebounce > 0 && hasNodeSelectors(selectorPod, cloud.GKETPUNodeSelector, cloud.GKEAcceleratorNodeSelector) {
+		nodeSelector := cloud.NodeSelectorForPod(selectorPod)
+		topo := nodeSelector[cloud.GKETPUNodeSelector]
+		nodeCount, err := cloud.TPUTopologyToNodeCount(nodeSelector[cloud.GKEAcceleratorNodeSelector], topo)
+		if err != nil {
+			r.Recorder.Event(&pod, corev1.EventTypeWarning, EventFailedEnsuringNodePool, "Failed to determine slice size: "+err.Error())
+			r.audit(ctx, &pod, auditFailed, EventFailedEnsuringNodePool, auditKeyError, err.Error())
+			return ctrl.Result{}, nil
+		}
+
+		dispatch, wait := r.slices.observe(key, pod.Name, nodeCount, r.SliceDebounce)
+		if !dispatch {
+			if wait > 0 {
+				lg.V(3).Info("Waiting for remaining pods in slice", "slice", key, "waiting", wait)
+				r.audit(ctx, &pod, auditDeferred, "SliceDebounce")
+				return ctrl.Result{RequeueAfter: wait}, nil
+			}
+			lg.V(3).Info("Node pool request for slice already in progress", "slice", key)
+			r.ignored(ctx, &pod, auditReasonSliceInProgress)
+			return ctrl.Result{}, nil
+		}
+		defer r.slices.done(key)
+
+		npReq = cloud.NodePoolRequest{NodeCount: nodeCount, Topology: topo}
+		trigger = "slice " + key
+		lg.Info("Ensuring node pool for unschedulable slice", "slice", key, "nodeCount", nodeCount)
+	} else if noMatchingPool {
+		lg.Info("Ensuring node pool for pod without a matching node pool", "reason", auditReasonNoMatchingNodePool)
 	} else {
-		r.Recorder.Event(&pod, corev1.EventTypeNormal, EventNodePoolEnsured, "Node Pool Ensured.")
+		lg.Info("Ensuring node pool for unschedulable pod")
+	}
+	npReq.Placement = cloud.PlacementIntentForPod(&pod)
+
+	nodePoolName, err := nodePoolNameForPod(r.Provider, &pod)
+	if err != nil {
+		lg.Error(err, "Failed to determine node pool name")
+	}
+	fields := podEventFields(&pod, nodePoolName, npReq)
+	msg := fmt.Sprintf("Ensuring Node Pool, triggered by %s.", trigger)
+	if report, fields := r.SliceAggregator.transition(&pod, EventEnsuringNodePool, fields); report {
+		r.Recorder.Event(&pod, corev1.EventTypeNormal, EventEnsuringNodePool, eventMessage(msg, fields...))
+		r.EventSink.record(&pod, corev1.EventTypeNormal, EventEnsuringNodePool, msg, nil, fields...)
+	}
+	r.JobSetEvents.record(ctx, &pod, corev1.EventTypeNormal, EventEnsuringNodePool, "Ensuring Node Pool for slice.", fields...)
+	// Avoid flipping an Ensured condition back to Ensuring every time the
+	// still-pending Pod is reconciled, and a Failed one on every retry: each
+	// flip is two status updates.
+	if !hasPodCondition(&pod, PodConditionNodePoolProvisioning, NodePoolProvisioningEnsured) &&
+		!hasPodCondition(&pod, PodConditionNodePoolProvisioning, NodePoolProvisioningFailed) {
+		r.updateProvisioningCondition(ctx, &pod, corev1.ConditionTrue, NodePoolProvisioningEnsuring, fmt.Sprintf("Ensuring Node Pool %s.", nodePoolName))
+	}
+
+	if r.NodePoolFinalizer && !controllerutil.ContainsFinalizer(&pod, NodePoolFinalizer) {
+		patch := client.MergeFrom(pod.DeepCopy())
+		controllerutil.AddFinalizer(&pod, NodePoolFinalizer)
+		if err := r.Patch(ctx, &pod, patch); err != nil {
+			return ctrl.Result{}, fmt.Errorf("adding finalizer: %w", err)
+		}
+	}
+	if err := r.markProvisioningStarted(ctx, &pod); err != nil {
+		return ctrl.Result{}, fmt.Errorf("recording provisioning start: %w", err)
+	}
+
+	op, err := r.ensureNodePool(ctx, &pod, nodePoolName, npReq)
+	ctx, cancel := r.checkpointContext(ctx)
+	defer cancel()
+
+	if op != nil && op.NodePool != "" && op.NodePool != nodePoolName {
+		// The preferred name was taken by another node pool.
+		nodePoolName = op.NodePool
+		fields = podEventFields(&pod, nodePoolName, npReq)
+	}
+	if op != nil {
+		lg.Info("Node pool operation", "operation", op.Name, "pending", op.Pending)
+		fields = append(fields, eventFieldOperation, op.Name)
+		if err := r.annotateOperation(ctx, &pod, op); err != nil {
+			if op.Pending {
+				// Without the annotation the operation would not be polled.
+				return ctrl.Result{}, fmt.Errorf("annotating pod with node pool operation: %w", err)
+			}
+			lg.Error(err, "Failed to annotate pod with node pool operation")
+		}
+	}
+
+	if err != nil {
+		if errors.Is(err, cloud.ErrDuplicateRequest) {
+			nodePoolCreationAttempts.WithLabelValues("duplicate").Inc()
+			lg.Info("Ignoring duplicate request to create node pool")
+			r.ignored(ctx, &pod, auditReasonDuplicateRequest, auditKeyNodePool, nodePoolName)
+			return ctrl.Result{}, nil
+		}
+		var rateLimited *cloud.RateLimitedError
+		if errors.As(err, &rateLimited) {
+			lg.Info("Node pool creation throttled by rate limiter", "retryAfter", rateLimited.RetryAfter)
+			r.audit(ctx, &pod, auditDeferred, "RateLimited", auditKeyNodePool, nodePoolName)
+			return ctrl.Result{RequeueAfter: r.RetryPolicy.jitter(rateLimited.RetryAfter)}, nil
+		}
+		var cooldown *cloud.CooldownError
+		if errors.As(err, &cooldown) {
+			lg.Info("Node pool of the same shape was recently deleted, waiting for cooldown", "shape", cooldown.Shape, "retryAfter", cooldown.RetryAfter)
+			r.audit(ctx, &pod, auditDeferred, EventCooldownActive, auditKeyNodePool, nodePoolName)
+			r.Recorder.Event(&pod, corev1.EventTypeNormal, EventCooldownActive,
+				eventMessage(fmt.Sprintf("Not ensuring Node Pool until the recreate cooldown ends in %v.", cooldown.RetryAfter.Round(time.Second)), fields...))
+			return ctrl.Result{RequeueAfter: cooldown.RetryAfter}, nil
+		}
+
+		return r.ensureFailed(ctx, &pod, nodePoolName, fields, err)
+	}
+
+	if op != nil && op.Pending {
+		lg.Info("Waiting for node pool operation", "operation", op.Name, "pollInterval", r.OperationPolling.Interval)
+		r.audit(ctx, &pod, auditPending, "OperationPending", auditKeyNodePool, nodePoolName)
+		return ctrl.Result{RequeueAfter: r.OperationPolling.Interval}, nil
+	}
+
+	r.ensured(ctx, &pod, nodePoolName, expectedNodeCount(&pod, npReq), fields)
+	return ctrl.Result{RequeueAfter: r.ProvisioningTimeout.requeueAfter(&pod, time.Now())}, nil
+}
+
+// ensureFailed records that ensuring the node pool of the Pod failed and
+// returns the result determined by the RetryPolicy.
+func (r *CreationReconciler) ensureFailed(ctx context.Context, pod *corev1.Pod, nodePoolName string, fields []string, err error) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+
+	nodePoolCreationAttempts.WithLabelValues("error").Inc()
+	nodePoolCreationErrors.WithLabelValues(cloud.ErrorCategory(err)).Inc()
+	r.recordFailure(pod, nodePoolName, err)
+	r.updateProvisioningCondition(ctx, pod, corev1.ConditionFalse, NodePoolProvisioningFailed, fmt.Sprintf("Failed to ensure Node Pool %s: %v", nodePoolName, err))
+
+	reason := EventFailedEnsuringNodePool
+	switch {
+	case errors.Is(err, cloud.ErrInvalidNodePoolConfig):
+		reason = EventInvalidNodePoolConfig
+	case errors.Is(err, cloud.ErrInvalidTPUConfig):
+		reason = EventInvalidTPUConfig
+	case errors.Is(err, cloud.ErrReservationUnavailable):
+		reason = EventReservationUnavailable
+	case errors.Is(err, cloud.ErrPlacementPolicyNotFound):
+		reason = EventPlacementPolicyNotFound
+	case errors.Is(err, cloud.ErrUnknownNodePoolClass):
+		reason = EventUnknownNodePoolClass
+	case errors.Is(err, cloud.ErrInvalidDiskConfig):
+		reason = EventInvalidDiskConfig
+	case errors.Is(err, cloud.ErrInvalidNetworkConfig):
+		reason = EventInvalidNetworkConfig
+	case errors.Is(err, cloud.ErrIncompatibleNodeVersion):
+		reason = EventIncompatibleNodeVersion
+	case errors.Is(err, cloud.ErrInvalidServiceAccount):
+		reason = EventInvalidServiceAccount
+	case errors.Is(err, cloud.ErrServiceAccountPermission):
+		reason = EventServiceAccountPermissionDenied
+	case errors.Is(err, cloud.ErrProjectPermission):
+		reason = EventProjectPermissionDenied
+		var perr *cloud.ProjectPermissionError
+		if errors.As(err, &perr) {
+			fields = append(fields, eventFieldProjectRole, perr.Role, eventFieldProject, perr.Project)
+		}
+	case errors.Is(err, cloud.ErrNodePoolLimitReached):
+		reason = EventNodePoolLimitReached
+	case errors.Is(err, cloud.ErrZoneStockout):
+		reason = EventZoneStockout
+		nodePoolStockouts.WithLabelValues(eventField(fields, eventFieldAccelerator)).Inc()
+	case errors.Is(err, cloud.ErrNodeManagementConflict):
+		reason = EventNodeManagementConflict
+	case errors.Is(err, cloud.ErrIncompatibleLocality):
+		reason = EventIncompatibleLocality
+	case errors.Is(err, cloud.ErrInvalidImageType):
+		reason = EventInvalidImageType
+	case errors.Is(err, cloud.ErrInvalidHostVMConfig):
+		reason = EventInvalidHostVMConfig
+	case errors.Is(err, cloud.ErrInvalidSandboxConfig):
+		reason = EventInvalidSandboxConfig
+	case errors.Is(err, cloud.ErrInvalidKubeletConfig):
+		reason = EventInvalidKubeletConfig
+	case errors.Is(err, cloud.ErrInvalidMaxPodsPerNode):
+		reason = EventInvalidMaxPodsPerNode
+	case errors.Is(err, cloud.ErrInvalidResourceManagerTags):
+		reason = EventInvalidResourceManagerTags
+	case errors.Is(err, cloud.ErrResourceManagerTagBinding):
+		reason = EventResourceManagerTagBindingFailed
+	case errors.Is(err, cloud.ErrInvalidNetworkInterfaceConfig):
+		reason = EventInvalidNetworkInterfaceConfig
+	case errors.Is(err, cloud.ErrCreateHookRejected):
+		reason = EventCreateHookRejected
+	case errors.Is(err, cloud.ErrCreateHookFailed):
+		reason = EventCreateHookFailed
+	case errors.Is(err, cloud.ErrIncompleteTPUSelector):
+		reason = EventIncompleteSelector
+	case errors.Is(err, cloud.ErrUnsatisfiableTopology):
+		reason = EventUnsatisfiableTopology
+	case errors.Is(err, cloud.ErrClusterNotFound):
+		reason = EventMisconfigured
+		lg.Error(err, "The configured GKE project or cluster does not exist, check the provisioner configuration")
+	case errors.Is(err, cloud.ErrTemplateNotFound):
+		reason = EventTemplateNotFound
+	case errors.Is(err, cloud.ErrOperationInProgress):
+		reason = EventOperationInProgress
+		var inProgress *cloud.OperationInProgressError
+		if errors.As(err, &inProgress) {
+			fields = append(fields, eventFieldConflictingOperation, inProgress.Operation)
+		}
+	case errors.Is(err, cloud.ErrQuotaExceeded):
+		reason = EventQuotaExceeded
+		if err := r.annotatePod(ctx, pod, cloud.AnnotationLastQuotaFailure, time.Now().UTC().Format(time.RFC3339)); err != nil {
+			lg.Error(err, "Failed to annotate pod with quota failure")
+		}
+	}
+	if report, fields := r.SliceAggregator.transition(pod, reason, fields); report {
+		r.Recorder.Event(pod, corev1.EventTypeWarning, reason, eventMessage("Failed to ensure existance of Node Pool: "+err.Error(), fields...))
+		r.EventSink.record(pod, corev1.EventTypeWarning, reason, "Failed to ensure existance of Node Pool.", err, fields...)
+	}
+	r.JobSetEvents.record(ctx, pod, corev1.EventTypeWarning, reason, "Failed to ensure Node Pool for slice: "+err.Error(), fields...)
+	r.audit(ctx, pod, auditFailed, reason, auditKeyNodePool, nodePoolName, auditKeyError, err.Error())
+
+	if isPermanentError(err) && r.RetryPolicy.MaxPermanentAttempts > 0 {
+		return r.recordPermanentFailure(ctx, pod, err, fields)
+	}
+
+	result, retErr := r.RetryPolicy.resultFor(err)
+	if retErr == nil {
+		lg.Error(err, "Failed to ensure node pool", "permanent", isPermanentError(err), "requeueAfter", result.RequeueAfter)
+	}
+	return result, retErr
+}
+
+// ensured records that the node pool of the Pod, expected to have nodeCount
+// Nodes, exists.
+func (r *CreationReconciler) ensured(ctx context.Context, pod *corev1.Pod, nodePoolName string, nodeCount int, fields []string) {
+	lg := log.FromContext(ctx)
+
+	nodePoolCreationAttempts.WithLabelValues("success").Inc()
+	_, failed := pod.Annotations[cloud.AnnotationProvisioningAttempts]
+	_, quotaFailed := pod.Annotations[cloud.AnnotationLastQuotaFailure]
+	if failed || quotaFailed {
+		if err := r.clearFailures(ctx, pod); err != nil {
+			lg.Error(err, "Failed to remove provisioning failure annotations")
+		}
+	}
+	if _, reported := pod.Annotations[cloud.AnnotationNodePoolReady]; r.ReadyTracker != nil && nodePoolName != "" && !reported {
+		since, _ := unschedulableSince(pod)
+		r.ReadyTracker.track(nodePoolName, client.ObjectKeyFromObject(pod), nodeCount, since)
+	}
+	r.updateProvisioningCondition(ctx, pod, corev1.ConditionTrue, NodePoolProvisioningEnsured, fmt.Sprintf("Node Pool %s ensured.", nodePoolName))
+	if report, fields := r.SliceAggregator.transition(pod, EventNodePoolEnsured, fields); report {
+		r.Recorder.Event(pod, corev1.EventTypeNormal, EventNodePoolEnsured, eventMessage("Node Pool Ensured.", fields...))
+		r.EventSink.record(pod, corev1.EventTypeNormal, EventNodePoolEnsured, "Node Pool Ensured.", nil, fields...)
+	}
+	r.JobSetEvents.record(ctx, pod, corev1.EventTypeNormal, EventNodePoolEnsured, "Node Pool for slice ensured.", fields...)
+	r.audit(ctx, pod, auditEnsured, EventNodePoolEnsured, auditKeyNodePool, nodePoolName)
+}
+
+// namespaceAllowed returns whether Pods in the namespace may trigger node pool
+// creation. The Namespace is only fetched if the global lists disallow it.
+func (r *CreationReconciler) namespaceAllowed(ctx context.Context, name string) (bool, error) {
+	if r.NamespaceFilter.allows(name) {
+		return true, nil
+	}
+	var ns corev1.Namespace
+	if err := r.Get(ctx, types.NamespacedName{Name: name}, &ns); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("getting namespace: %w", err)
+	}
+	return ns.Annotations[cloud.AnnotationNamespaceEnabled] == "true", nil
+}
+
+// nodePoolNameForPod returns the name of the node pool for the Pod: the
+// alternate name that the provider recorded after the preferred name was
+// taken by another node pool, or else the preferred name.
+func nodePoolNameForPod(p cloud.Provider, pod *corev1.Pod) (string, error) {
+	if name := pod.Annotations[cloud.AnnotationNodePoolName]; name != "" {
+		return name, nil
+	}
+	return p.NodePoolNameForPod(pod)
+}
+
+// expectedNodeCount returns the number of Nodes that the node pool for the
+// Pod is expected to have, or 0 if unknown.
+func expectedNodeCount(p *corev1.Pod, npReq cloud.NodePoolRequest) int {
+	if npReq.NodeCount > 0 {
+		return npReq.NodeCount
+	}
+	nodeSelector := cloud.NodeSelectorForPod(p)
+	if topo, ok := nodeSelector[cloud.GKETPUNodeSelector]; ok {
+		n, _ := cloud.TPUTopologyToNodeCount(nodeSelector[cloud.GKEAcceleratorNodeSelector], topo)
+		return n
 	}
+	return 1
+}
 
-	return ctrl.Result{}, nil
+func (r *CreationReconciler) annotatePod(ctx context.Context, pod *corev1.Pod, key, value string) error {
+	patch := client.MergeFrom(pod.DeepCopy())
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[key] = value
+	return r.Patch(ctx, pod, patch)
+}
+
+// recordPermanentFailure records a permanent failure to ensure the node pool
+// of the Pod and either schedules a retry with backoff or abandons the Pod
+// once RetryPolicy.MaxPermanentAttempts is reached.
+func (r *CreationReconciler) recordPermanentFailure(ctx context.Context, pod *corev1.Pod, ensureErr error, fields []string) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+
+	attempts := provisioningAttempts(pod) + 1
+	patch := client.MergeFrom(pod.DeepCopy())
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[cloud.AnnotationProvisioningAttempts] = strconv.Itoa(attempts)
+	pod.Annotations[cloud.AnnotationLastProvisioningFailure] = time.Now().UTC().Format(time.RFC3339)
+	pod.Annotations[cloud.AnnotationLastProvisioningError] = truncateError(ensureErr)
+	if err := r.Patch(ctx, pod, patch); err != nil {
+		return ctrl.Result{}, fmt.Errorf("recording provisioning failure: %w", err)
+	}
+
+	if attempts >= r.RetryPolicy.MaxPermanentAttempts {
+		podsAbandoned.WithLabelValues(cloud.ErrorCategory(ensureErr)).Inc()
+		lg.Error(ensureErr, "Abandoning node pool provisioning for pod", "attempts", attempts)
+		r.Recorder.Event(pod, corev1.EventTypeWarning, EventProvisioningAbandoned,
+			eventMessage(fmt.Sprintf("Abandoned ensuring Node Pool after %d failed attempts: %v", attempts, ensureErr), fields...))
+		return ctrl.Result{}, nil
+	}
+
+	backoff := r.RetryPolicy.jitter(r.RetryPolicy.permanentBackoff(attempts))
+	lg.Error(ensureErr, "Failed to ensure node pool", "permanent", true, "attempts", attempts, "requeueAfter", backoff)
+	return ctrl.Result{RequeueAfter: backoff}, nil
+}
+
+// clearFailures removes the permanent and quota failures recorded on the Pod.
+func (r *CreationReconciler) clearFailures(ctx context.Context, pod *corev1.Pod) error {
+	patch := client.MergeFrom(pod.DeepCopy())
+	delete(pod.Annotations, cloud.AnnotationLastQuotaFailure)
+	delete(pod.Annotations, cloud.AnnotationProvisioningAttempts)
+	delete(pod.Annotations, cloud.AnnotationLastProvisioningFailure)
+	delete(pod.Annotations, cloud.AnnotationLastProvisioningError)
+	return r.Patch(ctx, pod, patch)
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *CreationReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.Pod{}).
-		Complete(r)
+	r.RetryPolicy = r.RetryPolicy.withDefaults()
+	r.PriorityPolicy = r.PriorityPolicy.withDefaults()
+	r.OperationPolling = r.OperationPolling.withDefaults()
+	if r.PriorityPolicy.Enabled {
+		if err := mgr.GetFieldIndexer().IndexField(context.Background(), &corev1.Pod{}, priorityWaitingIndex, indexPriorityWaiting); err != nil {
+			return err
+		}
+	}
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Pod{}, builder.WithPredicates(
+			predicate.NewPredicateFuncs(r.PodCriteria.mayTrigger),
+			predicate.Funcs{UpdateFunc: r.PodCriteria.relevantUpdate},
+		)).
+		WithOptions(crcontroller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles})
+	if r.Resync != nil {
+		b = b.Watches(&source.Channel{Source: r.Resync}, &handler.EnqueueRequestForObject{})
+	}
+	if r.Sweep != nil {
+		b = b.Watches(&source.Channel{Source: r.Sweep}, &handler.EnqueueRequestForObject{})
+	}
+	return b.Complete(r)
 }
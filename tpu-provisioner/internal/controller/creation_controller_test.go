@@ -2,15 +2,27 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"testing"
 	"time"
 
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	apires "k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
 // +kubebuilder:docs-gen:collapse=Imports
@@ -111,6 +123,15 @@ var _ = Describe("Creation controller", func() {
 				return provider.getCreated(types.NamespacedName{Name: targetPod.Name, Namespace: targetPod.Namespace})
 			}, timeout, interval).Should(BeTrue())
 
+			By("Checking that the Pod reports that its Node Pool was ensured")
+			Eventually(func() bool {
+				var p corev1.Pod
+				if err := k8sClient.Get(ctx, types.NamespacedName{Name: targetPod.Name, Namespace: targetPod.Namespace}, &p); err != nil {
+					return false
+				}
+				return hasPodCondition(&p, PodConditionNodePoolProvisioning, NodePoolProvisioningEnsured)
+			}, timeout, interval).Should(BeTrue())
+
 			By("Checking that excessive Node Pool creation attempts were not made")
 			// Ensure the non-pending Pod did not result in a Node Pool creation attempt.
 			Consistently(func() bool {
@@ -120,3 +141,407 @@ var _ = Describe("Creation controller", func() {
 	})
 
 })
+
+func Test_PodCriteria_matches(t *testing.T) {
+	pod := func(lbls map[string]string) *corev1.Pod {
+		p := &corev1.Pod{}
+		p.Labels = lbls
+		p.Spec.NodeSelector = map[string]string{"cloud.google.com/gke-tpu-topology": "2x2x1"}
+		p.Spec.Containers = []corev1.Container{{
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{"google.com/tpu": apires.MustParse("4")},
+			},
+		}}
+		return p
+	}
+	selector := labels.SelectorFromSet(labels.Set{"team": "ml-research"})
+	annotated := func(v string) *corev1.Pod {
+		p := pod(nil)
+		p.Annotations = map[string]string{cloud.AnnotationSkipProvisioning: v}
+		return p
+	}
+	acceleratorOnly := pod(nil)
+	acceleratorOnly.Spec.NodeSelector = map[string]string{cloud.GKEAcceleratorNodeSelector: cloud.V5ePodSliceAccelerator}
+	skip := PodCriteria{ResourceType: "google.com/tpu", SkipAnnotation: cloud.AnnotationSkipProvisioning}
+
+	cases := []struct {
+		name     string
+		criteria PodCriteria
+		pod      *corev1.Pod
+		exp      bool
+	}{
+		{name: "no selector", criteria: PodCriteria{ResourceType: "google.com/tpu"}, pod: pod(nil), exp: true},
+		{name: "selector matches", criteria: PodCriteria{ResourceType: "google.com/tpu", Selector: selector}, pod: pod(map[string]string{"team": "ml-research"}), exp: true},
+		{name: "selector does not match", criteria: PodCriteria{ResourceType: "google.com/tpu", Selector: selector}, pod: pod(map[string]string{"team": "web"}), exp: false},
+		{name: "selector matches without resource", criteria: PodCriteria{ResourceType: "nvidia.com/gpu", Selector: selector}, pod: pod(map[string]string{"team": "ml-research"}), exp: false},
+		{name: "alternative resource type", criteria: PodCriteria{ResourceTypes: []string{"example.com/tpu", "google.com/tpu"}}, pod: pod(nil), exp: true},
+		{name: "other resource types", criteria: PodCriteria{ResourceTypes: []string{"example.com/tpu"}}, pod: pod(nil), exp: false},
+		{name: "skipped", criteria: skip, pod: annotated("true"), exp: false},
+		{name: "skip annotation not true", criteria: skip, pod: annotated("false"), exp: true},
+		{name: "skip annotation disabled", criteria: PodCriteria{ResourceType: "google.com/tpu"}, pod: annotated("true"), exp: true},
+		{name: "accelerator without topology", criteria: PodCriteria{ResourceType: "google.com/tpu"}, pod: acceleratorOnly, exp: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.criteria.matches(c.pod); got != c.exp {
+				t.Fatalf("expected: %v, got: %v", c.exp, got)
+			}
+		})
+	}
+}
+
+func Test_doesRequestResource(t *testing.T) {
+	resources := func(requests, limits corev1.ResourceList) corev1.Container {
+		return corev1.Container{Resources: corev1.ResourceRequirements{Requests: requests, Limits: limits}}
+	}
+	tpu := corev1.ResourceList{"example.com/tpu": apires.MustParse("4")}
+
+	cases := []struct {
+		name string
+		pod  corev1.PodSpec
+		exp  bool
+	}{
+		{name: "request", pod: corev1.PodSpec{Containers: []corev1.Container{resources(tpu, nil)}}, exp: true},
+		{name: "limit only", pod: corev1.PodSpec{Containers: []corev1.Container{resources(nil, tpu)}}, exp: true},
+		{name: "init container", pod: corev1.PodSpec{Containers: []corev1.Container{{}}, InitContainers: []corev1.Container{resources(tpu, nil)}}, exp: true},
+		{name: "other resource", pod: corev1.PodSpec{Containers: []corev1.Container{resources(corev1.ResourceList{"google.com/tpu": apires.MustParse("4")}, nil)}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := &corev1.Pod{Spec: c.pod}
+			if got := doesRequestResource(p, "example.com/tpu"); got != c.exp {
+				t.Fatalf("expected: %v, got: %v", c.exp, got)
+			}
+		})
+	}
+}
+
+func Test_PodCriteria_mayTrigger(t *testing.T) {
+	criteria := PodCriteria{ResourceType: "google.com/tpu"}
+	pod := func(phase corev1.PodPhase, unschedulable bool, resourceName corev1.ResourceName) *corev1.Pod {
+		p := &corev1.Pod{}
+		p.Status.Phase = phase
+		if unschedulable {
+			p.Status.Conditions = []corev1.PodCondition{{
+				Type:   corev1.PodScheduled,
+				Status: corev1.ConditionFalse,
+				Reason: corev1.PodReasonUnschedulable,
+			}}
+		}
+		p.Spec.NodeSelector = map[string]string{"cloud.google.com/gke-tpu-topology": "2x2x1"}
+		p.Spec.Containers = []corev1.Container{{
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{resourceName: apires.MustParse("4")},
+			},
+		}}
+		return p
+	}
+
+	cases := []struct {
+		name string
+		pod  *corev1.Pod
+		exp  bool
+	}{
+		{name: "pending", pod: pod(corev1.PodPending, false, "google.com/tpu"), exp: true},
+		{name: "unschedulable", pod: pod(corev1.PodPending, true, "google.com/tpu"), exp: true},
+		{name: "running", pod: pod(corev1.PodRunning, false, "google.com/tpu"), exp: false},
+		{name: "other resource", pod: pod(corev1.PodPending, true, "cpu"), exp: false},
+		{name: "not a pod", exp: false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var o client.Object = &corev1.Node{}
+			if c.pod != nil {
+				o = c.pod
+			}
+			if got := criteria.mayTrigger(o); got != c.exp {
+				t.Fatalf("expected: %v, got: %v", c.exp, got)
+			}
+		})
+	}
+
+	// The status update that makes a Pod Unschedulable is queued.
+	p := predicate.NewPredicateFuncs(criteria.mayTrigger)
+	if !p.Update(event.UpdateEvent{
+		ObjectOld: pod(corev1.PodPending, false, "google.com/tpu"),
+		ObjectNew: pod(corev1.PodPending, true, "google.com/tpu"),
+	}) {
+		t.Fatal("expected the transition into Unschedulable to be queued")
+	}
+}
+
+// podStore serves Pods and Nodes by name, and the Nodes that match the label
+// selector of a List call, records every write of the Pods and the Pods that
+// are evicted, which stay in place. Other calls panic.
+type podStore struct {
+	client.Client
+	pods         map[string]*corev1.Pod
+	nodes        []corev1.Node
+	writes       []*corev1.Pod
+	statusWrites int
+	evictions    []string
+}
+
+func newPodStore(pods ...*corev1.Pod) *podStore {
+	s := &podStore{pods: map[string]*corev1.Pod{}}
+	for _, p := range pods {
+		s.pods[p.Name] = p.DeepCopy()
+	}
+	return s
+}
+
+func (s *podStore) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	if n, ok := obj.(*corev1.Node); ok {
+		stored := s.node(key.Name)
+		if stored == nil {
+			return apierrors.NewNotFound(corev1.Resource("nodes"), key.Name)
+		}
+		stored.DeepCopyInto(n)
+		return nil
+	}
+	p, ok := s.pods[key.Name]
+	if !ok {
+		return apierrors.NewNotFound(corev1.Resource("pods"), key.Name)
+	}
+	p.DeepCopyInto(obj.(*corev1.Pod))
+	return nil
+}
+
+func (s *podStore) node(name string) *corev1.Node {
+	for i := range s.nodes {
+		if s.nodes[i].Name == name {
+			return &s.nodes[i]
+		}
+	}
+	return nil
+}
+
+func (s *podStore) List(_ context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	switch l := list.(type) {
+	case *corev1.PodList:
+		for _, p := range s.pods {
+			l.Items = append(l.Items, *p.DeepCopy())
+		}
+	case *corev1.NodeList:
+		o := (&client.ListOptions{}).ApplyOptions(opts)
+		for _, n := range s.nodes {
+			if o.LabelSelector == nil || o.LabelSelector.Matches(labels.Set(n.Labels)) {
+				l.Items = append(l.Items, *n.DeepCopy())
+			}
+		}
+	default:
+		return errors.New("not implemented")
+	}
+	return nil
+}
+
+// Patch applies the merge patch to the stored Pod or Node, like the API
+// server does, so that a patch made from a stale copy does not revert other
+// writes.
+func (s *podStore) Patch(_ context.Context, obj client.Object, patch client.Patch, _ ...client.PatchOption) error {
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	if n, ok := obj.(*corev1.Node); ok {
+		stored := s.node(n.Name)
+		if stored == nil {
+			return apierrors.NewNotFound(corev1.Resource("nodes"), n.Name)
+		}
+		current, err := json.Marshal(stored)
+		if err != nil {
+			return err
+		}
+		patched, err := jsonpatch.MergePatch(current, data)
+		if err != nil {
+			return err
+		}
+		var updated corev1.Node
+		if err := json.Unmarshal(patched, &updated); err != nil {
+			return err
+		}
+		updated.DeepCopyInto(stored)
+		updated.DeepCopyInto(n)
+		return nil
+	}
+	current, err := json.Marshal(s.pods[obj.GetName()])
+	if err != nil {
+		return err
+	}
+	patched, err := jsonpatch.MergePatch(current, data)
+	if err != nil {
+		return err
+	}
+	var p corev1.Pod
+	if err := json.Unmarshal(patched, &p); err != nil {
+		return err
+	}
+	p.DeepCopyInto(obj.(*corev1.Pod))
+	return s.write(&p)
+}
+
+func (s *podStore) Status() client.SubResourceWriter { return podStatusWriter{s: s} }
+
+func (s *podStore) SubResource(subResource string) client.SubResourceClient {
+	if subResource != "eviction" {
+		panic("not implemented: " + subResource)
+	}
+	return podEvictionClient{s: s}
+}
+
+type podEvictionClient struct {
+	client.SubResourceClient
+	s *podStore
+}
+
+func (c podEvictionClient) Create(_ context.Context, obj client.Object, _ client.Object, _ ...client.SubResourceCreateOption) error {
+	c.s.evictions = append(c.s.evictions, obj.GetName())
+	return nil
+}
+
+func (s *podStore) write(obj client.Object) error {
+	p := obj.(*corev1.Pod).DeepCopy()
+	s.pods[p.Name] = p
+	s.writes = append(s.writes, p)
+	return nil
+}
+
+type podStatusWriter struct {
+	client.SubResourceWriter
+	s *podStore
+}
+
+func (w podStatusWriter) Update(_ context.Context, obj client.Object, _ ...client.SubResourceUpdateOption) error {
+	w.s.statusWrites++
+	return w.s.write(obj)
+}
+
+// ensureErrProvider fails to ensure any node pool with err.
+type ensureErrProvider struct {
+	cloud.Mock
+	err error
+}
+
+func (p *ensureErrProvider) EnsureNodePoolForPod(*corev1.Pod, cloud.NodePoolRequest) (*cloud.NodePoolOperation, error) {
+	return nil, p.err
+}
+
+func Test_CreationReconciler_failedReconcileNotRequeuedByOwnWrites(t *testing.T) {
+	for _, ensureErr := range []error{
+		fmt.Errorf("%w: out of TPUs", cloud.ErrQuotaExceeded),
+		fmt.Errorf("%w: bad topology", cloud.ErrInvalidTPUConfig),
+	} {
+		t.Run(ensureErr.Error(), func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "w-0"},
+				Spec: corev1.PodSpec{
+					NodeSelector: map[string]string{
+						cloud.GKEAcceleratorNodeSelector: "tpu-v5-lite-podslice",
+						cloud.GKETPUNodeSelector:         "2x4",
+					},
+					Containers: []corev1.Container{{Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{"google.com/tpu": apires.MustParse("4")},
+					}}},
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodPending,
+					Conditions: []corev1.PodCondition{{
+						Type:   corev1.PodScheduled,
+						Status: corev1.ConditionFalse,
+						Reason: corev1.PodReasonUnschedulable,
+					}},
+				},
+			}
+			store := newPodStore(pod)
+			r := &CreationReconciler{
+				Client:      store,
+				Recorder:    record.NewFakeRecorder(100),
+				Provider:    &ensureErrProvider{err: ensureErr},
+				PodCriteria: PodCriteria{ResourceType: "google.com/tpu"},
+				RetryPolicy: RetryPolicy{}.withDefaults(),
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "w-0"}}
+
+			// The second reconcile is the retry after RequeueAfter, which
+			// must not flip the condition to Ensuring and back again.
+			for i := 0; i < 2; i++ {
+				if _, err := r.Reconcile(context.Background(), req); err != nil {
+					t.Fatalf("reconcile %d: unexpected error: %v", i, err)
+				}
+			}
+			if p := store.pods["w-0"]; !hasPodCondition(p, PodConditionNodePoolProvisioning, NodePoolProvisioningFailed) {
+				t.Fatalf("expected the Failed condition, got: %v", p.Status.Conditions)
+			}
+			if store.statusWrites != 2 {
+				t.Fatalf("expected the condition to be set to Ensuring and Failed once, got %d status writes", store.statusWrites)
+			}
+
+			// None of the writes queue the Pod again before the RequeueAfter.
+			p := predicate.Funcs{UpdateFunc: r.PodCriteria.relevantUpdate}
+			old := pod
+			for i, w := range store.writes {
+				if p.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: w}) {
+					t.Fatalf("write %d: expected the update not to be queued", i)
+				}
+				old = w
+			}
+		})
+	}
+}
+
+func Test_PodCriteria_relevantUpdate(t *testing.T) {
+	criteria := PodCriteria{SkipAnnotation: cloud.AnnotationSkipProvisioning}
+	pending := &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodPending}}
+	update := func(mutate func(*corev1.Pod)) bool {
+		p := pending.DeepCopy()
+		mutate(p)
+		return criteria.relevantUpdate(event.UpdateEvent{ObjectOld: pending, ObjectNew: p})
+	}
+
+	if !update(func(p *corev1.Pod) {
+		p.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: corev1.PodReasonUnschedulable}}
+	}) {
+		t.Fatal("expected the transition into Unschedulable to be queued")
+	}
+	if !update(func(p *corev1.Pod) { p.Labels = map[string]string{"team": "a"} }) {
+		t.Fatal("expected a label change to be queued")
+	}
+	if !update(func(p *corev1.Pod) { p.Annotations = map[string]string{cloud.AnnotationSkipProvisioning: "false"} }) {
+		t.Fatal("expected a change of the skip annotation to be queued")
+	}
+	if update(func(p *corev1.Pod) {
+		p.ResourceVersion = "2"
+		p.Annotations = map[string]string{cloud.AnnotationLastQuotaFailure: "2024-01-01T00:00:00Z"}
+	}) {
+		t.Fatal("expected an annotation-only update not to be queued")
+	}
+	if update(func(p *corev1.Pod) { p.Finalizers = []string{NodePoolFinalizer} }) {
+		t.Fatal("expected a finalizer-only update not to be queued")
+	}
+	if update(func(p *corev1.Pod) {
+		p.Status.Conditions = []corev1.PodCondition{{Type: PodConditionNodePoolProvisioning, Status: corev1.ConditionFalse, Reason: NodePoolProvisioningFailed}}
+	}) {
+		t.Fatal("expected an update of the provisioning condition not to be queued")
+	}
+}
+
+func Test_nodePoolNameForPod(t *testing.T) {
+	for name, c := range map[string]struct {
+		annotations map[string]string
+		expected    string
+	}{
+		"preferred name": {expected: "test-pod"},
+		"alternate name": {annotations: map[string]string{cloud.AnnotationNodePoolName: "test-pod-alt"}, expected: "test-pod-alt"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Annotations: c.annotations}}
+			got, err := nodePoolNameForPod(&testProvider{}, pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != c.expected {
+				t.Fatalf("node pool name: expected: %v, got: %v", c.expected, got)
+			}
+		})
+	}
+}
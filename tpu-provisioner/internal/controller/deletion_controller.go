@@ -39,6 +39,12 @@ type DeletionReconciler struct {
 
 	NodeCriteria               NodeCriteria
 	NodePoolsMarkedForDeletion sync.Map
+
+	// EventSink, if set, also receives the node pool deletion events.
+	EventSink *EventSink
+
+	// Tracer, if set, traces the provider calls that delete node pools.
+	Tracer Tracer
 }
 
 type NodeCriteria struct {
@@ -64,11 +70,16 @@ func (r *DeletionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	}
 
 	// NOTE: Because of the cache filter in main.go, this check should always evaluate to false.
-	if node.GetLabels()[cloud.LabelNodepoolManager] != cloud.LabelNodepoolManagerTPUPodinator {
+	if !r.Provider.NodePoolOwner().Owns(node.GetLabels()) {
 		lg.V(3).Info("Node was not provisioned by this controller, ignoring")
 		return ctrl.Result{}, nil
 	}
 
+	if warmNodePool([]corev1.Node{node}) {
+		lg.V(3).Info("Node belongs to an available warm node pool, ignoring")
+		return ctrl.Result{}, nil
+	}
+
 	// Ensure node was not just created to make sure Pods have had time to schedule.
 	if since := time.Since(node.GetCreationTimestamp().Time); since < r.NodeCriteria.MinLifetime {
 		wait := r.NodeCriteria.MinLifetime - since + time.Second
@@ -142,17 +153,24 @@ func (r *DeletionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	// If this point is reached, the node pool has passed the deletion check twice
 	// and can be deleted.
 	lg.Info(fmt.Sprintf("Node pool %q passed deletion check twice. Ensuring Node Pool is deleted", nodePoolName))
-	r.Recorder.Event(&node, corev1.EventTypeNormal, EventDeletingNodePool, DeletingNodePoolEventMessage)
-	if err := r.Provider.DeleteNodePoolForNode(&node); err != nil {
+	fields := nodeEventFields(&node, nodePoolName, len(nodes.Items))
+	r.Recorder.Event(&node, corev1.EventTypeNormal, EventDeletingNodePool, eventMessage(DeletingNodePoolEventMessage, fields...))
+	if err := tracedProvider(ctx, r.Tracer, r.Provider).DeleteNodePoolForNode(&node); err != nil {
+		var rateLimited *cloud.RateLimitedError
 		if errors.Is(err, cloud.ErrDuplicateRequest) {
 			lg.Info("Ignoring duplicate request to delete node pool")
 			return ctrl.Result{}, nil
+		} else if errors.As(err, &rateLimited) {
+			lg.Info("Node pool deletion throttled by rate limiter", "retryAfter", rateLimited.RetryAfter)
+			return ctrl.Result{RequeueAfter: rateLimited.RetryAfter}, nil
 		} else {
-			r.Recorder.Event(&node, corev1.EventTypeWarning, EventFailedDeletingNodePool, "Failed to delete Node Pool: "+err.Error())
+			r.Recorder.Event(&node, corev1.EventTypeWarning, EventFailedDeletingNodePool, eventMessage("Failed to delete Node Pool: "+err.Error(), fields...))
+			r.EventSink.record(&node, corev1.EventTypeWarning, EventFailedDeletingNodePool, "Failed to delete Node Pool.", err, fields...)
 			return ctrl.Result{}, client.IgnoreNotFound(err)
 		}
 	}
-	r.Recorder.Event(&node, corev1.EventTypeNormal, EventNodePoolDeleted, DeletedNodePoolEventMessage)
+	r.Recorder.Event(&node, corev1.EventTypeNormal, EventNodePoolDeleted, eventMessage(DeletedNodePoolEventMessage, fields...))
+	r.EventSink.record(&node, corev1.EventTypeNormal, EventNodePoolDeleted, DeletedNodePoolEventMessage, nil, fields...)
 
 	// Remove node pool from the map tracking node pools marked for deletion, in case the JobSet
 	// is reran in the future, as this will result in node pools with the same name being recreated,
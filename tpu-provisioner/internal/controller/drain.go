@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Actions taken when a node pool is not drained within the drain timeout.
+const (
+	// DrainTimeoutDelete deletes the node pool anyway, killing the Pods that
+	// were not evicted.
+	DrainTimeoutDelete = "delete"
+	// DrainTimeoutSkip keeps the node pool and uncordons its Nodes. It is
+	// drained again once it has been idle for the IdleDuration again.
+	DrainTimeoutSkip = "skip"
+)
+
+var drainTimeoutActions = []string{DrainTimeoutDelete, DrainTimeoutSkip}
+
+// ValidateDrainTimeoutAction returns an error if the action is not known.
+func ValidateDrainTimeoutAction(action string) error {
+	for _, a := range drainTimeoutActions {
+		if a == action {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown drain timeout action %q, must be one of %q", action, drainTimeoutActions)
+}
+
+//+kubebuilder:rbac:groups="",resources=pods/eviction,verbs=create
+
+// Drainer cordons the Nodes of a node pool and evicts their Pods before the
+// node pool is deleted. Pods are evicted with the Eviction API, so evictions
+// that a PodDisruptionBudget does not allow are refused by the API server and
+// retried. DaemonSet and mirror Pods are not evicted.
+type Drainer struct {
+	Client client.Client
+
+	// Timeout is how long draining a node pool may take before the
+	// TimeoutAction applies. It must be set.
+	Timeout time.Duration
+	// TimeoutAction is DrainTimeoutDelete or DrainTimeoutSkip.
+	TimeoutAction string
+}
+
+// podsToEvict returns the Pods running on the Nodes that must be evicted
+// before their node pool is deleted.
+func podsToEvict(nodes []corev1.Node, pods []corev1.Pod) []*corev1.Pod {
+	onNodes := map[string]bool{}
+	for _, n := range nodes {
+		onNodes[n.Name] = true
+	}
+	var out []*corev1.Pod
+	for i := range pods {
+		p := &pods[i]
+		if !onNodes[p.Spec.NodeName] || isDone(p) {
+			continue
+		}
+		if owner := metav1.GetControllerOf(p); owner != nil && (owner.Kind == "DaemonSet" || owner.Kind == "Node") {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// drain cordons the Nodes and requests the eviction of the Pods running on
+// them. It returns the number of Pods left, that are terminating or whose
+// eviction is not allowed yet; the node pool is drained once it is zero.
+func (d *Drainer) drain(ctx context.Context, nodes []corev1.Node, pods []corev1.Pod) (int, error) {
+	for i := range nodes {
+		if err := d.cordon(ctx, &nodes[i]); err != nil {
+			return 0, err
+		}
+	}
+	left := podsToEvict(nodes, pods)
+	for _, p := range left {
+		if p.DeletionTimestamp != nil {
+			continue
+		}
+		if err := d.evict(ctx, p); err != nil {
+			return 0, err
+		}
+	}
+	return len(left), nil
+}
+
+func (d *Drainer) cordon(ctx context.Context, n *corev1.Node) error {
+	if n.Spec.Unschedulable {
+		return nil
+	}
+	patch := client.MergeFrom(n.DeepCopy())
+	n.Spec.Unschedulable = true
+	if n.Annotations == nil {
+		n.Annotations = map[string]string{}
+	}
+	n.Annotations[cloud.AnnotationCordoned] = time.Now().UTC().Format(time.RFC3339)
+	if err := d.Client.Patch(ctx, n, patch); err != nil {
+		return fmt.Errorf("cordoning node %s: %w", n.Name, err)
+	}
+	return nil
+}
+
+// uncordon makes the Nodes that the Drainer cordoned schedulable again.
+func (d *Drainer) uncordon(ctx context.Context, nodes []corev1.Node) error {
+	for i := range nodes {
+		n := &nodes[i]
+		if _, ok := n.Annotations[cloud.AnnotationCordoned]; !ok {
+			continue
+		}
+		patch := client.MergeFrom(n.DeepCopy())
+		n.Spec.Unschedulable = false
+		delete(n.Annotations, cloud.AnnotationCordoned)
+		if err := d.Client.Patch(ctx, n, patch); err != nil {
+			return fmt.Errorf("uncordoning node %s: %w", n.Name, err)
+		}
+	}
+	return nil
+}
+
+func (d *Drainer) evict(ctx context.Context, p *corev1.Pod) error {
+	eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Name: p.Name, Namespace: p.Namespace}}
+	err := d.Client.SubResource("eviction").Create(ctx, p, eviction)
+	switch {
+	case err == nil, apierrors.IsNotFound(err):
+		return nil
+	case apierrors.IsTooManyRequests(err):
+		// A PodDisruptionBudget does not allow the eviction yet.
+		log.FromContext(ctx).V(1).Info("Eviction not allowed yet", "podNamespace", p.Namespace, "podName", p.Name, "reason", err.Error())
+		return nil
+	}
+	return fmt.Errorf("evicting pod %s/%s: %w", p.Namespace, p.Name, err)
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_podsToEvict(t *testing.T) {
+	isController := true
+	pod := func(name, node, ownerKind string, phase corev1.PodPhase) corev1.Pod {
+		p := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       corev1.PodSpec{NodeName: node},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+		if ownerKind != "" {
+			p.OwnerReferences = []metav1.OwnerReference{{Kind: ownerKind, Name: "owner", Controller: &isController}}
+		}
+		return p
+	}
+	nodes := []corev1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}}, {ObjectMeta: metav1.ObjectMeta{Name: "node-b"}}}
+	pods := []corev1.Pod{
+		pod("web", "node-a", "ReplicaSet", corev1.PodRunning),
+		pod("bare", "node-b", "", corev1.PodPending),
+		pod("logging", "node-a", "DaemonSet", corev1.PodRunning),
+		pod("static", "node-b", "Node", corev1.PodRunning),
+		pod("finished", "node-a", "Job", corev1.PodSucceeded),
+		pod("elsewhere", "node-c", "ReplicaSet", corev1.PodRunning),
+	}
+
+	var got []string
+	for _, p := range podsToEvict(nodes, pods) {
+		got = append(got, p.Name)
+	}
+	if len(got) != 2 || got[0] != "web" || got[1] != "bare" {
+		t.Fatalf("expected [web bare], got: %v", got)
+	}
+}
+
+func Test_ValidateDrainTimeoutAction(t *testing.T) {
+	for _, a := range []string{DrainTimeoutDelete, DrainTimeoutSkip} {
+		if err := ValidateDrainTimeoutAction(a); err != nil {
+			t.Errorf("%s: unexpected error: %v", a, err)
+		}
+	}
+	if err := ValidateDrainTimeoutAction("force"); err == nil {
+		t.Error("expected an error for an unknown action")
+	}
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ensureFlights collapses concurrent calls to ensure the same node pool into
+// a single provider call, so that the Pods of a slice that are reconciled at
+// the same time do not each call the GKE API to find out that the node pool
+// is already being created.
+type ensureFlights struct {
+	mtx   sync.Mutex
+	calls map[string]*ensureCall
+}
+
+type ensureCall struct {
+	done chan struct{}
+	// dups is the number of callers waiting for the call.
+	dups int
+	op   *cloud.NodePoolOperation
+	err  error
+}
+
+// do calls fn unless a call with the same key is in flight, in which case it
+// waits for that call and returns its result with shared=true.
+func (f *ensureFlights) do(key string, fn func() (*cloud.NodePoolOperation, error)) (op *cloud.NodePoolOperation, err error, shared bool) {
+	f.mtx.Lock()
+	if f.calls == nil {
+		f.calls = map[string]*ensureCall{}
+	}
+	if c, ok := f.calls[key]; ok {
+		c.dups++
+		f.mtx.Unlock()
+		<-c.done
+		return c.op, c.err, true
+	}
+	c := &ensureCall{done: make(chan struct{})}
+	f.calls[key] = c
+	f.mtx.Unlock()
+
+	c.op, c.err = fn()
+
+	f.mtx.Lock()
+	delete(f.calls, key)
+	f.mtx.Unlock()
+	close(c.done)
+	return c.op, c.err, false
+}
+
+// waiting returns the number of callers waiting for the call with the key.
+func (f *ensureFlights) waiting(key string) int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if c, ok := f.calls[key]; ok {
+		return c.dups
+	}
+	return 0
+}
+
+// ensureNodePool ensures the node pool of the Pod, sharing the provider call
+// with concurrent reconciles of Pods for the same node pool. Callers that
+// joined a failed call get ErrDuplicateRequest, the failure is reported on
+// the Pod that made the call. Network errors are retried right away, see
+// RetryPolicy.NetworkRetries.
+func (r *CreationReconciler) ensureNodePool(ctx context.Context, pod *corev1.Pod, nodePoolName string, npReq cloud.NodePoolRequest) (*cloud.NodePoolOperation, error) {
+	ensure := func() (*cloud.NodePoolOperation, error) {
+		nodePoolsCreating.Inc()
+		defer nodePoolsCreating.Dec()
+		start := time.Now()
+		defer func() { nodePoolEnsureDuration.Observe(time.Since(start).Seconds()) }()
+		return r.RetryPolicy.retryNetworkErrors(ctx, func() (*cloud.NodePoolOperation, error) {
+			return tracedProvider(ctx, r.Tracer, r.Provider).EnsureNodePoolForPod(pod, npReq)
+		})
+	}
+	if nodePoolName == "" {
+		return ensure()
+	}
+	op, err, shared := r.flights.do(nodePoolName, ensure)
+	if shared && err != nil {
+		return nil, cloud.ErrDuplicateRequest
+	}
+	return op, err
+}
@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// blockingProvider counts EnsureNodePoolForPod calls, which block until
+// release is closed.
+type blockingProvider struct {
+	cloud.Mock
+	calls   int32
+	release chan struct{}
+	err     error
+}
+
+func (p *blockingProvider) EnsureNodePoolForPod(*corev1.Pod, cloud.NodePoolRequest) (*cloud.NodePoolOperation, error) {
+	atomic.AddInt32(&p.calls, 1)
+	<-p.release
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &cloud.NodePoolOperation{Name: "operation-1"}, nil
+}
+
+func Test_CreationReconciler_ensureNodePool(t *testing.T) {
+	const n = 16
+
+	for _, providerErr := range []error{nil, errors.New("quota exceeded")} {
+		t.Run("error="+errString(providerErr), func(t *testing.T) {
+			provider := &blockingProvider{release: make(chan struct{}), err: providerErr}
+			r := &CreationReconciler{Provider: provider}
+
+			var (
+				wg         sync.WaitGroup
+				mtx        sync.Mutex
+				ops        int
+				duplicates int
+				failures   int
+			)
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					op, err := r.ensureNodePool(context.Background(), &corev1.Pod{}, "np", cloud.NodePoolRequest{NodeCount: n})
+					mtx.Lock()
+					defer mtx.Unlock()
+					switch {
+					case errors.Is(err, cloud.ErrDuplicateRequest):
+						duplicates++
+					case err != nil:
+						failures++
+					case op != nil:
+						ops++
+					}
+				}()
+			}
+
+			// Wait for all but the first caller to join the in-flight call.
+			deadline := time.Now().Add(5 * time.Second)
+			for r.flights.waiting("np") < n-1 {
+				if time.Now().After(deadline) {
+					t.Fatalf("timed out waiting for callers to join, waiting: %v", r.flights.waiting("np"))
+				}
+				time.Sleep(time.Millisecond)
+			}
+			close(provider.release)
+			wg.Wait()
+
+			if exp, got := int32(1), atomic.LoadInt32(&provider.calls); exp != got {
+				t.Fatalf("provider calls: expected: %v, got: %v", exp, got)
+			}
+			if providerErr == nil {
+				if ops != n {
+					t.Fatalf("expected all callers to share the operation, got %v", ops)
+				}
+			} else if failures != 1 || duplicates != n-1 {
+				t.Fatalf("expected 1 failure and %v duplicates, got %v and %v", n-1, failures, duplicates)
+			}
+		})
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return "nil"
+	}
+	return err.Error()
+}
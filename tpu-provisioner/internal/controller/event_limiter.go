@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// DefaultLimitedEventReasons are the event reasons that are emitted on every
+// retry of a failing or waiting Pod.
+var DefaultLimitedEventReasons = []string{
+	EventEnsuringNodePool,
+	EventFailedEnsuringNodePool,
+	EventQuotaExceeded,
+	EventZoneStockout,
+	EventNodePoolLimitReached,
+	EventOperationInProgress,
+	EventCooldownActive,
+	EventProvisioningPaused,
+}
+
+// EventLimiter is an EventRecorder that emits at most one event per object
+// and reason every Window for the limited reasons, and drops the others. The
+// next event that is emitted after a Window has the number of dropped events
+// appended as the suppressed field. client-go only aggregates events with
+// identical messages, while retries of the same failure often differ in
+// details such as operation names.
+type EventLimiter struct {
+	record.EventRecorder
+
+	// Window is how long events of a limited reason are suppressed after one
+	// was emitted for an object.
+	Window time.Duration
+	// Reasons are the limited event reasons, other events are always emitted.
+	Reasons map[string]bool
+
+	mtx sync.Mutex
+	// last tracks the events that were emitted within the Window.
+	last map[limitedEventKey]*limitedEvent
+	now  func() time.Time
+}
+
+type limitedEventKey struct {
+	object, reason string
+}
+
+type limitedEvent struct {
+	emitted    time.Time
+	suppressed int
+}
+
+// LimitEvents returns an EventLimiter for the recorder, or the recorder
+// itself if window is not positive.
+func LimitEvents(recorder record.EventRecorder, window time.Duration, reasons []string) record.EventRecorder {
+	if window <= 0 {
+		return recorder
+	}
+	l := &EventLimiter{EventRecorder: recorder, Window: window, Reasons: map[string]bool{}}
+	for _, r := range reasons {
+		l.Reasons[r] = true
+	}
+	return l
+}
+
+func (l *EventLimiter) Event(object runtime.Object, eventtype, reason, message string) {
+	if msg, ok := l.allow(object, reason, message); ok {
+		l.EventRecorder.Event(object, eventtype, reason, msg)
+	}
+}
+
+func (l *EventLimiter) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	l.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (l *EventLimiter) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	if msg, ok := l.allow(object, reason, fmt.Sprintf(messageFmt, args...)); ok {
+		l.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", msg)
+	}
+}
+
+// allow returns whether the event should be emitted, and its message.
+func (l *EventLimiter) allow(object runtime.Object, reason, message string) (string, bool) {
+	if !l.Reasons[reason] {
+		return message, true
+	}
+	obj, err := meta.Accessor(object)
+	if err != nil {
+		return message, true
+	}
+	key := limitedEventKey{object: obj.GetNamespace() + "/" + obj.GetName() + "/" + string(obj.GetUID()), reason: reason}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	now := time.Now()
+	if l.now != nil {
+		now = l.now()
+	}
+	if l.last == nil {
+		l.last = map[limitedEventKey]*limitedEvent{}
+	}
+	e, ok := l.last[key]
+	if ok && now.Sub(e.emitted) < l.Window {
+		e.suppressed++
+		eventsSuppressed.WithLabelValues(reason).Inc()
+		return "", false
+	}
+	if ok && e.suppressed > 0 {
+		message = eventMessage(message, eventFieldSuppressed, strconv.Itoa(e.suppressed))
+	}
+	l.last[key] = &limitedEvent{emitted: now}
+	l.prune(now)
+	return message, true
+}
+
+// prune forgets the events whose Window ended, so that objects that are gone
+// do not accumulate. Their suppressed counts are lost.
+func (l *EventLimiter) prune(now time.Time) {
+	for k, e := range l.last {
+		if now.Sub(e.emitted) >= 2*l.Window {
+			delete(l.last, k)
+		}
+	}
+}
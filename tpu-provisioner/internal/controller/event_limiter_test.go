@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestEventLimiter(t *testing.T) {
+	rec := record.NewFakeRecorder(10)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := LimitEvents(rec, time.Minute, []string{EventFailedEnsuringNodePool}).(*EventLimiter)
+	l.now = func() time.Time { return now }
+
+	a := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a", UID: "a"}}
+	b := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "b", UID: "b"}}
+	expect := func(events ...string) {
+		t.Helper()
+		for _, exp := range events {
+			select {
+			case got := <-rec.Events:
+				if got != exp {
+					t.Fatalf("expected event %q, got: %q", exp, got)
+				}
+			default:
+				t.Fatalf("expected event %q, got none", exp)
+			}
+		}
+		select {
+		case got := <-rec.Events:
+			t.Fatalf("unexpected event: %q", got)
+		default:
+		}
+	}
+
+	l.Event(a, corev1.EventTypeWarning, EventFailedEnsuringNodePool, "Failed.")
+	l.Event(a, corev1.EventTypeWarning, EventFailedEnsuringNodePool, "Failed again.")
+	l.Eventf(a, corev1.EventTypeWarning, EventFailedEnsuringNodePool, "Failed %s.", "once more")
+	l.Event(b, corev1.EventTypeWarning, EventFailedEnsuringNodePool, "Failed.")
+	l.Event(a, corev1.EventTypeNormal, EventNodePoolEnsured, "Ensured.")
+	expect(
+		"Warning FailedEnsuringNodePool Failed.",
+		"Warning FailedEnsuringNodePool Failed.",
+		"Normal NodePoolEnsured Ensured.",
+	)
+
+	now = now.Add(time.Minute)
+	l.Event(a, corev1.EventTypeWarning, EventFailedEnsuringNodePool, "Failed.")
+	expect("Warning FailedEnsuringNodePool Failed. suppressed=2")
+
+	now = now.Add(time.Hour)
+	l.Event(a, corev1.EventTypeWarning, EventFailedEnsuringNodePool, "Failed.")
+	expect("Warning FailedEnsuringNodePool Failed.")
+	if _, ok := l.last[limitedEventKey{object: "default/b/b", reason: EventFailedEnsuringNodePool}]; ok {
+		t.Fatal("expected expired events to be pruned")
+	}
+}
+
+func TestLimitEvents_disabled(t *testing.T) {
+	rec := record.NewFakeRecorder(1)
+	if LimitEvents(rec, 0, DefaultLimitedEventReasons) != record.EventRecorder(rec) {
+		t.Fatal("expected the recorder to be returned without a window")
+	}
+}
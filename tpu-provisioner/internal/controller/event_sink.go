@@ -0,0 +1,250 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Defaults of the EventSink delivery settings.
+const (
+	defaultEventSinkQueueSize     = 1000
+	defaultEventSinkMaxAttempts   = 3
+	defaultEventSinkRetryInterval = time.Second
+	defaultEventSinkTimeout       = 10 * time.Second
+)
+
+// SinkEvent is the JSON payload that the EventSink posts for a node pool
+// lifecycle event. Fields without a known value are omitted.
+type SinkEvent struct {
+	Time time.Time `json:"time"`
+	// Type is the type of the Kubernetes event, Normal or Warning.
+	Type string `json:"type"`
+	// Reason is the reason of the Kubernetes event, for example
+	// NodePoolEnsured or QuotaExceeded.
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+
+	NodePool    string `json:"nodePool,omitempty"`
+	Accelerator string `json:"accelerator,omitempty"`
+	Topology    string `json:"topology,omitempty"`
+	NodeCount   int    `json:"nodeCount,omitempty"`
+	Operation   string `json:"operation,omitempty"`
+
+	// PodNamespace and PodName identify the Pod that the node pool was
+	// ensured for, NodeName the Node of a deleted node pool.
+	PodNamespace string `json:"podNamespace,omitempty"`
+	PodName      string `json:"podName,omitempty"`
+	NodeName     string `json:"nodeName,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// EventSink posts node pool lifecycle events to an external HTTP webhook, in
+// addition to the Kubernetes events. Delivery is best-effort: events are
+// queued without blocking the caller and dropped if the queue is full, and
+// each delivery is attempted up to MaxAttempts times.
+//
+// It implements manager.Runnable. A nil *EventSink discards events.
+type EventSink struct {
+	// URL is the http or https URL that events are posted to.
+	URL string
+	// AuthHeader, if set, is sent as the Authorization header. It is never
+	// logged.
+	AuthHeader string
+
+	// Client is used to post events, it defaults to a client with a 10s
+	// timeout.
+	Client *http.Client
+	// QueueSize is the number of events that can wait for delivery.
+	QueueSize int
+	// MaxAttempts is the number of delivery attempts of each event, and
+	// RetryInterval the delay after the first failed attempt, doubled after
+	// each further one.
+	MaxAttempts   int
+	RetryInterval time.Duration
+
+	once  sync.Once
+	queue chan SinkEvent
+}
+
+// ValidateEventSinkURL returns an error unless u is an absolute http or https
+// URL. The error does not contain the URL, which may contain credentials.
+func ValidateEventSinkURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("invalid event sink URL")
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("event sink URL must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// redactURL returns the URL without the user info and the query, which may
+// contain credentials, for logging.
+func redactURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "<invalid URL>"
+	}
+	parsed.User = nil
+	if parsed.RawQuery != "" {
+		parsed.RawQuery = "REDACTED"
+	}
+	parsed.Fragment = ""
+	return parsed.String()
+}
+
+func (s *EventSink) init() {
+	s.once.Do(func() {
+		size := s.QueueSize
+		if size <= 0 {
+			size = defaultEventSinkQueueSize
+		}
+		s.queue = make(chan SinkEvent, size)
+		if s.Client == nil {
+			s.Client = &http.Client{Timeout: defaultEventSinkTimeout}
+		}
+		if s.MaxAttempts <= 0 {
+			s.MaxAttempts = defaultEventSinkMaxAttempts
+		}
+		if s.RetryInterval <= 0 {
+			s.RetryInterval = defaultEventSinkRetryInterval
+		}
+	})
+}
+
+// Start delivers queued events until the context is cancelled. Events still
+// queued when it returns are dropped.
+func (s *EventSink) Start(ctx context.Context) error {
+	s.init()
+	lg := log.FromContext(ctx).WithName("event-sink")
+	lg.Info("Posting node pool events to event sink", "url", redactURL(s.URL))
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev := <-s.queue:
+			if err := s.deliver(ctx, ev); err != nil {
+				eventSinkDeliveries.WithLabelValues("failed").Inc()
+				lg.Error(err, "Failed to post event to event sink", "reason", ev.Reason, "nodePool", ev.NodePool, "url", redactURL(s.URL))
+				continue
+			}
+			eventSinkDeliveries.WithLabelValues("delivered").Inc()
+		}
+	}
+}
+
+// send queues the event for delivery, or drops it if the queue is full.
+func (s *EventSink) send(ev SinkEvent) {
+	if s == nil {
+		return
+	}
+	s.init()
+	select {
+	case s.queue <- ev:
+	default:
+		eventSinkDeliveries.WithLabelValues("dropped").Inc()
+		log.Log.WithName("event-sink").Info("Dropping event, event sink queue is full", "reason", ev.Reason, "nodePool", ev.NodePool)
+	}
+}
+
+// record queues an event about the Pod or Node, with the fields of the
+// corresponding Kubernetes event (see podEventFields and nodeEventFields). err
+// is the error of a failure event, if any.
+func (s *EventSink) record(obj client.Object, eventType, reason, message string, err error, fields ...string) {
+	if s == nil {
+		return
+	}
+	ev := SinkEvent{Time: time.Now().UTC(), Type: eventType, Reason: reason, Message: message}
+	switch obj.(type) {
+	case *corev1.Pod:
+		ev.PodNamespace, ev.PodName = obj.GetNamespace(), obj.GetName()
+	case *corev1.Node:
+		ev.NodeName = obj.GetName()
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		v := fields[i+1]
+		switch fields[i] {
+		case eventFieldNodePool:
+			ev.NodePool = v
+		case eventFieldAccelerator:
+			ev.Accelerator = v
+		case eventFieldTopology:
+			ev.Topology = v
+		case eventFieldNodeCount:
+			ev.NodeCount, _ = strconv.Atoi(v)
+		case eventFieldOperation:
+			ev.Operation = v
+		}
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	s.send(ev)
+}
+
+// deliver posts the event, retrying network errors, 429 and 5xx responses
+// with exponential backoff.
+func (s *EventSink) deliver(ctx context.Context, ev SinkEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+	wait := s.RetryInterval
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= s.MaxAttempts {
+			return fmt.Errorf("attempt %d: %w", attempt, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// post makes a single delivery attempt and returns whether a failure may be
+// retried. Errors never contain the URL or the auth header.
+func (s *EventSink) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("creating request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.AuthHeader != "" {
+		req.Header.Set("Authorization", s.AuthHeader)
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		// The *url.Error of the client contains the URL.
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return true, fmt.Errorf("posting event: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("event sink responded with status %d", resp.StatusCode)
+}
@@ -1,5 +1,13 @@
 package controller
 
+import (
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+	corev1 "k8s.io/api/core/v1"
+)
+
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 const (
@@ -9,6 +17,156 @@ const (
 	EventNodePoolEnsured         = "NodePoolEnsured"
 	EventDeletingNodePool        = "DeletingNodePool"
 	EventNodePoolDeleted         = "NodePoolDeleted"
-	DeletingNodePoolEventMessage = "Deleted Node Pool."
-	DeletedNodePoolEventMessage  = "Deleted Node Pool."
+	EventMissingToleration       = "MissingToleration"
+	EventInvalidNodePoolTaints   = "InvalidNodePoolTaints"
+	EventReservationUnavailable  = "ReservationUnavailable"
+	EventQuotaExceeded           = "QuotaExceeded"
+	EventNodePoolLimitReached    = "NodePoolLimitReached"
+	EventInvalidTPUConfig        = "InvalidTPUConfig"
+	EventInvalidNodePoolConfig   = "InvalidNodePoolConfig"
+	EventNodePoolReady           = "NodePoolReady"
+	EventPlacementPolicyNotFound = "PlacementPolicyNotFound"
+	EventUnknownNodePoolClass    = "UnknownNodePoolClass"
+	EventInvalidDiskConfig       = "InvalidDiskConfig"
+	EventInvalidNetworkConfig    = "InvalidNetworkConfig"
+	EventProvisioningAbandoned   = "ProvisioningAbandoned"
+	EventIncompatibleNodeVersion = "IncompatibleNodeVersion"
+	EventCooldownActive          = "CooldownActive"
+	EventZoneStockout            = "ZoneStockout"
+	EventNodeManagementConflict  = "NodeManagementConflict"
+	EventIncompatibleLocality    = "IncompatibleLocality"
+	EventOperationInProgress     = "OperationInProgress"
+	EventInvalidImageType        = "InvalidImageType"
+	EventInvalidHostVMConfig     = "InvalidHostVMConfig"
+	EventMisconfigured           = "Misconfigured"
+	EventProvisioningPaused      = "ProvisioningPaused"
+	EventProvisioningTimeout     = "ProvisioningTimeout"
+	EventTemplateNotFound        = "TemplateNotFound"
+	EventInvalidSandboxConfig    = "InvalidSandboxConfig"
+	EventInvalidKubeletConfig    = "InvalidKubeletConfig"
+	EventInvalidMaxPodsPerNode   = "InvalidMaxPodsPerNode"
+	EventPartialSlice            = "PartialSlice"
+	EventDrainingNodePool        = "DrainingNodePool"
+	EventDrainTimeout            = "DrainTimeout"
+	EventForceRecreate           = "ForceRecreate"
+
+	EventInvalidResourceManagerTags      = "InvalidResourceManagerTags"
+	EventResourceManagerTagBindingFailed = "ResourceManagerTagBindingFailed"
+
+	EventInvalidNetworkInterfaceConfig = "InvalidNetworkInterfaceConfig"
+
+	EventCreateHookRejected = "NodePoolRejectedByHook"
+	EventCreateHookFailed   = "CreateHookFailed"
+
+	EventManualDeletion = "ManualDeletion"
+
+	EventIncompleteSelector = "IncompleteSelector"
+
+	EventUnsatisfiableTopology = "UnsatisfiableTopology"
+
+	EventAcceleratorTypeNotAllowed = "AcceleratorTypeNotAllowed"
+
+	EventNodePoolNotReady = "NodePoolNotReady"
+
+	EventInvalidServiceAccount          = "InvalidServiceAccount"
+	EventServiceAccountPermissionDenied = "ServiceAccountPermissionDenied"
+	EventProjectPermissionDenied        = "ProjectPermissionDenied"
+	DeletingNodePoolEventMessage        = "Deleting Node Pool."
+	DeletedNodePoolEventMessage         = "Deleted Node Pool."
+)
+
+// Event field keys appended to node pool event messages. Tooling that scrapes
+// events can rely on these keys, new keys are only ever appended.
+const (
+	eventFieldNodePool    = "nodePool"
+	eventFieldAccelerator = "accelerator"
+	eventFieldTopology    = "topology"
+	eventFieldNodeCount   = "nodeCount"
+	eventFieldOperation   = "operation"
+	// eventFieldConflictingOperation is the cluster operation that GKE
+	// reported as conflicting with the node pool creation.
+	eventFieldConflictingOperation = "conflictingOperation"
+	// eventFieldSuppressed is the number of events of the same reason for
+	// the same object that an EventLimiter dropped before this one.
+	eventFieldSuppressed = "suppressed"
+	// eventFieldRequestID is the ID of the force recreate request, see
+	// cloud.AnnotationForceRecreate.
+	eventFieldRequestID = "requestID"
+	// eventFieldProjectRole and eventFieldProject are the role (network or
+	// reservation) and project of a resource that the node pool may not
+	// use, see cloud.ProjectPermissionError.
+	eventFieldProjectRole = "projectRole"
+	eventFieldProject     = "project"
+	// eventFieldSlice is the slice key of the Pods of a JobSet event, see
+	// JobSetEvents.
+	eventFieldSlice = "slice"
+	// eventFieldSlicePods is the number of Pods of the slice seen when a
+	// SliceAggregator recorded the event.
+	eventFieldSlicePods = "slicePods"
 )
+
+// eventMessage appends the key=value pairs in kvs to the human-readable
+// message. Pairs with an empty value are omitted and values that contain
+// whitespace or quotes are quoted.
+func eventMessage(msg string, kvs ...string) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i+1 < len(kvs); i += 2 {
+		k, v := kvs[i], kvs[i+1]
+		if v == "" {
+			continue
+		}
+		if strings.ContainsAny(v, " \t\n\"=") {
+			v = strconv.Quote(v)
+		}
+		b.WriteString(" " + k + "=" + v)
+	}
+	return b.String()
+}
+
+// podEventFields returns the event fields describing the node pool requested
+// by the Pod.
+func podEventFields(p *corev1.Pod, nodePoolName string, npReq cloud.NodePoolRequest) []string {
+	nodeSelector := cloud.NodeSelectorForPod(p)
+	accel := podAccelerator(p)
+	topo := npReq.Topology
+	if topo == "" {
+		topo = nodeSelector[cloud.GKETPUNodeSelector]
+	}
+	return []string{
+		eventFieldNodePool, nodePoolName,
+		eventFieldAccelerator, accel,
+		eventFieldTopology, topo,
+		eventFieldNodeCount, strconv.Itoa(expectedNodeCount(p, npReq)),
+	}
+}
+
+// eventField returns the value of the event field with the key, or "".
+func eventField(fields []string, key string) string {
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i] == key {
+			return fields[i+1]
+		}
+	}
+	return ""
+}
+
+// nodeEventFields returns the event fields describing the node pool of the
+// Node, nodeCount is omitted if 0.
+func nodeEventFields(node *corev1.Node, nodePoolName string, nodeCount int) []string {
+	labels := node.GetLabels()
+	accel := labels[cloud.GKEAcceleratorNodeSelector]
+	if accel == "" {
+		accel = labels[cloud.GKEGPUNodeSelector]
+	}
+	var count string
+	if nodeCount > 0 {
+		count = strconv.Itoa(nodeCount)
+	}
+	return []string{
+		eventFieldNodePool, nodePoolName,
+		eventFieldAccelerator, accel,
+		eventFieldTopology, labels[cloud.GKETPUNodeSelector],
+		eventFieldNodeCount, count,
+	}
+}
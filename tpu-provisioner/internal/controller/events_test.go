@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func Test_eventMessage(t *testing.T) {
+	cases := []struct {
+		name string
+		msg  string
+		kvs  []string
+		exp  string
+	}{
+		{name: "no fields", msg: "Node Pool Ensured.", exp: "Node Pool Ensured."},
+		{
+			name: "fields",
+			msg:  "Node Pool Ensured.",
+			kvs:  []string{"nodePool", "tpu-provisioner-abc", "nodeCount", "2"},
+			exp:  "Node Pool Ensured. nodePool=tpu-provisioner-abc nodeCount=2",
+		},
+		{
+			name: "empty value omitted",
+			msg:  "Deleting Node Pool.",
+			kvs:  []string{"nodePool", "np", "topology", ""},
+			exp:  "Deleting Node Pool. nodePool=np",
+		},
+		{
+			name: "quoted value",
+			msg:  "Failed.",
+			kvs:  []string{"reason", `over "quota"`},
+			exp:  `Failed. reason="over \"quota\""`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := eventMessage(c.msg, c.kvs...); got != c.exp {
+				t.Fatalf("expected: %q, got: %q", c.exp, got)
+			}
+		})
+	}
+}
+
+func Test_podEventFields(t *testing.T) {
+	p := &corev1.Pod{Spec: corev1.PodSpec{NodeSelector: map[string]string{
+		cloud.GKEAcceleratorNodeSelector: cloud.V4PodSliceAccelerator,
+		cloud.GKETPUNodeSelector:         "2x2x4",
+	}}}
+
+	got := eventMessage("Ensuring Node Pool.", podEventFields(p, "tpu-provisioner-abc", cloud.NodePoolRequest{})...)
+	exp := "Ensuring Node Pool. nodePool=tpu-provisioner-abc accelerator=tpu-v4-podslice topology=2x2x4 nodeCount=4"
+	if got != exp {
+		t.Fatalf("expected: %q, got: %q", exp, got)
+	}
+}
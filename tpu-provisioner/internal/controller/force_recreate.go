@@ -0,0 +1,305 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// forceRecreateRetryInterval is how often a node pool that is being drained
+// or deleted for a force recreate request is checked again.
+const forceRecreateRetryInterval = 15 * time.Second
+
+// ForceRecreateReconciler deletes the node pool of a Pod that has the
+// cloud.AnnotationForceRecreate annotation, so that the creation controller
+// creates it again for the Pods that are left Unschedulable, with the current
+// configuration. The node pool is the one that the Pod runs on, or the one
+// that would be created for it if it is not scheduled.
+//
+// The request is handed over to the node pool's Nodes: they are annotated
+// with cloud.AnnotationRecreating and the Pod's annotation is replaced by
+// cloud.AnnotationForceRecreateDone with the same request ID, so that a
+// request is only handled once even if the Pod is evicted or the annotation
+// is set again. The Nodes are then drained with the Drainer, if set, and the
+// node pool deleted. The NodePoolGarbageCollector leaves node pools with
+// annotated Nodes alone.
+type ForceRecreateReconciler struct {
+	client.Client
+	Recorder  record.EventRecorder
+	Provider  cloud.Provider
+	EventSink *EventSink
+	// Drainer, if set, drains the Nodes before the node pool is deleted.
+	Drainer *Drainer
+	// Tracer, if set, traces the provider calls that delete node pools.
+	Tracer Tracer
+
+	// deleter drains and deletes the node pools, see nodePoolDeleter.
+	deleter     *nodePoolDeleter
+	deleterOnce sync.Once
+}
+
+// nodePoolDeleter returns the deleter of the reconciler.
+func (r *ForceRecreateReconciler) nodePoolDeleter() *nodePoolDeleter {
+	r.deleterOnce.Do(func() {
+		r.deleter = &nodePoolDeleter{Recorder: r.Recorder, Provider: r.Provider, EventSink: r.EventSink, Drainer: r.Drainer, Tracer: r.Tracer}
+	})
+	return r.deleter
+}
+
+// Reconcile hands the force recreate request of a Pod over to the Nodes of its
+// node pool.
+func (r *ForceRecreateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+
+	var pod corev1.Pod
+	if err := r.Get(ctx, req.NamespacedName, &pod); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, fmt.Errorf("getting pod: %w", err)
+	}
+	id := pod.Annotations[cloud.AnnotationForceRecreate]
+	if id == "" {
+		return ctrl.Result{}, nil
+	}
+	if id == pod.Annotations[cloud.AnnotationForceRecreateDone] {
+		lg.V(1).Info("Force recreate request was already handled", "requestID", id)
+		return ctrl.Result{}, r.finishRequest(ctx, &pod, id)
+	}
+
+	name, err := r.nodePoolForPod(ctx, &pod)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	fields := []string{eventFieldNodePool, name, eventFieldRequestID, id}
+	if name == "" {
+		r.Recorder.Event(&pod, corev1.EventTypeWarning, EventForceRecreate, eventMessage("No provisioner-managed Node Pool to recreate.", fields...))
+		return ctrl.Result{}, r.finishRequest(ctx, &pod, id)
+	}
+
+	nodes, err := r.nodePoolNodes(ctx, name)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if len(nodes) == 0 {
+		// Nothing to drain, for example a node pool whose Nodes never
+		// registered.
+		if known, err := r.managedNodePool(name); err != nil || !known {
+			if err == nil {
+				r.Recorder.Event(&pod, corev1.EventTypeWarning, EventForceRecreate, eventMessage("No provisioner-managed Node Pool to recreate.", fields...))
+				err = r.finishRequest(ctx, &pod, id)
+			}
+			return ctrl.Result{}, err
+		}
+		lg.Info("Force recreating node pool without Nodes", "nodePool", name, "requestID", id)
+		r.Recorder.Event(&pod, corev1.EventTypeNormal, EventForceRecreate, eventMessage("Recreating Node Pool.", fields...))
+		if retry, err := r.nodePoolDeleter().deleteNodePool(ctx, &pod, name, fields); err != nil || retry {
+			return ctrl.Result{RequeueAfter: forceRecreateRetryInterval}, err
+		}
+		return ctrl.Result{}, r.finishRequest(ctx, &pod, id)
+	}
+
+	lg.Info("Force recreating node pool", "nodePool", name, "requestID", id)
+	for i := range nodes {
+		n := &nodes[i]
+		if n.Annotations[cloud.AnnotationRecreating] == id {
+			continue
+		}
+		patch := client.MergeFrom(n.DeepCopy())
+		if n.Annotations == nil {
+			n.Annotations = map[string]string{}
+		}
+		n.Annotations[cloud.AnnotationRecreating] = id
+		if err := r.Patch(ctx, n, patch); err != nil {
+			return ctrl.Result{}, fmt.Errorf("annotating node %s: %w", n.Name, err)
+		}
+	}
+	r.Recorder.Event(&pod, corev1.EventTypeNormal, EventForceRecreate, eventMessage("Recreating Node Pool.", fields...))
+	return ctrl.Result{}, r.finishRequest(ctx, &pod, id)
+}
+
+// finishRequest records the request ID as handled on the Pod and removes the
+// request annotation.
+func (r *ForceRecreateReconciler) finishRequest(ctx context.Context, pod *corev1.Pod, id string) error {
+	patch := client.MergeFrom(pod.DeepCopy())
+	delete(pod.Annotations, cloud.AnnotationForceRecreate)
+	pod.Annotations[cloud.AnnotationForceRecreateDone] = id
+	if err := r.Patch(ctx, pod, patch); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	return nil
+}
+
+// nodePoolForPod returns the name of the provisioner-managed node pool of the
+// Pod, or "" if it runs on a node pool that the provisioner does not manage.
+func (r *ForceRecreateReconciler) nodePoolForPod(ctx context.Context, pod *corev1.Pod) (string, error) {
+	if pod.Spec.NodeName == "" {
+		name, err := nodePoolNameForPod(r.Provider, pod)
+		if err != nil {
+			return "", fmt.Errorf("determining node pool name: %w", err)
+		}
+		return name, nil
+	}
+	var node corev1.Node
+	if err := r.Get(ctx, client.ObjectKey{Name: pod.Spec.NodeName}, &node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("getting node: %w", err)
+	}
+	if !r.Provider.NodePoolOwner().Owns(node.Labels) {
+		return "", nil
+	}
+	return node.Labels[r.Provider.NodePoolLabelKey()], nil
+}
+
+// managedNodePool returns true if the provider lists the node pool as managed
+// by this provisioner.
+func (r *ForceRecreateReconciler) managedNodePool(name string) (bool, error) {
+	nps, err := r.Provider.ListNodePools()
+	if err != nil {
+		return false, fmt.Errorf("listing node pools: %w", err)
+	}
+	for _, np := range nps {
+		if np.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// nodePoolNodes returns the Nodes of the provisioner-managed node pool.
+func (r *ForceRecreateReconciler) nodePoolNodes(ctx context.Context, name string) ([]corev1.Node, error) {
+	owner := r.Provider.NodePoolOwner()
+	var nodes corev1.NodeList
+	if err := r.List(ctx, &nodes, client.MatchingLabels{
+		owner.NodeLabelKey():          owner.Value,
+		r.Provider.NodePoolLabelKey(): name,
+	}); err != nil {
+		return nil, fmt.Errorf("listing nodes: %w", err)
+	}
+	return nodes.Items, nil
+}
+
+// reconcileNode drains and deletes the node pool of a Node that has the
+// cloud.AnnotationRecreating annotation.
+func (r *ForceRecreateReconciler) reconcileNode(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+
+	var node corev1.Node
+	if err := r.Get(ctx, req.NamespacedName, &node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, fmt.Errorf("getting node: %w", err)
+	}
+	id, ok := node.Annotations[cloud.AnnotationRecreating]
+	if !ok || !r.Provider.NodePoolOwner().Owns(node.Labels) {
+		return ctrl.Result{}, nil
+	}
+	name, ok := node.Labels[r.Provider.NodePoolLabelKey()]
+	if !ok {
+		return ctrl.Result{}, nil
+	}
+
+	nodes, err := r.nodePoolNodes(ctx, name)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if len(nodes) == 0 {
+		return ctrl.Result{}, nil
+	}
+	fields := append(nodeEventFields(&node, name, len(nodes)), eventFieldRequestID, id)
+	deleter := r.nodePoolDeleter()
+
+	if r.Drainer != nil {
+		var pods corev1.PodList
+		if err := r.List(ctx, &pods); err != nil {
+			return ctrl.Result{}, fmt.Errorf("listing pods: %w", err)
+		}
+		drained, skipped, err := deleter.drained(ctx, name, nodes, pods.Items, fields)
+		if err != nil {
+			return ctrl.Result{RequeueAfter: forceRecreateRetryInterval}, err
+		}
+		if skipped {
+			// The request is dropped.
+			return ctrl.Result{}, r.removeRecreating(ctx, nodes)
+		}
+		if !drained {
+			return ctrl.Result{RequeueAfter: forceRecreateRetryInterval}, nil
+		}
+	}
+
+	lg.Info("Deleting node pool to recreate it", "nodePool", name, "requestID", id)
+	if retry, err := deleter.deleteNodePool(ctx, &node, name, fields); err != nil || retry {
+		return ctrl.Result{RequeueAfter: forceRecreateRetryInterval}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// removeRecreating removes the cloud.AnnotationRecreating annotation from the
+// Nodes.
+func (r *ForceRecreateReconciler) removeRecreating(ctx context.Context, nodes []corev1.Node) error {
+	for i := range nodes {
+		n := &nodes[i]
+		patch := client.MergeFrom(n.DeepCopy())
+		delete(n.Annotations, cloud.AnnotationRecreating)
+		if err := r.Patch(ctx, n, patch); err != nil {
+			return fmt.Errorf("removing recreate annotation from node %s: %w", n.Name, err)
+		}
+	}
+	return nil
+}
+
+// SetupWithManager sets up the controllers for the Pod requests and the
+// annotated Nodes with the Manager.
+func (r *ForceRecreateReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Drainer != nil {
+		if r.Drainer.Timeout <= 0 {
+			return fmt.Errorf("Drainer.Timeout must be set")
+		}
+		if err := ValidateDrainTimeoutAction(r.Drainer.TimeoutAction); err != nil {
+			return err
+		}
+	}
+	hasAnnotation := func(key string) predicate.Predicate {
+		return predicate.NewPredicateFuncs(func(o client.Object) bool {
+			_, ok := o.GetAnnotations()[key]
+			return ok
+		})
+	}
+	if err := ctrl.NewControllerManagedBy(mgr).
+		Named("force-recreate").
+		For(&corev1.Pod{}, builder.WithPredicates(hasAnnotation(cloud.AnnotationForceRecreate))).
+		Complete(r); err != nil {
+		return err
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("force-recreate-node-pool").
+		For(&corev1.Node{}, builder.WithPredicates(hasAnnotation(cloud.AnnotationRecreating))).
+		Complete(reconcile.Func(r.reconcileNode))
+}
+
+// forceRecreating returns true if the Nodes are being drained or deleted for
+// a force recreate request.
+func forceRecreating(nodes []corev1.Node) bool {
+	for i := range nodes {
+		if _, ok := nodes[i].Annotations[cloud.AnnotationRecreating]; ok {
+			return true
+		}
+	}
+	return false
+}
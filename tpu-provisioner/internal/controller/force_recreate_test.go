@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func Test_forceRecreating(t *testing.T) {
+	nodes := []corev1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}}, {ObjectMeta: metav1.ObjectMeta{Name: "node-b"}}}
+	if forceRecreating(nodes) {
+		t.Fatal("expected Nodes without the annotation to not be recreated")
+	}
+	nodes[1].Annotations = map[string]string{cloud.AnnotationRecreating: "2024-01-01"}
+	if !forceRecreating(nodes) {
+		t.Fatal("expected a Node with the annotation to mark its node pool as recreated")
+	}
+}
+
+// forceRecreateFixture returns a store with the two Nodes of node pool np and
+// a TPU Pod running on the first one, with the force recreate annotations.
+func forceRecreateFixture(annotations map[string]string) *podStore {
+	node := func(name string) corev1.Node {
+		lbls := cloud.DefaultOwner.NodeLabels()
+		lbls["cloud.test.com/test-nodepool"] = "np"
+		return corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: lbls}}
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "w-0", Annotations: annotations}}
+	pod.Spec.NodeName = "node-a"
+	pod.Spec.NodeSelector = map[string]string{
+		cloud.GKEAcceleratorNodeSelector: "tpu-v5-lite-podslice",
+		cloud.GKETPUNodeSelector:         "2x4",
+	}
+	pod.Status.Phase = corev1.PodRunning
+	store := newPodStore(pod)
+	store.nodes = []corev1.Node{node("node-a"), node("node-b")}
+	return store
+}
+
+func Test_ForceRecreateReconciler_Reconcile(t *testing.T) {
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: client.ObjectKey{Namespace: "default", Name: "w-0"}}
+
+	t.Run("request handed over to the Nodes", func(t *testing.T) {
+		store := forceRecreateFixture(map[string]string{cloud.AnnotationForceRecreate: "r1"})
+		provider := &testProvider{deletedPools: map[string]time.Time{}}
+		r := &ForceRecreateReconciler{Client: store, Recorder: record.NewFakeRecorder(10), Provider: provider}
+
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		pod := store.pods["w-0"]
+		if _, ok := pod.Annotations[cloud.AnnotationForceRecreate]; ok || pod.Annotations[cloud.AnnotationForceRecreateDone] != "r1" {
+			t.Fatalf("expected the request to be recorded as done on the Pod, got: %v", pod.Annotations)
+		}
+		for _, n := range store.nodes {
+			if n.Annotations[cloud.AnnotationRecreating] != "r1" {
+				t.Fatalf("expected Node %s to carry the request, got: %v", n.Name, n.Annotations)
+			}
+		}
+		if provider.getDeletedPool("np") {
+			t.Fatal("expected the node pool to be deleted by the Node reconciler, not the Pod reconciler")
+		}
+
+		// The garbage collector leaves the node pool to the
+		// ForceRecreateReconciler even when it is idle.
+		store.pods["w-0"].Status.Phase = corev1.PodSucceeded
+		gc := &NodePoolGarbageCollector{Client: store, Recorder: record.NewFakeRecorder(10), Provider: provider, IdleDuration: time.Nanosecond}
+		for i := 0; i < 2; i++ {
+			if err := gc.collect(ctx); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if provider.getDeletedPool("np") {
+			t.Fatal("expected the garbage collector to leave the node pool alone")
+		}
+
+		if _, err := r.reconcileNode(ctx, ctrl.Request{NamespacedName: client.ObjectKey{Name: "node-a"}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !provider.getDeletedPool("np") {
+			t.Fatal("expected the node pool to be deleted")
+		}
+	})
+
+	t.Run("request seen again", func(t *testing.T) {
+		// The request annotation is set again, for example by a
+		// controller that restores the Pod's annotations.
+		store := forceRecreateFixture(map[string]string{cloud.AnnotationForceRecreate: "r1", cloud.AnnotationForceRecreateDone: "r1"})
+		provider := &testProvider{deletedPools: map[string]time.Time{}}
+		r := &ForceRecreateReconciler{Client: store, Recorder: record.NewFakeRecorder(10), Provider: provider}
+
+		result, err := r.Reconcile(ctx, req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsZero() {
+			t.Fatalf("expected no requeue, got: %+v", result)
+		}
+		if _, ok := store.pods["w-0"].Annotations[cloud.AnnotationForceRecreate]; ok {
+			t.Fatal("expected the request annotation to be removed")
+		}
+		for _, n := range store.nodes {
+			if _, ok := n.Annotations[cloud.AnnotationRecreating]; ok {
+				t.Fatalf("expected Node %s to not be annotated again", n.Name)
+			}
+		}
+		if provider.getDeletedPool("np") {
+			t.Fatal("expected the node pool to not be deleted again")
+		}
+	})
+
+	t.Run("drain timeout with skip", func(t *testing.T) {
+		store := forceRecreateFixture(map[string]string{cloud.AnnotationForceRecreateDone: "r1"})
+		for i := range store.nodes {
+			store.nodes[i].Annotations = map[string]string{cloud.AnnotationRecreating: "r1"}
+		}
+		provider := &testProvider{deletedPools: map[string]time.Time{}}
+		r := &ForceRecreateReconciler{
+			Client:   store,
+			Recorder: record.NewFakeRecorder(10),
+			Provider: provider,
+			// The Pod is never evicted by the store, the drain times
+			// out on the first attempt.
+			Drainer: &Drainer{Client: store, Timeout: time.Nanosecond, TimeoutAction: DrainTimeoutSkip},
+		}
+
+		result, err := r.reconcileNode(ctx, ctrl.Request{NamespacedName: client.ObjectKey{Name: "node-a"}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsZero() {
+			t.Fatalf("expected the request to be dropped without a requeue, got: %+v", result)
+		}
+		if len(store.evictions) != 1 || store.evictions[0] != "w-0" {
+			t.Fatalf("expected the Pod to be evicted, got: %v", store.evictions)
+		}
+		if provider.getDeletedPool("np") {
+			t.Fatal("expected the node pool to be kept")
+		}
+		for _, n := range store.nodes {
+			if _, ok := n.Annotations[cloud.AnnotationRecreating]; ok || n.Spec.Unschedulable {
+				t.Fatalf("expected Node %s to be uncordoned and its request removed, got: %+v", n.Name, n)
+			}
+		}
+		if r.nodePoolDeleter().draining("np") {
+			t.Fatal("expected the drain to be forgotten")
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get
+//+kubebuilder:rbac:groups=jobset.x-k8s.io,resources=jobsets,verbs=get
+
+// jobSetSliceSize returns the slice key and node count of the multi-host TPU
+// slice of the Pod as declared by its JobSet, see jobSetParallelism. It
+// returns false if JobSet slice sizing is disabled, the Pod does not belong
+// to a JobSet or the JobSet cannot be read, in which case the Pods of the
+// slice are counted instead.
+func (r *CreationReconciler) jobSetSliceSize(ctx context.Context, pod *corev1.Pod) (string, int, bool) {
+	if r.JobSetReader == nil || !hasNodeSelectors(pod, cloud.GKETPUNodeSelector) {
+		return "", 0, false
+	}
+	key, ok := sliceKey(pod)
+	if !ok {
+		return "", 0, false
+	}
+	n, err := jobSetParallelism(ctx, r.JobSetReader, pod)
+	if err != nil {
+		log.FromContext(ctx).V(1).Info("Unable to determine slice size from JobSet, counting pods instead", "slice", key, "error", err.Error())
+		return "", 0, false
+	}
+	return key, n, true
+}
+
+// jobSetParallelism follows the owner references of the Pod up to its
+// JobSet (Pod -> Job -> JobSet) and returns the parallelism of the Pod's
+// replicated Job, which is the number of Pods (and Nodes) of each slice.
+func jobSetParallelism(ctx context.Context, c client.Reader, pod *corev1.Pod) (int, error) {
+	jobSetRef, err := jobSetRefOf(ctx, c, pod)
+	if err != nil {
+		return 0, err
+	}
+	jobSet := &unstructured.Unstructured{}
+	jobSet.SetGroupVersionKind(schema.FromAPIVersionAndKind(jobSetRef.APIVersion, jobSetRef.Kind))
+	if err := c.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: jobSetRef.Name}, jobSet); err != nil {
+		return 0, fmt.Errorf("getting jobset: %w", err)
+	}
+
+	return replicatedJobParallelism(jobSet, pod.Labels[cloud.JobSetReplicatedJobLabel])
+}
+
+// jobSetRefOf returns the reference to the JobSet that owns the Job of the
+// Pod.
+func jobSetRefOf(ctx context.Context, c client.Reader, pod *corev1.Pod) (*metav1.OwnerReference, error) {
+	jobRef := metav1.GetControllerOf(pod)
+	if jobRef == nil || jobRef.Kind != "Job" {
+		return nil, fmt.Errorf("pod is not owned by a Job")
+	}
+	var job batchv1.Job
+	if err := c.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: jobRef.Name}, &job); err != nil {
+		return nil, fmt.Errorf("getting job: %w", err)
+	}
+	jobSetRef := metav1.GetControllerOf(&job)
+	if jobSetRef == nil || jobSetRef.Kind != "JobSet" {
+		return nil, fmt.Errorf("job %q is not owned by a JobSet", job.Name)
+	}
+	return jobSetRef, nil
+}
+
+// replicatedJobParallelism returns the parallelism of the Job template of the
+// named replicated Job of the JobSet, defaulting to 1 like Jobs do.
+func replicatedJobParallelism(jobSet *unstructured.Unstructured, name string) (int, error) {
+	rjobs, _, err := unstructured.NestedSlice(jobSet.Object, "spec", "replicatedJobs")
+	if err != nil {
+		return 0, fmt.Errorf("reading replicated jobs: %w", err)
+	}
+	for _, v := range rjobs {
+		rjob, ok := v.(map[string]interface{})
+		if !ok || rjob["name"] != name {
+			continue
+		}
+		parallelism, found, err := unstructured.NestedInt64(rjob, "template", "spec", "parallelism")
+		if err != nil {
+			return 0, fmt.Errorf("reading parallelism of replicated job %q: %w", name, err)
+		}
+		if !found {
+			return 1, nil
+		}
+		if parallelism < 1 {
+			return 0, fmt.Errorf("replicated job %q has parallelism %d", name, parallelism)
+		}
+		return int(parallelism), nil
+	}
+	return 0, fmt.Errorf("replicated job %q not found in jobset %q", name, jobSet.GetName())
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// jobSetEventRetention is how long the last event of a slice is remembered.
+// The same event is recorded on the JobSet again after that, as a reminder
+// for slices that keep failing the same way.
+const jobSetEventRetention = time.Hour
+
+// JobSetEvents records the node pool events of the Pods of a JobSet slice
+// (ensuring, ensured and failed) on the owning JobSet as well, so that
+// provisioning of a whole multi-host job can be followed in one place. Each
+// slice and node pool only gets an event when its state (the event reason)
+// changes, not once per Pod of the slice. Pods whose JobSet cannot be
+// resolved, for example because RBAC forbids reading their Job, only get
+// the events on the Pod.
+type JobSetEvents struct {
+	// Reader reads the Jobs that own the Pods. It should not be a cached
+	// client, to avoid watching all Jobs.
+	Reader   client.Reader
+	Recorder record.EventRecorder
+
+	mtx sync.Mutex
+	// last is the last event reason recorded for each slice and node pool.
+	last map[jobSetEventKey]jobSetEvent
+	now  func() time.Time
+}
+
+type jobSetEventKey struct {
+	slice, nodePool string
+}
+
+type jobSetEvent struct {
+	reason   string
+	recorded time.Time
+}
+
+// record records the event of the Pod on its JobSet, unless it is the same
+// event that was last recorded for the slice and node pool.
+func (j *JobSetEvents) record(ctx context.Context, pod *corev1.Pod, eventType, reason, message string, fields ...string) {
+	if j == nil {
+		return
+	}
+	slice, ok := sliceKey(pod)
+	if !ok {
+		return
+	}
+	key := jobSetEventKey{slice: slice, nodePool: eventField(fields, eventFieldNodePool)}
+	prev, claimed := j.claim(key, reason)
+	if !claimed {
+		return
+	}
+	ref, err := jobSetRefOf(ctx, j.Reader, pod)
+	if err != nil {
+		j.release(key, prev)
+		log.FromContext(ctx).V(1).Info("Unable to resolve JobSet of pod, recording the event on the pod only", "slice", slice, "error", err.Error())
+		return
+	}
+	jobSet := &unstructured.Unstructured{}
+	jobSet.SetGroupVersionKind(schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind))
+	jobSet.SetNamespace(pod.Namespace)
+	jobSet.SetName(ref.Name)
+	jobSet.SetUID(ref.UID)
+
+	fields = append([]string{eventFieldSlice, slice}, fields...)
+	j.Recorder.Event(jobSet, eventType, reason, eventMessage(message, fields...))
+}
+
+// claim records reason as the last event of the key and returns true, unless
+// it already is the last event recorded within the jobSetEventRetention.
+// Claiming before the JobSet is read keeps concurrent reconciles of the
+// Pods of a slice from recording the event more than once. prev is the
+// previous last event, see release.
+func (j *JobSetEvents) claim(key jobSetEventKey, reason string) (prev jobSetEvent, claimed bool) {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	now := j.clock()
+	if j.last == nil {
+		j.last = map[jobSetEventKey]jobSetEvent{}
+	}
+	prev, ok := j.last[key]
+	if ok && prev.reason == reason && now.Sub(prev.recorded) < jobSetEventRetention {
+		return prev, false
+	}
+	j.prune(now)
+	j.last[key] = jobSetEvent{reason: reason, recorded: now}
+	return prev, true
+}
+
+// release restores the previous last event of the key after the event could
+// not be recorded, so that another Pod of the slice can record it.
+func (j *JobSetEvents) release(key jobSetEventKey, prev jobSetEvent) {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	if prev.reason == "" {
+		delete(j.last, key)
+		return
+	}
+	j.last[key] = prev
+}
+
+// prune forgets the slices whose last event is older than the retention, so
+// that finished JobSets do not accumulate. j.mtx must be held.
+func (j *JobSetEvents) prune(now time.Time) {
+	for k, e := range j.last {
+		if now.Sub(e.recorded) >= jobSetEventRetention {
+			delete(j.last, k)
+		}
+	}
+}
+
+func (j *JobSetEvents) clock() time.Time {
+	if j.now != nil {
+		return j.now()
+	}
+	return time.Now()
+}
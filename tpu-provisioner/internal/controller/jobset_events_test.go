@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// jobReader is a client.Reader that returns a Job owned by a JobSet, or err.
+type jobReader struct {
+	client.Reader
+	err  error
+	gets int
+}
+
+func (r *jobReader) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	r.gets++
+	if r.err != nil {
+		return r.err
+	}
+	job := obj.(*batchv1.Job)
+	job.Namespace, job.Name = key.Namespace, key.Name
+	job.OwnerReferences = []metav1.OwnerReference{{APIVersion: "jobset.x-k8s.io/v1alpha2", Kind: "JobSet", Name: "train", UID: "train-uid", Controller: boolPtr(true)}}
+	return nil
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+func jobSetPod(name, jobIndex string) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default",
+		Name:      name,
+		Labels: map[string]string{
+			cloud.JobSetNameLabel:          "train",
+			cloud.JobSetReplicatedJobLabel: "workers",
+			cloud.JobSetJobIndexLabel:      jobIndex,
+		},
+		OwnerReferences: []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "Job", Name: "train-workers-" + jobIndex, Controller: boolPtr(true)}},
+	}}
+}
+
+func TestJobSetEvents(t *testing.T) {
+	rec := record.NewFakeRecorder(10)
+	reader := &jobReader{}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	j := &JobSetEvents{Reader: reader, Recorder: rec, now: func() time.Time { return now }}
+	expect := func(events ...string) {
+		t.Helper()
+		for _, exp := range events {
+			select {
+			case got := <-rec.Events:
+				if got != exp {
+					t.Fatalf("expected event %q, got: %q", exp, got)
+				}
+			default:
+				t.Fatalf("expected event %q, got none", exp)
+			}
+		}
+		select {
+		case got := <-rec.Events:
+			t.Fatalf("unexpected event: %q", got)
+		default:
+		}
+	}
+	ctx := context.Background()
+	fields := []string{eventFieldNodePool, "tpu-train-0", eventFieldNodeCount, "4"}
+
+	for _, name := range []string{"a", "b", "c"} {
+		j.record(ctx, jobSetPod(name, "0"), corev1.EventTypeNormal, EventEnsuringNodePool, "Ensuring.", fields...)
+	}
+	j.record(ctx, jobSetPod("a", "0"), corev1.EventTypeWarning, EventQuotaExceeded, "Failed.", fields...)
+	j.record(ctx, jobSetPod("b", "0"), corev1.EventTypeWarning, EventQuotaExceeded, "Failed.", fields...)
+	j.record(ctx, jobSetPod("d", "1"), corev1.EventTypeNormal, EventEnsuringNodePool, "Ensuring.", eventFieldNodePool, "tpu-train-1")
+	expect(
+		"Normal EnsuringNodePool Ensuring. slice=default/train/workers/0 nodePool=tpu-train-0 nodeCount=4",
+		"Warning QuotaExceeded Failed. slice=default/train/workers/0 nodePool=tpu-train-0 nodeCount=4",
+		"Normal EnsuringNodePool Ensuring. slice=default/train/workers/1 nodePool=tpu-train-1",
+	)
+	if reader.gets != 3 {
+		t.Fatalf("expected the Job to be read once per recorded event, got %d reads", reader.gets)
+	}
+
+	now = now.Add(jobSetEventRetention)
+	j.record(ctx, jobSetPod("a", "0"), corev1.EventTypeWarning, EventQuotaExceeded, "Failed.", fields...)
+	expect("Warning QuotaExceeded Failed. slice=default/train/workers/0 nodePool=tpu-train-0 nodeCount=4")
+	if _, ok := j.last[jobSetEventKey{slice: "default/train/workers/1", nodePool: "tpu-train-1"}]; ok {
+		t.Fatal("expected old slices to be pruned")
+	}
+
+	reader.err = errors.New("forbidden")
+	j.record(ctx, jobSetPod("a", "0"), corev1.EventTypeNormal, EventNodePoolEnsured, "Ensured.", fields...)
+	expect()
+	reader.err = nil
+	j.record(ctx, jobSetPod("b", "0"), corev1.EventTypeNormal, EventNodePoolEnsured, "Ensured.", fields...)
+	expect("Normal NodePoolEnsured Ensured. slice=default/train/workers/0 nodePool=tpu-train-0 nodeCount=4")
+
+	var disabled *JobSetEvents
+	disabled.record(ctx, jobSetPod("a", "0"), corev1.EventTypeNormal, EventEnsuringNodePool, "Ensuring.")
+	j.record(ctx, &corev1.Pod{}, corev1.EventTypeNormal, EventEnsuringNodePool, "Ensuring.")
+	expect()
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// jobSetReader serves a single Job and JobSet.
+type jobSetReader struct {
+	job    *batchv1.Job
+	jobSet *unstructured.Unstructured
+}
+
+func (r *jobSetReader) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	switch o := obj.(type) {
+	case *batchv1.Job:
+		if r.job == nil || r.job.Name != key.Name {
+			return errors.New("job not found")
+		}
+		*o = *r.job
+	case *unstructured.Unstructured:
+		if r.jobSet == nil || r.jobSet.GetName() != key.Name {
+			return errors.New("forbidden")
+		}
+		o.Object = r.jobSet.DeepCopy().Object
+	}
+	return nil
+}
+
+func (r *jobSetReader) List(context.Context, client.ObjectList, ...client.ListOption) error {
+	return errors.New("not implemented")
+}
+
+func testJobSet(parallelism interface{}) *unstructured.Unstructured {
+	template := map[string]interface{}{"spec": map[string]interface{}{}}
+	if parallelism != nil {
+		template["spec"].(map[string]interface{})["parallelism"] = parallelism
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "jobset.x-k8s.io/v1alpha2",
+		"kind":       "JobSet",
+		"metadata":   map[string]interface{}{"name": "train", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"replicatedJobs": []interface{}{
+				map[string]interface{}{"name": "coordinator", "template": map[string]interface{}{}},
+				map[string]interface{}{"name": "workers", "template": template},
+			},
+		},
+	}}
+}
+
+func Test_replicatedJobParallelism(t *testing.T) {
+	cases := []struct {
+		name    string
+		jobSet  *unstructured.Unstructured
+		rjob    string
+		exp     int
+		wantErr bool
+	}{
+		{name: "parallelism", jobSet: testJobSet(int64(4)), rjob: "workers", exp: 4},
+		{name: "default parallelism", jobSet: testJobSet(nil), rjob: "workers", exp: 1},
+		{name: "unknown replicated job", jobSet: testJobSet(int64(4)), rjob: "evaluators", wantErr: true},
+		{name: "zero parallelism", jobSet: testJobSet(int64(0)), rjob: "workers", wantErr: true},
+		{name: "invalid parallelism", jobSet: testJobSet("four"), rjob: "workers", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			n, err := replicatedJobParallelism(c.jobSet, c.rjob)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("error: expected: %v, got: %v", c.wantErr, err)
+			}
+			if n != c.exp {
+				t.Fatalf("expected: %v, got: %v", c.exp, n)
+			}
+		})
+	}
+}
+
+func Test_jobSetParallelism(t *testing.T) {
+	isController := true
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Name:      "train-workers-0",
+		Namespace: "default",
+		OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "jobset.x-k8s.io/v1alpha2", Kind: "JobSet", Name: "train", Controller: &isController},
+		},
+	}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "train-workers-0-0",
+		Namespace: "default",
+		Labels:    map[string]string{cloud.JobSetReplicatedJobLabel: "workers"},
+		OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "batch/v1", Kind: "Job", Name: job.Name, Controller: &isController},
+		},
+	}}
+
+	n, err := jobSetParallelism(context.Background(), &jobSetReader{job: job, jobSet: testJobSet(int64(4))}, pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 4 {
+		t.Fatalf("expected: 4, got: %v", n)
+	}
+
+	// The JobSet could not be read, for example due to missing permissions.
+	if _, err := jobSetParallelism(context.Background(), &jobSetReader{job: job}, pod); err == nil {
+		t.Fatalf("expected error")
+	}
+}
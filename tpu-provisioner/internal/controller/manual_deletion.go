@@ -0,0 +1,224 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// manualDeletionRetryInterval is how often a node pool that is being drained
+// or deleted for a manual deletion request is checked again.
+const manualDeletionRetryInterval = 15 * time.Second
+
+// ManualDeletionReconciler deletes the node pool of a Node that has the
+// cloud.AnnotationDeleteNodePool annotation set to "true", after draining its
+// Nodes with the Drainer, if set. Only node pools that the provider lists as
+// created by this provisioner are deleted, the annotation is ignored on other
+// Nodes.
+//
+// The annotation goes away with the Nodes of the deleted node pool. Nodes
+// that were created before the node pool of their name (see
+// manualDeletionLeftover) are leftovers of a node pool that was already
+// deleted, so that a node pool created again for Pods that are still pending
+// is not deleted by their annotation.
+type ManualDeletionReconciler struct {
+	client.Client
+	Recorder  record.EventRecorder
+	Provider  cloud.Provider
+	EventSink *EventSink
+	// Drainer, if set, drains the Nodes before the node pool is deleted.
+	Drainer *Drainer
+	// Tracer, if set, traces the provider calls that delete node pools.
+	Tracer Tracer
+
+	// deleter drains and deletes the node pools, see nodePoolDeleter.
+	deleter     *nodePoolDeleter
+	deleterOnce sync.Once
+
+	mtx sync.Mutex
+	// deletedAt tracks when each node pool was deleted, guarded by mtx.
+	deletedAt map[string]time.Time
+}
+
+// nodePoolDeleter returns the deleter of the reconciler.
+func (r *ManualDeletionReconciler) nodePoolDeleter() *nodePoolDeleter {
+	r.deleterOnce.Do(func() {
+		r.deleter = &nodePoolDeleter{Recorder: r.Recorder, Provider: r.Provider, EventSink: r.EventSink, Drainer: r.Drainer, Tracer: r.Tracer}
+	})
+	return r.deleter
+}
+
+// manualDeletionRequested returns true if the Node requests the deletion of
+// its node pool.
+func manualDeletionRequested(n *corev1.Node) bool {
+	return n.Annotations[cloud.AnnotationDeleteNodePool] == "true"
+}
+
+// manualDeletionLeftover returns true if the Node was created before the node
+// pool of its name was created (createdAt, zero if unknown) or deleted
+// (deletedAt, zero if not deleted by the ManualDeletionReconciler): it
+// belongs to an earlier node pool with the same name.
+func manualDeletionLeftover(n *corev1.Node, createdAt, deletedAt time.Time) bool {
+	created := n.CreationTimestamp.Time
+	for _, t := range []time.Time{createdAt, deletedAt} {
+		if !t.IsZero() && created.Before(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reconcile drains and deletes the node pool of a Node that requests it.
+func (r *ManualDeletionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+
+	var node corev1.Node
+	if err := r.Get(ctx, req.NamespacedName, &node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, fmt.Errorf("getting node: %w", err)
+	}
+	if !manualDeletionRequested(&node) {
+		return ctrl.Result{}, nil
+	}
+	name, ok := node.Labels[r.Provider.NodePoolLabelKey()]
+	if !ok || !r.Provider.NodePoolOwner().Owns(node.Labels) {
+		lg.V(1).Info("Ignoring node pool deletion request on a Node that the provisioner does not manage")
+		return ctrl.Result{}, nil
+	}
+	info, known, err := r.managedNodePool(name)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !known {
+		lg.V(1).Info("Ignoring node pool deletion request, the node pool is not managed by the provisioner", "nodePool", name)
+		return ctrl.Result{}, nil
+	}
+	r.mtx.Lock()
+	deletedAt := r.deletedAt[name]
+	r.mtx.Unlock()
+	if manualDeletionLeftover(&node, info.CreatedAt, deletedAt) {
+		lg.V(1).Info("Ignoring node pool deletion request of a Node of an earlier node pool", "nodePool", name)
+		return ctrl.Result{}, nil
+	}
+
+	var nodes corev1.NodeList
+	owner := r.Provider.NodePoolOwner()
+	if err := r.List(ctx, &nodes, client.MatchingLabels{
+		owner.NodeLabelKey():          owner.Value,
+		r.Provider.NodePoolLabelKey(): name,
+	}); err != nil {
+		return ctrl.Result{}, fmt.Errorf("listing nodes: %w", err)
+	}
+	fields := nodeEventFields(&node, name, len(nodes.Items))
+	deleter := r.nodePoolDeleter()
+	if !deleter.draining(name) {
+		lg.Info("Deleting node pool as requested by Node annotation", "nodePool", name)
+		r.Recorder.Event(&node, corev1.EventTypeNormal, EventManualDeletion, eventMessage("Deleting Node Pool as requested by the "+cloud.AnnotationDeleteNodePool+" annotation.", fields...))
+		r.EventSink.record(&node, corev1.EventTypeNormal, EventManualDeletion, "Deleting Node Pool as requested.", nil, fields...)
+	}
+
+	if r.Drainer != nil {
+		var pods corev1.PodList
+		if err := r.List(ctx, &pods); err != nil {
+			return ctrl.Result{}, fmt.Errorf("listing pods: %w", err)
+		}
+		drained, skipped, err := deleter.drained(ctx, name, nodes.Items, pods.Items, fields)
+		if err != nil {
+			return ctrl.Result{RequeueAfter: manualDeletionRetryInterval}, err
+		}
+		if skipped {
+			// The request is dropped.
+			return ctrl.Result{}, r.removeDeleteRequest(ctx, nodes.Items)
+		}
+		if !drained {
+			return ctrl.Result{RequeueAfter: manualDeletionRetryInterval}, nil
+		}
+	}
+
+	if retry, err := deleter.deleteNodePool(ctx, &node, name, fields); err != nil || retry {
+		return ctrl.Result{RequeueAfter: manualDeletionRetryInterval}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.deletedAt == nil {
+		r.deletedAt = map[string]time.Time{}
+	}
+	r.deletedAt[name] = time.Now()
+	return ctrl.Result{}, nil
+}
+
+// removeDeleteRequest removes the cloud.AnnotationDeleteNodePool annotation
+// from the Nodes.
+func (r *ManualDeletionReconciler) removeDeleteRequest(ctx context.Context, nodes []corev1.Node) error {
+	for i := range nodes {
+		n := &nodes[i]
+		if _, ok := n.Annotations[cloud.AnnotationDeleteNodePool]; !ok {
+			continue
+		}
+		patch := client.MergeFrom(n.DeepCopy())
+		delete(n.Annotations, cloud.AnnotationDeleteNodePool)
+		if err := r.Patch(ctx, n, patch); err != nil {
+			return fmt.Errorf("removing delete annotation from node %s: %w", n.Name, err)
+		}
+	}
+	return nil
+}
+
+// managedNodePool returns the node pool if the provider lists it as managed
+// by this provisioner.
+func (r *ManualDeletionReconciler) managedNodePool(name string) (cloud.NodePoolInfo, bool, error) {
+	nps, err := r.Provider.ListNodePools()
+	if err != nil {
+		return cloud.NodePoolInfo{}, false, fmt.Errorf("listing node pools: %w", err)
+	}
+	for _, np := range nps {
+		if np.Name == name {
+			return np, true, nil
+		}
+	}
+	return cloud.NodePoolInfo{}, false, nil
+}
+
+// SetupWithManager sets up the controller for the annotated Nodes with the
+// Manager.
+func (r *ManualDeletionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Drainer != nil {
+		if r.Drainer.Timeout <= 0 {
+			return fmt.Errorf("Drainer.Timeout must be set")
+		}
+		if err := ValidateDrainTimeoutAction(r.Drainer.TimeoutAction); err != nil {
+			return err
+		}
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("manual-deletion").
+		For(&corev1.Node{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(o client.Object) bool {
+			return o.GetAnnotations()[cloud.AnnotationDeleteNodePool] == "true"
+		}))).
+		Complete(r)
+}
+
+// manuallyDeleting returns true if one of the Nodes requests the deletion of
+// their node pool.
+func manuallyDeleting(nodes []corev1.Node) bool {
+	for i := range nodes {
+		if manualDeletionRequested(&nodes[i]) {
+			return true
+		}
+	}
+	return false
+}
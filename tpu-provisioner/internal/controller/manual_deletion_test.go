@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func Test_manuallyDeleting(t *testing.T) {
+	nodes := []corev1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}}, {ObjectMeta: metav1.ObjectMeta{Name: "node-b"}}}
+	if manuallyDeleting(nodes) {
+		t.Fatal("expected Nodes without the annotation to not be deleted")
+	}
+	nodes[1].Annotations = map[string]string{cloud.AnnotationDeleteNodePool: "false"}
+	if manuallyDeleting(nodes) {
+		t.Fatal("expected the annotation to have to be true")
+	}
+	nodes[1].Annotations[cloud.AnnotationDeleteNodePool] = "true"
+	if !manuallyDeleting(nodes) {
+		t.Fatal("expected a Node with the annotation to mark its node pool as deleted")
+	}
+}
+
+func Test_manualDeletionLeftover(t *testing.T) {
+	now := time.Now()
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a", CreationTimestamp: metav1.NewTime(now.Add(-time.Hour))}}
+	cases := []struct {
+		name                 string
+		createdAt, deletedAt time.Time
+		leftover             bool
+	}{
+		{name: "unknown creation"},
+		{name: "node of the node pool", createdAt: now.Add(-2 * time.Hour)},
+		{name: "node of an earlier node pool", createdAt: now.Add(-time.Minute), leftover: true},
+		{name: "node of a deleted node pool", createdAt: now.Add(-2 * time.Hour), deletedAt: now.Add(-time.Minute), leftover: true},
+		{name: "node pool deleted before the node was created", deletedAt: now.Add(-2 * time.Hour)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := manualDeletionLeftover(node, c.createdAt, c.deletedAt); got != c.leftover {
+				t.Fatalf("expected leftover: %v, got: %v", c.leftover, got)
+			}
+		})
+	}
+}
+
+// nodePoolInfoProvider lists the given node pools as created by the
+// provisioner.
+type nodePoolInfoProvider struct {
+	testProvider
+	pools []cloud.NodePoolInfo
+}
+
+func (p *nodePoolInfoProvider) ListNodePools() ([]cloud.NodePoolInfo, error) { return p.pools, nil }
+
+func Test_ManualDeletionReconciler_Reconcile(t *testing.T) {
+	now := time.Now()
+	node := func(labels map[string]string, created time.Time) corev1.Node {
+		return corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:              "node-a",
+			Labels:            labels,
+			Annotations:       map[string]string{cloud.AnnotationDeleteNodePool: "true"},
+			CreationTimestamp: metav1.NewTime(created),
+		}}
+	}
+	owned := cloud.DefaultOwner.NodeLabels()
+	owned["cloud.test.com/test-nodepool"] = "np"
+	foreign := map[string]string{"cloud.test.com/test-nodepool": "np"}
+
+	for name, c := range map[string]struct {
+		node    corev1.Node
+		pools   []cloud.NodePoolInfo
+		deleted bool
+	}{
+		"owned node pool": {
+			node:    node(owned, now.Add(-time.Hour)),
+			pools:   []cloud.NodePoolInfo{{Name: "np", CreatedAt: now.Add(-2 * time.Hour)}},
+			deleted: true,
+		},
+		"Node not managed by the provisioner": {
+			node:  node(foreign, now.Add(-time.Hour)),
+			pools: []cloud.NodePoolInfo{{Name: "np", CreatedAt: now.Add(-2 * time.Hour)}},
+		},
+		"node pool not listed by the provider": {
+			node: node(owned, now.Add(-time.Hour)),
+		},
+		"Node of an earlier node pool": {
+			node:  node(owned, now.Add(-time.Hour)),
+			pools: []cloud.NodePoolInfo{{Name: "np", CreatedAt: now.Add(-time.Minute)}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			store := newPodStore()
+			store.nodes = []corev1.Node{c.node}
+			provider := &nodePoolInfoProvider{testProvider: testProvider{deletedPools: map[string]time.Time{}}, pools: c.pools}
+			r := &ManualDeletionReconciler{Client: store, Recorder: record.NewFakeRecorder(10), Provider: provider}
+
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKey{Name: "node-a"}}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := provider.getDeletedPool("np"); got != c.deleted {
+				t.Fatalf("node pool deleted: expected: %v, got: %v", c.deleted, got)
+			}
+		})
+	}
+
+	t.Run("leftover annotation after the deletion", func(t *testing.T) {
+		store := newPodStore()
+		store.nodes = []corev1.Node{node(owned, now.Add(-time.Hour))}
+		provider := &nodePoolInfoProvider{
+			testProvider: testProvider{deletedPools: map[string]time.Time{}},
+			// Node pools created by older versions have no creation
+			// time.
+			pools: []cloud.NodePoolInfo{{Name: "np"}},
+		}
+		r := &ManualDeletionReconciler{Client: store, Recorder: record.NewFakeRecorder(10), Provider: provider}
+		req := ctrl.Request{NamespacedName: client.ObjectKey{Name: "node-a"}}
+		if _, err := r.Reconcile(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !provider.getDeletedPool("np") {
+			t.Fatal("expected the node pool to be deleted")
+		}
+
+		// The node pool is created again for pending Pods while the
+		// annotated Node is still being removed.
+		provider.deletedPools = map[string]time.Time{}
+		if _, err := r.Reconcile(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if provider.getDeletedPool("np") {
+			t.Fatal("expected the new node pool to not be deleted by the annotation of an old Node")
+		}
+	})
+}
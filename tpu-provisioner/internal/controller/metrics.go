@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const metricsNamespace = "tpu_provisioner"
+
+var (
+	nodePoolCreationAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "node_pool_creation_attempts_total",
+		Help:      "Number of attempts to ensure a node pool, partitioned by result (success, duplicate, error).",
+	}, []string{"result"})
+
+	nodePoolCreationErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "node_pool_creation_errors_total",
+		Help:      "Number of failed attempts to ensure a node pool, partitioned by error category.",
+	}, []string{"category"})
+
+	nodePoolEnsureDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "node_pool_ensure_duration_seconds",
+		Help:      "Latency of provider calls to ensure a node pool.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 13),
+	})
+
+	nodePoolReadyDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "node_pool_ready_duration_seconds",
+		Help:      "Time from a node pool being ensured for a Pod until all of its Nodes are Ready.",
+		Buckets:   prometheus.ExponentialBuckets(15, 2, 10),
+	})
+
+	nodePoolsNotReady = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "node_pools_not_ready_total",
+		Help:      "Number of node pools ensured for a Pod whose Nodes were not all Ready within the ready timeout.",
+	})
+
+	podProvisioningDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "pod_provisioning_duration_seconds",
+		Help:      "Time from a Pod becoming Unschedulable until all Nodes of the node pool ensured for it are Ready, partitioned by accelerator and topology.",
+		Buckets:   prometheus.ExponentialBuckets(15, 2, 10),
+	}, []string{"accelerator", "topology"})
+
+	nodePoolStockouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "node_pool_stockouts_total",
+		Help:      "Number of failed attempts to ensure a node pool because its zones were out of capacity, partitioned by accelerator.",
+	}, []string{"accelerator"})
+
+	podsAbandoned = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "pods_abandoned_total",
+		Help:      "Number of Pods for which ensuring a node pool was given up after repeated permanent errors, partitioned by error category.",
+	}, []string{"category"})
+
+	provisioningTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "provisioning_timeouts_total",
+		Help:      "Number of node pools that were not Ready within the provisioning timeout, partitioned by the action taken.",
+	}, []string{"action"})
+
+	partialSlices = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "partial_slices_total",
+		Help:      "Number of multi-host node pools that had fewer Ready Nodes than their topology requires after the grace period, partitioned by the action taken.",
+	}, []string{"action"})
+
+	eventsSuppressed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "events_suppressed_total",
+		Help:      "Number of events that were not emitted because an event of the same reason was recently emitted for the same object, partitioned by reason.",
+	}, []string{"reason"})
+
+	nodePoolsCreating = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "node_pools_creating",
+		Help:      "Number of node pools currently being ensured.",
+	})
+
+	provisioningPaused = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "provisioning_paused",
+		Help:      "Whether node pool creation was paused (1) or not (0) when a Pod was last reconciled.",
+	})
+
+	eventSinkDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "event_sink_deliveries_total",
+		Help:      "Number of events posted to the event sink, partitioned by result (delivered, failed, dropped).",
+	}, []string{"result"})
+
+	sweepDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "sweep_duration_seconds",
+		Help:      "Duration of the periodic sweeps of all node pools.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+	})
+
+	sweepActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "sweep_actions_total",
+		Help:      "Number of actions taken by the periodic sweeps of all node pools, partitioned by action (resync, delete_orphan, failed).",
+	}, []string{"action"})
+
+	podsIgnored = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "pods_ignored_total",
+		Help:      "Number of reconciles that did not ensure a node pool for a Pod, partitioned by the reason it was ignored (for example NotUnschedulable or MissingNodeSelectors).",
+	}, []string{"reason"})
+
+	slicesProvisioning = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "slices_provisioning",
+		Help:      "Number of multi-host slices whose node pool is not ensured yet, tracked when slice aggregation is enabled.",
+	})
+
+	sliceProvisioningDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "slice_provisioning_duration_seconds",
+		Help:      "Time from the first event of a multi-host slice until its node pool was ensured or the slice expired, partitioned by result (ensured, expired).",
+		Buckets:   prometheus.ExponentialBuckets(15, 2, 10),
+	}, []string{"result"})
+
+	sliceTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "slice_transitions_total",
+		Help:      "Number of node pool event transitions of multi-host slices, partitioned by event reason.",
+	}, []string{"reason"})
+
+	managedNodePools = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "managed_node_pools",
+		Help:      "Number of node pools created by the provisioner as of the last sweep, partitioned by provider status.",
+	}, []string{"status"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		nodePoolCreationAttempts,
+		nodePoolCreationErrors,
+		nodePoolEnsureDuration,
+		nodePoolReadyDuration,
+		nodePoolsNotReady,
+		nodePoolsCreating,
+		podProvisioningDuration,
+		nodePoolStockouts,
+		podsAbandoned,
+		provisioningTimeouts,
+		partialSlices,
+		eventsSuppressed,
+		provisioningPaused,
+		eventSinkDeliveries,
+		sweepDuration,
+		sweepActions,
+		managedNodePools,
+		podsIgnored,
+		slicesProvisioning,
+		sliceProvisioningDuration,
+		sliceTransitions,
+	)
+	// Export every reason from the start, so that rates can be computed
+	// before a reason first occurs.
+	for _, reason := range ignoreReasons {
+		podsIgnored.WithLabelValues(reason)
+	}
+	podsIgnored.WithLabelValues(ignoreReasonOther)
+}
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"fmt"
+	"path"
+)
+
+// NamespaceFilter restricts which namespaces may trigger node pool creation.
+// Patterns are shell globs as understood by path.Match, for example "team-*".
+type NamespaceFilter struct {
+	// Allow, if non-empty, lists the only namespaces that are allowed.
+	Allow []string
+	// Deny lists namespaces that are not allowed. It takes precedence over
+	// Allow.
+	Deny []string
+}
+
+// allows returns whether the namespace is allowed by the global lists. A
+// disallowed namespace can still opt in via the cloud.AnnotationNamespaceEnabled
+// annotation.
+func (f NamespaceFilter) allows(ns string) bool {
+	if matchesAnyGlob(ns, f.Deny) {
+		return false
+	}
+	if len(f.Allow) > 0 {
+		return matchesAnyGlob(ns, f.Allow)
+	}
+	return true
+}
+
+func matchesAnyGlob(s string, patterns []string) bool {
+	for _, p := range patterns {
+		// Patterns are validated by ValidateGlobs, so errors
+		// (path.ErrBadPattern) are not expected here.
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateGlobs returns an error if any of the patterns are malformed.
+func ValidateGlobs(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
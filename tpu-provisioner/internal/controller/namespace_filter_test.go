@@ -0,0 +1,59 @@
+package controller
+
+import "testing"
+
+func Test_NamespaceFilter_allows(t *testing.T) {
+	cases := []struct {
+		name   string
+		filter NamespaceFilter
+		ns     string
+		exp    bool
+	}{
+		{
+			name: "no lists",
+			ns:   "default",
+			exp:  true,
+		},
+		{
+			name:   "allowed by glob",
+			filter: NamespaceFilter{Allow: []string{"team-*"}},
+			ns:     "team-a",
+			exp:    true,
+		},
+		{
+			name:   "not in allowlist",
+			filter: NamespaceFilter{Allow: []string{"team-*"}},
+			ns:     "default",
+			exp:    false,
+		},
+		{
+			name:   "denied",
+			filter: NamespaceFilter{Deny: []string{"kube-*"}},
+			ns:     "kube-system",
+			exp:    false,
+		},
+		{
+			name:   "deny takes precedence",
+			filter: NamespaceFilter{Allow: []string{"team-*"}, Deny: []string{"team-b"}},
+			ns:     "team-b",
+			exp:    false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.filter.allows(c.ns); got != c.exp {
+				t.Fatalf("expected: %v, got: %v", c.exp, got)
+			}
+		})
+	}
+}
+
+func Test_ValidateGlobs(t *testing.T) {
+	if err := ValidateGlobs([]string{"team-*", "ml-[ab]"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ValidateGlobs([]string{"team-["}); err == nil {
+		t.Fatalf("expected error for malformed pattern")
+	}
+}
@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// nodePoolDeleter drains node pools with the Drainer, if set, and deletes
+// them, recording the events of both. It is shared by the components that
+// delete node pools on their own: the NodePoolGarbageCollector, the
+// ForceRecreateReconciler and the ManualDeletionReconciler.
+type nodePoolDeleter struct {
+	Recorder  record.EventRecorder
+	Provider  cloud.Provider
+	EventSink *EventSink
+	Drainer   *Drainer
+	Tracer    Tracer
+
+	mtx sync.Mutex
+	// drainingSince tracks when draining each node pool started, guarded by
+	// mtx.
+	drainingSince map[string]time.Time
+}
+
+// draining returns true if the node pool is being drained.
+func (d *nodePoolDeleter) draining(name string) bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	_, ok := d.drainingSince[name]
+	return ok
+}
+
+// forget stops tracking the drain of the node pool, for example because
+// another component took it over.
+func (d *nodePoolDeleter) forget(name string) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	delete(d.drainingSince, name)
+}
+
+// prune forgets the drains of the node pools that keep returns false for.
+func (d *nodePoolDeleter) prune(keep func(name string) bool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	for name := range d.drainingSince {
+		if !keep(name) {
+			delete(d.drainingSince, name)
+		}
+	}
+}
+
+// drained drains the Nodes of the node pool and returns true once it can be
+// deleted: no Pods are left to evict, or the drain timed out and the
+// Drainer's TimeoutAction deletes the node pool anyway. If the TimeoutAction
+// keeps the node pool instead, its Nodes are uncordoned and skipped is true,
+// so that the caller can drop its request.
+func (d *nodePoolDeleter) drained(ctx context.Context, name string, nodes []corev1.Node, pods []corev1.Pod, fields []string) (drained, skipped bool, err error) {
+	lg := log.FromContext(ctx)
+
+	d.mtx.Lock()
+	if d.drainingSince == nil {
+		d.drainingSince = map[string]time.Time{}
+	}
+	started, ok := d.drainingSince[name]
+	if !ok {
+		started = time.Now()
+		d.drainingSince[name] = started
+	}
+	d.mtx.Unlock()
+	if !ok {
+		lg.Info("Draining node pool", "nodePool", name)
+		d.Recorder.Event(&nodes[0], corev1.EventTypeNormal, EventDrainingNodePool, eventMessage("Draining Node Pool.", fields...))
+	}
+
+	left, err := d.Drainer.drain(ctx, nodes, pods)
+	if err != nil {
+		return false, false, fmt.Errorf("draining node pool: %w", err)
+	}
+	if left == 0 {
+		return true, false, nil
+	}
+	if time.Since(started) < d.Drainer.Timeout {
+		lg.V(1).Info("Waiting for pods to be evicted", "nodePool", name, "pods", left)
+		return false, false, nil
+	}
+
+	msg := fmt.Sprintf("Node Pool %s still has %d Pods after draining for %v.", name, left, d.Drainer.Timeout)
+	skip := d.Drainer.TimeoutAction == DrainTimeoutSkip
+	if skip {
+		msg += " Keeping it."
+	} else {
+		msg += " Deleting it anyway."
+	}
+	lg.Info("Draining node pool timed out", "nodePool", name, "pods", left, "action", d.Drainer.TimeoutAction)
+	d.Recorder.Event(&nodes[0], corev1.EventTypeWarning, EventDrainTimeout, eventMessage(msg, fields...))
+	d.EventSink.record(&nodes[0], corev1.EventTypeWarning, EventDrainTimeout, msg, nil, fields...)
+	if !skip {
+		return true, false, nil
+	}
+	if err := d.stopDraining(ctx, name, nodes); err != nil {
+		return false, false, err
+	}
+	return false, true, nil
+}
+
+// stopDraining uncordons the Nodes of a node pool that is being drained but
+// is no longer going to be deleted.
+func (d *nodePoolDeleter) stopDraining(ctx context.Context, name string, nodes []corev1.Node) error {
+	if !d.draining(name) {
+		return nil
+	}
+	if err := d.Drainer.uncordon(ctx, nodes); err != nil {
+		return fmt.Errorf("uncordoning node pool: %w", err)
+	}
+	d.forget(name)
+	return nil
+}
+
+// deleteNodePool deletes the node pool and records the events on the object.
+// It returns true if the deletion should be retried later because the node
+// pool is busy or the provider is rate limited.
+func (d *nodePoolDeleter) deleteNodePool(ctx context.Context, obj client.Object, name string, fields []string) (bool, error) {
+	d.Recorder.Event(obj, corev1.EventTypeNormal, EventDeletingNodePool, eventMessage(DeletingNodePoolEventMessage, fields...))
+	if err := tracedProvider(ctx, d.Tracer, d.Provider).DeleteNodePool(name); err != nil {
+		var rateLimited *cloud.RateLimitedError
+		if errors.Is(err, cloud.ErrDuplicateRequest) || errors.Is(err, cloud.ErrNodePoolCreationInProgress) || errors.As(err, &rateLimited) {
+			log.FromContext(ctx).Info("Waiting to delete node pool", "nodePool", name, "reason", err.Error())
+			return true, nil
+		}
+		d.Recorder.Event(obj, corev1.EventTypeWarning, EventFailedDeletingNodePool, eventMessage("Failed to delete Node Pool: "+err.Error(), fields...))
+		d.EventSink.record(obj, corev1.EventTypeWarning, EventFailedDeletingNodePool, "Failed to delete Node Pool.", err, fields...)
+		return false, fmt.Errorf("deleting node pool %q: %w", name, err)
+	}
+	d.Recorder.Event(obj, corev1.EventTypeNormal, EventNodePoolDeleted, eventMessage(DeletedNodePoolEventMessage, fields...))
+	d.EventSink.record(obj, corev1.EventTypeNormal, EventNodePoolDeleted, DeletedNodePoolEventMessage, nil, fields...)
+	d.forget(name)
+	return false, nil
+}
@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// NodePoolGarbageCollector periodically deletes node pools created by this
+// provisioner that have not had any TPU (or GPU) Pods scheduled on them for
+// longer than IdleDuration. Autoscaled node pools are only deleted once they
+// have also been scaled in to their minimum size for IdleDuration. (Node pools
+// that scale to zero have no Nodes and are left alone.) Node pools created
+// for Pods with the cloud.AnnotationIdleTimeout annotation use their own idle
+// timeout instead of IdleDuration, see idleTimeout.
+type NodePoolGarbageCollector struct {
+	Client   client.Client
+	Recorder record.EventRecorder
+	Provider cloud.Provider
+
+	// Interval is the time between garbage collection passes.
+	Interval time.Duration
+	// IdleDuration is how long a node pool must be idle before it is deleted,
+	// unless it has its own idle timeout.
+	IdleDuration time.Duration
+	// DryRun logs the node pools that would be deleted without deleting them.
+	DryRun bool
+	// EventSink, if set, also receives the node pool deletion events.
+	EventSink *EventSink
+	// Drainer, if set, drains the Nodes of idle node pools before they are
+	// deleted, which takes at least one more pass.
+	Drainer *Drainer
+	// Tracer, if set, traces the provider calls that delete node pools.
+	Tracer Tracer
+
+	// idleSince tracks when each node pool was first observed to be idle.
+	idleSince map[string]time.Time
+	// deleter drains and deletes the idle node pools, see nodePoolDeleter.
+	deleter     *nodePoolDeleter
+	deleterOnce sync.Once
+}
+
+// nodePoolDeleter returns the deleter of the garbage collector.
+func (g *NodePoolGarbageCollector) nodePoolDeleter() *nodePoolDeleter {
+	g.deleterOnce.Do(func() {
+		g.deleter = &nodePoolDeleter{Recorder: g.Recorder, Provider: g.Provider, EventSink: g.EventSink, Drainer: g.Drainer, Tracer: g.Tracer}
+	})
+	return g.deleter
+}
+
+// Start runs the garbage collector until the context is cancelled.
+// It implements manager.Runnable.
+func (g *NodePoolGarbageCollector) Start(ctx context.Context) error {
+	if g.Interval == 0 || g.IdleDuration == 0 {
+		return fmt.Errorf("NodePoolGarbageCollector.Interval and IdleDuration must be set")
+	}
+	if g.Drainer != nil {
+		if g.Drainer.Timeout <= 0 {
+			return fmt.Errorf("Drainer.Timeout must be set")
+		}
+		if err := ValidateDrainTimeoutAction(g.Drainer.TimeoutAction); err != nil {
+			return err
+		}
+	}
+
+	t := time.NewTicker(g.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			if err := g.collect(ctx); err != nil {
+				log.FromContext(ctx).Error(err, "garbage collecting node pools")
+			}
+		}
+	}
+}
+
+func (g *NodePoolGarbageCollector) collect(ctx context.Context) error {
+	lg := log.FromContext(ctx).WithName("nodepool-gc")
+
+	var nodes corev1.NodeList
+	if err := g.Client.List(ctx, &nodes, client.MatchingLabels(g.Provider.NodePoolOwner().NodeLabels())); err != nil {
+		return fmt.Errorf("listing nodes: %w", err)
+	}
+
+	nodePoolLabelKey := g.Provider.NodePoolLabelKey()
+	nodePools := map[string][]corev1.Node{}
+	for _, n := range nodes.Items {
+		if name, ok := n.GetLabels()[nodePoolLabelKey]; ok {
+			nodePools[name] = append(nodePools[name], n)
+		}
+	}
+
+	var pods corev1.PodList
+	if err := g.Client.List(ctx, &pods); err != nil {
+		return fmt.Errorf("listing pods: %w", err)
+	}
+	busyNodes := map[string]bool{}
+	for _, p := range pods.Items {
+		if p.Spec.NodeName == "" || isDone(&p) {
+			continue
+		}
+		// Pods that select only the TPU accelerator type got their node
+		// pool with the topology filled in, see cloud.CompleteTPUSelectors.
+		if cloud.HasTPUSelector(&p) || hasAnyNodeSelector(&p, cloud.GKEGPUNodeSelector) {
+			busyNodes[p.Spec.NodeName] = true
+		}
+	}
+
+	if g.idleSince == nil {
+		g.idleSince = map[string]time.Time{}
+	}
+	for name := range g.idleSince {
+		if _, ok := nodePools[name]; !ok {
+			delete(g.idleSince, name)
+		}
+	}
+	deleter := g.nodePoolDeleter()
+	deleter.prune(func(name string) bool {
+		_, ok := nodePools[name]
+		return ok
+	})
+
+	for name, poolNodes := range nodePools {
+		idle := true
+		for _, n := range poolNodes {
+			if busyNodes[n.Name] {
+				idle = false
+				break
+			}
+		}
+		// Node pools that are force recreated are drained and deleted by
+		// the ForceRecreateReconciler.
+		if forceRecreating(poolNodes) {
+			delete(g.idleSince, name)
+			deleter.forget(name)
+			continue
+		}
+		// So are node pools whose deletion was requested on a Node, by
+		// the ManualDeletionReconciler.
+		if manuallyDeleting(poolNodes) {
+			delete(g.idleSince, name)
+			deleter.forget(name)
+			continue
+		}
+		// Warm node pools are kept idle on purpose, the
+		// WarmNodePoolRefiller deletes the ones that are not wanted.
+		if warmNodePool(poolNodes) {
+			delete(g.idleSince, name)
+			continue
+		}
+		// Autoscaled node pools are first scaled in by the cluster
+		// autoscaler, only start counting once it is done.
+		if !idle || aboveAutoscalingMin(poolNodes) {
+			delete(g.idleSince, name)
+			if err := deleter.stopDraining(ctx, name, poolNodes); err != nil {
+				lg.Error(err, "stopping to drain node pool", "nodePool", name)
+			}
+			continue
+		}
+
+		since, ok := g.idleSince[name]
+		if !ok {
+			g.idleSince[name] = time.Now()
+			continue
+		}
+		timeout := idleTimeout(ctx, name, poolNodes, g.IdleDuration)
+		if time.Since(since) < timeout {
+			continue
+		}
+
+		if g.DryRun {
+			lg.Info("Dry run: would delete idle node pool", "nodePool", name, "idleSince", since, "idleTimeout", timeout)
+			continue
+		}
+
+		node := &poolNodes[0]
+		fields := nodeEventFields(node, name, len(poolNodes))
+		if g.Drainer != nil {
+			drained, skipped, err := deleter.drained(ctx, name, poolNodes, pods.Items, fields)
+			if err != nil {
+				lg.Error(err, "draining idle node pool", "nodePool", name)
+				continue
+			}
+			if skipped {
+				// Drained again once it has been idle for its
+				// timeout again.
+				delete(g.idleSince, name)
+			}
+			if !drained {
+				continue
+			}
+		}
+
+		lg.Info("Deleting idle node pool", "nodePool", name, "idleSince", since, "idleTimeout", timeout)
+		retry, err := deleter.deleteNodePool(ctx, node, name, fields)
+		if err != nil {
+			lg.Error(err, "deleting idle node pool", "nodePool", name)
+		}
+		if err != nil || retry {
+			continue
+		}
+		delete(g.idleSince, name)
+	}
+
+	return nil
+}
+
+// aboveAutoscalingMin returns true if the Nodes belong to an autoscaled node
+// pool that has more Nodes than its minimum size.
+func aboveAutoscalingMin(nodes []corev1.Node) bool {
+	v, ok := nodes[0].Labels[cloud.LabelAutoscalingMin]
+	if !ok {
+		return false
+	}
+	min, err := strconv.Atoi(v)
+	if err != nil {
+		return false
+	}
+	return len(nodes) > min
+}
+
+// idleTimeout returns how long the node pool must be idle before it is
+// deleted: the idle timeout stamped on its Nodes at creation, from the
+// annotation of the Pod it was created for, or def if it has none. An invalid
+// label, which the provisioner does not set, is logged and ignored.
+func idleTimeout(ctx context.Context, name string, nodes []corev1.Node, def time.Duration) time.Duration {
+	if d, ok := cloud.NodePoolIdleTimeout(nodes[0].Labels); ok {
+		return d
+	}
+	if v, ok := nodes[0].Labels[cloud.LabelIdleTimeout]; ok {
+		log.FromContext(ctx).WithName("nodepool-gc").Info("Ignoring invalid idle timeout label", "nodePool", name, "value", v)
+	}
+	return def
+}
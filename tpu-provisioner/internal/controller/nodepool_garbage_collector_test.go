@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Node pool garbage collector", func() {
+
+	// Define utility constants for object names and testing timeouts/durations and intervals.
+	const (
+		timeout  = time.Second * 10
+		interval = time.Millisecond * 250
+	)
+
+	Context("When node pools are idle", func() {
+		It("Should delete only idle provisioner-managed Node Pools", func() {
+			ctx := context.Background()
+
+			By("Creating a Node in an unmanaged Node Pool")
+			unmanagedNode := corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "gc-unmanaged-node",
+					Labels: map[string]string{
+						"cloud.test.com/test-nodepool": "gc-unmanaged-nodepool",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, &unmanagedNode)).Should(Succeed())
+
+			By("Creating a Node in an idle provisioner-managed Node Pool")
+			idleNode := corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "gc-idle-node",
+					Labels: map[string]string{
+						cloud.LabelNodepoolManager:     cloud.LabelNodepoolManagerTPUPodinator,
+						"cloud.test.com/test-nodepool": "gc-idle-nodepool",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, &idleNode)).Should(Succeed())
+
+			By("Checking that the idle Node Pool was deleted")
+			Eventually(func() bool {
+				return provider.getDeletedPool("gc-idle-nodepool")
+			}, timeout, interval).Should(BeTrue())
+
+			By("Checking that the unmanaged Node Pool was not deleted")
+			Consistently(func() bool {
+				return provider.getDeletedPool("gc-unmanaged-nodepool")
+			}, gcIdleDuration*3, interval).Should(BeFalse())
+		})
+	})
+})
+
+func Test_aboveAutoscalingMin(t *testing.T) {
+	nodes := func(n int, labels map[string]string) []corev1.Node {
+		out := make([]corev1.Node, n)
+		for i := range out {
+			out[i].Labels = labels
+		}
+		return out
+	}
+	autoscaled := map[string]string{cloud.LabelAutoscalingMin: "2"}
+
+	cases := []struct {
+		name  string
+		nodes []corev1.Node
+		exp   bool
+	}{
+		{name: "fixed size", nodes: nodes(4, nil), exp: false},
+		{name: "autoscaled above min", nodes: nodes(4, autoscaled), exp: true},
+		{name: "autoscaled at min", nodes: nodes(2, autoscaled), exp: false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := aboveAutoscalingMin(c.nodes); got != c.exp {
+				t.Fatalf("expected: %v, got: %v", c.exp, got)
+			}
+		})
+	}
+}
+
+func Test_warmNodePool(t *testing.T) {
+	node := func(v string) corev1.Node {
+		return corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{cloud.LabelWarmNodePool: v}}}
+	}
+	if !warmNodePool([]corev1.Node{node(cloud.WarmNodePoolAvailable)}) {
+		t.Fatal("expected nodes of an available warm node pool to be warm")
+	}
+	if warmNodePool([]corev1.Node{node(cloud.WarmNodePoolClaimed)}) {
+		t.Fatal("expected nodes of a claimed warm node pool not to be warm")
+	}
+	if warmNodePool([]corev1.Node{{}}) {
+		t.Fatal("expected nodes of other node pools not to be warm")
+	}
+}
+
+func Test_idleTimeout(t *testing.T) {
+	node := func(labels map[string]string) []corev1.Node {
+		return []corev1.Node{{ObjectMeta: metav1.ObjectMeta{Labels: labels}}}
+	}
+	cases := []struct {
+		name   string
+		labels map[string]string
+		exp    time.Duration
+	}{
+		{name: "default", exp: time.Hour},
+		{name: "own timeout", labels: map[string]string{cloud.LabelIdleTimeout: "2h0m0s"}, exp: 2 * time.Hour},
+		{name: "invalid label", labels: map[string]string{cloud.LabelIdleTimeout: "-5m"}, exp: time.Hour},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := idleTimeout(context.Background(), "np", node(c.labels), time.Hour); got != c.exp {
+				t.Fatalf("expected: %v, got: %v", c.exp, got)
+			}
+		})
+	}
+}
+
+func Test_NodePoolGarbageCollector_collect_busyPods(t *testing.T) {
+	node := func(name, pool string) corev1.Node {
+		return corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{
+			cloud.LabelNodepoolManager:     cloud.LabelNodepoolManagerTPUPodinator,
+			"cloud.test.com/test-nodepool": pool,
+		}}}
+	}
+	pod := func(name, nodeName string, nodeSelector map[string]string) *corev1.Pod {
+		p := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+		p.Spec.NodeName = nodeName
+		p.Spec.NodeSelector = nodeSelector
+		p.Status.Phase = corev1.PodRunning
+		return p
+	}
+	store := newPodStore(
+		// Selects only the accelerator type, the topology was filled in
+		// from the accelerator defaults when its node pool was created.
+		pod("accelerator-only", "busy-node", map[string]string{cloud.GKEAcceleratorNodeSelector: "tpu-v5-lite-podslice"}),
+		pod("cpu", "idle-node", nil),
+	)
+	store.nodes = []corev1.Node{node("busy-node", "busy-pool"), node("idle-node", "idle-pool")}
+	provider := &testProvider{deletedPools: map[string]time.Time{}}
+	tracer := &recordingTracer{}
+	gc := &NodePoolGarbageCollector{
+		Client:       store,
+		Recorder:     record.NewFakeRecorder(10),
+		Provider:     provider,
+		IdleDuration: time.Nanosecond,
+		Tracer:       tracer,
+	}
+
+	// The first pass starts counting the idle time, the second deletes.
+	for i := 0; i < 2; i++ {
+		if err := gc.collect(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if provider.getDeletedPool("busy-pool") {
+		t.Fatal("expected the node pool of the accelerator-only Pod to be kept")
+	}
+	if !provider.getDeletedPool("idle-pool") {
+		t.Fatal("expected the idle node pool to be deleted")
+	}
+	if len(tracer.ended) != 1 || tracer.ended[0].name != "DeleteNodePool" || tracer.ended[0].attrs[spanAttrNodePool] != "idle-pool" {
+		t.Fatalf("expected a DeleteNodePool span for the idle node pool, got: %+v", tracer.ended)
+	}
+}
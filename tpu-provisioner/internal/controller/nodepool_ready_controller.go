@@ -0,0 +1,273 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// NodePoolReadyTracker records the node pools that were ensured for Pods and
+// are waiting for their Nodes to become Ready. It is shared between the
+// CreationReconciler and the NodePoolReadyReconciler. Tracking is in memory,
+// so node pools that were ensured before a restart are not reported.
+type NodePoolReadyTracker struct {
+	mtx     sync.Mutex
+	pending map[string]pendingNodePool
+}
+
+type pendingNodePool struct {
+	pod       types.NamespacedName
+	nodeCount int
+	since     time.Time
+	// unschedulableSince is when the Pod became Unschedulable, zero if
+	// unknown.
+	unschedulableSince time.Time
+}
+
+func (t *NodePoolReadyTracker) track(name string, pod types.NamespacedName, nodeCount int, unschedulableSince time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.pending == nil {
+		t.pending = map[string]pendingNodePool{}
+	}
+	if _, ok := t.pending[name]; ok {
+		// Keep the first Pod and start time.
+		return
+	}
+	t.pending[name] = pendingNodePool{pod: pod, nodeCount: nodeCount, since: time.Now(), unschedulableSince: unschedulableSince}
+}
+
+func (t *NodePoolReadyTracker) get(name string) (pendingNodePool, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	p, ok := t.pending[name]
+	return p, ok
+}
+
+func (t *NodePoolReadyTracker) done(name string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	delete(t.pending, name)
+}
+
+// names returns the names of the tracked node pools.
+func (t *NodePoolReadyTracker) names() []string {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	names := make([]string, 0, len(t.pending))
+	for name := range t.pending {
+		names = append(names, name)
+	}
+	return names
+}
+
+// expire stops tracking the node pools that were tracked for longer than the
+// timeout and returns them by name.
+func (t *NodePoolReadyTracker) expire(now time.Time, timeout time.Duration) map[string]pendingNodePool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	expired := map[string]pendingNodePool{}
+	for name, p := range t.pending {
+		if now.Sub(p.since) >= timeout {
+			expired[name] = p
+			delete(t.pending, name)
+		}
+	}
+	return expired
+}
+
+// DefaultNodePoolReadyCheckInterval is how often the NodePoolReadyReconciler
+// checks the tracked node pools unless CheckInterval is set.
+const DefaultNodePoolReadyCheckInterval = time.Minute
+
+// NodePoolReadyReconciler watches Nodes and reports on the triggering Pod
+// once all Nodes of a node pool ensured for it are Ready. Every
+// CheckInterval it also stops tracking node pools that were deleted, and
+// reports those that are not Ready within the Timeout.
+type NodePoolReadyReconciler struct {
+	client.Client
+	Recorder record.EventRecorder
+	Provider cloud.Provider
+	Tracker  *NodePoolReadyTracker
+
+	// Timeout, if set, is how long a node pool may take to have all of its
+	// Nodes Ready before a NodePoolNotReady event is recorded on the
+	// triggering Pod and it is no longer tracked.
+	Timeout time.Duration
+	// CheckInterval is the time between checks of the tracked node pools,
+	// DefaultNodePoolReadyCheckInterval if not set.
+	CheckInterval time.Duration
+}
+
+func (r *NodePoolReadyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+
+	var node corev1.Node
+	if err := r.Get(ctx, req.NamespacedName, &node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, fmt.Errorf("getting node: %w", err)
+	}
+
+	labelKey := r.Provider.NodePoolLabelKey()
+	nodePoolName, ok := node.GetLabels()[labelKey]
+	if !ok {
+		return ctrl.Result{}, nil
+	}
+	pending, ok := r.Tracker.get(nodePoolName)
+	if !ok {
+		return ctrl.Result{}, nil
+	}
+
+	var nodes corev1.NodeList
+	if err := r.List(ctx, &nodes, client.MatchingLabels{labelKey: nodePoolName}); err != nil {
+		return ctrl.Result{}, fmt.Errorf("listing node pool nodes: %w", err)
+	}
+	var ready int
+	for i := range nodes.Items {
+		if isNodeReady(&nodes.Items[i]) {
+			ready++
+		}
+	}
+	if ready == 0 || ready < pending.nodeCount {
+		lg.V(3).Info("Waiting for node pool nodes to become ready", "nodePool", nodePoolName, "ready", ready, "expected", pending.nodeCount)
+		return ctrl.Result{}, nil
+	}
+
+	r.Tracker.done(nodePoolName)
+	elapsed := time.Since(pending.since)
+	nodePoolReadyDuration.Observe(elapsed.Seconds())
+	if !pending.unschedulableSince.IsZero() {
+		labels := nodes.Items[0].GetLabels()
+		accel := labels[cloud.GKEAcceleratorNodeSelector]
+		if accel == "" {
+			accel = labels[cloud.GKEGPUNodeSelector]
+		}
+		podProvisioningDuration.WithLabelValues(accel, labels[cloud.GKETPUNodeSelector]).Observe(time.Since(pending.unschedulableSince).Seconds())
+	}
+	lg.Info("Node pool ready", "nodePool", nodePoolName, "nodes", ready, "elapsed", elapsed)
+
+	var pod corev1.Pod
+	if err := r.Get(ctx, pending.pod, &pod); err != nil {
+		if apierrors.IsNotFound(err) {
+			lg.V(1).Info("Triggering pod no longer exists, not reporting node pool readiness", "nodePool", nodePoolName, "pod", pending.pod)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, fmt.Errorf("getting pod: %w", err)
+	}
+	r.Recorder.Event(&pod, corev1.EventTypeNormal, EventNodePoolReady, eventMessage(fmt.Sprintf("Node Pool %s is ready after %v.", nodePoolName, elapsed.Round(time.Second)),
+		append(nodeEventFields(&nodes.Items[0], nodePoolName, ready), "elapsedSeconds", strconv.Itoa(int(elapsed.Seconds())))...))
+
+	patch := client.MergeFrom(pod.DeepCopy())
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[cloud.AnnotationNodePoolReady] = time.Now().UTC().Format(time.RFC3339)
+	if err := r.Patch(ctx, &pod, patch); err != nil && !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, fmt.Errorf("annotating pod: %w", err)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// nodePoolReadyCheck runs the periodic check of the NodePoolReadyReconciler.
+// It implements manager.Runnable.
+type nodePoolReadyCheck struct {
+	r *NodePoolReadyReconciler
+}
+
+func (c nodePoolReadyCheck) Start(ctx context.Context) error {
+	interval := c.r.CheckInterval
+	if interval <= 0 {
+		interval = DefaultNodePoolReadyCheckInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			c.r.check(ctx, time.Now())
+		}
+	}
+}
+
+// check stops tracking the node pools that no longer exist, and reports the
+// ones that were not Ready within the Timeout.
+func (r *NodePoolReadyReconciler) check(ctx context.Context, now time.Time) {
+	lg := log.FromContext(ctx).WithName("nodepool-ready")
+
+	names := r.Tracker.names()
+	if len(names) == 0 {
+		return
+	}
+	nps, err := r.Provider.ListNodePools()
+	if err != nil {
+		lg.Error(err, "Failed to list node pools, not checking for deleted node pools")
+	} else {
+		exists := map[string]bool{}
+		for _, np := range nps {
+			exists[np.Name] = true
+		}
+		for _, name := range names {
+			if !exists[name] {
+				lg.V(1).Info("Node pool was deleted before it was ready", "nodePool", name)
+				r.Tracker.done(name)
+			}
+		}
+	}
+
+	if r.Timeout <= 0 {
+		return
+	}
+	for name, pending := range r.Tracker.expire(now, r.Timeout) {
+		nodePoolsNotReady.Inc()
+		lg.Info("Node pool not ready within timeout", "nodePool", name, "timeout", r.Timeout, "pod", pending.pod)
+		var pod corev1.Pod
+		if err := r.Get(ctx, pending.pod, &pod); err != nil {
+			if !apierrors.IsNotFound(err) {
+				lg.Error(err, "Failed to get triggering pod", "nodePool", name, "pod", pending.pod)
+			}
+			continue
+		}
+		r.Recorder.Event(&pod, corev1.EventTypeWarning, EventNodePoolNotReady, eventMessage(fmt.Sprintf("Node Pool %s is not ready after %v.", name, r.Timeout),
+			eventFieldNodePool, name, eventFieldNodeCount, strconv.Itoa(pending.nodeCount)))
+	}
+}
+
+func isNodeReady(n *corev1.Node) bool {
+	for _, c := range n.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *NodePoolReadyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Tracker == nil {
+		return fmt.Errorf("NodePoolReadyReconciler.Tracker must be set")
+	}
+	if err := mgr.Add(nodePoolReadyCheck{r: r}); err != nil {
+		return err
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("nodepool-ready").
+		For(&corev1.Node{}).
+		Complete(r)
+}
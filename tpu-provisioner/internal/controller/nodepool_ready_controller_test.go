@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func Test_NodePoolReadyTracker(t *testing.T) {
+	var tr NodePoolReadyTracker
+	podA := types.NamespacedName{Namespace: "default", Name: "a"}
+	podB := types.NamespacedName{Namespace: "default", Name: "b"}
+
+	if _, ok := tr.get("np"); ok {
+		t.Fatalf("expected untracked node pool")
+	}
+
+	since := time.Now().Add(-time.Minute)
+	tr.track("np", podA, 4, since)
+	tr.track("np", podB, 4, time.Now())
+	p, ok := tr.get("np")
+	if !ok {
+		t.Fatalf("expected tracked node pool")
+	}
+	if p.pod != podA || p.nodeCount != 4 || !p.unschedulableSince.Equal(since) {
+		t.Fatalf("expected first pod to be kept, got: %+v", p)
+	}
+
+	tr.done("np")
+	if _, ok := tr.get("np"); ok {
+		t.Fatalf("expected node pool to no longer be tracked")
+	}
+}
+
+// listingProvider lists the given node pools.
+type listingProvider struct {
+	cloud.Mock
+	nodePools []string
+}
+
+func (p *listingProvider) ListNodePools() ([]cloud.NodePoolInfo, error) {
+	var nps []cloud.NodePoolInfo
+	for _, name := range p.nodePools {
+		nps = append(nps, cloud.NodePoolInfo{Name: name})
+	}
+	return nps, nil
+}
+
+func Test_NodePoolReadyReconciler_check(t *testing.T) {
+	now := time.Now()
+	trigger := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "w-0"}}
+	tr := &NodePoolReadyTracker{}
+	tr.track("deleted", client.ObjectKeyFromObject(trigger), 2, time.Time{})
+	tr.track("slow", client.ObjectKeyFromObject(trigger), 2, time.Time{})
+	tr.track("fresh", client.ObjectKeyFromObject(trigger), 2, time.Time{})
+	for _, name := range []string{"deleted", "slow"} {
+		p := tr.pending[name]
+		p.since = now.Add(-2 * time.Hour)
+		tr.pending[name] = p
+	}
+
+	rec := record.NewFakeRecorder(10)
+	r := &NodePoolReadyReconciler{
+		Client:   newPodStore(trigger),
+		Recorder: rec,
+		Provider: &listingProvider{nodePools: []string{"slow", "fresh"}},
+		Tracker:  tr,
+		Timeout:  time.Hour,
+	}
+	r.check(context.Background(), now)
+
+	if _, ok := tr.get("deleted"); ok {
+		t.Error("expected the deleted node pool to no longer be tracked")
+	}
+	if _, ok := tr.get("slow"); ok {
+		t.Error("expected the node pool that timed out to no longer be tracked")
+	}
+	if _, ok := tr.get("fresh"); !ok {
+		t.Error("expected the node pool within the timeout to still be tracked")
+	}
+	if len(rec.Events) != 1 {
+		t.Fatalf("expected one event, got: %d", len(rec.Events))
+	}
+	if ev := <-rec.Events; !strings.Contains(ev, EventNodePoolNotReady) || !strings.Contains(ev, "nodePool=slow") {
+		t.Fatalf("expected a %s event for the slow node pool, got: %v", EventNodePoolNotReady, ev)
+	}
+
+	// Without a timeout, only deleted node pools are forgotten.
+	r.Timeout = 0
+	r.Provider = &listingProvider{}
+	r.check(context.Background(), now.Add(24*time.Hour))
+	if _, ok := tr.get("fresh"); ok {
+		t.Error("expected the deleted node pool to no longer be tracked")
+	}
+	if len(rec.Events) != 0 {
+		t.Fatalf("expected no events without a timeout, got: %d", len(rec.Events))
+	}
+}
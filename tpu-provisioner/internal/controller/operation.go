@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Defaults for OperationPolling fields that are not set.
+const (
+	defaultOperationPollInterval = 15 * time.Second
+	defaultOperationTimeout      = 30 * time.Minute
+)
+
+// OperationPolling configures how pending node pool operations (see
+// cloud.NodePoolOperation) are polled. The operation of a Pod is tracked in
+// the AnnotationNodePoolOperation and AnnotationNodePoolOperationStarted
+// annotations, so polling resumes after restarts.
+type OperationPolling struct {
+	// Interval is the delay between polls.
+	Interval time.Duration
+	// Timeout is how long to wait for an operation before reporting it as
+	// failed.
+	Timeout time.Duration
+}
+
+func (p OperationPolling) withDefaults() OperationPolling {
+	if p.Interval == 0 {
+		p.Interval = defaultOperationPollInterval
+	}
+	if p.Timeout == 0 {
+		p.Timeout = defaultOperationTimeout
+	}
+	return p
+}
+
+// timedOut returns true if an operation started at the given time should no
+// longer be waited for. Operations with an unknown start time time out
+// immediately.
+func (p OperationPolling) timedOut(started string, now time.Time) bool {
+	t, err := time.Parse(time.RFC3339, started)
+	return err != nil || now.Sub(t) >= p.Timeout
+}
+
+// annotateOperation records the operation on the Pod, and that it is
+// pending if so.
+func (r *CreationReconciler) annotateOperation(ctx context.Context, pod *corev1.Pod, op *cloud.NodePoolOperation) error {
+	patch := client.MergeFrom(pod.DeepCopy())
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[cloud.AnnotationNodePoolOperation] = op.Name
+	if op.Pending {
+		pod.Annotations[cloud.AnnotationNodePoolOperationStarted] = time.Now().UTC().Format(time.RFC3339)
+	}
+	return r.Patch(ctx, pod, patch)
+}
+
+// pollOperation checks the pending node pool operation of the Pod and, once
+// it is done or timed out, reports the result like a synchronous ensure.
+func (r *CreationReconciler) pollOperation(ctx context.Context, pod *corev1.Pod) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+
+	name := pod.Annotations[cloud.AnnotationNodePoolOperation]
+	done, opErr := tracedProvider(ctx, r.Tracer, r.Provider).PollNodePoolOperation(name)
+	ctx, cancel := r.checkpointContext(ctx)
+	defer cancel()
+	if !done {
+		if opErr != nil {
+			lg.Error(opErr, "Failed to poll node pool operation", "operation", name)
+		}
+		if !r.OperationPolling.timedOut(pod.Annotations[cloud.AnnotationNodePoolOperationStarted], time.Now()) {
+			lg.V(3).Info("Node pool operation still running", "operation", name)
+			r.audit(ctx, pod, auditPending, "OperationPending")
+			return ctrl.Result{RequeueAfter: r.OperationPolling.Interval}, nil
+		}
+		opErr = fmt.Errorf("timed out after %v waiting for operation %s", r.OperationPolling.Timeout, name)
+	}
+
+	patch := client.MergeFrom(pod.DeepCopy())
+	delete(pod.Annotations, cloud.AnnotationNodePoolOperationStarted)
+	if err := r.Patch(ctx, pod, patch); err != nil {
+		return ctrl.Result{}, fmt.Errorf("removing pending operation annotation: %w", err)
+	}
+
+	nodePoolName, err := nodePoolNameForPod(r.Provider, pod)
+	if err != nil {
+		lg.Error(err, "Failed to determine node pool name")
+	}
+	fields := append(podEventFields(pod, nodePoolName, cloud.NodePoolRequest{}), eventFieldOperation, name)
+	if opErr != nil {
+		return r.ensureFailed(ctx, pod, nodePoolName, fields, opErr)
+	}
+	lg.Info("Node pool operation done", "operation", name)
+	r.ensured(ctx, pod, nodePoolName, expectedNodeCount(pod, cloud.NodePoolRequest{}), fields)
+	return ctrl.Result{RequeueAfter: r.ProvisioningTimeout.requeueAfter(pod, time.Now())}, nil
+}
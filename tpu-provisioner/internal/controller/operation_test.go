@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_OperationPolling_timedOut(t *testing.T) {
+	p := OperationPolling{}.withDefaults()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		started  string
+		timedOut bool
+	}{
+		{name: "just started", started: now.Format(time.RFC3339)},
+		{name: "before timeout", started: now.Add(-29 * time.Minute).Format(time.RFC3339)},
+		{name: "after timeout", started: now.Add(-31 * time.Minute).Format(time.RFC3339), timedOut: true},
+		{name: "invalid", started: "yesterday", timedOut: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := p.timedOut(c.started, now); got != c.timedOut {
+				t.Fatalf("expected: %v, got: %v", c.timedOut, got)
+			}
+		})
+	}
+}
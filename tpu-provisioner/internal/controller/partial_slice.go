@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Actions taken on partial slices.
+const (
+	// PartialSliceAlert only reports the partial slice.
+	PartialSliceAlert = "alert"
+	// PartialSliceDelete deletes the node pool of the partial slice, so that
+	// its Pods become Unschedulable again and trigger a new node pool.
+	PartialSliceDelete = "delete"
+)
+
+var partialSliceActions = []string{PartialSliceAlert, PartialSliceDelete}
+
+// ValidatePartialSliceAction returns an error if the action is not known.
+func ValidatePartialSliceAction(action string) error {
+	for _, a := range partialSliceActions {
+		if a == action {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown partial slice action %q, must be one of %q", action, partialSliceActions)
+}
+
+// PartialSliceReconciler watches the Nodes of the multi-host TPU node pools
+// that the provisioner created and reports the node pools that have fewer
+// Ready Nodes than their TPU topology requires for longer than the
+// GracePeriod, for example because some of their VMs never registered. The
+// expected size is taken from the topology labels of the Nodes, and the grace
+// period starts when the first Node of the node pool was created. Autoscaled
+// node pools are not checked.
+type PartialSliceReconciler struct {
+	client.Client
+	Recorder  record.EventRecorder
+	Provider  cloud.Provider
+	EventSink *EventSink
+	// Tracer, if set, traces the provider calls that delete node pools.
+	Tracer Tracer
+
+	// GracePeriod is how long a node pool may take to have all of its Nodes
+	// Ready. It must be set.
+	GracePeriod time.Duration
+	// Action is PartialSliceAlert or PartialSliceDelete.
+	Action string
+
+	mtx sync.Mutex
+	// reported holds the creation time of the oldest Node of the node pools
+	// whose partial slice was reported, so that a node pool that is created
+	// again with the same name is reported again.
+	reported map[string]time.Time
+}
+
+// sliceStatus is the state of the Nodes of a multi-host TPU node pool.
+type sliceStatus struct {
+	expected, registered, ready int
+	// since is the creation time of the oldest Node.
+	since time.Time
+}
+
+// partialSliceStatus returns the state of the Nodes of a node pool, and false
+// if they are not a fixed-size multi-host TPU slice.
+func partialSliceStatus(nodes []corev1.Node) (sliceStatus, bool) {
+	if len(nodes) == 0 {
+		return sliceStatus{}, false
+	}
+	labels := nodes[0].GetLabels()
+	if _, autoscaled := labels[cloud.LabelAutoscalingMin]; autoscaled {
+		return sliceStatus{}, false
+	}
+	topo, ok := labels[cloud.GKETPUNodeSelector]
+	if !ok {
+		return sliceStatus{}, false
+	}
+	expected, err := cloud.TPUTopologyToNodeCount(labels[cloud.GKEAcceleratorNodeSelector], topo)
+	if err != nil || expected <= 1 {
+		return sliceStatus{}, false
+	}
+	s := sliceStatus{expected: expected, registered: len(nodes)}
+	for i := range nodes {
+		if isNodeReady(&nodes[i]) {
+			s.ready++
+		}
+		if created := nodes[i].GetCreationTimestamp().Time; s.since.IsZero() || created.Before(s.since) {
+			s.since = created
+		}
+	}
+	return s, true
+}
+
+func (r *PartialSliceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+
+	var node corev1.Node
+	if err := r.Get(ctx, req.NamespacedName, &node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, fmt.Errorf("getting node: %w", err)
+	}
+	if !r.Provider.NodePoolOwner().Owns(node.GetLabels()) {
+		return ctrl.Result{}, nil
+	}
+	labelKey := r.Provider.NodePoolLabelKey()
+	nodePoolName, ok := node.GetLabels()[labelKey]
+	if !ok {
+		return ctrl.Result{}, nil
+	}
+
+	var nodes corev1.NodeList
+	if err := r.List(ctx, &nodes, client.MatchingLabels{labelKey: nodePoolName}); err != nil {
+		return ctrl.Result{}, fmt.Errorf("listing node pool nodes: %w", err)
+	}
+	status, ok := partialSliceStatus(nodes.Items)
+	if !ok {
+		return ctrl.Result{}, nil
+	}
+	if status.ready >= status.expected {
+		r.setReported(nodePoolName, time.Time{})
+		return ctrl.Result{}, nil
+	}
+	if wait := time.Until(status.since.Add(r.GracePeriod)); wait > 0 {
+		lg.V(3).Info("Waiting for slice nodes to become ready", "nodePool", nodePoolName, "ready", status.ready, "expected", status.expected, "wait", wait)
+		return ctrl.Result{RequeueAfter: wait + time.Second}, nil
+	}
+	if r.isReported(nodePoolName, status.since) {
+		return ctrl.Result{}, nil
+	}
+
+	msg := fmt.Sprintf("Node Pool %s has %d of %d Nodes Ready (%d registered) after %v.", nodePoolName, status.ready, status.expected, status.registered, r.GracePeriod)
+	if r.Action == PartialSliceDelete {
+		msg += " Deleting it so that it is created again."
+	}
+	fields := nodeEventFields(&node, nodePoolName, status.expected)
+	lg.Info("Partial slice", "nodePool", nodePoolName, "ready", status.ready, "registered", status.registered, "expected", status.expected, "action", r.Action)
+	r.Recorder.Event(&node, corev1.EventTypeWarning, EventPartialSlice, eventMessage(msg, fields...))
+	r.EventSink.record(&node, corev1.EventTypeWarning, EventPartialSlice, msg, nil, fields...)
+
+	if r.Action == PartialSliceDelete {
+		if err := tracedProvider(ctx, r.Tracer, r.Provider).DeleteNodePool(nodePoolName); err != nil {
+			if errors.Is(err, cloud.ErrNodePoolCreationInProgress) || errors.Is(err, cloud.ErrDuplicateRequest) {
+				return ctrl.Result{RequeueAfter: r.GracePeriod}, nil
+			}
+			return ctrl.Result{}, fmt.Errorf("deleting partial slice node pool %s: %w", nodePoolName, err)
+		}
+	}
+	partialSlices.WithLabelValues(r.Action).Inc()
+	r.setReported(nodePoolName, status.since)
+	return ctrl.Result{}, nil
+}
+
+// isReported returns whether the partial slice of the node pool whose oldest
+// Node was created at since was already reported. Like the
+// NodePoolReadyTracker, this does not survive restarts.
+func (r *PartialSliceReconciler) isReported(nodePoolName string, since time.Time) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	reported, ok := r.reported[nodePoolName]
+	return ok && reported.Equal(since)
+}
+
+// setReported records that the partial slice of the node pool was reported,
+// or forgets it if since is zero.
+func (r *PartialSliceReconciler) setReported(nodePoolName string, since time.Time) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if since.IsZero() {
+		delete(r.reported, nodePoolName)
+		return
+	}
+	if r.reported == nil {
+		r.reported = map[string]time.Time{}
+	}
+	r.reported[nodePoolName] = since
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PartialSliceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.GracePeriod <= 0 {
+		return fmt.Errorf("PartialSliceReconciler.GracePeriod must be set")
+	}
+	if err := ValidatePartialSliceAction(r.Action); err != nil {
+		return err
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("partial-slice").
+		For(&corev1.Node{}).
+		Complete(r)
+}
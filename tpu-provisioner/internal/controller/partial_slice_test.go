@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_partialSliceStatus(t *testing.T) {
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	node := func(topo string, age time.Duration, ready bool, extra map[string]string) corev1.Node {
+		n := corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			CreationTimestamp: metav1.NewTime(created.Add(-age)),
+			Labels: map[string]string{
+				cloud.GKEAcceleratorNodeSelector: "tpu-v4-podslice",
+				cloud.GKETPUNodeSelector:         topo,
+			},
+		}}
+		for k, v := range extra {
+			n.Labels[k] = v
+		}
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		n.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}}
+		return n
+	}
+
+	cases := []struct {
+		name   string
+		nodes  []corev1.Node
+		status sliceStatus
+		ok     bool
+	}{
+		{name: "no nodes"},
+		{name: "single host", nodes: []corev1.Node{node("2x2x1", 0, false, nil)}},
+		{name: "autoscaled", nodes: []corev1.Node{node("2x2x2", 0, false, map[string]string{cloud.LabelAutoscalingMin: "0"})}},
+		{
+			name:   "partial",
+			nodes:  []corev1.Node{node("2x2x4", 0, true, nil), node("2x2x4", time.Minute, false, nil), node("2x2x4", 0, true, nil)},
+			status: sliceStatus{expected: 4, registered: 3, ready: 2, since: created.Add(-time.Minute)},
+			ok:     true,
+		},
+		{
+			name:   "complete",
+			nodes:  []corev1.Node{node("2x2x2", 0, true, nil), node("2x2x2", 0, true, nil)},
+			status: sliceStatus{expected: 2, registered: 2, ready: 2, since: created},
+			ok:     true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			status, ok := partialSliceStatus(c.nodes)
+			if ok != c.ok || status != c.status {
+				t.Fatalf("expected: %+v, %v, got: %+v, %v", c.status, c.ok, status, ok)
+			}
+		})
+	}
+}
+
+func Test_PartialSliceReconciler_reported(t *testing.T) {
+	var r PartialSliceReconciler
+	first := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if r.isReported("np", first) {
+		t.Fatalf("expected node pool to not be reported")
+	}
+	r.setReported("np", first)
+	if !r.isReported("np", first) {
+		t.Fatalf("expected node pool to be reported")
+	}
+	if r.isReported("np", first.Add(time.Hour)) {
+		t.Fatalf("expected a recreated node pool to not be reported")
+	}
+	r.setReported("np", time.Time{})
+	if r.isReported("np", first) {
+		t.Fatalf("expected node pool to be forgotten")
+	}
+}
+
+func Test_ValidatePartialSliceAction(t *testing.T) {
+	for _, a := range []string{PartialSliceAlert, PartialSliceDelete} {
+		if err := ValidatePartialSliceAction(a); err != nil {
+			t.Errorf("%s: unexpected error: %v", a, err)
+		}
+	}
+	if err := ValidatePartialSliceAction("repair"); err == nil {
+		t.Error("expected an error for an unknown action")
+	}
+}
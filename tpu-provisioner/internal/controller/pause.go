@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const defaultPauseRequeueInterval = time.Minute
+
+// PauseSwitch halts node pool creation cluster-wide while the
+// cloud.AnnotationProvisioningPaused annotation of its Namespace is "true",
+// for example during an incident:
+//
+//	kubectl annotate namespace tpu-provisioner-system google.com/tpu-provisioner-paused=true
+//
+// Node pool operations that already started are still polled.
+type PauseSwitch struct {
+	// Namespace is the Namespace whose annotation pauses provisioning,
+	// usually the one the provisioner runs in. Empty disables the switch.
+	Namespace string
+	// RequeueInterval is how often Pods are reconciled while paused, so that
+	// provisioning resumes once the annotation is removed. Zero uses one
+	// minute.
+	RequeueInterval time.Duration
+}
+
+// paused returns whether provisioning is paused. Namespaces are served from
+// the cache, so the switch takes effect without a restart.
+func (s PauseSwitch) paused(ctx context.Context, c client.Reader) (bool, error) {
+	if s.Namespace == "" {
+		return false, nil
+	}
+	var ns corev1.Namespace
+	if err := c.Get(ctx, types.NamespacedName{Name: s.Namespace}, &ns); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return false, fmt.Errorf("getting namespace %s: %w", s.Namespace, err)
+		}
+	}
+	paused := ns.Annotations[cloud.AnnotationProvisioningPaused] == "true"
+	if paused {
+		provisioningPaused.Set(1)
+	} else {
+		provisioningPaused.Set(0)
+	}
+	return paused, nil
+}
+
+func (s PauseSwitch) requeueInterval() time.Duration {
+	if s.RequeueInterval <= 0 {
+		return defaultPauseRequeueInterval
+	}
+	return s.RequeueInterval
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// namespaceReader serves a single Namespace.
+type namespaceReader struct {
+	ns  *corev1.Namespace
+	err error
+}
+
+func (r *namespaceReader) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.ns == nil || r.ns.Name != key.Name {
+		return apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, key.Name)
+	}
+	*obj.(*corev1.Namespace) = *r.ns
+	return nil
+}
+
+func (r *namespaceReader) List(context.Context, client.ObjectList, ...client.ListOption) error {
+	return errors.New("not implemented")
+}
+
+func Test_PauseSwitch_paused(t *testing.T) {
+	ns := &corev1.Namespace{}
+	ns.Name = "tpu-provisioner-system"
+	reader := &namespaceReader{ns: ns}
+	ctx := context.Background()
+
+	if paused, err := (PauseSwitch{}).paused(ctx, reader); err != nil || paused {
+		t.Fatalf("disabled switch: expected not paused, got: %v, %v", paused, err)
+	}
+
+	s := PauseSwitch{Namespace: ns.Name}
+	if paused, err := s.paused(ctx, reader); err != nil || paused {
+		t.Fatalf("without annotation: expected not paused, got: %v, %v", paused, err)
+	}
+
+	ns.Annotations = map[string]string{cloud.AnnotationProvisioningPaused: "true"}
+	if paused, err := s.paused(ctx, reader); err != nil || !paused {
+		t.Fatalf("with annotation: expected paused, got: %v, %v", paused, err)
+	}
+
+	if paused, err := (PauseSwitch{Namespace: "missing"}).paused(ctx, reader); err != nil || paused {
+		t.Fatalf("missing namespace: expected not paused, got: %v, %v", paused, err)
+	}
+
+	reader.err = errors.New("cache not synced")
+	if _, err := s.paused(ctx, reader); err == nil {
+		t.Fatalf("expected error")
+	}
+}
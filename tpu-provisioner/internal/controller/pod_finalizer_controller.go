@@ -0,0 +1,199 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// NodePoolFinalizer is added to Pods that trigger node pool creation when
+// CreationReconciler.NodePoolFinalizer is set. It is removed by the
+// PodFinalizerReconciler once the node pools of the Pod's parent are no
+// longer needed.
+const NodePoolFinalizer = "google.com/tpu-provisioner-node-pool"
+
+// PodFinalizerReconciler deletes the node pools created for a parent (for
+// example a Job) once its last Pod is deleted, so that node pools are not
+// orphaned when a workload is torn down before its Pods are scheduled.
+//
+// Ownership is derived from the parent labels on the node pool's Nodes and
+// from the node pool name of the Pod, not from in-memory state, so Pods that
+// were deleted while the controller was down are handled after a restart.
+type PodFinalizerReconciler struct {
+	client.Client
+	Recorder record.EventRecorder
+	Provider cloud.Provider
+	// Tracer, if set, traces the provider calls that delete node pools.
+	Tracer Tracer
+
+	// parentsMarkedForDeletion holds the time at which each parent was first
+	// found to have no remaining Pods, see nodePoolDeletionCheckInterval.
+	parentsMarkedForDeletion sync.Map
+}
+
+func (r *PodFinalizerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+
+	var pod corev1.Pod
+	if err := r.Get(ctx, req.NamespacedName, &pod); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, fmt.Errorf("getting pod: %w", err)
+	}
+	if pod.DeletionTimestamp == nil || !controllerutil.ContainsFinalizer(&pod, NodePoolFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	if ref := metav1.GetControllerOf(&pod); ref != nil {
+		result, err := r.deleteParentNodePools(ctx, &pod, ref)
+		if err != nil || !result.IsZero() {
+			return result, err
+		}
+	}
+
+	lg.V(1).Info("Removing node pool finalizer from pod")
+	patch := client.MergeFrom(pod.DeepCopy())
+	controllerutil.RemoveFinalizer(&pod, NodePoolFinalizer)
+	if err := r.Patch(ctx, &pod, patch); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	return ctrl.Result{}, nil
+}
+
+// deleteParentNodePools deletes the node pools of the parent of the Pod if
+// the parent has no other remaining Pods. A non-zero result means the caller
+// should requeue before removing the finalizer.
+func (r *PodFinalizerReconciler) deleteParentNodePools(ctx context.Context, pod *corev1.Pod, ref *metav1.OwnerReference) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+	parent := pod.Namespace + "/" + strings.ToLower(ref.Kind) + "/" + strings.ToLower(ref.Name)
+
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(pod.Namespace)); err != nil {
+		return ctrl.Result{}, fmt.Errorf("listing pods: %w", err)
+	}
+	if parentHasPods(pods.Items, ref) {
+		lg.V(1).Info("Parent still has pods, not deleting node pools", "parent", parent)
+		r.parentsMarkedForDeletion.Delete(parent)
+		return ctrl.Result{}, nil
+	}
+
+	// As in the DeletionReconciler, wait before deleting to give a
+	// restarting parent time to recreate its Pods.
+	value, marked := r.parentsMarkedForDeletion.LoadOrStore(parent, time.Now())
+	if !marked {
+		return ctrl.Result{RequeueAfter: nodePoolDeletionCheckInterval}, nil
+	}
+	if wait := nodePoolDeletionCheckInterval - time.Since(value.(time.Time)); wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	names, err := r.parentNodePools(ctx, pod, ref)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	for _, name := range names {
+		lg.Info("Deleting node pool of deleted parent", "nodePool", name, "parent", parent)
+		if err := tracedProvider(ctx, r.Tracer, r.Provider).DeleteNodePool(name); err != nil {
+			var rateLimited *cloud.RateLimitedError
+			switch {
+			case errors.As(err, &rateLimited):
+				return ctrl.Result{RequeueAfter: rateLimited.RetryAfter}, nil
+			case errors.Is(err, cloud.ErrNodePoolNotOwned):
+				// Another node pool took the name that would have
+				// been used for the Pod.
+				lg.Info("Not deleting node pool that was created by someone else", "nodePool", name)
+				continue
+			case errors.Is(err, cloud.ErrDuplicateRequest), errors.Is(err, cloud.ErrNodePoolCreationInProgress):
+				// Wait for the other operation to finish, the delete is
+				// retried and succeeds if the node pool is already gone.
+				lg.Info("Waiting to delete node pool", "nodePool", name, "reason", err.Error())
+				return ctrl.Result{RequeueAfter: nodePoolDeletionCheckInterval}, nil
+			}
+			r.Recorder.Event(pod, corev1.EventTypeWarning, EventFailedDeletingNodePool, eventMessage("Failed to delete Node Pool: "+err.Error(), eventFieldNodePool, name))
+			return ctrl.Result{}, fmt.Errorf("deleting node pool %q: %w", name, err)
+		}
+	}
+	r.parentsMarkedForDeletion.Delete(parent)
+	return ctrl.Result{}, nil
+}
+
+// parentNodePools returns the names of the node pools that were created for
+// the parent of the Pod: those whose Nodes carry the parent labels, and the
+// node pool that would be created for the Pod, which may not have any Nodes
+// yet.
+func (r *PodFinalizerReconciler) parentNodePools(ctx context.Context, pod *corev1.Pod, ref *metav1.OwnerReference) ([]string, error) {
+	names := map[string]bool{}
+
+	owner := r.Provider.NodePoolOwner()
+	var nodes corev1.NodeList
+	if err := r.List(ctx, &nodes, client.MatchingLabels{
+		owner.NodeLabelKey():       owner.Value,
+		cloud.LabelParentKind:      strings.ToLower(ref.Kind),
+		cloud.LabelParentName:      strings.ToLower(ref.Name),
+		cloud.LabelParentNamespace: strings.ToLower(pod.Namespace),
+	}); err != nil {
+		return nil, fmt.Errorf("listing nodes: %w", err)
+	}
+	labelKey := r.Provider.NodePoolLabelKey()
+	for _, n := range nodes.Items {
+		if name, ok := n.Labels[labelKey]; ok {
+			names[name] = true
+		}
+	}
+
+	if name, err := nodePoolNameForPod(r.Provider, pod); err == nil {
+		names[name] = true
+	}
+
+	out := make([]string, 0, len(names))
+	for name := range names {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// parentHasPods returns true if any of the Pods is controlled by the parent
+// and is neither done nor being deleted. Parents are compared by kind and
+// name rather than UID, so that a recreated parent keeps its node pools.
+func parentHasPods(pods []corev1.Pod, ref *metav1.OwnerReference) bool {
+	for i := range pods {
+		p := &pods[i]
+		if p.DeletionTimestamp != nil || isDone(p) {
+			continue
+		}
+		if owner := metav1.GetControllerOf(p); owner != nil && owner.Kind == ref.Kind && owner.Name == ref.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PodFinalizerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	hasFinalizer := predicate.NewPredicateFuncs(func(o client.Object) bool {
+		return controllerutil.ContainsFinalizer(o, NodePoolFinalizer)
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("pod-finalizer").
+		For(&corev1.Pod{}, builder.WithPredicates(hasFinalizer)).
+		Complete(r)
+}
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_parentHasPods(t *testing.T) {
+	isController := true
+	ref := &metav1.OwnerReference{Kind: "Job", Name: "train", UID: "new-uid", Controller: &isController}
+	pod := func(owner string, phase corev1.PodPhase, deleting bool) corev1.Pod {
+		p := corev1.Pod{}
+		p.OwnerReferences = []metav1.OwnerReference{{Kind: "Job", Name: owner, UID: "old-uid", Controller: &isController}}
+		p.Status.Phase = phase
+		if deleting {
+			now := metav1.Now()
+			p.DeletionTimestamp = &now
+		}
+		return p
+	}
+
+	cases := []struct {
+		name string
+		pods []corev1.Pod
+		exp  bool
+	}{
+		{name: "no pods", exp: false},
+		{name: "pending pod of recreated parent", pods: []corev1.Pod{pod("train", corev1.PodPending, false)}, exp: true},
+		{name: "deleting pod", pods: []corev1.Pod{pod("train", corev1.PodRunning, true)}, exp: false},
+		{name: "finished pod", pods: []corev1.Pod{pod("train", corev1.PodSucceeded, false)}, exp: false},
+		{name: "pod of other parent", pods: []corev1.Pod{pod("other", corev1.PodRunning, false)}, exp: false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := parentHasPods(c.pods, ref); got != c.exp {
+				t.Fatalf("expected: %v, got: %v", c.exp, got)
+			}
+		})
+	}
+}
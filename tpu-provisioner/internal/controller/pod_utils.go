@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
 	corev1 "k8s.io/api/core/v1"
 )
 
@@ -23,20 +25,43 @@ func isUnschedulable(p *corev1.Pod) bool {
 	return false
 }
 
-func doesRequestResource(p *corev1.Pod, resource string) bool {
-	for _, c := range p.Spec.Containers {
-		if _, ok := c.Resources.Requests[corev1.ResourceName(resource)]; ok {
-			return true
+// doesRequestResource returns true if any container or init container of the
+// Pod requests any of the resources, or only sets a limit for it (which the
+// request defaults to for extended resources).
+func doesRequestResource(p *corev1.Pod, resources ...string) bool {
+	for _, containers := range [][]corev1.Container{p.Spec.Containers, p.Spec.InitContainers} {
+		for _, c := range containers {
+			for _, resource := range resources {
+				if _, ok := c.Resources.Requests[corev1.ResourceName(resource)]; ok {
+					return true
+				}
+				if _, ok := c.Resources.Limits[corev1.ResourceName(resource)]; ok {
+					return true
+				}
+			}
 		}
 	}
 	return false
 }
 
+// hasNodeSelectors returns true if the Pod requires all of the given node
+// labels, either via its node selector or its required node affinity.
 func hasNodeSelectors(p *corev1.Pod, selectors ...string) bool {
+	nodeSelector := cloud.NodeSelectorForPod(p)
 	for _, key := range selectors {
-		if _, ok := p.Spec.NodeSelector[key]; !ok {
+		if _, ok := nodeSelector[key]; !ok {
 			return false
 		}
 	}
 	return true
 }
+
+func hasAnyNodeSelector(p *corev1.Pod, selectors ...string) bool {
+	nodeSelector := cloud.NodeSelectorForPod(p)
+	for _, key := range selectors {
+		if _, ok := nodeSelector[key]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// priorityWaitingIndex is the field index of the Pods that wait for a node
+// pool, see priorityWaiting. Only those are listed to decide whether a Pod
+// is deferred.
+const priorityWaitingIndex = "priorityWaiting"
+
+// Defaults for PriorityPolicy fields that are not set.
+const (
+	defaultPriorityRequeueInterval = 5 * time.Second
+	defaultPriorityMaxDeferral     = 5 * time.Minute
+)
+
+// PriorityPolicy serves Pods in order of their priority (spec.priority, which
+// is resolved from the PriorityClass of the Pod): node pool creation for a
+// Pod is deferred while Pods with a higher priority are waiting for theirs.
+// Deferral is bounded by MaxDeferral, so low-priority Pods are still served
+// eventually.
+type PriorityPolicy struct {
+	Enabled bool
+	// RequeueInterval is how long a deferred Pod waits before it is
+	// reconciled again.
+	RequeueInterval time.Duration
+	// MaxDeferral is how long after becoming unschedulable a Pod may be
+	// deferred at most.
+	MaxDeferral time.Duration
+}
+
+func (p PriorityPolicy) withDefaults() PriorityPolicy {
+	if p.RequeueInterval == 0 {
+		p.RequeueInterval = defaultPriorityRequeueInterval
+	}
+	if p.MaxDeferral == 0 {
+		p.MaxDeferral = defaultPriorityMaxDeferral
+	}
+	return p
+}
+
+// shouldDefer returns true if node pool creation for the Pod should wait for
+// one of the other Pods, which has a higher priority, has not been served yet
+// and would be served: for which served returns true.
+func (p PriorityPolicy) shouldDefer(pod *corev1.Pod, pods []corev1.Pod, served func(*corev1.Pod) (bool, error), now time.Time) (bool, error) {
+	if !p.Enabled {
+		return false, nil
+	}
+	if since, ok := unschedulableSince(pod); ok && now.Sub(since) >= p.MaxDeferral {
+		return false, nil
+	}
+	priority := podPriority(pod)
+	for i := range pods {
+		other := &pods[i]
+		if podPriority(other) <= priority || other.UID == pod.UID || !priorityWaiting(other) {
+			continue
+		}
+		if ok, err := served(other); err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// priorityWaiting returns true if the Pod is pending and unschedulable and
+// has not been served (or is being served) yet.
+func priorityWaiting(p *corev1.Pod) bool {
+	return isPending(p) && isUnschedulable(p) && !hasProvisioningCondition(p)
+}
+
+// indexPriorityWaiting indexes the Pods for which priorityWaiting returns
+// true under priorityWaitingIndex.
+func indexPriorityWaiting(o client.Object) []string {
+	p, ok := o.(*corev1.Pod)
+	if !ok || !priorityWaiting(p) {
+		return nil
+	}
+	return []string{"true"}
+}
+
+// wouldServe returns true if Reconcile would ensure a node pool for the
+// waiting Pod: it applies the same skip checks (the SkipAnnotation, the
+// Namespace, the criteria, the accelerator allowlist, abandoned and timed out
+// Pods). The PauseSwitch is not checked, while provisioning is paused no Pod
+// gets as far as the priority check.
+func (r *CreationReconciler) wouldServe(ctx context.Context, p *corev1.Pod) (bool, error) {
+	if r.PodCriteria.skipped(p) || !r.PodCriteria.matches(p) {
+		return false, nil
+	}
+	if allowed, err := r.namespaceAllowed(ctx, p.Namespace); err != nil || !allowed {
+		return false, err
+	}
+	if !r.AcceleratorAllowlist.allows(ctx, podAccelerator(p)) {
+		return false, nil
+	}
+	return !r.RetryPolicy.abandoned(p) && !provisioningTimedOut(p), nil
+}
+
+func podPriority(p *corev1.Pod) int32 {
+	if p.Spec.Priority == nil {
+		return 0
+	}
+	return *p.Spec.Priority
+}
+
+func hasProvisioningCondition(p *corev1.Pod) bool {
+	for _, c := range p.Status.Conditions {
+		if c.Type == PodConditionNodePoolProvisioning {
+			return true
+		}
+	}
+	return false
+}
+
+func unschedulableSince(p *corev1.Pod) (time.Time, bool) {
+	for _, c := range p.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse {
+			return c.LastTransitionTime.Time, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,196 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func Test_PriorityPolicy_shouldDefer(t *testing.T) {
+	const tpu = "google.com/tpu"
+	now := time.Now()
+	pod := func(name string, priority int32, unschedulableFor time.Duration) corev1.Pod {
+		p := corev1.Pod{}
+		p.Name = name
+		p.Namespace = "default"
+		p.UID = types.UID(name)
+		p.Spec.Priority = &priority
+		p.Spec.NodeSelector = map[string]string{cloud.GKETPUNodeSelector: "2x2x1"}
+		p.Spec.Containers = []corev1.Container{{
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{tpu: resource.MustParse("4")},
+			},
+		}}
+		p.Status.Phase = corev1.PodPending
+		p.Status.Conditions = []corev1.PodCondition{{
+			Type:               corev1.PodScheduled,
+			Status:             corev1.ConditionFalse,
+			Reason:             corev1.PodReasonUnschedulable,
+			LastTransitionTime: metav1.NewTime(now.Add(-unschedulableFor)),
+		}}
+		return p
+	}
+	served := pod("high-served", 100, time.Minute)
+	served.Status.Conditions = append(served.Status.Conditions, corev1.PodCondition{
+		Type:   PodConditionNodePoolProvisioning,
+		Status: corev1.ConditionTrue,
+		Reason: NodePoolProvisioningEnsuring,
+	})
+
+	policy := PriorityPolicy{Enabled: true}.withDefaults()
+	criteria := PodCriteria{ResourceType: tpu}
+
+	cases := []struct {
+		name   string
+		policy PriorityPolicy
+		pod    corev1.Pod
+		others []corev1.Pod
+		exp    bool
+	}{
+		{
+			name:   "disabled",
+			policy: PriorityPolicy{},
+			pod:    pod("low", 0, time.Minute),
+			others: []corev1.Pod{pod("high", 100, time.Minute)},
+			exp:    false,
+		},
+		{
+			name:   "higher priority waiting",
+			policy: policy,
+			pod:    pod("low", 0, time.Minute),
+			others: []corev1.Pod{pod("low", 0, time.Minute), pod("high", 100, time.Minute)},
+			exp:    true,
+		},
+		{
+			name:   "higher priority already served",
+			policy: policy,
+			pod:    pod("low", 0, time.Minute),
+			others: []corev1.Pod{served},
+			exp:    false,
+		},
+		{
+			name:   "higher priority not served",
+			policy: policy,
+			pod:    pod("low", 0, time.Minute),
+			others: []corev1.Pod{pod("high-skipped", 100, time.Minute)},
+			exp:    false,
+		},
+		{
+			name:   "same priority",
+			policy: policy,
+			pod:    pod("low", 0, time.Minute),
+			others: []corev1.Pod{pod("other", 0, time.Minute)},
+			exp:    false,
+		},
+		{
+			name:   "deferred for too long",
+			policy: policy,
+			pod:    pod("low", 0, time.Hour),
+			others: []corev1.Pod{pod("high", 100, time.Minute)},
+			exp:    false,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			served := func(p *corev1.Pod) (bool, error) { return criteria.matches(p) && p.Name != "high-skipped", nil }
+			got, err := c.policy.shouldDefer(&c.pod, c.others, served, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != c.exp {
+				t.Fatalf("expected: %v, got: %v", c.exp, got)
+			}
+		})
+	}
+}
+
+func Test_CreationReconciler_wouldServe(t *testing.T) {
+	const tpu = "google.com/tpu"
+	pod := func(mutate func(p *corev1.Pod)) *corev1.Pod {
+		p := &corev1.Pod{}
+		p.Name = "high"
+		p.Namespace = "default"
+		p.Spec.NodeSelector = map[string]string{
+			cloud.GKETPUNodeSelector:         "2x2x1",
+			cloud.GKEAcceleratorNodeSelector: cloud.V4PodSliceAccelerator,
+		}
+		p.Spec.Containers = []corev1.Container{{
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{tpu: resource.MustParse("4")},
+			},
+		}}
+		if mutate != nil {
+			mutate(p)
+		}
+		return p
+	}
+	r := &CreationReconciler{
+		PodCriteria:          PodCriteria{ResourceType: tpu, SkipAnnotation: "example.com/skip"},
+		NamespaceFilter:      NamespaceFilter{Allow: []string{"default"}},
+		AcceleratorAllowlist: &AcceleratorAllowlist{Allow: []string{cloud.V4PodSliceAccelerator}},
+		RetryPolicy:          RetryPolicy{MaxPermanentAttempts: 2},
+	}
+
+	cases := []struct {
+		name string
+		pod  *corev1.Pod
+		exp  bool
+	}{
+		{name: "served", pod: pod(nil), exp: true},
+		{name: "skip annotation", pod: pod(func(p *corev1.Pod) {
+			p.Annotations = map[string]string{"example.com/skip": "true"}
+		})},
+		{name: "accelerator not allowed", pod: pod(func(p *corev1.Pod) {
+			p.Spec.NodeSelector[cloud.GKEAcceleratorNodeSelector] = "tpu-v5-lite-podslice"
+		})},
+		{name: "abandoned", pod: pod(func(p *corev1.Pod) {
+			p.Annotations = map[string]string{cloud.AnnotationProvisioningAttempts: "2"}
+		})},
+		{name: "timed out", pod: pod(func(p *corev1.Pod) {
+			p.Annotations = map[string]string{cloud.AnnotationProvisioningTimedOut: "us-central2-b"}
+		})},
+		{name: "no TPU request", pod: pod(func(p *corev1.Pod) {
+			p.Spec.Containers[0].Resources = corev1.ResourceRequirements{}
+		})},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := r.wouldServe(context.Background(), c.pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != c.exp {
+				t.Fatalf("expected: %v, got: %v", c.exp, got)
+			}
+		})
+	}
+}
+
+func Test_indexPriorityWaiting(t *testing.T) {
+	waiting := &corev1.Pod{}
+	waiting.Status.Phase = corev1.PodPending
+	waiting.Status.Conditions = []corev1.PodCondition{{
+		Type:   corev1.PodScheduled,
+		Status: corev1.ConditionFalse,
+		Reason: corev1.PodReasonUnschedulable,
+	}}
+	served := waiting.DeepCopy()
+	served.Status.Conditions = append(served.Status.Conditions, corev1.PodCondition{Type: PodConditionNodePoolProvisioning, Status: corev1.ConditionTrue})
+	running := waiting.DeepCopy()
+	running.Status.Phase = corev1.PodRunning
+
+	if got := indexPriorityWaiting(waiting); len(got) != 1 || got[0] != "true" {
+		t.Fatalf("waiting pod: expected to be indexed, got: %v", got)
+	}
+	for name, p := range map[string]*corev1.Pod{"served": served, "running": running} {
+		if got := indexPriorityWaiting(p); got != nil {
+			t.Fatalf("%s pod: expected not to be indexed, got: %v", name, got)
+		}
+	}
+}
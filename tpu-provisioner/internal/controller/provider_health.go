@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// ProviderHealthCheck periodically lists the node pools of the provider and
+// reports the provisioner as not ready once FailureThreshold consecutive
+// calls failed, so that broken credentials or connectivity are noticed
+// before Pods get stuck. Single failures are tolerated, except for
+// cloud.ErrClusterNotFound, which fails the check right away.
+type ProviderHealthCheck struct {
+	Provider cloud.Provider
+
+	// Interval is the time between calls to the provider.
+	Interval time.Duration
+	// FailureThreshold is the number of consecutive failed calls after
+	// which the check fails.
+	FailureThreshold int
+
+	mu       sync.Mutex
+	failures int
+	lastErr  error
+}
+
+// Start runs the check until the context is cancelled.
+// It implements manager.Runnable.
+func (h *ProviderHealthCheck) Start(ctx context.Context) error {
+	if h.Interval == 0 || h.FailureThreshold == 0 {
+		return fmt.Errorf("ProviderHealthCheck.Interval and FailureThreshold must be set")
+	}
+
+	t := time.NewTicker(h.Interval)
+	defer t.Stop()
+	for {
+		h.probe(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// NeedLeaderElection returns false, every replica reports its own readiness.
+// It implements manager.LeaderElectionRunnable.
+func (h *ProviderHealthCheck) NeedLeaderElection() bool {
+	return false
+}
+
+func (h *ProviderHealthCheck) probe(ctx context.Context) {
+	_, err := h.Provider.ListNodePools()
+	if err != nil {
+		log.FromContext(ctx).Error(err, "provider health check failed")
+	}
+	h.record(err)
+}
+
+func (h *ProviderHealthCheck) record(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil {
+		h.failures = 0
+		h.lastErr = nil
+		return
+	}
+	h.failures++
+	h.lastErr = err
+}
+
+// Check returns an error if the last FailureThreshold calls to the provider
+// failed, or the last one did because the cluster does not exist. It
+// implements healthz.Checker.
+func (h *ProviderHealthCheck) Check(_ *http.Request) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if errors.Is(h.lastErr, cloud.ErrClusterNotFound) {
+		return fmt.Errorf("provider is misconfigured: %w", h.lastErr)
+	}
+	if h.failures < h.FailureThreshold {
+		return nil
+	}
+	return fmt.Errorf("%d consecutive provider calls failed, last error: %w", h.failures, h.lastErr)
+}
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+)
+
+func Test_ProviderHealthCheck_Check(t *testing.T) {
+	h := &ProviderHealthCheck{FailureThreshold: 3}
+	errUnavailable := errors.New("unavailable")
+
+	steps := []struct {
+		err     error
+		healthy bool
+	}{
+		{err: nil, healthy: true},
+		{err: errUnavailable, healthy: true},
+		{err: errUnavailable, healthy: true},
+		{err: errUnavailable, healthy: false},
+		{err: errUnavailable, healthy: false},
+		{err: nil, healthy: true},
+		{err: errUnavailable, healthy: true},
+	}
+
+	for i, s := range steps {
+		h.record(s.err)
+		err := h.Check(nil)
+		if (err == nil) != s.healthy {
+			t.Fatalf("step %d: healthy: expected: %v, got error: %v", i, s.healthy, err)
+		}
+		if err != nil && !errors.Is(err, errUnavailable) {
+			t.Fatalf("step %d: expected last error to be wrapped, got: %v", i, err)
+		}
+	}
+}
+
+func Test_ProviderHealthCheck_Check_clusterNotFound(t *testing.T) {
+	h := &ProviderHealthCheck{FailureThreshold: 3}
+	h.record(fmt.Errorf("%w: my-cluster", cloud.ErrClusterNotFound))
+	if err := h.Check(nil); !errors.Is(err, cloud.ErrClusterNotFound) {
+		t.Fatalf("expected the first failure to fail the check, got: %v", err)
+	}
+	h.record(nil)
+	if err := h.Check(nil); err != nil {
+		t.Fatalf("expected the check to pass again, got: %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 )
@@ -12,15 +13,29 @@ type testProvider struct {
 	sync.Mutex
 	created map[types.NamespacedName]bool
 	deleted map[string]time.Time
+
+	deletedPools map[string]time.Time
 }
 
 func (p *testProvider) NodePoolLabelKey() string { return "cloud.test.com/test-nodepool" }
 
-func (p *testProvider) EnsureNodePoolForPod(pod *corev1.Pod) error {
+func (p *testProvider) NodePoolOwner() cloud.Owner { return cloud.DefaultOwner }
+
+func (p *testProvider) EnsureNodePoolForPod(pod *corev1.Pod, _ cloud.NodePoolRequest) (*cloud.NodePoolOperation, error) {
 	p.Lock()
 	defer p.Unlock()
 	p.created[types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}] = true
-	return nil
+	return nil, nil
+}
+
+func (p *testProvider) PollNodePoolOperation(string) (bool, error) { return true, nil }
+
+func (p *testProvider) NodePoolNameForPod(pod *corev1.Pod) (string, error) {
+	return "test-" + pod.Name, nil
+}
+
+func (p *testProvider) NodePoolTaintsForPod(*corev1.Pod) ([]corev1.Taint, error) {
+	return nil, nil
 }
 
 func (p *testProvider) getCreated(nn types.NamespacedName) bool {
@@ -38,9 +53,29 @@ func (p *testProvider) DeleteNodePoolForNode(node *corev1.Node) error {
 	return nil
 }
 
+func (p *testProvider) DeleteNodePool(name string) error {
+	p.Lock()
+	defer p.Unlock()
+	if _, exists := p.deletedPools[name]; !exists {
+		p.deletedPools[name] = time.Now()
+	}
+	return nil
+}
+
+func (p *testProvider) ListNodePools() ([]cloud.NodePoolInfo, error) {
+	return nil, nil
+}
+
 func (p *testProvider) getDeleted(name string) (time.Time, bool) {
 	p.Lock()
 	defer p.Unlock()
 	timestamp, exists := p.deleted[name]
 	return timestamp, exists
 }
+
+func (p *testProvider) getDeletedPool(name string) bool {
+	p.Lock()
+	defer p.Unlock()
+	_, exists := p.deletedPools[name]
+	return exists
+}
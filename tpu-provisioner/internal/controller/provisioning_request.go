@@ -0,0 +1,312 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Conditions that the ProvisioningRequestReconciler sets on provisioning
+// requests, named like those of Kueue ProvisioningRequests.
+const (
+	// ProvisioningRequestProvisioned is True once the node pool exists.
+	ProvisioningRequestProvisioned = "Provisioned"
+	// ProvisioningRequestFailed is True if the node pool cannot be created
+	// without changing the request or the provisioner configuration.
+	ProvisioningRequestFailed = "Failed"
+)
+
+// DefaultProvisioningRequestGVK is the kind of the provisioning requests of
+// examples/provisioning-request.
+var DefaultProvisioningRequestGVK = schema.GroupVersionKind{Group: "tpu-provisioner.google.com", Version: "v1alpha1", Kind: "ProvisioningRequest"}
+
+//+kubebuilder:rbac:groups=tpu-provisioner.google.com,resources=provisioningrequests,verbs=get;list;watch
+//+kubebuilder:rbac:groups=tpu-provisioner.google.com,resources=provisioningrequests/status,verbs=get;update;patch
+
+// ProvisioningRequestReconciler ensures the node pools declared by
+// provisioning request objects, so that they are created before the Pods that
+// use them exist. The objects are read as unstructured, so any namespaced kind
+// with the status subresource and this schema can be used:
+//
+//	spec:
+//	  accelerator: tpu-v5p-slice # cloud.google.com/gke-tpu-accelerator
+//	  topology: 2x2x4            # cloud.google.com/gke-tpu-topology
+//	  chips: 4                   # TPU chips per Node
+//	  nodeCount: 4               # optional, derived from the topology
+//	  annotations: {}            # optional, Pod annotations such as google.com/tpu-provisioner-spot
+//	status:
+//	  nodePool: tpu-provisioner-0123456789ab
+//	  operation: operation-123   # while the node pool operation is pending
+//	  conditions: []             # Provisioned and Failed
+//
+// The node pool is ensured as for a Pod of the request that is owned by the
+// request object, so it is named after the object's UID.
+type ProvisioningRequestReconciler struct {
+	client.Client
+	Recorder record.EventRecorder
+	Provider cloud.Provider
+
+	// GVK is the kind of the provisioning request objects.
+	GVK schema.GroupVersionKind
+	// TPUResource is the resource that the chips are requested as,
+	// cloud.GoogleTPUResource if empty.
+	TPUResource      string
+	RetryPolicy      RetryPolicy
+	OperationPolling OperationPolling
+}
+
+// provisioningRequestSpec is the spec of a provisioning request.
+type provisioningRequestSpec struct {
+	Accelerator string            `json:"accelerator"`
+	Topology    string            `json:"topology"`
+	Chips       int64             `json:"chips"`
+	NodeCount   int               `json:"nodeCount,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// provisioningRequestStatus is the status of a provisioning request.
+type provisioningRequestStatus struct {
+	NodePool   string             `json:"nodePool,omitempty"`
+	Operation  string             `json:"operation,omitempty"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+func readProvisioningRequestSpec(obj *unstructured.Unstructured) (provisioningRequestSpec, error) {
+	var spec provisioningRequestSpec
+	m, _, err := unstructured.NestedMap(obj.Object, "spec")
+	if err != nil {
+		return spec, fmt.Errorf("reading spec: %w", err)
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, &spec); err != nil {
+		return spec, fmt.Errorf("reading spec: %w", err)
+	}
+	if spec.Accelerator == "" || spec.Topology == "" {
+		return spec, errors.New("spec.accelerator and spec.topology must be set")
+	}
+	if spec.Chips <= 0 {
+		return spec, errors.New("spec.chips must be positive")
+	}
+	if spec.NodeCount < 0 {
+		return spec, errors.New("spec.nodeCount must not be negative")
+	}
+	return spec, nil
+}
+
+func readProvisioningRequestStatus(obj *unstructured.Unstructured) (provisioningRequestStatus, error) {
+	var status provisioningRequestStatus
+	m, _, err := unstructured.NestedMap(obj.Object, "status")
+	if err != nil {
+		return status, fmt.Errorf("reading status: %w", err)
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, &status); err != nil {
+		return status, fmt.Errorf("reading status: %w", err)
+	}
+	return status, nil
+}
+
+// finished returns true if the request was provisioned or failed at its
+// current generation.
+func (s provisioningRequestStatus) finished(generation int64) bool {
+	for _, t := range []string{ProvisioningRequestProvisioned, ProvisioningRequestFailed} {
+		if c := meta.FindStatusCondition(s.Conditions, t); c != nil && c.Status == metav1.ConditionTrue && c.ObservedGeneration == generation {
+			return true
+		}
+	}
+	return false
+}
+
+// provisioningRequestPod returns the Pod that the node pool of the request is
+// ensured for. It is never created.
+func provisioningRequestPod(obj *unstructured.Unstructured, spec provisioningRequestSpec, tpuResource string) *corev1.Pod {
+	isController := true
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        obj.GetName(),
+			Namespace:   obj.GetNamespace(),
+			Annotations: spec.Annotations,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: obj.GetAPIVersion(),
+				Kind:       obj.GetKind(),
+				Name:       obj.GetName(),
+				UID:        obj.GetUID(),
+				Controller: &isController,
+			}},
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{
+				cloud.GKEAcceleratorNodeSelector: spec.Accelerator,
+				cloud.GKETPUNodeSelector:         spec.Topology,
+			},
+			Containers: []corev1.Container{{
+				Name: "tpu",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceName(tpuResource): *resource.NewQuantity(spec.Chips, resource.DecimalSI)},
+				},
+			}},
+		},
+	}
+}
+
+func (r *ProvisioningRequestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(r.GVK)
+	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, fmt.Errorf("getting provisioning request: %w", err)
+	}
+	if obj.GetDeletionTimestamp() != nil {
+		return ctrl.Result{}, nil
+	}
+	status, err := readProvisioningRequestStatus(obj)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if status.finished(obj.GetGeneration()) {
+		return ctrl.Result{}, nil
+	}
+
+	spec, err := readProvisioningRequestSpec(obj)
+	if err != nil {
+		r.Recorder.Event(obj, corev1.EventTypeWarning, EventFailedEnsuringNodePool, "Invalid provisioning request: "+err.Error())
+		r.setCondition(obj, &status, ProvisioningRequestFailed, metav1.ConditionTrue, "InvalidSpec", err.Error())
+		return ctrl.Result{}, r.writeStatus(ctx, obj, status)
+	}
+	tpuResource := r.TPUResource
+	if tpuResource == "" {
+		tpuResource = cloud.GoogleTPUResource
+	}
+	pod := provisioningRequestPod(obj, spec, tpuResource)
+	npReq := cloud.NodePoolRequest{NodeCount: spec.NodeCount, Topology: spec.Topology}
+
+	if status.Operation != "" {
+		done, err := r.Provider.PollNodePoolOperation(status.Operation)
+		if !done {
+			if err != nil {
+				lg.Error(err, "Polling node pool operation", "operation", status.Operation)
+			}
+			return ctrl.Result{RequeueAfter: r.OperationPolling.Interval}, nil
+		}
+		status.Operation = ""
+		if err != nil {
+			return r.ensureFailed(ctx, obj, status, err)
+		}
+		return r.ensured(ctx, obj, status)
+	}
+
+	nodePoolName, err := nodePoolNameForPod(r.Provider, pod)
+	if err != nil {
+		return r.ensureFailed(ctx, obj, status, fmt.Errorf("%w: determining node pool name: %v", cloud.ErrInvalidNodePoolConfig, err))
+	}
+	status.NodePool = nodePoolName
+	lg.Info("Ensuring node pool for provisioning request", "nodePool", nodePoolName, "accelerator", spec.Accelerator, "topology", spec.Topology)
+	r.Recorder.Event(obj, corev1.EventTypeNormal, EventEnsuringNodePool, fmt.Sprintf("Ensuring Node Pool %s.", nodePoolName))
+
+	op, err := r.RetryPolicy.retryNetworkErrors(ctx, func() (*cloud.NodePoolOperation, error) {
+		return r.Provider.EnsureNodePoolForPod(pod, npReq)
+	})
+	if errors.Is(err, cloud.ErrDuplicateRequest) {
+		return r.ensured(ctx, obj, status)
+	}
+	if err != nil {
+		return r.ensureFailed(ctx, obj, status, err)
+	}
+	if op != nil && op.NodePool != "" {
+		status.NodePool = op.NodePool
+	}
+	if op != nil && op.Pending {
+		lg.Info("Waiting for node pool operation", "operation", op.Name, "pollInterval", r.OperationPolling.Interval)
+		status.Operation = op.Name
+		r.setCondition(obj, &status, ProvisioningRequestProvisioned, metav1.ConditionFalse, "OperationPending", fmt.Sprintf("Waiting for operation %s.", op.Name))
+		if err := r.writeStatus(ctx, obj, status); err != nil {
+			// Without the status the operation would not be polled.
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: r.OperationPolling.Interval}, nil
+	}
+	return r.ensured(ctx, obj, status)
+}
+
+func (r *ProvisioningRequestReconciler) ensured(ctx context.Context, obj *unstructured.Unstructured, status provisioningRequestStatus) (ctrl.Result, error) {
+	msg := fmt.Sprintf("Ensured Node Pool %s.", status.NodePool)
+	r.Recorder.Event(obj, corev1.EventTypeNormal, EventNodePoolEnsured, msg)
+	r.setCondition(obj, &status, ProvisioningRequestProvisioned, metav1.ConditionTrue, EventNodePoolEnsured, msg)
+	meta.RemoveStatusCondition(&status.Conditions, ProvisioningRequestFailed)
+	return ctrl.Result{}, r.writeStatus(ctx, obj, status)
+}
+
+// ensureFailed records that ensuring the node pool of the request failed and
+// returns the result determined by the RetryPolicy. Permanent errors fail the
+// request until its spec changes.
+func (r *ProvisioningRequestReconciler) ensureFailed(ctx context.Context, obj *unstructured.Unstructured, status provisioningRequestStatus, err error) (ctrl.Result, error) {
+	category := cloud.ErrorCategory(err)
+	nodePoolCreationErrors.WithLabelValues(category).Inc()
+	log.FromContext(ctx).Error(err, "Failed to ensure node pool for provisioning request", "nodePool", status.NodePool)
+	r.Recorder.Event(obj, corev1.EventTypeWarning, EventFailedEnsuringNodePool, "Failed to ensure Node Pool: "+err.Error())
+
+	msg := truncateError(err)
+	r.setCondition(obj, &status, ProvisioningRequestProvisioned, metav1.ConditionFalse, category, msg)
+	if isPermanentError(err) {
+		r.setCondition(obj, &status, ProvisioningRequestFailed, metav1.ConditionTrue, category, msg)
+	}
+	if err := r.writeStatus(ctx, obj, status); err != nil {
+		return ctrl.Result{}, err
+	}
+	return r.RetryPolicy.resultFor(err)
+}
+
+func (r *ProvisioningRequestReconciler) setCondition(obj *unstructured.Unstructured, status *provisioningRequestStatus, conditionType string, s metav1.ConditionStatus, reason, msg string) {
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             s,
+		ObservedGeneration: obj.GetGeneration(),
+		Reason:             reason,
+		Message:            msg,
+	})
+}
+
+func (r *ProvisioningRequestReconciler) writeStatus(ctx context.Context, obj *unstructured.Unstructured, status provisioningRequestStatus) error {
+	m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return fmt.Errorf("converting provisioning request status: %w", err)
+	}
+	patch := client.MergeFrom(obj.DeepCopy())
+	obj.Object["status"] = m
+	if err := r.Status().Patch(ctx, obj, patch); err != nil {
+		return fmt.Errorf("updating provisioning request status: %w", err)
+	}
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ProvisioningRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.GVK.Empty() {
+		r.GVK = DefaultProvisioningRequestGVK
+	}
+	r.RetryPolicy = r.RetryPolicy.withDefaults()
+	r.OperationPolling = r.OperationPolling.withDefaults()
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(r.GVK)
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("provisioning-request").
+		For(obj).
+		Complete(r)
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func Test_readProvisioningRequestSpec(t *testing.T) {
+	obj := func(spec map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	}
+	cases := []struct {
+		name  string
+		obj   *unstructured.Unstructured
+		spec  provisioningRequestSpec
+		valid bool
+	}{
+		{
+			name:  "valid",
+			obj:   obj(map[string]interface{}{"accelerator": "tpu-v4-podslice", "topology": "2x2x4", "chips": int64(4), "annotations": map[string]interface{}{cloud.AnnotationSpot: "true"}}),
+			spec:  provisioningRequestSpec{Accelerator: "tpu-v4-podslice", Topology: "2x2x4", Chips: 4, Annotations: map[string]string{cloud.AnnotationSpot: "true"}},
+			valid: true,
+		},
+		{name: "no spec", obj: &unstructured.Unstructured{Object: map[string]interface{}{}}},
+		{name: "no topology", obj: obj(map[string]interface{}{"accelerator": "tpu-v4-podslice", "chips": int64(4)})},
+		{name: "no chips", obj: obj(map[string]interface{}{"accelerator": "tpu-v4-podslice", "topology": "2x2x4"})},
+		{name: "wrong type", obj: obj(map[string]interface{}{"accelerator": "tpu-v4-podslice", "topology": "2x2x4", "chips": "four"})},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			spec, err := readProvisioningRequestSpec(c.obj)
+			if !c.valid {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if spec.Accelerator != c.spec.Accelerator || spec.Topology != c.spec.Topology || spec.Chips != c.spec.Chips || spec.Annotations[cloud.AnnotationSpot] != "true" {
+				t.Fatalf("expected: %+v, got: %+v", c.spec, spec)
+			}
+		})
+	}
+}
+
+func Test_provisioningRequestPod(t *testing.T) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(DefaultProvisioningRequestGVK)
+	obj.SetNamespace("default")
+	obj.SetName("train")
+	obj.SetUID("0123456789abcdef")
+	spec := provisioningRequestSpec{Accelerator: "tpu-v4-podslice", Topology: "2x2x4", Chips: 4}
+
+	pod := provisioningRequestPod(obj, spec, cloud.GoogleTPUResource)
+	if err := cloud.ValidateTPUPod(pod); err != nil {
+		t.Fatalf("expected a valid TPU Pod, got: %v", err)
+	}
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil || ref.UID != obj.GetUID() || ref.Kind != "ProvisioningRequest" {
+		t.Fatalf("expected the request to own the Pod, got: %+v", ref)
+	}
+	if got := cloud.NodeSelectorForPod(pod)[cloud.GKETPUNodeSelector]; got != spec.Topology {
+		t.Fatalf("expected the topology node selector, got: %q", got)
+	}
+}
+
+func Test_provisioningRequestStatus(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	obj.SetGeneration(1)
+	r := &ProvisioningRequestReconciler{}
+
+	var status provisioningRequestStatus
+	r.setCondition(obj, &status, ProvisioningRequestProvisioned, metav1.ConditionFalse, "OperationPending", "Waiting.")
+	if status.finished(1) {
+		t.Fatal("expected a pending request to not be finished")
+	}
+	r.setCondition(obj, &status, ProvisioningRequestProvisioned, metav1.ConditionTrue, EventNodePoolEnsured, "Ensured.")
+	if !status.finished(1) || status.finished(2) {
+		t.Fatal("expected the request to only be finished at its generation")
+	}
+
+	status.NodePool = "np"
+	m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	obj.Object["status"] = m
+	got, err := readProvisioningRequestStatus(obj)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.NodePool != "np" || !meta.IsStatusConditionTrue(got.Conditions, ProvisioningRequestProvisioned) {
+		t.Fatalf("expected the status to round-trip, got: %+v", got)
+	}
+}
@@ -0,0 +1,265 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Actions taken when the node pool of a Pod is not Ready within the
+// ProvisioningTimeout.
+const (
+	// ProvisioningTimeoutRetryZone deletes the node pool and creates it
+	// again in another zone of the Pod, see cloud.AnnotationExcludedZones.
+	// Pods whose node pool zone is unknown are handled like
+	// ProvisioningTimeoutDelete.
+	ProvisioningTimeoutRetryZone = "retry-zone"
+	// ProvisioningTimeoutDelete deletes the node pool and abandons the Pod.
+	ProvisioningTimeoutDelete = "delete"
+	// ProvisioningTimeoutAbandon abandons the Pod and leaves the node pool
+	// to the garbage collector.
+	ProvisioningTimeoutAbandon = "abandon"
+)
+
+var provisioningTimeoutActions = []string{ProvisioningTimeoutRetryZone, ProvisioningTimeoutDelete, ProvisioningTimeoutAbandon}
+
+// ProvisioningTimeout bounds how long the node pool of a Pod may take to
+// have Ready Nodes, from the first attempt to ensure it. The start is tracked
+// in the AnnotationProvisioningStarted annotation, so the timeout survives
+// restarts. It covers pending operations, so it should be longer than the
+// OperationPolling timeout for operations to fail with their own error first.
+type ProvisioningTimeout struct {
+	// Timeout is the time that the node pool has to become Ready. Zero
+	// disables the timeout.
+	Timeout time.Duration
+	// Action is one of ProvisioningTimeoutRetryZone,
+	// ProvisioningTimeoutDelete and ProvisioningTimeoutAbandon.
+	Action string
+}
+
+// ValidateProvisioningTimeoutAction returns an error if the action is not
+// known.
+func ValidateProvisioningTimeoutAction(action string) error {
+	for _, a := range provisioningTimeoutActions {
+		if a == action {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown provisioning timeout action %q, must be one of %q", action, provisioningTimeoutActions)
+}
+
+// remaining returns how much longer the node pool of the Pod has to become
+// Ready, and false if the timeout is disabled or provisioning has not started
+// yet. Unparseable start times time out immediately.
+func (t ProvisioningTimeout) remaining(pod *corev1.Pod, now time.Time) (time.Duration, bool) {
+	if t.Timeout <= 0 {
+		return 0, false
+	}
+	v, ok := pod.Annotations[cloud.AnnotationProvisioningStarted]
+	if !ok {
+		return 0, false
+	}
+	started, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0, true
+	}
+	if d := started.Add(t.Timeout).Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// requeueAfter returns when to check the timeout of a Pod whose node pool was
+// ensured, or 0 if there is nothing to check.
+func (t ProvisioningTimeout) requeueAfter(pod *corev1.Pod, now time.Time) time.Duration {
+	if _, ready := pod.Annotations[cloud.AnnotationNodePoolReady]; ready {
+		return 0
+	}
+	d, ok := t.remaining(pod, now)
+	if !ok {
+		return 0
+	}
+	// Requeue right after the deadline rather than on it.
+	return d + time.Second
+}
+
+// markProvisioningStarted records when provisioning started for the Pod,
+// unless it already has.
+func (r *CreationReconciler) markProvisioningStarted(ctx context.Context, pod *corev1.Pod) error {
+	if r.ProvisioningTimeout.Timeout <= 0 {
+		return nil
+	}
+	if _, ok := pod.Annotations[cloud.AnnotationProvisioningStarted]; ok {
+		return nil
+	}
+	return r.annotatePod(ctx, pod, cloud.AnnotationProvisioningStarted, time.Now().UTC().Format(time.RFC3339))
+}
+
+// checkProvisioningTimeout takes the ProvisioningTimeout action if the node
+// pool of the Pod did not become Ready in time, and returns true if it did
+// so and the Pod should not be reconciled further. The node pool is shared by
+// the Pods of a Job or slice, so the action is recorded on all of them: they
+// move to the next zone together, or are all abandoned, whichever of them
+// timed out first.
+func (r *CreationReconciler) checkProvisioningTimeout(ctx context.Context, pod *corev1.Pod) (ctrl.Result, bool, error) {
+	lg := log.FromContext(ctx)
+
+	if _, ready := pod.Annotations[cloud.AnnotationNodePoolReady]; ready {
+		return ctrl.Result{}, false, nil
+	}
+	if left, ok := r.ProvisioningTimeout.remaining(pod, time.Now()); !ok || left > 0 {
+		return ctrl.Result{}, false, nil
+	}
+	nodePoolName, err := nodePoolNameForPod(r.Provider, pod)
+	if err != nil {
+		// Ensuring fails the same way and reports it.
+		return ctrl.Result{}, false, nil
+	}
+	// The NodePoolReadyTracker does not survive restarts, so check the
+	// Nodes before giving up on them.
+	ready, err := r.readyNodes(ctx, nodePoolName)
+	if err != nil {
+		return ctrl.Result{}, false, err
+	}
+	if n := expectedNodeCount(pod, cloud.NodePoolRequest{}); ready > 0 && ready >= n {
+		return ctrl.Result{}, false, nil
+	}
+
+	action := r.ProvisioningTimeout.Action
+	zone := pod.Annotations[cloud.AnnotationNodePoolZone]
+	if action == ProvisioningTimeoutRetryZone && zone == "" {
+		action = ProvisioningTimeoutDelete
+	}
+	if action != ProvisioningTimeoutAbandon {
+		if err := tracedProvider(ctx, r.Tracer, r.Provider).DeleteNodePool(nodePoolName); err != nil && !errors.Is(err, cloud.ErrNodePoolNotOwned) {
+			if errors.Is(err, cloud.ErrNodePoolCreationInProgress) || errors.Is(err, cloud.ErrDuplicateRequest) {
+				lg.V(1).Info("Waiting to delete node pool that timed out", "nodePool", nodePoolName, "error", err.Error())
+				return ctrl.Result{RequeueAfter: r.OperationPolling.Interval}, true, nil
+			}
+			return ctrl.Result{}, true, fmt.Errorf("deleting node pool %s after provisioning timeout: %w", nodePoolName, err)
+		}
+		if r.ReadyTracker != nil {
+			r.ReadyTracker.done(nodePoolName)
+		}
+	}
+
+	provisioningTimeouts.WithLabelValues(action).Inc()
+	fields := podEventFields(pod, nodePoolName, cloud.NodePoolRequest{})
+	var msg string
+	switch action {
+	case ProvisioningTimeoutRetryZone:
+		msg = fmt.Sprintf("Node Pool was not Ready after %v, deleted it to retry outside of zone %s.", r.ProvisioningTimeout.Timeout, zone)
+	case ProvisioningTimeoutDelete:
+		msg = fmt.Sprintf("Node Pool was not Ready after %v, deleted it and abandoned provisioning.", r.ProvisioningTimeout.Timeout)
+	default:
+		msg = fmt.Sprintf("Node Pool was not Ready after %v, abandoned provisioning.", r.ProvisioningTimeout.Timeout)
+	}
+	lg.Info("Node pool provisioning timed out", "nodePool", nodePoolName, "action", action, "zone", zone, "readyNodes", ready)
+	r.Recorder.Event(pod, corev1.EventTypeWarning, EventProvisioningTimeout, eventMessage(msg, fields...))
+	r.EventSink.record(pod, corev1.EventTypeWarning, EventProvisioningTimeout, msg, nil, fields...)
+	r.audit(ctx, pod, auditFailed, EventProvisioningTimeout, auditKeyNodePool, nodePoolName)
+
+	pods, err := r.nodePoolPods(ctx, pod, nodePoolName)
+	if err != nil {
+		return ctrl.Result{}, true, err
+	}
+	timedOut := time.Now().UTC().Format(time.RFC3339)
+	for _, p := range pods {
+		if err := r.recordProvisioningTimeout(ctx, p, action, zone, timedOut); err != nil {
+			return ctrl.Result{}, true, fmt.Errorf("recording provisioning timeout: %w", err)
+		}
+		if action != ProvisioningTimeoutRetryZone {
+			r.updateProvisioningCondition(ctx, p, corev1.ConditionFalse, NodePoolProvisioningFailed, msg)
+		}
+	}
+	if action == ProvisioningTimeoutRetryZone {
+		return ctrl.Result{Requeue: true}, true, nil
+	}
+	return ctrl.Result{}, true, nil
+}
+
+// recordProvisioningTimeout records on the Pod that its node pool timed out
+// in the zone and the action was taken.
+func (r *CreationReconciler) recordProvisioningTimeout(ctx context.Context, pod *corev1.Pod, action, zone, timedOut string) error {
+	patch := client.MergeFrom(pod.DeepCopy())
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	if action == ProvisioningTimeoutRetryZone {
+		pod.Annotations[cloud.AnnotationExcludedZones] = excludeZone(pod.Annotations[cloud.AnnotationExcludedZones], zone)
+		// Start over, whatever operation was pending belonged to the
+		// deleted node pool.
+		delete(pod.Annotations, cloud.AnnotationProvisioningStarted)
+		delete(pod.Annotations, cloud.AnnotationNodePoolZone)
+		delete(pod.Annotations, cloud.AnnotationNodePoolOperation)
+		delete(pod.Annotations, cloud.AnnotationNodePoolOperationStarted)
+	} else {
+		pod.Annotations[cloud.AnnotationProvisioningTimedOut] = timedOut
+	}
+	return r.Patch(ctx, pod, patch)
+}
+
+// excludeZone adds the zone to the comma-separated excluded zones, unless it
+// is excluded already.
+func excludeZone(excluded, zone string) string {
+	if excluded == "" {
+		return zone
+	}
+	for _, z := range strings.Split(excluded, ",") {
+		if strings.TrimSpace(z) == zone {
+			return excluded
+		}
+	}
+	return excluded + "," + zone
+}
+
+// nodePoolPods returns the Pods in the Namespace of the Pod that are not done
+// and share its node pool, starting with the Pod itself.
+func (r *CreationReconciler) nodePoolPods(ctx context.Context, pod *corev1.Pod, nodePoolName string) ([]*corev1.Pod, error) {
+	var list corev1.PodList
+	if err := r.List(ctx, &list, client.InNamespace(pod.Namespace)); err != nil {
+		return nil, fmt.Errorf("listing pods of node pool %s: %w", nodePoolName, err)
+	}
+	pods := []*corev1.Pod{pod}
+	for i := range list.Items {
+		p := &list.Items[i]
+		if p.Name == pod.Name || isDone(p) {
+			continue
+		}
+		if name, err := nodePoolNameForPod(r.Provider, p); err == nil && name == nodePoolName {
+			pods = append(pods, p)
+		}
+	}
+	return pods, nil
+}
+
+// readyNodes returns the number of Ready Nodes of the node pool.
+func (r *CreationReconciler) readyNodes(ctx context.Context, nodePoolName string) (int, error) {
+	var nodes corev1.NodeList
+	if err := r.List(ctx, &nodes, client.MatchingLabels{r.Provider.NodePoolLabelKey(): nodePoolName}); err != nil {
+		return 0, fmt.Errorf("listing node pool nodes: %w", err)
+	}
+	var ready int
+	for i := range nodes.Items {
+		if isNodeReady(&nodes.Items[i]) {
+			ready++
+		}
+	}
+	return ready, nil
+}
+
+// provisioningTimedOut returns true if the Pod was abandoned after its node
+// pool timed out.
+func provisioningTimedOut(pod *corev1.Pod) bool {
+	_, ok := pod.Annotations[cloud.AnnotationProvisioningTimedOut]
+	return ok
+}
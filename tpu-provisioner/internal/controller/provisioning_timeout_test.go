@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func Test_ProvisioningTimeout_remaining(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	pod := func(annotations map[string]string) *corev1.Pod {
+		p := &corev1.Pod{}
+		p.Annotations = annotations
+		return p
+	}
+
+	cases := []struct {
+		name      string
+		timeout   time.Duration
+		pod       *corev1.Pod
+		remaining time.Duration
+		ok        bool
+	}{
+		{name: "disabled", pod: pod(map[string]string{cloud.AnnotationProvisioningStarted: now.Format(time.RFC3339)})},
+		{name: "not started", timeout: time.Hour, pod: pod(nil)},
+		{name: "before timeout", timeout: time.Hour, pod: pod(map[string]string{cloud.AnnotationProvisioningStarted: now.Add(-10 * time.Minute).Format(time.RFC3339)}), remaining: 50 * time.Minute, ok: true},
+		{name: "after timeout", timeout: time.Hour, pod: pod(map[string]string{cloud.AnnotationProvisioningStarted: now.Add(-2 * time.Hour).Format(time.RFC3339)}), ok: true},
+		{name: "invalid", timeout: time.Hour, pod: pod(map[string]string{cloud.AnnotationProvisioningStarted: "yesterday"}), ok: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			remaining, ok := ProvisioningTimeout{Timeout: c.timeout}.remaining(c.pod, now)
+			if remaining != c.remaining || ok != c.ok {
+				t.Fatalf("expected: %v, %v, got: %v, %v", c.remaining, c.ok, remaining, ok)
+			}
+		})
+	}
+}
+
+func Test_ProvisioningTimeout_requeueAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	p := ProvisioningTimeout{Timeout: time.Hour}
+	pod := &corev1.Pod{}
+	pod.Annotations = map[string]string{cloud.AnnotationProvisioningStarted: now.Add(-10 * time.Minute).Format(time.RFC3339)}
+
+	if exp, got := 50*time.Minute+time.Second, p.requeueAfter(pod, now); exp != got {
+		t.Fatalf("expected: %v, got: %v", exp, got)
+	}
+	pod.Annotations[cloud.AnnotationNodePoolReady] = now.Format(time.RFC3339)
+	if got := p.requeueAfter(pod, now); got != 0 {
+		t.Fatalf("expected no requeue once ready, got: %v", got)
+	}
+}
+
+func Test_ValidateProvisioningTimeoutAction(t *testing.T) {
+	for _, a := range []string{ProvisioningTimeoutRetryZone, ProvisioningTimeoutDelete, ProvisioningTimeoutAbandon} {
+		if err := ValidateProvisioningTimeoutAction(a); err != nil {
+			t.Errorf("%s: unexpected error: %v", a, err)
+		}
+	}
+	if err := ValidateProvisioningTimeoutAction("retry"); err == nil {
+		t.Error("expected an error for an unknown action")
+	}
+}
+
+// poolLabelProvider names the node pool of each Pod after its "pool" label
+// and records the node pools it deletes.
+type poolLabelProvider struct {
+	cloud.Mock
+	deleted []string
+}
+
+func (p *poolLabelProvider) NodePoolNameForPod(pod *corev1.Pod) (string, error) {
+	return pod.Labels["pool"], nil
+}
+
+func (p *poolLabelProvider) DeleteNodePool(name string) error {
+	p.deleted = append(p.deleted, name)
+	return nil
+}
+
+func Test_CreationReconciler_checkProvisioningTimeout_siblings(t *testing.T) {
+	now := time.Now()
+	pod := func(name, pool string, started time.Time) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+			Labels:    map[string]string{"pool": pool},
+			Annotations: map[string]string{
+				cloud.AnnotationProvisioningStarted: started.UTC().Format(time.RFC3339),
+				cloud.AnnotationNodePoolZone:        "us-central2-b",
+			},
+		}}
+	}
+	// The sibling started later, for example because it was reconciled
+	// after the first Pod of the slice.
+	first := pod("w-0", "np", now.Add(-2*time.Hour))
+	sibling := pod("w-1", "np", now.Add(-10*time.Minute))
+	sibling.Annotations[cloud.AnnotationExcludedZones] = "us-central2-a"
+	other := pod("x-0", "other", now.Add(-2*time.Hour))
+
+	for _, action := range []string{ProvisioningTimeoutRetryZone, ProvisioningTimeoutDelete} {
+		t.Run(action, func(t *testing.T) {
+			store := newPodStore(first, sibling, other)
+			provider := &poolLabelProvider{}
+			r := &CreationReconciler{
+				Client:              store,
+				Recorder:            record.NewFakeRecorder(10),
+				Provider:            provider,
+				ProvisioningTimeout: ProvisioningTimeout{Timeout: time.Hour, Action: action},
+			}
+			p := store.pods["w-0"].DeepCopy()
+			if _, handled, err := r.checkProvisioningTimeout(context.Background(), p); !handled || err != nil {
+				t.Fatalf("expected the timeout to be handled, got: %v, %v", handled, err)
+			}
+			if len(provider.deleted) != 1 || provider.deleted[0] != "np" {
+				t.Fatalf("expected the shared node pool to be deleted once, got: %v", provider.deleted)
+			}
+
+			for name, exp := range map[string]string{"w-0": "us-central2-b", "w-1": "us-central2-a,us-central2-b"} {
+				a := store.pods[name].Annotations
+				if action == ProvisioningTimeoutRetryZone {
+					if a[cloud.AnnotationExcludedZones] != exp {
+						t.Errorf("%s: expected excluded zones %q, got: %q", name, exp, a[cloud.AnnotationExcludedZones])
+					}
+					if _, ok := a[cloud.AnnotationProvisioningStarted]; ok {
+						t.Errorf("%s: expected the provisioning start to be reset", name)
+					}
+				} else if _, ok := a[cloud.AnnotationProvisioningTimedOut]; !ok {
+					t.Errorf("%s: expected the Pod to be abandoned, got: %v", name, a)
+				}
+			}
+			if a := store.pods["x-0"].Annotations; a[cloud.AnnotationExcludedZones] != "" || a[cloud.AnnotationProvisioningTimedOut] != "" {
+				t.Errorf("expected the Pod of another node pool to be left alone, got: %v", a)
+			}
+		})
+	}
+}
+
+func Test_excludeZone(t *testing.T) {
+	for _, c := range []struct{ excluded, zone, exp string }{
+		{"", "us-central2-b", "us-central2-b"},
+		{"us-central2-a", "us-central2-b", "us-central2-a,us-central2-b"},
+		{"us-central2-a, us-central2-b", "us-central2-b", "us-central2-a, us-central2-b"},
+	} {
+		if got := excludeZone(c.excluded, c.zone); got != c.exp {
+			t.Errorf("excludeZone(%q, %q): expected: %q, got: %q", c.excluded, c.zone, c.exp, got)
+		}
+	}
+}
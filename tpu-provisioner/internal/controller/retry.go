@@ -0,0 +1,286 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Defaults for RetryPolicy fields that are not set.
+const (
+	defaultTransientRetryInterval = 15 * time.Second
+	defaultQuotaRetryInterval     = 5 * time.Minute
+	// defaultStockoutRetryInterval is longer than the transient interval:
+	// capacity rarely frees up within seconds.
+	defaultStockoutRetryInterval = 2 * time.Minute
+	// defaultInProgressRetryInterval gives most conflicting cluster
+	// operations (for example another node pool creation) time to finish.
+	defaultInProgressRetryInterval = 30 * time.Second
+	defaultPermanentRetryInterval  = time.Minute
+	// defaultMisconfiguredRetryInterval is long: nothing succeeds until the
+	// provisioner is reconfigured, which restarts it.
+	defaultMisconfiguredRetryInterval = time.Hour
+
+	// maxPermanentRetryInterval caps the exponential backoff of permanent
+	// errors.
+	maxPermanentRetryInterval = time.Hour
+	// maxLastErrorLength is the length at which the error recorded in the
+	// AnnotationLastProvisioningError annotation is truncated.
+	maxLastErrorLength = 1024
+)
+
+// RetryPolicy determines when a Pod is reconciled again after ensuring its
+// node pool failed, based on the kind of error returned by the provider.
+type RetryPolicy struct {
+	// TransientInterval is the delay before retrying errors that are likely
+	// to go away on their own. Negative values use the workqueue's
+	// exponential backoff instead.
+	TransientInterval time.Duration
+	// QuotaInterval is the delay before retrying after a quota was exceeded.
+	QuotaInterval time.Duration
+	// StockoutInterval is the delay before retrying after the zones of the
+	// node pool were out of capacity.
+	StockoutInterval time.Duration
+	// InProgressInterval is the delay before retrying after the cluster was
+	// running a conflicting operation.
+	InProgressInterval time.Duration
+	// MisconfiguredInterval is the delay before retrying after the
+	// configured cluster was not found.
+	MisconfiguredInterval time.Duration
+
+	// MaxPermanentAttempts, if set, is the number of times that ensuring the
+	// node pool of a Pod may fail with a permanent error before the Pod is
+	// abandoned. The attempts are retried with exponential backoff starting
+	// at PermanentInterval. If unset, permanent errors are not retried until
+	// the Pod changes.
+	MaxPermanentAttempts int
+	PermanentInterval    time.Duration
+
+	// NetworkRetries is the number of times that a call to the provider
+	// failing with cloud.ErrTransient (a DNS, connection or timeout error)
+	// is retried right away, NetworkRetryDelay apart, before the error is
+	// retried like other transient errors. Zero disables the retries.
+	NetworkRetries    int
+	NetworkRetryDelay time.Duration
+
+	// Jitter is the fraction by which retry delays are randomly lengthened
+	// or shortened, so that Pods failing at the same time do not retry in
+	// lockstep. Zero disables jitter.
+	Jitter float64
+}
+
+// jitterRand is the source of the randomness added to retry delays.
+var jitterRand = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// ValidateJitter returns an error if f cannot be used as
+// RetryPolicy.Jitter.
+func ValidateJitter(f float64) error {
+	if f < 0 || f >= 1 {
+		return fmt.Errorf("jitter must be in [0, 1), got %v", f)
+	}
+	return nil
+}
+
+// jitter randomly spreads d by up to Jitter of its length in either
+// direction.
+func (p RetryPolicy) jitter(d time.Duration) time.Duration {
+	if p.Jitter <= 0 || d <= 0 {
+		return d
+	}
+	jitterRand.Lock()
+	f := jitterRand.Float64()
+	jitterRand.Unlock()
+	return d + time.Duration(float64(d)*p.Jitter*(2*f-1))
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.TransientInterval == 0 {
+		p.TransientInterval = defaultTransientRetryInterval
+	}
+	if p.QuotaInterval == 0 {
+		p.QuotaInterval = defaultQuotaRetryInterval
+	}
+	if p.StockoutInterval == 0 {
+		p.StockoutInterval = defaultStockoutRetryInterval
+	}
+	if p.InProgressInterval == 0 {
+		p.InProgressInterval = defaultInProgressRetryInterval
+	}
+	if p.PermanentInterval == 0 {
+		p.PermanentInterval = defaultPermanentRetryInterval
+	}
+	if p.MisconfiguredInterval == 0 {
+		p.MisconfiguredInterval = defaultMisconfiguredRetryInterval
+	}
+	return p
+}
+
+// resultFor returns the result and error that Reconcile should return after
+// the provider failed with err.
+func (p RetryPolicy) resultFor(err error) (ctrl.Result, error) {
+	switch {
+	case isPermanentError(err):
+		// Retrying will not help until the Pod or the cloud configuration
+		// changes, both of which trigger a new reconcile or are surfaced as
+		// events.
+		return ctrl.Result{}, nil
+	case errors.Is(err, cloud.ErrClusterNotFound):
+		// Not a permanent error of the Pod: it must not be abandoned, and
+		// is provisioned once the provisioner is reconfigured.
+		return ctrl.Result{RequeueAfter: p.jitter(p.MisconfiguredInterval)}, nil
+	case errors.Is(err, cloud.ErrTemplateNotFound):
+		// Back off exponentially until the template is created.
+		return ctrl.Result{}, err
+	case errors.Is(err, cloud.ErrQuotaExceeded):
+		// Quota increases take a while, avoid hammering the API.
+		return ctrl.Result{RequeueAfter: p.jitter(p.QuotaInterval)}, nil
+	case errors.Is(err, cloud.ErrZoneStockout):
+		// Capacity frees up on its own, but not right away.
+		return ctrl.Result{RequeueAfter: p.jitter(p.StockoutInterval)}, nil
+	case errors.Is(err, cloud.ErrOperationInProgress):
+		// Retrying right away fails the same way until the operation is done.
+		return ctrl.Result{RequeueAfter: p.jitter(p.InProgressInterval)}, nil
+	case errors.Is(err, cloud.ErrNodePoolLimitReached):
+		return ctrl.Result{Requeue: true}, nil
+	}
+	if p.TransientInterval < 0 {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: p.jitter(p.TransientInterval)}, nil
+}
+
+// retryNetworkErrors calls fn until it does not fail with
+// cloud.ErrTransient, at most NetworkRetries more times, or the context is
+// done.
+func (p RetryPolicy) retryNetworkErrors(ctx context.Context, fn func() (*cloud.NodePoolOperation, error)) (*cloud.NodePoolOperation, error) {
+	op, err := fn()
+	for i := 1; i <= p.NetworkRetries && errors.Is(err, cloud.ErrTransient); i++ {
+		log.FromContext(ctx).Info("Retrying after network error", "attempt", i, "of", p.NetworkRetries, "error", err.Error())
+		select {
+		case <-ctx.Done():
+			return op, err
+		case <-time.After(p.NetworkRetryDelay):
+		}
+		op, err = fn()
+	}
+	return op, err
+}
+
+func isPermanentError(err error) bool {
+	return errors.Is(err, cloud.ErrInvalidNodePoolConfig) ||
+		errors.Is(err, cloud.ErrInvalidTPUConfig) ||
+		errors.Is(err, cloud.ErrReservationUnavailable) ||
+		errors.Is(err, cloud.ErrPlacementPolicyNotFound) ||
+		errors.Is(err, cloud.ErrUnknownNodePoolClass) ||
+		errors.Is(err, cloud.ErrInvalidDiskConfig) ||
+		errors.Is(err, cloud.ErrInvalidNetworkConfig) ||
+		errors.Is(err, cloud.ErrIncompatibleNodeVersion) ||
+		errors.Is(err, cloud.ErrInvalidServiceAccount) ||
+		errors.Is(err, cloud.ErrServiceAccountPermission) ||
+		errors.Is(err, cloud.ErrProjectPermission) ||
+		errors.Is(err, cloud.ErrNodeManagementConflict) ||
+		errors.Is(err, cloud.ErrIncompatibleLocality) ||
+		errors.Is(err, cloud.ErrInvalidImageType) ||
+		errors.Is(err, cloud.ErrInvalidHostVMConfig) ||
+		errors.Is(err, cloud.ErrInvalidSandboxConfig) ||
+		errors.Is(err, cloud.ErrInvalidKubeletConfig) ||
+		errors.Is(err, cloud.ErrInvalidMaxPodsPerNode) ||
+		errors.Is(err, cloud.ErrInvalidResourceManagerTags) ||
+		errors.Is(err, cloud.ErrResourceManagerTagBinding) ||
+		errors.Is(err, cloud.ErrInvalidNetworkInterfaceConfig) ||
+		errors.Is(err, cloud.ErrCreateHookRejected) ||
+		errors.Is(err, cloud.ErrIncompleteTPUSelector) ||
+		errors.Is(err, cloud.ErrUnsatisfiableTopology)
+}
+
+// permanentBackoff returns how long to wait after the given number of failed
+// attempts before ensuring the node pool of a Pod again.
+func (p RetryPolicy) permanentBackoff(attempts int) time.Duration {
+	d := p.PermanentInterval
+	for i := 1; i < attempts && d < maxPermanentRetryInterval; i++ {
+		d *= 2
+	}
+	if d > maxPermanentRetryInterval {
+		d = maxPermanentRetryInterval
+	}
+	return d
+}
+
+// abandoned returns true if the Pod failed permanently too many times for it
+// to be retried.
+func (p RetryPolicy) abandoned(pod *corev1.Pod) bool {
+	return p.MaxPermanentAttempts > 0 && provisioningAttempts(pod) >= p.MaxPermanentAttempts
+}
+
+// permanentRetryWait returns how much longer to wait before retrying a Pod
+// that previously failed with a permanent error, or 0 if it can be retried
+// now.
+func (p RetryPolicy) permanentRetryWait(pod *corev1.Pod, now time.Time) time.Duration {
+	attempts := provisioningAttempts(pod)
+	if p.MaxPermanentAttempts <= 0 || attempts == 0 {
+		return 0
+	}
+	last, err := time.Parse(time.RFC3339, pod.Annotations[cloud.AnnotationLastProvisioningFailure])
+	if err != nil {
+		return 0
+	}
+	if wait := last.Add(p.permanentBackoff(attempts)).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// quotaRetryWait returns how much longer to wait before retrying a Pod whose
+// node pool last failed on an exceeded quota, from its AnnotationLastQuotaFailure
+// annotation, or 0 if it can be retried now. This holds the Pod back for the
+// QuotaInterval however it is queued, for example by a sweep or a restart.
+// The wait is shortened by the Jitter, so that a jittered requeue is never
+// pushed back again.
+func (p RetryPolicy) quotaRetryWait(pod *corev1.Pod, now time.Time) time.Duration {
+	v, ok := pod.Annotations[cloud.AnnotationLastQuotaFailure]
+	if !ok {
+		return 0
+	}
+	last, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0
+	}
+	interval := p.QuotaInterval
+	if p.Jitter > 0 {
+		interval -= time.Duration(float64(interval) * p.Jitter)
+	}
+	if wait := last.Add(interval).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// provisioningAttempts returns the number of permanent failures recorded on
+// the Pod.
+func provisioningAttempts(pod *corev1.Pod) int {
+	n, _ := strconv.Atoi(pod.Annotations[cloud.AnnotationProvisioningAttempts])
+	return n
+}
+
+// truncateError returns the message of err, truncated for use as an
+// annotation value.
+func truncateError(err error) string {
+	msg := err.Error()
+	if len(msg) > maxLastErrorLength {
+		msg = msg[:maxLastErrorLength-3] + "..."
+	}
+	return msg
+}
@@ -0,0 +1,270 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func Test_RetryPolicy_resultFor(t *testing.T) {
+	p := RetryPolicy{TransientInterval: 10 * time.Second, QuotaInterval: 10 * time.Minute, StockoutInterval: 2 * time.Minute, InProgressInterval: time.Minute, MisconfiguredInterval: time.Hour}
+
+	cases := []struct {
+		name   string
+		policy RetryPolicy
+		err    error
+		result ctrl.Result
+		retErr bool
+	}{
+		{
+			name:   "invalid config",
+			policy: p,
+			err:    fmt.Errorf("%w: spot and reservation cannot both be requested", cloud.ErrInvalidNodePoolConfig),
+		},
+		{
+			name:   "invalid tpu config",
+			policy: p,
+			err:    fmt.Errorf("%w: unsupported accelerator", cloud.ErrInvalidTPUConfig),
+		},
+		{
+			name:   "reservation",
+			policy: p,
+			err:    fmt.Errorf("%w: not found", cloud.ErrReservationUnavailable),
+		},
+		{
+			name:   "quota",
+			policy: p,
+			err:    fmt.Errorf("%w: TPUS", cloud.ErrQuotaExceeded),
+			result: ctrl.Result{RequeueAfter: 10 * time.Minute},
+		},
+		{
+			name:   "stockout",
+			policy: p,
+			err:    fmt.Errorf("%w: GCE_STOCKOUT", cloud.ErrZoneStockout),
+			result: ctrl.Result{RequeueAfter: 2 * time.Minute},
+		},
+		{
+			name:   "limit",
+			policy: p,
+			err:    fmt.Errorf("%w: 10 of 10", cloud.ErrNodePoolLimitReached),
+			result: ctrl.Result{Requeue: true},
+		},
+		{
+			name:   "operation in progress",
+			policy: p,
+			err:    &cloud.OperationInProgressError{Operation: "operation-1", Err: errors.New("incompatible operation")},
+			result: ctrl.Result{RequeueAfter: time.Minute},
+		},
+		{
+			name:   "cluster not found",
+			policy: p,
+			err:    fmt.Errorf("%w: my-cluster", cloud.ErrClusterNotFound),
+			result: ctrl.Result{RequeueAfter: time.Hour},
+		},
+		{
+			name:   "template not found",
+			policy: p,
+			err:    fmt.Errorf("%w: golden", cloud.ErrTemplateNotFound),
+			retErr: true,
+		},
+		{
+			name:   "transient",
+			policy: p,
+			err:    errors.New("googleapi: Error 503: backend unavailable"),
+			result: ctrl.Result{RequeueAfter: 10 * time.Second},
+		},
+		{
+			name:   "transient with exponential backoff",
+			policy: RetryPolicy{TransientInterval: -1},
+			err:    errors.New("googleapi: Error 503: backend unavailable"),
+			retErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result, err := c.policy.resultFor(c.err)
+			if result != c.result {
+				t.Fatalf("result: expected: %+v, got: %+v", c.result, result)
+			}
+			if (err != nil) != c.retErr {
+				t.Fatalf("error: expected: %v, got: %v", c.retErr, err)
+			}
+		})
+	}
+}
+
+func Test_RetryPolicy_permanentBackoff(t *testing.T) {
+	p := RetryPolicy{PermanentInterval: time.Minute}
+
+	cases := []struct {
+		attempts int
+		exp      time.Duration
+	}{
+		{attempts: 1, exp: time.Minute},
+		{attempts: 2, exp: 2 * time.Minute},
+		{attempts: 4, exp: 8 * time.Minute},
+		{attempts: 10, exp: maxPermanentRetryInterval},
+		{attempts: 100, exp: maxPermanentRetryInterval},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%d_attempts", c.attempts), func(t *testing.T) {
+			if got := p.permanentBackoff(c.attempts); got != c.exp {
+				t.Fatalf("expected: %v, got: %v", c.exp, got)
+			}
+		})
+	}
+}
+
+func Test_RetryPolicy_jitter(t *testing.T) {
+	if got := (RetryPolicy{}).jitter(time.Minute); got != time.Minute {
+		t.Fatalf("without jitter: expected: %v, got: %v", time.Minute, got)
+	}
+
+	p := RetryPolicy{QuotaInterval: 5 * time.Minute, Jitter: 0.2}
+	min, max := 48*time.Second, 72*time.Second
+	distinct := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		got := p.jitter(time.Minute)
+		if got < min || got > max {
+			t.Fatalf("expected a delay in [%v, %v], got: %v", min, max, got)
+		}
+		distinct[got] = true
+	}
+	if len(distinct) < 2 {
+		t.Fatalf("expected delays to vary, got: %v", distinct)
+	}
+
+	res, err := p.resultFor(fmt.Errorf("%w: TPUS_PER_REGION", cloud.ErrQuotaExceeded))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.RequeueAfter < 4*time.Minute || res.RequeueAfter > 6*time.Minute {
+		t.Fatalf("expected a jittered quota interval, got: %v", res.RequeueAfter)
+	}
+}
+
+func Test_RetryPolicy_retryNetworkErrors(t *testing.T) {
+	transient := fmt.Errorf("%w: dial tcp: lookup container.googleapis.com: no such host", cloud.ErrTransient)
+	quota := fmt.Errorf("%w: TPUS", cloud.ErrQuotaExceeded)
+
+	cases := []struct {
+		name      string
+		errs      []error
+		retries   int
+		expCalls  int
+		expResult error
+	}{
+		{name: "success", errs: []error{nil}, retries: 3, expCalls: 1},
+		{name: "network error then success", errs: []error{transient, transient, nil}, retries: 3, expCalls: 3},
+		{name: "network errors beyond the retries", errs: []error{transient, transient, transient}, retries: 2, expCalls: 3, expResult: cloud.ErrTransient},
+		{name: "retries disabled", errs: []error{transient, nil}, retries: 0, expCalls: 1, expResult: cloud.ErrTransient},
+		{name: "API errors are not retried", errs: []error{quota, nil}, retries: 3, expCalls: 1, expResult: cloud.ErrQuotaExceeded},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := RetryPolicy{NetworkRetries: c.retries, NetworkRetryDelay: time.Millisecond}
+			calls := 0
+			_, err := p.retryNetworkErrors(context.Background(), func() (*cloud.NodePoolOperation, error) {
+				err := c.errs[calls]
+				calls++
+				return nil, err
+			})
+			if calls != c.expCalls {
+				t.Fatalf("calls: expected: %v, got: %v", c.expCalls, calls)
+			}
+			if !errors.Is(err, c.expResult) || (c.expResult == nil && err != nil) {
+				t.Fatalf("expected error %v, got: %v", c.expResult, err)
+			}
+		})
+	}
+}
+
+func Test_ValidateJitter(t *testing.T) {
+	for _, f := range []float64{0, 0.2, 0.99} {
+		if err := ValidateJitter(f); err != nil {
+			t.Errorf("%v: unexpected error: %v", f, err)
+		}
+	}
+	for _, f := range []float64{-0.1, 1, 2} {
+		if err := ValidateJitter(f); err == nil {
+			t.Errorf("%v: expected an error", f)
+		}
+	}
+}
+
+func Test_RetryPolicy_permanentRetryWait(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	p := RetryPolicy{MaxPermanentAttempts: 3, PermanentInterval: time.Minute}
+
+	pod := func(attempts, lastFailure string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+			cloud.AnnotationProvisioningAttempts:    attempts,
+			cloud.AnnotationLastProvisioningFailure: lastFailure,
+		}}}
+	}
+
+	cases := []struct {
+		name      string
+		policy    RetryPolicy
+		pod       *corev1.Pod
+		wait      time.Duration
+		abandoned bool
+	}{
+		{name: "no failures", policy: p, pod: &corev1.Pod{}},
+		{name: "within backoff", policy: p, pod: pod("2", "2024-01-01T11:59:30Z"), wait: 90 * time.Second},
+		{name: "backoff elapsed", policy: p, pod: pod("1", "2024-01-01T11:58:00Z")},
+		{name: "limit reached", policy: p, pod: pod("3", "2024-01-01T11:00:00Z"), abandoned: true},
+		{name: "disabled", policy: RetryPolicy{PermanentInterval: time.Minute}, pod: pod("10", "2024-01-01T11:59:30Z")},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.policy.permanentRetryWait(c.pod, now); got != c.wait {
+				t.Fatalf("wait: expected: %v, got: %v", c.wait, got)
+			}
+			if got := c.policy.abandoned(c.pod); got != c.abandoned {
+				t.Fatalf("abandoned: expected: %v, got: %v", c.abandoned, got)
+			}
+		})
+	}
+}
+
+func Test_RetryPolicy_quotaRetryWait(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	p := RetryPolicy{QuotaInterval: 5 * time.Minute}
+	pod := func(lastFailure string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+			cloud.AnnotationLastQuotaFailure: lastFailure,
+		}}}
+	}
+
+	cases := []struct {
+		name   string
+		policy RetryPolicy
+		pod    *corev1.Pod
+		wait   time.Duration
+	}{
+		{name: "no failure", policy: p, pod: &corev1.Pod{}},
+		{name: "within interval", policy: p, pod: pod("2024-01-01T11:58:00Z"), wait: 3 * time.Minute},
+		{name: "interval elapsed", policy: p, pod: pod("2024-01-01T11:55:00Z")},
+		{name: "shortened by jitter", policy: RetryPolicy{QuotaInterval: 5 * time.Minute, Jitter: 0.2}, pod: pod("2024-01-01T11:58:00Z"), wait: 2 * time.Minute},
+		{name: "unparseable", policy: p, pod: pod("yesterday")},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.policy.quotaRetryWait(c.pod, now); got != c.wait {
+				t.Fatalf("expected: %v, got: %v", c.wait, got)
+			}
+		})
+	}
+}
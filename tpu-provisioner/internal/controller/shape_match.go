@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// auditReasonNoMatchingNodePool is the reason of audit log lines for Pods
+// that trigger node pool creation with StrictShapeMatching before they are
+// Unschedulable.
+const auditReasonNoMatchingNodePool = "NoMatchingNodePool"
+
+// lacksMatchingNodePool returns true if the Pod is not bound to a Node yet
+// and no Node of a node pool created by the owner has the exact TPU
+// accelerator and topology that the Pod selects. It is used by
+// StrictShapeMatching to treat such Pods as triggers before the scheduler
+// marks them Unschedulable.
+//
+// Pods whose node pool was already ensured are not triggers: their node pool
+// may not have Nodes yet, and they are reconciled again by the normal path
+// if they become Unschedulable. Pods without a TPU topology (GPU Pods) are
+// left to the normal path as well.
+func lacksMatchingNodePool(ctx context.Context, c client.Reader, owner cloud.Owner, p *corev1.Pod) (bool, error) {
+	if p.Spec.NodeName != "" || hasPodCondition(p, PodConditionNodePoolProvisioning, NodePoolProvisioningEnsured) {
+		return false, nil
+	}
+	nodeSelector := cloud.NodeSelectorForPod(p)
+	accel, topo := nodeSelector[cloud.GKEAcceleratorNodeSelector], nodeSelector[cloud.GKETPUNodeSelector]
+	if accel == "" || topo == "" {
+		return false, nil
+	}
+	var nodes corev1.NodeList
+	if err := c.List(ctx, &nodes, client.MatchingLabels{
+		owner.NodeLabelKey():             owner.Value,
+		cloud.GKEAcceleratorNodeSelector: accel,
+		cloud.GKETPUNodeSelector:         topo,
+	}, client.Limit(1)); err != nil {
+		return false, fmt.Errorf("listing nodes: %w", err)
+	}
+	return len(nodes.Items) == 0, nil
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// nodeLister serves the Nodes that match the label selector of a List call.
+type nodeLister struct {
+	client.Reader
+	nodes []corev1.Node
+}
+
+func (l *nodeLister) List(_ context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	nl, ok := list.(*corev1.NodeList)
+	if !ok {
+		return errors.New("not implemented")
+	}
+	o := (&client.ListOptions{}).ApplyOptions(opts)
+	for _, n := range l.nodes {
+		if o.LabelSelector == nil || o.LabelSelector.Matches(labels.Set(n.Labels)) {
+			nl.Items = append(nl.Items, n)
+		}
+	}
+	return nil
+}
+
+func Test_lacksMatchingNodePool(t *testing.T) {
+	node := func(accel, topo string) corev1.Node {
+		return corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+			cloud.LabelNodepoolManager:       cloud.LabelNodepoolManagerTPUPodinator,
+			cloud.GKEAcceleratorNodeSelector: accel,
+			cloud.GKETPUNodeSelector:         topo,
+		}}}
+	}
+	pod := func(accel, topo string) *corev1.Pod {
+		p := &corev1.Pod{}
+		p.Spec.NodeSelector = map[string]string{cloud.GKEAcceleratorNodeSelector: accel, cloud.GKETPUNodeSelector: topo}
+		return p
+	}
+	nodes := &nodeLister{nodes: []corev1.Node{node("tpu-v4-podslice", "2x2x2")}}
+
+	cases := []struct {
+		name string
+		pod  *corev1.Pod
+		exp  bool
+	}{
+		{name: "matching pool", pod: pod("tpu-v4-podslice", "2x2x2")},
+		{name: "other topology", pod: pod("tpu-v4-podslice", "2x2x4"), exp: true},
+		{name: "other generation", pod: pod("tpu-v5p-slice", "2x2x2"), exp: true},
+		{
+			name: "bound to a node",
+			pod: func() *corev1.Pod {
+				p := pod("tpu-v5p-slice", "2x2x2")
+				p.Spec.NodeName = "node"
+				return p
+			}(),
+		},
+		{
+			name: "node pool already ensured",
+			pod: func() *corev1.Pod {
+				p := pod("tpu-v5p-slice", "2x2x2")
+				p.Status.Conditions = []corev1.PodCondition{{
+					Type:   PodConditionNodePoolProvisioning,
+					Status: corev1.ConditionTrue,
+					Reason: NodePoolProvisioningEnsured,
+				}}
+				return p
+			}(),
+		},
+		{name: "no topology", pod: &corev1.Pod{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := lacksMatchingNodePool(context.Background(), nodes, cloud.DefaultOwner, c.pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != c.exp {
+				t.Fatalf("expected %v, got: %v", c.exp, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"context"
+	"time"
+)
+
+// shutdownMargin is the part of the Pod's termination grace period that is
+// kept for stopping the manager (releasing the leader election Lease,
+// flushing logs) after the grace period for reconciles ended.
+const shutdownMargin = 5 * time.Second
+
+// BoundedShutdownGracePeriod returns the requested grace period for in-flight
+// reconciles, shortened if needed so that the manager stops before the
+// kubelet kills the container after terminationGracePeriodSeconds.
+// terminationGracePeriodSeconds can be nil if it is not known.
+func BoundedShutdownGracePeriod(requested time.Duration, terminationGracePeriodSeconds *int64) time.Duration {
+	if terminationGracePeriodSeconds == nil {
+		return requested
+	}
+	termination := time.Duration(*terminationGracePeriodSeconds) * time.Second
+	max := termination - shutdownMargin
+	if max <= 0 {
+		max = termination / 2
+	}
+	if requested > max {
+		return max
+	}
+	return requested
+}
+
+// checkpointContext returns the context to persist the result of a provider
+// call to the Pod with. Once the manager is stopping the reconcile context is
+// canceled, but the provider call already happened: the returned context lets
+// the annotations and events be written for up to the ShutdownGracePeriod, so
+// that the operation is not lost after a restart.
+func (r *CreationReconciler) checkpointContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx.Err() == nil || r.ShutdownGracePeriod <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(detachedContext{ctx}, r.ShutdownGracePeriod)
+}
+
+// detachedContext carries the values of its parent but is never canceled.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=create;update
+
+// Stages of outstanding provisioning work, see ShutdownReport.
+const (
+	// OutstandingStagePending is a Pod that waits for its node pool to be
+	// ensured.
+	OutstandingStagePending = "Pending"
+	// OutstandingStageCreating is a node pool whose provider call is in
+	// progress, and a Pod of such a node pool.
+	OutstandingStageCreating = "Creating"
+	// OutstandingStageOperationPending is a node pool whose operation is
+	// being polled, and a Pod of such a node pool.
+	OutstandingStageOperationPending = "OperationPending"
+)
+
+const (
+	// DefaultShutdownReportMaxEntries is the number of Pods and of node
+	// pools in a ShutdownReport unless MaxEntries is set.
+	DefaultShutdownReportMaxEntries = 100
+
+	// shutdownReportTimeout bounds listing the Pods and writing the report.
+	shutdownReportTimeout = 5 * time.Second
+	// shutdownReportKey is the key of the report in the ConfigMap.
+	shutdownReportKey = "report.json"
+)
+
+// OutstandingWork is the provisioning work that the provisioner had not
+// finished when it stopped.
+type OutstandingWork struct {
+	Time      time.Time             `json:"time"`
+	Pods      []OutstandingPod      `json:"pods"`
+	NodePools []OutstandingNodePool `json:"nodePools"`
+	// OmittedPods and OmittedNodePools are the numbers of Pods and node
+	// pools left out to keep the report small.
+	OmittedPods      int `json:"omittedPods,omitempty"`
+	OmittedNodePools int `json:"omittedNodePools,omitempty"`
+}
+
+// OutstandingPod is a Pod whose node pool was not ensured yet.
+type OutstandingPod struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// NodePool is the computed name of the node pool of the Pod, empty if
+	// it could not be determined.
+	NodePool string `json:"nodePool,omitempty"`
+	Stage    string `json:"stage"`
+	// Operation is the node pool operation recorded on the Pod, if any.
+	Operation string `json:"operation,omitempty"`
+}
+
+// OutstandingNodePool is a node pool whose creation had not finished.
+type OutstandingNodePool struct {
+	Name      string `json:"name"`
+	Stage     string `json:"stage"`
+	Operation string `json:"operation,omitempty"`
+}
+
+// ShutdownReport logs the provisioning work that is outstanding when the
+// manager stops: Pods that still wait for their node pool and node pools
+// that are being created. The report can also be written to a file and to a
+// ConfigMap, for the next instance or an operator to check whether a rollout
+// dropped any work. Only the leader reports, standbys have no work.
+type ShutdownReport struct {
+	Client     client.Client
+	Reconciler *CreationReconciler
+
+	// Path, if set, is the file the report is written to as JSON.
+	Path string
+	// ConfigMapNamespace and ConfigMapName, if set, are the ConfigMap the
+	// report is written to, as JSON under the "report.json" key.
+	ConfigMapNamespace string
+	ConfigMapName      string
+	// MaxEntries is the maximum number of Pods and of node pools in the
+	// report, DefaultShutdownReportMaxEntries if not set.
+	MaxEntries int
+	// WaitForInFlight is how long the provider calls that are in flight at
+	// shutdown are waited for before the report is made.
+	WaitForInFlight time.Duration
+}
+
+// Start waits for the context to be cancelled and reports the outstanding
+// work.
+func (s *ShutdownReport) Start(ctx context.Context) error {
+	<-ctx.Done()
+	lg := log.FromContext(ctx).WithName("shutdown-report")
+
+	deadline := time.Now().Add(s.WaitForInFlight)
+	for len(s.Reconciler.flights.inFlight()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	reportCtx, cancel := context.WithTimeout(detachedContext{ctx}, shutdownReportTimeout)
+	defer cancel()
+	work, err := s.Reconciler.outstandingWork(reportCtx, s.maxEntries())
+	if err != nil {
+		lg.Error(err, "Failed to determine outstanding provisioning work")
+		return nil
+	}
+	lg.Info("Outstanding provisioning work at shutdown", "pods", len(work.Pods)+work.OmittedPods, "nodePools", len(work.NodePools)+work.OmittedNodePools)
+	for _, p := range work.Pods {
+		lg.Info("Outstanding pod", "namespace", p.Namespace, "name", p.Name, "nodePool", p.NodePool, "stage", p.Stage, "operation", p.Operation)
+	}
+	for _, np := range work.NodePools {
+		lg.Info("Outstanding node pool", "nodePool", np.Name, "stage", np.Stage, "operation", np.Operation)
+	}
+	if work.OmittedPods > 0 || work.OmittedNodePools > 0 {
+		lg.Info("Outstanding provisioning work omitted from the report", "pods", work.OmittedPods, "nodePools", work.OmittedNodePools)
+	}
+
+	data, err := json.Marshal(work)
+	if err != nil {
+		lg.Error(err, "Failed to encode shutdown report")
+		return nil
+	}
+	if s.Path != "" {
+		if err := os.WriteFile(s.Path, data, 0o644); err != nil {
+			lg.Error(err, "Failed to write shutdown report", "path", s.Path)
+		}
+	}
+	if s.ConfigMapName != "" {
+		if err := s.writeConfigMap(reportCtx, data); err != nil {
+			lg.Error(err, "Failed to write shutdown report", "configMap", s.ConfigMapNamespace+"/"+s.ConfigMapName)
+		}
+	}
+	return nil
+}
+
+// NeedLeaderElection returns true: the report is made after the leader's
+// reconciles had their grace period, while the cache still runs. It
+// implements manager.LeaderElectionRunnable.
+func (s *ShutdownReport) NeedLeaderElection() bool {
+	return true
+}
+
+func (s *ShutdownReport) maxEntries() int {
+	if s.MaxEntries > 0 {
+		return s.MaxEntries
+	}
+	return DefaultShutdownReportMaxEntries
+}
+
+// writeConfigMap replaces the report in the ConfigMap, creating it if needed.
+// The ConfigMap is not read through the cache, which does not watch
+// ConfigMaps.
+func (s *ShutdownReport) writeConfigMap(ctx context.Context, data []byte) error {
+	cm := &corev1.ConfigMap{Data: map[string]string{shutdownReportKey: string(data)}}
+	cm.Namespace, cm.Name = s.ConfigMapNamespace, s.ConfigMapName
+	err := s.Client.Update(ctx, cm)
+	if apierrors.IsNotFound(err) {
+		err = s.Client.Create(ctx, cm)
+	}
+	if err != nil {
+		return fmt.Errorf("writing configmap: %w", err)
+	}
+	return nil
+}
+
+// outstandingWork returns the Pods that trigger node pool creation or whose
+// node pool operation is pending, and the node pools being created, at most
+// max of each. Pods are read from the cache.
+func (r *CreationReconciler) outstandingWork(ctx context.Context, max int) (*OutstandingWork, error) {
+	w := &OutstandingWork{Time: time.Now().UTC(), Pods: []OutstandingPod{}, NodePools: []OutstandingNodePool{}}
+	creating := map[string]bool{}
+	for _, name := range r.flights.inFlight() {
+		creating[name] = true
+		w.NodePools = append(w.NodePools, OutstandingNodePool{Name: name, Stage: OutstandingStageCreating})
+	}
+
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods); err != nil {
+		return nil, fmt.Errorf("listing pods: %w", err)
+	}
+	polling := map[string]bool{}
+	for i := range pods.Items {
+		p := &pods.Items[i]
+		op := p.Annotations[cloud.AnnotationNodePoolOperation]
+		_, pending := p.Annotations[cloud.AnnotationNodePoolOperationStarted]
+		_, reason := auditCriteria(p, r.PodCriteria)
+		trigger := reason == "" && r.NamespaceFilter.allows(p.Namespace)
+		if !pending && !trigger {
+			continue
+		}
+		name, _ := nodePoolNameForPod(r.Provider, p)
+		stage := OutstandingStagePending
+		switch {
+		case creating[name]:
+			stage = OutstandingStageCreating
+		case pending:
+			stage = OutstandingStageOperationPending
+			// The Pods of a slice share the node pool and its operation.
+			if name != "" && !polling[name] {
+				polling[name] = true
+				w.NodePools = append(w.NodePools, OutstandingNodePool{Name: name, Stage: stage, Operation: op})
+			}
+		}
+		w.Pods = append(w.Pods, OutstandingPod{Namespace: p.Namespace, Name: p.Name, NodePool: name, Stage: stage, Operation: op})
+	}
+
+	sort.Slice(w.Pods, func(i, j int) bool {
+		if w.Pods[i].Namespace != w.Pods[j].Namespace {
+			return w.Pods[i].Namespace < w.Pods[j].Namespace
+		}
+		return w.Pods[i].Name < w.Pods[j].Name
+	})
+	sort.Slice(w.NodePools, func(i, j int) bool { return w.NodePools[i].Name < w.NodePools[j].Name })
+	if len(w.Pods) > max {
+		w.OmittedPods = len(w.Pods) - max
+		w.Pods = w.Pods[:max]
+	}
+	if len(w.NodePools) > max {
+		w.OmittedNodePools = len(w.NodePools) - max
+		w.NodePools = w.NodePools[:max]
+	}
+	return w, nil
+}
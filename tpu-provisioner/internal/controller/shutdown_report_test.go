@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func Test_ShutdownReport(t *testing.T) {
+	isController := true
+	pod := func(name string, annotations map[string]string) corev1.Pod {
+		p := corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        name,
+			Annotations: annotations,
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Job", Name: name, UID: types.UID(name + "-0123456789abcdef"), Controller: &isController},
+			},
+		}}
+		p.Status.Phase = corev1.PodPending
+		p.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: corev1.PodReasonUnschedulable}}
+		p.Spec.NodeSelector = map[string]string{
+			cloud.GKETPUNodeSelector:         "2x2x1",
+			cloud.GKEAcceleratorNodeSelector: cloud.V4PodSliceAccelerator,
+		}
+		p.Spec.Containers = []corev1.Container{{Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{cloud.GoogleTPUResource: resource.MustParse("4")},
+		}}}
+		return p
+	}
+	creating, polling, waiting := pod("train-a", nil), pod("train-b", map[string]string{
+		cloud.AnnotationNodePoolOperation:        "operation-1",
+		cloud.AnnotationNodePoolOperationStarted: "2023-01-01T00:00:00Z",
+	}), pod("train-c", nil)
+
+	provider := &cloud.Fake{}
+	r := &CreationReconciler{
+		Client:      &podLister{pods: []corev1.Pod{waiting, polling, creating}},
+		Provider:    provider,
+		PodCriteria: PodCriteria{ResourceType: cloud.GoogleTPUResource},
+	}
+	creatingPool, _ := provider.NodePoolNameForPod(&creating)
+	r.flights.calls = map[string]*ensureCall{creatingPool: {done: make(chan struct{})}}
+
+	w, err := r.outstandingWork(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stages := map[string]string{}
+	for _, p := range w.Pods {
+		stages[p.Name] = p.Stage
+	}
+	exp := map[string]string{"train-a": OutstandingStageCreating, "train-b": OutstandingStageOperationPending, "train-c": OutstandingStagePending}
+	for name, stage := range exp {
+		if stages[name] != stage {
+			t.Fatalf("expected stages: %v, got: %+v", exp, w.Pods)
+		}
+	}
+	if w.Pods[0].Name != "train-a" || w.Pods[0].NodePool != creatingPool {
+		t.Fatalf("expected the Pods sorted with their node pools, got: %+v", w.Pods)
+	}
+	if len(w.NodePools) != 2 || w.OmittedPods != 0 {
+		t.Fatalf("expected the creating and the polled node pool, got: %+v", w)
+	}
+
+	if w, err = r.outstandingWork(context.Background(), 1); err != nil || len(w.Pods) != 1 || w.OmittedPods != 2 || w.OmittedNodePools != 1 {
+		t.Fatalf("expected the report to be bounded, got: %+v, %v", w, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := (&ShutdownReport{Reconciler: r, Path: path}).Start(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading report: %v", err)
+	}
+	var got OutstandingWork
+	if err := json.Unmarshal(data, &got); err != nil || len(got.Pods) != 3 {
+		t.Fatalf("expected the report to be written, got: %s, %v", data, err)
+	}
+}
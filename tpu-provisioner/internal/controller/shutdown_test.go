@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_BoundedShutdownGracePeriod(t *testing.T) {
+	seconds := func(s int64) *int64 { return &s }
+	cases := []struct {
+		name        string
+		requested   time.Duration
+		termination *int64
+		exp         time.Duration
+	}{
+		{name: "unknown termination grace period", requested: time.Minute, exp: time.Minute},
+		{name: "within termination grace period", requested: 30 * time.Second, termination: seconds(60), exp: 30 * time.Second},
+		{name: "exceeds termination grace period", requested: time.Minute, termination: seconds(30), exp: 25 * time.Second},
+		{name: "short termination grace period", requested: time.Minute, termination: seconds(4), exp: 2 * time.Second},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := BoundedShutdownGracePeriod(c.requested, c.termination); got != c.exp {
+				t.Fatalf("expected: %v, got: %v", c.exp, got)
+			}
+		})
+	}
+}
+
+func Test_CreationReconciler_checkpointContext(t *testing.T) {
+	type key struct{}
+	parent, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "value"))
+
+	r := &CreationReconciler{ShutdownGracePeriod: time.Minute}
+	ctx, done := r.checkpointContext(parent)
+	done()
+	if ctx != parent {
+		t.Fatalf("expected the reconcile context while not stopping")
+	}
+
+	cancel()
+	ctx, done = r.checkpointContext(parent)
+	defer done()
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("expected context that is not canceled, got: %v", err)
+	}
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Fatalf("expected deadline within the grace period, got: %v, %v", deadline, ok)
+	}
+	if v := ctx.Value(key{}); v != "value" {
+		t.Fatalf("expected values of the reconcile context, got: %v", v)
+	}
+
+	r.ShutdownGracePeriod = 0
+	if ctx, _ := r.checkpointContext(parent); ctx.Err() == nil {
+		t.Fatalf("expected the canceled reconcile context without a grace period")
+	}
+}
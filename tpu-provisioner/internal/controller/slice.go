@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// sliceKey returns a key identifying the multi-host TPU slice that a Pod
+// belongs to. Pods created for the same Job of a JobSet replicated job share
+// a slice (and therefore a node pool).
+func sliceKey(p *corev1.Pod) (string, bool) {
+	lbls := p.GetLabels()
+	jobSet, ok := lbls[cloud.JobSetNameLabel]
+	if !ok {
+		return "", false
+	}
+	jobIndex, ok := lbls[cloud.JobSetJobIndexLabel]
+	if !ok {
+		return "", false
+	}
+	return p.Namespace + "/" + jobSet + "/" + lbls[cloud.JobSetReplicatedJobLabel] + "/" + jobIndex, true
+}
+
+// sliceTracker collects the pending Pods of each slice so that a single
+// node pool request can be made for the whole slice. Slices that are not in
+// flight are forgotten once none of their Pods was observed for twice the
+// debounce window, for example because the Pods were deleted while they were
+// waiting.
+type sliceTracker struct {
+	mtx    sync.Mutex
+	slices map[string]*sliceState
+	// now is time.Now if nil, for tests.
+	now func() time.Time
+}
+
+type sliceState struct {
+	firstSeen time.Time
+	lastSeen  time.Time
+	pods      map[string]struct{}
+	inFlight  bool
+}
+
+// observe records a pending Pod for the given slice. It returns dispatch=true
+// for exactly one caller once either all expected Pods have been observed or
+// the debounce window has elapsed. Otherwise, if the slice is still being
+// collected, wait is the time remaining in the debounce window.
+func (t *sliceTracker) observe(key, pod string, expected int, window time.Duration) (dispatch bool, wait time.Duration) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	now := t.clock()
+	t.prune(now, window)
+	if t.slices == nil {
+		t.slices = map[string]*sliceState{}
+	}
+	s, ok := t.slices[key]
+	if !ok {
+		s = &sliceState{firstSeen: now, pods: map[string]struct{}{}}
+		t.slices[key] = s
+	}
+	s.pods[pod] = struct{}{}
+	s.lastSeen = now
+
+	if s.inFlight {
+		return false, 0
+	}
+	if len(s.pods) < expected {
+		if since := now.Sub(s.firstSeen); since < window {
+			return false, window - since
+		}
+	}
+
+	s.inFlight = true
+	return true, 0
+}
+
+// done forgets the slice after a node pool request for it has completed
+// (successfully or not), allowing future requests to be made.
+func (t *sliceTracker) done(key string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	delete(t.slices, key)
+}
+
+// prune forgets the slices that are not in flight and none of whose Pods was
+// observed within twice the window. Waiting Pods are requeued when the window
+// ends, so only slices whose Pods are gone are forgotten. t.mtx must be held.
+func (t *sliceTracker) prune(now time.Time, window time.Duration) {
+	for key, s := range t.slices {
+		if !s.inFlight && now.Sub(s.lastSeen) >= 2*window {
+			delete(t.slices, key)
+		}
+	}
+}
+
+func (t *sliceTracker) clock() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultSliceAggregationTTL is how long a slice is tracked after its last
+// transition unless SliceAggregator.TTL is set.
+const DefaultSliceAggregationTTL = time.Hour
+
+// Results of the slice_provisioning_duration_seconds metric.
+const (
+	sliceResultEnsured = "ensured"
+	sliceResultExpired = "expired"
+)
+
+// SliceAggregator collapses the node pool events of the Pods of a multi-host
+// slice (identified by sliceKey, like for slice batching) into one event per
+// slice transition: only the first Pod that reports a new event reason gets
+// the event, with the slice and the number of its Pods seen so far, and the
+// slice_* metrics are recorded once per slice instead of once per Pod.
+//
+// Pods can be reconciled in any order. An EnsuringNodePool reported by a Pod
+// that is only seen after its slice's node pool was ensured is not a
+// transition. Slices are forgotten TTL after their last transition, so that
+// slices that never get all of their Pods, or whose node pool is never
+// ensured, are counted as expired rather than tracked forever.
+type SliceAggregator struct {
+	// TTL is how long a slice is tracked after its last transition,
+	// DefaultSliceAggregationTTL if not set.
+	TTL time.Duration
+
+	mtx sync.Mutex
+	// slices are the tracked slices by key, guarded by mtx.
+	slices map[string]*aggregatedSlice
+	now    func() time.Time
+}
+
+type aggregatedSlice struct {
+	// since is when the slice started provisioning: when its first Pod was
+	// seen, or when it failed again after its node pool was ensured.
+	since          time.Time
+	lastTransition time.Time
+	reason         string
+	// ensured is true while the last transition is EventNodePoolEnsured.
+	ensured bool
+	pods    map[string]struct{}
+}
+
+// transition records that the Pod reports an event of the reason. It returns
+// true if the event should be recorded for the Pod, with the fields extended
+// by the slice and its number of Pods: always if the aggregator is nil or the
+// Pod does not belong to a slice, otherwise only for the transitions of the
+// slice.
+func (a *SliceAggregator) transition(p *corev1.Pod, reason string, fields []string) (bool, []string) {
+	if a == nil {
+		return true, fields
+	}
+	key, ok := sliceKey(p)
+	if !ok {
+		return true, fields
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	now := a.clock()
+	a.prune(now)
+	if a.slices == nil {
+		a.slices = map[string]*aggregatedSlice{}
+	}
+	s, ok := a.slices[key]
+	if !ok {
+		// A slice that is first seen ensured, for example after a restart,
+		// was not seen provisioning.
+		s = &aggregatedSlice{since: now, ensured: reason == EventNodePoolEnsured, pods: map[string]struct{}{}}
+		a.slices[key] = s
+		if !s.ensured {
+			slicesProvisioning.Inc()
+		}
+	}
+	s.pods[p.Name] = struct{}{}
+
+	if reason == s.reason || (reason == EventEnsuringNodePool && s.ensured) {
+		return false, fields
+	}
+	switch {
+	case reason == EventNodePoolEnsured && !s.ensured:
+		s.ensured = true
+		slicesProvisioning.Dec()
+		sliceProvisioningDuration.WithLabelValues(sliceResultEnsured).Observe(now.Sub(s.since).Seconds())
+	case reason != EventNodePoolEnsured && s.ensured:
+		// Provisioning the slice failed again, for example while its node
+		// pool was recreated.
+		s.ensured = false
+		s.since = now
+		slicesProvisioning.Inc()
+	}
+	s.reason, s.lastTransition = reason, now
+	sliceTransitions.WithLabelValues(reason).Inc()
+	return true, append(fields, eventFieldSlice, key, eventFieldSlicePods, strconv.Itoa(len(s.pods)))
+}
+
+// prune forgets the slices whose last transition is older than the TTL. a.mtx
+// must be held.
+func (a *SliceAggregator) prune(now time.Time) {
+	ttl := a.TTL
+	if ttl <= 0 {
+		ttl = DefaultSliceAggregationTTL
+	}
+	for key, s := range a.slices {
+		if now.Sub(s.lastTransition) < ttl {
+			continue
+		}
+		if !s.ensured {
+			slicesProvisioning.Dec()
+			sliceProvisioningDuration.WithLabelValues(sliceResultExpired).Observe(now.Sub(s.since).Seconds())
+		}
+		delete(a.slices, key)
+	}
+}
+
+func (a *SliceAggregator) clock() time.Time {
+	if a.now != nil {
+		return a.now()
+	}
+	return time.Now()
+}
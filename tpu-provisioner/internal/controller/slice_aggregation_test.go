@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSliceAggregator(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	a := &SliceAggregator{TTL: time.Hour, now: func() time.Time { return now }}
+	expect := func(p *corev1.Pod, reason string, report bool, pods string) {
+		t.Helper()
+		got, fields := a.transition(p, reason, []string{eventFieldNodePool, "np"})
+		if got != report {
+			t.Fatalf("%s/%s: expected report: %v, got: %v", p.Name, reason, report, got)
+		}
+		if report && eventField(fields, eventFieldSlicePods) != pods {
+			t.Fatalf("%s/%s: expected %s pods, got fields: %v", p.Name, reason, pods, fields)
+		}
+	}
+
+	expect(jobSetPod("w-0", "0"), EventEnsuringNodePool, true, "1")
+	expect(jobSetPod("w-1", "0"), EventEnsuringNodePool, false, "")
+	expect(jobSetPod("w-1", "0"), EventQuotaExceeded, true, "2")
+	expect(jobSetPod("w-0", "0"), EventQuotaExceeded, false, "")
+	expect(jobSetPod("w-0", "0"), EventNodePoolEnsured, true, "2")
+	// A Pod that is reconciled after the node pool was ensured.
+	expect(jobSetPod("w-2", "0"), EventEnsuringNodePool, false, "")
+	expect(jobSetPod("w-2", "0"), EventNodePoolEnsured, false, "")
+
+	// Other slices and Pods outside of slices are not aggregated.
+	expect(jobSetPod("w-3", "1"), EventEnsuringNodePool, true, "1")
+	if report, fields := a.transition(&corev1.Pod{}, EventEnsuringNodePool, nil); !report || len(fields) != 0 {
+		t.Fatalf("expected a Pod outside of a slice to be reported as is, got: %v, %v", report, fields)
+	}
+
+	// A slice that is not ensured expires.
+	now = now.Add(time.Hour)
+	a.transition(jobSetPod("w-4", "2"), EventEnsuringNodePool, nil)
+	if len(a.slices) != 1 {
+		t.Fatalf("expected the old slices to be forgotten, got: %v", a.slices)
+	}
+	expect(jobSetPod("w-0", "0"), EventEnsuringNodePool, true, "1")
+
+	var nilAggregator *SliceAggregator
+	if report, _ := nilAggregator.transition(jobSetPod("w-0", "0"), EventEnsuringNodePool, nil); !report {
+		t.Fatal("expected a nil aggregator to report every event")
+	}
+}
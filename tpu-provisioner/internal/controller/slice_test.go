@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_sliceTracker(t *testing.T) {
+	var tr sliceTracker
+
+	dispatch, wait := tr.observe("ns/js/rj/0", "pod-a", 2, time.Minute)
+	if dispatch || wait <= 0 {
+		t.Fatalf("first pod of slice: expected wait, got dispatch=%v wait=%v", dispatch, wait)
+	}
+
+	dispatch, _ = tr.observe("ns/js/rj/0", "pod-b", 2, time.Minute)
+	if !dispatch {
+		t.Fatalf("full slice: expected dispatch")
+	}
+
+	dispatch, wait = tr.observe("ns/js/rj/0", "pod-a", 2, time.Minute)
+	if dispatch || wait != 0 {
+		t.Fatalf("in-flight slice: expected no dispatch and no wait, got dispatch=%v wait=%v", dispatch, wait)
+	}
+
+	tr.done("ns/js/rj/0")
+
+	dispatch, _ = tr.observe("ns/js/rj/1", "pod-c", 2, 0)
+	if !dispatch {
+		t.Fatalf("elapsed window: expected dispatch")
+	}
+}
+
+func Test_sliceTracker_expiry(t *testing.T) {
+	now := time.Unix(0, 0)
+	tr := sliceTracker{now: func() time.Time { return now }}
+
+	// The Pods of the first slice are deleted while waiting.
+	tr.observe("ns/js/rj/0", "pod-a", 2, time.Minute)
+	now = now.Add(30 * time.Second)
+	if dispatch, _ := tr.observe("ns/js/rj/1", "pod-c", 2, time.Minute); dispatch {
+		t.Fatalf("first pod of second slice: expected no dispatch")
+	}
+	if _, ok := tr.slices["ns/js/rj/0"]; !ok {
+		t.Fatalf("expected the first slice to be kept within the window")
+	}
+
+	// The waiting Pod of the second slice is requeued when the window ends.
+	now = now.Add(time.Minute)
+	if dispatch, _ := tr.observe("ns/js/rj/1", "pod-c", 2, time.Minute); !dispatch {
+		t.Fatalf("elapsed window: expected dispatch")
+	}
+	if _, ok := tr.slices["ns/js/rj/0"]; !ok {
+		t.Fatalf("expected the first slice to be kept within twice the window")
+	}
+	now = now.Add(30 * time.Second)
+	tr.observe("ns/js/rj/2", "pod-e", 2, time.Minute)
+	if _, ok := tr.slices["ns/js/rj/0"]; ok {
+		t.Fatalf("expected the first slice to be forgotten, got: %v", tr.slices)
+	}
+
+	// Slices in flight are only forgotten by done.
+	now = now.Add(time.Hour)
+	tr.observe("ns/js/rj/3", "pod-g", 2, time.Minute)
+	if _, ok := tr.slices["ns/js/rj/1"]; !ok {
+		t.Fatalf("expected the in-flight slice to be kept")
+	}
+}
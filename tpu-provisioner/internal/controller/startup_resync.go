@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// StartupResync is a one-shot pass, run once the manager has started, that
+// enqueues every Pod that is already pending and unschedulable so that Pods
+// which became stuck while the provisioner was down get node pools. Pods are
+// enqueued at a bounded rate to avoid a thundering herd of node pool
+// creations after a restart.
+//
+// It implements manager.Runnable. Pass Events() to CreationReconciler.Resync.
+type StartupResync struct {
+	Client      client.Client
+	PodCriteria PodCriteria
+
+	// QPS is the rate at which Pods are enqueued.
+	QPS float64
+	// MaxPods is the maximum number of Pods that are enqueued.
+	MaxPods int
+
+	events chan event.GenericEvent
+}
+
+// Events returns the channel that Pods are enqueued on.
+func (s *StartupResync) Events() <-chan event.GenericEvent {
+	if s.events == nil {
+		s.events = make(chan event.GenericEvent)
+	}
+	return s.events
+}
+
+func (s *StartupResync) Start(ctx context.Context) error {
+	if s.QPS <= 0 || s.MaxPods <= 0 {
+		return fmt.Errorf("StartupResync.QPS and MaxPods must be set")
+	}
+	lg := log.FromContext(ctx).WithName("startup-resync")
+	s.Events()
+
+	var pods corev1.PodList
+	if err := s.Client.List(ctx, &pods); err != nil {
+		return fmt.Errorf("listing pods: %w", err)
+	}
+
+	stuck := resyncCandidates(pods.Items, s.PodCriteria)
+	if len(stuck) > s.MaxPods {
+		lg.Info("Too many unschedulable pods, only resyncing some of them", "pods", len(stuck), "maxPods", s.MaxPods)
+		stuck = stuck[:s.MaxPods]
+	}
+	lg.Info("Resyncing unschedulable pods", "pods", len(stuck))
+
+	limiter := rate.NewLimiter(rate.Limit(s.QPS), 1)
+	for _, p := range stuck {
+		if err := limiter.Wait(ctx); err != nil {
+			// Context cancelled, the manager is shutting down.
+			return nil
+		}
+		select {
+		case s.events <- event.GenericEvent{Object: p}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	lg.Info("Finished resyncing unschedulable pods")
+	return nil
+}
+
+// resyncCandidates returns the Pods that the CreationReconciler would act
+// upon: pending, unschedulable and matching the criteria.
+func resyncCandidates(pods []corev1.Pod, criteria PodCriteria) []*corev1.Pod {
+	var out []*corev1.Pod
+	for i := range pods {
+		p := &pods[i]
+		if isPending(p) && isUnschedulable(p) && criteria.matches(p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func Test_resyncCandidates(t *testing.T) {
+	const tpu = "google.com/tpu"
+	pod := func(name string, phase corev1.PodPhase, unschedulable bool, resourceName string) corev1.Pod {
+		p := corev1.Pod{}
+		p.Name = name
+		p.Status.Phase = phase
+		if unschedulable {
+			p.Status.Conditions = []corev1.PodCondition{{
+				Type:   corev1.PodScheduled,
+				Status: corev1.ConditionFalse,
+				Reason: corev1.PodReasonUnschedulable,
+			}}
+		}
+		p.Spec.NodeSelector = map[string]string{cloud.GKETPUNodeSelector: "2x2x1"}
+		p.Spec.Containers = []corev1.Container{{
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceName(resourceName): resource.MustParse("4")},
+			},
+		}}
+		return p
+	}
+
+	pods := []corev1.Pod{
+		pod("stuck", corev1.PodPending, true, tpu),
+		pod("pending", corev1.PodPending, false, tpu),
+		pod("running", corev1.PodRunning, false, tpu),
+		pod("cpu", corev1.PodPending, true, "cpu"),
+	}
+
+	got := resyncCandidates(pods, PodCriteria{ResourceType: tpu})
+	if len(got) != 1 || got[0].Name != "stuck" {
+		t.Fatalf("expected only the stuck pod, got: %v", got)
+	}
+}
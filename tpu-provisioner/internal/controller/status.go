@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// maxRecentFailures is the number of failures kept for the status endpoint.
+const maxRecentFailures = 50
+
+// ProvisioningStatus is a snapshot of what the CreationReconciler is tracking, served
+// as JSON by StatusHandler.
+type ProvisioningStatus struct {
+	Paused         bool            `json:"paused"`
+	Triggers       []StatusPod     `json:"triggers"`
+	InFlight       []StatusPool    `json:"inFlight"`
+	RecentFailures []StatusFailure `json:"recentFailures"`
+}
+
+// StatusPod is a Pod that triggers node pool creation.
+type StatusPod struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Operation is the node pool operation recorded on the Pod, if any.
+	Operation string `json:"operation,omitempty"`
+}
+
+// StatusPool is a node pool that is being ensured, either by a provider
+// call of this process or by an operation that is being polled.
+type StatusPool struct {
+	Name string `json:"name"`
+	// Operation is the operation that is being polled, empty while the
+	// provider call is in progress.
+	Operation string `json:"operation,omitempty"`
+}
+
+// StatusFailure is a failed attempt to ensure a node pool.
+type StatusFailure struct {
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	Pod       string    `json:"pod"`
+	NodePool  string    `json:"nodePool,omitempty"`
+	Category  string    `json:"category"`
+	Error     string    `json:"error"`
+}
+
+// failureLog keeps the most recent failures.
+type failureLog struct {
+	mtx      sync.Mutex
+	failures []StatusFailure
+}
+
+func (l *failureLog) record(f StatusFailure) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.failures = append(l.failures, f)
+	if len(l.failures) > maxRecentFailures {
+		l.failures = l.failures[len(l.failures)-maxRecentFailures:]
+	}
+}
+
+// recent returns the failures, most recent first.
+func (l *failureLog) recent() []StatusFailure {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	out := make([]StatusFailure, 0, len(l.failures))
+	for i := len(l.failures) - 1; i >= 0; i-- {
+		out = append(out, l.failures[i])
+	}
+	return out
+}
+
+// recordFailure records a failure to ensure the node pool of the Pod for the
+// status endpoint.
+func (r *CreationReconciler) recordFailure(pod *corev1.Pod, nodePoolName string, err error) {
+	r.failures.record(StatusFailure{
+		Time:      time.Now().UTC(),
+		Namespace: pod.Namespace,
+		Pod:       pod.Name,
+		NodePool:  nodePoolName,
+		Category:  cloud.ErrorCategory(err),
+		Error:     truncateError(err),
+	})
+}
+
+// inFlight returns the keys of the calls in flight.
+func (f *ensureFlights) inFlight() []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	keys := make([]string, 0, len(f.calls))
+	for k := range f.calls {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// ProvisioningStatus returns a snapshot of the provisioning state. Pods are read from the
+// cache.
+func (r *CreationReconciler) ProvisioningStatus(ctx context.Context) (*ProvisioningStatus, error) {
+	paused, err := r.PauseSwitch.paused(ctx, r.Client)
+	if err != nil {
+		return nil, err
+	}
+	s := &ProvisioningStatus{
+		Paused:         paused,
+		Triggers:       []StatusPod{},
+		InFlight:       []StatusPool{},
+		RecentFailures: r.failures.recent(),
+	}
+	seen := map[string]bool{}
+	for _, name := range r.flights.inFlight() {
+		seen[name] = true
+		s.InFlight = append(s.InFlight, StatusPool{Name: name})
+	}
+
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods); err != nil {
+		return nil, fmt.Errorf("listing pods: %w", err)
+	}
+	for i := range pods.Items {
+		p := &pods.Items[i]
+		op := p.Annotations[cloud.AnnotationNodePoolOperation]
+		if _, pending := p.Annotations[cloud.AnnotationNodePoolOperationStarted]; pending {
+			// The Pods of a slice share the node pool and its operation.
+			if name, err := nodePoolNameForPod(r.Provider, p); err == nil && !seen[name] {
+				seen[name] = true
+				s.InFlight = append(s.InFlight, StatusPool{Name: name, Operation: op})
+			}
+		}
+		if _, reason := auditCriteria(p, r.PodCriteria); reason == "" && r.NamespaceFilter.allows(p.Namespace) {
+			s.Triggers = append(s.Triggers, StatusPod{Namespace: p.Namespace, Name: p.Name, Operation: op})
+		}
+	}
+	sort.Slice(s.Triggers, func(i, j int) bool {
+		if s.Triggers[i].Namespace != s.Triggers[j].Namespace {
+			return s.Triggers[i].Namespace < s.Triggers[j].Namespace
+		}
+		return s.Triggers[i].Name < s.Triggers[j].Name
+	})
+	sort.Slice(s.InFlight, func(i, j int) bool { return s.InFlight[i].Name < s.InFlight[j].Name })
+	return s, nil
+}
+
+// StatusHandler serves the ProvisioningStatus as JSON. It only accepts GET requests and
+// is meant to be registered on the metrics server.
+func (r *CreationReconciler) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s, err := r.ProvisioningStatus(req.Context())
+		if err != nil {
+			log.FromContext(req.Context()).Error(err, "Failed to get provisioning status")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(s); err != nil {
+			log.FromContext(req.Context()).Error(err, "Failed to write provisioning status")
+		}
+	})
+}
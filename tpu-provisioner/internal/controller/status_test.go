@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// podLister serves a fixed list of Pods, other calls panic.
+type podLister struct {
+	client.Client
+	pods []corev1.Pod
+}
+
+func (l *podLister) List(_ context.Context, list client.ObjectList, _ ...client.ListOption) error {
+	pl, ok := list.(*corev1.PodList)
+	if !ok {
+		return errors.New("not implemented")
+	}
+	pl.Items = append([]corev1.Pod(nil), l.pods...)
+	return nil
+}
+
+func Test_CreationReconciler_ProvisioningStatus(t *testing.T) {
+	isController := true
+	pod := func(name string, mutate func(*corev1.Pod)) corev1.Pod {
+		p := corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Job", Name: name, UID: "0123456789abcdef", Controller: &isController},
+			},
+		}}
+		p.Status.Phase = corev1.PodPending
+		p.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: corev1.PodReasonUnschedulable}}
+		p.Spec.NodeSelector = map[string]string{
+			cloud.GKETPUNodeSelector:         "2x2x1",
+			cloud.GKEAcceleratorNodeSelector: cloud.V4PodSliceAccelerator,
+		}
+		p.Spec.Containers = []corev1.Container{{Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{cloud.GoogleTPUResource: resource.MustParse("4")},
+		}}}
+		if mutate != nil {
+			mutate(&p)
+		}
+		return p
+	}
+	pending := pod("train-b", func(p *corev1.Pod) {
+		p.Annotations = map[string]string{
+			cloud.AnnotationNodePoolOperation:        "operation-1",
+			cloud.AnnotationNodePoolOperationStarted: "2023-01-01T00:00:00Z",
+		}
+	})
+
+	provider := &cloud.Fake{}
+	r := &CreationReconciler{
+		Client: &podLister{pods: []corev1.Pod{
+			pod("train-a", nil),
+			pending,
+			pod("web", func(p *corev1.Pod) { p.Spec.Containers = nil }),
+		}},
+		Provider:    provider,
+		PodCriteria: PodCriteria{ResourceType: cloud.GoogleTPUResource},
+	}
+	failed := pod("train-c", nil)
+	r.recordFailure(&failed, "np-c", fmt.Errorf("%w: TPUS_PER_REGION", cloud.ErrQuotaExceeded))
+
+	s, err := r.ProvisioningStatus(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Paused {
+		t.Fatalf("expected not paused")
+	}
+	if len(s.Triggers) != 2 || s.Triggers[0].Name != "train-a" || s.Triggers[1].Name != "train-b" || s.Triggers[1].Operation != "operation-1" {
+		t.Fatalf("unexpected triggers: %+v", s.Triggers)
+	}
+	pendingPool, err := provider.NodePoolNameForPod(&pending)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(s.InFlight) != 1 || s.InFlight[0] != (StatusPool{Name: pendingPool, Operation: "operation-1"}) {
+		t.Fatalf("unexpected node pools in flight: %+v", s.InFlight)
+	}
+	if len(s.RecentFailures) != 1 || s.RecentFailures[0].Pod != "train-c" || s.RecentFailures[0].Category != cloud.ErrorCategoryQuota {
+		t.Fatalf("unexpected failures: %+v", s.RecentFailures)
+	}
+
+	rec := httptest.NewRecorder()
+	r.StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got: %d", http.StatusOK, rec.Code)
+	}
+	var got ProvisioningStatus
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if len(got.Triggers) != 2 || len(got.InFlight) != 1 || len(got.RecentFailures) != 1 {
+		t.Fatalf("unexpected response: %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	r.StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/status", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status %d for POST, got: %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
+
+func Test_failureLog(t *testing.T) {
+	var l failureLog
+	for i := 0; i < maxRecentFailures+10; i++ {
+		l.record(StatusFailure{Pod: fmt.Sprint(i)})
+	}
+	got := l.recent()
+	if len(got) != maxRecentFailures {
+		t.Fatalf("expected %d failures, got: %d", maxRecentFailures, len(got))
+	}
+	if exp := fmt.Sprint(maxRecentFailures + 9); got[0].Pod != exp {
+		t.Fatalf("expected most recent failure %s first, got: %s", exp, got[0].Pod)
+	}
+}
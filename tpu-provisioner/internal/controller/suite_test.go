@@ -45,6 +45,8 @@ var (
 	provider  = &testProvider{
 		created: make(map[types.NamespacedName]bool),
 		deleted: make(map[string]time.Time),
+
+		deletedPools: make(map[string]time.Time),
 	}
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -53,6 +55,8 @@ var (
 const (
 	resourceName    = "test.com/tpu"
 	minNodeLifetime = time.Second
+	gcInterval      = 250 * time.Millisecond
+	gcIdleDuration  = time.Second
 )
 
 func TestAPIs(t *testing.T) {
@@ -108,6 +112,15 @@ var _ = BeforeSuite(func() {
 	}).SetupWithManager(mgr)
 	Expect(err).ToNot(HaveOccurred())
 
+	err = mgr.Add(&NodePoolGarbageCollector{
+		Client:       mgr.GetClient(),
+		Recorder:     mgr.GetEventRecorderFor("tpu-provisioner-gc"),
+		Provider:     provider,
+		Interval:     gcInterval,
+		IdleDuration: gcIdleDuration,
+	})
+	Expect(err).ToNot(HaveOccurred())
+
 	go func() {
 		defer GinkgoRecover()
 		err = mgr.Start(ctx)
@@ -0,0 +1,227 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Actions of a NodePoolSweep, see the sweep_actions_total metric.
+const (
+	sweepActionResync       = "resync"
+	sweepActionDeleteOrphan = "delete_orphan"
+	sweepActionFailed       = "failed"
+)
+
+// NodePoolSweep periodically compares the node pools of the provisioner with
+// the cluster, as a level-based safety net for what the event driven
+// controllers missed, for example while the provisioner was down:
+//
+//   - Pods that are still pending and unschedulable are reconciled again,
+//     which polls their node pool operations and recreates drifted node
+//     pools like any other reconcile.
+//   - Orphaned node pools, that failed to be created more than
+//     OrphanGracePeriod ago, or that are not autoscaled and have had no
+//     Nodes for OrphanGracePeriod, are deleted so that their Pods get a new
+//     node pool.
+//
+// Actions are taken at a bounded rate, and at most MaxActions per sweep, to
+// avoid spikes of API calls. The sweep only runs on the leader.
+//
+// It implements manager.Runnable. Pass Events() to CreationReconciler.Sweep.
+type NodePoolSweep struct {
+	Client      client.Client
+	Provider    cloud.Provider
+	PodCriteria PodCriteria
+
+	// Interval is the time between sweeps.
+	Interval time.Duration
+	// OrphanGracePeriod is how old a failed node pool, and how long a node
+	// pool without Nodes, must be before it is deleted as an orphan. Zero
+	// never deletes orphaned node pools.
+	OrphanGracePeriod time.Duration
+	// QPS is the rate at which actions are taken.
+	QPS float64
+	// MaxActions is the maximum number of actions per sweep.
+	MaxActions int
+	// DryRun logs the orphaned node pools that would be deleted without
+	// deleting them.
+	DryRun bool
+
+	// Tracer, if set, traces the provider calls of the sweeps.
+	Tracer Tracer
+
+	events chan event.GenericEvent
+	now    func() time.Time
+	// nodelessSince tracks when each node pool was first seen without
+	// Nodes.
+	nodelessSince map[string]time.Time
+}
+
+// Events returns the channel that Pods are enqueued on.
+func (s *NodePoolSweep) Events() <-chan event.GenericEvent {
+	if s.events == nil {
+		s.events = make(chan event.GenericEvent)
+	}
+	return s.events
+}
+
+// Start sweeps until the context is cancelled.
+func (s *NodePoolSweep) Start(ctx context.Context) error {
+	if s.Interval <= 0 || s.QPS <= 0 || s.MaxActions <= 0 {
+		return fmt.Errorf("NodePoolSweep.Interval, QPS and MaxActions must be set")
+	}
+	s.Events()
+
+	t := time.NewTicker(s.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			if err := s.sweep(ctx); err != nil {
+				log.FromContext(ctx).Error(err, "sweeping node pools")
+			}
+		}
+	}
+}
+
+// NeedLeaderElection returns true, only the leader acts on node pools.
+// It implements manager.LeaderElectionRunnable.
+func (s *NodePoolSweep) NeedLeaderElection() bool {
+	return true
+}
+
+func (s *NodePoolSweep) sweep(ctx context.Context) error {
+	lg := log.FromContext(ctx).WithName("nodepool-sweep")
+	start := s.clock()
+	defer func() { sweepDuration.Observe(s.clock().Sub(start).Seconds()) }()
+
+	pools, err := tracedProvider(ctx, s.Tracer, s.Provider).ListNodePools()
+	if err != nil {
+		return fmt.Errorf("listing node pools: %w", err)
+	}
+	var nodes corev1.NodeList
+	if err := s.Client.List(ctx, &nodes, client.MatchingLabels(s.Provider.NodePoolOwner().NodeLabels())); err != nil {
+		return fmt.Errorf("listing nodes: %w", err)
+	}
+	var pods corev1.PodList
+	if err := s.Client.List(ctx, &pods); err != nil {
+		return fmt.Errorf("listing pods: %w", err)
+	}
+
+	statuses := map[string]float64{}
+	for _, p := range pools {
+		statuses[p.Status]++
+	}
+	managedNodePools.Reset()
+	for status, n := range statuses {
+		managedNodePools.WithLabelValues(status).Set(n)
+	}
+
+	orphans := s.orphans(pools, nodes.Items)
+	stuck := resyncCandidates(pods.Items, s.PodCriteria)
+	lg.V(1).Info("Sweeping node pools", "nodePools", len(pools), "orphans", len(orphans), "pods", len(stuck))
+
+	limiter := rate.NewLimiter(rate.Limit(s.QPS), 1)
+	actions := 0
+	act := func() bool {
+		if actions >= s.MaxActions {
+			return false
+		}
+		actions++
+		// Only fails once the context is cancelled.
+		return limiter.Wait(ctx) == nil
+	}
+
+	for _, name := range orphans {
+		if s.DryRun {
+			lg.Info("Dry run: would delete orphaned node pool", "nodePool", name)
+			continue
+		}
+		if !act() {
+			lg.Info("Too many actions, continuing with the next sweep", "maxActions", s.MaxActions)
+			return nil
+		}
+		lg.Info("Deleting orphaned node pool", "nodePool", name)
+		if err := tracedProvider(ctx, s.Tracer, s.Provider).DeleteNodePool(name); err != nil {
+			sweepActions.WithLabelValues(sweepActionFailed).Inc()
+			lg.Error(err, "deleting orphaned node pool", "nodePool", name)
+			continue
+		}
+		sweepActions.WithLabelValues(sweepActionDeleteOrphan).Inc()
+	}
+
+	for _, p := range stuck {
+		if !act() {
+			lg.Info("Too many actions, continuing with the next sweep", "maxActions", s.MaxActions)
+			return nil
+		}
+		select {
+		case s.events <- event.GenericEvent{Object: p}:
+			sweepActions.WithLabelValues(sweepActionResync).Inc()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+// orphans returns the names of the node pools without Nodes that will not
+// get any: those that failed to be created more than OrphanGracePeriod ago,
+// and those that are not autoscaled but have had no Nodes for the
+// OrphanGracePeriod, measured from the sweep that first saw them without
+// Nodes. Failed node pools of unknown age, and node pools that are still
+// being created or updated, are never orphans.
+func (s *NodePoolSweep) orphans(pools []cloud.NodePoolInfo, nodes []corev1.Node) []string {
+	if s.OrphanGracePeriod <= 0 {
+		return nil
+	}
+	key := s.Provider.NodePoolLabelKey()
+	hasNodes := map[string]bool{}
+	for _, n := range nodes {
+		hasNodes[n.Labels[key]] = true
+	}
+	now := s.clock()
+	nodeless := map[string]time.Time{}
+	var out []string
+	for _, p := range pools {
+		if hasNodes[p.Name] {
+			continue
+		}
+		since, ok := s.nodelessSince[p.Name]
+		if !ok {
+			since = now
+		}
+		nodeless[p.Name] = since
+		switch {
+		case p.Status == cloud.NodePoolStatusError:
+			if !p.CreatedAt.IsZero() && now.Sub(p.CreatedAt) >= s.OrphanGracePeriod {
+				out = append(out, p.Name)
+			}
+		case p.Status == cloud.NodePoolStatusRunning && !p.Autoscaled && p.NodeCount > 0:
+			if now.Sub(since) >= s.OrphanGracePeriod {
+				out = append(out, p.Name)
+			}
+		}
+	}
+	// Node pools that got Nodes again, or are gone, are forgotten.
+	s.nodelessSince = nodeless
+	return out
+}
+
+func (s *NodePoolSweep) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_NodePoolSweep_orphans(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-time.Hour)
+	provider := &testProvider{}
+	node := func(pool string) corev1.Node {
+		return corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{provider.NodePoolLabelKey(): pool}}}
+	}
+
+	pools := []cloud.NodePoolInfo{
+		{Name: "running", CreatedAt: old, NodeCount: 2, Status: cloud.NodePoolStatusRunning},
+		{Name: "failed", CreatedAt: old, NodeCount: 2, Status: cloud.NodePoolStatusError},
+		{Name: "lost-nodes", CreatedAt: old, NodeCount: 2, Status: cloud.NodePoolStatusRunning},
+		{Name: "scaled-to-zero", CreatedAt: old, NodeCount: 2, Autoscaled: true, Status: cloud.NodePoolStatusRunning},
+		{Name: "created-empty", CreatedAt: old, Status: cloud.NodePoolStatusRunning},
+		{Name: "provisioning", CreatedAt: old, NodeCount: 2, Status: "PROVISIONING"},
+		{Name: "recent", CreatedAt: now.Add(-time.Minute), NodeCount: 2, Status: cloud.NodePoolStatusError},
+		{Name: "unknown-age", NodeCount: 2, Status: cloud.NodePoolStatusError},
+	}
+	nodes := []corev1.Node{node("running"), node("running")}
+
+	clock := now
+	s := &NodePoolSweep{Provider: provider, OrphanGracePeriod: 30 * time.Minute, now: func() time.Time { return clock }}
+	// The grace period of node pools that lost their Nodes starts when the
+	// sweep first sees them without Nodes, not when they were created.
+	if exp, got := "[failed]", fmt.Sprint(s.orphans(pools, nodes)); exp != got {
+		t.Fatalf("first sweep: expected: %v, got: %v", exp, got)
+	}
+	clock = now.Add(29 * time.Minute)
+	if exp, got := "[failed recent]", fmt.Sprint(s.orphans(pools, nodes)); exp != got {
+		t.Fatalf("within the grace period: expected: %v, got: %v", exp, got)
+	}
+	clock = now.Add(30 * time.Minute)
+	if exp, got := "[failed lost-nodes recent]", fmt.Sprint(s.orphans(pools, nodes)); exp != got {
+		t.Fatalf("after the grace period: expected: %v, got: %v", exp, got)
+	}
+
+	// A node pool that gets Nodes again starts over.
+	s.orphans(pools, append(nodes, node("lost-nodes")))
+	clock = now.Add(40 * time.Minute)
+	if exp, got := "[failed recent]", fmt.Sprint(s.orphans(pools, nodes)); exp != got {
+		t.Fatalf("after Nodes came back: expected: %v, got: %v", exp, got)
+	}
+
+	s.OrphanGracePeriod = 0
+	if got := s.orphans(pools, nodes); len(got) != 0 {
+		t.Fatalf("expected no orphans without a grace period, got: %v", got)
+	}
+}
@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Tracer starts the spans of reconciles and provider calls. It is the
+// provisioner's own minimal interface, not an OpenTelemetry API: attributes
+// are strings and a span records a single error. A nil Tracer starts no-op
+// spans.
+type Tracer interface {
+	// StartSpan starts a span that is a child of the span in ctx, if any,
+	// and returns a context that carries it.
+	StartSpan(ctx context.Context, name string, attrs ...SpanAttribute) (context.Context, Span)
+}
+
+// Tracers that can be configured without injecting one.
+const (
+	// TracerNone starts no-op spans.
+	TracerNone = "none"
+	// TracerLog logs the spans, see LogTracer.
+	TracerLog = "log"
+)
+
+var tracers = []string{TracerNone, TracerLog}
+
+// NewTracer returns the named Tracer, nil for TracerNone, or an error if the
+// name is not known.
+func NewTracer(name string) (Tracer, error) {
+	switch name {
+	case TracerNone:
+		return nil, nil
+	case TracerLog:
+		return LogTracer{}, nil
+	}
+	return nil, fmt.Errorf("unknown tracer %q, must be one of %q", name, tracers)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// Annotate adds attributes to the span.
+	Annotate(attrs ...SpanAttribute)
+	// Fail records the error and marks the span as failed.
+	Fail(err error)
+	End()
+}
+
+// SpanAttribute is a key-value attribute of a span.
+type SpanAttribute struct {
+	Key, Value string
+}
+
+// Span attribute keys. Tooling can rely on these keys, like on the event
+// fields.
+const (
+	spanAttrNodePool    = "tpu_provisioner.node_pool"
+	spanAttrAccelerator = "tpu_provisioner.accelerator"
+	spanAttrTopology    = "tpu_provisioner.topology"
+	spanAttrOperation   = "tpu_provisioner.operation"
+	spanAttrPod         = "tpu_provisioner.pod"
+	spanAttrResult      = "tpu_provisioner.result"
+)
+
+// Results of provider call spans.
+const (
+	spanResultSuccess   = "success"
+	spanResultPending   = "pending"
+	spanResultDuplicate = "duplicate"
+	spanResultError     = "error"
+)
+
+// startSpan starts a span with the tracer, or a no-op span if it is nil.
+func startSpan(ctx context.Context, t Tracer, name string, attrs ...SpanAttribute) (context.Context, Span) {
+	if t == nil {
+		return ctx, noopSpan{}
+	}
+	return t.StartSpan(ctx, name, attrs...)
+}
+
+// endSpan records the result of the call and ends the span.
+func endSpan(span Span, result string, err error) {
+	if err != nil {
+		span.Fail(err)
+		if result == spanResultSuccess {
+			result = spanResultError
+		}
+		if errors.Is(err, cloud.ErrDuplicateRequest) {
+			result = spanResultDuplicate
+		}
+	}
+	span.Annotate(SpanAttribute{spanAttrResult, result})
+	span.End()
+}
+
+type noopSpan struct{}
+
+func (noopSpan) Annotate(...SpanAttribute) {}
+func (noopSpan) Fail(error)                {}
+func (noopSpan) End()                      {}
+
+// tracingProvider starts a span, as a child of the span in ctx, around each
+// provider call that talks to the cloud.
+type tracingProvider struct {
+	cloud.Provider
+	ctx    context.Context
+	tracer Tracer
+}
+
+// tracedProvider returns the provider with its calls traced as children of
+// the span in ctx, or the provider itself if the tracer is nil.
+func tracedProvider(ctx context.Context, t Tracer, p cloud.Provider) cloud.Provider {
+	if t == nil {
+		return p
+	}
+	return &tracingProvider{Provider: p, ctx: ctx, tracer: t}
+}
+
+func (p *tracingProvider) EnsureNodePoolForPod(pod *corev1.Pod, r cloud.NodePoolRequest) (*cloud.NodePoolOperation, error) {
+	name, _ := nodePoolNameForPod(p.Provider, pod)
+	topo := r.Topology
+	if topo == "" {
+		topo = cloud.NodeSelectorForPod(pod)[cloud.GKETPUNodeSelector]
+	}
+	_, span := p.tracer.StartSpan(p.ctx, "EnsureNodePoolForPod",
+		SpanAttribute{spanAttrPod, pod.Namespace + "/" + pod.Name},
+		SpanAttribute{spanAttrNodePool, name},
+		SpanAttribute{spanAttrAccelerator, podAccelerator(pod)},
+		SpanAttribute{spanAttrTopology, topo})
+	op, err := p.Provider.EnsureNodePoolForPod(pod, r)
+	result := spanResultSuccess
+	if op != nil {
+		span.Annotate(SpanAttribute{spanAttrOperation, op.Name})
+		if op.NodePool != "" && op.NodePool != name {
+			span.Annotate(SpanAttribute{spanAttrNodePool, op.NodePool})
+		}
+		if op.Pending {
+			result = spanResultPending
+		}
+	}
+	endSpan(span, result, err)
+	return op, err
+}
+
+func (p *tracingProvider) PollNodePoolOperation(name string) (bool, error) {
+	_, span := p.tracer.StartSpan(p.ctx, "PollNodePoolOperation", SpanAttribute{spanAttrOperation, name})
+	done, err := p.Provider.PollNodePoolOperation(name)
+	result := spanResultSuccess
+	if !done {
+		result = spanResultPending
+	}
+	endSpan(span, result, err)
+	return done, err
+}
+
+func (p *tracingProvider) DeleteNodePoolForNode(node *corev1.Node) error {
+	_, span := p.tracer.StartSpan(p.ctx, "DeleteNodePool", SpanAttribute{spanAttrNodePool, node.Labels[p.Provider.NodePoolLabelKey()]})
+	err := p.Provider.DeleteNodePoolForNode(node)
+	endSpan(span, spanResultSuccess, err)
+	return err
+}
+
+func (p *tracingProvider) DeleteNodePool(name string) error {
+	_, span := p.tracer.StartSpan(p.ctx, "DeleteNodePool", SpanAttribute{spanAttrNodePool, name})
+	err := p.Provider.DeleteNodePool(name)
+	endSpan(span, spanResultSuccess, err)
+	return err
+}
+
+func (p *tracingProvider) ListNodePools() ([]cloud.NodePoolInfo, error) {
+	_, span := p.tracer.StartSpan(p.ctx, "ListNodePools")
+	nps, err := p.Provider.ListNodePools()
+	endSpan(span, spanResultSuccess, err)
+	return nps, err
+}
+
+// LogTracer is a Tracer that logs each span when it ends, with its duration
+// and attributes, at verbosity 1.
+type LogTracer struct{}
+
+func (LogTracer) StartSpan(ctx context.Context, name string, attrs ...SpanAttribute) (context.Context, Span) {
+	s := &logSpan{ctx: ctx, name: name, start: time.Now(), attrs: attrs}
+	if parent, ok := ctx.Value(logSpanKey{}).(*logSpan); ok {
+		s.parent = parent.name
+	}
+	return context.WithValue(ctx, logSpanKey{}, s), s
+}
+
+type logSpanKey struct{}
+
+type logSpan struct {
+	ctx    context.Context
+	name   string
+	parent string
+	start  time.Time
+	attrs  []SpanAttribute
+	err    error
+}
+
+func (s *logSpan) Annotate(attrs ...SpanAttribute) { s.attrs = append(s.attrs, attrs...) }
+func (s *logSpan) Fail(err error)                  { s.err = err }
+
+func (s *logSpan) End() {
+	kvs := []interface{}{"span", s.name, "parent", s.parent, "duration", time.Since(s.start)}
+	for _, a := range s.attrs {
+		kvs = append(kvs, a.Key, a.Value)
+	}
+	if s.err != nil {
+		kvs = append(kvs, "error", s.err.Error())
+	}
+	log.FromContext(s.ctx).WithName("trace").V(1).Info("Span ended", kvs...)
+}
@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// recordingTracer records the spans that ended, with the name of their
+// parent span.
+type recordingTracer struct {
+	ended []*recordedSpan
+}
+
+type spanKey struct{}
+
+type recordedSpan struct {
+	t      *recordingTracer
+	name   string
+	parent string
+	attrs  map[string]string
+	err    error
+}
+
+func (t *recordingTracer) StartSpan(ctx context.Context, name string, attrs ...SpanAttribute) (context.Context, Span) {
+	s := &recordedSpan{t: t, name: name, attrs: map[string]string{}}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		s.parent = parent.name
+	}
+	s.Annotate(attrs...)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *recordedSpan) Annotate(attrs ...SpanAttribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+func (s *recordedSpan) Fail(err error) { s.err = err }
+func (s *recordedSpan) End()           { s.t.ended = append(s.t.ended, s) }
+
+type failingProvider struct {
+	cloud.Mock
+}
+
+func (*failingProvider) DeleteNodePool(string) error { return cloud.ErrDuplicateRequest }
+
+func TestTracedProvider(t *testing.T) {
+	tracer := &recordingTracer{}
+	ctx, span := startSpan(context.Background(), tracer, "Reconcile")
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "w-0"},
+		Spec: corev1.PodSpec{NodeSelector: map[string]string{
+			cloud.GKEAcceleratorNodeSelector: "tpu-v5-lite-podslice",
+			cloud.GKETPUNodeSelector:         "2x4",
+		}},
+	}
+	p := tracedProvider(ctx, tracer, &failingProvider{})
+	if _, err := p.EnsureNodePoolForPod(pod, cloud.NodePoolRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := p.DeleteNodePool("np"); !errors.Is(err, cloud.ErrDuplicateRequest) {
+		t.Fatalf("expected the provider's error, got: %v", err)
+	}
+	endSpan(span, spanResultSuccess, nil)
+
+	if len(tracer.ended) != 3 {
+		t.Fatalf("expected 3 spans, got: %d", len(tracer.ended))
+	}
+	ensure, del, reconcile := tracer.ended[0], tracer.ended[1], tracer.ended[2]
+	if ensure.name != "EnsureNodePoolForPod" || ensure.parent != "Reconcile" {
+		t.Fatalf("expected the ensure span to be a child of the reconcile span, got: %+v", ensure)
+	}
+	for k, v := range map[string]string{
+		spanAttrNodePool:    "mock",
+		spanAttrAccelerator: "tpu-v5-lite-podslice",
+		spanAttrTopology:    "2x4",
+		spanAttrResult:      spanResultSuccess,
+	} {
+		if ensure.attrs[k] != v {
+			t.Errorf("expected %s=%s, got: %v", k, v, ensure.attrs)
+		}
+	}
+	if del.attrs[spanAttrResult] != spanResultDuplicate || del.err == nil {
+		t.Errorf("expected the delete span to record the error, got: %+v", del)
+	}
+	if reconcile.parent != "" || reconcile.attrs[spanAttrResult] != spanResultSuccess {
+		t.Errorf("unexpected reconcile span: %+v", reconcile)
+	}
+
+	provider := &failingProvider{}
+	if p := tracedProvider(ctx, nil, provider); p != provider {
+		t.Fatalf("expected the provider itself without a tracer, got: %T", p)
+	}
+}
+
+func TestNewTracer(t *testing.T) {
+	if tr, err := NewTracer(TracerNone); tr != nil || err != nil {
+		t.Fatalf("expected no tracer, got: %v, %v", tr, err)
+	}
+	if tr, err := NewTracer(TracerLog); tr == nil || err != nil {
+		t.Fatalf("expected the log tracer, got: %v, %v", tr, err)
+	}
+	if _, err := NewTracer("otlp"); err == nil {
+		t.Fatal("expected an error for an unknown tracer")
+	}
+}
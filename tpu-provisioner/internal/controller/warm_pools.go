@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// WarmNodePoolRefiller periodically refills the warm node pools of the
+// provider, see cloud.GKE.WarmNodePools. Pods claim warm node pools when the
+// CreationReconciler ensures their node pool.
+type WarmNodePoolRefiller struct {
+	Provider cloud.WarmNodePoolRefiller
+
+	// Interval is the time between refills.
+	Interval time.Duration
+}
+
+// Start refills the warm node pools until the context is cancelled.
+// It implements manager.Runnable.
+func (r *WarmNodePoolRefiller) Start(ctx context.Context) error {
+	if r.Interval == 0 {
+		return fmt.Errorf("WarmNodePoolRefiller.Interval must be set")
+	}
+
+	t := time.NewTicker(r.Interval)
+	defer t.Stop()
+	for {
+		if err := r.Provider.RefillWarmNodePools(); err != nil {
+			log.FromContext(ctx).Error(err, "refilling warm node pools")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// warmNodePool returns true if the Nodes belong to an available warm node
+// pool, which is idle until it is claimed.
+func warmNodePool(nodes []corev1.Node) bool {
+	for i := range nodes {
+		if nodes[i].Labels[cloud.LabelWarmNodePool] == cloud.WarmNodePoolAvailable {
+			return true
+		}
+	}
+	return false
+}
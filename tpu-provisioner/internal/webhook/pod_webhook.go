@@ -0,0 +1,106 @@
+// Package webhook implements opt-in admission webhooks that default and
+// validate the node pool related settings of TPU Pods, so that broken Pods
+// are rejected when they are created instead of failing to provision later.
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+//+kubebuilder:webhook:path=/mutate-v1-pod,mutating=true,failurePolicy=ignore,sideEffects=None,groups="",resources=pods,verbs=create,versions=v1,name=mpod.tpu-provisioner.google.com,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-v1-pod,mutating=false,failurePolicy=ignore,sideEffects=None,groups="",resources=pods,verbs=create,versions=v1,name=vpod.tpu-provisioner.google.com,admissionReviewVersions=v1
+
+// PodDefaulter sets the optional node pool annotations of TPU Pods that are
+// not set to the provisioner defaults, so that the effective settings are
+// visible on the Pod.
+type PodDefaulter struct {
+	Decoder *admission.Decoder
+
+	// DiskSizeGB is the default boot disk size, zero for none.
+	DiskSizeGB int64
+	// Spot is whether node pools use Spot VMs by default.
+	Spot bool
+}
+
+func (d *PodDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	var pod corev1.Pod
+	if err := d.Decoder.Decode(req, &pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if !isTPUPod(&pod) || !d.setDefaults(&pod) {
+		return admission.Allowed("")
+	}
+	marshaled, err := json.Marshal(&pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// setDefaults returns true if the Pod was changed.
+func (d *PodDefaulter) setDefaults(p *corev1.Pod) bool {
+	var changed bool
+	set := func(key, value string) {
+		if _, ok := p.Annotations[key]; ok {
+			return
+		}
+		if p.Annotations == nil {
+			p.Annotations = map[string]string{}
+		}
+		p.Annotations[key] = value
+		changed = true
+	}
+
+	if d.DiskSizeGB > 0 {
+		set(cloud.AnnotationDiskSizeGB, strconv.FormatInt(d.DiskSizeGB, 10))
+	}
+	// The spot node selector would be overridden by the annotation.
+	if _, ok := cloud.NodeSelectorForPod(p)[cloud.GKESpotNodeSelector]; !ok {
+		set(cloud.AnnotationSpot, strconv.FormatBool(d.Spot))
+	}
+	return changed
+}
+
+// PodValidator rejects TPU Pods for which no node pool can be created, see
+// cloud.ValidatePod.
+type PodValidator struct {
+	Decoder *admission.Decoder
+	// TPUResources are the names of the resources that request TPU chips,
+	// see cloud.ValidateTPUPod.
+	TPUResources []string
+	// IncompleteSelectorPolicy and AcceleratorDefaults complete the TPU
+	// node selectors of Pods that select only one of them, or reject the
+	// Pods, as the provisioner does, see cloud.CompleteTPUSelectors.
+	IncompleteSelectorPolicy string
+	AcceleratorDefaults      map[string]cloud.AcceleratorDefaults
+}
+
+func (v *PodValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	var pod corev1.Pod
+	if err := v.Decoder.Decode(req, &pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if !isTPUPod(&pod) {
+		return admission.Allowed("")
+	}
+	p, err := cloud.CompleteTPUSelectors(&pod, v.IncompleteSelectorPolicy, v.AcceleratorDefaults)
+	if err != nil {
+		return admission.Denied(err.Error())
+	}
+	if err := cloud.ValidatePod(p, v.TPUResources...); err != nil {
+		return admission.Denied(err.Error())
+	}
+	return admission.Allowed("")
+}
+
+func isTPUPod(p *corev1.Pod) bool {
+	return cloud.HasTPUSelector(p)
+}
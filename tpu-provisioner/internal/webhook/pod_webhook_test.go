@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/ai-on-gke/tpu-provisioner/internal/cloud"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func tpuPod(topo string, annotations map[string]string) *corev1.Pod {
+	p := &corev1.Pod{}
+	p.Name = "train-0"
+	p.Annotations = annotations
+	p.Spec.NodeSelector = map[string]string{
+		cloud.GKETPUNodeSelector:         topo,
+		cloud.GKEAcceleratorNodeSelector: cloud.V4PodSliceAccelerator,
+	}
+	p.Spec.Containers = []corev1.Container{{
+		Name: "train",
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{cloud.GoogleTPUResource: resource.MustParse("4")},
+		},
+	}}
+	return p
+}
+
+func withoutNodeSelector(p *corev1.Pod, key string) *corev1.Pod {
+	delete(p.Spec.NodeSelector, key)
+	return p
+}
+
+func request(t *testing.T, p *corev1.Pod) admission.Request {
+	raw, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+}
+
+func decoder(t *testing.T) *admission.Decoder {
+	d, err := admission.NewDecoder(clientgoscheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestPodValidator(t *testing.T) {
+	v := &PodValidator{Decoder: decoder(t)}
+
+	cases := []struct {
+		name    string
+		pod     *corev1.Pod
+		allowed bool
+	}{
+		{name: "non-TPU pod", pod: &corev1.Pod{}, allowed: true},
+		{name: "valid TPU pod", pod: tpuPod("2x2x2", nil), allowed: true},
+		{name: "invalid topology", pod: tpuPod("2x2", nil), allowed: false},
+		{name: "invalid annotation", pod: tpuPod("2x2x2", map[string]string{cloud.AnnotationSpot: "maybe"}), allowed: false},
+		{name: "missing accelerator", pod: withoutNodeSelector(tpuPod("2x2x2", nil), cloud.GKEAcceleratorNodeSelector), allowed: false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp := v.Handle(context.Background(), request(t, c.pod))
+			if resp.Allowed != c.allowed {
+				t.Fatalf("allowed: expected: %v, got: %v (%v)", c.allowed, resp.Allowed, resp.Result)
+			}
+		})
+	}
+}
+
+func TestPodValidator_incompleteSelector(t *testing.T) {
+	v := &PodValidator{
+		Decoder:                  decoder(t),
+		IncompleteSelectorPolicy: cloud.IncompleteSelectorDefault,
+		AcceleratorDefaults:      map[string]cloud.AcceleratorDefaults{cloud.V4PodSliceAccelerator: {Topology: "2x2x2"}},
+	}
+	if resp := v.Handle(context.Background(), request(t, withoutNodeSelector(tpuPod("", nil), cloud.GKETPUNodeSelector))); !resp.Allowed {
+		t.Fatalf("expected the Pod with a default topology to be allowed, got: %v", resp.Result)
+	}
+	v.AcceleratorDefaults[cloud.V4PodSliceAccelerator] = cloud.AcceleratorDefaults{Topology: "2x2"}
+	if resp := v.Handle(context.Background(), request(t, withoutNodeSelector(tpuPod("", nil), cloud.GKETPUNodeSelector))); resp.Allowed {
+		t.Fatal("expected the Pod with an invalid default topology to be denied")
+	}
+}
+
+func TestPodDefaulter(t *testing.T) {
+	d := &PodDefaulter{Decoder: decoder(t), DiskSizeGB: 200, Spot: true}
+
+	resp := d.Handle(context.Background(), request(t, tpuPod("2x2x2", nil)))
+	if !resp.Allowed {
+		t.Fatalf("expected pod to be allowed: %v", resp.Result)
+	}
+	patched := map[string]bool{}
+	for _, op := range resp.Patches {
+		patched[op.Path] = true
+	}
+	if !patched["/metadata/annotations"] {
+		t.Fatalf("expected annotations to be added, got patches: %v", resp.Patches)
+	}
+
+	// Set annotations and the spot node selector win over defaults.
+	p := tpuPod("2x2x2", map[string]string{cloud.AnnotationDiskSizeGB: "500"})
+	p.Spec.NodeSelector[cloud.GKESpotNodeSelector] = "false"
+	if d.setDefaults(p) {
+		t.Fatalf("expected no changes, got annotations: %v", p.Annotations)
+	}
+
+	resp = d.Handle(context.Background(), request(t, &corev1.Pod{}))
+	if !resp.Allowed || len(resp.Patches) != 0 {
+		t.Fatalf("expected non-TPU pod to be allowed unchanged, got: %v", resp)
+	}
+}